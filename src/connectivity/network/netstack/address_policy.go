@@ -0,0 +1,298 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+)
+
+const addressPolicyTagName = "address policy"
+
+// addressPolicy is an entry of the IPv6 address selection policy table
+// described in RFC 6724 section 2.1.
+type addressPolicy struct {
+	prefix     tcpip.Subnet
+	precedence uint8
+	label      uint8
+}
+
+func (p addressPolicy) String() string {
+	return fmt.Sprintf("%s/%d,%d,%d", p.prefix.ID(), p.prefix.Prefix(), p.precedence, p.label)
+}
+
+// defaultAddressPolicies is the default policy table of RFC 6724 section 2.1.
+var defaultAddressPolicies = []addressPolicy{
+	mustParseAddressPolicy("::1/128,50,0"),
+	mustParseAddressPolicy("::/0,40,1"),
+	mustParseAddressPolicy("::ffff:0:0/96,35,4"),
+	mustParseAddressPolicy("2002::/16,30,2"),
+	mustParseAddressPolicy("2001::/32,5,5"),
+	mustParseAddressPolicy("fc00::/7,3,13"),
+	mustParseAddressPolicy("::/96,1,3"),
+	mustParseAddressPolicy("fec0::/10,1,11"),
+	mustParseAddressPolicy("3ffe::/16,1,12"),
+}
+
+// defaultAddressPolicyTable ranks source addresses when no policy table is
+// configured.
+var defaultAddressPolicyTable = newAddressPolicyTable(defaultAddressPolicies)
+
+// parseAddressPolicy parses a policy of the form prefix,precedence,label,
+// e.g. "fc00::/7,3,13".
+func parseAddressPolicy(s string) (addressPolicy, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return addressPolicy{}, fmt.Errorf("%q is not of the form prefix,precedence,label", s)
+	}
+	_, ipNet, err := net.ParseCIDR(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return addressPolicy{}, err
+	}
+	if len(ipNet.Mask) != net.IPv6len {
+		return addressPolicy{}, fmt.Errorf("%s is not an IPv6 prefix", parts[0])
+	}
+	prefix, err := tcpip.NewSubnet(tcpip.Address(ipNet.IP.To16()), tcpip.AddressMask(ipNet.Mask))
+	if err != nil {
+		return addressPolicy{}, err
+	}
+	precedence, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 8)
+	if err != nil {
+		return addressPolicy{}, fmt.Errorf("invalid precedence: %w", err)
+	}
+	label, err := strconv.ParseUint(strings.TrimSpace(parts[2]), 10, 8)
+	if err != nil {
+		return addressPolicy{}, fmt.Errorf("invalid label: %w", err)
+	}
+	return addressPolicy{
+		prefix:     prefix,
+		precedence: uint8(precedence),
+		label:      uint8(label),
+	}, nil
+}
+
+func mustParseAddressPolicy(s string) addressPolicy {
+	p, err := parseAddressPolicy(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// addressPolicyTable selects IPv6 source addresses according to a policy
+// table.
+//
+// The stack already prefers source addresses that match the destination's
+// scope and share the longest prefix with the destination, but it has no
+// notion of labels. The table is used to override the stack's choice when
+// another address on the same interface is preferred by RFC 6724 rule 3
+// (avoid deprecated addresses) or rule 6 (prefer matching label), so that
+// e.g. ULAs are used to reach ULAs.
+type addressPolicyTable struct {
+	// policies is sorted by decreasing prefix length, so that the first
+	// matching policy is the most specific one.
+	policies []addressPolicy
+}
+
+func newAddressPolicyTable(policies []addressPolicy) *addressPolicyTable {
+	t := &addressPolicyTable{
+		policies: append([]addressPolicy(nil), policies...),
+	}
+	sort.SliceStable(t.policies, func(i, j int) bool {
+		return t.policies[i].prefix.Prefix() > t.policies[j].prefix.Prefix()
+	})
+	return t
+}
+
+// Policies returns the policies of the table, most specific first.
+func (t *addressPolicyTable) Policies() []addressPolicy {
+	return append([]addressPolicy(nil), t.policies...)
+}
+
+// lookup returns the policy of the longest prefix that contains addr. An
+// address that no policy matches is given label and precedence 0.
+func (t *addressPolicyTable) lookup(addr tcpip.Address) addressPolicy {
+	for _, p := range t.policies {
+		if p.prefix.Contains(addr) {
+			return p
+		}
+	}
+	return addressPolicy{}
+}
+
+// ipv6Scope returns the scope of addr as defined in RFC 4291 section 2.7 and
+// RFC 6724 section 3.1.
+func ipv6Scope(addr tcpip.Address) uint8 {
+	switch {
+	case header.IsV6MulticastAddress(addr):
+		return addr[1] & 0xf
+	case header.IsV6LinkLocalUnicastAddress(addr), addr == header.IPv6Loopback:
+		return 0x2
+	case addr[0] == 0xfe && addr[1]&0xc0 == 0xc0:
+		// Deprecated site-local addresses, fec0::/10.
+		return 0x5
+	default:
+		return 0xe
+	}
+}
+
+// commonPrefixLen returns the number of leading bits a and b have in common.
+func commonPrefixLen(a, b tcpip.Address) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if x := a[i] ^ b[i]; x != 0 {
+			n := i * 8
+			for x&0x80 == 0 {
+				x <<= 1
+				n++
+			}
+			return n
+		}
+	}
+	return len(a) * 8
+}
+
+// compare returns a positive number if source address a is preferred over b
+// for dst, a negative number if b is preferred, or zero if neither is by RFC
+// 6724 rules 1, 2, 3 and 6.
+func (t *addressPolicyTable) compare(a, b ipv6AddressInfo, dst tcpip.Address) int {
+	// Rule 1: prefer same address.
+	if a.addr.Address == dst {
+		return 1
+	}
+	if b.addr.Address == dst {
+		return -1
+	}
+
+	// Rule 2: prefer appropriate scope.
+	if scopeA, scopeB := ipv6Scope(a.addr.Address), ipv6Scope(b.addr.Address); scopeA != scopeB {
+		scopeDst := ipv6Scope(dst)
+		if scopeA < scopeB {
+			if scopeA < scopeDst {
+				return -1
+			}
+			return 1
+		}
+		if scopeB < scopeDst {
+			return 1
+		}
+		return -1
+	}
+
+	// Rule 3: avoid deprecated addresses.
+	switch {
+	case !a.lifetimes.Deprecated && b.lifetimes.Deprecated:
+		return 1
+	case a.lifetimes.Deprecated && !b.lifetimes.Deprecated:
+		return -1
+	}
+
+	// Rule 6: prefer matching label.
+	labelDst := t.lookup(dst).label
+	matchA, matchB := t.lookup(a.addr.Address).label == labelDst, t.lookup(b.addr.Address).label == labelDst
+	switch {
+	case matchA && !matchB:
+		return 1
+	case matchB && !matchA:
+		return -1
+	}
+	return 0
+}
+
+// findAddressInfo returns the information about addr among addrs. An address
+// that isn't among them is assumed to be preferred.
+func findAddressInfo(addrs []ipv6AddressInfo, addr tcpip.Address) ipv6AddressInfo {
+	for _, info := range addrs {
+		if info.addr.Address == addr {
+			return info
+		}
+	}
+	return ipv6AddressInfo{addr: tcpip.AddressWithPrefix{Address: addr}}
+}
+
+// selectSource returns the source address to use to reach dst, given the
+// address chosen by the stack and the IPv6 addresses of the outgoing
+// interface. The stack's choice is kept unless a candidate is preferred over
+// it; candidates that the table can't distinguish from the stack's choice are
+// ordered by RFC 6724 rule 8 (use longest matching prefix).
+func (t *addressPolicyTable) selectSource(dst, stackChoice tcpip.Address, candidates []ipv6AddressInfo) tcpip.Address {
+	best := findAddressInfo(candidates, stackChoice)
+	for _, c := range candidates {
+		if len(c.addr.Address) != header.IPv6AddressSize || c.addr.Address == best.addr.Address {
+			continue
+		}
+		switch cmp := t.compare(c, best, dst); {
+		case cmp > 0:
+			best = c
+		case cmp == 0 && best.addr.Address != stackChoice && commonPrefixLen(c.addr.Address, dst) > commonPrefixLen(best.addr.Address, dst):
+			best = c
+		}
+	}
+	return best.addr.Address
+}
+
+// addressPolicyFlag is a flag.Value that collects address selection policies.
+type addressPolicyFlag struct {
+	policies []addressPolicy
+}
+
+// String implements flag.Value.String.
+func (f *addressPolicyFlag) String() string {
+	var b strings.Builder
+	for i, p := range f.policies {
+		if i != 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(p.String())
+	}
+	return b.String()
+}
+
+// Set implements flag.Value.Set.
+func (f *addressPolicyFlag) Set(s string) error {
+	p, err := parseAddressPolicy(s)
+	if err != nil {
+		return err
+	}
+	f.policies = append(f.policies, p)
+	return nil
+}
+
+// addressPolicyStats counts source addresses chosen by the policy table.
+type addressPolicyStats struct {
+	// SourceAddressOverrides counts connections whose source address was
+	// chosen by the policy table rather than by the stack.
+	SourceAddressOverrides tcpip.StatCounter
+}
+
+// policySourceAddress returns the source address preferred by the policy
+// table, if one was configured, and the outgoing interface's temporary
+// address preference for connecting to addr, if it differs from the stack's
+// choice.
+func (ns *Netstack) policySourceAddress(addr tcpip.FullAddress) (tcpip.Address, bool) {
+	r, err := ns.stack.FindRoute(addr.NIC, "", addr.Addr, ipv6.ProtocolNumber, false /* multicastLoop */)
+	if err != nil {
+		return "", false
+	}
+	nicID, stackChoice := r.NICID(), r.LocalAddress()
+	r.Release()
+
+	src := stackChoice
+	if ns.addressPolicy != nil {
+		src = ns.addressPolicy.selectSource(addr.Addr, stackChoice, ns.ipv6Addresses(nicID))
+	}
+	if public, ok := ns.publicSourceAddress(nicID, addr.Addr, src); ok {
+		src = public
+	}
+	return src, src != stackChoice
+}
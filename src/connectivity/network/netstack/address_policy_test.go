@@ -0,0 +1,247 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/util"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+func TestParseAddressPolicy(t *testing.T) {
+	for _, s := range []string{"fc00::/7,3,13", "::/0,40,1", " 2001:db8::/32 , 5 , 5 "} {
+		if _, err := parseAddressPolicy(s); err != nil {
+			t.Errorf("parseAddressPolicy(%q) = %s", s, err)
+		}
+	}
+	for _, s := range []string{"", "fc00::/7", "fc00::/7,3", "fc00::,3,13", "10.0.0.0/8,3,13", "fc00::/7,256,13", "fc00::/7,3,-1"} {
+		if p, err := parseAddressPolicy(s); err == nil {
+			t.Errorf("parseAddressPolicy(%q) = %s, want error", s, p)
+		}
+	}
+
+	p := mustParseAddressPolicy("fc00::/7,3,13")
+	if got, want := p.String(), "fc00::/7,3,13"; got != want {
+		t.Errorf("got String() = %s, want = %s", got, want)
+	}
+}
+
+func TestAddressPolicyTableLookup(t *testing.T) {
+	table := newAddressPolicyTable(defaultAddressPolicies)
+	for _, tc := range []struct {
+		addr  string
+		label uint8
+	}{
+		{addr: "::1", label: 0},
+		{addr: "2001::1", label: 5},
+		{addr: "2002::1", label: 2},
+		{addr: "fd00::1", label: 13},
+		{addr: "2600::1", label: 1},
+	} {
+		if got := table.lookup(util.Parse(tc.addr)).label; got != tc.label {
+			t.Errorf("got lookup(%s).label = %d, want = %d", tc.addr, got, tc.label)
+		}
+	}
+
+	empty := newAddressPolicyTable(nil)
+	if got := empty.lookup(util.Parse("2600::1")); got != (addressPolicy{}) {
+		t.Errorf("got lookup on an empty table = %s, want the zero policy", got)
+	}
+}
+
+func TestAddressPolicyTableSelectSource(t *testing.T) {
+	var (
+		global    = util.Parse("2600::2")
+		ula       = util.Parse("fd00::2")
+		otherULA  = util.Parse("fd00:1::2")
+		linkLocal = util.Parse("fe80::2")
+	)
+	infos := func(addrs ...tcpip.Address) []ipv6AddressInfo {
+		var infos []ipv6AddressInfo
+		for _, addr := range addrs {
+			infos = append(infos, ipv6AddressInfo{addr: tcpip.AddressWithPrefix{Address: addr, PrefixLen: 64}})
+		}
+		return infos
+	}
+	deprecatedULA := ipv6AddressInfo{
+		addr:      tcpip.AddressWithPrefix{Address: ula, PrefixLen: 64},
+		lifetimes: stack.AddressLifetimes{Deprecated: true},
+	}
+	table := newAddressPolicyTable(defaultAddressPolicies)
+	for _, tc := range []struct {
+		name        string
+		dst         string
+		stackChoice tcpip.Address
+		candidates  []ipv6AddressInfo
+		want        tcpip.Address
+	}{
+		{
+			name:        "ULA destination prefers ULA source",
+			dst:         "fd00::1",
+			stackChoice: global,
+			candidates:  infos(global, linkLocal, ula),
+			want:        ula,
+		},
+		{
+			name:        "global destination prefers global source",
+			dst:         "2600::1",
+			stackChoice: ula,
+			candidates:  infos(ula, global),
+			want:        global,
+		},
+		{
+			name:        "stack choice is kept on a tie",
+			dst:         "fd00::1",
+			stackChoice: otherULA,
+			candidates:  infos(otherULA, ula),
+			want:        otherULA,
+		},
+		{
+			name:        "longest prefix breaks ties among overrides",
+			dst:         "fd00::1",
+			stackChoice: global,
+			candidates:  infos(global, otherULA, ula),
+			want:        ula,
+		},
+		{
+			name:        "link-local destination prefers link-local source",
+			dst:         "fe80::1",
+			stackChoice: linkLocal,
+			candidates:  infos(global, ula, linkLocal),
+			want:        linkLocal,
+		},
+		{
+			name:        "deprecated address is avoided",
+			dst:         "fd00::1",
+			stackChoice: global,
+			candidates:  append(infos(global), deprecatedULA),
+			want:        global,
+		},
+		{
+			name:        "stack choice is replaced if deprecated",
+			dst:         "fd00::1",
+			stackChoice: ula,
+			candidates:  append(infos(otherULA), deprecatedULA),
+			want:        otherULA,
+		},
+		{
+			name:        "destination address is preferred",
+			dst:         "fd00::2",
+			stackChoice: global,
+			candidates:  infos(global, ula),
+			want:        ula,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := table.selectSource(util.Parse(tc.dst), tc.stackChoice, tc.candidates); got != tc.want {
+				t.Errorf("got selectSource(%s, %s, %s) = %s, want = %s", tc.dst, tc.stackChoice, tc.candidates, got, tc.want)
+			}
+		})
+	}
+
+	// Giving ULAs the same label as global addresses makes the stack's choice
+	// stand.
+	custom := newAddressPolicyTable([]addressPolicy{
+		mustParseAddressPolicy("::/0,40,1"),
+		mustParseAddressPolicy("fc00::/7,45,1"),
+	})
+	if got := custom.selectSource(util.Parse("fd00::1"), global, infos(global, ula)); got != global {
+		t.Errorf("got selectSource with a custom table = %s, want = %s", got, global)
+	}
+}
+
+func TestPolicySourceAddressOnConnect(t *testing.T) {
+	addGoleakCheck(t)
+	var (
+		stackChoice = util.Parse("2600::2")
+		preferred   = util.Parse("2600::ff")
+		dst         = util.Parse("2600::1")
+		otherSrc    = util.Parse("2700::2")
+		otherDst    = util.Parse("2700::1")
+	)
+	ns, _ := newNetstack(t, netstackTestOptions{})
+	// Only the preferred address shares the destination's label.
+	ns.addressPolicy = newAddressPolicyTable([]addressPolicy{
+		mustParseAddressPolicy("2600::1/128,50,5"),
+		mustParseAddressPolicy("2600::ff/128,50,5"),
+	})
+	ifs := installAndValidateIface(t, ns, addNoopEndpoint)
+	otherIfs := installAndValidateIface(t, ns, addNoopEndpoint)
+	for _, a := range []struct {
+		ifs  *ifState
+		addr tcpip.Address
+	}{
+		{ifs: ifs, addr: stackChoice},
+		{ifs: ifs, addr: preferred},
+		{ifs: otherIfs, addr: otherSrc},
+	} {
+		addAddressAndRoute(t, ns, a.ifs, tcpip.ProtocolAddress{
+			Protocol:          header.IPv6ProtocolNumber,
+			AddressWithPrefix: tcpip.AddressWithPrefix{Address: a.addr, PrefixLen: 64},
+		})
+	}
+
+	newEndpoint := func(transProto tcpip.TransportProtocolNumber) *endpoint {
+		t.Helper()
+		wq := new(waiter.Queue)
+		ep, err := ns.stack.NewEndpoint(transProto, ipv6.ProtocolNumber, wq)
+		if err != nil {
+			t.Fatalf("NewEndpoint(%d, ipv6.ProtocolNumber, _) = %s", transProto, err)
+		}
+		t.Cleanup(ep.Close)
+		return &endpoint{
+			wq:         wq,
+			ep:         ep,
+			transProto: transProto,
+			netProto:   ipv6.ProtocolNumber,
+			ns:         ns,
+		}
+	}
+	localAddress := func(ep *endpoint) tcpip.Address {
+		t.Helper()
+		addr, err := ep.ep.GetLocalAddress()
+		if err != nil {
+			t.Fatalf("GetLocalAddress() = %s", err)
+		}
+		return addr.Addr
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		ep := newEndpoint(tcp.ProtocolNumber)
+		switch err := ep.connect(tcpip.FullAddress{Addr: dst, Port: 80}); err.(type) {
+		case nil, *tcpip.ErrConnectStarted:
+		default:
+			t.Fatalf("connect(%s) = %s", dst, err)
+		}
+		if got := localAddress(ep); got != preferred {
+			t.Errorf("got local address %s, want %s", got, preferred)
+		}
+	})
+
+	// A datagram socket isn't bound to the address preferred for its first
+	// destination, so it can be connected again through another interface.
+	t.Run("datagram reconnect", func(t *testing.T) {
+		ep := newEndpoint(udp.ProtocolNumber)
+		if err := ep.connect(tcpip.FullAddress{Addr: dst, Port: 80}); err != nil {
+			t.Fatalf("connect(%s) = %s", dst, err)
+		}
+		if err := ep.connect(tcpip.FullAddress{Addr: otherDst, Port: 80}); err != nil {
+			t.Fatalf("connect(%s) = %s", otherDst, err)
+		}
+		if got := localAddress(ep); got != otherSrc {
+			t.Errorf("got local address %s, want %s", got, otherSrc)
+		}
+	})
+}
@@ -0,0 +1,351 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package bpf implements classic BPF socket filters, as attached to packet
+// sockets with SO_ATTACH_FILTER on Linux.
+package bpf
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// MaxInstructions is the maximum length of a Program.
+const MaxInstructions = 4096
+
+// memWords is the number of words of scratch memory available to a Program.
+const memWords = 16
+
+// Instruction classes.
+const (
+	classLD   = 0x00
+	classLDX  = 0x01
+	classST   = 0x02
+	classSTX  = 0x03
+	classALU  = 0x04
+	classJMP  = 0x05
+	classRET  = 0x06
+	classMISC = 0x07
+)
+
+// Load sizes.
+const (
+	sizeW = 0x00
+	sizeH = 0x08
+	sizeB = 0x10
+)
+
+// Load modes.
+const (
+	modeIMM = 0x00
+	modeABS = 0x20
+	modeIND = 0x40
+	modeMEM = 0x60
+	modeLEN = 0x80
+	modeMSH = 0xa0
+)
+
+// ALU operations.
+const (
+	aluADD = 0x00
+	aluSUB = 0x10
+	aluMUL = 0x20
+	aluDIV = 0x30
+	aluOR  = 0x40
+	aluAND = 0x50
+	aluLSH = 0x60
+	aluRSH = 0x70
+	aluNEG = 0x80
+	aluMOD = 0x90
+	aluXOR = 0xa0
+)
+
+// Jump operations.
+const (
+	jmpJA   = 0x00
+	jmpJEQ  = 0x10
+	jmpJGT  = 0x20
+	jmpJGE  = 0x30
+	jmpJSET = 0x40
+)
+
+// Operand sources. For RET, srcA returns the accumulator.
+const (
+	srcK = 0x00
+	srcX = 0x08
+	srcA = 0x10
+)
+
+// Miscellaneous operations.
+const (
+	miscTAX = 0x00
+	miscTXA = 0x80
+)
+
+// Instruction is a classic BPF instruction, laid out as struct sock_filter.
+type Instruction struct {
+	Code uint16
+	Jt   uint8
+	Jf   uint8
+	K    uint32
+}
+
+// Program is a validated classic BPF program.
+//
+// It must be created using the Compile function.
+type Program struct {
+	instructions []Instruction
+}
+
+// Compile validates instructions the way the Linux kernel does when a filter
+// is attached to a socket: the program must be non-empty and no longer than
+// MaxInstructions, every opcode must be known, jumps must stay within the
+// program, scratch memory accesses must be in range, constant divisors and
+// shifts must be valid, and the last instruction must return.
+func Compile(instructions []Instruction) (*Program, error) {
+	if len(instructions) == 0 || len(instructions) > MaxInstructions {
+		return nil, fmt.Errorf("program has %d instructions, want 1 to %d", len(instructions), MaxInstructions)
+	}
+	for pc, ins := range instructions {
+		if err := validate(ins, len(instructions)-pc-1); err != nil {
+			return nil, fmt.Errorf("instruction %d (%#v): %w", pc, ins, err)
+		}
+	}
+	if last := instructions[len(instructions)-1]; last.Code&0x07 != classRET {
+		return nil, fmt.Errorf("last instruction (%#v) doesn't return", last)
+	}
+	return &Program{instructions: append([]Instruction(nil), instructions...)}, nil
+}
+
+// validate validates ins, which is followed by remaining instructions.
+func validate(ins Instruction, remaining int) error {
+	switch ins.Code & 0x07 {
+	case classLD:
+		switch ins.Code {
+		case classLD | modeIMM, classLD | modeLEN,
+			classLD | modeABS | sizeW, classLD | modeABS | sizeH, classLD | modeABS | sizeB,
+			classLD | modeIND | sizeW, classLD | modeIND | sizeH, classLD | modeIND | sizeB:
+			return nil
+		case classLD | modeMEM:
+			return validateMem(ins.K)
+		}
+	case classLDX:
+		switch ins.Code {
+		case classLDX | modeIMM, classLDX | modeLEN, classLDX | modeMSH | sizeB:
+			return nil
+		case classLDX | modeMEM:
+			return validateMem(ins.K)
+		}
+	case classST, classSTX:
+		if ins.Code&^0x07 == 0 {
+			return validateMem(ins.K)
+		}
+	case classALU:
+		src := ins.Code & srcX
+		switch ins.Code &^ 0x0f {
+		case aluNEG:
+			if src == srcK {
+				return nil
+			}
+		case aluDIV, aluMOD:
+			if src == srcK && ins.K == 0 {
+				return fmt.Errorf("division by zero")
+			}
+			return nil
+		case aluLSH, aluRSH:
+			if src == srcK && ins.K >= 32 {
+				return fmt.Errorf("shift by %d", ins.K)
+			}
+			return nil
+		case aluADD, aluSUB, aluMUL, aluOR, aluAND, aluXOR:
+			return nil
+		}
+	case classJMP:
+		switch ins.Code &^ 0x0f {
+		case jmpJA:
+			if ins.Code&srcX != 0 {
+				break
+			}
+			if int64(ins.K) >= int64(remaining) {
+				return fmt.Errorf("jump out of the program")
+			}
+			return nil
+		case jmpJEQ, jmpJGT, jmpJGE, jmpJSET:
+			if int(ins.Jt) >= remaining || int(ins.Jf) >= remaining {
+				return fmt.Errorf("jump out of the program")
+			}
+			return nil
+		}
+	case classRET:
+		switch ins.Code {
+		case classRET | srcK, classRET | srcX, classRET | srcA:
+			return nil
+		}
+	case classMISC:
+		switch ins.Code {
+		case classMISC | miscTAX, classMISC | miscTXA:
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown opcode %#x", ins.Code)
+}
+
+func validateMem(k uint32) error {
+	if k >= memWords {
+		return fmt.Errorf("scratch memory word %d out of range", k)
+	}
+	return nil
+}
+
+// Run runs the program against pkt and returns the number of bytes of pkt to
+// accept; 0 means the packet is dropped. As on Linux, a load out of the
+// packet's bounds or a division by a zero X register drops the packet.
+func (p *Program) Run(pkt []byte) uint32 {
+	var a, x uint32
+	var mem [memWords]uint32
+	for pc := 0; pc < len(p.instructions); pc++ {
+		ins := p.instructions[pc]
+		switch ins.Code & 0x07 {
+		case classLD:
+			switch ins.Code &^ 0x07 {
+			case modeIMM:
+				a = ins.K
+			case modeLEN:
+				a = uint32(len(pkt))
+			case modeMEM:
+				a = mem[ins.K]
+			default:
+				offset := uint64(ins.K)
+				if ins.Code&0xe0 == modeIND {
+					offset += uint64(x)
+				}
+				v, ok := load(pkt, offset, ins.Code&0x18)
+				if !ok {
+					return 0
+				}
+				a = v
+			}
+		case classLDX:
+			switch ins.Code &^ 0x07 {
+			case modeIMM:
+				x = ins.K
+			case modeLEN:
+				x = uint32(len(pkt))
+			case modeMEM:
+				x = mem[ins.K]
+			case modeMSH | sizeB:
+				if uint64(ins.K) >= uint64(len(pkt)) {
+					return 0
+				}
+				x = uint32(pkt[ins.K]&0x0f) * 4
+			}
+		case classST:
+			mem[ins.K] = a
+		case classSTX:
+			mem[ins.K] = x
+		case classALU:
+			operand := ins.K
+			if ins.Code&srcX != 0 {
+				operand = x
+			}
+			switch ins.Code &^ 0x0f {
+			case aluADD:
+				a += operand
+			case aluSUB:
+				a -= operand
+			case aluMUL:
+				a *= operand
+			case aluDIV:
+				if operand == 0 {
+					return 0
+				}
+				a /= operand
+			case aluMOD:
+				if operand == 0 {
+					return 0
+				}
+				a %= operand
+			case aluOR:
+				a |= operand
+			case aluAND:
+				a &= operand
+			case aluXOR:
+				a ^= operand
+			case aluLSH:
+				a <<= operand
+			case aluRSH:
+				a >>= operand
+			case aluNEG:
+				a = -a
+			}
+		case classJMP:
+			operand := ins.K
+			if ins.Code&srcX != 0 {
+				operand = x
+			}
+			var cond bool
+			switch ins.Code &^ 0x0f {
+			case jmpJA:
+				pc += int(ins.K)
+				continue
+			case jmpJEQ:
+				cond = a == operand
+			case jmpJGT:
+				cond = a > operand
+			case jmpJGE:
+				cond = a >= operand
+			case jmpJSET:
+				cond = a&operand != 0
+			}
+			if cond {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case classRET:
+			switch ins.Code &^ 0x07 {
+			case srcX:
+				return x
+			case srcA:
+				return a
+			default:
+				return ins.K
+			}
+		case classMISC:
+			switch ins.Code &^ 0x07 {
+			case miscTAX:
+				x = a
+			case miscTXA:
+				a = x
+			}
+		}
+	}
+	// Compile guarantees that the last instruction returns.
+	panic("unreachable")
+}
+
+// load loads the big-endian value of the given size at offset in pkt.
+func load(pkt []byte, offset uint64, size uint16) (uint32, bool) {
+	var n uint64
+	switch size {
+	case sizeW:
+		n = 4
+	case sizeH:
+		n = 2
+	case sizeB:
+		n = 1
+	}
+	if offset+n > uint64(len(pkt)) {
+		return 0, false
+	}
+	b := pkt[offset : offset+n]
+	switch size {
+	case sizeW:
+		return binary.BigEndian.Uint32(b), true
+	case sizeH:
+		return uint32(binary.BigEndian.Uint16(b)), true
+	default:
+		return uint32(b[0]), true
+	}
+}
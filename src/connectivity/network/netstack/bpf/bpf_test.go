@@ -0,0 +1,186 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bpf_test
+
+import (
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/bpf"
+)
+
+// arpFilter is the output of `tcpdump -dd arp`.
+var arpFilter = []bpf.Instruction{
+	{Code: 0x28, Jt: 0, Jf: 0, K: 0x0000000c},
+	{Code: 0x15, Jt: 0, Jf: 1, K: 0x00000806},
+	{Code: 0x6, Jt: 0, Jf: 0, K: 0x00040000},
+	{Code: 0x6, Jt: 0, Jf: 0, K: 0x00000000},
+}
+
+// udpPort67Filter is the IPv4 half of the output of `tcpdump -dd udp dst port
+// 67`, which exercises indirect loads and the IP header length helper.
+var udpPort67Filter = []bpf.Instruction{
+	{Code: 0x28, Jt: 0, Jf: 0, K: 0x0000000c},
+	{Code: 0x15, Jt: 0, Jf: 8, K: 0x00000800},
+	{Code: 0x30, Jt: 0, Jf: 0, K: 0x00000017},
+	{Code: 0x15, Jt: 0, Jf: 6, K: 0x00000011},
+	{Code: 0x28, Jt: 0, Jf: 0, K: 0x00000014},
+	{Code: 0x45, Jt: 4, Jf: 0, K: 0x00001fff},
+	{Code: 0xb1, Jt: 0, Jf: 0, K: 0x0000000e},
+	{Code: 0x48, Jt: 0, Jf: 0, K: 0x00000010},
+	{Code: 0x15, Jt: 0, Jf: 1, K: 0x00000043},
+	{Code: 0x6, Jt: 0, Jf: 0, K: 0x00040000},
+	{Code: 0x6, Jt: 0, Jf: 0, K: 0x00000000},
+}
+
+func ethernetFrame(etherType uint16, payload ...byte) []byte {
+	frame := make([]byte, 12, 14+len(payload))
+	frame = append(frame, byte(etherType>>8), byte(etherType))
+	return append(frame, payload...)
+}
+
+func ipv4UDP(dstPort uint16) []byte {
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	ip[9] = 17
+	udp := make([]byte, 8)
+	udp[2] = byte(dstPort >> 8)
+	udp[3] = byte(dstPort)
+	return ethernetFrame(0x0800, append(ip, udp...)...)
+}
+
+func TestRun(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		program []bpf.Instruction
+		pkt     []byte
+		want    uint32
+	}{
+		{
+			name:    "arp accepts arp",
+			program: arpFilter,
+			pkt:     ethernetFrame(0x0806, make([]byte, 28)...),
+			want:    0x40000,
+		},
+		{
+			name:    "arp drops ipv4",
+			program: arpFilter,
+			pkt:     ipv4UDP(67),
+		},
+		{
+			name:    "arp drops truncated frame",
+			program: arpFilter,
+			pkt:     make([]byte, 13),
+		},
+		{
+			name:    "udp port accepts match",
+			program: udpPort67Filter,
+			pkt:     ipv4UDP(67),
+			want:    0x40000,
+		},
+		{
+			name:    "udp port drops other port",
+			program: udpPort67Filter,
+			pkt:     ipv4UDP(68),
+		},
+		{
+			name: "return length",
+			program: []bpf.Instruction{
+				{Code: 0x80},       // ld len
+				{Code: 0x14, K: 4}, // sub #4
+				{Code: 0x16},       // ret a
+			},
+			pkt:  make([]byte, 10),
+			want: 6,
+		},
+		{
+			name: "scratch memory",
+			program: []bpf.Instruction{
+				{Code: 0x00, K: 7},  // ld #7
+				{Code: 0x02, K: 15}, // st M[15]
+				{Code: 0x01, K: 3},  // ldx #3
+				{Code: 0x60, K: 15}, // ld M[15]
+				{Code: 0x2c},        // mul x
+				{Code: 0x16},        // ret a
+			},
+			want: 21,
+		},
+		{
+			name: "division by zero x drops",
+			program: []bpf.Instruction{
+				{Code: 0x00, K: 7}, // ld #7
+				{Code: 0x3c},       // div x
+				{Code: 0x06, K: 1}, // ret #1
+			},
+		},
+		{
+			name: "jump always",
+			program: []bpf.Instruction{
+				{Code: 0x05, K: 1}, // ja +1
+				{Code: 0x06, K: 1}, // ret #1
+				{Code: 0x06, K: 2}, // ret #2
+			},
+			want: 2,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := bpf.Compile(test.program)
+			if err != nil {
+				t.Fatalf("Compile(_) = %s", err)
+			}
+			if got := p.Run(test.pkt); got != test.want {
+				t.Errorf("got Run(_) = %d, want = %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		program []bpf.Instruction
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:    "too long",
+			program: make([]bpf.Instruction, bpf.MaxInstructions+1),
+		},
+		{
+			name:    "no return",
+			program: []bpf.Instruction{{Code: 0x00, K: 1}},
+		},
+		{
+			name:    "unknown opcode",
+			program: []bpf.Instruction{{Code: 0xff}, {Code: 0x06}},
+		},
+		{
+			name:    "jump out of program",
+			program: []bpf.Instruction{{Code: 0x15, Jt: 1}, {Code: 0x06}},
+		},
+		{
+			name:    "jump always out of program",
+			program: []bpf.Instruction{{Code: 0x05, K: 1}, {Code: 0x06}},
+		},
+		{
+			name:    "division by constant zero",
+			program: []bpf.Instruction{{Code: 0x34}, {Code: 0x06}},
+		},
+		{
+			name:    "shift too far",
+			program: []bpf.Instruction{{Code: 0x64, K: 32}, {Code: 0x06}},
+		},
+		{
+			name:    "scratch memory out of range",
+			program: []bpf.Instruction{{Code: 0x02, K: 16}, {Code: 0x06}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := bpf.Compile(test.program); err == nil {
+				t.Errorf("Compile(_) succeeded, want error")
+			}
+		})
+	}
+}
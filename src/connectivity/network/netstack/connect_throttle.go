@@ -0,0 +1,222 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	syslog "go.fuchsia.dev/fuchsia/src/lib/syslog/go"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	connectThrottleTagName = "connect throttle"
+
+	// The number of destinations or clients a throttle tracks. Buckets that
+	// have refilled are discarded first, then the least recently used ones.
+	maxThrottleBuckets = 1024
+)
+
+// connectThrottlePolicy configures rate limiting of outbound stream socket
+// connection attempts, so that an application stuck in a retry loop can't
+// exhaust ephemeral ports and CPU for everyone else.
+type connectThrottlePolicy struct {
+	// period is the interval over which attempts are counted.
+	period time.Duration
+
+	// perDestination is the number of attempts allowed to a single remote
+	// address and port per period. Zero disables the limit.
+	perDestination uint
+
+	// perClient is the number of attempts allowed on sockets created through
+	// a single connection to fuchsia.posix.socket/Provider per period, which
+	// usually corresponds to a single component. Zero disables the limit.
+	perClient uint
+}
+
+// connectThrottleStats counts connection attempts that were refused by the
+// throttle.
+type connectThrottleStats struct {
+	// ThrottledByDestination counts attempts refused because too many were
+	// made to the same destination.
+	ThrottledByDestination tcpip.StatCounter
+	// ThrottledByClient counts attempts refused because too many were made by
+	// the same client.
+	ThrottledByClient tcpip.StatCounter
+}
+
+// tokenBucket allows up to capacity events per period, in bursts of up to
+// capacity events.
+type tokenBucket struct {
+	tokens float64
+	last   tcpip.MonotonicTime
+	// throttled is set while the bucket is refusing events, so that only the
+	// first refusal is logged.
+	throttled bool
+}
+
+// refill adds the tokens accrued since the bucket was last refilled.
+func (b *tokenBucket) refill(now tcpip.MonotonicTime, capacity uint, period time.Duration) {
+	b.tokens += float64(capacity) * float64(now.Sub(b.last)) / float64(period)
+	if b.tokens > float64(capacity) {
+		b.tokens = float64(capacity)
+	}
+	b.last = now
+}
+
+// throttleKey identifies a destination, by addr and port, or a client.
+type throttleKey struct {
+	addr   tcpip.Address
+	port   uint16
+	client uint64
+}
+
+// connectThrottle rate limits connection attempts by destination and by
+// client.
+type connectThrottle struct {
+	policy connectThrottlePolicy
+	clock  tcpip.Clock
+	stats  *connectThrottleStats
+
+	nextClient uint64
+
+	mu struct {
+		sync.Mutex
+		destinations tokenBuckets
+		clients      tokenBuckets
+	}
+}
+
+func newConnectThrottle(policy connectThrottlePolicy, clock tcpip.Clock, stats *connectThrottleStats) *connectThrottle {
+	t := &connectThrottle{
+		policy: policy,
+		clock:  clock,
+		stats:  stats,
+	}
+	t.mu.destinations.init()
+	t.mu.clients.init()
+	return t
+}
+
+// newClient returns the identifier of a new client. Zero is never returned,
+// and identifies sockets with no known client.
+func (t *connectThrottle) newClient() uint64 {
+	if t == nil {
+		return 0
+	}
+	return atomic.AddUint64(&t.nextClient, 1)
+}
+
+// allow records an attempt by client to connect to addr, and returns
+// tcpip.ErrWouldBlock if it exceeds either limit. Refused attempts don't count
+// against the limits.
+func (t *connectThrottle) allow(client uint64, addr tcpip.FullAddress) tcpip.Error {
+	if t == nil || t.policy.period <= 0 {
+		return nil
+	}
+	now := t.clock.NowMonotonic()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var dst, src *tokenBucket
+	if t.policy.perDestination != 0 {
+		dst = t.mu.destinations.take(throttleKey{addr: addr.Addr, port: addr.Port}, now, t.policy.perDestination, t.policy.period)
+	}
+	if t.policy.perClient != 0 && client != 0 {
+		src = t.mu.clients.take(throttleKey{client: client}, now, t.policy.perClient, t.policy.period)
+	}
+
+	if dst != nil && dst.tokens < 1 {
+		t.stats.ThrottledByDestination.Increment()
+		if !dst.throttled {
+			dst.throttled = true
+			_ = syslog.WarnTf(connectThrottleTagName, "throttling connection attempts to %s:%d: more than %d per %s", addr.Addr, addr.Port, t.policy.perDestination, t.policy.period)
+		}
+		return &tcpip.ErrWouldBlock{}
+	}
+	if src != nil && src.tokens < 1 {
+		t.stats.ThrottledByClient.Increment()
+		if !src.throttled {
+			src.throttled = true
+			_ = syslog.WarnTf(connectThrottleTagName, "throttling connection attempts by client %d: more than %d per %s", client, t.policy.perClient, t.policy.period)
+		}
+		return &tcpip.ErrWouldBlock{}
+	}
+	for _, b := range [...]*tokenBucket{dst, src} {
+		if b != nil {
+			b.tokens--
+			b.throttled = false
+		}
+	}
+	return nil
+}
+
+// tokenBuckets holds the token buckets of up to maxThrottleBuckets keys.
+type tokenBuckets struct {
+	buckets map[throttleKey]*list.Element
+	// lru holds the *keyedTokenBucket values of buckets, most recently used
+	// first.
+	lru list.List
+}
+
+type keyedTokenBucket struct {
+	key throttleKey
+	tokenBucket
+}
+
+func (bs *tokenBuckets) init() {
+	bs.buckets = make(map[throttleKey]*list.Element)
+	bs.lru.Init()
+}
+
+func (bs *tokenBuckets) len() int {
+	return len(bs.buckets)
+}
+
+// take returns the refilled bucket for key, creating it if needed. Buckets
+// are discarded when there are too many of them, as described by prune.
+func (bs *tokenBuckets) take(key throttleKey, now tcpip.MonotonicTime, capacity uint, period time.Duration) *tokenBucket {
+	e, ok := bs.buckets[key]
+	if !ok {
+		if len(bs.buckets) >= maxThrottleBuckets {
+			bs.prune(now, period)
+		}
+		e = bs.lru.PushFront(&keyedTokenBucket{
+			key:         key,
+			tokenBucket: tokenBucket{tokens: float64(capacity), last: now},
+		})
+		bs.buckets[key] = e
+	}
+	bs.lru.MoveToFront(e)
+	b := &e.Value.(*keyedTokenBucket).tokenBucket
+	b.refill(now, capacity, period)
+	return b
+}
+
+// prune discards the buckets that haven't been used for a whole period, which
+// have refilled and so are indistinguishable from new ones, or the least
+// recently used bucket if none has. Buckets are ordered by when they were
+// last used, so only the ones that are discarded are visited, and each
+// bucket is discarded at most once.
+func (bs *tokenBuckets) prune(now tcpip.MonotonicTime, period time.Duration) {
+	for e := bs.lru.Back(); e != nil && now.Sub(e.Value.(*keyedTokenBucket).last) >= period; e = bs.lru.Back() {
+		bs.remove(e)
+	}
+	if len(bs.buckets) >= maxThrottleBuckets {
+		bs.remove(bs.lru.Back())
+	}
+}
+
+func (bs *tokenBuckets) remove(e *list.Element) {
+	bs.lru.Remove(e)
+	delete(bs.buckets, e.Value.(*keyedTokenBucket).key)
+}
@@ -0,0 +1,132 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+)
+
+func TestConnectThrottle(t *testing.T) {
+	clock := faketime.NewManualClock()
+	var stats connectThrottleStats
+	throttle := newConnectThrottle(connectThrottlePolicy{
+		period:         time.Second,
+		perDestination: 2,
+		perClient:      3,
+	}, clock, &stats)
+
+	a := tcpip.FullAddress{Addr: "\xc0\xa8\x00\x01", Port: 80}
+	b := tcpip.FullAddress{Addr: "\xc0\xa8\x00\x02", Port: 80}
+	client := throttle.newClient()
+	otherClient := throttle.newClient()
+
+	allow := func(client uint64, addr tcpip.FullAddress, want bool) {
+		t.Helper()
+		err := throttle.allow(client, addr)
+		if got := err == nil; got != want {
+			t.Errorf("got allow(%d, %s:%d) = %v, want allowed = %t", client, addr.Addr, addr.Port, err, want)
+		}
+		if _, ok := err.(*tcpip.ErrWouldBlock); err != nil && !ok {
+			t.Errorf("got allow(%d, %s:%d) = %v, want %T", client, addr.Addr, addr.Port, err, &tcpip.ErrWouldBlock{})
+		}
+	}
+
+	allow(client, a, true)
+	allow(client, a, true)
+	// The destination is exhausted, for every client.
+	allow(client, a, false)
+	allow(otherClient, a, false)
+	if got := stats.ThrottledByDestination.Value(); got != 2 {
+		t.Errorf("got ThrottledByDestination = %d, want = 2", got)
+	}
+
+	// The client has one attempt left, which refused attempts didn't spend.
+	allow(client, b, true)
+	allow(client, b, false)
+	if got := stats.ThrottledByClient.Value(); got != 1 {
+		t.Errorf("got ThrottledByClient = %d, want = 1", got)
+	}
+	allow(otherClient, b, true)
+
+	// Attempts are allowed again as the buckets refill.
+	clock.Advance(time.Second / 2)
+	allow(client, a, true)
+	allow(client, a, false)
+	clock.Advance(time.Second)
+	allow(client, a, true)
+	allow(client, a, true)
+
+	// Sockets with no known client are only limited by destination.
+	for i := 0; i < 2; i++ {
+		allow(0, b, true)
+	}
+	allow(0, b, false)
+
+	// A nil throttle allows everything.
+	var nilThrottle *connectThrottle
+	if err := nilThrottle.allow(nilThrottle.newClient(), a); err != nil {
+		t.Errorf("got allow(...) = %s on a nil throttle, want nil", err)
+	}
+}
+
+func TestConnectThrottlePrunesFullBuckets(t *testing.T) {
+	clock := faketime.NewManualClock()
+	throttle := newConnectThrottle(connectThrottlePolicy{
+		period:         time.Second,
+		perDestination: 1,
+	}, clock, &connectThrottleStats{})
+
+	for i := 0; i < maxThrottleBuckets; i++ {
+		addr := tcpip.FullAddress{Addr: "\xc0\xa8\x00\x01", Port: uint16(i + 1)}
+		if err := throttle.allow(0, addr); err != nil {
+			t.Fatalf("allow(0, %s:%d) = %s", addr.Addr, addr.Port, err)
+		}
+	}
+	clock.Advance(time.Second)
+	if err := throttle.allow(0, tcpip.FullAddress{Addr: "\xc0\xa8\x00\x02", Port: 1}); err != nil {
+		t.Fatalf("allow(...) = %s", err)
+	}
+	throttle.mu.Lock()
+	defer throttle.mu.Unlock()
+	if got := throttle.mu.destinations.len(); got != 1 {
+		t.Errorf("got %d tracked destinations, want = 1", got)
+	}
+}
+
+func TestConnectThrottlePrunesOnlyIdleBuckets(t *testing.T) {
+	clock := faketime.NewManualClock()
+	throttle := newConnectThrottle(connectThrottlePolicy{
+		period:         time.Second,
+		perDestination: 1,
+	}, clock, &connectThrottleStats{})
+
+	// Half of the destinations are last used half a period after the others,
+	// so they haven't refilled when the table fills up a period after the
+	// first half.
+	for i := 0; i < maxThrottleBuckets; i++ {
+		if i == maxThrottleBuckets/2 {
+			clock.Advance(time.Second / 2)
+		}
+		addr := tcpip.FullAddress{Addr: "\xc0\xa8\x00\x01", Port: uint16(i + 1)}
+		if err := throttle.allow(0, addr); err != nil {
+			t.Fatalf("allow(0, %s:%d) = %s", addr.Addr, addr.Port, err)
+		}
+	}
+	clock.Advance(time.Second / 2)
+	if err := throttle.allow(0, tcpip.FullAddress{Addr: "\xc0\xa8\x00\x02", Port: 1}); err != nil {
+		t.Fatalf("allow(...) = %s", err)
+	}
+	throttle.mu.Lock()
+	defer throttle.mu.Unlock()
+	if got, want := throttle.mu.destinations.len(), maxThrottleBuckets/2+1; got != want {
+		t.Errorf("got %d tracked destinations, want = %d", got, want)
+	}
+}
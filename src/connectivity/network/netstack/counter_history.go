@@ -0,0 +1,199 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	syslog "go.fuchsia.dev/fuchsia/src/lib/syslog/go"
+
+	inspect "fidl/fuchsia/inspect/deprecated"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	counterHistoryTagName = "counter history"
+
+	counterHistoryLabel = "History"
+)
+
+// counterHistoryPolicy configures the periodic sampling of each NIC's
+// counters, so that rates can be computed from a single inspect snapshot.
+type counterHistoryPolicy struct {
+	// period is the amount of time between samples. Zero disables sampling.
+	period time.Duration
+
+	// samples is the number of samples kept per NIC.
+	samples int
+}
+
+// counterSample holds the values of a NIC's counters at a point in time.
+type counterSample struct {
+	at tcpip.MonotonicTime
+	// metrics holds the value of each counter, keyed by its path in the NIC's
+	// Stats node, e.g. "Tx.Packets".
+	metrics []inspect.Metric
+}
+
+// counterHistory is a ring buffer of the most recent samples of a NIC's
+// counters.
+//
+// The zero value is ready to use.
+type counterHistory struct {
+	mu struct {
+		sync.Mutex
+		samples []counterSample
+		// first is the index of the oldest sample once the buffer is full.
+		first int
+	}
+}
+
+// record adds sample to the history, replacing the oldest sample if the
+// history already holds capacity samples.
+func (h *counterHistory) record(sample counterSample, capacity int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.mu.samples) < capacity {
+		h.mu.samples = append(h.mu.samples, sample)
+		return
+	}
+	h.mu.samples[h.mu.first] = sample
+	h.mu.first = (h.mu.first + 1) % len(h.mu.samples)
+}
+
+// snapshot returns the samples in the history, oldest first.
+func (h *counterHistory) snapshot() []counterSample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	samples := make([]counterSample, 0, len(h.mu.samples))
+	samples = append(samples, h.mu.samples[h.mu.first:]...)
+	return append(samples, h.mu.samples[:h.mu.first]...)
+}
+
+// flattenMetrics appends the metrics of node and of all its descendants to
+// metrics, keyed by their path below node.
+func flattenMetrics(prefix string, node inspectInner, metrics []inspect.Metric) []inspect.Metric {
+	for _, metric := range node.ReadData().Metrics {
+		metric.Key = prefix + metric.Key
+		metrics = append(metrics, metric)
+	}
+	for _, childName := range node.ListChildren() {
+		if child := node.GetChild(childName); child != nil {
+			metrics = flattenMetrics(prefix+childName+".", child, metrics)
+		}
+	}
+	return metrics
+}
+
+// sampleCounters records a sample of the counters of each NIC, keeping at
+// most samples of them per NIC.
+func (ns *Netstack) sampleCounters(samples int) {
+	now := ns.stack.Clock().NowMonotonic()
+	for _, ni := range ns.stack.NICInfo() {
+		ifs := ni.Context.(*ifState)
+		ifs.counterHistory.record(counterSample{
+			at: now,
+			metrics: flattenMetrics("", &statCounterInspectImpl{
+				value: reflect.ValueOf(ni.Stats),
+			}, nil),
+		}, samples)
+	}
+}
+
+func (ns *Netstack) startCounterHistory(ctx context.Context, policy counterHistoryPolicy) {
+	if policy.period <= 0 || policy.samples <= 0 {
+		return
+	}
+	_ = syslog.InfoTf(counterHistoryTagName, "sampling NIC counters every %s, keeping %d samples", policy.period, policy.samples)
+
+	var timer tcpip.Timer
+	timer = ns.stack.Clock().AfterFunc(policy.period, func() {
+		select {
+		case <-ctx.Done():
+			_ = syslog.InfoTf(counterHistoryTagName, "stopping counter sampling")
+		default:
+			ns.sampleCounters(policy.samples)
+			timer.Reset(policy.period)
+		}
+	})
+}
+
+var _ inspectInner = (*counterHistoryInspectImpl)(nil)
+
+// counterHistoryInspectImpl exposes the samples of a NIC's counters, oldest
+// first, as children named by their index.
+type counterHistoryInspectImpl struct {
+	name  string
+	value []counterSample
+}
+
+func (impl *counterHistoryInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+	}
+}
+
+func (impl *counterHistoryInspectImpl) ListChildren() []string {
+	children := make([]string, 0, len(impl.value))
+	for i := range impl.value {
+		children = append(children, strconv.FormatUint(uint64(i), 10))
+	}
+	return children
+}
+
+func (impl *counterHistoryInspectImpl) GetChild(childName string) inspectInner {
+	index, err := strconv.ParseUint(childName, 10, 64)
+	if err != nil {
+		_ = syslog.VLogTf(syslog.DebugVerbosity, inspect.InspectName, "GetChild(): %s", err)
+		return nil
+	}
+	if index >= uint64(len(impl.value)) {
+		_ = syslog.VLogTf(
+			syslog.DebugVerbosity,
+			inspect.InspectName,
+			"GetChild(%s): index %d out of bounds, there are %d samples in the counter history",
+			childName,
+			index,
+			len(impl.value),
+		)
+		return nil
+	}
+	return &counterSampleInspectImpl{
+		name:  childName,
+		value: impl.value[index],
+	}
+}
+
+var _ inspectInner = (*counterSampleInspectImpl)(nil)
+
+type counterSampleInspectImpl struct {
+	name  string
+	value counterSample
+}
+
+func (impl *counterSampleInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+		Properties: []inspect.Property{
+			{Key: "@time", Value: inspect.PropertyValueWithStr(strconv.FormatInt(impl.value.at.Sub(tcpip.MonotonicTime{}).Nanoseconds(), 10))},
+		},
+		Metrics: impl.value.metrics,
+	}
+}
+
+func (*counterSampleInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*counterSampleInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	inspect "fidl/fuchsia/inspect/deprecated"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+func TestCounterHistory(t *testing.T) {
+	addGoleakCheck(t)
+
+	var h counterHistory
+	if got := h.snapshot(); len(got) != 0 {
+		t.Errorf("got snapshot() = %#v, want empty", got)
+	}
+
+	const capacity = 3
+	var start tcpip.MonotonicTime
+	for i := 0; i < 5; i++ {
+		h.record(counterSample{at: start.Add(time.Duration(i) * time.Second)}, capacity)
+	}
+
+	var got []time.Duration
+	for _, sample := range h.snapshot() {
+		got = append(got, sample.at.Sub(start))
+	}
+	if diff := cmp.Diff([]time.Duration{2 * time.Second, 3 * time.Second, 4 * time.Second}, got); diff != "" {
+		t.Errorf("snapshot() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSampleCounters(t *testing.T) {
+	addGoleakCheck(t)
+
+	ns, clock := newNetstack(t, netstackTestOptions{})
+	ifs := addNoopEndpoint(t, ns, "")
+
+	const samples = 2
+	var want []string
+	for i := 0; i < samples+1; i++ {
+		clock.Advance(time.Minute)
+		ns.sampleCounters(samples)
+		want = append(want, strconv.FormatInt(clock.NowMonotonic().Sub(tcpip.MonotonicTime{}).Nanoseconds(), 10))
+	}
+	// The oldest sample was replaced.
+	want = want[1:]
+
+	nicInfo := ns.getIfStateInfo(ns.stack.NICInfo())[ifs.nicid]
+	nic := nicInfoInspectImpl{name: "doesn't matter", value: nicInfo}
+	if children := nic.ListChildren(); len(children) < 2 || children[1] != counterHistoryLabel {
+		t.Errorf("got ListChildren() = %s, want %s to follow %s", children, counterHistoryLabel, statsLabel)
+	}
+	history := nic.GetChild(counterHistoryLabel)
+	if history == nil {
+		t.Fatalf("got GetChild(%s) = nil, want non-nil", counterHistoryLabel)
+	}
+	if diff := cmp.Diff(inspect.Object{
+		Name: counterHistoryLabel,
+	}, history.ReadData(), cmpopts.IgnoreUnexported(inspect.Object{})); diff != "" {
+		t.Errorf("ReadData() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"0", "1"}, history.ListChildren()); diff != "" {
+		t.Fatalf("ListChildren() mismatch (-want +got):\n%s", diff)
+	}
+
+	for i, childName := range history.ListChildren() {
+		data := history.GetChild(childName).ReadData()
+		if diff := cmp.Diff([]inspect.Property{
+			{Key: "@time", Value: inspect.PropertyValueWithStr(want[i])},
+		}, data.Properties, cmpopts.IgnoreUnexported(inspect.Property{}, inspect.PropertyValue{})); diff != "" {
+			t.Errorf("sample %s: Properties mismatch (-want +got):\n%s", childName, diff)
+		}
+
+		found := false
+		for _, metric := range data.Metrics {
+			if metric.Key == "Tx.Packets" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("sample %s has no Tx.Packets metric: %#v", childName, data.Metrics)
+		}
+	}
+
+	if child := history.GetChild(strconv.Itoa(samples)); child != nil {
+		t.Errorf("got GetChild(%d) = %#v, want = nil", samples, child)
+	}
+	if child := history.GetChild("not a real child"); child != nil {
+		t.Errorf("got GetChild(%s) = %#v, want = nil", "not a real child", child)
+	}
+}
@@ -69,6 +69,8 @@ type Client struct {
 	// reboots, remove the recent state history.
 	stateRecentHistory util.CircularLogs
 
+	stateTransitions stateTransitions
+
 	stats Stats
 
 	acquiredFunc AcquiredFunc
@@ -235,6 +237,21 @@ func (c *Client) StateRecentHistory() []util.LogEntry {
 	return c.stateRecentHistory.BuildLogs()
 }
 
+// StateTransitions returns the client's most recent state transitions, from
+// oldest to newest.
+func (c *Client) StateTransitions() []StateTransition {
+	return c.stateTransitions.list()
+}
+
+func (c *Client) recordTransition(from, to dhcpClientState, reason string) {
+	c.stateTransitions.push(StateTransition{
+		Timestamp: c.stack.Clock().NowMonotonic(),
+		From:      from,
+		To:        to,
+		Reason:    reason,
+	})
+}
+
 // Run runs the DHCP client, returning the address assigned when it is stopped.
 //
 // The function periodically searches for a new IP address.
@@ -258,6 +275,10 @@ func (c *Client) Run(ctx context.Context) (rtn tcpip.AddressWithPrefix) {
 	}()
 
 	for {
+		from := info.State
+		// failure is the reason the transaction failed, if it did.
+		var failure string
+		nak := false
 		if err := func() error {
 			acquisitionTimeout := info.Acquisition
 			txnStart := c.now()
@@ -295,6 +316,7 @@ func (c *Client) Run(ctx context.Context) (rtn tcpip.AddressWithPrefix) {
 				return err
 			}
 			if cfg.Declined {
+				nak = true
 				c.stats.ReacquireAfterNAK.Increment()
 				c.lost(ctx, c.cleanup(&info, nicName, false /* release */))
 				return nil
@@ -448,10 +470,21 @@ func (c *Client) Run(ctx context.Context) (rtn tcpip.AddressWithPrefix) {
 				return
 			}
 			_ = c.logThrottler.logTf(syslog.InfoLevel, tag, "%s: %s; retrying %s", nicName, err, info.State)
+			failure = transitionReason(err)
 		}
 
 		// Synchronize info after attempt to acquire is complete.
 		c.storeInfo(&info)
+		switch {
+		case failure != "":
+			c.recordTransition(from, info.State, failure)
+		case nak && from == initSelecting:
+			// A NAK received in any other state is recorded below, as the
+			// client transitions to initSelecting.
+			c.recordTransition(from, info.State, TransitionReasonNAK)
+		case info.State != from:
+			c.recordTransition(from, info.State, "")
+		}
 
 		// RFC 2131 Section 4.4.5
 		// https://tools.ietf.org/html/rfc2131#section-4.4.5
@@ -505,6 +538,16 @@ func (c *Client) Run(ctx context.Context) (rtn tcpip.AddressWithPrefix) {
 			c.lost(ctx, c.cleanup(&info, nicName, true /* release */))
 		}
 
+		if info.State != next {
+			var reason string
+			if next == initSelecting {
+				reason = TransitionReasonLeaseExpired
+				if nak {
+					reason = TransitionReasonNAK
+				}
+			}
+			c.recordTransition(info.State, next, reason)
+		}
 		info.State = next
 
 		// Synchronize info after any state updates.
@@ -18,6 +18,7 @@ import (
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"gvisor.dev/gvisor/pkg/bufferv2"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -281,11 +282,66 @@ func TestSimultaneousDHCPClients(t *testing.T) {
 		}()
 	}
 
-	if _, err := newEPConnServer(ctx, serverStack, defaultClientAddrs, defaultServerCfg, testServerOptions{}); err != nil {
+	if _, err := newEPConnServer(ctx, serverStack, 0 /* nicID */, defaultClientAddrs, defaultServerCfg, testServerOptions{}); err != nil {
 		t.Fatalf("newEPConnServer failed: %s", err)
 	}
 }
 
+// TestNICServerLeases checks that a server bound to a NIC records its leases,
+// and reuses an expired lease's address once its pool is exhausted.
+func TestNICServerLeases(t *testing.T) {
+	var serverLinkEP, clientLinkEP endpoint
+	serverLinkEP.remote = append(serverLinkEP.remote, &clientLinkEP)
+	clientLinkEP.remote = append(clientLinkEP.remote, &serverLinkEP)
+
+	serverStack := createTestStack()
+	addEndpointToStack(t, []tcpip.Address{serverAddr}, testNICID, serverStack, &serverLinkEP)
+
+	clientStack := createTestStack()
+	addEndpointToStack(t, nil, testNICID, clientStack, &clientLinkEP)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := defaultClientAddrs[:1]
+	server, err := NewNICServer(ctx, serverStack, testNICID, pool, defaultServerCfg)
+	if err != nil {
+		t.Fatalf("NewNICServer failed: %s", err)
+	}
+	if got, want := server.PoolSize(), len(pool); got != want {
+		t.Errorf("got server.PoolSize() = %d, want = %d", got, want)
+	}
+
+	acquireWith := func(linkAddr tcpip.LinkAddress) {
+		t.Helper()
+		c := newZeroJitterClient(clientStack, testNICID, linkAddr, defaultAcquireTimeout, defaultBackoffTime, defaultRetransTime, nil)
+		info := c.Info()
+		if _, err := acquire(ctx, c, t.Name(), &info); err != nil {
+			t.Fatalf("acquire(...) failed: %s", err)
+		}
+		if got, want := info.Acquired.Address, pool[0]; got != want {
+			t.Errorf("got info.Acquired.Address = %s, want = %s", got, want)
+		}
+	}
+	ignoreStart := cmpopts.IgnoreFields(Lease{}, "Start")
+
+	acquireWith(linkAddr1)
+	if diff := cmp.Diff([]Lease{{LinkAddress: linkAddr1, Addr: pool[0], State: "acked"}}, server.Leases(), ignoreStart); diff != "" {
+		t.Errorf("server.Leases() mismatch (-want +got):\n%s", diff)
+	}
+
+	server.mu.Lock()
+	lease := server.leases[linkAddr1]
+	lease.state = leaseExpired
+	server.leases[linkAddr1] = lease
+	server.mu.Unlock()
+
+	acquireWith(linkAddr2)
+	if diff := cmp.Diff([]Lease{{LinkAddress: linkAddr2, Addr: pool[0], State: "acked"}}, server.Leases(), ignoreStart); diff != "" {
+		t.Errorf("server.Leases() mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func (c *Client) verifyClientStats(t *testing.T, want uint64) {
 	t.Helper()
 	if got := c.stats.SendDiscovers.Value(); got != want {
@@ -322,7 +378,7 @@ func setupTestEnv(ctx context.Context, t *testing.T, serverCfg Config, testServe
 	clientStack = createTestStack()
 	addEndpointToStack(t, nil, testNICID, clientStack, &clientLinkEP)
 
-	if _, err := newEPConnServer(ctx, serverStack, defaultClientAddrs, serverCfg, testServerOptions); err != nil {
+	if _, err := newEPConnServer(ctx, serverStack, 0 /* nicID */, defaultClientAddrs, serverCfg, testServerOptions); err != nil {
 		t.Fatalf("newEPConnServer failed: %s", err)
 	}
 	c := newZeroJitterClient(clientStack, testNICID, linkAddr1, defaultAcquireTimeout, defaultBackoffTime, defaultRetransTime, nil)
@@ -360,7 +416,7 @@ func testDHCP(t *testing.T, tc testDHCPCase) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	if _, err := newEPConnServer(ctx, serverStack, defaultClientAddrs, defaultServerCfg, tc.testServerOptions); err != nil {
+	if _, err := newEPConnServer(ctx, serverStack, 0 /* nicID */, defaultClientAddrs, defaultServerCfg, tc.testServerOptions); err != nil {
 		t.Fatalf("newEPConnServer failed: %s", err)
 	}
 
@@ -1487,6 +1543,7 @@ func TestStateTransition(t *testing.T) {
 		// The time durations to advance in test when the current time is requested.
 		durations            []time.Duration
 		expectedStateHistory []dhcpClientState
+		expectedTransitions  []StateTransition
 	}{
 		{
 			name:           "Renew",
@@ -1508,6 +1565,11 @@ func TestStateTransition(t *testing.T) {
 				bound,
 				bound,
 			},
+			expectedTransitions: []StateTransition{
+				{From: initSelecting, To: bound},
+				{From: bound, To: renewing},
+				{From: renewing, To: bound},
+			},
 		},
 		{
 			name:           "Rebind",
@@ -1535,6 +1597,13 @@ func TestStateTransition(t *testing.T) {
 				bound,
 				bound,
 			},
+			expectedTransitions: []StateTransition{
+				{From: initSelecting, To: bound},
+				{From: bound, To: renewing},
+				{From: renewing, To: renewing, Reason: TransitionReasonTimeout},
+				{From: renewing, To: rebinding},
+				{From: rebinding, To: bound},
+			},
 		},
 		{
 			// Test the client is not stuck in retransimission longer than it should.
@@ -1567,6 +1636,13 @@ func TestStateTransition(t *testing.T) {
 				bound,
 				bound,
 			},
+			expectedTransitions: []StateTransition{
+				{From: initSelecting, To: bound},
+				{From: bound, To: renewing},
+				{From: renewing, To: renewing, Reason: TransitionReasonTimeout},
+				{From: renewing, To: rebinding},
+				{From: rebinding, To: bound},
+			},
 		},
 		{
 			name:           "LeaseExpire",
@@ -1601,6 +1677,15 @@ func TestStateTransition(t *testing.T) {
 				bound,
 				bound,
 			},
+			expectedTransitions: []StateTransition{
+				{From: initSelecting, To: bound},
+				{From: bound, To: renewing},
+				{From: renewing, To: renewing, Reason: TransitionReasonTimeout},
+				{From: renewing, To: rebinding},
+				{From: rebinding, To: rebinding, Reason: TransitionReasonTimeout},
+				{From: rebinding, To: initSelecting, Reason: TransitionReasonLeaseExpired},
+				{From: initSelecting, To: bound},
+			},
 		},
 		{
 			// Test the client is not stuck in retransimission longer than it should.
@@ -1640,6 +1725,15 @@ func TestStateTransition(t *testing.T) {
 				bound,
 				bound,
 			},
+			expectedTransitions: []StateTransition{
+				{From: initSelecting, To: bound},
+				{From: bound, To: renewing},
+				{From: renewing, To: renewing, Reason: TransitionReasonTimeout},
+				{From: renewing, To: rebinding},
+				{From: rebinding, To: rebinding, Reason: TransitionReasonTimeout},
+				{From: rebinding, To: initSelecting, Reason: TransitionReasonLeaseExpired},
+				{From: initSelecting, To: bound},
+			},
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
@@ -1757,6 +1851,9 @@ func TestStateTransition(t *testing.T) {
 			if err := c.verifyRecentStateHistory(t, tc.expectedStateHistory); err != nil {
 				t.Error(err)
 			}
+			if diff := cmp.Diff(tc.expectedTransitions, c.StateTransitions(), cmpopts.IgnoreFields(StateTransition{}, "Timestamp")); diff != "" {
+				t.Errorf("c.StateTransitions() mismatch (-want +got):\n%s", diff)
+			}
 		})
 	}
 }
@@ -2065,7 +2162,7 @@ func TestTwoServers(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if _, err := newEPConnServer(ctx, serverStack, []tcpip.Address{"\xc0\xa8\x03\x02"}, Config{
+	if _, err := newEPConnServer(ctx, serverStack, 0 /* nicID */, []tcpip.Address{"\xc0\xa8\x03\x02"}, Config{
 		ServerAddress: "\xc0\xa8\x03\x01",
 		SubnetMask:    "\xff\xff\xff\x00",
 		Router:        []tcpip.Address{"\xc0\xa8\x03\xF0"},
@@ -2074,7 +2171,7 @@ func TestTwoServers(t *testing.T) {
 	}, testServerOptions{}); err != nil {
 		t.Fatal(err)
 	}
-	if _, err := newEPConnServer(ctx, serverStack, []tcpip.Address{"\xc0\xa8\x04\x02"}, Config{
+	if _, err := newEPConnServer(ctx, serverStack, 0 /* nicID */, []tcpip.Address{"\xc0\xa8\x04\x02"}, Config{
 		ServerAddress: "\xc0\xa8\x04\x01",
 		SubnetMask:    "\xff\xff\xff\x00",
 		Router:        []tcpip.Address{"\xc0\xa8\x03\xF0"},
@@ -23,6 +23,7 @@ import (
 	"io"
 	"log"
 	"runtime"
+	"sort"
 	stdtime "time"
 
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/sync"
@@ -130,22 +131,40 @@ func (c *epConn) Write(b []byte, addr *tcpip.FullAddress) error {
 	return nil
 }
 
-func newEPConnServer(ctx context.Context, stack *stack.Stack, addrs []tcpip.Address, cfg Config, testServerOptions testServerOptions) (*Server, error) {
+func newEPConnServer(ctx context.Context, stack *stack.Stack, nicID tcpip.NICID, addrs []tcpip.Address, cfg Config, testServerOptions testServerOptions) (*Server, error) {
 	wq := new(waiter.Queue)
 	ep, err := stack.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, wq)
 	if err != nil {
 		return nil, fmt.Errorf("NewEndpoint: %s", err)
 	}
 	ep.SocketOptions().SetReusePort(true)
+	if nicID != 0 {
+		if err := ep.SocketOptions().SetBindToDevice(int32(nicID)); err != nil {
+			ep.Close()
+			return nil, fmt.Errorf("SetBindToDevice(%d): %s", nicID, err)
+		}
+	}
 	addr := tcpip.FullAddress{Port: ServerPort}
 	if err := ep.Bind(addr); err != nil {
+		ep.Close()
 		return nil, fmt.Errorf("Bind(%+v): %s", addr, err)
 	}
 	ep.SocketOptions().SetBroadcast(true)
 	c := newEPConn(ctx, wq, ep)
+	go func() {
+		<-ctx.Done()
+		ep.Close()
+	}()
 	return NewServer(ctx, c, addrs, cfg, testServerOptions)
 }
 
+// NewNICServer creates a DHCP server that serves the clients on the NIC with
+// the given ID, leasing them the addresses in pool. The server continues
+// serving until ctx is done.
+func NewNICServer(ctx context.Context, stack *stack.Stack, nicID tcpip.NICID, pool []tcpip.Address, cfg Config) (*Server, error) {
+	return newEPConnServer(ctx, stack, nicID, pool, cfg, testServerOptions{})
+}
+
 // NewServer creates a new DHCP server and begins serving.
 // The server continues serving until ctx is done.
 func NewServer(ctx context.Context, c conn, addrs []tcpip.Address, cfg Config, testServerOptions testServerOptions) (*Server, error) {
@@ -179,6 +198,46 @@ func NewServer(ctx context.Context, c conn, addrs []tcpip.Address, cfg Config, t
 	return s, nil
 }
 
+// Lease is a snapshot of an entry in a Server's lease table.
+type Lease struct {
+	LinkAddress tcpip.LinkAddress
+	Addr        tcpip.Address
+	// State is one of "offered", "acked" or "expired".
+	State string
+	// Start is when the address was last offered or acked to the client.
+	Start time.Time
+}
+
+// Leases returns the server's leases, sorted by address.
+func (s *Server) Leases() []Lease {
+	s.mu.Lock()
+	leases := make([]Lease, 0, len(s.leases))
+	for linkAddr, lease := range s.leases {
+		leases = append(leases, Lease{
+			LinkAddress: linkAddr,
+			Addr:        lease.addr,
+			State:       lease.state.String(),
+			Start:       lease.start,
+		})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(leases, func(i, j int) bool {
+		return bytes.Compare([]byte(leases[i].Addr), []byte(leases[j].Addr)) < 0
+	})
+	return leases
+}
+
+// PoolSize returns the number of addresses the server leases.
+func (s *Server) PoolSize() int {
+	return len(s.addrs)
+}
+
+// ServerAddress returns the address the server identifies itself with.
+func (s *Server) ServerAddress() tcpip.Address {
+	return s.cfg.ServerAddress
+}
+
 func (s *Server) expirer(ctx context.Context) {
 	t := stdtime.NewTicker(1 * stdtime.Minute)
 	defer t.Stop()
@@ -294,7 +353,7 @@ func (s *Server) handleDiscover(hreq hdr, opts options) {
 					delete(s.leases, k)
 					lease = serverLease{
 						start: time.Now(),
-						addr:  lease.addr,
+						addr:  oldLease.addr,
 						xid:   xid,
 						state: leaseOffer,
 					}
@@ -302,9 +361,11 @@ func (s *Server) handleDiscover(hreq hdr, opts options) {
 					break
 				}
 			}
-			log.Printf("server has no more addresses")
-			s.mu.Unlock()
-			return
+			if lease.state == leaseNew {
+				log.Printf("server has no more addresses")
+				s.mu.Unlock()
+				return
+			}
 		}
 	case leaseOffer, leaseAck, leaseExpired:
 		lease = serverLease{
@@ -466,6 +527,21 @@ const (
 	leaseExpired
 )
 
+func (s leaseState) String() string {
+	switch s {
+	case leaseNew:
+		return "new"
+	case leaseOffer:
+		return "offered"
+	case leaseAck:
+		return "acked"
+	case leaseExpired:
+		return "expired"
+	default:
+		return fmt.Sprintf("leaseState(%d)", s)
+	}
+}
+
 type serverLease struct {
 	start time.Time
 	addr  tcpip.Address
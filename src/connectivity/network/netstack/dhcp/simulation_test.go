@@ -0,0 +1,261 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package dhcp
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/time"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// simOutcome is the scripted server behaviour for a single DHCP transaction.
+type simOutcome int
+
+const (
+	// simAck completes the transaction with a lease.
+	simAck simOutcome = iota
+	// simNak completes the transaction with a DHCPNAK.
+	simNak
+	// simDrop never answers; the transaction runs until its deadline.
+	simDrop
+)
+
+func (o simOutcome) String() string {
+	switch o {
+	case simAck:
+		return "ack"
+	case simNak:
+		return "nak"
+	case simDrop:
+		return "drop"
+	default:
+		return fmt.Sprintf("simOutcome(%d)", int(o))
+	}
+}
+
+// simStep is one scripted transaction. The harness fails the test if the
+// client starts the transaction in a state other than state.
+type simStep struct {
+	state   dhcpClientState
+	outcome simOutcome
+}
+
+// simEvent records a transaction started by the client, relative to the start
+// of the simulation.
+type simEvent struct {
+	at      time.Duration
+	state   dhcpClientState
+	outcome simOutcome
+}
+
+// simulation drives a Client through a script of transaction outcomes using a
+// virtual clock.
+//
+// Run calls every stubbed function synchronously from its own goroutine, so
+// the clock only moves when the client waits for a timer or a transaction
+// runs to its deadline. Scenarios therefore execute instantly and always
+// observe the same sequence of times.
+type simulation struct {
+	t      *testing.T
+	c      *Client
+	cancel context.CancelFunc
+
+	start, now time.Time
+	deadline   time.Time
+	script     []simStep
+	events     []simEvent
+	// addrs holds every address change reported through acquiredFunc.
+	addrs []tcpip.AddressWithPrefix
+
+	acquired tcpip.AddressWithPrefix
+	lease    Config
+}
+
+func newSimulation(t *testing.T, acquisition, backoff time.Duration, lease Config, script []simStep) *simulation {
+	t.Helper()
+
+	s := createTestStack()
+	if err := s.CreateNIC(testNICID, &endpoint{}); err != nil {
+		t.Fatalf("s.CreateNIC(_, nil) = %s", err)
+	}
+
+	sim := &simulation{
+		t:      t,
+		c:      newZeroJitterClient(s, testNICID, linkAddr1, acquisition, backoff, defaultRetransTime, nil),
+		script: script,
+		acquired: tcpip.AddressWithPrefix{
+			Address:   defaultClientAddrs[0],
+			PrefixLen: 24,
+		},
+		lease: lease,
+	}
+	sim.now = sim.start
+
+	sim.c.now = func() time.Time { return sim.now }
+	sim.c.retransTimeout = func(d time.Duration) <-chan time.Time {
+		sim.now = sim.now.Add(d)
+		ch := make(chan time.Time, 1)
+		ch <- sim.now
+		return ch
+	}
+	sim.c.contextWithTimeout = func(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+		sim.deadline = sim.now.Add(d)
+		return context.WithCancel(ctx)
+	}
+	sim.c.acquire = sim.acquire
+	sim.c.acquiredFunc = func(_ context.Context, lost, acquired tcpip.AddressWithPrefix, _ Config) {
+		if lost != acquired {
+			sim.addrs = append(sim.addrs, acquired)
+		}
+	}
+
+	// Avoid waiting for ARP on sending DHCPRELEASE.
+	s.AddStaticNeighbor(testNICID, header.IPv4ProtocolNumber, sim.c.Info().Config.ServerAddress, tcpip.LinkAddress([]byte{0, 1, 2, 3, 4, 5}))
+	return sim
+}
+
+func (sim *simulation) acquire(ctx context.Context, _ *Client, _ string, info *Info) (Config, error) {
+	if len(sim.script) == 0 {
+		sim.cancel()
+		return Config{}, ctx.Err()
+	}
+	var step simStep
+	step, sim.script = sim.script[0], sim.script[1:]
+	sim.events = append(sim.events, simEvent{
+		at:      sim.now.Sub(sim.start),
+		state:   info.State,
+		outcome: step.outcome,
+	})
+	if info.State != step.state {
+		sim.t.Errorf("transaction %d started in state %s, want %s", len(sim.events), info.State, step.state)
+	}
+
+	switch step.outcome {
+	case simAck:
+		info.Acquired = sim.acquired
+		return sim.lease, nil
+	case simNak:
+		return Config{Declined: true}, nil
+	case simDrop:
+		sim.now = sim.deadline
+		return Config{}, fmt.Errorf("simulated server did not respond: %w", context.DeadlineExceeded)
+	default:
+		panic(fmt.Sprintf("unknown outcome %s", step.outcome))
+	}
+}
+
+// run runs the client until the script is exhausted and returns the events it
+// produced.
+func (sim *simulation) run() []simEvent {
+	sim.t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sim.cancel = cancel
+
+	sim.c.Run(ctx)
+	if len(sim.script) != 0 {
+		sim.t.Errorf("client stopped with %d unused scripted steps", len(sim.script))
+	}
+	return sim.events
+}
+
+func TestSimulation(t *testing.T) {
+	const (
+		acquisition = 10 * time.Minute
+		backoff     = 5 * time.Second
+	)
+	lease := Config{
+		RenewTime:   60,
+		RebindTime:  120,
+		LeaseLength: 180,
+	}
+	renewAt := lease.RenewTime.Duration()
+	rebindAt := lease.RebindTime.Duration()
+	expireAt := lease.LeaseLength.Duration()
+	addr := tcpip.AddressWithPrefix{Address: defaultClientAddrs[0], PrefixLen: 24}
+
+	for _, tc := range []struct {
+		name       string
+		script     []simStep
+		wantEvents []simEvent
+		wantAddrs  []tcpip.AddressWithPrefix
+		wantNAKs   uint64
+	}{
+		{
+			name: "LossyServer",
+			script: []simStep{
+				{state: initSelecting, outcome: simDrop},
+				{state: initSelecting, outcome: simDrop},
+				{state: initSelecting, outcome: simAck},
+			},
+			wantEvents: []simEvent{
+				{at: 0, state: initSelecting, outcome: simDrop},
+				{at: acquisition + backoff, state: initSelecting, outcome: simDrop},
+				{at: 2 * (acquisition + backoff), state: initSelecting, outcome: simAck},
+			},
+			wantAddrs: []tcpip.AddressWithPrefix{addr},
+		},
+		{
+			name: "NAKStorm",
+			script: []simStep{
+				{state: initSelecting, outcome: simAck},
+				{state: renewing, outcome: simNak},
+				{state: initSelecting, outcome: simNak},
+				{state: initSelecting, outcome: simNak},
+				{state: initSelecting, outcome: simAck},
+			},
+			wantEvents: []simEvent{
+				{at: 0, state: initSelecting, outcome: simAck},
+				{at: renewAt, state: renewing, outcome: simNak},
+				{at: renewAt, state: initSelecting, outcome: simNak},
+				{at: renewAt + backoff, state: initSelecting, outcome: simNak},
+				{at: renewAt + 2*backoff, state: initSelecting, outcome: simAck},
+			},
+			wantAddrs: []tcpip.AddressWithPrefix{addr, {}, addr},
+			wantNAKs:  3,
+		},
+		{
+			name: "RebindFailure",
+			script: []simStep{
+				{state: initSelecting, outcome: simAck},
+				{state: renewing, outcome: simDrop},
+				{state: rebinding, outcome: simDrop},
+				{state: initSelecting, outcome: simAck},
+			},
+			wantEvents: []simEvent{
+				{at: 0, state: initSelecting, outcome: simAck},
+				// Transactions in RENEWING and REBINDING are cut short so that the
+				// client moves on as soon as the next deadline passes.
+				{at: renewAt, state: renewing, outcome: simDrop},
+				{at: rebindAt, state: rebinding, outcome: simDrop},
+				{at: expireAt, state: initSelecting, outcome: simAck},
+			},
+			wantAddrs: []tcpip.AddressWithPrefix{addr, {}, addr},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sim := newSimulation(t, acquisition, backoff, lease, tc.script)
+			gotEvents := sim.run()
+
+			if diff := cmp.Diff(tc.wantEvents, gotEvents, cmp.AllowUnexported(simEvent{})); diff != "" {
+				t.Errorf("events mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantAddrs, sim.addrs); diff != "" {
+				t.Errorf("acquired addresses mismatch (-want +got):\n%s", diff)
+			}
+			if got := sim.c.stats.ReacquireAfterNAK.Value(); got != tc.wantNAKs {
+				t.Errorf("got stats.ReacquireAfterNAK = %d, want = %d", got, tc.wantNAKs)
+			}
+		})
+	}
+}
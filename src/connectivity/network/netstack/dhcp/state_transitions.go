@@ -0,0 +1,81 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package dhcp
+
+import (
+	"context"
+	"errors"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// stateTransitionsLength is the number of recent state transitions kept by a
+// client.
+const stateTransitionsLength = 32
+
+// Reasons for a state transition.
+const (
+	TransitionReasonNAK          = "NAK"
+	TransitionReasonTimeout      = "timeout"
+	TransitionReasonLeaseExpired = "lease expired"
+)
+
+// StateTransition records a change of a client's state, or a failed
+// transaction that left the client in the same state.
+type StateTransition struct {
+	// Timestamp is when the transition happened.
+	Timestamp tcpip.MonotonicTime
+	From, To  dhcpClientState
+	// Reason is why the transition happened if it is due to a failure, e.g.
+	// one of the TransitionReason constants or the error that failed the
+	// transaction.
+	Reason string
+}
+
+// transitionReason returns the reason to record for a transaction that failed
+// with err.
+func transitionReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return TransitionReasonTimeout
+	}
+	return err.Error()
+}
+
+// stateTransitions is a circular buffer of a client's most recent state
+// transitions.
+type stateTransitions struct {
+	mu struct {
+		sync.Mutex
+		transitions []StateTransition
+		// first is the index of the oldest transition.
+		first int
+	}
+}
+
+// push records t, replacing the oldest transition if the buffer is full.
+func (s *stateTransitions) push(t StateTransition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.mu.transitions) < stateTransitionsLength {
+		s.mu.transitions = append(s.mu.transitions, t)
+	} else {
+		s.mu.transitions[s.mu.first] = t
+		s.mu.first = (s.mu.first + 1) % stateTransitionsLength
+	}
+}
+
+// list returns the recorded transitions, from oldest to newest.
+func (s *stateTransitions) list() []StateTransition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transitions := make([]StateTransition, 0, len(s.mu.transitions))
+	transitions = append(transitions, s.mu.transitions[s.mu.first:]...)
+	return append(transitions, s.mu.transitions[:s.mu.first]...)
+}
@@ -0,0 +1,209 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/dhcp"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// defaultDHCPServerLeaseLength is the length of the leases of a DHCP
+	// server whose configuration doesn't specify it.
+	defaultDHCPServerLeaseLength = time.Hour
+
+	// maxDHCPServerPoolSize bounds the number of addresses a DHCP server
+	// leases, which keeps its lease table small.
+	maxDHCPServerPoolSize = 1024
+)
+
+// dhcpServerConfig configures the DHCP server of an interface.
+type dhcpServerConfig struct {
+	// addr is the address of the server. It is added to the interface, and
+	// clients are told to use it as their router.
+	addr tcpip.AddressWithPrefix
+	// first and last are the first and last addresses leased to clients.
+	first, last tcpip.Address
+	leaseLength time.Duration
+}
+
+func (c dhcpServerConfig) String() string {
+	return fmt.Sprintf("%s,%s-%s,%s", c.addr, c.first, c.last, c.leaseLength)
+}
+
+// parseDHCPServerConfig parses a configuration of the form
+// addr/prefix,first-last[,leaseLength], e.g.
+// "192.168.42.1/24,192.168.42.10-192.168.42.100,1h".
+func parseDHCPServerConfig(s string) (dhcpServerConfig, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 && len(parts) != 3 {
+		return dhcpServerConfig{}, fmt.Errorf("%q is not of the form addr/prefix,first-last[,leaseLength]", s)
+	}
+	ip, ipNet, err := net.ParseCIDR(parts[0])
+	if err != nil {
+		return dhcpServerConfig{}, err
+	}
+	if ip.To4() == nil {
+		return dhcpServerConfig{}, fmt.Errorf("%s is not an IPv4 address", parts[0])
+	}
+	prefixLen, _ := ipNet.Mask.Size()
+	c := dhcpServerConfig{
+		addr: tcpip.AddressWithPrefix{
+			Address:   tcpip.Address(ip.To4()),
+			PrefixLen: prefixLen,
+		},
+		leaseLength: defaultDHCPServerLeaseLength,
+	}
+	first, last, ok := strings.Cut(parts[1], "-")
+	if !ok {
+		return dhcpServerConfig{}, fmt.Errorf("%q is not a range of the form first-last", parts[1])
+	}
+	for _, a := range []struct {
+		s    string
+		addr *tcpip.Address
+	}{
+		{s: first, addr: &c.first},
+		{s: last, addr: &c.last},
+	} {
+		ip := net.ParseIP(a.s).To4()
+		if ip == nil {
+			return dhcpServerConfig{}, fmt.Errorf("%q is not an IPv4 address", a.s)
+		}
+		*a.addr = tcpip.Address(ip)
+	}
+	if len(parts) == 3 {
+		if c.leaseLength, err = time.ParseDuration(parts[2]); err != nil {
+			return dhcpServerConfig{}, fmt.Errorf("invalid lease length: %w", err)
+		}
+		if c.leaseLength < time.Second {
+			return dhcpServerConfig{}, fmt.Errorf("lease length %s is shorter than a second", c.leaseLength)
+		}
+	}
+	if _, err := c.pool(); err != nil {
+		return dhcpServerConfig{}, fmt.Errorf("%q: %w", s, err)
+	}
+	return c, nil
+}
+
+// pool returns the addresses leased to clients: those from first to last,
+// except for the server's own address. The range must lie within the
+// server's subnet and exclude the subnet's network and broadcast addresses.
+func (c dhcpServerConfig) pool() ([]tcpip.Address, error) {
+	subnet := c.addr.Subnet()
+	first := binary.BigEndian.Uint32([]byte(c.first))
+	last := binary.BigEndian.Uint32([]byte(c.last))
+	if first > last {
+		return nil, fmt.Errorf("range %s-%s is empty", c.first, c.last)
+	}
+	if !subnet.Contains(c.first) || !subnet.Contains(c.last) {
+		return nil, fmt.Errorf("range %s-%s is not within %s", c.first, c.last, subnet)
+	}
+	if c.first == subnet.ID() || c.last == subnet.Broadcast() {
+		return nil, fmt.Errorf("range %s-%s includes the network or broadcast address of %s", c.first, c.last, subnet)
+	}
+	if last-first >= maxDHCPServerPoolSize {
+		return nil, fmt.Errorf("range %s-%s has more than %d addresses", c.first, c.last, maxDHCPServerPoolSize)
+	}
+	var pool []tcpip.Address
+	for i := first; ; i++ {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], i)
+		if addr := tcpip.Address(b[:]); addr != c.addr.Address {
+			pool = append(pool, addr)
+		}
+		if i == last {
+			break
+		}
+	}
+	if len(pool) == 0 {
+		return nil, fmt.Errorf("range %s-%s has no address but the server's", c.first, c.last)
+	}
+	return pool, nil
+}
+
+// startDHCPServerLocked adds the server's address to the interface and starts
+// a DHCP server on it, which runs until the interface is removed.
+//
+// ifs.mu must be locked.
+func (ifs *ifState) startDHCPServerLocked(c dhcpServerConfig) error {
+	pool, err := c.pool()
+	if err != nil {
+		return err
+	}
+	protocolAddr := tcpip.ProtocolAddress{
+		Protocol:          ipv4.ProtocolNumber,
+		AddressWithPrefix: c.addr,
+	}
+	if ok, reason := ifs.addAddress(protocolAddr, stack.AddressProperties{}); !ok {
+		return fmt.Errorf("failed to add %s: %s", c.addr, reason)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	server, err := dhcp.NewNICServer(ctx, ifs.ns.stack, ifs.nicid, pool, dhcp.Config{
+		ServerAddress: c.addr.Address,
+		SubnetMask:    c.addr.Subnet().Mask(),
+		Router:        []tcpip.Address{c.addr.Address},
+		LeaseLength:   dhcp.Seconds(c.leaseLength / time.Second),
+	})
+	if err != nil {
+		cancel()
+		return err
+	}
+	ifs.mu.dhcpServer.Server = server
+	ifs.mu.dhcpServer.cancel = cancel
+	return nil
+}
+
+// dhcpServersFlag is a flag.Value that collects DHCP server configurations of
+// interfaces by name.
+type dhcpServersFlag struct {
+	configs map[string]dhcpServerConfig
+}
+
+// Set implements flag.Value.Set.
+func (f *dhcpServersFlag) Set(s string) error {
+	name, config, ok := strings.Cut(s, "=")
+	if !ok || len(name) == 0 {
+		return fmt.Errorf("%q is not of the form name=addr/prefix,first-last[,leaseLength]", s)
+	}
+	c, err := parseDHCPServerConfig(config)
+	if err != nil {
+		return err
+	}
+	if f.configs == nil {
+		f.configs = make(map[string]dhcpServerConfig)
+	}
+	f.configs[name] = c
+	return nil
+}
+
+// String implements flag.Value.String.
+func (f *dhcpServersFlag) String() string {
+	names := make([]string, 0, len(f.configs))
+	for name := range f.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for i, name := range names {
+		if i != 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(name + "=" + f.configs[name].String())
+	}
+	return b.String()
+}
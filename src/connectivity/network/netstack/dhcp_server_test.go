@@ -0,0 +1,114 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/util"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+)
+
+func TestParseDHCPServerConfig(t *testing.T) {
+	for _, s := range []string{
+		"192.168.42.1/24,192.168.42.10-192.168.42.100,1h0m0s",
+		"10.0.0.1/30,10.0.0.1-10.0.0.2,30s",
+	} {
+		c, err := parseDHCPServerConfig(s)
+		if err != nil {
+			t.Errorf("parseDHCPServerConfig(%q) = %s", s, err)
+		} else if got := c.String(); got != s {
+			t.Errorf("got parseDHCPServerConfig(%q).String() = %s", s, got)
+		}
+	}
+	if c, err := parseDHCPServerConfig("192.168.42.1/24,192.168.42.10-192.168.42.100"); err != nil {
+		t.Errorf("parseDHCPServerConfig(_) = %s", err)
+	} else if c.leaseLength != defaultDHCPServerLeaseLength {
+		t.Errorf("got leaseLength = %s, want = %s", c.leaseLength, defaultDHCPServerLeaseLength)
+	}
+	for _, s := range []string{
+		"",
+		"192.168.42.1/24",
+		"fe80::1/64,fe80::10-fe80::20",
+		"192.168.42.1/24,192.168.42.10",
+		"192.168.42.1/24,192.168.42.100-192.168.42.10",
+		"192.168.42.1/24,192.168.43.10-192.168.43.100",
+		"192.168.42.1/24,192.168.42.0-192.168.42.100",
+		"192.168.42.1/24,192.168.42.10-192.168.42.255",
+		"192.168.42.1/24,192.168.42.1-192.168.42.1",
+		"10.0.0.1/8,10.0.0.2-10.1.0.1",
+		"192.168.42.1/24,192.168.42.10-192.168.42.100,0s",
+		"192.168.42.1/24,192.168.42.10-192.168.42.100,forever",
+	} {
+		if c, err := parseDHCPServerConfig(s); err == nil {
+			t.Errorf("parseDHCPServerConfig(%q) = %s, want error", s, c)
+		}
+	}
+}
+
+func TestDHCPServerConfigPool(t *testing.T) {
+	c, err := parseDHCPServerConfig("10.0.0.2/29,10.0.0.1-10.0.0.4")
+	if err != nil {
+		t.Fatalf("parseDHCPServerConfig(_) = %s", err)
+	}
+	pool, err := c.pool()
+	if err != nil {
+		t.Fatalf("pool() = %s", err)
+	}
+	want := []tcpip.Address{util.Parse("10.0.0.1"), util.Parse("10.0.0.3"), util.Parse("10.0.0.4")}
+	if len(pool) != len(want) {
+		t.Fatalf("got pool() = %s, want = %s", pool, want)
+	}
+	for i := range want {
+		if pool[i] != want[i] {
+			t.Errorf("got pool()[%d] = %s, want = %s", i, pool[i], want[i])
+		}
+	}
+}
+
+func TestDHCPServerOnInterface(t *testing.T) {
+	addGoleakCheck(t)
+
+	ns, _ := newNetstack(t, netstackTestOptions{})
+	var flag dhcpServersFlag
+	if err := flag.Set("svc0=192.168.42.1/24,192.168.42.10-192.168.42.19"); err != nil {
+		t.Fatalf("flag.Set(_) = %s", err)
+	}
+	ns.dhcpServers = flag.configs
+
+	ifs, err := ns.addDummyInterface("svc0")
+	if err != nil {
+		t.Fatalf("addDummyInterface(svc0) = %s", err)
+	}
+	defer ifs.RemoveByUser()
+
+	addr := tcpip.AddressWithPrefix{Address: util.Parse("192.168.42.1"), PrefixLen: 24}
+	found := false
+	for _, protocolAddr := range ns.stack.NICInfo()[ifs.nicid].ProtocolAddresses {
+		if protocolAddr.Protocol == ipv4.ProtocolNumber && protocolAddr.AddressWithPrefix == addr {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("server address %s not added to NIC %d", addr, ifs.nicid)
+	}
+
+	ifs.mu.Lock()
+	server := ifs.mu.dhcpServer.Server
+	ifs.mu.Unlock()
+	if server == nil {
+		t.Fatalf("no DHCP server on NIC %d", ifs.nicid)
+	}
+	if got, want := server.PoolSize(), 10; got != want {
+		t.Errorf("got server.PoolSize() = %d, want = %d", got, want)
+	}
+	if got := server.ServerAddress(); got != addr.Address {
+		t.Errorf("got server.ServerAddress() = %s, want = %s", got, addr.Address)
+	}
+}
@@ -168,6 +168,13 @@ func (f *Filter) getNATRules() filter.FilterGetNatRulesResult {
 	})
 }
 
+// NATRules returns the installed NAT rules and their generation.
+func (f *Filter) NATRules() ([]filter.Nat, uint32) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.mu.natRules, f.mu.natGeneration
+}
+
 func (f *Filter) updateNATRules(rules []filter.Nat, generation uint32) filter.FilterUpdateNatRulesResult {
 	v4Table, v6Table, ok := f.parseNATRules(rules)
 	if !ok {
@@ -20,15 +20,18 @@ import (
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/dhcp"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/fidlconv"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link"
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/bridge"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/eth"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/fifo"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/netdevice"
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/ratelimit"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/routes"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/util"
 	"go.fuchsia.dev/fuchsia/src/lib/component"
 	syslog "go.fuchsia.dev/fuchsia/src/lib/syslog/go"
 
 	inspect "fidl/fuchsia/inspect/deprecated"
+	"fidl/fuchsia/net/filter"
 
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -46,17 +49,25 @@ type inspectInner interface {
 
 const (
 	statsLabel                  = "Stats"
+	dropsLabel                  = "Drops"
 	networkEndpointStatsLabel   = "Network Endpoint Stats"
 	socketInfo                  = "Socket Info"
+	socketClientsLabel          = "Socket Clients"
 	dhcpInfo                    = "DHCP Info"
 	dhcpStateRecentHistoryLabel = "DHCP State Recent History"
+	dhcpStateTransitionsLabel   = "DHCP State Transitions"
+	dhcpServerLabel             = "DHCP Server"
 	neighborsLabel              = "Neighbors"
 	ethInfo                     = "Ethernet Info"
 	netdeviceInfo               = "Network Device Info"
+	rateLimitLabel              = "Rate Limit"
+	bridgeWritesLabel           = "Bridge Write Failures"
 	rxReads                     = "RxReads"
 	rxWrites                    = "RxWrites"
 	txReads                     = "TxReads"
 	txWrites                    = "TxWrites"
+	ipv4AcceptedLabel           = "IPv4 Accepted"
+	ipv6AcceptedLabel           = "IPv6 Accepted"
 )
 
 // An adapter that implements fuchsia.inspect.InspectWithCtx using the above.
@@ -130,6 +141,12 @@ type statCounter interface {
 var _ statCounter = (*tcpip.StatCounter)(nil)
 var statCounterType = reflect.TypeOf((*statCounter)(nil)).Elem()
 
+// inspectNode is implemented by stats which can't be walked by reflection,
+// e.g. because they're keyed dynamically, to provide their own inspect node.
+type inspectNode interface {
+	asInspectInner(name string) inspectInner
+}
+
 // Recursive reflection-based implementation for structs containing other
 // structs, stat counters, or maps of stat counters.
 
@@ -201,6 +218,11 @@ func (impl *statCounterInspectImpl) GetChild(childName string) inspectInner {
 			return nil
 		}
 		if child := impl.value.FieldByName(childName); child.IsValid() {
+			if child.CanAddr() {
+				if node, ok := child.Addr().Interface().(inspectNode); ok {
+					return node.asInspectInner(childName)
+				}
+			}
 			if counterMap, ok := extractIntegralStatCounterMap(child); ok {
 				return &integralStatCounterMapInspectImpl{
 					name:  childName,
@@ -412,10 +434,17 @@ type ifStateInfo struct {
 	dhcpEnabled            bool
 	dhcpInfo               dhcp.Info
 	dhcpStateRecentHistory []util.LogEntry
+	dhcpStateTransitions   []dhcp.StateTransition
 	dhcpStats              *dhcp.Stats
+	dhcpServer             *dhcp.Server
 	controller             link.Controller
 	neighbors              map[string]stack.NeighborEntry
 	networkEndpointStats   map[string]stack.NetworkEndpointStats
+	rateLimiter            *ratelimit.Endpoint
+	counterHistory         []counterSample
+	// tempAddrConfig is nil for loopback interfaces.
+	tempAddrConfig     *tempAddrConfig
+	temporaryAddresses []ipv6AddressInfo
 }
 
 type nicInfoMapInspectImpl struct {
@@ -513,21 +542,35 @@ func (impl *nicInfoInspectImpl) ListChildren() []string {
 	children := []string{
 		statsLabel,
 	}
+	if len(impl.value.counterHistory) != 0 {
+		children = append(children, counterHistoryLabel)
+	}
 	if len(impl.value.NetworkStats) != 0 {
 		children = append(children, networkEndpointStatsLabel)
 	}
 	if impl.value.dhcpEnabled {
 		children = append(children, dhcpInfo)
 	}
+	if impl.value.dhcpServer != nil {
+		children = append(children, dhcpServerLabel)
+	}
 	if impl.value.neighbors != nil {
 		children = append(children, neighborsLabel)
 	}
+	if impl.value.rateLimiter != nil {
+		children = append(children, rateLimitLabel)
+	}
+	if impl.value.tempAddrConfig != nil {
+		children = append(children, temporaryAddressesLabel)
+	}
 
 	switch impl.value.controller.(type) {
 	case *eth.Client:
 		children = append(children, ethInfo)
 	case *netdevice.Port:
 		children = append(children, netdeviceInfo)
+	case *bridge.Endpoint:
+		children = append(children, bridgeWritesLabel)
 	}
 
 	return children
@@ -540,6 +583,11 @@ func (impl *nicInfoInspectImpl) GetChild(childName string) inspectInner {
 			name:  childName,
 			value: reflect.ValueOf(impl.value.Stats),
 		}
+	case counterHistoryLabel:
+		return &counterHistoryInspectImpl{
+			name:  childName,
+			value: impl.value.counterHistory,
+		}
 	case networkEndpointStatsLabel:
 		return &networkEndpointStatsInspectImpl{
 			name:  childName,
@@ -550,13 +598,40 @@ func (impl *nicInfoInspectImpl) GetChild(childName string) inspectInner {
 			name:               childName,
 			info:               impl.value.dhcpInfo,
 			stateRecentHistory: impl.value.dhcpStateRecentHistory,
+			stateTransitions:   impl.value.dhcpStateTransitions,
 			stats:              impl.value.dhcpStats,
 		}
+	case dhcpServerLabel:
+		if impl.value.dhcpServer == nil {
+			return nil
+		}
+		return &dhcpServerInspectImpl{
+			name:   childName,
+			server: impl.value.dhcpServer,
+			leases: impl.value.dhcpServer.Leases(),
+		}
 	case neighborsLabel:
 		return &neighborTableInspectImpl{
 			name:  childName,
 			value: impl.value.neighbors,
 		}
+	case rateLimitLabel:
+		if impl.value.rateLimiter == nil {
+			return nil
+		}
+		return &rateLimitInspectImpl{
+			name:  childName,
+			value: impl.value.rateLimiter,
+		}
+	case temporaryAddressesLabel:
+		if impl.value.tempAddrConfig == nil {
+			return nil
+		}
+		return &tempAddrsInspectImpl{
+			name:   childName,
+			config: *impl.value.tempAddrConfig,
+			addrs:  impl.value.temporaryAddresses,
+		}
 	case ethInfo:
 		return &ethInfoInspectImpl{
 			name:  childName,
@@ -567,11 +642,110 @@ func (impl *nicInfoInspectImpl) GetChild(childName string) inspectInner {
 			name:  childName,
 			value: impl.value.controller.(*netdevice.Port),
 		}
+	case bridgeWritesLabel:
+		b, ok := impl.value.controller.(*bridge.Endpoint)
+		if !ok {
+			return nil
+		}
+		return &bridgeWritesInspectImpl{
+			name:  childName,
+			value: b.PortWriteStats(),
+		}
 	default:
 		return nil
 	}
 }
 
+var _ inspectInner = (*rateLimitInspectImpl)(nil)
+
+type rateLimitInspectImpl struct {
+	name  string
+	value *ratelimit.Endpoint
+}
+
+func (impl *rateLimitInspectImpl) ReadData() inspect.Object {
+	limit := impl.value.Limit()
+	stats := impl.value.Stats()
+	return inspect.Object{
+		Name: impl.name,
+		Properties: []inspect.Property{
+			{Key: "Limit", Value: inspect.PropertyValueWithStr(limit.String())},
+		},
+		Metrics: []inspect.Metric{
+			{Key: "BytesPerSecond", Value: inspect.MetricValueWithUintValue(limit.BytesPerSecond)},
+			{Key: "BurstBytes", Value: inspect.MetricValueWithUintValue(limit.BurstBytes)},
+			{Key: "Delayed", Value: inspect.MetricValueWithUintValue(stats.Delayed.Value())},
+			{Key: "Dropped", Value: inspect.MetricValueWithUintValue(stats.Dropped.Value())},
+		},
+	}
+}
+
+func (*rateLimitInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*rateLimitInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
+
+var _ inspectInner = (*bridgeWritesInspectImpl)(nil)
+
+type bridgeWritesInspectImpl struct {
+	name  string
+	value []bridge.PortWriteStats
+}
+
+func (impl *bridgeWritesInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+	}
+}
+
+func (impl *bridgeWritesInspectImpl) ListChildren() []string {
+	children := make([]string, 0, len(impl.value))
+	for _, stats := range impl.value {
+		children = append(children, stats.LinkAddress.String())
+	}
+	return children
+}
+
+func (impl *bridgeWritesInspectImpl) GetChild(childName string) inspectInner {
+	for _, stats := range impl.value {
+		if stats.LinkAddress.String() == childName {
+			return &portWriteStatsInspectImpl{
+				name:  childName,
+				value: stats,
+			}
+		}
+	}
+	return nil
+}
+
+var _ inspectInner = (*portWriteStatsInspectImpl)(nil)
+
+type portWriteStatsInspectImpl struct {
+	name  string
+	value bridge.PortWriteStats
+}
+
+func (impl *portWriteStatsInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+		Metrics: []inspect.Metric{
+			{Key: "Errors", Value: inspect.MetricValueWithUintValue(impl.value.Errors)},
+			{Key: "DroppedPackets", Value: inspect.MetricValueWithUintValue(impl.value.DroppedPackets)},
+		},
+	}
+}
+
+func (*portWriteStatsInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*portWriteStatsInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
+
 var _ inspectInner = (*networkEndpointStatsInspectImpl)(nil)
 
 type networkEndpointStatsInspectImpl struct {
@@ -615,6 +789,7 @@ type dhcpInfoInspectImpl struct {
 	name               string
 	info               dhcp.Info
 	stateRecentHistory []util.LogEntry
+	stateTransitions   []dhcp.StateTransition
 	stats              *dhcp.Stats
 }
 
@@ -678,6 +853,7 @@ func (*dhcpInfoInspectImpl) ListChildren() []string {
 	return []string{
 		statsLabel,
 		dhcpStateRecentHistoryLabel,
+		dhcpStateTransitionsLabel,
 	}
 }
 
@@ -693,11 +869,142 @@ func (impl *dhcpInfoInspectImpl) GetChild(childName string) inspectInner {
 			name:  childName,
 			value: impl.stateRecentHistory,
 		}
+	case dhcpStateTransitionsLabel:
+		return &dhcpStateTransitionsInspectImpl{
+			name:  childName,
+			value: impl.stateTransitions,
+		}
 	default:
 		return nil
 	}
 }
 
+var _ inspectInner = (*dhcpStateTransitionsInspectImpl)(nil)
+
+type dhcpStateTransitionsInspectImpl struct {
+	name  string
+	value []dhcp.StateTransition
+}
+
+func (impl *dhcpStateTransitionsInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+	}
+}
+
+func (impl *dhcpStateTransitionsInspectImpl) ListChildren() []string {
+	children := make([]string, 0, len(impl.value))
+	for i := range impl.value {
+		children = append(children, strconv.Itoa(i))
+	}
+	return children
+}
+
+func (impl *dhcpStateTransitionsInspectImpl) GetChild(childName string) inspectInner {
+	index, err := strconv.ParseUint(childName, 10, 64)
+	if err != nil || index >= uint64(len(impl.value)) {
+		_ = syslog.VLogTf(syslog.DebugVerbosity, inspect.InspectName, "GetChild(%s): not one of %d state transitions", childName, len(impl.value))
+		return nil
+	}
+	return &dhcpStateTransitionInspectImpl{
+		name:  childName,
+		value: impl.value[index],
+	}
+}
+
+var _ inspectInner = (*dhcpStateTransitionInspectImpl)(nil)
+
+type dhcpStateTransitionInspectImpl struct {
+	name  string
+	value dhcp.StateTransition
+}
+
+func (impl *dhcpStateTransitionInspectImpl) ReadData() inspect.Object {
+	properties := []inspect.Property{
+		{Key: "@time", Value: inspect.PropertyValueWithStr(strconv.FormatInt(impl.value.Timestamp.Sub(tcpip.MonotonicTime{}).Nanoseconds(), 10))},
+		{Key: "From", Value: inspect.PropertyValueWithStr(impl.value.From.String())},
+		{Key: "To", Value: inspect.PropertyValueWithStr(impl.value.To.String())},
+	}
+	if impl.value.Reason != "" {
+		properties = append(properties, inspect.Property{Key: "Reason", Value: inspect.PropertyValueWithStr(impl.value.Reason)})
+	}
+	return inspect.Object{
+		Name:       impl.name,
+		Properties: properties,
+	}
+}
+
+func (*dhcpStateTransitionInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*dhcpStateTransitionInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
+
+var _ inspectInner = (*dhcpServerInspectImpl)(nil)
+
+type dhcpServerInspectImpl struct {
+	name   string
+	server *dhcp.Server
+	leases []dhcp.Lease
+}
+
+func (impl *dhcpServerInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+		Properties: []inspect.Property{
+			{Key: "ServerAddress", Value: inspect.PropertyValueWithStr(impl.server.ServerAddress().String())},
+		},
+		Metrics: []inspect.Metric{
+			{Key: "PoolSize", Value: inspect.MetricValueWithUintValue(uint64(impl.server.PoolSize()))},
+			{Key: "Leases", Value: inspect.MetricValueWithUintValue(uint64(len(impl.leases)))},
+		},
+	}
+}
+
+func (impl *dhcpServerInspectImpl) ListChildren() []string {
+	children := make([]string, 0, len(impl.leases))
+	for _, lease := range impl.leases {
+		children = append(children, lease.Addr.String())
+	}
+	return children
+}
+
+func (impl *dhcpServerInspectImpl) GetChild(childName string) inspectInner {
+	for _, lease := range impl.leases {
+		if lease.Addr.String() == childName {
+			return &dhcpLeaseInspectImpl{value: lease}
+		}
+	}
+	return nil
+}
+
+var _ inspectInner = (*dhcpLeaseInspectImpl)(nil)
+
+type dhcpLeaseInspectImpl struct {
+	value dhcp.Lease
+}
+
+func (impl *dhcpLeaseInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.value.Addr.String(),
+		Properties: []inspect.Property{
+			{Key: "Link address", Value: inspect.PropertyValueWithStr(impl.value.LinkAddress.String())},
+			{Key: "State", Value: inspect.PropertyValueWithStr(impl.value.State)},
+			{Key: "Start", Value: inspect.PropertyValueWithStr(impl.value.Start.String())},
+		},
+	}
+}
+
+func (*dhcpLeaseInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*dhcpLeaseInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
+
 var _ inspectInner = (*ethInfoInspectImpl)(nil)
 
 type ethInfoInspectImpl struct {
@@ -852,6 +1159,13 @@ var _ inspectInner = (*socketInfoMapInspectImpl)(nil)
 
 type socketInfoMapInspectImpl struct {
 	value *endpointsMap
+	// listeners and clock are optional; if set, listening sockets also report
+	// their accept activity.
+	listeners *listenersMap
+	clock     tcpip.Clock
+	// clients is optional; if set, sockets also report the client that
+	// created them.
+	clients *socketClientsMap
 }
 
 func (*socketInfoMapInspectImpl) ReadData() inspect.Object {
@@ -876,12 +1190,24 @@ func (impl *socketInfoMapInspectImpl) GetChild(childName string) inspectInner {
 		return nil
 	}
 	if ep, ok := impl.value.Load(uint64(id)); ok {
-		return &socketInfoInspectImpl{
+		child := &socketInfoInspectImpl{
 			name:  childName,
 			info:  ep.Info(),
 			state: ep.State(),
 			stats: ep.Stats(),
 		}
+		if impl.listeners != nil {
+			if l, ok := impl.listeners.Load(id); ok {
+				snapshot := l.snapshot(impl.clock.NowMonotonic())
+				child.listener = &snapshot
+			}
+		}
+		if impl.clients != nil {
+			if koid, ok := impl.clients.owner(id); ok {
+				child.clientKoid = &koid
+			}
+		}
+		return child
 	}
 	return nil
 }
@@ -893,6 +1219,10 @@ type socketInfoInspectImpl struct {
 	info  tcpip.EndpointInfo
 	state uint32
 	stats tcpip.EndpointStats
+	// listener is set for listening stream sockets.
+	listener *listenerSnapshot
+	// clientKoid is set if the client that created the socket is known.
+	clientKoid *uint64
 }
 
 func (impl *socketInfoInspectImpl) ReadData() inspect.Object {
@@ -957,6 +1287,16 @@ func (impl *socketInfoInspectImpl) ReadData() inspect.Object {
 		{Key: "BindNICID", Value: inspect.PropertyValueWithStr(strconv.FormatUint(uint64(common.BindNICID), 10))},
 		{Key: "RegisterNICID", Value: inspect.PropertyValueWithStr(strconv.FormatUint(uint64(common.RegisterNICID), 10))},
 	}
+	if l := impl.listener; l != nil {
+		properties = append(properties,
+			inspect.Property{Key: "Accepts", Value: inspect.PropertyValueWithStr(strconv.FormatUint(l.accepts, 10))},
+			inspect.Property{Key: "IdleSeconds", Value: inspect.PropertyValueWithStr(strconv.FormatInt(int64(l.idle.Seconds()), 10))},
+			inspect.Property{Key: "OwnerGone", Value: inspect.PropertyValueWithStr(strconv.FormatBool(l.ownerGone))},
+		)
+	}
+	if koid := impl.clientKoid; koid != nil {
+		properties = append(properties, inspect.Property{Key: "ClientKoid", Value: inspect.PropertyValueWithStr(strconv.FormatUint(*koid, 10))})
+	}
 
 	return inspect.Object{
 		Name:       impl.name,
@@ -964,14 +1304,43 @@ func (impl *socketInfoInspectImpl) ReadData() inspect.Object {
 	}
 }
 
-func (*socketInfoInspectImpl) ListChildren() []string {
-	return []string{
+func (impl *socketInfoInspectImpl) ListChildren() []string {
+	children := []string{
 		statsLabel,
 	}
+	if _, ok := socketDropsFromStats(impl.stats); ok {
+		children = append(children, dropsLabel)
+	}
+	if l := impl.listener; l != nil && l.dualStack {
+		children = append(children, ipv4AcceptedLabel, ipv6AcceptedLabel)
+	}
+	return children
 }
 
 func (impl *socketInfoInspectImpl) GetChild(childName string) inspectInner {
 	switch childName {
+	case ipv4AcceptedLabel, ipv6AcceptedLabel:
+		l := impl.listener
+		if l == nil || !l.dualStack {
+			return nil
+		}
+		value := l.ipv4
+		if childName == ipv6AcceptedLabel {
+			value = l.ipv6
+		}
+		return &familyStatsInspectImpl{
+			name:  childName,
+			value: value,
+		}
+	case dropsLabel:
+		drops, ok := socketDropsFromStats(impl.stats)
+		if !ok {
+			return nil
+		}
+		return &socketDropsInspectImpl{
+			name:  childName,
+			value: drops,
+		}
 	case statsLabel:
 		var value reflect.Value
 		switch t := impl.stats.(type) {
@@ -990,6 +1359,160 @@ func (impl *socketInfoInspectImpl) GetChild(childName string) inspectInner {
 	return nil
 }
 
+// socketDrops attributes the packets dropped by a socket to the reason they
+// were dropped for.
+//
+// Packets dropped before they are delivered to a socket, e.g. because their
+// TTL expired or they were filtered, can't be attributed to it and are only
+// counted by the stack-wide counters.
+type socketDrops struct {
+	// queueFull counts packets dropped because the socket's receive queue
+	// was full.
+	queueFull uint64
+	// checksumError counts packets dropped because their transport checksum
+	// was invalid.
+	checksumError uint64
+}
+
+// socketDropsFromStats returns the drops recorded in a socket's stats, or false
+// if the stats are of an unknown type.
+func socketDropsFromStats(stats tcpip.EndpointStats) (socketDrops, bool) {
+	switch t := stats.(type) {
+	case *tcp.Stats:
+		return socketDrops{
+			queueFull:     t.ReceiveErrors.ReceiveBufferOverflow.Value() + t.ReceiveErrors.SegmentQueueDropped.Value(),
+			checksumError: t.ReceiveErrors.ChecksumErrors.Value(),
+		}, true
+	case *tcpip.TransportEndpointStats:
+		return socketDrops{
+			queueFull:     t.ReceiveErrors.ReceiveBufferOverflow.Value(),
+			checksumError: t.ReceiveErrors.ChecksumErrors.Value(),
+		}, true
+	default:
+		return socketDrops{}, false
+	}
+}
+
+var _ inspectInner = (*socketClientsInspectImpl)(nil)
+
+// socketClientsInspectImpl reports the sockets of each client of the socket
+// providers, keyed by the client's koid.
+type socketClientsInspectImpl struct {
+	value *socketClientsMap
+}
+
+func (*socketClientsInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: socketClientsLabel,
+	}
+}
+
+func (impl *socketClientsInspectImpl) ListChildren() []string {
+	var children []string
+	for _, koid := range impl.value.koids() {
+		children = append(children, strconv.FormatUint(koid, 10))
+	}
+	return children
+}
+
+func (impl *socketClientsInspectImpl) GetChild(childName string) inspectInner {
+	koid, err := strconv.ParseUint(childName, 10, 64)
+	if err != nil {
+		_ = syslog.VLogTf(syslog.DebugVerbosity, inspect.InspectName, "GetChild(): %s", err)
+		return nil
+	}
+	if snapshot, ok := impl.value.snapshot(koid); ok {
+		return &socketClientInspectImpl{
+			name:  childName,
+			value: snapshot,
+		}
+	}
+	return nil
+}
+
+var _ inspectInner = (*socketClientInspectImpl)(nil)
+
+type socketClientInspectImpl struct {
+	name  string
+	value socketClientSnapshot
+}
+
+func (impl *socketClientInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+		Properties: []inspect.Property{
+			{Key: "Connected", Value: inspect.PropertyValueWithStr(strconv.FormatBool(impl.value.connected))},
+		},
+		Metrics: []inspect.Metric{
+			{Key: "SocketsCreated", Value: inspect.MetricValueWithUintValue(impl.value.created)},
+			{Key: "SocketsOpen", Value: inspect.MetricValueWithUintValue(impl.value.open)},
+			{Key: "PacketsSent", Value: inspect.MetricValueWithUintValue(impl.value.traffic.packetsSent)},
+			{Key: "PacketsReceived", Value: inspect.MetricValueWithUintValue(impl.value.traffic.packetsReceived)},
+		},
+	}
+}
+
+func (*socketClientInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*socketClientInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
+
+var _ inspectInner = (*socketDropsInspectImpl)(nil)
+
+type socketDropsInspectImpl struct {
+	name  string
+	value socketDrops
+}
+
+func (impl *socketDropsInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+		Metrics: []inspect.Metric{
+			{Key: "QueueFull", Value: inspect.MetricValueWithUintValue(impl.value.queueFull)},
+			{Key: "ChecksumError", Value: inspect.MetricValueWithUintValue(impl.value.checksumError)},
+		},
+	}
+}
+
+func (*socketDropsInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*socketDropsInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
+
+var _ inspectInner = (*familyStatsInspectImpl)(nil)
+
+// familyStatsInspectImpl reports the connections a dual-stack listener
+// accepted over one network protocol.
+type familyStatsInspectImpl struct {
+	name  string
+	value familyStats
+}
+
+func (impl *familyStatsInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+		Metrics: []inspect.Metric{
+			{Key: "Accepts", Value: inspect.MetricValueWithUintValue(impl.value.accepts)},
+			{Key: "SegmentsReceived", Value: inspect.MetricValueWithUintValue(impl.value.segmentsReceived)},
+			{Key: "SegmentsSent", Value: inspect.MetricValueWithUintValue(impl.value.segmentsSent)},
+		},
+	}
+}
+
+func (*familyStatsInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*familyStatsInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
+
 var _ inspectInner = (*routingTableInspectImpl)(nil)
 
 type routingTableInspectImpl struct {
@@ -1044,6 +1567,7 @@ func (impl *routeInfoInspectImpl) ReadData() inspect.Object {
 	return inspect.Object{
 		Name: impl.name,
 		Properties: []inspect.Property{
+			{Key: "Type", Value: inspect.PropertyValueWithStr(impl.value.Type.String())},
 			{Key: "Destination", Value: inspect.PropertyValueWithStr(impl.value.Route.Destination.String())},
 			{Key: "Gateway", Value: inspect.PropertyValueWithStr(impl.value.Route.Gateway.String())},
 			{Key: "NIC", Value: inspect.PropertyValueWithStr(strconv.FormatUint(uint64(impl.value.Route.NIC), 10))},
@@ -1174,3 +1698,202 @@ func (*memstatsInspectImpl) ListChildren() []string {
 func (*memstatsInspectImpl) GetChild(string) inspectInner {
 	return nil
 }
+
+var _ inspectInner = (*tunablesInspectImpl)(nil)
+
+type tunablesInspectImpl struct {
+	value []tunableValue
+}
+
+func (impl *tunablesInspectImpl) ReadData() inspect.Object {
+	properties := make([]inspect.Property, 0, len(impl.value))
+	for _, v := range impl.value {
+		properties = append(properties, inspect.Property{Key: v.name, Value: inspect.PropertyValueWithStr(v.value)})
+	}
+	return inspect.Object{
+		Name:       "Tunables",
+		Properties: properties,
+	}
+}
+
+func (*tunablesInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*tunablesInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
+
+var _ inspectInner = (*addressPolicyInspectImpl)(nil)
+
+type addressPolicyInspectImpl struct {
+	value *addressPolicyTable
+}
+
+func (*addressPolicyInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: "Address Policy",
+	}
+}
+
+func (impl *addressPolicyInspectImpl) ListChildren() []string {
+	policies := impl.value.Policies()
+	children := make([]string, 0, len(policies))
+	for i := range policies {
+		children = append(children, strconv.FormatUint(uint64(i), 10))
+	}
+	return children
+}
+
+func (impl *addressPolicyInspectImpl) GetChild(childName string) inspectInner {
+	policies := impl.value.Policies()
+	index, err := strconv.ParseUint(childName, 10, 64)
+	if err != nil {
+		_ = syslog.VLogTf(syslog.DebugVerbosity, inspect.InspectName, "GetChild(): %s", err)
+		return nil
+	}
+	if index >= uint64(len(policies)) {
+		_ = syslog.VLogTf(
+			syslog.DebugVerbosity,
+			inspect.InspectName,
+			"GetChild(%s): index %d out of bounds, there are %d entries in the address policy table",
+			childName,
+			index,
+			len(policies),
+		)
+		return nil
+	}
+	return &addressPolicyEntryInspectImpl{
+		name:  childName,
+		value: policies[index],
+	}
+}
+
+var _ inspectInner = (*addressPolicyEntryInspectImpl)(nil)
+
+type addressPolicyEntryInspectImpl struct {
+	name  string
+	value addressPolicy
+}
+
+func (impl *addressPolicyEntryInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+		Properties: []inspect.Property{
+			{Key: "Prefix", Value: inspect.PropertyValueWithStr(fmt.Sprintf("%s/%d", impl.value.prefix.ID(), impl.value.prefix.Prefix()))},
+		},
+		Metrics: []inspect.Metric{
+			{Key: "Precedence", Value: inspect.MetricValueWithUintValue(uint64(impl.value.precedence))},
+			{Key: "Label", Value: inspect.MetricValueWithUintValue(uint64(impl.value.label))},
+		},
+	}
+}
+
+func (*addressPolicyEntryInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*addressPolicyEntryInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
+
+var _ inspectInner = (*natInspectImpl)(nil)
+
+type natInspectImpl struct {
+	rules      []filter.Nat
+	generation uint32
+}
+
+func (impl *natInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: "NAT",
+		Metrics: []inspect.Metric{
+			{Key: "Generation", Value: inspect.MetricValueWithUintValue(uint64(impl.generation))},
+		},
+	}
+}
+
+func (impl *natInspectImpl) ListChildren() []string {
+	children := make([]string, 0, len(impl.rules))
+	for i := range impl.rules {
+		children = append(children, strconv.FormatUint(uint64(i), 10))
+	}
+	return children
+}
+
+func (impl *natInspectImpl) GetChild(childName string) inspectInner {
+	index, err := strconv.ParseUint(childName, 10, 64)
+	if err != nil {
+		_ = syslog.VLogTf(syslog.DebugVerbosity, inspect.InspectName, "GetChild(): %s", err)
+		return nil
+	}
+	if index >= uint64(len(impl.rules)) {
+		_ = syslog.VLogTf(
+			syslog.DebugVerbosity,
+			inspect.InspectName,
+			"GetChild(%s): index %d out of bounds, there are %d NAT rules",
+			childName,
+			index,
+			len(impl.rules),
+		)
+		return nil
+	}
+	return &natRuleInspectImpl{
+		name:  childName,
+		value: impl.rules[index],
+	}
+}
+
+var _ inspectInner = (*natRuleInspectImpl)(nil)
+
+type natRuleInspectImpl struct {
+	name  string
+	value filter.Nat
+}
+
+func (impl *natRuleInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+		Properties: []inspect.Property{
+			{Key: "Source Subnet", Value: inspect.PropertyValueWithStr(fidlconv.ToTCPIPSubnet(impl.value.SrcSubnet).String())},
+			{Key: "Protocol", Value: inspect.PropertyValueWithStr(impl.value.Proto.String())},
+		},
+		Metrics: []inspect.Metric{
+			{Key: "Outgoing NIC", Value: inspect.MetricValueWithUintValue(uint64(impl.value.OutgoingNic))},
+		},
+	}
+}
+
+func (*natRuleInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*natRuleInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
+
+var _ inspectInner = (*tcpKeepaliveInspectImpl)(nil)
+
+type tcpKeepaliveInspectImpl struct {
+	value *tcpKeepalive
+}
+
+func (impl *tcpKeepaliveInspectImpl) ReadData() inspect.Object {
+	defaults := impl.value.Defaults()
+	return inspect.Object{
+		Name: "TCP Keepalive Defaults",
+		Metrics: []inspect.Metric{
+			{Key: "IdleSecs", Value: inspect.MetricValueWithUintValue(uint64(defaults.idle.Seconds()))},
+			{Key: "IntervalSecs", Value: inspect.MetricValueWithUintValue(uint64(defaults.interval.Seconds()))},
+			{Key: "Count", Value: inspect.MetricValueWithUintValue(uint64(defaults.count))},
+		},
+	}
+}
+
+func (*tcpKeepaliveInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*tcpKeepaliveInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
@@ -25,6 +25,7 @@ import (
 
 	"fidl/fuchsia/hardware/ethernet"
 	inspect "fidl/fuchsia/inspect/deprecated"
+	"fidl/fuchsia/net/filter"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -450,6 +451,7 @@ func TestSocketStatCounterInspectImpl(t *testing.T) {
 		epChildren := child.ListChildren()
 		if diff := cmp.Diff([]string{
 			"Stats",
+			"Drops",
 		}, epChildren); diff != "" {
 			t.Errorf("ListChildren() mismatch (-want +got):\n%s", diff)
 		}
@@ -500,6 +502,109 @@ func TestSocketStatCounterInspectImpl(t *testing.T) {
 	}
 }
 
+func TestDualStackListenerInspectImpl(t *testing.T) {
+	impl := socketInfoInspectImpl{
+		name: "1",
+		listener: &listenerSnapshot{
+			dualStack: true,
+			ipv4:      familyStats{accepts: 1, segmentsReceived: 2, segmentsSent: 3},
+			ipv6:      familyStats{accepts: 4, segmentsReceived: 5, segmentsSent: 6},
+		},
+	}
+	if diff := cmp.Diff([]string{statsLabel, ipv4AcceptedLabel, ipv6AcceptedLabel}, impl.ListChildren()); diff != "" {
+		t.Errorf("ListChildren() mismatch (-want +got):\n%s", diff)
+	}
+	for _, test := range []struct {
+		label string
+		want  familyStats
+	}{
+		{label: ipv4AcceptedLabel, want: impl.listener.ipv4},
+		{label: ipv6AcceptedLabel, want: impl.listener.ipv6},
+	} {
+		child := impl.GetChild(test.label)
+		if child == nil {
+			t.Fatalf("got GetChild(%s) = nil, want non-nil", test.label)
+		}
+		if diff := cmp.Diff(inspect.Object{
+			Name: test.label,
+			Metrics: []inspect.Metric{
+				{Key: "Accepts", Value: inspect.MetricValueWithUintValue(test.want.accepts)},
+				{Key: "SegmentsReceived", Value: inspect.MetricValueWithUintValue(test.want.segmentsReceived)},
+				{Key: "SegmentsSent", Value: inspect.MetricValueWithUintValue(test.want.segmentsSent)},
+			},
+		}, child.ReadData(), cmpopts.IgnoreUnexported(inspect.Object{}, inspect.Metric{})); diff != "" {
+			t.Errorf("ReadData() mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	impl.listener.dualStack = false
+	if diff := cmp.Diff([]string{statsLabel}, impl.ListChildren()); diff != "" {
+		t.Errorf("ListChildren() mismatch (-want +got):\n%s", diff)
+	}
+	if child := impl.GetChild(ipv4AcceptedLabel); child != nil {
+		t.Errorf("got GetChild(%s) = %#v, want = nil", ipv4AcceptedLabel, child)
+	}
+}
+
+func TestSocketDropsInspectImpl(t *testing.T) {
+	addGoleakCheck(t)
+
+	var tcpStats tcp.Stats
+	tcpStats.ReceiveErrors.ReceiveBufferOverflow.Increment()
+	tcpStats.ReceiveErrors.SegmentQueueDropped.Increment()
+	tcpStats.ReceiveErrors.ChecksumErrors.Increment()
+	var udpStats tcpip.TransportEndpointStats
+	udpStats.ReceiveErrors.ReceiveBufferOverflow.IncrementBy(3)
+
+	for _, test := range []struct {
+		name  string
+		stats tcpip.EndpointStats
+		want  []inspect.Metric
+	}{
+		{
+			name:  "TCP",
+			stats: &tcpStats,
+			want: []inspect.Metric{
+				{Key: "QueueFull", Value: inspect.MetricValueWithUintValue(2)},
+				{Key: "ChecksumError", Value: inspect.MetricValueWithUintValue(1)},
+			},
+		},
+		{
+			name:  "UDP",
+			stats: &udpStats,
+			want: []inspect.Metric{
+				{Key: "QueueFull", Value: inspect.MetricValueWithUintValue(3)},
+				{Key: "ChecksumError", Value: inspect.MetricValueWithUintValue(0)},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			impl := socketInfoInspectImpl{
+				name:  "1",
+				stats: test.stats,
+			}
+			if diff := cmp.Diff([]string{statsLabel, dropsLabel}, impl.ListChildren()); diff != "" {
+				t.Errorf("ListChildren() mismatch (-want +got):\n%s", diff)
+			}
+			child := impl.GetChild(dropsLabel)
+			if child == nil {
+				t.Fatalf("got GetChild(%s) = nil, want non-nil", dropsLabel)
+			}
+			if diff := cmp.Diff(inspect.Object{
+				Name:    dropsLabel,
+				Metrics: test.want,
+			}, child.ReadData(), cmpopts.IgnoreUnexported(inspect.Object{}, inspect.Metric{})); diff != "" {
+				t.Errorf("ReadData() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	impl := socketInfoInspectImpl{name: "1"}
+	if child := impl.GetChild(dropsLabel); child != nil {
+		t.Errorf("got GetChild(%s) = %#v, want = nil", dropsLabel, child)
+	}
+}
+
 func TestNicInfoMapInspectImpl(t *testing.T) {
 	addGoleakCheck(t)
 
@@ -616,6 +721,10 @@ func TestDHCPInfoInspectImpl(t *testing.T) {
 			{Timestamp: 1, Content: "1"},
 			{Timestamp: 2, Content: "2"},
 		},
+		stateTransitions: []dhcp.StateTransition{
+			{Timestamp: tcpip.MonotonicTime{}.Add(3), Reason: dhcp.TransitionReasonTimeout},
+			{Timestamp: tcpip.MonotonicTime{}.Add(4)},
+		},
 		stats: &dhcp.Stats{},
 	}
 	v.stats.PacketDiscardStats.Init()
@@ -633,7 +742,7 @@ func TestDHCPInfoInspectImpl(t *testing.T) {
 	}
 	children := v.ListChildren()
 	if diff := cmp.Diff([]string{
-		"Stats", "DHCP State Recent History",
+		"Stats", "DHCP State Recent History", "DHCP State Transitions",
 	}, children); diff != "" {
 		t.Errorf("ListChildren() mismatch (-want +got):\n%s", diff)
 	}
@@ -806,6 +915,47 @@ func TestDHCPInfoInspectImpl(t *testing.T) {
 			}
 		}
 	}
+
+	{
+		child := v.GetChild("DHCP State Transitions")
+		transitions, ok := child.(*dhcpStateTransitionsInspectImpl)
+		if !ok {
+			t.Fatalf("got GetChild(DHCP State Transitions) = %#v, want %T", child, (*dhcpStateTransitionsInspectImpl)(nil))
+		}
+		if err := checkInspectRecurse(transitions, inspectNodeExpectation{
+			node: inspect.Object{
+				Name: "DHCP State Transitions",
+			},
+			children: []inspectNodeExpectation{
+				{
+					node: inspect.Object{
+						Name: "0",
+						Properties: []inspect.Property{
+							{Key: "@time", Value: inspect.PropertyValueWithStr("3")},
+							{Key: "From", Value: inspect.PropertyValueWithStr("initSelecting")},
+							{Key: "To", Value: inspect.PropertyValueWithStr("initSelecting")},
+							{Key: "Reason", Value: inspect.PropertyValueWithStr(dhcp.TransitionReasonTimeout)},
+						},
+					},
+				},
+				{
+					node: inspect.Object{
+						Name: "1",
+						Properties: []inspect.Property{
+							{Key: "@time", Value: inspect.PropertyValueWithStr("4")},
+							{Key: "From", Value: inspect.PropertyValueWithStr("initSelecting")},
+							{Key: "To", Value: inspect.PropertyValueWithStr("initSelecting")},
+						},
+					},
+				},
+			},
+		}); err != nil {
+			t.Error(err)
+		}
+		if child := transitions.GetChild("2"); child != nil {
+			t.Errorf("got GetChild(2) = %#v, want = nil", child)
+		}
+	}
 }
 
 func TestEthInfoInspectImpl(t *testing.T) {
@@ -1320,3 +1470,55 @@ func TestNeighborInfoInspectImpl(t *testing.T) {
 		})
 	}
 }
+
+func TestNATInspectImpl(t *testing.T) {
+	addGoleakCheck(t)
+
+	impl := natInspectImpl{
+		rules: []filter.Nat{
+			{
+				Proto: filter.SocketProtocolTcp,
+				SrcSubnet: fidlconv.ToNetSubnet(tcpip.AddressWithPrefix{
+					Address:   util.Parse("192.168.42.0"),
+					PrefixLen: 24,
+				}),
+				OutgoingNic: 2,
+			},
+		},
+		generation: 3,
+	}
+	children := impl.ListChildren()
+	if diff := cmp.Diff([]string{"0"}, children); diff != "" {
+		t.Errorf("ListChildren() mismatch (-want +got):\n%s", diff)
+	}
+	for _, childName := range []string{"not a real child", "1"} {
+		if got := impl.GetChild(childName); got != nil {
+			t.Errorf("got GetChild(%s) = %s, want = nil", childName, got)
+		}
+	}
+	if diff := cmp.Diff(inspect.Object{
+		Name: "NAT",
+		Metrics: []inspect.Metric{
+			{Key: "Generation", Value: inspect.MetricValueWithUintValue(3)},
+		},
+	}, impl.ReadData(), cmpopts.IgnoreUnexported(inspect.Object{}, inspect.Metric{})); diff != "" {
+		t.Errorf("ReadData() mismatch (-want +got):\n%s", diff)
+	}
+
+	child := impl.GetChild("0")
+	if child == nil {
+		t.Fatal("got GetChild(0) = nil, want non-nil")
+	}
+	if diff := cmp.Diff(inspect.Object{
+		Name: "0",
+		Properties: []inspect.Property{
+			{Key: "Source Subnet", Value: inspect.PropertyValueWithStr("192.168.42.0/24")},
+			{Key: "Protocol", Value: inspect.PropertyValueWithStr("Tcp")},
+		},
+		Metrics: []inspect.Metric{
+			{Key: "Outgoing NIC", Value: inspect.MetricValueWithUintValue(2)},
+		},
+	}, child.ReadData(), cmpopts.IgnoreUnexported(inspect.Object{}, inspect.Property{}, inspect.Metric{})); diff != "" {
+		t.Errorf("GetChild(0).ReadData() mismatch (-want +got):\n%s", diff)
+	}
+}
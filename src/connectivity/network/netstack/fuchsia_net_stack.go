@@ -54,6 +54,10 @@ func (ns *Netstack) getForwardingTable() []stack.ForwardingEntry {
 	ert := ns.GetExtendedRouteTable()
 	entries := make([]stack.ForwardingEntry, 0, len(ert))
 	for _, er := range ert {
+		// Forwarding entries cannot express blackhole or unreachable routes.
+		if er.Type != routes.RouteTypeUnicast {
+			continue
+		}
 		entry := fidlconv.TCPIPRouteToForwardingEntry(er.Route)
 		entry.Metric = uint32(er.Metric)
 		entries = append(entries, entry)
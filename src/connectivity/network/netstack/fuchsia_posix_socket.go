@@ -23,10 +23,12 @@ import (
 	"time"
 	"unsafe"
 
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/bpf"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/fidlconv"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/sync"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/tracing/trace"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/udp_serde"
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/util"
 	"go.fuchsia.dev/fuchsia/src/lib/component"
 	syslog "go.fuchsia.dev/fuchsia/src/lib/syslog/go"
 
@@ -209,6 +211,9 @@ func (s *signaler) mustUpdate() {
 }
 
 type streamSocketError struct {
+	// onError, if set, is called with the first terminal error stored.
+	onError func(tcpip.Error)
+
 	mu struct {
 		sync.Mutex
 		ch  <-chan tcpip.Error
@@ -259,6 +264,9 @@ func (s *streamSocketError) setLockedInner(err tcpip.Error) tcpip.Error {
 			close(ch)
 			s.mu.ch = ch
 			s.mu.err = err
+			if s.onError != nil {
+				s.onError(err)
+			}
 		}
 		return previous
 	default:
@@ -316,6 +324,14 @@ type endpoint struct {
 
 	key uint64
 
+	// connectClient identifies the client that created the endpoint to the
+	// connect throttle.
+	connectClient uint64
+
+	// client is the socket provider client that created the endpoint, if
+	// known. Accepted connections belong to the client of their listener.
+	client *socketClient
+
 	ns *Netstack
 }
 
@@ -423,6 +439,7 @@ func (ep *endpoint) toTCPIPFullAddress(address fidlnet.SocketAddress) (tcpip.Ful
 }
 
 func (ep *endpoint) connect(addr tcpip.FullAddress) tcpip.Error {
+	ep.bindPolicySourceAddress(addr)
 	if err := ep.ep.Connect(addr); err != nil {
 		return err
 	}
@@ -447,6 +464,49 @@ func (ep *endpoint) connect(addr tcpip.FullAddress) tcpip.Error {
 	return nil
 }
 
+// bindPolicySourceAddress binds an unbound IPv6 stream endpoint to the source
+// address that the address selection policy prefers for connecting to addr, if
+// the stack would pick a different one. Failing to bind leaves the choice to
+// the stack.
+//
+// gVisor can't unbind an endpoint, so the bind can't be undone if the connect
+// that follows fails. Instead, the address is only bound once a route from it
+// to addr is known to exist, so that the bind never causes the connect to
+// fail, and a stream endpoint whose connect fails can't be connected again
+// anyway. Datagram endpoints may be connected again to other destinations,
+// which the bound address would then be used for too, so they are left to the
+// stack.
+func (ep *endpoint) bindPolicySourceAddress(addr tcpip.FullAddress) {
+	if ep.transProto != tcp.ProtocolNumber {
+		return
+	}
+	if ep.ns.addressPolicy == nil && !ep.ns.avoidsTemporaryAddresses() {
+		return
+	}
+	if ep.netProto != ipv6.ProtocolNumber || len(addr.Addr) != header.IPv6AddressSize || header.IsV4MappedAddress(addr.Addr) {
+		return
+	}
+	localAddr, err := ep.ep.GetLocalAddress()
+	if err != nil || localAddr.Port != 0 || (len(localAddr.Addr) != 0 && !util.IsAny(localAddr.Addr)) {
+		return
+	}
+	src, ok := ep.ns.policySourceAddress(addr)
+	if !ok {
+		return
+	}
+	r, err := ep.ns.stack.FindRoute(addr.NIC, src, addr.Addr, ipv6.ProtocolNumber, false /* multicastLoop */)
+	if err != nil {
+		_ = syslog.DebugTf(addressPolicyTagName, "%p: no route from %s to %s: %s", ep, src, addr.Addr, err)
+		return
+	}
+	r.Release()
+	if err := ep.ep.Bind(tcpip.FullAddress{NIC: addr.NIC, Addr: src}); err != nil {
+		_ = syslog.DebugTf(addressPolicyTagName, "%p: bind to %s for %s failed: %s", ep, src, addr.Addr, err)
+		return
+	}
+	ep.ns.stats.AddressPolicy.SourceAddressOverrides.Increment()
+}
+
 func (ep *endpoint) Disconnect(fidl.Context) (socket.BaseNetworkSocketDisconnectResult, error) {
 	if err := ep.ep.Disconnect(); err != nil {
 		return socket.BaseNetworkSocketDisconnectResultWithErr(tcpipErrorToCode(err)), nil
@@ -476,6 +536,7 @@ func (ep *endpoint) GetPeerName(fidl.Context) (socket.BaseNetworkSocketGetPeerNa
 
 // TODO(https://fxbug.dev/87656): Remove after ABI transition.
 func (ep *endpoint) GetTimestampDeprecated(fidl.Context) (socket.BaseSocketGetTimestampDeprecatedResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_TIMESTAMP")
 	ep.mu.RLock()
 	value := ep.mu.sockOptTimestamp
 	ep.mu.RUnlock()
@@ -484,6 +545,7 @@ func (ep *endpoint) GetTimestampDeprecated(fidl.Context) (socket.BaseSocketGetTi
 
 // TODO(https://fxbug.dev/87656): Remove after ABI transition.
 func (ep *endpoint) SetTimestampDeprecated(_ fidl.Context, value socket.TimestampOption) (socket.BaseSocketSetTimestampDeprecatedResult, error) {
+	ep.ns.stats.SocketOptions.set(solSocket, "SO_TIMESTAMP")
 	ep.mu.Lock()
 	ep.mu.sockOptTimestamp = value
 	ep.mu.Unlock()
@@ -491,6 +553,7 @@ func (ep *endpoint) SetTimestampDeprecated(_ fidl.Context, value socket.Timestam
 }
 
 func (ep *endpoint) GetTimestamp(fidl.Context) (socket.BaseSocketGetTimestampResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_TIMESTAMP")
 	ep.mu.RLock()
 	value := ep.mu.sockOptTimestamp
 	ep.mu.RUnlock()
@@ -504,6 +567,7 @@ func (ep *endpoint) setTimestamp(value socket.TimestampOption) {
 }
 
 func (ep *endpoint) SetTimestamp(_ fidl.Context, value socket.TimestampOption) (socket.BaseSocketSetTimestampResult, error) {
+	ep.ns.stats.SocketOptions.set(solSocket, "SO_TIMESTAMP")
 	ep.setTimestamp(value)
 	return socket.BaseSocketSetTimestampResultWithResponse(socket.BaseSocketSetTimestampResponse{}), nil
 }
@@ -548,48 +612,57 @@ func setBufferSize(size uint64, set func(int64, bool), limits func() (min, max i
 }
 
 func (ep *endpoint) SetSendBuffer(_ fidl.Context, size uint64) (socket.BaseSocketSetSendBufferResult, error) {
+	ep.ns.stats.SocketOptions.set(solSocket, "SO_SNDBUF")
 	opts := ep.ep.SocketOptions()
 	setBufferSize(size, opts.SetSendBufferSize, opts.SendBufferLimits)
 	return socket.BaseSocketSetSendBufferResultWithResponse(socket.BaseSocketSetSendBufferResponse{}), nil
 }
 
 func (ep *endpoint) GetSendBuffer(fidl.Context) (socket.BaseSocketGetSendBufferResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_SNDBUF")
 	size := ep.ep.SocketOptions().GetSendBufferSize()
 	return socket.BaseSocketGetSendBufferResultWithResponse(socket.BaseSocketGetSendBufferResponse{ValueBytes: uint64(size)}), nil
 }
 
 func (ep *endpoint) SetReceiveBuffer(_ fidl.Context, size uint64) (socket.BaseSocketSetReceiveBufferResult, error) {
+	ep.ns.stats.SocketOptions.set(solSocket, "SO_RCVBUF")
 	opts := ep.ep.SocketOptions()
 	setBufferSize(size, opts.SetReceiveBufferSize, opts.ReceiveBufferLimits)
 	return socket.BaseSocketSetReceiveBufferResultWithResponse(socket.BaseSocketSetReceiveBufferResponse{}), nil
 }
 
 func (ep *endpoint) GetReceiveBuffer(fidl.Context) (socket.BaseSocketGetReceiveBufferResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_RCVBUF")
 	size := ep.ep.SocketOptions().GetReceiveBufferSize()
 	return socket.BaseSocketGetReceiveBufferResultWithResponse(socket.BaseSocketGetReceiveBufferResponse{ValueBytes: uint64(size)}), nil
 }
 
 func (ep *endpoint) SetReuseAddress(_ fidl.Context, value bool) (socket.BaseSocketSetReuseAddressResult, error) {
+	ep.ns.stats.SocketOptions.set(solSocket, "SO_REUSEADDR")
 	ep.ep.SocketOptions().SetReuseAddress(value)
 	return socket.BaseSocketSetReuseAddressResultWithResponse(socket.BaseSocketSetReuseAddressResponse{}), nil
 }
 
 func (ep *endpoint) GetReuseAddress(fidl.Context) (socket.BaseSocketGetReuseAddressResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_REUSEADDR")
 	value := ep.ep.SocketOptions().GetReuseAddress()
 	return socket.BaseSocketGetReuseAddressResultWithResponse(socket.BaseSocketGetReuseAddressResponse{Value: value}), nil
 }
 
 func (ep *endpoint) SetReusePort(_ fidl.Context, value bool) (socket.BaseSocketSetReusePortResult, error) {
+	ep.ns.stats.SocketOptions.set(solSocket, "SO_REUSEPORT")
 	ep.ep.SocketOptions().SetReusePort(value)
 	return socket.BaseSocketSetReusePortResultWithResponse(socket.BaseSocketSetReusePortResponse{}), nil
 }
 
 func (ep *endpoint) GetReusePort(fidl.Context) (socket.BaseSocketGetReusePortResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_REUSEPORT")
 	value := ep.ep.SocketOptions().GetReusePort()
 	return socket.BaseSocketGetReusePortResultWithResponse(socket.BaseSocketGetReusePortResponse{Value: value}), nil
 }
 
 func (ep *endpoint) GetAcceptConn(fidl.Context) (socket.BaseSocketGetAcceptConnResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_ACCEPTCONN")
 	value := false
 	if ep.transProto == tcp.ProtocolNumber {
 		value = tcp.EndpointState(ep.ep.State()) == tcp.StateListen
@@ -598,6 +671,7 @@ func (ep *endpoint) GetAcceptConn(fidl.Context) (socket.BaseSocketGetAcceptConnR
 }
 
 func (ep *endpoint) SetBindToDevice(_ fidl.Context, value string) (socket.BaseSocketSetBindToDeviceResult, error) {
+	ep.ns.stats.SocketOptions.set(solSocket, "SO_BINDTODEVICE")
 	if err := func() tcpip.Error {
 		if len(value) == 0 {
 			return ep.ep.SocketOptions().SetBindToDevice(0)
@@ -615,6 +689,7 @@ func (ep *endpoint) SetBindToDevice(_ fidl.Context, value string) (socket.BaseSo
 }
 
 func (ep *endpoint) GetBindToDevice(fidl.Context) (socket.BaseSocketGetBindToDeviceResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_BINDTODEVICE")
 	id := ep.ep.SocketOptions().GetBindToDevice()
 	if id == 0 {
 		return socket.BaseSocketGetBindToDeviceResultWithResponse(socket.BaseSocketGetBindToDeviceResponse{}), nil
@@ -629,26 +704,31 @@ func (ep *endpoint) GetBindToDevice(fidl.Context) (socket.BaseSocketGetBindToDev
 }
 
 func (ep *endpoint) SetBroadcast(_ fidl.Context, value bool) (socket.BaseSocketSetBroadcastResult, error) {
+	ep.ns.stats.SocketOptions.set(solSocket, "SO_BROADCAST")
 	ep.ep.SocketOptions().SetBroadcast(value)
 	return socket.BaseSocketSetBroadcastResultWithResponse(socket.BaseSocketSetBroadcastResponse{}), nil
 }
 
 func (ep *endpoint) GetBroadcast(fidl.Context) (socket.BaseSocketGetBroadcastResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_BROADCAST")
 	value := ep.ep.SocketOptions().GetBroadcast()
 	return socket.BaseSocketGetBroadcastResultWithResponse(socket.BaseSocketGetBroadcastResponse{Value: value}), nil
 }
 
 func (ep *endpoint) SetKeepAlive(_ fidl.Context, value bool) (socket.BaseSocketSetKeepAliveResult, error) {
+	ep.ns.stats.SocketOptions.set(solSocket, "SO_KEEPALIVE")
 	ep.ep.SocketOptions().SetKeepAlive(value)
 	return socket.BaseSocketSetKeepAliveResultWithResponse(socket.BaseSocketSetKeepAliveResponse{}), nil
 }
 
 func (ep *endpoint) GetKeepAlive(fidl.Context) (socket.BaseSocketGetKeepAliveResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_KEEPALIVE")
 	value := ep.ep.SocketOptions().GetKeepAlive()
 	return socket.BaseSocketGetKeepAliveResultWithResponse(socket.BaseSocketGetKeepAliveResponse{Value: value}), nil
 }
 
 func (ep *endpoint) SetLinger(_ fidl.Context, linger bool, seconds uint32) (socket.BaseSocketSetLingerResult, error) {
+	ep.ns.stats.SocketOptions.set(solSocket, "SO_LINGER")
 	ep.ep.SocketOptions().SetLinger(tcpip.LingerOption{
 		Enabled: linger,
 		Timeout: time.Second * time.Duration(seconds),
@@ -657,6 +737,7 @@ func (ep *endpoint) SetLinger(_ fidl.Context, linger bool, seconds uint32) (sock
 }
 
 func (ep *endpoint) GetLinger(fidl.Context) (socket.BaseSocketGetLingerResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_LINGER")
 	value := ep.ep.SocketOptions().GetLinger()
 	return socket.BaseSocketGetLingerResultWithResponse(
 		socket.BaseSocketGetLingerResponse{
@@ -667,11 +748,13 @@ func (ep *endpoint) GetLinger(fidl.Context) (socket.BaseSocketGetLingerResult, e
 }
 
 func (ep *endpoint) SetOutOfBandInline(_ fidl.Context, value bool) (socket.BaseSocketSetOutOfBandInlineResult, error) {
+	ep.ns.stats.SocketOptions.set(solSocket, "SO_OOBINLINE")
 	ep.ep.SocketOptions().SetOutOfBandInline(value)
 	return socket.BaseSocketSetOutOfBandInlineResultWithResponse(socket.BaseSocketSetOutOfBandInlineResponse{}), nil
 }
 
 func (ep *endpoint) GetOutOfBandInline(fidl.Context) (socket.BaseSocketGetOutOfBandInlineResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_OOBINLINE")
 	value := ep.ep.SocketOptions().GetOutOfBandInline()
 	return socket.BaseSocketGetOutOfBandInlineResultWithResponse(
 		socket.BaseSocketGetOutOfBandInlineResponse{
@@ -681,26 +764,31 @@ func (ep *endpoint) GetOutOfBandInline(fidl.Context) (socket.BaseSocketGetOutOfB
 }
 
 func (ep *endpoint) SetNoCheck(_ fidl.Context, value bool) (socket.BaseSocketSetNoCheckResult, error) {
+	ep.ns.stats.SocketOptions.set(solSocket, "SO_NO_CHECK")
 	ep.ep.SocketOptions().SetNoChecksum(value)
 	return socket.BaseSocketSetNoCheckResultWithResponse(socket.BaseSocketSetNoCheckResponse{}), nil
 }
 
 func (ep *endpoint) GetNoCheck(fidl.Context) (socket.BaseSocketGetNoCheckResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_NO_CHECK")
 	value := ep.ep.SocketOptions().GetNoChecksum()
 	return socket.BaseSocketGetNoCheckResultWithResponse(socket.BaseSocketGetNoCheckResponse{Value: value}), nil
 }
 
 func (ep *endpoint) SetIpv6Only(_ fidl.Context, value bool) (socket.BaseNetworkSocketSetIpv6OnlyResult, error) {
+	ep.ns.stats.SocketOptions.set(solIPv6, "IPV6_V6ONLY")
 	ep.ep.SocketOptions().SetV6Only(value)
 	return socket.BaseNetworkSocketSetIpv6OnlyResultWithResponse(socket.BaseNetworkSocketSetIpv6OnlyResponse{}), nil
 }
 
 func (ep *endpoint) GetIpv6Only(fidl.Context) (socket.BaseNetworkSocketGetIpv6OnlyResult, error) {
+	ep.ns.stats.SocketOptions.get(solIPv6, "IPV6_V6ONLY")
 	value := ep.ep.SocketOptions().GetV6Only()
 	return socket.BaseNetworkSocketGetIpv6OnlyResultWithResponse(socket.BaseNetworkSocketGetIpv6OnlyResponse{Value: value}), nil
 }
 
 func (ep *endpoint) SetIpv6TrafficClass(_ fidl.Context, value socket.OptionalUint8) (socket.BaseNetworkSocketSetIpv6TrafficClassResult, error) {
+	ep.ns.stats.SocketOptions.set(solIPv6, "IPV6_TCLASS")
 	v, err := optionalUint8ToInt(value, 0)
 	if err != nil {
 		return socket.BaseNetworkSocketSetIpv6TrafficClassResultWithErr(tcpipErrorToCode(err)), nil
@@ -712,6 +800,7 @@ func (ep *endpoint) SetIpv6TrafficClass(_ fidl.Context, value socket.OptionalUin
 }
 
 func (ep *endpoint) GetIpv6TrafficClass(fidl.Context) (socket.BaseNetworkSocketGetIpv6TrafficClassResult, error) {
+	ep.ns.stats.SocketOptions.get(solIPv6, "IPV6_TCLASS")
 	value, err := ep.ep.GetSockOptInt(tcpip.IPv6TrafficClassOption)
 	if err != nil {
 		return socket.BaseNetworkSocketGetIpv6TrafficClassResultWithErr(tcpipErrorToCode(err)), nil
@@ -725,6 +814,7 @@ func (ep *endpoint) GetIpv6TrafficClass(fidl.Context) (socket.BaseNetworkSocketG
 }
 
 func (ep *endpoint) SetIpv6MulticastInterface(_ fidl.Context, value uint64) (socket.BaseNetworkSocketSetIpv6MulticastInterfaceResult, error) {
+	ep.ns.stats.SocketOptions.set(solIPv6, "IPV6_MULTICAST_IF")
 	opt := tcpip.MulticastInterfaceOption{
 		NIC: tcpip.NICID(value),
 	}
@@ -735,6 +825,7 @@ func (ep *endpoint) SetIpv6MulticastInterface(_ fidl.Context, value uint64) (soc
 }
 
 func (ep *endpoint) GetIpv6MulticastInterface(fidl.Context) (socket.BaseNetworkSocketGetIpv6MulticastInterfaceResult, error) {
+	ep.ns.stats.SocketOptions.get(solIPv6, "IPV6_MULTICAST_IF")
 	var value tcpip.MulticastInterfaceOption
 	if err := ep.ep.GetSockOpt(&value); err != nil {
 		return socket.BaseNetworkSocketGetIpv6MulticastInterfaceResultWithErr(tcpipErrorToCode(err)), nil
@@ -743,6 +834,7 @@ func (ep *endpoint) GetIpv6MulticastInterface(fidl.Context) (socket.BaseNetworkS
 }
 
 func (ep *endpoint) SetIpv6MulticastHops(_ fidl.Context, value socket.OptionalUint8) (socket.BaseNetworkSocketSetIpv6MulticastHopsResult, error) {
+	ep.ns.stats.SocketOptions.set(solIPv6, "IPV6_MULTICAST_HOPS")
 	v, err := optionalUint8ToInt(value, 1)
 	if err != nil {
 		return socket.BaseNetworkSocketSetIpv6MulticastHopsResultWithErr(tcpipErrorToCode(err)), nil
@@ -754,6 +846,7 @@ func (ep *endpoint) SetIpv6MulticastHops(_ fidl.Context, value socket.OptionalUi
 }
 
 func (ep *endpoint) GetIpv6MulticastHops(fidl.Context) (socket.BaseNetworkSocketGetIpv6MulticastHopsResult, error) {
+	ep.ns.stats.SocketOptions.get(solIPv6, "IPV6_MULTICAST_HOPS")
 	value, err := ep.ep.GetSockOptInt(tcpip.MulticastTTLOption)
 	if err != nil {
 		return socket.BaseNetworkSocketGetIpv6MulticastHopsResultWithErr(tcpipErrorToCode(err)), nil
@@ -766,6 +859,7 @@ func (ep *endpoint) GetIpv6MulticastHops(fidl.Context) (socket.BaseNetworkSocket
 }
 
 func (ep *endpoint) SetIpv6UnicastHops(_ fidl.Context, value socket.OptionalUint8) (socket.BaseNetworkSocketSetIpv6UnicastHopsResult, error) {
+	ep.ns.stats.SocketOptions.set(solIPv6, "IPV6_UNICAST_HOPS")
 	v, err := optionalUint8ToInt(value, -1)
 	if err != nil {
 		return socket.BaseNetworkSocketSetIpv6UnicastHopsResultWithErr(tcpipErrorToCode(err)), nil
@@ -777,6 +871,7 @@ func (ep *endpoint) SetIpv6UnicastHops(_ fidl.Context, value socket.OptionalUint
 }
 
 func (ep *endpoint) GetIpv6UnicastHops(fidl.Context) (socket.BaseNetworkSocketGetIpv6UnicastHopsResult, error) {
+	ep.ns.stats.SocketOptions.get(solIPv6, "IPV6_UNICAST_HOPS")
 	value, err := ep.ep.GetSockOptInt(tcpip.IPv6HopLimitOption)
 	if err != nil {
 		return socket.BaseNetworkSocketGetIpv6UnicastHopsResultWithErr(tcpipErrorToCode(err)), nil
@@ -796,16 +891,19 @@ func (ep *endpoint) GetIpv6UnicastHops(fidl.Context) (socket.BaseNetworkSocketGe
 }
 
 func (ep *endpoint) SetIpv6MulticastLoopback(_ fidl.Context, value bool) (socket.BaseNetworkSocketSetIpv6MulticastLoopbackResult, error) {
+	ep.ns.stats.SocketOptions.set(solIPv6, "IPV6_MULTICAST_LOOP")
 	ep.ep.SocketOptions().SetMulticastLoop(value)
 	return socket.BaseNetworkSocketSetIpv6MulticastLoopbackResultWithResponse(socket.BaseNetworkSocketSetIpv6MulticastLoopbackResponse{}), nil
 }
 
 func (ep *endpoint) GetIpv6MulticastLoopback(fidl.Context) (socket.BaseNetworkSocketGetIpv6MulticastLoopbackResult, error) {
+	ep.ns.stats.SocketOptions.get(solIPv6, "IPV6_MULTICAST_LOOP")
 	value := ep.ep.SocketOptions().GetMulticastLoop()
 	return socket.BaseNetworkSocketGetIpv6MulticastLoopbackResultWithResponse(socket.BaseNetworkSocketGetIpv6MulticastLoopbackResponse{Value: value}), nil
 }
 
 func (ep *endpoint) SetIpTtl(_ fidl.Context, value socket.OptionalUint8) (socket.BaseNetworkSocketSetIpTtlResult, error) {
+	ep.ns.stats.SocketOptions.set(solIP, "IP_TTL")
 	v, err := optionalUint8ToInt(value, -1)
 	if err != nil {
 		return socket.BaseNetworkSocketSetIpTtlResultWithErr(tcpipErrorToCode(err)), nil
@@ -824,6 +922,7 @@ func (ep *endpoint) SetIpTtl(_ fidl.Context, value socket.OptionalUint8) (socket
 }
 
 func (ep *endpoint) GetIpTtl(fidl.Context) (socket.BaseNetworkSocketGetIpTtlResult, error) {
+	ep.ns.stats.SocketOptions.get(solIP, "IP_TTL")
 	value, err := ep.ep.GetSockOptInt(tcpip.IPv4TTLOption)
 	if err != nil {
 		return socket.BaseNetworkSocketGetIpTtlResultWithErr(tcpipErrorToCode(err)), nil
@@ -839,6 +938,7 @@ func (ep *endpoint) GetIpTtl(fidl.Context) (socket.BaseNetworkSocketGetIpTtlResu
 }
 
 func (ep *endpoint) SetIpMulticastTtl(_ fidl.Context, value socket.OptionalUint8) (socket.BaseNetworkSocketSetIpMulticastTtlResult, error) {
+	ep.ns.stats.SocketOptions.set(solIP, "IP_MULTICAST_TTL")
 	// Linux translates -1 (unset) to 1
 	v, err := optionalUint8ToInt(value, 1)
 	if err != nil {
@@ -851,6 +951,7 @@ func (ep *endpoint) SetIpMulticastTtl(_ fidl.Context, value socket.OptionalUint8
 }
 
 func (ep *endpoint) GetIpMulticastTtl(fidl.Context) (socket.BaseNetworkSocketGetIpMulticastTtlResult, error) {
+	ep.ns.stats.SocketOptions.get(solIP, "IP_MULTICAST_TTL")
 	value, err := ep.ep.GetSockOptInt(tcpip.MulticastTTLOption)
 	if err != nil {
 		return socket.BaseNetworkSocketGetIpMulticastTtlResultWithErr(tcpipErrorToCode(err)), nil
@@ -859,6 +960,7 @@ func (ep *endpoint) GetIpMulticastTtl(fidl.Context) (socket.BaseNetworkSocketGet
 }
 
 func (ep *endpoint) SetIpMulticastInterface(_ fidl.Context, iface uint64, value fidlnet.Ipv4Address) (socket.BaseNetworkSocketSetIpMulticastInterfaceResult, error) {
+	ep.ns.stats.SocketOptions.set(solIP, "IP_MULTICAST_IF")
 	opt := tcpip.MulticastInterfaceOption{
 		NIC:           tcpip.NICID(iface),
 		InterfaceAddr: fidlconv.ToTcpIpAddressDroppingUnspecifiedv4(value),
@@ -870,6 +972,7 @@ func (ep *endpoint) SetIpMulticastInterface(_ fidl.Context, iface uint64, value
 }
 
 func (ep *endpoint) GetIpMulticastInterface(fidl.Context) (socket.BaseNetworkSocketGetIpMulticastInterfaceResult, error) {
+	ep.ns.stats.SocketOptions.get(solIP, "IP_MULTICAST_IF")
 	var v tcpip.MulticastInterfaceOption
 	if err := ep.ep.GetSockOpt(&v); err != nil {
 		return socket.BaseNetworkSocketGetIpMulticastInterfaceResultWithErr(tcpipErrorToCode(err)), nil
@@ -886,16 +989,19 @@ func (ep *endpoint) GetIpMulticastInterface(fidl.Context) (socket.BaseNetworkSoc
 }
 
 func (ep *endpoint) SetIpMulticastLoopback(_ fidl.Context, value bool) (socket.BaseNetworkSocketSetIpMulticastLoopbackResult, error) {
+	ep.ns.stats.SocketOptions.set(solIP, "IP_MULTICAST_LOOP")
 	ep.ep.SocketOptions().SetMulticastLoop(value)
 	return socket.BaseNetworkSocketSetIpMulticastLoopbackResultWithResponse(socket.BaseNetworkSocketSetIpMulticastLoopbackResponse{}), nil
 }
 
 func (ep *endpoint) GetIpMulticastLoopback(fidl.Context) (socket.BaseNetworkSocketGetIpMulticastLoopbackResult, error) {
+	ep.ns.stats.SocketOptions.get(solIP, "IP_MULTICAST_LOOP")
 	value := ep.ep.SocketOptions().GetMulticastLoop()
 	return socket.BaseNetworkSocketGetIpMulticastLoopbackResultWithResponse(socket.BaseNetworkSocketGetIpMulticastLoopbackResponse{Value: value}), nil
 }
 
 func (ep *endpoint) SetIpTypeOfService(_ fidl.Context, value uint8) (socket.BaseNetworkSocketSetIpTypeOfServiceResult, error) {
+	ep.ns.stats.SocketOptions.set(solIP, "IP_TOS")
 	if err := ep.ep.SetSockOptInt(tcpip.IPv4TOSOption, int(value)); err != nil {
 		return socket.BaseNetworkSocketSetIpTypeOfServiceResultWithErr(tcpipErrorToCode(err)), nil
 	}
@@ -903,6 +1009,7 @@ func (ep *endpoint) SetIpTypeOfService(_ fidl.Context, value uint8) (socket.Base
 }
 
 func (ep *endpoint) GetIpTypeOfService(fidl.Context) (socket.BaseNetworkSocketGetIpTypeOfServiceResult, error) {
+	ep.ns.stats.SocketOptions.get(solIP, "IP_TOS")
 	value, err := ep.ep.GetSockOptInt(tcpip.IPv4TOSOption)
 	if err != nil {
 		return socket.BaseNetworkSocketGetIpTypeOfServiceResultWithErr(tcpipErrorToCode(err)), nil
@@ -914,6 +1021,7 @@ func (ep *endpoint) GetIpTypeOfService(fidl.Context) (socket.BaseNetworkSocketGe
 }
 
 func (ep *endpoint) AddIpMembership(_ fidl.Context, membership socket.IpMulticastMembership) (socket.BaseNetworkSocketAddIpMembershipResult, error) {
+	ep.ns.stats.SocketOptions.set(solIP, "IP_ADD_MEMBERSHIP")
 	opt := tcpip.AddMembershipOption{
 		NIC:           tcpip.NICID(membership.Iface),
 		InterfaceAddr: fidlconv.ToTcpIpAddressDroppingUnspecifiedv4(membership.LocalAddr),
@@ -926,6 +1034,7 @@ func (ep *endpoint) AddIpMembership(_ fidl.Context, membership socket.IpMulticas
 }
 
 func (ep *endpoint) DropIpMembership(_ fidl.Context, membership socket.IpMulticastMembership) (socket.BaseNetworkSocketDropIpMembershipResult, error) {
+	ep.ns.stats.SocketOptions.set(solIP, "IP_DROP_MEMBERSHIP")
 	opt := tcpip.RemoveMembershipOption{
 		NIC:           tcpip.NICID(membership.Iface),
 		InterfaceAddr: fidlconv.ToTcpIpAddressDroppingUnspecifiedv4(membership.LocalAddr),
@@ -938,6 +1047,7 @@ func (ep *endpoint) DropIpMembership(_ fidl.Context, membership socket.IpMultica
 }
 
 func (ep *endpoint) AddIpv6Membership(_ fidl.Context, membership socket.Ipv6MulticastMembership) (socket.BaseNetworkSocketAddIpv6MembershipResult, error) {
+	ep.ns.stats.SocketOptions.set(solIPv6, "IPV6_ADD_MEMBERSHIP")
 	opt := tcpip.AddMembershipOption{
 		NIC:           tcpip.NICID(membership.Iface),
 		MulticastAddr: fidlconv.ToTcpIpAddressDroppingUnspecifiedv6(membership.McastAddr),
@@ -949,6 +1059,7 @@ func (ep *endpoint) AddIpv6Membership(_ fidl.Context, membership socket.Ipv6Mult
 }
 
 func (ep *endpoint) DropIpv6Membership(_ fidl.Context, membership socket.Ipv6MulticastMembership) (socket.BaseNetworkSocketDropIpv6MembershipResult, error) {
+	ep.ns.stats.SocketOptions.set(solIPv6, "IPV6_DROP_MEMBERSHIP")
 	opt := tcpip.RemoveMembershipOption{
 		NIC:           tcpip.NICID(membership.Iface),
 		MulticastAddr: fidlconv.ToTcpIpAddressDroppingUnspecifiedv6(membership.McastAddr),
@@ -964,11 +1075,13 @@ func (ep *endpoint) setIpv6ReceiveTrafficClass(value bool) {
 }
 
 func (ep *endpoint) SetIpv6ReceiveTrafficClass(_ fidl.Context, value bool) (socket.BaseNetworkSocketSetIpv6ReceiveTrafficClassResult, error) {
+	ep.ns.stats.SocketOptions.set(solIPv6, "IPV6_RECVTCLASS")
 	ep.setIpv6ReceiveTrafficClass(value)
 	return socket.BaseNetworkSocketSetIpv6ReceiveTrafficClassResultWithResponse(socket.BaseNetworkSocketSetIpv6ReceiveTrafficClassResponse{}), nil
 }
 
 func (ep *endpoint) GetIpv6ReceiveTrafficClass(fidl.Context) (socket.BaseNetworkSocketGetIpv6ReceiveTrafficClassResult, error) {
+	ep.ns.stats.SocketOptions.get(solIPv6, "IPV6_RECVTCLASS")
 	value := ep.ep.SocketOptions().GetReceiveTClass()
 	return socket.BaseNetworkSocketGetIpv6ReceiveTrafficClassResultWithResponse(socket.BaseNetworkSocketGetIpv6ReceiveTrafficClassResponse{Value: value}), nil
 }
@@ -978,11 +1091,13 @@ func (ep *endpoint) setIpv6ReceiveHopLimit(value bool) {
 }
 
 func (ep *endpoint) SetIpv6ReceiveHopLimit(_ fidl.Context, value bool) (socket.BaseNetworkSocketSetIpv6ReceiveHopLimitResult, error) {
+	ep.ns.stats.SocketOptions.set(solIPv6, "IPV6_RECVHOPLIMIT")
 	ep.setIpv6ReceiveHopLimit(value)
 	return socket.BaseNetworkSocketSetIpv6ReceiveHopLimitResultWithResponse(socket.BaseNetworkSocketSetIpv6ReceiveHopLimitResponse{}), nil
 }
 
 func (ep *endpoint) GetIpv6ReceiveHopLimit(fidl.Context) (socket.BaseNetworkSocketGetIpv6ReceiveHopLimitResult, error) {
+	ep.ns.stats.SocketOptions.get(solIPv6, "IPV6_RECVHOPLIMIT")
 	value := ep.ep.SocketOptions().GetReceiveHopLimit()
 	return socket.BaseNetworkSocketGetIpv6ReceiveHopLimitResultWithResponse(socket.BaseNetworkSocketGetIpv6ReceiveHopLimitResponse{Value: value}), nil
 }
@@ -992,11 +1107,13 @@ func (ep *endpoint) setIpv6ReceivePacketInfo(value bool) {
 }
 
 func (ep *endpoint) SetIpv6ReceivePacketInfo(_ fidl.Context, value bool) (socket.BaseNetworkSocketSetIpv6ReceivePacketInfoResult, error) {
+	ep.ns.stats.SocketOptions.set(solIPv6, "IPV6_RECVPKTINFO")
 	ep.setIpv6ReceivePacketInfo(value)
 	return socket.BaseNetworkSocketSetIpv6ReceivePacketInfoResultWithResponse(socket.BaseNetworkSocketSetIpv6ReceivePacketInfoResponse{}), nil
 }
 
 func (ep *endpoint) GetIpv6ReceivePacketInfo(fidl.Context) (socket.BaseNetworkSocketGetIpv6ReceivePacketInfoResult, error) {
+	ep.ns.stats.SocketOptions.get(solIPv6, "IPV6_RECVPKTINFO")
 	value := ep.ep.SocketOptions().GetIPv6ReceivePacketInfo()
 	return socket.BaseNetworkSocketGetIpv6ReceivePacketInfoResultWithResponse(socket.BaseNetworkSocketGetIpv6ReceivePacketInfoResponse{Value: value}), nil
 }
@@ -1006,11 +1123,13 @@ func (ep *endpoint) setIpReceiveTypeOfService(value bool) {
 }
 
 func (ep *endpoint) SetIpReceiveTypeOfService(_ fidl.Context, value bool) (socket.BaseNetworkSocketSetIpReceiveTypeOfServiceResult, error) {
+	ep.ns.stats.SocketOptions.set(solIP, "IP_RECVTOS")
 	ep.setIpReceiveTypeOfService(value)
 	return socket.BaseNetworkSocketSetIpReceiveTypeOfServiceResultWithResponse(socket.BaseNetworkSocketSetIpReceiveTypeOfServiceResponse{}), nil
 }
 
 func (ep *endpoint) GetIpReceiveTypeOfService(fidl.Context) (socket.BaseNetworkSocketGetIpReceiveTypeOfServiceResult, error) {
+	ep.ns.stats.SocketOptions.get(solIP, "IP_RECVTOS")
 	value := ep.ep.SocketOptions().GetReceiveTOS()
 	return socket.BaseNetworkSocketGetIpReceiveTypeOfServiceResultWithResponse(socket.BaseNetworkSocketGetIpReceiveTypeOfServiceResponse{Value: value}), nil
 }
@@ -1020,21 +1139,25 @@ func (ep *endpoint) setIpReceiveTtl(value bool) {
 }
 
 func (ep *endpoint) SetIpReceiveTtl(_ fidl.Context, value bool) (socket.BaseNetworkSocketSetIpReceiveTtlResult, error) {
+	ep.ns.stats.SocketOptions.set(solIP, "IP_RECVTTL")
 	ep.setIpReceiveTtl(value)
 	return socket.BaseNetworkSocketSetIpReceiveTtlResultWithResponse(socket.BaseNetworkSocketSetIpReceiveTtlResponse{}), nil
 }
 
 func (ep *endpoint) GetIpReceiveTtl(fidl.Context) (socket.BaseNetworkSocketGetIpReceiveTtlResult, error) {
+	ep.ns.stats.SocketOptions.get(solIP, "IP_RECVTTL")
 	value := ep.ep.SocketOptions().GetReceiveTTL()
 	return socket.BaseNetworkSocketGetIpReceiveTtlResultWithResponse(socket.BaseNetworkSocketGetIpReceiveTtlResponse{Value: value}), nil
 }
 
 func (ep *endpoint) SetIpPacketInfo(_ fidl.Context, value bool) (socket.BaseNetworkSocketSetIpPacketInfoResult, error) {
+	ep.ns.stats.SocketOptions.set(solIP, "IP_PKTINFO")
 	ep.ep.SocketOptions().SetReceivePacketInfo(value)
 	return socket.BaseNetworkSocketSetIpPacketInfoResultWithResponse(socket.BaseNetworkSocketSetIpPacketInfoResponse{}), nil
 }
 
 func (ep *endpoint) GetIpPacketInfo(fidl.Context) (socket.BaseNetworkSocketGetIpPacketInfoResult, error) {
+	ep.ns.stats.SocketOptions.get(solIP, "IP_PKTINFO")
 	value := ep.ep.SocketOptions().GetReceivePacketInfo()
 	return socket.BaseNetworkSocketGetIpPacketInfoResultWithResponse(socket.BaseNetworkSocketGetIpPacketInfoResponse{Value: value}), nil
 }
@@ -1069,6 +1192,10 @@ type endpointWithSocket struct {
 
 	// onHUp is used to register callback for closing events.
 	onHUp waiter.Entry
+
+	// tcpDiag records the diagnostics of the connection if it is sampled by
+	// ns.tcpDiagnostics.
+	tcpDiag *tcpConnTracker
 }
 
 func newEndpointWithSocket(
@@ -1102,6 +1229,10 @@ func newEndpointWithSocket(
 	// endpoint is attempted to be removed from the map.
 	ns.onAddEndpoint(&eps.endpoint)
 
+	if transProto == tcp.ProtocolNumber {
+		eps.tcpDiag = ns.tcpDiagnostics.track(ep, wq)
+	}
+
 	eps.onHUp = waiter.NewFunctionEntry(waiter.EventHUp, func(waiter.EventMask) {
 		eps.HUp()
 	})
@@ -1123,6 +1254,9 @@ func (eps *endpointWithSocket) HUp() {
 		go func() {
 			eps.wq.EventUnregister(&eps.onHUp)
 			eps.close()
+			// The loops have exited, so the error that ended the connection, if
+			// any, has been recorded.
+			eps.tcpDiag.finish()
 		}()
 	})
 }
@@ -1139,6 +1273,7 @@ type endpointWithEvent struct {
 }
 
 func (ep *endpointWithEvent) GetError(fidl.Context) (socket.BaseSocketGetErrorResult, error) {
+	ep.ns.stats.SocketOptions.get(solSocket, "SO_ERROR")
 	err := ep.ep.LastError()
 	ep.pending.mustUpdate()
 	if err != nil {
@@ -1272,6 +1407,8 @@ func (s *streamSocketImpl) Listen(_ fidl.Context, backlog int16) (socket.StreamS
 	// fail above, so we register the callback only in the success case to avoid
 	// incorrectly handling events on connected sockets.
 	s.sharedState.onListen.Do(func() {
+		s.endpoint.ns.listeners.onListen(s.endpointWithSocket, s.endpoint.ns.stack.Clock().NowMonotonic())
+
 		s.sharedState.pending.supported = waiter.EventIn
 		var entry waiter.Entry
 		cb := func() {
@@ -1342,6 +1479,14 @@ func (s *streamSocketImpl) Connect(_ fidl.Context, address fidlnet.SocketAddress
 		if err != nil {
 			return err
 		}
+		// Only fresh connection attempts are throttled; repeated calls while a
+		// connection is in progress don't send SYNs.
+		switch tcp.EndpointState(s.endpoint.ep.State()) {
+		case tcp.StateInitial, tcp.StateBound:
+			if err := s.endpoint.ns.connectThrottle.allow(s.endpoint.connectClient, addr); err != nil {
+				return err
+			}
+		}
 		s.sharedState.err.mu.Lock()
 		err = s.endpoint.connect(addr)
 		ch := s.sharedState.err.setConsumedLockedInner(err)
@@ -1420,6 +1565,7 @@ func (s *streamSocketImpl) accept(wantAddr bool) (posix.Errno, *tcpip.FullAddres
 	if err != nil {
 		return tcpipErrorToCode(err), nil, streamSocketImpl{}, nil
 	}
+	s.endpoint.ns.listeners.onAccept(s.endpoint.key, s.endpoint.ns.stack.Clock().NowMonotonic(), ep)
 	{
 		if err := s.sharedState.pending.update(); err != nil {
 			panic(err)
@@ -1457,6 +1603,7 @@ func (s *streamSocketImpl) accept(wantAddr bool) (posix.Errno, *tcpip.FullAddres
 		if err != nil {
 			return 0, nil, streamSocketImpl{}, err
 		}
+		s.endpoint.ns.onClientEndpoint(s.endpoint.client, &eps.endpoint)
 
 		{
 			s := makeStreamSocketImpl(eps)
@@ -2417,6 +2564,7 @@ func (s *datagramSocketImpl) NotifyEvent(waiter.EventMask) {
 }
 
 func (s *datagramSocketImpl) GetError(fidl.Context) (socket.BaseSocketGetErrorResult, error) {
+	s.ns.stats.SocketOptions.get(solSocket, "SO_ERROR")
 	if err := s.sharedState.err.consume(); err != nil {
 		return socket.BaseSocketGetErrorResultWithErr(tcpipErrorToCode(err)), nil
 	}
@@ -2437,6 +2585,7 @@ func (s *datagramSocketImpl) Shutdown(ctx fidl.Context, how socket.ShutdownMode)
 
 // TODO(https://fxbug.dev/87656): Remove after ABI transition.
 func (s *datagramSocketImpl) GetTimestampDeprecated(fidl.Context) (socket.BaseSocketGetTimestampDeprecatedResult, error) {
+	s.ns.stats.SocketOptions.get(solSocket, "SO_TIMESTAMP")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	return socket.BaseSocketGetTimestampDeprecatedResultWithResponse(socket.BaseSocketGetTimestampDeprecatedResponse{Value: s.sharedState.cmsgCacheMu.cmsgCache.timestamp}), nil
@@ -2444,6 +2593,7 @@ func (s *datagramSocketImpl) GetTimestampDeprecated(fidl.Context) (socket.BaseSo
 
 // TODO(https://fxbug.dev/87656): Remove after ABI transition.
 func (s *datagramSocketImpl) SetTimestampDeprecated(ctx fidl.Context, value socket.TimestampOption) (socket.BaseSocketSetTimestampDeprecatedResult, error) {
+	s.ns.stats.SocketOptions.set(solSocket, "SO_TIMESTAMP")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	s.sharedState.cmsgCacheMu.cmsgCache.timestamp = value
@@ -2452,12 +2602,14 @@ func (s *datagramSocketImpl) SetTimestampDeprecated(ctx fidl.Context, value sock
 }
 
 func (s *datagramSocketImpl) GetTimestamp(fidl.Context) (socket.BaseSocketGetTimestampResult, error) {
+	s.ns.stats.SocketOptions.get(solSocket, "SO_TIMESTAMP")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	return socket.BaseSocketGetTimestampResultWithResponse(socket.BaseSocketGetTimestampResponse{Value: s.sharedState.cmsgCacheMu.cmsgCache.timestamp}), nil
 }
 
 func (s *datagramSocketImpl) SetTimestamp(ctx fidl.Context, value socket.TimestampOption) (socket.BaseSocketSetTimestampResult, error) {
+	s.ns.stats.SocketOptions.set(solSocket, "SO_TIMESTAMP")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	s.sharedState.cmsgCacheMu.cmsgCache.timestamp = value
@@ -2466,12 +2618,14 @@ func (s *datagramSocketImpl) SetTimestamp(ctx fidl.Context, value socket.Timesta
 }
 
 func (s *datagramSocketImpl) GetIpReceiveTypeOfService(fidl.Context) (socket.BaseNetworkSocketGetIpReceiveTypeOfServiceResult, error) {
+	s.ns.stats.SocketOptions.get(solIP, "IP_RECVTOS")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	return socket.BaseNetworkSocketGetIpReceiveTypeOfServiceResultWithResponse(socket.BaseNetworkSocketGetIpReceiveTypeOfServiceResponse{Value: s.sharedState.cmsgCacheMu.cmsgCache.ipTos}), nil
 }
 
 func (s *datagramSocketImpl) SetIpReceiveTypeOfService(ctx fidl.Context, value bool) (socket.BaseNetworkSocketSetIpReceiveTypeOfServiceResult, error) {
+	s.ns.stats.SocketOptions.set(solIP, "IP_RECVTOS")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	s.sharedState.cmsgCacheMu.cmsgCache.ipTos = value
@@ -2480,12 +2634,14 @@ func (s *datagramSocketImpl) SetIpReceiveTypeOfService(ctx fidl.Context, value b
 }
 
 func (s *datagramSocketImpl) GetIpReceiveTtl(fidl.Context) (socket.BaseNetworkSocketGetIpReceiveTtlResult, error) {
+	s.ns.stats.SocketOptions.get(solIP, "IP_RECVTTL")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	return socket.BaseNetworkSocketGetIpReceiveTtlResultWithResponse(socket.BaseNetworkSocketGetIpReceiveTtlResponse{Value: s.sharedState.cmsgCacheMu.cmsgCache.ipTtl}), nil
 }
 
 func (s *datagramSocketImpl) SetIpReceiveTtl(ctx fidl.Context, value bool) (socket.BaseNetworkSocketSetIpReceiveTtlResult, error) {
+	s.ns.stats.SocketOptions.set(solIP, "IP_RECVTTL")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	s.sharedState.cmsgCacheMu.cmsgCache.ipTtl = value
@@ -2494,12 +2650,14 @@ func (s *datagramSocketImpl) SetIpReceiveTtl(ctx fidl.Context, value bool) (sock
 }
 
 func (s *datagramSocketImpl) GetIpv6ReceiveTrafficClass(fidl.Context) (socket.BaseNetworkSocketGetIpv6ReceiveTrafficClassResult, error) {
+	s.ns.stats.SocketOptions.get(solIPv6, "IPV6_RECVTCLASS")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	return socket.BaseNetworkSocketGetIpv6ReceiveTrafficClassResultWithResponse(socket.BaseNetworkSocketGetIpv6ReceiveTrafficClassResponse{Value: s.sharedState.cmsgCacheMu.cmsgCache.ipv6Tclass}), nil
 }
 
 func (s *datagramSocketImpl) SetIpv6ReceiveTrafficClass(ctx fidl.Context, value bool) (socket.BaseNetworkSocketSetIpv6ReceiveTrafficClassResult, error) {
+	s.ns.stats.SocketOptions.set(solIPv6, "IPV6_RECVTCLASS")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	s.sharedState.cmsgCacheMu.cmsgCache.ipv6Tclass = value
@@ -2508,12 +2666,14 @@ func (s *datagramSocketImpl) SetIpv6ReceiveTrafficClass(ctx fidl.Context, value
 }
 
 func (s *datagramSocketImpl) GetIpv6ReceiveHopLimit(fidl.Context) (socket.BaseNetworkSocketGetIpv6ReceiveHopLimitResult, error) {
+	s.ns.stats.SocketOptions.get(solIPv6, "IPV6_RECVHOPLIMIT")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	return socket.BaseNetworkSocketGetIpv6ReceiveHopLimitResultWithResponse(socket.BaseNetworkSocketGetIpv6ReceiveHopLimitResponse{Value: s.sharedState.cmsgCacheMu.cmsgCache.ipv6HopLimit}), nil
 }
 
 func (s *datagramSocketImpl) SetIpv6ReceiveHopLimit(ctx fidl.Context, value bool) (socket.BaseNetworkSocketSetIpv6ReceiveHopLimitResult, error) {
+	s.ns.stats.SocketOptions.set(solIPv6, "IPV6_RECVHOPLIMIT")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	s.sharedState.cmsgCacheMu.cmsgCache.ipv6HopLimit = value
@@ -2522,6 +2682,7 @@ func (s *datagramSocketImpl) SetIpv6ReceiveHopLimit(ctx fidl.Context, value bool
 }
 
 func (s *datagramSocketImpl) SetIpv6ReceivePacketInfo(ctx fidl.Context, value bool) (socket.BaseNetworkSocketSetIpv6ReceivePacketInfoResult, error) {
+	s.ns.stats.SocketOptions.set(solIPv6, "IPV6_RECVPKTINFO")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	s.sharedState.cmsgCacheMu.cmsgCache.ipv6PktInfo = value
@@ -2530,6 +2691,7 @@ func (s *datagramSocketImpl) SetIpv6ReceivePacketInfo(ctx fidl.Context, value bo
 }
 
 func (s *datagramSocketImpl) GetIpv6ReceivePacketInfo(fidl.Context) (socket.BaseNetworkSocketGetIpv6ReceivePacketInfoResult, error) {
+	s.ns.stats.SocketOptions.get(solIPv6, "IPV6_RECVPKTINFO")
 	s.sharedState.cmsgCacheMu.Lock()
 	defer s.sharedState.cmsgCacheMu.Unlock()
 	return socket.BaseNetworkSocketGetIpv6ReceivePacketInfoResultWithResponse(socket.BaseNetworkSocketGetIpv6ReceivePacketInfoResponse{Value: s.sharedState.cmsgCacheMu.cmsgCache.ipv6PktInfo}), nil
@@ -3155,6 +3317,9 @@ func makeStreamSocketImpl(eps *endpointWithSocket) streamSocketImpl {
 		endpointWithSocket: eps,
 		linger:             make(chan struct{}),
 		sharedState: &sharedStreamSocketState{
+			err: streamSocketError{
+				onError: eps.tcpDiag.onError,
+			},
 			pending: signaler{
 				eventsToSignals: func(events waiter.EventMask) zx.Signals {
 					signals := zx.SignalNone
@@ -3198,6 +3363,11 @@ func (s *streamSocketImpl) close() {
 			}
 		}
 
+		if linger.Enabled && linger.Timeout == 0 {
+			// Closing with a zero linger timeout resets the connection.
+			s.tcpDiag.onAbort()
+		}
+
 		if linger.Enabled {
 			// `man 7 socket`:
 			//
@@ -3256,6 +3426,7 @@ func (s *streamSocketImpl) Close(fidl.Context) (unknown.CloseableCloseResult, er
 }
 
 func (s *streamSocketImpl) GetError(fidl.Context) (socket.BaseSocketGetErrorResult, error) {
+	s.ns.stats.SocketOptions.get(solSocket, "SO_ERROR")
 	err := func() tcpip.Error {
 		s.sharedState.err.mu.Lock()
 		defer s.sharedState.err.mu.Unlock()
@@ -3407,11 +3578,13 @@ func (s *streamSocketImpl) GetInfo(fidl.Context) (socket.StreamSocketGetInfoResu
 }
 
 func (s *streamSocketImpl) SetTcpNoDelay(_ fidl.Context, value bool) (socket.StreamSocketSetTcpNoDelayResult, error) {
+	s.ns.stats.SocketOptions.set(solTCP, "TCP_NODELAY")
 	s.ep.SocketOptions().SetDelayOption(!value)
 	return socket.StreamSocketSetTcpNoDelayResultWithResponse(socket.StreamSocketSetTcpNoDelayResponse{}), nil
 }
 
 func (s *streamSocketImpl) GetTcpNoDelay(fidl.Context) (socket.StreamSocketGetTcpNoDelayResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_NODELAY")
 	value := s.ep.SocketOptions().GetDelayOption()
 	return socket.StreamSocketGetTcpNoDelayResultWithResponse(
 		socket.StreamSocketGetTcpNoDelayResponse{
@@ -3421,26 +3594,31 @@ func (s *streamSocketImpl) GetTcpNoDelay(fidl.Context) (socket.StreamSocketGetTc
 }
 
 func (s *streamSocketImpl) SetTcpCork(_ fidl.Context, value bool) (socket.StreamSocketSetTcpCorkResult, error) {
+	s.ns.stats.SocketOptions.set(solTCP, "TCP_CORK")
 	s.ep.SocketOptions().SetCorkOption(value)
 	return socket.StreamSocketSetTcpCorkResultWithResponse(socket.StreamSocketSetTcpCorkResponse{}), nil
 }
 
 func (s *streamSocketImpl) GetTcpCork(fidl.Context) (socket.StreamSocketGetTcpCorkResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_CORK")
 	value := s.ep.SocketOptions().GetCorkOption()
 	return socket.StreamSocketGetTcpCorkResultWithResponse(socket.StreamSocketGetTcpCorkResponse{Value: value}), nil
 }
 
 func (s *streamSocketImpl) SetTcpQuickAck(_ fidl.Context, value bool) (socket.StreamSocketSetTcpQuickAckResult, error) {
+	s.ns.stats.SocketOptions.set(solTCP, "TCP_QUICKACK")
 	s.ep.SocketOptions().SetQuickAck(value)
 	return socket.StreamSocketSetTcpQuickAckResultWithResponse(socket.StreamSocketSetTcpQuickAckResponse{}), nil
 }
 
 func (s *streamSocketImpl) GetTcpQuickAck(fidl.Context) (socket.StreamSocketGetTcpQuickAckResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_QUICKACK")
 	value := s.ep.SocketOptions().GetQuickAck()
 	return socket.StreamSocketGetTcpQuickAckResultWithResponse(socket.StreamSocketGetTcpQuickAckResponse{Value: value}), nil
 }
 
 func (s *streamSocketImpl) SetTcpMaxSegment(_ fidl.Context, valueBytes uint32) (socket.StreamSocketSetTcpMaxSegmentResult, error) {
+	s.ns.stats.SocketOptions.set(solTCP, "TCP_MAXSEG")
 	if err := s.ep.SetSockOptInt(tcpip.MaxSegOption, int(valueBytes)); err != nil {
 		return socket.StreamSocketSetTcpMaxSegmentResultWithErr(tcpipErrorToCode(err)), nil
 	}
@@ -3448,6 +3626,7 @@ func (s *streamSocketImpl) SetTcpMaxSegment(_ fidl.Context, valueBytes uint32) (
 }
 
 func (s *streamSocketImpl) GetTcpMaxSegment(fidl.Context) (socket.StreamSocketGetTcpMaxSegmentResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_MAXSEG")
 	value, err := s.ep.GetSockOptInt(tcpip.MaxSegOption)
 	if err != nil {
 		return socket.StreamSocketGetTcpMaxSegmentResultWithErr(tcpipErrorToCode(err)), nil
@@ -3458,6 +3637,7 @@ func (s *streamSocketImpl) GetTcpMaxSegment(fidl.Context) (socket.StreamSocketGe
 }
 
 func (s *streamSocketImpl) SetTcpKeepAliveIdle(_ fidl.Context, valueSecs uint32) (socket.StreamSocketSetTcpKeepAliveIdleResult, error) {
+	s.ns.stats.SocketOptions.set(solTCP, "TCP_KEEPIDLE")
 	// https://github.com/torvalds/linux/blob/f2850dd5ee015bd7b77043f731632888887689c7/net/ipv4/tcp.c#L2991
 	if valueSecs < 1 || valueSecs > maxTCPKeepIdle {
 		return socket.StreamSocketSetTcpKeepAliveIdleResultWithErr(posix.ErrnoEinval), nil
@@ -3470,6 +3650,7 @@ func (s *streamSocketImpl) SetTcpKeepAliveIdle(_ fidl.Context, valueSecs uint32)
 }
 
 func (s *streamSocketImpl) GetTcpKeepAliveIdle(fidl.Context) (socket.StreamSocketGetTcpKeepAliveIdleResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_KEEPIDLE")
 	var value tcpip.KeepaliveIdleOption
 	if err := s.ep.GetSockOpt(&value); err != nil {
 		return socket.StreamSocketGetTcpKeepAliveIdleResultWithErr(tcpipErrorToCode(err)), nil
@@ -3480,6 +3661,7 @@ func (s *streamSocketImpl) GetTcpKeepAliveIdle(fidl.Context) (socket.StreamSocke
 }
 
 func (s *streamSocketImpl) SetTcpKeepAliveInterval(_ fidl.Context, valueSecs uint32) (socket.StreamSocketSetTcpKeepAliveIntervalResult, error) {
+	s.ns.stats.SocketOptions.set(solTCP, "TCP_KEEPINTVL")
 	// https://github.com/torvalds/linux/blob/f2850dd5ee015bd7b77043f731632888887689c7/net/ipv4/tcp.c#L3008
 	if valueSecs < 1 || valueSecs > maxTCPKeepIntvl {
 		return socket.StreamSocketSetTcpKeepAliveIntervalResultWithErr(posix.ErrnoEinval), nil
@@ -3492,6 +3674,7 @@ func (s *streamSocketImpl) SetTcpKeepAliveInterval(_ fidl.Context, valueSecs uin
 }
 
 func (s *streamSocketImpl) GetTcpKeepAliveInterval(fidl.Context) (socket.StreamSocketGetTcpKeepAliveIntervalResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_KEEPINTVL")
 	var value tcpip.KeepaliveIntervalOption
 	if err := s.ep.GetSockOpt(&value); err != nil {
 		return socket.StreamSocketGetTcpKeepAliveIntervalResultWithErr(tcpipErrorToCode(err)), nil
@@ -3502,6 +3685,7 @@ func (s *streamSocketImpl) GetTcpKeepAliveInterval(fidl.Context) (socket.StreamS
 }
 
 func (s *streamSocketImpl) SetTcpKeepAliveCount(_ fidl.Context, value uint32) (socket.StreamSocketSetTcpKeepAliveCountResult, error) {
+	s.ns.stats.SocketOptions.set(solTCP, "TCP_KEEPCNT")
 	// https://github.com/torvalds/linux/blob/f2850dd5ee015bd7b77043f731632888887689c7/net/ipv4/tcp.c#L3014
 	if value < 1 || value > maxTCPKeepCnt {
 		return socket.StreamSocketSetTcpKeepAliveCountResultWithErr(posix.ErrnoEinval), nil
@@ -3513,6 +3697,7 @@ func (s *streamSocketImpl) SetTcpKeepAliveCount(_ fidl.Context, value uint32) (s
 }
 
 func (s *streamSocketImpl) GetTcpKeepAliveCount(fidl.Context) (socket.StreamSocketGetTcpKeepAliveCountResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_KEEPCNT")
 	value, err := s.ep.GetSockOptInt(tcpip.KeepaliveCountOption)
 	if err != nil {
 		return socket.StreamSocketGetTcpKeepAliveCountResultWithErr(tcpipErrorToCode(err)), nil
@@ -3521,6 +3706,7 @@ func (s *streamSocketImpl) GetTcpKeepAliveCount(fidl.Context) (socket.StreamSock
 }
 
 func (s *streamSocketImpl) SetTcpUserTimeout(_ fidl.Context, valueMillis uint32) (socket.StreamSocketSetTcpUserTimeoutResult, error) {
+	s.ns.stats.SocketOptions.set(solTCP, "TCP_USER_TIMEOUT")
 	opt := tcpip.TCPUserTimeoutOption(time.Millisecond * time.Duration(valueMillis))
 	if err := s.ep.SetSockOpt(&opt); err != nil {
 		return socket.StreamSocketSetTcpUserTimeoutResultWithErr(tcpipErrorToCode(err)), nil
@@ -3529,6 +3715,7 @@ func (s *streamSocketImpl) SetTcpUserTimeout(_ fidl.Context, valueMillis uint32)
 }
 
 func (s *streamSocketImpl) GetTcpUserTimeout(fidl.Context) (socket.StreamSocketGetTcpUserTimeoutResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_USER_TIMEOUT")
 	var value tcpip.TCPUserTimeoutOption
 	if err := s.ep.GetSockOpt(&value); err != nil {
 		return socket.StreamSocketGetTcpUserTimeoutResultWithErr(tcpipErrorToCode(err)), nil
@@ -3539,6 +3726,7 @@ func (s *streamSocketImpl) GetTcpUserTimeout(fidl.Context) (socket.StreamSocketG
 }
 
 func (s *streamSocketImpl) SetTcpCongestion(_ fidl.Context, value socket.TcpCongestionControl) (socket.StreamSocketSetTcpCongestionResult, error) {
+	s.ns.stats.SocketOptions.set(solTCP, "TCP_CONGESTION")
 	var cc string
 	switch value {
 	case socket.TcpCongestionControlReno:
@@ -3558,6 +3746,7 @@ func (s *streamSocketImpl) SetTcpCongestion(_ fidl.Context, value socket.TcpCong
 }
 
 func (s *streamSocketImpl) GetTcpCongestion(fidl.Context) (socket.StreamSocketGetTcpCongestionResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_CONGESTION")
 	var value tcpip.CongestionControlOption
 	if err := s.ep.GetSockOpt(&value); err != nil {
 		return socket.StreamSocketGetTcpCongestionResultWithErr(tcpipErrorToCode(err)), nil
@@ -3575,6 +3764,7 @@ func (s *streamSocketImpl) GetTcpCongestion(fidl.Context) (socket.StreamSocketGe
 }
 
 func (s *streamSocketImpl) SetTcpDeferAccept(_ fidl.Context, valueSecs uint32) (socket.StreamSocketSetTcpDeferAcceptResult, error) {
+	s.ns.stats.SocketOptions.set(solTCP, "TCP_DEFER_ACCEPT")
 	opt := tcpip.TCPDeferAcceptOption(time.Second * time.Duration(valueSecs))
 	if err := s.ep.SetSockOpt(&opt); err != nil {
 		return socket.StreamSocketSetTcpDeferAcceptResultWithErr(tcpipErrorToCode(err)), nil
@@ -3583,6 +3773,7 @@ func (s *streamSocketImpl) SetTcpDeferAccept(_ fidl.Context, valueSecs uint32) (
 }
 
 func (s *streamSocketImpl) GetTcpDeferAccept(fidl.Context) (socket.StreamSocketGetTcpDeferAcceptResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_DEFER_ACCEPT")
 	var value tcpip.TCPDeferAcceptOption
 	if err := s.ep.GetSockOpt(&value); err != nil {
 		return socket.StreamSocketGetTcpDeferAcceptResultWithErr(tcpipErrorToCode(err)), nil
@@ -3593,6 +3784,7 @@ func (s *streamSocketImpl) GetTcpDeferAccept(fidl.Context) (socket.StreamSocketG
 }
 
 func (s *streamSocketImpl) GetTcpInfo(fidl.Context) (socket.StreamSocketGetTcpInfoResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_INFO")
 	var value tcpip.TCPInfoOption
 	if err := s.ep.GetSockOpt(&value); err != nil {
 		return socket.StreamSocketGetTcpInfoResultWithErr(tcpipErrorToCode(err)), nil
@@ -3655,6 +3847,7 @@ func (s *streamSocketImpl) GetTcpInfo(fidl.Context) (socket.StreamSocketGetTcpIn
 }
 
 func (s *streamSocketImpl) SetTcpSynCount(_ fidl.Context, value uint32) (socket.StreamSocketSetTcpSynCountResult, error) {
+	s.ns.stats.SocketOptions.set(solTCP, "TCP_SYNCNT")
 	if err := s.ep.SetSockOptInt(tcpip.TCPSynCountOption, int(value)); err != nil {
 		return socket.StreamSocketSetTcpSynCountResultWithErr(tcpipErrorToCode(err)), nil
 	}
@@ -3662,6 +3855,7 @@ func (s *streamSocketImpl) SetTcpSynCount(_ fidl.Context, value uint32) (socket.
 }
 
 func (s *streamSocketImpl) GetTcpSynCount(fidl.Context) (socket.StreamSocketGetTcpSynCountResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_SYNCNT")
 	value, err := s.ep.GetSockOptInt(tcpip.TCPSynCountOption)
 	if err != nil {
 		return socket.StreamSocketGetTcpSynCountResultWithErr(tcpipErrorToCode(err)), nil
@@ -3670,6 +3864,7 @@ func (s *streamSocketImpl) GetTcpSynCount(fidl.Context) (socket.StreamSocketGetT
 }
 
 func (s *streamSocketImpl) SetTcpWindowClamp(_ fidl.Context, value uint32) (socket.StreamSocketSetTcpWindowClampResult, error) {
+	s.ns.stats.SocketOptions.set(solTCP, "TCP_WINDOW_CLAMP")
 	if err := s.ep.SetSockOptInt(tcpip.TCPWindowClampOption, int(value)); err != nil {
 		return socket.StreamSocketSetTcpWindowClampResultWithErr(tcpipErrorToCode(err)), nil
 	}
@@ -3677,6 +3872,7 @@ func (s *streamSocketImpl) SetTcpWindowClamp(_ fidl.Context, value uint32) (sock
 }
 
 func (s *streamSocketImpl) GetTcpWindowClamp(fidl.Context) (socket.StreamSocketGetTcpWindowClampResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_WINDOW_CLAMP")
 	value, err := s.ep.GetSockOptInt(tcpip.TCPWindowClampOption)
 	if err != nil {
 		return socket.StreamSocketGetTcpWindowClampResultWithErr(tcpipErrorToCode(err)), nil
@@ -3685,6 +3881,7 @@ func (s *streamSocketImpl) GetTcpWindowClamp(fidl.Context) (socket.StreamSocketG
 }
 
 func (s *streamSocketImpl) SetTcpLinger(_ fidl.Context, valueSecs socket.OptionalUint32) (socket.StreamSocketSetTcpLingerResult, error) {
+	s.ns.stats.SocketOptions.set(solTCP, "TCP_LINGER2")
 	v, err := optionalUint32ToInt(valueSecs, -1)
 	if err != nil {
 		return socket.StreamSocketSetTcpLingerResultWithErr(tcpipErrorToCode(err)), nil
@@ -3697,6 +3894,7 @@ func (s *streamSocketImpl) SetTcpLinger(_ fidl.Context, valueSecs socket.Optiona
 }
 
 func (s *streamSocketImpl) GetTcpLinger(fidl.Context) (socket.StreamSocketGetTcpLingerResult, error) {
+	s.ns.stats.SocketOptions.get(solTCP, "TCP_LINGER2")
 	var value tcpip.TCPLingerTimeoutOption
 	if err := s.ep.GetSockOpt(&value); err != nil {
 		return socket.StreamSocketGetTcpLingerResultWithErr(tcpipErrorToCode(err)), nil
@@ -3740,12 +3938,21 @@ func (ns *Netstack) onRemoveEndpoint(key uint64) bool {
 	if key == 0 {
 		return false
 	}
-	_, deleted := ns.endpoints.LoadAndDelete(key)
+	ep, deleted := ns.endpoints.LoadAndDelete(key)
+	ns.listeners.onRemove(key, ep)
+	if deleted {
+		ns.socketClients.remove(key)
+	}
 	return deleted
 }
 
 type providerImpl struct {
 	ns *Netstack
+	// connectClient identifies this connection to the provider to the
+	// connect throttle.
+	connectClient uint64
+	// client accounts for the sockets created through this connection.
+	client *socketClient
 }
 
 var _ socket.ProviderWithCtx = (*providerImpl)(nil)
@@ -3874,6 +4081,7 @@ func (sp *providerImpl) DatagramSocketDeprecated(ctx fidl.Context, domain socket
 	s.addConnection(ctx, localC)
 	_ = syslog.DebugTf("NewSynchronousDatagram", "%p", s.endpointWithEvent)
 	sp.ns.onAddEndpoint(&s.endpoint)
+	sp.ns.onClientEndpoint(sp.client, &s.endpoint)
 
 	if err := s.endpointWithEvent.local.SignalPeer(0, zxsocket.SignalDatagramOutgoing); err != nil {
 		panic(fmt.Sprintf("local.SignalPeer(0, zxsocket.SignalDatagramOutgoing) = %s", err))
@@ -3924,6 +4132,7 @@ func (sp *providerImpl) DatagramSocket(ctx fidl.Context, domain socket.Domain, p
 		s.addConnection(ctx, localC)
 		_ = syslog.DebugTf("NewSynchronousDatagram", "%p", s.endpointWithEvent)
 		sp.ns.onAddEndpoint(&s.endpoint)
+		sp.ns.onClientEndpoint(sp.client, &s.endpoint)
 
 		if err := s.endpointWithEvent.local.SignalPeer(0, zxsocket.SignalDatagramOutgoing); err != nil {
 			panic(fmt.Sprintf("local.SignalPeer(0, zxsocket.SignalDatagramOutgoing) = %s", err))
@@ -3936,6 +4145,7 @@ func (sp *providerImpl) DatagramSocket(ctx fidl.Context, domain socket.Domain, p
 	if err != nil {
 		return socket.ProviderDatagramSocketResult{}, err
 	}
+	sp.ns.onClientEndpoint(sp.client, &s.endpoint)
 
 	localC, peerC, err := zx.NewChannel(0)
 	if err != nil {
@@ -3966,11 +4176,16 @@ func (sp *providerImpl) StreamSocket(_ fidl.Context, domain socket.Domain, proto
 			return socket.ProviderStreamSocketResultWithErr(tcpipErrorToCode(err)), nil
 		}
 	}
+	if transProto == tcp.ProtocolNumber && sp.ns.tcpKeepalive != nil {
+		sp.ns.tcpKeepalive.onNewEndpoint(ep)
+	}
 
 	socketEp, err := newEndpointWithSocket(ep, wq, transProto, netProto, sp.ns, zx.SocketStream)
 	if err != nil {
 		return socket.ProviderStreamSocketResult{}, err
 	}
+	socketEp.endpoint.connectClient = sp.connectClient
+	sp.ns.onClientEndpoint(sp.client, &socketEp.endpoint)
 	streamSocketInterface, err := newStreamSocket(makeStreamSocketImpl(socketEp))
 	if err != nil {
 		return socket.ProviderStreamSocketResult{}, err
@@ -4002,6 +4217,8 @@ func (sp *providerImpl) InterfaceNameToIndex(_ fidl.Context, name string) (socke
 
 type rawProviderImpl struct {
 	ns *Netstack
+	// client accounts for the sockets created through this connection.
+	client *socketClient
 }
 
 var _ rawsocket.ProviderWithCtx = (*rawProviderImpl)(nil)
@@ -4057,6 +4274,7 @@ func (sp *rawProviderImpl) Socket(ctx fidl.Context, domain socket.Domain, proto
 	s.addConnection(ctx, localC)
 	_ = syslog.DebugTf("NewRawSocket", "%p", s.endpointWithEvent)
 	sp.ns.onAddEndpoint(&s.endpoint)
+	sp.ns.onClientEndpoint(sp.client, &s.endpoint)
 
 	if err := s.endpointWithEvent.local.SignalPeer(0, zxsocket.SignalDatagramOutgoing); err != nil {
 		panic(fmt.Sprintf("local.SignalPeer(0, zxsocket.SignalDatagramOutgoing) = %s", err))
@@ -4193,16 +4411,19 @@ func (s *rawSocketImpl) GetInfo(fidl.Context) (rawsocket.SocketGetInfoResult, er
 }
 
 func (s *rawSocketImpl) SetIpHeaderIncluded(_ fidl.Context, value bool) (rawsocket.SocketSetIpHeaderIncludedResult, error) {
+	s.ns.stats.SocketOptions.set(solIP, "IP_HDRINCL")
 	s.ep.SocketOptions().SetHeaderIncluded(value)
 	return rawsocket.SocketSetIpHeaderIncludedResultWithResponse(rawsocket.SocketSetIpHeaderIncludedResponse{}), nil
 }
 
 func (s *rawSocketImpl) GetIpHeaderIncluded(fidl.Context) (rawsocket.SocketGetIpHeaderIncludedResult, error) {
+	s.ns.stats.SocketOptions.get(solIP, "IP_HDRINCL")
 	value := s.ep.SocketOptions().GetHeaderIncluded()
 	return rawsocket.SocketGetIpHeaderIncludedResultWithResponse(rawsocket.SocketGetIpHeaderIncludedResponse{Value: value}), nil
 }
 
 func (s *rawSocketImpl) SetIcmpv6Filter(_ fidl.Context, value rawsocket.Icmpv6Filter) (rawsocket.SocketSetIcmpv6FilterResult, error) {
+	s.ns.stats.SocketOptions.set(solICMPv6, "ICMP6_FILTER")
 	if err := s.ep.SetSockOpt(&tcpip.ICMPv6Filter{DenyType: value.BlockedTypes}); err != nil {
 		return rawsocket.SocketSetIcmpv6FilterResultWithErr(tcpipErrorToCode(err)), nil
 	}
@@ -4210,6 +4431,7 @@ func (s *rawSocketImpl) SetIcmpv6Filter(_ fidl.Context, value rawsocket.Icmpv6Fi
 }
 
 func (s *rawSocketImpl) GetIcmpv6Filter(fidl.Context) (rawsocket.SocketGetIcmpv6FilterResult, error) {
+	s.ns.stats.SocketOptions.get(solICMPv6, "ICMP6_FILTER")
 	var filter tcpip.ICMPv6Filter
 	if err := s.ep.GetSockOpt(&filter); err != nil {
 		return rawsocket.SocketGetIcmpv6FilterResultWithErr(tcpipErrorToCode(err)), nil
@@ -4222,6 +4444,7 @@ func (s *rawSocketImpl) GetIcmpv6Filter(fidl.Context) (rawsocket.SocketGetIcmpv6
 }
 
 func (s *rawSocketImpl) SetIpv6Checksum(_ fidl.Context, value rawsocket.Ipv6ChecksumConfiguration) (rawsocket.SocketSetIpv6ChecksumResult, error) {
+	s.ns.stats.SocketOptions.set(solIPv6, "IPV6_CHECKSUM")
 	var v int
 	switch value.Which() {
 	case rawsocket.Ipv6ChecksumConfigurationDisabled:
@@ -4239,6 +4462,7 @@ func (s *rawSocketImpl) SetIpv6Checksum(_ fidl.Context, value rawsocket.Ipv6Chec
 }
 
 func (s *rawSocketImpl) GetIpv6Checksum(fidl.Context) (rawsocket.SocketGetIpv6ChecksumResult, error) {
+	s.ns.stats.SocketOptions.get(solIPv6, "IPV6_CHECKSUM")
 	v, err := s.ep.GetSockOptInt(tcpip.IPv6Checksum)
 	if err != nil {
 		return rawsocket.SocketGetIpv6ChecksumResultWithErr(tcpipErrorToCode(err)), nil
@@ -4431,6 +4655,178 @@ type packetSocketImpl struct {
 	synchronousDatagramSocket
 
 	kind packetsocket.Kind
+
+	// filter is shared by all connections to the socket.
+	filter *packetSocketFilter
+}
+
+var _ stack.PacketEndpoint = (*packetSocketFilter)(nil)
+
+// packetSocketFilter runs the classic BPF program attached to a packet socket
+// as packets are delivered to it.
+//
+// While a program is attached, the filter is registered with the stack in
+// place of the socket's endpoint, so packets the program drops never take up
+// space in the socket's receive queue or make it readable.
+type packetSocketFilter struct {
+	stack *stack.Stack
+	ep    tcpip.Endpoint
+	// handler is ep's stack.PacketEndpoint, which the filter hands accepted
+	// packets to.
+	handler stack.PacketEndpoint
+	cooked  bool
+
+	// onHUp detaches the filter from the stack once the endpoint is closed.
+	onHUp waiter.Entry
+
+	// program is read by HandlePacket without taking mu, which must not be
+	// held while packets are delivered: the stack delivers packets with its
+	// NIC's lock held, and mu is held while (un)registering with the stack,
+	// which takes the same lock.
+	program atomic.Pointer[bpf.Program]
+
+	// mu serializes attaching, detaching and binding.
+	mu struct {
+		sync.Mutex
+		// attached is true while the filter is registered with the stack in
+		// place of the endpoint, for nicID and netProto.
+		attached bool
+		nicID    tcpip.NICID
+		netProto tcpip.NetworkProtocolNumber
+		// closed is set once the endpoint is closed, after which the filter
+		// is never attached again.
+		closed bool
+	}
+}
+
+func newPacketSocketFilter(s *stack.Stack, ep tcpip.Endpoint, wq *waiter.Queue, cooked bool) *packetSocketFilter {
+	f := &packetSocketFilter{
+		stack:   s,
+		ep:      ep,
+		handler: ep.(stack.PacketEndpoint),
+		cooked:  cooked,
+	}
+	f.onHUp = waiter.NewFunctionEntry(waiter.EventHUp, func(waiter.EventMask) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.mu.closed = true
+		f.program.Store(nil)
+		if f.mu.attached {
+			f.mu.attached = false
+			f.stack.UnregisterPacketEndpoint(f.mu.nicID, f.mu.netProto, f)
+		}
+	})
+	wq.EventRegister(&f.onHUp)
+	return f
+}
+
+// attachLocked registers the filter with the stack in place of the endpoint,
+// for the endpoint's current binding.
+func (f *packetSocketFilter) attachLocked() {
+	addr, err := f.ep.GetLocalAddress()
+	if err != nil {
+		_ = syslog.WarnTf("packetSocketFilter", "GetLocalAddress() = %s", err)
+		return
+	}
+	f.mu.nicID = addr.NIC
+	f.mu.netProto = tcpip.NetworkProtocolNumber(addr.Port)
+	f.stack.UnregisterPacketEndpoint(f.mu.nicID, f.mu.netProto, f.handler)
+	if err := f.stack.RegisterPacketEndpoint(f.mu.nicID, f.mu.netProto, f); err != nil {
+		_ = syslog.WarnTf("packetSocketFilter", "RegisterPacketEndpoint(%d, %d, _) = %s", f.mu.nicID, f.mu.netProto, err)
+		return
+	}
+	f.mu.attached = true
+}
+
+// detachLocked registers the endpoint with the stack in place of the filter.
+func (f *packetSocketFilter) detachLocked() {
+	f.mu.attached = false
+	f.stack.UnregisterPacketEndpoint(f.mu.nicID, f.mu.netProto, f)
+	if err := f.stack.RegisterPacketEndpoint(f.mu.nicID, f.mu.netProto, f.handler); err != nil {
+		_ = syslog.WarnTf("packetSocketFilter", "RegisterPacketEndpoint(%d, %d, _) = %s", f.mu.nicID, f.mu.netProto, err)
+	}
+}
+
+// setProgram attaches program, replacing any attached program. A nil program
+// detaches the filter.
+func (f *packetSocketFilter) setProgram(program *bpf.Program) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.mu.closed {
+		return
+	}
+	f.program.Store(program)
+	switch {
+	case program != nil && !f.mu.attached:
+		f.attachLocked()
+	case program == nil && f.mu.attached:
+		f.detachLocked()
+	}
+}
+
+// bind binds the endpoint to addr, moving the filter's registration with the
+// stack to the new binding.
+func (f *packetSocketFilter) bind(addr tcpip.FullAddress) tcpip.Error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// The endpoint unregisters itself from its previous binding and
+	// registers itself for the new one when bound, so put it back in the
+	// filter's place around the call.
+	if f.mu.attached {
+		f.detachLocked()
+	}
+	err := f.ep.Bind(addr)
+	if f.program.Load() != nil {
+		f.attachLocked()
+	}
+	return err
+}
+
+// HandlePacket implements stack.PacketEndpoint.
+//
+// Packets the program drops are discarded, and accepted packets are
+// truncated to the length the program returns, though never past their
+// headers.
+func (f *packetSocketFilter) HandlePacket(nicID tcpip.NICID, netProto tcpip.NetworkProtocolNumber, pkt stack.PacketBufferPtr) {
+	program := f.program.Load()
+	if program == nil {
+		f.handler.HandlePacket(nicID, netProto, pkt)
+		return
+	}
+
+	// The program sees the packet as the socket would receive it: cooked
+	// sockets don't receive link headers.
+	view := pkt.ToView()
+	b := view.AsSlice()
+	if f.cooked {
+		b = b[len(pkt.LinkHeader().Slice()):]
+	}
+	size := len(b)
+	filtered := program.Run(b)
+	view.Release()
+
+	if filtered == 0 {
+		return
+	}
+	if int64(filtered) < int64(size) {
+		headers := size - pkt.Data().Size()
+		length := int(filtered) - headers
+		if length < 0 {
+			length = 0
+		}
+		pkt = pkt.Clone()
+		defer pkt.DecRef()
+		pkt.Data().CapLength(length)
+	}
+	f.handler.HandlePacket(nicID, netProto, pkt)
+}
+
+// setFilter attaches program to the socket, replacing any attached program. A
+// nil program detaches the filter.
+func (s *packetSocketImpl) setFilter(program *bpf.Program) {
+	s.filter.setProgram(program)
 }
 
 func (s *packetSocketImpl) DescribeDeprecated(fidl.Context) (fidlio.NodeInfoDeprecated, error) {
@@ -4522,7 +4918,7 @@ func (s *packetSocketImpl) Bind(_ fidl.Context, proto *packetsocket.ProtocolAsso
 		panic(fmt.Sprintf("unhandled %[1]T variant = %[1]d; %#[2]v", w, interface_id))
 	}
 
-	if err := s.ep.Bind(addr); err != nil {
+	if err := s.filter.bind(addr); err != nil {
 		if _, ok := err.(*tcpip.ErrUnknownNICID); ok {
 			return packetsocket.SocketBindResultWithErr(posix.ErrnoEnodev), nil
 		}
@@ -4695,6 +5091,8 @@ var _ packetsocket.ProviderWithCtx = (*packetProviderImpl)(nil)
 
 type packetProviderImpl struct {
 	ns *Netstack
+	// client accounts for the sockets created through this connection.
+	client *socketClient
 }
 
 func (sp *packetProviderImpl) Socket(ctx fidl.Context, kind packetsocket.Kind) (packetsocket.ProviderSocketResult, error) {
@@ -4725,6 +5123,7 @@ func (sp *packetProviderImpl) Socket(ctx fidl.Context, kind packetsocket.Kind) (
 	s := packetSocketImpl{
 		synchronousDatagramSocket: synchronousDatagramSocket,
 		kind:                      kind,
+		filter:                    newPacketSocketFilter(sp.ns.stack, ep, wq, cooked),
 	}
 
 	localC, peerC, err := zx.NewChannel(0)
@@ -4735,6 +5134,7 @@ func (sp *packetProviderImpl) Socket(ctx fidl.Context, kind packetsocket.Kind) (
 	s.addConnection(ctx, localC)
 	_ = syslog.DebugTf("NewPacketSocket", "%p", s.endpointWithEvent)
 	sp.ns.onAddEndpoint(&s.endpoint)
+	sp.ns.onClientEndpoint(sp.client, &s.endpoint)
 
 	if err := s.endpointWithEvent.local.SignalPeer(0, zxsocket.SignalDatagramOutgoing); err != nil {
 		panic(fmt.Sprintf("local.SignalPeer(0, zxsocket.SignalDatagramOutgoing) = %s", err))
@@ -9,13 +9,22 @@ package netstack
 import (
 	"context"
 	"fmt"
+	"math"
 	"syscall/zx"
 	"testing"
+	"time"
 
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/bpf"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/udp_serde"
+
+	packetsocket "fidl/fuchsia/posix/socket/packet"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/waiter"
 )
 
@@ -191,3 +200,170 @@ func TestDatagramSocketWithBlockingEndpoint(t *testing.T) {
 		})
 	}
 }
+
+// newTestPacketSocket returns a cooked packet socket on ns, which is closed
+// when the test finishes.
+func newTestPacketSocket(t *testing.T, ns *Netstack) (*packetSocketImpl, tcpip.Endpoint) {
+	t.Helper()
+	wq := new(waiter.Queue)
+	ep, tcpipErr := ns.stack.NewPacketEndpoint(true /* cooked */, 0 /* netProto */, wq)
+	if tcpipErr != nil {
+		t.Fatalf("NewPacketEndpoint(true, 0, _) = %s", tcpipErr)
+	}
+	synchronousDatagramSocket, err := makeSynchronousDatagramSocket(ep, 0 /* netProto */, 0 /* transProto */, wq, ns)
+	if err != nil {
+		t.Fatalf("makeSynchronousDatagramSocket(_, 0, 0, _, _): %s", err)
+	}
+	s := &packetSocketImpl{
+		synchronousDatagramSocket: synchronousDatagramSocket,
+		kind:                      packetsocket.KindNetwork,
+		filter:                    newPacketSocketFilter(ns.stack, ep, wq, true /* cooked */),
+	}
+	s.endpoint.incRef()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	t.Cleanup(func() {
+		if _, err := s.Close(context.Background()); err != nil {
+			t.Errorf("s.Close(): %s", err)
+		}
+		<-ctx.Done()
+	})
+	return s, ep
+}
+
+// bindTestPacketSocket binds s to IPv4 packets on nicID.
+func bindTestPacketSocket(t *testing.T, s *packetSocketImpl, nicID tcpip.NICID) {
+	t.Helper()
+	proto := packetsocket.ProtocolAssociationWithSpecified(uint16(header.IPv4ProtocolNumber))
+	result, err := s.Bind(context.Background(), &proto, packetsocket.BoundInterfaceIdWithSpecified(uint64(nicID)))
+	if err != nil {
+		t.Fatalf("s.Bind(_, _, _) = %s", err)
+	}
+	if result.Which() != packetsocket.SocketBindResultResponse {
+		t.Fatalf("s.Bind(_, _, _) = %s", result.Err)
+	}
+}
+
+func TestPacketSocketFilter(t *testing.T) {
+	addGoleakCheck(t)
+	ns, _ := newNetstack(t, netstackTestOptions{})
+	linkEp := channel.New(1, 1500, "")
+	ifState := installAndValidateIface(t, ns, func(t *testing.T, ns *Netstack, name string) *ifState {
+		return addLinkEndpoint(t, ns, name, linkEp)
+	})
+	s, ep := newTestPacketSocket(t, ns)
+
+	// Accept IPv4 packets truncated to 4 bytes, and drop everything else.
+	program, err := bpf.Compile([]bpf.Instruction{
+		{Code: 0x30, K: 0},
+		{Code: 0x15, Jt: 0, Jf: 1, K: 0x45},
+		{Code: 0x6, K: 4},
+		{Code: 0x6, K: 0},
+	})
+	if err != nil {
+		t.Fatalf("bpf.Compile(_) = %s", err)
+	}
+	// Attach the filter before binding so binding has to move it.
+	s.setFilter(program)
+	bindTestPacketSocket(t, s, ifState.nicid)
+
+	inject := func(b ...byte) {
+		t.Helper()
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Payload: bufferv2.MakeWithData(b),
+		})
+		defer pkt.DecRef()
+		linkEp.InjectInbound(header.IPv4ProtocolNumber, pkt)
+	}
+	expectRecv := func(want []byte) {
+		t.Helper()
+		result, err := s.RecvMsg(context.Background(), false /* wantPacketInfo */, math.MaxUint32, false /* wantControl */, 0)
+		if err != nil {
+			t.Fatalf("s.RecvMsg(_, ...) = %s", err)
+		}
+		if result.Which() != packetsocket.SocketRecvMsgResultResponse {
+			t.Fatalf("s.RecvMsg(_, ...) = %s", result.Err)
+		}
+		if got := result.Response.Data; string(got) != string(want) {
+			t.Errorf("got s.RecvMsg(_, ...).Data = %x, want = %x", got, want)
+		}
+	}
+	expectNotReadable := func() {
+		t.Helper()
+		if got := ep.Readiness(waiter.ReadableEvents); got != 0 {
+			t.Errorf("got ep.Readiness(waiter.ReadableEvents) = %b, want = 0", got)
+		}
+	}
+
+	// Dropped packets never reach the socket.
+	inject(0x60, 1, 2, 3, 4, 5)
+	expectNotReadable()
+
+	// Accepted packets are truncated to the length the filter returns.
+	inject(0x45, 1, 2, 3, 4, 5)
+	expectRecv([]byte{0x45, 1, 2, 3})
+	expectNotReadable()
+
+	// Detaching the filter lets all packets through again.
+	s.setFilter(nil)
+	inject(0x60, 1, 2, 3, 4, 5)
+	expectRecv([]byte{0x60, 1, 2, 3, 4, 5})
+}
+
+// Attaching, detaching and binding register with the stack, which must not
+// wait on packets being delivered to the filter, or vice versa.
+func TestPacketSocketFilterConcurrentWithTraffic(t *testing.T) {
+	addGoleakCheck(t)
+	ns, _ := newNetstack(t, netstackTestOptions{})
+	linkEp := channel.New(1, 1500, "")
+	ifState := installAndValidateIface(t, ns, func(t *testing.T, ns *Netstack, name string) *ifState {
+		return addLinkEndpoint(t, ns, name, linkEp)
+	})
+	s, _ := newTestPacketSocket(t, ns)
+	bindTestPacketSocket(t, s, ifState.nicid)
+
+	program, err := bpf.Compile([]bpf.Instruction{{Code: 0x6, K: math.MaxUint32}})
+	if err != nil {
+		t.Fatalf("bpf.Compile(_) = %s", err)
+	}
+
+	stop := make(chan struct{})
+	injected := make(chan struct{})
+	go func() {
+		defer close(injected)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+				Payload: bufferv2.MakeWithData([]byte{0x45, 1, 2, 3}),
+			})
+			linkEp.InjectInbound(header.IPv4ProtocolNumber, pkt)
+			pkt.DecRef()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		proto := packetsocket.ProtocolAssociationWithSpecified(uint16(header.IPv4ProtocolNumber))
+		for i := 0; i < 1000; i++ {
+			s.setFilter(program)
+			if _, err := s.Bind(context.Background(), &proto, packetsocket.BoundInterfaceIdWithSpecified(uint64(ifState.nicid))); err != nil {
+				t.Errorf("s.Bind(_, _, _) = %s", err)
+				return
+			}
+			s.setFilter(nil)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatal("timed out attaching and binding the filter while packets are delivered")
+	}
+	close(stop)
+	<-injected
+}
@@ -0,0 +1,250 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	syslog "go.fuchsia.dev/fuchsia/src/lib/syslog/go"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/nested"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const icmpErrorPolicyTagName = "icmp error policy"
+
+// icmpErrorType is a kind of ICMP error message, covering both ICMPv4 and
+// ICMPv6.
+type icmpErrorType string
+
+const (
+	icmpErrorUnreachable      icmpErrorType = "unreachable"
+	icmpErrorPacketTooBig     icmpErrorType = "packet_too_big"
+	icmpErrorTimeExceeded     icmpErrorType = "time_exceeded"
+	icmpErrorParameterProblem icmpErrorType = "parameter_problem"
+)
+
+var allICMPErrorTypes = []icmpErrorType{
+	icmpErrorPacketTooBig,
+	icmpErrorParameterProblem,
+	icmpErrorTimeExceeded,
+	icmpErrorUnreachable,
+}
+
+// icmpErrorPolicy configures which ICMP error messages netstack sends and how
+// often, so that the stack behaves predictably when it is scanned or flooded.
+type icmpErrorPolicy struct {
+	// period is the interval over which errors are counted.
+	period time.Duration
+
+	// perDestination is the number of errors sent to a single address per
+	// period. Zero disables the limit.
+	perDestination uint
+
+	// disabled holds the types of errors that are never sent.
+	disabled map[icmpErrorType]struct{}
+}
+
+// icmpErrorPolicyStats counts ICMP error messages that the policy kept from
+// being sent.
+type icmpErrorPolicyStats struct {
+	// Disabled counts errors of a disabled type.
+	Disabled tcpip.StatCounter
+	// ThrottledByDestination counts errors dropped because too many were sent
+	// to the same destination.
+	ThrottledByDestination tcpip.StatCounter
+}
+
+// icmpErrorThrottle enforces an icmpErrorPolicy across all interfaces.
+//
+// The stack's own ICMP rate limiter, configured with stack.SetICMPLimit and
+// stack.SetICMPBurst, still applies before the policy, but it is a single
+// bucket shared by every destination: one flooded destination would use up
+// the errors sent to all others. The policy's limit is per destination, so it
+// keeps its own buckets, in the same bounded set as the connect throttle's.
+type icmpErrorThrottle struct {
+	policy icmpErrorPolicy
+	clock  tcpip.Clock
+	stats  *icmpErrorPolicyStats
+
+	mu struct {
+		sync.Mutex
+		destinations tokenBuckets
+	}
+}
+
+func newICMPErrorThrottle(policy icmpErrorPolicy, clock tcpip.Clock, stats *icmpErrorPolicyStats) *icmpErrorThrottle {
+	t := &icmpErrorThrottle{
+		policy: policy,
+		clock:  clock,
+		stats:  stats,
+	}
+	t.mu.destinations.init()
+	return t
+}
+
+// classifyICMPError returns the type of the ICMP error message in pkt and its
+// destination, or false if pkt isn't an ICMP error generated by the stack.
+// Forwarded packets are never classified, as their transport header isn't
+// parsed.
+func classifyICMPError(pkt stack.PacketBufferPtr) (icmpErrorType, tcpip.Address, bool) {
+	transport := pkt.TransportHeader().Slice()
+	if len(transport) < 2 {
+		return "", "", false
+	}
+	icmpType, icmpCode := transport[0], transport[1]
+	network := pkt.NetworkHeader().Slice()
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		if pkt.TransportProtocolNumber != header.ICMPv4ProtocolNumber || len(network) < header.IPv4MinimumSize {
+			return "", "", false
+		}
+		dst := header.IPv4(network).DestinationAddress()
+		switch header.ICMPv4Type(icmpType) {
+		case header.ICMPv4DstUnreachable:
+			if header.ICMPv4Code(icmpCode) == header.ICMPv4FragmentationNeeded {
+				return icmpErrorPacketTooBig, dst, true
+			}
+			return icmpErrorUnreachable, dst, true
+		case header.ICMPv4TimeExceeded:
+			return icmpErrorTimeExceeded, dst, true
+		case header.ICMPv4ParamProblem:
+			return icmpErrorParameterProblem, dst, true
+		}
+	case header.IPv6ProtocolNumber:
+		if pkt.TransportProtocolNumber != header.ICMPv6ProtocolNumber || len(network) < header.IPv6MinimumSize {
+			return "", "", false
+		}
+		dst := header.IPv6(network).DestinationAddress()
+		switch header.ICMPv6Type(icmpType) {
+		case header.ICMPv6DstUnreachable:
+			return icmpErrorUnreachable, dst, true
+		case header.ICMPv6PacketTooBig:
+			return icmpErrorPacketTooBig, dst, true
+		case header.ICMPv6TimeExceeded:
+			return icmpErrorTimeExceeded, dst, true
+		case header.ICMPv6ParamProblem:
+			return icmpErrorParameterProblem, dst, true
+		}
+	}
+	return "", "", false
+}
+
+// allow returns whether an ICMP error of type typ may be sent to dst, and
+// counts it against the destination's limit if so.
+func (t *icmpErrorThrottle) allow(typ icmpErrorType, dst tcpip.Address) bool {
+	if _, ok := t.policy.disabled[typ]; ok {
+		t.stats.Disabled.Increment()
+		return false
+	}
+	if t.policy.period <= 0 || t.policy.perDestination == 0 {
+		return true
+	}
+	now := t.clock.NowMonotonic()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := t.mu.destinations.take(throttleKey{addr: dst}, now, t.policy.perDestination, t.policy.period)
+	if b.tokens < 1 {
+		t.stats.ThrottledByDestination.Increment()
+		if !b.throttled {
+			b.throttled = true
+			_ = syslog.WarnTf(icmpErrorPolicyTagName, "throttling ICMP errors to %s: more than %d per %s", dst, t.policy.perDestination, t.policy.period)
+		}
+		return false
+	}
+	b.tokens--
+	b.throttled = false
+	return true
+}
+
+// wrap returns a link endpoint that drops the ICMP errors written to lower
+// that the policy doesn't allow. It returns lower if the policy allows all
+// errors.
+func (t *icmpErrorThrottle) wrap(lower stack.LinkEndpoint) stack.LinkEndpoint {
+	if t == nil || (len(t.policy.disabled) == 0 && (t.policy.period <= 0 || t.policy.perDestination == 0)) {
+		return lower
+	}
+	e := &icmpErrorEndpoint{throttle: t}
+	e.Endpoint.Init(lower, e)
+	return e
+}
+
+var _ stack.LinkEndpoint = (*icmpErrorEndpoint)(nil)
+var _ stack.GSOEndpoint = (*icmpErrorEndpoint)(nil)
+var _ stack.NetworkDispatcher = (*icmpErrorEndpoint)(nil)
+
+// icmpErrorEndpoint is a link endpoint that enforces an icmpErrorThrottle on
+// the packets written to the endpoint it wraps.
+type icmpErrorEndpoint struct {
+	nested.Endpoint
+
+	throttle *icmpErrorThrottle
+}
+
+// WritePackets implements stack.LinkEndpoint.WritePackets.
+//
+// Dropped packets are reported as written, as they would be had the link
+// itself dropped them.
+func (e *icmpErrorEndpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	dropped := 0
+	var allowed stack.PacketBufferList
+	for _, pkt := range pkts.AsSlice() {
+		if typ, dst, ok := classifyICMPError(pkt); ok && !e.throttle.allow(typ, dst) {
+			dropped++
+			continue
+		}
+		pkt.IncRef()
+		allowed.PushBack(pkt)
+	}
+	defer allowed.DecRef()
+	if allowed.Len() == 0 {
+		return dropped, nil
+	}
+	n, err := e.Endpoint.WritePackets(allowed)
+	return n + dropped, err
+}
+
+// icmpErrorTypesFlag is a flag.Value that collects ICMP error types.
+type icmpErrorTypesFlag struct {
+	types map[icmpErrorType]struct{}
+}
+
+// String implements flag.Value.String.
+func (f *icmpErrorTypesFlag) String() string {
+	types := make([]string, 0, len(f.types))
+	for typ := range f.types {
+		types = append(types, string(typ))
+	}
+	sort.Strings(types)
+	return strings.Join(types, ",")
+}
+
+// Set implements flag.Value.Set.
+func (f *icmpErrorTypesFlag) Set(s string) error {
+	for _, typ := range allICMPErrorTypes {
+		if string(typ) == s {
+			if f.types == nil {
+				f.types = make(map[icmpErrorType]struct{})
+			}
+			f.types[typ] = struct{}{}
+			return nil
+		}
+	}
+	names := make([]string, 0, len(allICMPErrorTypes))
+	for _, typ := range allICMPErrorTypes {
+		names = append(names, string(typ))
+	}
+	return fmt.Errorf("unknown ICMP error type %q, want one of %s", s, strings.Join(names, ", "))
+}
@@ -0,0 +1,208 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	icmpTestSrcV4 = tcpip.Address("\xc0\xa8\x00\x01")
+	icmpTestDstV4 = tcpip.Address("\xc0\xa8\x00\x02")
+	icmpTestSrcV6 = tcpip.Address("\xfe\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01")
+	icmpTestDstV6 = tcpip.Address("\xfe\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02")
+)
+
+// icmpPacket returns an outgoing ICMP packet laid out as the stack lays out
+// the errors it generates.
+func icmpPacket(network tcpip.NetworkProtocolNumber, dst tcpip.Address, icmpType, icmpCode uint8) stack.PacketBufferPtr {
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: header.IPv6MinimumSize + header.ICMPv6MinimumSize,
+	})
+	icmp := pkt.TransportHeader().Push(header.ICMPv4MinimumSize)
+	icmp[0] = icmpType
+	icmp[1] = icmpCode
+	pkt.NetworkProtocolNumber = network
+	switch network {
+	case header.IPv4ProtocolNumber:
+		pkt.TransportProtocolNumber = header.ICMPv4ProtocolNumber
+		header.IPv4(pkt.NetworkHeader().Push(header.IPv4MinimumSize)).Encode(&header.IPv4Fields{
+			TotalLength: uint16(header.IPv4MinimumSize + len(icmp)),
+			TTL:         64,
+			Protocol:    uint8(header.ICMPv4ProtocolNumber),
+			SrcAddr:     icmpTestSrcV4,
+			DstAddr:     dst,
+		})
+	case header.IPv6ProtocolNumber:
+		pkt.TransportProtocolNumber = header.ICMPv6ProtocolNumber
+		header.IPv6(pkt.NetworkHeader().Push(header.IPv6MinimumSize)).Encode(&header.IPv6Fields{
+			PayloadLength:     uint16(len(icmp)),
+			TransportProtocol: header.ICMPv6ProtocolNumber,
+			HopLimit:          64,
+			SrcAddr:           icmpTestSrcV6,
+			DstAddr:           dst,
+		})
+	}
+	return pkt
+}
+
+func TestClassifyICMPError(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		network  tcpip.NetworkProtocolNumber
+		dst      tcpip.Address
+		icmpType uint8
+		icmpCode uint8
+		want     icmpErrorType
+		wantOK   bool
+	}{
+		{name: "v4 port unreachable", network: header.IPv4ProtocolNumber, dst: icmpTestDstV4, icmpType: uint8(header.ICMPv4DstUnreachable), icmpCode: uint8(header.ICMPv4PortUnreachable), want: icmpErrorUnreachable, wantOK: true},
+		{name: "v4 fragmentation needed", network: header.IPv4ProtocolNumber, dst: icmpTestDstV4, icmpType: uint8(header.ICMPv4DstUnreachable), icmpCode: uint8(header.ICMPv4FragmentationNeeded), want: icmpErrorPacketTooBig, wantOK: true},
+		{name: "v4 time exceeded", network: header.IPv4ProtocolNumber, dst: icmpTestDstV4, icmpType: uint8(header.ICMPv4TimeExceeded), want: icmpErrorTimeExceeded, wantOK: true},
+		{name: "v4 parameter problem", network: header.IPv4ProtocolNumber, dst: icmpTestDstV4, icmpType: uint8(header.ICMPv4ParamProblem), want: icmpErrorParameterProblem, wantOK: true},
+		{name: "v4 echo reply", network: header.IPv4ProtocolNumber, dst: icmpTestDstV4, icmpType: uint8(header.ICMPv4EchoReply)},
+		{name: "v6 unreachable", network: header.IPv6ProtocolNumber, dst: icmpTestDstV6, icmpType: uint8(header.ICMPv6DstUnreachable), want: icmpErrorUnreachable, wantOK: true},
+		{name: "v6 packet too big", network: header.IPv6ProtocolNumber, dst: icmpTestDstV6, icmpType: uint8(header.ICMPv6PacketTooBig), want: icmpErrorPacketTooBig, wantOK: true},
+		{name: "v6 time exceeded", network: header.IPv6ProtocolNumber, dst: icmpTestDstV6, icmpType: uint8(header.ICMPv6TimeExceeded), want: icmpErrorTimeExceeded, wantOK: true},
+		{name: "v6 parameter problem", network: header.IPv6ProtocolNumber, dst: icmpTestDstV6, icmpType: uint8(header.ICMPv6ParamProblem), want: icmpErrorParameterProblem, wantOK: true},
+		{name: "v6 neighbor solicitation", network: header.IPv6ProtocolNumber, dst: icmpTestDstV6, icmpType: uint8(header.ICMPv6NeighborSolicit)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pkt := icmpPacket(tc.network, tc.dst, tc.icmpType, tc.icmpCode)
+			defer pkt.DecRef()
+			got, dst, ok := classifyICMPError(pkt)
+			if got != tc.want || ok != tc.wantOK {
+				t.Fatalf("got classifyICMPError(_) = (%s, _, %t), want = (%s, _, %t)", got, ok, tc.want, tc.wantOK)
+			}
+			if ok && dst != tc.dst {
+				t.Errorf("got destination %s, want = %s", dst, tc.dst)
+			}
+		})
+	}
+}
+
+func TestICMPErrorEndpoint(t *testing.T) {
+	clock := faketime.NewManualClock()
+	var stats icmpErrorPolicyStats
+	throttle := newICMPErrorThrottle(icmpErrorPolicy{
+		period:         time.Second,
+		perDestination: 2,
+		disabled:       map[icmpErrorType]struct{}{icmpErrorTimeExceeded: {}},
+	}, clock, &stats)
+
+	var lower sentinelEndpoint
+	ep := throttle.wrap(&lower)
+
+	write := func(pkt stack.PacketBufferPtr, wantWritten uint) {
+		t.Helper()
+		var pkts stack.PacketBufferList
+		pkts.PushBack(pkt)
+		n, err := ep.WritePackets(pkts)
+		pkts.DecRef()
+		if err != nil || n != 1 {
+			t.Fatalf("got WritePackets(_) = (%d, %s), want = (1, nil)", n, err)
+		}
+		if got := lower.Enqueued(); got != wantWritten {
+			t.Errorf("got %d packets written to the lower endpoint, want = %d", got, wantWritten)
+		}
+	}
+
+	unreachable := func() stack.PacketBufferPtr {
+		return icmpPacket(header.IPv4ProtocolNumber, icmpTestDstV4, uint8(header.ICMPv4DstUnreachable), uint8(header.ICMPv4PortUnreachable))
+	}
+	write(unreachable(), 1)
+	write(unreachable(), 2)
+	// The destination is exhausted.
+	write(unreachable(), 2)
+	if got := stats.ThrottledByDestination.Value(); got != 1 {
+		t.Errorf("got ThrottledByDestination = %d, want = 1", got)
+	}
+	// Messages that aren't errors and errors to other destinations aren't
+	// throttled.
+	write(icmpPacket(header.IPv4ProtocolNumber, icmpTestDstV4, uint8(header.ICMPv4EchoReply), 0), 3)
+	write(icmpPacket(header.IPv6ProtocolNumber, icmpTestDstV6, uint8(header.ICMPv6PacketTooBig), 0), 4)
+
+	// Disabled errors are never sent.
+	write(icmpPacket(header.IPv6ProtocolNumber, icmpTestDstV6, uint8(header.ICMPv6TimeExceeded), 0), 4)
+	if got := stats.Disabled.Value(); got != 1 {
+		t.Errorf("got Disabled = %d, want = 1", got)
+	}
+
+	// Errors are allowed again as the bucket refills.
+	clock.Advance(time.Second / 2)
+	write(unreachable(), 5)
+	write(unreachable(), 5)
+}
+
+func TestICMPErrorThrottleEvictsLeastRecentlyUsed(t *testing.T) {
+	throttle := newICMPErrorThrottle(icmpErrorPolicy{
+		period:         time.Hour,
+		perDestination: 1,
+	}, faketime.NewManualClock(), &icmpErrorPolicyStats{})
+	addr := func(i int) tcpip.Address {
+		return tcpip.Address(string([]byte{10, 0, byte(i >> 8), byte(i)}))
+	}
+
+	// Exhaust the buckets of more destinations than are tracked; none has
+	// refilled, so the least recently used one is evicted.
+	for i := 0; i <= maxThrottleBuckets; i++ {
+		if !throttle.allow(icmpErrorUnreachable, addr(i)) {
+			t.Fatalf("got allow(_, %s) = false, want = true", addr(i))
+		}
+	}
+	// Destination 1 is still tracked, and now the most recently used.
+	if throttle.allow(icmpErrorUnreachable, addr(1)) {
+		t.Errorf("got allow(_, %s) = true, want = false", addr(1))
+	}
+	// Destination 0 was evicted, and destination 2 makes room for it.
+	for _, i := range []int{0, 2} {
+		if !throttle.allow(icmpErrorUnreachable, addr(i)) {
+			t.Errorf("got allow(_, %s) = false, want = true", addr(i))
+		}
+	}
+
+	throttle.mu.Lock()
+	defer throttle.mu.Unlock()
+	if got := throttle.mu.destinations.len(); got != maxThrottleBuckets {
+		t.Errorf("got %d tracked destinations, want = %d", got, maxThrottleBuckets)
+	}
+}
+
+func TestICMPErrorThrottleWrapAllowingAll(t *testing.T) {
+	lower := &noopEndpoint{}
+
+	var nilThrottle *icmpErrorThrottle
+	for _, throttle := range []*icmpErrorThrottle{
+		nilThrottle,
+		newICMPErrorThrottle(icmpErrorPolicy{period: time.Second}, faketime.NewManualClock(), &icmpErrorPolicyStats{}),
+	} {
+		if got := throttle.wrap(lower); got != lower {
+			t.Errorf("got wrap(_) = %T, want the lower endpoint", got)
+		}
+	}
+}
+
+func TestICMPErrorTypesFlag(t *testing.T) {
+	var f icmpErrorTypesFlag
+	for _, s := range []string{"time_exceeded", "unreachable"} {
+		if err := f.Set(s); err != nil {
+			t.Errorf("Set(%q) = %s", s, err)
+		}
+	}
+	if got, want := f.String(), "time_exceeded,unreachable"; got != want {
+		t.Errorf("got String() = %s, want = %s", got, want)
+	}
+	if err := f.Set("redirect"); err == nil {
+		t.Errorf("Set(redirect) succeeded, want error")
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"syscall/zx"
+	"time"
+
+	syslog "go.fuchsia.dev/fuchsia/src/lib/syslog/go"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+)
+
+const (
+	idleListenersTagName = "idle listeners"
+
+	// The amount of time between scans for idle listeners.
+	idleListenerScanPeriod = time.Minute
+)
+
+// idleListenerPolicy configures detection of listening stream sockets that
+// have not accepted a connection in a long time. Such sockets are usually
+// leaked, and accumulate across restarts of the components that leak them.
+type idleListenerPolicy struct {
+	// threshold is the amount of time after which a listener that has not
+	// accepted a connection is considered idle. Zero disables detection.
+	threshold time.Duration
+
+	// reap closes idle listeners whose owner is known to be gone.
+	reap bool
+}
+
+// familyStats counts the activity of the connections accepted by a listener
+// over a single network protocol.
+type familyStats struct {
+	accepts          uint64
+	segmentsReceived uint64
+	segmentsSent     uint64
+}
+
+func (s *familyStats) addTraffic(ep tcpip.Endpoint) {
+	if stats, ok := ep.Stats().(*tcp.Stats); ok {
+		s.segmentsReceived += stats.SegmentsReceived.Value()
+		s.segmentsSent += stats.SegmentsSent.Value()
+	}
+}
+
+// listenerActivity records accept activity on a listening stream socket.
+type listenerActivity struct {
+	eps *endpointWithSocket
+	// dualStack is set for IPv6 listeners that also accept IPv4 connections,
+	// whose activity is additionally split by network protocol.
+	dualStack bool
+
+	mu struct {
+		sync.Mutex
+		// lastActive is the time the socket started listening or last accepted
+		// a connection, whichever is later.
+		lastActive tcpip.MonotonicTime
+		accepts    uint64
+		// reported is set once the listener has been logged as idle.
+		reported bool
+		// ipv4 and ipv6 hold the activity of dual-stack listeners by network
+		// protocol, including the traffic of accepted connections that have
+		// since closed.
+		ipv4, ipv6 familyStats
+		// open maps the open connections accepted by dual-stack listeners to
+		// their network protocol. Their traffic is folded into ipv4 or ipv6
+		// when they are closed.
+		open map[tcpip.Endpoint]tcpip.NetworkProtocolNumber
+	}
+}
+
+// onAccept records that the listener accepted the connection ep. It returns
+// whether ep must be passed to onClose once it is closed.
+func (l *listenerActivity) onAccept(now tcpip.MonotonicTime, ep tcpip.Endpoint) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mu.lastActive = now
+	l.mu.accepts++
+	l.mu.reported = false
+
+	if !l.dualStack {
+		return false
+	}
+	var netProto tcpip.NetworkProtocolNumber
+	if info, ok := ep.Info().(*stack.TransportEndpointInfo); ok {
+		netProto = info.NetProto
+	}
+	stats := l.familyLocked(netProto)
+	if stats == nil {
+		return false
+	}
+	stats.accepts++
+	if l.mu.open == nil {
+		l.mu.open = make(map[tcpip.Endpoint]tcpip.NetworkProtocolNumber)
+	}
+	l.mu.open[ep] = netProto
+	return true
+}
+
+// onClose folds the traffic of the accepted connection ep, which has been
+// closed, into the per-family stats and releases it.
+func (l *listenerActivity) onClose(ep tcpip.Endpoint) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if netProto, ok := l.mu.open[ep]; ok {
+		l.familyLocked(netProto).addTraffic(ep)
+		delete(l.mu.open, ep)
+	}
+}
+
+// familyLocked returns the stats for netProto, or nil if it is neither IPv4
+// nor IPv6.
+func (l *listenerActivity) familyLocked(netProto tcpip.NetworkProtocolNumber) *familyStats {
+	switch netProto {
+	case header.IPv4ProtocolNumber:
+		return &l.mu.ipv4
+	case header.IPv6ProtocolNumber:
+		return &l.mu.ipv6
+	default:
+		return nil
+	}
+}
+
+// ownerGone returns whether the client end of the listener's zircon socket
+// has been closed, i.e. no process can observe incoming connections anymore.
+func (l *listenerActivity) ownerGone() bool {
+	status := zx.Sys_object_wait_one(zx.Handle(l.eps.local), zx.SignalSocketPeerClosed, 0, nil)
+	switch status {
+	case zx.ErrOk:
+		return true
+	case zx.ErrTimedOut:
+		return false
+	default:
+		// The socket may have been closed concurrently.
+		_ = syslog.DebugTf(idleListenersTagName, "wait for peer closed on %p failed with status = %s", l.eps, status)
+		return false
+	}
+}
+
+// listenerSnapshot is a point-in-time view of a listenerActivity.
+type listenerSnapshot struct {
+	idle      time.Duration
+	accepts   uint64
+	ownerGone bool
+	// dualStack is set if ipv4 and ipv6 split the listener's activity by
+	// network protocol.
+	dualStack  bool
+	ipv4, ipv6 familyStats
+}
+
+func (l *listenerActivity) snapshot(now tcpip.MonotonicTime) listenerSnapshot {
+	l.mu.Lock()
+	s := listenerSnapshot{
+		idle:      now.Sub(l.mu.lastActive),
+		accepts:   l.mu.accepts,
+		dualStack: l.dualStack,
+	}
+	if l.dualStack {
+		s.ipv4, s.ipv6 = l.mu.ipv4, l.mu.ipv6
+		for ep, netProto := range l.mu.open {
+			switch netProto {
+			case header.IPv4ProtocolNumber:
+				s.ipv4.addTraffic(ep)
+			case header.IPv6ProtocolNumber:
+				s.ipv6.addTraffic(ep)
+			}
+		}
+	}
+	l.mu.Unlock()
+	s.ownerGone = l.ownerGone()
+	return s
+}
+
+// listenersMap is a map from endpoint key to the accept activity of listening
+// stream sockets.
+//
+// It is a typesafe wrapper around sync.Map.
+type listenersMap struct {
+	inner sync.Map
+	// accepted maps the open connections accepted by dual-stack listeners to
+	// the listeners' activity, so that they can be released when they close.
+	accepted sync.Map
+}
+
+func (m *listenersMap) Load(key uint64) (*listenerActivity, bool) {
+	if value, ok := m.inner.Load(key); ok {
+		return value.(*listenerActivity), true
+	}
+	return nil, false
+}
+
+// onRemove stops tracking the listener with the given key, if any, and
+// releases ep if it is a connection accepted by a dual-stack listener.
+func (m *listenersMap) onRemove(key uint64, ep tcpip.Endpoint) {
+	m.inner.Delete(key)
+	if ep == nil {
+		return
+	}
+	if value, ok := m.accepted.LoadAndDelete(ep); ok {
+		value.(*listenerActivity).onClose(ep)
+	}
+}
+
+func (m *listenersMap) Range(f func(key uint64, value *listenerActivity) bool) {
+	m.inner.Range(func(key, value interface{}) bool {
+		return f(key.(uint64), value.(*listenerActivity))
+	})
+}
+
+// onListen starts tracking accept activity for eps.
+func (m *listenersMap) onListen(eps *endpointWithSocket, now tcpip.MonotonicTime) {
+	// Key value 0 would indicate that the endpoint was never added to the
+	// endpoints map, so it can't be reported either.
+	if eps.key == 0 {
+		return
+	}
+	l := &listenerActivity{
+		eps:       eps,
+		dualStack: eps.netProto == header.IPv6ProtocolNumber && !eps.ep.SocketOptions().GetV6Only(),
+	}
+	l.mu.lastActive = now
+	m.inner.Store(eps.key, l)
+}
+
+// onAccept records that the listener with the given key accepted the
+// connection ep.
+func (m *listenersMap) onAccept(key uint64, now tcpip.MonotonicTime, ep tcpip.Endpoint) {
+	if l, ok := m.Load(key); ok {
+		if l.onAccept(now, ep) {
+			m.accepted.Store(ep, l)
+		}
+	}
+}
+
+// scanIdleListeners logs listeners that have been idle for longer than the
+// policy's threshold and, if the policy allows it, closes those whose owner is
+// gone. It returns the number of idle and closed listeners.
+func (ns *Netstack) scanIdleListeners(policy idleListenerPolicy) (int, int) {
+	now := ns.stack.Clock().NowMonotonic()
+	var idle, reaped int
+	ns.listeners.Range(func(key uint64, l *listenerActivity) bool {
+		s := l.snapshot(now)
+		if s.idle < policy.threshold {
+			return true
+		}
+		idle++
+
+		l.mu.Lock()
+		reported := l.mu.reported
+		l.mu.reported = true
+		l.mu.Unlock()
+
+		var localAddr string
+		if addr, err := l.eps.ep.GetLocalAddress(); err == nil {
+			localAddr = fmt.Sprintf("%s:%d", addr.Addr, addr.Port)
+		}
+		if !reported {
+			_ = syslog.WarnTf(idleListenersTagName, "listener %d on %s has not accepted a connection in %s (accepts=%d, ownerGone=%t)", key, localAddr, s.idle, s.accepts, s.ownerGone)
+		}
+		if policy.reap && s.ownerGone {
+			_ = syslog.InfoTf(idleListenersTagName, "closing idle listener %d on %s", key, localAddr)
+			reaped++
+			// HUp removes the endpoint from the endpoints and listeners maps and
+			// closes it as if the endpoint had hung up.
+			l.eps.HUp()
+		}
+		return true
+	})
+	return idle, reaped
+}
+
+// startIdleListenerMonitor periodically scans for idle listeners until ctx is
+// done.
+func (ns *Netstack) startIdleListenerMonitor(ctx context.Context, policy idleListenerPolicy) {
+	if policy.threshold <= 0 {
+		return
+	}
+	_ = syslog.InfoTf(idleListenersTagName, "starting idle listener monitor with threshold=%s reap=%t", policy.threshold, policy.reap)
+
+	var timer tcpip.Timer
+	timer = ns.stack.Clock().AfterFunc(idleListenerScanPeriod, func() {
+		select {
+		case <-ctx.Done():
+			_ = syslog.InfoTf(idleListenersTagName, "stopping idle listener monitor")
+		default:
+			if idle, reaped := ns.scanIdleListeners(policy); idle != 0 {
+				_ = syslog.DebugTf(idleListenersTagName, "found %d idle listeners, closed %d", idle, reaped)
+			}
+			timer.Reset(idleListenerScanPeriod)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"syscall/zx"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+func TestDualStackListenerActivity(t *testing.T) {
+	addGoleakCheck(t)
+
+	ns, clock := newNetstack(t, netstackTestOptions{})
+	newEndpoint := func(netProto tcpip.NetworkProtocolNumber) tcpip.Endpoint {
+		t.Helper()
+		ep, err := ns.stack.NewEndpoint(tcp.ProtocolNumber, netProto, new(waiter.Queue))
+		if err != nil {
+			t.Fatalf("NewEndpoint(%d, %d, _) = %s", tcp.ProtocolNumber, netProto, err)
+		}
+		return ep
+	}
+
+	l := &listenerActivity{dualStack: true}
+	v4 := newEndpoint(ipv4.ProtocolNumber)
+	v6 := newEndpoint(ipv6.ProtocolNumber)
+	for _, ep := range []tcpip.Endpoint{v4, v6, newEndpoint(ipv6.ProtocolNumber)} {
+		if !l.onAccept(clock.NowMonotonic(), ep) {
+			t.Errorf("onAccept(_, %p) = false, want = true", ep)
+		}
+	}
+
+	l.mu.Lock()
+	if got, want := l.mu.accepts, uint64(3); got != want {
+		t.Errorf("got accepts = %d, want = %d", got, want)
+	}
+	if got, want := l.mu.ipv4.accepts, uint64(1); got != want {
+		t.Errorf("got IPv4 accepts = %d, want = %d", got, want)
+	}
+	if got, want := l.mu.ipv6.accepts, uint64(2); got != want {
+		t.Errorf("got IPv6 accepts = %d, want = %d", got, want)
+	}
+	if got, want := len(l.mu.open), 3; got != want {
+		t.Errorf("got %d open connections, want = %d", got, want)
+	}
+	l.mu.Unlock()
+
+	// Closed connections are released, but still count towards their family.
+	v4.Close()
+	l.onClose(v4)
+	// Connections that aren't tracked are ignored.
+	l.onClose(newEndpoint(ipv4.ProtocolNumber))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if got, want := l.mu.ipv4.accepts, uint64(1); got != want {
+		t.Errorf("got IPv4 accepts = %d, want = %d", got, want)
+	}
+	if got, want := len(l.mu.open), 2; got != want {
+		t.Errorf("got %d open connections, want = %d", got, want)
+	}
+	if _, ok := l.mu.open[v4]; ok {
+		t.Errorf("closed connection %p was not released", v4)
+	}
+}
+
+func TestScanIdleListeners(t *testing.T) {
+	addGoleakCheck(t)
+
+	ns, clock := newNetstack(t, netstackTestOptions{})
+	newListener := func() *endpointWithSocket {
+		t.Helper()
+		wq := new(waiter.Queue)
+		ep, tcpipErr := ns.stack.NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, wq)
+		if tcpipErr != nil {
+			t.Fatalf("NewEndpoint(%d, %d, _) = %s", tcp.ProtocolNumber, ipv4.ProtocolNumber, tcpipErr)
+		}
+		eps, err := newEndpointWithSocket(ep, wq, tcp.ProtocolNumber, ipv4.ProtocolNumber, ns, zx.SocketStream)
+		if err != nil {
+			t.Fatalf("newEndpointWithSocket(...) = %s", err)
+		}
+		ns.listeners.onListen(eps, clock.NowMonotonic())
+		return eps
+	}
+	closePeer := func(eps *endpointWithSocket) {
+		t.Helper()
+		if err := eps.peer.Close(); err != nil {
+			t.Fatalf("peer.Close() = %s", err)
+		}
+	}
+
+	const threshold = time.Hour
+	active := newListener()
+	ownerPresent := newListener()
+	ownerGone := newListener()
+	closePeer(ownerGone)
+	t.Cleanup(func() {
+		for _, eps := range []*endpointWithSocket{active, ownerPresent} {
+			closePeer(eps)
+			eps.HUp()
+		}
+	})
+
+	clock.Advance(threshold)
+	ns.listeners.onAccept(active.key, clock.NowMonotonic(), nil)
+
+	isTracked := func(eps *endpointWithSocket) bool {
+		_, ok := ns.listeners.Load(eps.key)
+		return ok
+	}
+
+	// Without reaping, idle listeners are only reported.
+	if idle, reaped := ns.scanIdleListeners(idleListenerPolicy{threshold: threshold}); idle != 2 || reaped != 0 {
+		t.Errorf("got scanIdleListeners(_) = (%d, %d), want = (2, 0)", idle, reaped)
+	}
+	if !isTracked(ownerGone) {
+		t.Error("idle listener closed without reaping")
+	}
+
+	// Reaping only closes the idle listener whose owner is gone.
+	if idle, reaped := ns.scanIdleListeners(idleListenerPolicy{threshold: threshold, reap: true}); idle != 2 || reaped != 1 {
+		t.Errorf("got scanIdleListeners(_) = (%d, %d), want = (2, 1)", idle, reaped)
+	}
+	if isTracked(ownerGone) {
+		t.Error("reaped listener is still tracked")
+	}
+	if _, ok := ns.endpoints.Load(ownerGone.key); ok {
+		t.Error("reaped listener is still in the endpoints map")
+	}
+	for _, eps := range []*endpointWithSocket{active, ownerPresent} {
+		if !isTracked(eps) {
+			t.Errorf("listener %d is no longer tracked", eps.key)
+		}
+	}
+}
@@ -39,11 +39,19 @@ type Endpoint struct {
 	capabilities    stack.LinkEndpointCapabilities
 	maxHeaderLength uint16
 	linkAddress     tcpip.LinkAddress
+	// oversizeDrops counts the frames received on each link that were too
+	// large to forward to at least one other link.
+	oversizeDrops map[*BridgeableEndpoint]*tcpip.StatCounter
+	// writeStats counts the packets written to the bridge that each link
+	// failed to accept.
+	writeStats map[*BridgeableEndpoint]*portWriteStats
 
 	mu struct {
 		sync.RWMutex
 
 		dispatcher stack.NetworkDispatcher
+		// vlans is set if VLAN filtering is enabled.
+		vlans *vlanFilter
 	}
 }
 
@@ -52,7 +60,10 @@ type Endpoint struct {
 //
 // `links` must be non-empty, as properties of the new link are derived from
 // the constituent links: it will have the minimum of the MTUs, the maximum
-// of the max header lengths, and the minimum set of capabilities.
+// of the max header lengths, and the minimum set of capabilities. Frames
+// received on a link that exceed the MTU of a link they would be forwarded to
+// are dropped on that link, and counted as oversize drops of the link they
+// were received on.
 func New(links []*BridgeableEndpoint) (*Endpoint, error) {
 	if len(links) == 0 {
 		return nil, fmt.Errorf("creating bridge with no attached endpoints is invalid")
@@ -64,13 +75,17 @@ func New(links []*BridgeableEndpoint) (*Endpoint, error) {
 			return strings.Compare(string(links[i].LinkAddress()), string(links[j].LinkAddress())) > 0
 		})
 		ep := &Endpoint{
-			links: make(map[tcpip.LinkAddress]*BridgeableEndpoint),
-			mtu:   math.MaxUint32,
+			links:         make(map[tcpip.LinkAddress]*BridgeableEndpoint),
+			mtu:           math.MaxUint32,
+			oversizeDrops: make(map[*BridgeableEndpoint]*tcpip.StatCounter),
+			writeStats:    make(map[*BridgeableEndpoint]*portWriteStats),
 		}
 		h := fnv.New64()
 		for _, l := range links {
 			linkAddress := l.LinkAddress()
 			ep.links[linkAddress] = l
+			ep.oversizeDrops[l] = &tcpip.StatCounter{}
+			ep.writeStats[l] = &portWriteStats{}
 
 			// mtu is the maximum write size, which is the minimum of any link's mtu.
 			if mtu := l.MTU(); mtu < ep.mtu {
@@ -127,7 +142,15 @@ func (*Endpoint) ConnectPort(port network.PortWithCtxInterfaceRequest) {
 	}
 }
 
+// MTU returns the minimum of the MTUs of the bridge's links. With VLAN
+// filtering enabled, it leaves room for the tag on the links that frames of
+// the bridge's VLAN are sent tagged on.
 func (ep *Endpoint) MTU() uint32 {
+	ep.mu.RLock()
+	defer ep.mu.RUnlock()
+	if vlans := ep.mu.vlans; vlans != nil {
+		return vlans.mtu
+	}
 	return ep.mtu
 }
 
@@ -151,11 +174,25 @@ func clonePkts(pkts stack.PacketBufferList) stack.PacketBufferList {
 	return newPkts
 }
 
-// WritePackets returns the number of packets in `pkts` that were successfully
-// written to all links.
+// WritePackets writes `pkts` to all links, and returns the number of packets
+// that were successfully written to at least one of them. A link that fails to
+// accept some packets doesn't keep them from being written to the others; the
+// packets each link failed to accept are counted in PortWriteStats.
 func (ep *Endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
-	minPkts := pkts.Len()
-	var firstErr tcpip.Error
+	summary := ep.writePackets(pkts)
+	return summary.written, summary.err()
+}
+
+// writePackets is like WritePackets, but returns a summary of the write.
+func (ep *Endpoint) writePackets(pkts stack.PacketBufferList) writeSummary {
+	ep.mu.RLock()
+	vlans := ep.mu.vlans
+	ep.mu.RUnlock()
+	if vlans != nil {
+		return ep.writeVLANPackets(vlans, pkts)
+	}
+
+	summary := writeSummary{packets: pkts.Len()}
 	i := 0
 	for _, l := range ep.links {
 		i++
@@ -170,23 +207,10 @@ func (ep *Endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error)
 			}
 			return l.WritePackets(pkts)
 		}()
-		if n < minPkts {
-			minPkts = n
-		}
-		switch err.(type) {
-		case nil:
-		case *tcpip.ErrClosedForSend:
-			// TODO(https://fxbug.dev/86959): Handle bridged interface removal.
-			_ = syslog.WarnTf(tag, "WritePackets on bridged endpoint returned ClosedForSend")
-		default:
-			if firstErr == nil {
-				firstErr = err
-			} else {
-				_ = syslog.WarnTf(tag, "already observed WritePackets error = %s, dropping error = %s", firstErr, err)
-			}
-		}
+		ep.recordWrite(&summary, l, n, err)
 	}
-	return minPkts, firstErr
+	ep.finishWrite(&summary)
+	return summary
 }
 
 func (ep *Endpoint) Attach(d stack.NetworkDispatcher) {
@@ -214,8 +238,14 @@ func (ep *Endpoint) IsAttached() bool {
 func (ep *Endpoint) DeliverNetworkPacketToBridge(rxEP *BridgeableEndpoint, protocol tcpip.NetworkProtocolNumber, pkt stack.PacketBufferPtr) {
 	ep.mu.RLock()
 	dispatcher := ep.mu.dispatcher
+	vlans := ep.mu.vlans
 	ep.mu.RUnlock()
 
+	if vlans != nil {
+		ep.deliverVLANPacketToBridge(vlans, dispatcher, rxEP, protocol, pkt)
+		return
+	}
+
 	dstLinkAddr := header.Ethernet(pkt.LinkHeader().Slice()).DestinationAddress()
 	if dstLinkAddr == ep.linkAddress {
 		if dispatcher != nil {
@@ -244,6 +274,8 @@ func (ep *Endpoint) DeliverNetworkPacketToBridge(rxEP *BridgeableEndpoint, proto
 
 	// TODO(https://fxbug.dev/20778): Learn which destinations are on
 	// which links and restrict transmission, like a bridge.
+	size := frameSize(pkt)
+	oversize := false
 	i := 0
 	rxFound := false
 	for _, l := range ep.links {
@@ -254,6 +286,10 @@ func (ep *Endpoint) DeliverNetworkPacketToBridge(rxEP *BridgeableEndpoint, proto
 			rxFound = true
 			continue
 		}
+		if !fitsMTU(l, size) {
+			oversize = true
+			continue
+		}
 
 		// Shadow pkt so that changes the link makes to the packet buffer
 		// are not visible to links we write the packet to after.
@@ -286,6 +322,9 @@ func (ep *Endpoint) DeliverNetworkPacketToBridge(rxEP *BridgeableEndpoint, proto
 			_ = syslog.WarnTf(tag, "failed to write to bridged endpoint %p: %s", l, err)
 		}
 	}
+	if oversize {
+		ep.oversizeDrops[rxEP].Increment()
+	}
 }
 
 // Wait implements stack.LinkEndpoint.
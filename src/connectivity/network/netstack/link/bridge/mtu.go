@@ -0,0 +1,55 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package bridge
+
+import (
+	"sort"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// MTUConflict describes a bridged link whose MTU exceeds the bridge's, so
+// that frames it receives may be too large to forward to other links.
+type MTUConflict struct {
+	LinkAddress tcpip.LinkAddress
+	MTU         uint32
+	// OversizeDrops is the number of frames received on the link that were too
+	// large to be forwarded to at least one other link.
+	OversizeDrops uint64
+}
+
+// MTUConflicts returns the links whose MTU exceeds the bridge's, ordered by
+// link address.
+func (ep *Endpoint) MTUConflicts() []MTUConflict {
+	var conflicts []MTUConflict
+	for linkAddress, l := range ep.links {
+		if mtu := l.MTU(); mtu > ep.mtu {
+			conflicts = append(conflicts, MTUConflict{
+				LinkAddress:   linkAddress,
+				MTU:           mtu,
+				OversizeDrops: ep.oversizeDrops[l].Value(),
+			})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return strings.Compare(string(conflicts[i].LinkAddress), string(conflicts[j].LinkAddress)) < 0
+	})
+	return conflicts
+}
+
+// fitsMTU returns whether a frame with the given payload size can be written
+// to l.
+func fitsMTU(l *BridgeableEndpoint, size int) bool {
+	return uint64(size) <= uint64(l.MTU())
+}
+
+// frameSize returns the size of the payload of the Ethernet frame in pkt.
+func frameSize(pkt stack.PacketBufferPtr) int {
+	return pkt.Size() - len(pkt.LinkHeader().Slice())
+}
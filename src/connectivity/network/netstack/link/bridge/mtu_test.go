@@ -0,0 +1,122 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bridge_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/bridge"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+type endpointWithMTU struct {
+	*stubEndpoint
+	mtu uint32
+}
+
+func (ep *endpointWithMTU) MTU() uint32 {
+	return ep.mtu
+}
+
+// TestOversizeFrames checks that frames too large for a link are not forwarded
+// to it, and are counted against the link they were received on.
+func TestOversizeFrames(t *testing.T) {
+	const (
+		smallMTU = 1500
+		largeMTU = 9000
+	)
+
+	eps := []stubEndpoint{
+		makeStubEndpoint(linkAddr1, 1),
+		makeStubEndpoint(linkAddr2, 1),
+		makeStubEndpoint(linkAddr3, 1),
+	}
+	defer func() {
+		for _, e := range eps {
+			e.release()
+		}
+	}()
+	mtus := []uint32{smallMTU, largeMTU, largeMTU}
+	var beps []*bridge.BridgeableEndpoint
+	for i := range eps {
+		// The Ethernet endpoint's MTU excludes its header.
+		beps = append(beps, bridge.NewEndpoint(ethernet.New(&endpointWithMTU{
+			stubEndpoint: &eps[i],
+			mtu:          mtus[i] + header.EthernetMinimumSize,
+		})))
+	}
+	bridgeEP, err := bridge.New(beps)
+	if err != nil {
+		t.Fatalf("failed to create bridge: %s", err)
+	}
+	if got := bridgeEP.MTU(); got != smallMTU {
+		t.Errorf("got MTU() = %d, want = %d", got, smallMTU)
+	}
+
+	wantConflicts := func(drops uint64) []bridge.MTUConflict {
+		return []bridge.MTUConflict{
+			{LinkAddress: linkAddr2, MTU: largeMTU, OversizeDrops: drops},
+			{LinkAddress: linkAddr3, MTU: largeMTU},
+		}
+	}
+	if diff := cmp.Diff(wantConflicts(0), bridgeEP.MTUConflicts()); diff != "" {
+		t.Errorf("MTUConflicts() mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, test := range []struct {
+		name      string
+		size      int
+		wantSmall bool
+		wantDrops uint64
+	}{
+		{name: "fits", size: smallMTU, wantSmall: true},
+		{name: "oversize", size: smallMTU + 1, wantDrops: 1},
+		{name: "jumbo", size: largeMTU, wantDrops: 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data := make([]byte, test.size)
+			pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+				ReserveHeaderBytes: int(bridgeEP.MaxHeaderLength()),
+				Payload:            bufferv2.MakeWithData(data),
+			})
+			defer pkt.DecRef()
+			header.Ethernet(pkt.LinkHeader().Push(header.EthernetMinimumSize)).Encode(&header.EthernetFields{
+				SrcAddr: linkAddr4,
+				DstAddr: linkAddr5,
+				Type:    fakeNetworkProtocol,
+			})
+			bridgeEP.DeliverNetworkPacketToBridge(beps[1], fakeNetworkProtocol, pkt)
+
+			func() {
+				pkt := eps[0].getPacket()
+				if pkt != (stack.PacketBufferPtr{}) {
+					defer pkt.DecRef()
+				}
+				if test.wantSmall {
+					expectPacket(t, "small MTU link", pkt, linkAddr4, linkAddr5, fakeNetworkProtocol, data)
+				} else if pkt != (stack.PacketBufferPtr{}) {
+					t.Errorf("small MTU link unexpectedly got a packet = %+v", pkt)
+				}
+			}()
+			func() {
+				pkt := eps[2].getPacket()
+				if pkt != (stack.PacketBufferPtr{}) {
+					defer pkt.DecRef()
+				}
+				expectPacket(t, "large MTU link", pkt, linkAddr4, linkAddr5, fakeNetworkProtocol, data)
+			}()
+
+			if diff := cmp.Diff(wantConflicts(test.wantDrops), bridgeEP.MTUConflicts()); diff != "" {
+				t.Errorf("MTUConflicts() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
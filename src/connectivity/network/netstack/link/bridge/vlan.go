@@ -0,0 +1,329 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package bridge
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	syslog "go.fuchsia.dev/fuchsia/src/lib/syslog/go"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// VLANEtherType is the EtherType of 802.1Q tagged frames.
+	VLANEtherType tcpip.NetworkProtocolNumber = 0x8100
+
+	// DefaultVLAN is the VLAN untagged frames belong to on ports without
+	// explicit VLAN membership, as on Linux bridges.
+	DefaultVLAN uint16 = 1
+
+	// MaxVLAN is the largest valid VLAN ID; 0 and 4095 are reserved.
+	MaxVLAN uint16 = 4094
+
+	// vlanTagSize is the size of an 802.1Q tag following the source address,
+	// excluding the EtherType of 0x8100 which takes the place of the
+	// encapsulated frame's.
+	vlanTagSize = 4
+
+	// vlanIDMask masks the VLAN ID out of the tag control information, which
+	// also holds the priority and drop eligibility of the frame.
+	vlanIDMask = 0x0fff
+)
+
+// PortVLANs is the VLAN membership of a bridged link.
+type PortVLANs struct {
+	// PVID is the VLAN untagged frames received on the port are assigned to.
+	// Frames of this VLAN are sent untagged on the port. Zero means the port
+	// drops untagged frames.
+	PVID uint16
+
+	// Tagged holds the VLANs whose frames are received and sent tagged on the
+	// port.
+	Tagged []uint16
+}
+
+// VLANConfig configures a bridge to forward frames only between the ports
+// that are members of their VLAN.
+type VLANConfig struct {
+	// PVID is the VLAN of the bridge's own interface. Frames it sends belong to
+	// this VLAN, and it only receives frames of this VLAN, untagged.
+	PVID uint16
+
+	// Ports holds the VLAN membership of bridged links. Links that aren't
+	// listed are untagged members of DefaultVLAN.
+	Ports map[*BridgeableEndpoint]PortVLANs
+}
+
+func checkVLAN(vid uint16) error {
+	if vid == 0 || vid > MaxVLAN {
+		return fmt.Errorf("invalid VLAN ID %d, must be in [1, %d]", vid, MaxVLAN)
+	}
+	return nil
+}
+
+// portMembership is the validated form of PortVLANs.
+type portMembership struct {
+	pvid   uint16
+	tagged map[uint16]struct{}
+}
+
+// egress returns whether the port is a member of VLAN vid, and if so whether
+// the VLAN's frames are sent tagged on it.
+func (m portMembership) egress(vid uint16) (member bool, tagged bool) {
+	if m.pvid == vid {
+		return true, false
+	}
+	_, ok := m.tagged[vid]
+	return ok, ok
+}
+
+// ingress returns the VLAN a frame received on the port with the given VLAN
+// tag belongs to, where 0 means the frame was untagged, or false if the port
+// drops the frame.
+func (m portMembership) ingress(tag uint16) (uint16, bool) {
+	if tag == 0 {
+		return m.pvid, m.pvid != 0
+	}
+	_, ok := m.tagged[tag]
+	return tag, ok
+}
+
+// vlanFilter is the validated form of VLANConfig.
+type vlanFilter struct {
+	pvid  uint16
+	ports map[*BridgeableEndpoint]portMembership
+	// mtu is the MTU of the bridge's own interface, which leaves room for the
+	// tag on the links that its frames are sent tagged on.
+	mtu uint32
+}
+
+func (f *vlanFilter) port(l *BridgeableEndpoint) portMembership {
+	if m, ok := f.ports[l]; ok {
+		return m
+	}
+	return portMembership{pvid: DefaultVLAN}
+}
+
+// SetVLANFiltering configures the bridge to forward frames only between the
+// ports that are members of their VLAN, tagging and untagging them as needed.
+// A nil config disables VLAN filtering, so that all frames are forwarded
+// unmodified.
+func (ep *Endpoint) SetVLANFiltering(config *VLANConfig) error {
+	var filter *vlanFilter
+	if config != nil {
+		if err := checkVLAN(config.PVID); err != nil {
+			return fmt.Errorf("bridge: %w", err)
+		}
+		filter = &vlanFilter{
+			pvid:  config.PVID,
+			ports: make(map[*BridgeableEndpoint]portMembership, len(config.Ports)),
+		}
+		for l, vlans := range config.Ports {
+			if ep.links[l.LinkAddress()] != l {
+				return fmt.Errorf("link %s is not part of the bridge", l.LinkAddress())
+			}
+			m := portMembership{
+				pvid:   vlans.PVID,
+				tagged: make(map[uint16]struct{}, len(vlans.Tagged)),
+			}
+			if m.pvid != 0 {
+				if err := checkVLAN(m.pvid); err != nil {
+					return fmt.Errorf("link %s: %w", l.LinkAddress(), err)
+				}
+			}
+			for _, vid := range vlans.Tagged {
+				if err := checkVLAN(vid); err != nil {
+					return fmt.Errorf("link %s: %w", l.LinkAddress(), err)
+				}
+				if vid == m.pvid {
+					return fmt.Errorf("link %s: VLAN %d can't be both untagged and tagged", l.LinkAddress(), vid)
+				}
+				m.tagged[vid] = struct{}{}
+			}
+			filter.ports[l] = m
+		}
+		filter.mtu = ep.vlanMTU(filter)
+	}
+
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.mu.vlans = filter
+	return nil
+}
+
+// vlanMTU returns the MTU of the bridge's own interface with VLAN filtering
+// configured by filter: the minimum of the MTUs of the links that are members
+// of its VLAN, less the size of the tag on links where the VLAN is tagged.
+func (ep *Endpoint) vlanMTU(filter *vlanFilter) uint32 {
+	mtu := ep.mtu
+	for _, l := range ep.links {
+		member, tagged := filter.port(l).egress(filter.pvid)
+		if !member || !tagged {
+			continue
+		}
+		linkMTU := l.MTU()
+		if linkMTU < vlanTagSize {
+			return 0
+		}
+		if linkMTU-vlanTagSize < mtu {
+			mtu = linkMTU - vlanTagSize
+		}
+	}
+	return mtu
+}
+
+// framePayload returns the payload of the Ethernet frame in pkt, following its
+// Ethernet header.
+func framePayload(pkt stack.PacketBufferPtr) []byte {
+	v := pkt.ToView()
+	defer v.Release()
+	return append([]byte(nil), v.AsSlice()[len(pkt.LinkHeader().Slice()):]...)
+}
+
+// newVLANPacket returns a new Ethernet frame holding the payload of an
+// untagged frame of the given protocol, tagged with vid or untagged if vid is
+// zero.
+func newVLANPacket(src, dst tcpip.LinkAddress, protocol tcpip.NetworkProtocolNumber, vid uint16, payload []byte) stack.PacketBufferPtr {
+	fields := header.EthernetFields{
+		SrcAddr: src,
+		DstAddr: dst,
+		Type:    protocol,
+	}
+	if vid != 0 {
+		fields.Type = VLANEtherType
+		tagged := make([]byte, vlanTagSize, vlanTagSize+len(payload))
+		binary.BigEndian.PutUint16(tagged, vid)
+		binary.BigEndian.PutUint16(tagged[2:], uint16(protocol))
+		payload = append(tagged, payload...)
+	}
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: header.EthernetMinimumSize,
+		Payload:            bufferv2.MakeWithData(payload),
+	})
+	pkt.NetworkProtocolNumber = protocol
+	header.Ethernet(pkt.LinkHeader().Push(header.EthernetMinimumSize)).Encode(&fields)
+	return pkt
+}
+
+// writeVLANPackets writes the packets sent by the bridge's own interface to
+// the links that are members of its VLAN, and returns the outcome on each of
+// them.
+func (ep *Endpoint) writeVLANPackets(vlans *vlanFilter, pkts stack.PacketBufferList) writeSummary {
+	type frame struct {
+		src, dst tcpip.LinkAddress
+		protocol tcpip.NetworkProtocolNumber
+		payload  []byte
+	}
+	frames := make([]frame, 0, pkts.Len())
+	for _, pkt := range pkts.AsSlice() {
+		eth := header.Ethernet(pkt.LinkHeader().Slice())
+		frames = append(frames, frame{
+			src:      eth.SourceAddress(),
+			dst:      eth.DestinationAddress(),
+			protocol: pkt.NetworkProtocolNumber,
+			payload:  framePayload(pkt),
+		})
+	}
+
+	summary := writeSummary{packets: len(frames)}
+	for _, l := range ep.links {
+		member, tagged := vlans.port(l).egress(vlans.pvid)
+		if !member {
+			continue
+		}
+		var vid uint16
+		if tagged {
+			vid = vlans.pvid
+		}
+		var pkts stack.PacketBufferList
+		for _, f := range frames {
+			pkts.PushBack(newVLANPacket(f.src, f.dst, f.protocol, vid, f.payload))
+		}
+		n, err := l.WritePackets(pkts)
+		pkts.DecRef()
+		ep.recordWrite(&summary, l, n, err)
+	}
+	ep.finishWrite(&summary)
+	return summary
+}
+
+// deliverVLANPacketToBridge delivers a frame received on rxEP to the bridge's
+// own interface and the other links that are members of its VLAN.
+func (ep *Endpoint) deliverVLANPacketToBridge(vlans *vlanFilter, dispatcher stack.NetworkDispatcher, rxEP *BridgeableEndpoint, protocol tcpip.NetworkProtocolNumber, pkt stack.PacketBufferPtr) {
+	payload := framePayload(pkt)
+	var vlanTag uint16
+	if protocol == VLANEtherType {
+		if len(payload) < vlanTagSize {
+			return
+		}
+		// A VLAN ID of zero means the frame is only priority tagged, and is
+		// treated as untagged.
+		vlanTag = binary.BigEndian.Uint16(payload) & vlanIDMask
+		protocol = tcpip.NetworkProtocolNumber(binary.BigEndian.Uint16(payload[2:]))
+		payload = payload[vlanTagSize:]
+	}
+	vid, ok := vlans.port(rxEP).ingress(vlanTag)
+	if !ok {
+		return
+	}
+
+	eth := header.Ethernet(pkt.LinkHeader().Slice())
+	src, dst := eth.SourceAddress(), eth.DestinationAddress()
+	toBridge := dst == ep.linkAddress
+	if (toBridge || header.IsMulticastEthernetAddress(dst)) && dispatcher != nil && vid == vlans.pvid {
+		func() {
+			pkt := newVLANPacket(src, dst, protocol, 0, payload)
+			defer pkt.DecRef()
+			dispatcher.DeliverNetworkPacket(protocol, pkt)
+		}()
+	}
+	if toBridge {
+		return
+	}
+
+	oversize := false
+	for _, l := range ep.links {
+		// Don't write back out the interface from which the frame arrived
+		// because that causes interoperability issues with a router.
+		if l == rxEP {
+			continue
+		}
+		member, tagged := vlans.port(l).egress(vid)
+		if !member {
+			continue
+		}
+		size := len(payload)
+		var egressVID uint16
+		if tagged {
+			egressVID = vid
+			size += vlanTagSize
+		}
+		if !fitsMTU(l, size) {
+			oversize = true
+			continue
+		}
+		var pkts stack.PacketBufferList
+		pkts.PushBack(newVLANPacket(src, dst, protocol, egressVID, payload))
+		_, err := l.WritePackets(pkts)
+		pkts.DecRef()
+		switch err.(type) {
+		case nil:
+		case *tcpip.ErrClosedForSend:
+			// TODO(https://fxbug.dev/86959): Handle bridged interface removal.
+		default:
+			_ = syslog.WarnTf(tag, "failed to write to bridged endpoint %p: %s", l, err)
+		}
+	}
+	if oversize {
+		ep.oversizeDrops[rxEP].Increment()
+	}
+}
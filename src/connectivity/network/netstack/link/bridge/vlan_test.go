@@ -0,0 +1,366 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bridge_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/bridge"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// vlanTag returns the 802.1Q tag of a frame of VLAN vid encapsulating
+// fakeNetworkProtocol, followed by data.
+func vlanTag(vid uint16, data []byte) []byte {
+	b := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint16(b, vid)
+	binary.BigEndian.PutUint16(b[2:], fakeNetworkProtocol)
+	return append(b, data...)
+}
+
+func TestSetVLANFiltering(t *testing.T) {
+	eps := []stubEndpoint{
+		makeStubEndpoint(linkAddr1, 0),
+		makeStubEndpoint(linkAddr2, 0),
+	}
+	defer func() {
+		for _, e := range eps {
+			e.release()
+		}
+	}()
+	bep := bridge.NewEndpoint(ethernet.New(&eps[0]))
+	bridgeEP, err := bridge.New([]*bridge.BridgeableEndpoint{bep})
+	if err != nil {
+		t.Fatalf("failed to create bridge: %s", err)
+	}
+	other := bridge.NewEndpoint(ethernet.New(&eps[1]))
+
+	for _, test := range []struct {
+		name    string
+		config  *bridge.VLANConfig
+		wantErr bool
+	}{
+		{name: "disabled", config: nil},
+		{name: "valid", config: &bridge.VLANConfig{
+			PVID:  1,
+			Ports: map[*bridge.BridgeableEndpoint]bridge.PortVLANs{bep: {PVID: 2, Tagged: []uint16{3, bridge.MaxVLAN}}},
+		}},
+		{name: "trunk", config: &bridge.VLANConfig{
+			PVID:  1,
+			Ports: map[*bridge.BridgeableEndpoint]bridge.PortVLANs{bep: {Tagged: []uint16{1}}},
+		}},
+		{name: "zero bridge PVID", config: &bridge.VLANConfig{}, wantErr: true},
+		{name: "reserved bridge PVID", config: &bridge.VLANConfig{PVID: 4095}, wantErr: true},
+		{name: "reserved port PVID", config: &bridge.VLANConfig{
+			PVID:  1,
+			Ports: map[*bridge.BridgeableEndpoint]bridge.PortVLANs{bep: {PVID: 4095}},
+		}, wantErr: true},
+		{name: "zero tagged VLAN", config: &bridge.VLANConfig{
+			PVID:  1,
+			Ports: map[*bridge.BridgeableEndpoint]bridge.PortVLANs{bep: {Tagged: []uint16{0}}},
+		}, wantErr: true},
+		{name: "untagged and tagged", config: &bridge.VLANConfig{
+			PVID:  1,
+			Ports: map[*bridge.BridgeableEndpoint]bridge.PortVLANs{bep: {PVID: 2, Tagged: []uint16{2}}},
+		}, wantErr: true},
+		{name: "link not in bridge", config: &bridge.VLANConfig{
+			PVID:  1,
+			Ports: map[*bridge.BridgeableEndpoint]bridge.PortVLANs{other: {PVID: 1}},
+		}, wantErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := bridgeEP.SetVLANFiltering(test.config)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Errorf("got SetVLANFiltering(_) = %v, want error = %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// TestVLANFiltering checks that frames are only forwarded between the ports
+// of their VLAN, and are tagged or untagged according to each port's
+// membership.
+func TestVLANFiltering(t *testing.T) {
+	const (
+		bridgeVLAN = 10
+		otherVLAN  = 20
+	)
+
+	eps := []stubEndpoint{
+		makeStubEndpoint(linkAddr1, 1),
+		makeStubEndpoint(linkAddr2, 1),
+		makeStubEndpoint(linkAddr3, 1),
+	}
+	defer func() {
+		for _, e := range eps {
+			e.release()
+		}
+	}()
+	beps := []*bridge.BridgeableEndpoint{
+		bridge.NewEndpoint(ethernet.New(&eps[0])),
+		bridge.NewEndpoint(ethernet.New(&eps[1])),
+		bridge.NewEndpoint(ethernet.New(&eps[2])),
+	}
+	bridgeEP, err := bridge.New(beps)
+	if err != nil {
+		t.Fatalf("failed to create bridge: %s", err)
+	}
+	if err := bridgeEP.SetVLANFiltering(&bridge.VLANConfig{
+		PVID: bridgeVLAN,
+		Ports: map[*bridge.BridgeableEndpoint]bridge.PortVLANs{
+			// An access port of the bridge's VLAN.
+			beps[0]: {PVID: bridgeVLAN},
+			// A trunk port carrying both VLANs.
+			beps[1]: {Tagged: []uint16{bridgeVLAN, otherVLAN}},
+			// An access port of the other VLAN.
+			beps[2]: {PVID: otherVLAN},
+		},
+	}); err != nil {
+		t.Fatalf("SetVLANFiltering(_) = %s", err)
+	}
+
+	data := []byte{1, 2, 3, 4}
+	srcAddr := linkAddr4
+	dstAddr := header.EthernetBroadcastAddress
+
+	type want struct {
+		proto tcpip.NetworkProtocolNumber
+		data  []byte
+	}
+	untagged := &want{proto: fakeNetworkProtocol, data: data}
+	tagged := func(vid uint16) *want {
+		return &want{proto: bridge.VLANEtherType, data: vlanTag(vid, data)}
+	}
+
+	for _, test := range []struct {
+		name         string
+		rxEP         int
+		vid          uint16
+		wantEPs      [3]*want
+		wantDelivery bool
+	}{
+		{
+			name:         "untagged on access port",
+			rxEP:         0,
+			wantEPs:      [3]*want{nil, tagged(bridgeVLAN), nil},
+			wantDelivery: true,
+		},
+		{
+			name:         "bridge VLAN on trunk port",
+			rxEP:         1,
+			vid:          bridgeVLAN,
+			wantEPs:      [3]*want{untagged, nil, nil},
+			wantDelivery: true,
+		},
+		{
+			name:    "other VLAN on trunk port",
+			rxEP:    1,
+			vid:     otherVLAN,
+			wantEPs: [3]*want{nil, nil, untagged},
+		},
+		{
+			name:    "untagged on other access port",
+			rxEP:    2,
+			wantEPs: [3]*want{nil, tagged(otherVLAN), nil},
+		},
+		{
+			name: "untagged on trunk port",
+			rxEP: 1,
+		},
+		{
+			name: "unknown VLAN on trunk port",
+			rxEP: 1,
+			vid:  30,
+		},
+		{
+			name: "tagged on access port",
+			rxEP: 0,
+			vid:  bridgeVLAN,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var ndb testNetworkDispatcher
+			defer ndb.release()
+			bridgeEP.Attach(&ndb)
+
+			payload := data
+			proto := tcpip.NetworkProtocolNumber(fakeNetworkProtocol)
+			if test.vid != 0 {
+				payload = vlanTag(test.vid, data)
+				proto = bridge.VLANEtherType
+			}
+			pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+				ReserveHeaderBytes: int(bridgeEP.MaxHeaderLength()),
+				Payload:            bufferv2.MakeWithData(payload),
+			})
+			defer pkt.DecRef()
+			header.Ethernet(pkt.LinkHeader().Push(header.EthernetMinimumSize)).Encode(&header.EthernetFields{
+				SrcAddr: srcAddr,
+				DstAddr: dstAddr,
+				Type:    proto,
+			})
+			bridgeEP.DeliverNetworkPacketToBridge(beps[test.rxEP], proto, pkt)
+
+			for i, want := range test.wantEPs {
+				func() {
+					pkt := eps[i].getPacket()
+					if pkt != (stack.PacketBufferPtr{}) {
+						defer pkt.DecRef()
+					}
+					if want != nil {
+						expectPacket(t, fmt.Sprintf("ep%d", i), pkt, srcAddr, dstAddr, want.proto, want.data)
+					} else if pkt != (stack.PacketBufferPtr{}) {
+						t.Errorf("ep%d unexpectedly got a packet = %+v", i, pkt)
+					}
+				}()
+			}
+
+			if test.wantDelivery {
+				if ndb.count != 1 {
+					t.Errorf("got ndb.count = %d, want = 1", ndb.count)
+				} else {
+					func() {
+						pkt := ndb.takePkt()
+						defer pkt.DecRef()
+						expectPacket(t, "bridge-dispatcher", pkt, srcAddr, dstAddr, fakeNetworkProtocol, data)
+					}()
+				}
+			} else if ndb.count != 0 {
+				t.Errorf("got ndb.count = %d, want = 0", ndb.count)
+			}
+		})
+	}
+
+	t.Run("WritePackets", func(t *testing.T) {
+		baddr := bridgeEP.LinkAddress()
+		var pkts stack.PacketBufferList
+		defer pkts.DecRef()
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			ReserveHeaderBytes: int(bridgeEP.MaxHeaderLength()),
+			Payload:            bufferv2.MakeWithData(data),
+		})
+		pkt.EgressRoute.LocalLinkAddress = baddr
+		pkt.EgressRoute.RemoteLinkAddress = dstAddr
+		pkt.NetworkProtocolNumber = fakeNetworkProtocol
+		bridgeEP.AddHeader(pkt)
+		pkts.PushBack(pkt)
+
+		if got, err := bridgeEP.WritePackets(pkts); err != nil || got != 1 {
+			t.Errorf("got bridgeEP.WritePackets(_) = (%d, %v), want = (1, nil)", got, err)
+		}
+
+		for i, want := range [3]*want{untagged, tagged(bridgeVLAN), nil} {
+			func() {
+				pkt := eps[i].getPacket()
+				if pkt != (stack.PacketBufferPtr{}) {
+					defer pkt.DecRef()
+				}
+				if want != nil {
+					expectPacket(t, fmt.Sprintf("ep%d", i), pkt, baddr, dstAddr, want.proto, want.data)
+				} else if pkt != (stack.PacketBufferPtr{}) {
+					t.Errorf("ep%d unexpectedly got a packet = %+v", i, pkt)
+				}
+			}()
+		}
+	})
+}
+
+// TestVLANMTU checks that the tag added to frames sent tagged on a link
+// counts against the link's MTU.
+func TestVLANMTU(t *testing.T) {
+	const (
+		mtu        = 1500
+		bridgeVLAN = 10
+	)
+
+	eps := []stubEndpoint{
+		makeStubEndpoint(linkAddr1, 1),
+		makeStubEndpoint(linkAddr2, 1),
+	}
+	defer func() {
+		for _, e := range eps {
+			e.release()
+		}
+	}()
+	var beps []*bridge.BridgeableEndpoint
+	for i := range eps {
+		// The Ethernet endpoint's MTU excludes its header.
+		beps = append(beps, bridge.NewEndpoint(ethernet.New(&endpointWithMTU{
+			stubEndpoint: &eps[i],
+			mtu:          mtu + header.EthernetMinimumSize,
+		})))
+	}
+	bridgeEP, err := bridge.New(beps)
+	if err != nil {
+		t.Fatalf("failed to create bridge: %s", err)
+	}
+
+	for _, test := range []struct {
+		name    string
+		config  *bridge.VLANConfig
+		wantMTU uint32
+	}{
+		{name: "disabled", wantMTU: mtu},
+		{name: "untagged", config: &bridge.VLANConfig{PVID: bridge.DefaultVLAN}, wantMTU: mtu},
+		{name: "tagged", config: &bridge.VLANConfig{
+			PVID: bridgeVLAN,
+			Ports: map[*bridge.BridgeableEndpoint]bridge.PortVLANs{
+				beps[0]: {PVID: bridgeVLAN},
+				beps[1]: {Tagged: []uint16{bridgeVLAN}},
+			},
+		}, wantMTU: mtu - 4},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := bridgeEP.SetVLANFiltering(test.config); err != nil {
+				t.Fatalf("SetVLANFiltering(_) = %s", err)
+			}
+			if got := bridgeEP.MTU(); got != test.wantMTU {
+				t.Errorf("got MTU() = %d, want = %d", got, test.wantMTU)
+			}
+		})
+	}
+
+	// The bridge is left with its VLAN tagged on the second link.
+	for _, test := range []struct {
+		name     string
+		size     int
+		wantSent bool
+	}{
+		{name: "fits", size: mtu - 4, wantSent: true},
+		{name: "oversize once tagged", size: mtu},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data := make([]byte, test.size)
+			pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+				ReserveHeaderBytes: int(bridgeEP.MaxHeaderLength()),
+				Payload:            bufferv2.MakeWithData(data),
+			})
+			defer pkt.DecRef()
+			header.Ethernet(pkt.LinkHeader().Push(header.EthernetMinimumSize)).Encode(&header.EthernetFields{
+				SrcAddr: linkAddr4,
+				DstAddr: linkAddr5,
+				Type:    fakeNetworkProtocol,
+			})
+			bridgeEP.DeliverNetworkPacketToBridge(beps[0], fakeNetworkProtocol, pkt)
+
+			got := eps[1].getPacket()
+			if got != (stack.PacketBufferPtr{}) {
+				defer got.DecRef()
+			}
+			if test.wantSent {
+				expectPacket(t, "tagged link", got, linkAddr4, linkAddr5, bridge.VLANEtherType, vlanTag(bridgeVLAN, data))
+			} else if got != (stack.PacketBufferPtr{}) {
+				t.Errorf("tagged link unexpectedly got a packet = %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package bridge
+
+import (
+	"sort"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// writeSummary is the outcome of writing packets to a bridge.
+type writeSummary struct {
+	// packets is the number of packets written to the bridge.
+	packets int
+	// written is the number of packets that at least one link accepted. It
+	// equals packets if the packets weren't written to any link, e.g. because
+	// none is a member of the bridge's VLAN.
+	written int
+
+	// errLinkAddress, errWritten and linkErr describe the link, among those that
+	// returned an error, that accepted the most packets, ties going to the
+	// lowest link address.
+	errLinkAddress tcpip.LinkAddress
+	errWritten     int
+	linkErr        tcpip.Error
+
+	// links is the number of links the packets were written to.
+	links int
+}
+
+// err returns the error to report for the packets that no link accepted,
+// or nil if every packet was accepted by at least one link. It is the error
+// of the link that accepted as many packets as any other, if that link
+// returned one.
+func (s *writeSummary) err() tcpip.Error {
+	if s.written == s.packets || s.errWritten != s.written {
+		return nil
+	}
+	return s.linkErr
+}
+
+// PortWriteStats counts the packets written to the bridge that one of its
+// links failed to accept.
+type PortWriteStats struct {
+	LinkAddress tcpip.LinkAddress
+	// Errors is the number of writes to the link that returned an error.
+	Errors uint64
+	// DroppedPackets is the number of packets the link didn't accept.
+	DroppedPackets uint64
+}
+
+type portWriteStats struct {
+	errors         tcpip.StatCounter
+	droppedPackets tcpip.StatCounter
+}
+
+// PortWriteStats returns the write failure counters of each link, ordered by
+// link address.
+func (ep *Endpoint) PortWriteStats() []PortWriteStats {
+	stats := make([]PortWriteStats, 0, len(ep.links))
+	for linkAddress, l := range ep.links {
+		s := ep.writeStats[l]
+		stats = append(stats, PortWriteStats{
+			LinkAddress:    linkAddress,
+			Errors:         s.errors.Value(),
+			DroppedPackets: s.droppedPackets.Value(),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return strings.Compare(string(stats[i].LinkAddress), string(stats[j].LinkAddress)) < 0
+	})
+	return stats
+}
+
+// recordWrite accounts in s for writing s.packets packets to l, of which n
+// were accepted.
+func (ep *Endpoint) recordWrite(s *writeSummary, l *BridgeableEndpoint, n int, err tcpip.Error) {
+	s.links++
+	if n > s.written {
+		s.written = n
+	}
+	if n == s.packets && err == nil {
+		return
+	}
+	stats := ep.writeStats[l]
+	stats.droppedPackets.IncrementBy(uint64(s.packets - n))
+	if err == nil {
+		return
+	}
+	stats.errors.Increment()
+	linkAddress := l.LinkAddress()
+	if s.linkErr == nil || n > s.errWritten || (n == s.errWritten && linkAddress < s.errLinkAddress) {
+		s.errLinkAddress = linkAddress
+		s.errWritten = n
+		s.linkErr = err
+	}
+}
+
+// finishWrite completes s once the packets have been written to every link.
+//
+// Failures aren't logged, as links routinely return ErrWouldBlock while
+// they're congested; they're counted in PortWriteStats instead.
+func (ep *Endpoint) finishWrite(s *writeSummary) {
+	if s.links == 0 {
+		s.written = s.packets
+	}
+}
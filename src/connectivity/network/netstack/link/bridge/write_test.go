@@ -0,0 +1,122 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package bridge_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/bridge"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// TestWritePacketsPortFailures checks that a link failing to accept packets
+// doesn't keep them from being written to the other links.
+func TestWritePacketsPortFailures(t *testing.T) {
+	eps := []stubEndpoint{
+		makeStubEndpoint(linkAddr1, 1),
+		makeStubEndpoint(linkAddr2, 3),
+		makeStubEndpoint(linkAddr3, 3),
+	}
+	defer func() {
+		for _, e := range eps {
+			e.release()
+		}
+	}()
+
+	bridgeEP, err := bridge.New([]*bridge.BridgeableEndpoint{
+		bridge.NewEndpoint(ethernet.New(&eps[0])),
+		bridge.NewEndpoint(ethernet.New(&eps[1])),
+		bridge.NewEndpoint(ethernet.New(&eps[2])),
+	})
+	if err != nil {
+		t.Fatalf("failed to create bridge: %s", err)
+	}
+
+	makePkts := func(n int) stack.PacketBufferList {
+		var pkts stack.PacketBufferList
+		for i := 0; i < n; i++ {
+			pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+				ReserveHeaderBytes: int(bridgeEP.MaxHeaderLength()),
+				Payload:            bufferv2.MakeWithData([]byte{byte(i)}),
+			})
+			pkt.EgressRoute.LocalLinkAddress = bridgeEP.LinkAddress()
+			pkt.EgressRoute.RemoteLinkAddress = linkAddr5
+			pkt.NetworkProtocolNumber = fakeNetworkProtocol
+			bridgeEP.AddHeader(pkt)
+			pkts.PushBack(pkt)
+		}
+		return pkts
+	}
+
+	// The first link only has room for one of the packets.
+	func() {
+		pkts := makePkts(3)
+		defer pkts.DecRef()
+
+		if got, err := bridgeEP.WritePackets(pkts); got != 3 || err != nil {
+			t.Errorf("got bridgeEP.WritePackets(_) = (%d, %v), want = (3, nil)", got, err)
+		}
+		for id := range eps[1:] {
+			for i := 0; i < 3; i++ {
+				if pkt := eps[id+1].getPacket(); pkt == (stack.PacketBufferPtr{}) {
+					t.Errorf("ep%d: packet %d not received", id+1, i)
+				} else {
+					pkt.DecRef()
+				}
+			}
+		}
+	}()
+	if diff := cmp.Diff([]bridge.PortWriteStats{
+		{LinkAddress: linkAddr1, Errors: 1, DroppedPackets: 2},
+		{LinkAddress: linkAddr2},
+		{LinkAddress: linkAddr3},
+	}, bridgeEP.PortWriteStats()); diff != "" {
+		t.Errorf("PortWriteStats() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Now the first link is full, so it accepts none of the packets.
+	func() {
+		pkts := makePkts(2)
+		defer pkts.DecRef()
+
+		if got, err := bridgeEP.WritePackets(pkts); got != 2 || err != nil {
+			t.Errorf("got bridgeEP.WritePackets(_) = (%d, %v), want = (2, nil)", got, err)
+		}
+	}()
+
+	if diff := cmp.Diff([]bridge.PortWriteStats{
+		{LinkAddress: linkAddr1, Errors: 2, DroppedPackets: 4},
+		{LinkAddress: linkAddr2},
+		{LinkAddress: linkAddr3},
+	}, bridgeEP.PortWriteStats()); diff != "" {
+		t.Errorf("PortWriteStats() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Once the other links only have room for one more packet, the second
+	// packet reaches no link.
+	func() {
+		pkts := makePkts(2)
+		defer pkts.DecRef()
+
+		if got, err := bridgeEP.WritePackets(pkts); got != 1 {
+			t.Errorf("got bridgeEP.WritePackets(_) = (%d, %v), want = (1, _)", got, err)
+		} else if _, ok := err.(*tcpip.ErrWouldBlock); !ok {
+			t.Errorf("got bridgeEP.WritePackets(_) = (%d, %v), want = (1, %s)", got, err, &tcpip.ErrWouldBlock{})
+		}
+	}()
+	if diff := cmp.Diff([]bridge.PortWriteStats{
+		{LinkAddress: linkAddr1, Errors: 3, DroppedPackets: 6},
+		{LinkAddress: linkAddr2, Errors: 1, DroppedPackets: 1},
+		{LinkAddress: linkAddr3, Errors: 1, DroppedPackets: 1},
+	}, bridgeEP.PortWriteStats()); diff != "" {
+		t.Errorf("PortWriteStats() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+// Package ratelimit provides a link endpoint that shapes outgoing traffic with
+// a token bucket.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/sync"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/nested"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// DefaultMaxDelay is the longest a packet is held back when a Limit doesn't
+// specify MaxDelay.
+const DefaultMaxDelay = 100 * time.Millisecond
+
+var _ stack.LinkEndpoint = (*Endpoint)(nil)
+var _ stack.GSOEndpoint = (*Endpoint)(nil)
+var _ stack.NetworkDispatcher = (*Endpoint)(nil)
+
+// Limit is the rate at which an Endpoint lets packets through.
+type Limit struct {
+	// BytesPerSecond is the sustained rate. Zero disables rate limiting.
+	BytesPerSecond uint64
+	// BurstBytes is the number of bytes that may be sent at once after the
+	// link has been idle.
+	BurstBytes uint64
+	// MaxDelay is the longest a packet is held back before being sent.
+	// Packets that would have to wait longer are dropped. Zero means
+	// DefaultMaxDelay.
+	MaxDelay time.Duration
+}
+
+func (l Limit) String() string {
+	if l.BytesPerSecond == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d,%d,%s", l.BytesPerSecond, l.BurstBytes, l.maxDelay())
+}
+
+func (l Limit) maxDelay() time.Duration {
+	if l.MaxDelay == 0 {
+		return DefaultMaxDelay
+	}
+	return l.MaxDelay
+}
+
+// ParseLimit parses a limit of the form bytesPerSecond,burstBytes[,maxDelay],
+// e.g. "125000,16384" or "125000,16384,50ms".
+func ParseLimit(s string) (Limit, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 && len(parts) != 3 {
+		return Limit{}, fmt.Errorf("%q is not of the form bytesPerSecond,burstBytes[,maxDelay]", s)
+	}
+	var l Limit
+	var err error
+	if l.BytesPerSecond, err = strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 64); err != nil {
+		return Limit{}, fmt.Errorf("invalid rate: %w", err)
+	}
+	if l.BurstBytes, err = strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64); err != nil {
+		return Limit{}, fmt.Errorf("invalid burst: %w", err)
+	}
+	if len(parts) == 3 {
+		if l.MaxDelay, err = time.ParseDuration(strings.TrimSpace(parts[2])); err != nil {
+			return Limit{}, fmt.Errorf("invalid maximum delay: %w", err)
+		}
+		if l.MaxDelay < 0 {
+			return Limit{}, fmt.Errorf("negative maximum delay %s", l.MaxDelay)
+		}
+	}
+	return l, nil
+}
+
+// Stats counts packets affected by rate limiting.
+type Stats struct {
+	// Delayed counts packets that were queued before being sent.
+	Delayed tcpip.StatCounter
+	// Dropped counts packets that were dropped because they would have been
+	// queued for longer than the limit's MaxDelay.
+	Dropped tcpip.StatCounter
+}
+
+// queuedPacket is a packet held back until the token bucket has refilled
+// enough to send it.
+type queuedPacket struct {
+	pkt stack.PacketBufferPtr
+	at  tcpip.MonotonicTime
+}
+
+// Endpoint is a link endpoint that limits the rate of packets written to the
+// endpoint it wraps. Packets are held back in a queue that is drained from a
+// timer once the token bucket has refilled enough to send them; writers are
+// never blocked.
+type Endpoint struct {
+	nested.Endpoint
+
+	clock tcpip.Clock
+	stats Stats
+
+	mu struct {
+		sync.Mutex
+		limit Limit
+		// tokens is the number of bytes that may be sent without waiting. It
+		// is negative while packets are waiting for the bucket to refill.
+		tokens float64
+		last   tcpip.MonotonicTime
+		// queue holds the packets waiting to be sent, in the order they were
+		// written.
+		queue []queuedPacket
+		// timer drains queue; it is nil while no drain is scheduled.
+		timer tcpip.Timer
+	}
+}
+
+// New returns an Endpoint wrapping lower that doesn't limit traffic until
+// SetLimit is called.
+func New(lower stack.LinkEndpoint, clock tcpip.Clock) *Endpoint {
+	e := &Endpoint{
+		clock: clock,
+	}
+	e.Endpoint.Init(lower, e)
+	return e
+}
+
+// SetLimit changes the limit of the endpoint. The token bucket starts out
+// full. Packets that are already queued are sent as previously scheduled.
+func (e *Endpoint) SetLimit(l Limit) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mu.limit = l
+	e.mu.tokens = float64(l.BurstBytes)
+	e.mu.last = e.clock.NowMonotonic()
+}
+
+// Limit returns the current limit of the endpoint.
+func (e *Endpoint) Limit() Limit {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.mu.limit
+}
+
+// Stats returns the endpoint's counters.
+func (e *Endpoint) Stats() *Stats {
+	return &e.stats
+}
+
+// Attach implements stack.LinkEndpoint.Attach.
+//
+// Detaching the endpoint, as happens when its NIC is removed, stops the timer
+// and drops the queued packets, so that neither outlives the NIC.
+func (e *Endpoint) Attach(dispatcher stack.NetworkDispatcher) {
+	e.Endpoint.Attach(dispatcher)
+	if dispatcher != nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.mu.timer != nil {
+		e.mu.timer.Stop()
+		e.mu.timer = nil
+	}
+	for i := range e.mu.queue {
+		e.mu.queue[i].pkt.DecRef()
+		e.stats.Dropped.Increment()
+	}
+	e.mu.queue = nil
+}
+
+// reserveLocked takes size bytes from the token bucket, and returns how long
+// the packet must wait before being sent, or false if it must be dropped.
+func (e *Endpoint) reserveLocked(now tcpip.MonotonicTime, size int) (time.Duration, bool) {
+	l := e.mu.limit
+	if l.BytesPerSecond == 0 {
+		return 0, true
+	}
+	e.mu.tokens += float64(l.BytesPerSecond) * now.Sub(e.mu.last).Seconds()
+	if burst := float64(l.BurstBytes); e.mu.tokens > burst {
+		e.mu.tokens = burst
+	}
+	e.mu.last = now
+
+	tokens := e.mu.tokens - float64(size)
+	if tokens >= 0 {
+		e.mu.tokens = tokens
+		return 0, true
+	}
+	wait := time.Duration(-tokens / float64(l.BytesPerSecond) * float64(time.Second))
+	if wait > l.maxDelay() {
+		return 0, false
+	}
+	e.mu.tokens = tokens
+	return wait, true
+}
+
+// scheduleLocked arms the timer to drain the head of the queue, if it isn't
+// already armed.
+func (e *Endpoint) scheduleLocked(now tcpip.MonotonicTime) {
+	if e.mu.timer != nil || len(e.mu.queue) == 0 {
+		return
+	}
+	wait := e.mu.queue[0].at.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	e.mu.timer = e.clock.AfterFunc(wait, e.drain)
+}
+
+// drain sends the queued packets that are due, and reschedules itself for
+// the rest.
+func (e *Endpoint) drain() {
+	var pkts stack.PacketBufferList
+	defer pkts.DecRef()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mu.timer = nil
+	now := e.clock.NowMonotonic()
+	i := 0
+	for ; i < len(e.mu.queue) && !e.mu.queue[i].at.After(now); i++ {
+		pkts.PushBack(e.mu.queue[i].pkt)
+		e.mu.queue[i] = queuedPacket{}
+	}
+	e.mu.queue = e.mu.queue[i:]
+	e.scheduleLocked(now)
+
+	// Write with the lock held so packets written concurrently can't
+	// overtake the ones being drained. Errors are dropped, as they would be
+	// had the link itself failed to send the packets asynchronously.
+	if pkts.Len() != 0 {
+		_, _ = e.Endpoint.WritePackets(pkts)
+	}
+}
+
+// WritePackets implements stack.LinkEndpoint.WritePackets.
+//
+// Queued and dropped packets are reported as written, as they would be had
+// the link itself queued or dropped them.
+func (e *Endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	var batch stack.PacketBufferList
+	defer batch.DecRef()
+	queued := 0
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.clock.NowMonotonic()
+	for _, pkt := range pkts.AsSlice() {
+		wait, ok := e.reserveLocked(now, pkt.Size())
+		if !ok {
+			e.stats.Dropped.Increment()
+			queued++
+			continue
+		}
+		// Once a packet is queued, the packets after it are queued too so
+		// they aren't sent out of order.
+		if wait > 0 || len(e.mu.queue) != 0 {
+			e.stats.Delayed.Increment()
+			pkt.IncRef()
+			e.mu.queue = append(e.mu.queue, queuedPacket{pkt: pkt, at: now.Add(wait)})
+			queued++
+			continue
+		}
+		pkt.IncRef()
+		batch.PushBack(pkt)
+	}
+	e.scheduleLocked(now)
+
+	if batch.Len() == 0 {
+		return queued, nil
+	}
+	n, err := e.Endpoint.WritePackets(batch)
+	return n + queued, err
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+func TestParseLimit(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Limit
+	}{
+		{in: "125000,16384", want: Limit{BytesPerSecond: 125000, BurstBytes: 16384}},
+		{in: "1000, 1500, 50ms", want: Limit{BytesPerSecond: 1000, BurstBytes: 1500, MaxDelay: 50 * time.Millisecond}},
+		{in: "0,0", want: Limit{}},
+	} {
+		got, err := ParseLimit(tc.in)
+		if err != nil {
+			t.Errorf("ParseLimit(%q) = %s", tc.in, err)
+		} else if got != tc.want {
+			t.Errorf("got ParseLimit(%q) = %#v, want = %#v", tc.in, got, tc.want)
+		}
+	}
+	for _, in := range []string{"", "1000", "1000,1500,50ms,1", "-1,1500", "1000,x", "1000,1500,-1s"} {
+		if l, err := ParseLimit(in); err == nil {
+			t.Errorf("got ParseLimit(%q) = %s, want error", in, l)
+		}
+	}
+}
+
+func writePackets(t *testing.T, ep *Endpoint, sizes ...int) {
+	t.Helper()
+	var pkts stack.PacketBufferList
+	defer pkts.DecRef()
+	for _, size := range sizes {
+		pkts.PushBack(stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Payload: bufferv2.MakeWithData(make([]byte, size)),
+		}))
+	}
+	if n, err := ep.WritePackets(pkts); err != nil {
+		t.Fatalf("WritePackets(_) = %s", err)
+	} else if n != len(sizes) {
+		t.Fatalf("got WritePackets(_) = %d, want = %d", n, len(sizes))
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	clock := faketime.NewManualClock()
+	lower := channel.New(16, 1500, "")
+	ep := New(lower, clock)
+
+	// Without a limit, packets pass straight through.
+	writePackets(t, ep, 1000, 1000, 1000)
+	if got := lower.Drain(); got != 3 {
+		t.Errorf("got %d packets written without a limit, want = 3", got)
+	}
+
+	ep.SetLimit(Limit{BytesPerSecond: 10000, BurstBytes: 2000, MaxDelay: 150 * time.Millisecond})
+
+	// The burst goes through at once, and the next packet is queued until
+	// the bucket has refilled; the writer isn't blocked.
+	writePackets(t, ep, 1000, 1000, 1000)
+	if got := lower.Drain(); got != 2 {
+		t.Errorf("got %d packets written, want = 2", got)
+	}
+	if got := ep.Stats().Delayed.Value(); got != 1 {
+		t.Errorf("got Delayed = %d, want = 1", got)
+	}
+	clock.Advance(99 * time.Millisecond)
+	if got := lower.Drain(); got != 0 {
+		t.Errorf("got %d packets written before the queued packet is due, want = 0", got)
+	}
+	clock.Advance(time.Millisecond)
+	if got := lower.Drain(); got != 1 {
+		t.Errorf("got %d packets written once the queued packet is due, want = 1", got)
+	}
+
+	// The bucket is empty; a packet that would wait for longer than the
+	// maximum delay is dropped, while a smaller one is queued.
+	writePackets(t, ep, 2000, 1000)
+	if got := ep.Stats().Dropped.Value(); got != 1 {
+		t.Errorf("got Dropped = %d, want = 1", got)
+	}
+	if got := ep.Stats().Delayed.Value(); got != 2 {
+		t.Errorf("got Delayed = %d, want = 2", got)
+	}
+	// Packets written while others are queued are sent after them.
+	clock.Advance(50 * time.Millisecond)
+	writePackets(t, ep, 500)
+	if got := lower.Drain(); got != 0 {
+		t.Errorf("got %d packets written ahead of the queue, want = 0", got)
+	}
+	clock.Advance(100 * time.Millisecond)
+	if got := lower.Drain(); got != 2 {
+		t.Errorf("got %d packets written once the queue is due, want = 2", got)
+	}
+
+	// The bucket refills up to the burst while the link is idle.
+	clock.Advance(time.Second)
+	writePackets(t, ep, 1000, 1000)
+	if got := lower.Drain(); got != 2 {
+		t.Errorf("got %d packets written after the link was idle, want = 2", got)
+	}
+
+	// Removing the limit stops delaying packets.
+	ep.SetLimit(Limit{})
+	writePackets(t, ep, 1000, 1000, 1000)
+	if got := lower.Drain(); got != 3 {
+		t.Errorf("got %d packets written after removing the limit, want = 3", got)
+	}
+	if got := ep.Stats().Delayed.Value(); got != 3 {
+		t.Errorf("got Delayed = %d, want = 3", got)
+	}
+}
+
+func TestEndpointDetach(t *testing.T) {
+	clock := faketime.NewManualClock()
+	lower := channel.New(16, 1500, "")
+	ep := New(lower, clock)
+	ep.SetLimit(Limit{BytesPerSecond: 10000, BurstBytes: 1000})
+
+	writePackets(t, ep, 1000, 500, 500)
+	if got := lower.Drain(); got != 1 {
+		t.Errorf("got %d packets written, want = 1", got)
+	}
+
+	// Detaching drops the queued packets instead of sending them once they
+	// are due.
+	ep.Attach(nil)
+	if got := ep.Stats().Dropped.Value(); got != 2 {
+		t.Errorf("got Dropped = %d, want = 2", got)
+	}
+	clock.Advance(time.Second)
+	if got := lower.Drain(); got != 0 {
+		t.Errorf("got %d packets written after detaching, want = 0", got)
+	}
+}
@@ -16,13 +16,16 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"syscall/zx"
 	"syscall/zx/zxwait"
 	"time"
 
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/dns"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/filter"
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/ratelimit"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/pprof"
 	zxtime "go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/time"
 	tracingprovider "go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/tracing/provider"
@@ -108,13 +111,13 @@ const (
 	// maxTempAddrValidLifetime is the maximum amount of time a temporary SLAAC
 	// address may be valid for from creation.
 	//
-	// As per RFC 4941 section 5, 7 days is the default max valid lifetime.
-	maxTempAddrValidLifetime = 7 * 24 * time.Hour
+	// As per RFC 8981 section 3.8, 2 days is the default max valid lifetime.
+	maxTempAddrValidLifetime = 2 * 24 * time.Hour
 
 	// maxTempAddrPreferredLifetime is the maximum amount of time a temporary
 	// SLAAC address may be preferred for from creation.
 	//
-	// As per RFC 4941 section 5, 1 day is the default max preferred lifetime.
+	// As per RFC 8981 section 3.8, 1 day is the default max preferred lifetime.
 	maxTempAddrPreferredLifetime = 24 * time.Hour
 
 	// regenAdvanceDuration is duration before the deprecation of a temporary
@@ -165,6 +168,46 @@ func (a *atomicBool) String() string {
 	return strconv.FormatBool(a.v.Load() != 0)
 }
 
+// linkRateLimitFlag is a flag.Value that collects rate limits of interfaces by
+// name.
+type linkRateLimitFlag struct {
+	limits map[string]ratelimit.Limit
+}
+
+// Set implements flag.Value.Set.
+func (f *linkRateLimitFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("%q is not of the form name=bytesPerSecond,burstBytes[,maxDelay]", s)
+	}
+	limit, err := ratelimit.ParseLimit(s[i+1:])
+	if err != nil {
+		return err
+	}
+	if f.limits == nil {
+		f.limits = make(map[string]ratelimit.Limit)
+	}
+	f.limits[s[:i]] = limit
+	return nil
+}
+
+// String implements flag.Value.String.
+func (f *linkRateLimitFlag) String() string {
+	names := make([]string, 0, len(f.limits))
+	for name := range f.limits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for i, name := range names {
+		if i != 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(name + "=" + f.limits[name].String())
+	}
+	return b.String()
+}
+
 func init() {
 	// As of this writing the default is 1.
 	sniffer.LogPackets.Store(0)
@@ -266,6 +309,63 @@ func Main() {
 	fastUDP := false
 	flags.BoolVar(&fastUDP, "fast-udp", false, "enable Fast UDP")
 
+	var idleListeners idleListenerPolicy
+	flags.DurationVar(&idleListeners.threshold, "idle-listener-threshold", 0, "report listening sockets that have not accepted a connection for this long; 0 disables reporting")
+	flags.BoolVar(&idleListeners.reap, "reap-idle-listeners", false, "close idle listening sockets whose owner has closed its end of the socket; requires -idle-listener-threshold")
+
+	tunablesProfile := defaultTunablesProfile
+	flags.StringVar(&tunablesProfile, "tunables-profile", defaultTunablesProfile, "set the profile of stack tunables for the product")
+	var tunableOverrides tunableFlag
+	flags.Var(&tunableOverrides, "tunable", "override a stack tunable as name=value, after applying the profile; may be repeated")
+
+	var connectThrottling connectThrottlePolicy
+	flags.DurationVar(&connectThrottling.period, "connect-throttle-period", time.Second, "interval over which outbound connection attempts are rate limited; 0 disables rate limiting")
+	flags.UintVar(&connectThrottling.perDestination, "connect-attempts-per-destination", 0, "maximum outbound connection attempts to a single address and port per period; 0 disables the limit")
+	flags.UintVar(&connectThrottling.perClient, "connect-attempts-per-client", 0, "maximum outbound connection attempts by a single socket provider client per period; 0 disables the limit")
+
+	var icmpErrors icmpErrorPolicy
+	flags.DurationVar(&icmpErrors.period, "icmp-error-throttle-period", time.Second, "interval over which ICMP error messages sent to a destination are rate limited; 0 disables rate limiting")
+	flags.UintVar(&icmpErrors.perDestination, "icmp-errors-per-destination", 0, "maximum ICMP error messages sent to a single address per period; 0 disables the limit")
+	var disabledICMPErrors icmpErrorTypesFlag
+	flags.Var(&disabledICMPErrors, "disable-icmp-error", "never send ICMP errors of the given type: unreachable, packet_too_big, time_exceeded or parameter_problem; may be repeated")
+
+	var specialRoutes specialRoutesFlag
+	flags.Var(&specialRoutes, "special-route", "add a static route that drops matching traffic as prefix,blackhole[,metric], or that rejects it with ICMP destination unreachable as prefix,unreachable[,metric]; may be repeated")
+
+	var addressPolicies addressPolicyFlag
+	flags.Var(&addressPolicies, "ipv6-address-policy", "add an entry to the IPv6 source address selection policy table as prefix,precedence,label; may be repeated. Without any entries, source addresses are chosen by the stack")
+
+	tempAddrDefaults := defaultTempAddrConfig
+	flags.BoolVar(&tempAddrDefaults.enabled, "ipv6-temporary-addresses", defaultTempAddrConfig.enabled, "generate temporary IPv6 addresses as per RFC 8981 alongside the addresses autoconfigured from router advertisements")
+	flags.BoolVar(&tempAddrDefaults.preferTemporary, "ipv6-prefer-temporary-addresses", defaultTempAddrConfig.preferTemporary, "prefer temporary IPv6 addresses over public ones as the source of outgoing connections")
+	flags.DurationVar(&tempAddrDefaults.validLifetime, "ipv6-temporary-address-valid-lifetime", defaultTempAddrConfig.validLifetime, "maximum time a temporary IPv6 address is valid for")
+	flags.DurationVar(&tempAddrDefaults.preferredLifetime, "ipv6-temporary-address-preferred-lifetime", defaultTempAddrConfig.preferredLifetime, "maximum time a temporary IPv6 address is preferred for; a new one is generated before it is deprecated")
+
+	tcpKeepaliveDefaults := defaultTCPKeepalive
+	flags.DurationVar(&tcpKeepaliveDefaults.idle, "tcp-keepalive-idle", defaultTCPKeepalive.idle, "default time a TCP connection is idle before keepalive probes are sent, for sockets that enable SO_KEEPALIVE")
+	flags.DurationVar(&tcpKeepaliveDefaults.interval, "tcp-keepalive-interval", defaultTCPKeepalive.interval, "default time between TCP keepalive probes")
+	flags.UintVar(&tcpKeepaliveDefaults.count, "tcp-keepalive-count", defaultTCPKeepalive.count, "default number of unanswered TCP keepalive probes before a connection is dropped")
+
+	var (
+		tcpDiagnosticsSampleRate uint
+		tcpDiagnosticsRecords    int
+	)
+	flags.UintVar(&tcpDiagnosticsSampleRate, "tcp-diagnostics-sample-rate", 0, "record the state transitions and termination cause of one in every this many TCP connections, exposed in inspect; 0 disables recording")
+	flags.IntVar(&tcpDiagnosticsRecords, "tcp-diagnostics-records", 64, "number of recently closed TCP connections whose diagnostics are kept")
+
+	var virtualInterfaces virtualInterfacesFlag
+	flags.Var(&virtualInterfaces, "virtual-interface", "add a virtual interface on startup as dummy[:name], an interface that drops all packets sent through it, or veth[:name1,name2], a pair of interfaces connected to each other; may be repeated")
+
+	var counterHistory counterHistoryPolicy
+	flags.DurationVar(&counterHistory.period, "counter-history-interval", 0, "interval at which the counters of each interface are sampled and exposed under History in inspect; 0 disables sampling")
+	flags.IntVar(&counterHistory.samples, "counter-history-samples", 60, "number of counter samples kept per interface")
+
+	var linkRateLimits linkRateLimitFlag
+	flags.Var(&linkRateLimits, "link-rate-limit", "limit the rate of outgoing traffic on the named interface as name=bytesPerSecond,burstBytes[,maxDelay]; may be repeated")
+
+	var dhcpServers dhcpServersFlag
+	flags.Var(&dhcpServers, "dhcp-server", "serve DHCPv4 on the named interface as name=addr/prefix,first-last[,leaseLength], adding addr to the interface and leasing the addresses from first to last; may be repeated")
+
 	if err := flags.Parse(os.Args[1:]); err != nil {
 		panic(err)
 	}
@@ -326,6 +426,21 @@ func Main() {
 	if err != nil {
 		panic(fmt.Sprintf("failed to get temp IID seed: %s", err))
 	}
+	if err := tempAddrDefaults.validate(); err != nil {
+		syslog.Fatalf("temporary addresses: %s", err)
+	}
+	ndpConfigs := tempAddrDefaults.ndpConfigurations(ipv6.NDPConfigurations{
+		MaxRtrSolicitations:           maxRtrSolicitations,
+		RtrSolicitationInterval:       rtrSolicitationInterval,
+		MaxRtrSolicitationDelay:       maxRtrSolicitationDelay,
+		HandleRAs:                     handleRAs,
+		DiscoverDefaultRouters:        true,
+		DiscoverMoreSpecificRoutes:    true,
+		DiscoverOnLinkPrefixes:        true,
+		AutoGenGlobalAddresses:        true,
+		AutoGenAddressConflictRetries: autoGenAddressConflictRetries,
+		RegenAdvanceDuration:          regenAdvanceDuration,
+	})
 
 	ndpDisp := newNDPDispatcher()
 	nudDisp := newNudDispatcher()
@@ -346,22 +461,8 @@ func Main() {
 				},
 			}),
 			ipv6.NewProtocolWithOptions(ipv6.Options{
-				DADConfigs: dadConfigs,
-				NDPConfigs: ipv6.NDPConfigurations{
-					MaxRtrSolicitations:           maxRtrSolicitations,
-					RtrSolicitationInterval:       rtrSolicitationInterval,
-					MaxRtrSolicitationDelay:       maxRtrSolicitationDelay,
-					HandleRAs:                     handleRAs,
-					DiscoverDefaultRouters:        true,
-					DiscoverMoreSpecificRoutes:    true,
-					DiscoverOnLinkPrefixes:        true,
-					AutoGenGlobalAddresses:        true,
-					AutoGenAddressConflictRetries: autoGenAddressConflictRetries,
-					AutoGenTempGlobalAddresses:    true,
-					MaxTempAddrValidLifetime:      maxTempAddrValidLifetime,
-					MaxTempAddrPreferredLifetime:  maxTempAddrPreferredLifetime,
-					RegenAdvanceDuration:          regenAdvanceDuration,
-				},
+				DADConfigs:       dadConfigs,
+				NDPConfigs:       ndpConfigs,
 				AutoGenLinkLocal: true,
 				NDPDisp:          ndpDisp,
 				OpaqueIIDOpts:    opaqueIIDOpts,
@@ -385,17 +486,8 @@ func Main() {
 		Clock:                    &zxtime.Clock{},
 	})
 
-	delayEnabled := tcpip.TCPDelayEnabled(true)
-	sackEnabled := tcpip.TCPSACKEnabled(true)
-	moderateReceiveBufferOption := tcpip.TCPModerateReceiveBufferOption(true)
-	for _, opt := range []tcpip.SettableTransportProtocolOption{
-		&delayEnabled,
-		&sackEnabled,
-		&moderateReceiveBufferOption,
-	} {
-		if err := stk.SetTransportProtocolOption(tcp.ProtocolNumber, opt); err != nil {
-			syslog.Fatalf("SetTransportProtocolOption(%d, %#v) failed: %s", tcp.ProtocolNumber, opt, err)
-		}
+	if err := applyTunables(stk, tunablesProfile, tunableOverrides.settings); err != nil {
+		syslog.Fatalf("tunables: %s", err)
 	}
 
 	f := filter.New(stk)
@@ -411,7 +503,26 @@ func Main() {
 		stats:              stats{Stats: stk.Stats()},
 		nicRemovedHandlers: []NICRemovedHandler{&ndpDisp.dynamicAddressSourceTracker, f},
 		featureFlags:       featureFlags{enableFastUDP: fastUDP},
+		linkRateLimits:     linkRateLimits.limits,
+		dhcpServers:        dhcpServers.configs,
+		ndpConfigs:         ndpConfigs,
+		tempAddrDefaults:   tempAddrDefaults,
+	}
+	if connectThrottling.perDestination != 0 || connectThrottling.perClient != 0 {
+		ns.connectThrottle = newConnectThrottle(connectThrottling, stk.Clock(), &ns.stats.ConnectThrottle)
 	}
+	icmpErrors.disabled = disabledICMPErrors.types
+	ns.icmpErrors = newICMPErrorThrottle(icmpErrors, stk.Clock(), &ns.stats.ICMPErrorPolicy)
+	if policies := addressPolicies.policies; len(policies) != 0 {
+		ns.addressPolicy = newAddressPolicyTable(policies)
+	}
+
+	tcpKeepalive, err := newTCPKeepalive(tcpKeepaliveDefaults)
+	if err != nil {
+		syslog.Fatalf("tcp keepalive: %s", err)
+	}
+	ns.tcpKeepalive = tcpKeepalive
+	ns.tcpDiagnostics = newTCPDiagnostics(tcpDiagnosticsSampleRate, tcpDiagnosticsRecords, stk.Clock(), &ns.stats.TCPDiagnostics)
 
 	ns.resetDestinationCache()
 
@@ -446,6 +557,20 @@ func Main() {
 		}
 	}
 
+	// Blackhole routes are installed on the loopback interface, so they can
+	// only be added once it exists.
+	for _, r := range specialRoutes.routes {
+		if err := ns.AddSpecialRoute(r.destination, r.typ, r.metric); err != nil {
+			syslog.Fatalf("special route %s: %s", r, err)
+		}
+	}
+
+	for _, v := range virtualInterfaces.interfaces {
+		if err := v.add(ns); err != nil {
+			syslog.Fatalf("virtual interface %s: %s", v, err)
+		}
+	}
+
 	ndpDisp.start(ctx)
 
 	dnsWatchers := newDnsServerWatcherCollection(ns.dnsConfig.GetServersCacheAndChannel)
@@ -489,11 +614,21 @@ func Main() {
 		Directory: &inspectDirectory{
 			asService: (&inspectImpl{
 				inner: &socketInfoMapInspectImpl{
-					value: &ns.endpoints,
+					value:     &ns.endpoints,
+					listeners: &ns.listeners,
+					clock:     stk.Clock(),
+					clients:   &ns.socketClients,
 				},
 			}).asService,
 		},
 	})
+	componentCtx.OutgoingService.AddDiagnostics("socket-clients", &component.DirectoryWrapper{
+		Directory: &inspectDirectory{
+			asService: (&inspectImpl{
+				inner: &socketClientsInspectImpl{value: &ns.socketClients},
+			}).asService,
+		},
+	})
 	componentCtx.OutgoingService.AddDiagnostics("routes", &component.DirectoryWrapper{
 		Directory: &inspectDirectory{
 			// asService is late-bound so that each call retrieves fresh routing table info.
@@ -504,6 +639,49 @@ func Main() {
 			},
 		},
 	})
+	componentCtx.OutgoingService.AddDiagnostics("tunables", &component.DirectoryWrapper{
+		Directory: &inspectDirectory{
+			// asService is late-bound so that each call retrieves fresh values.
+			asService: func() *component.Service {
+				return (&inspectImpl{
+					inner: &tunablesInspectImpl{value: listTunables(ns.stack)},
+				}).asService()
+			},
+		},
+	})
+	if ns.addressPolicy != nil {
+		componentCtx.OutgoingService.AddDiagnostics("address-policy", &component.DirectoryWrapper{
+			Directory: &inspectDirectory{
+				asService: (&inspectImpl{
+					inner: &addressPolicyInspectImpl{value: ns.addressPolicy},
+				}).asService,
+			},
+		})
+	}
+	componentCtx.OutgoingService.AddDiagnostics("tcp-keepalive", &component.DirectoryWrapper{
+		Directory: &inspectDirectory{
+			asService: (&inspectImpl{
+				inner: &tcpKeepaliveInspectImpl{value: ns.tcpKeepalive},
+			}).asService,
+		},
+	})
+	componentCtx.OutgoingService.AddDiagnostics("tcp-diagnostics", &component.DirectoryWrapper{
+		Directory: &inspectDirectory{
+			asService: (&inspectImpl{
+				inner: &tcpDiagnosticsInspectImpl{value: ns.tcpDiagnostics},
+			}).asService,
+		},
+	})
+	componentCtx.OutgoingService.AddDiagnostics("nat", &component.DirectoryWrapper{
+		Directory: &inspectDirectory{
+			asService: func() *component.Service {
+				rules, generation := f.NATRules()
+				return (&inspectImpl{
+					inner: &natInspectImpl{rules: rules, generation: generation},
+				}).asService()
+			},
+		},
+	})
 	componentCtx.OutgoingService.AddDiagnostics("memstats", &component.DirectoryWrapper{
 		Directory: &inspectDirectory{
 			// asService is late-bound so that each call retrieves fresh stats.
@@ -530,6 +708,13 @@ func Main() {
 	// before a reboot.
 	startPersistClient(ctx, componentCtx, stk.Clock())
 
+	// Periodically report, and optionally close, leaked listening sockets.
+	ns.startIdleListenerMonitor(ctx, idleListeners)
+
+	// Periodically sample interface counters so rates can be computed from a
+	// single inspect snapshot.
+	ns.startCounterHistory(ctx, counterHistory)
+
 	{
 		stub := netstack.NetstackWithCtxStub{Impl: &netstackImpl{ns: ns}}
 		componentCtx.OutgoingService.AddService(
@@ -581,45 +766,59 @@ func Main() {
 	}
 
 	{
-		stub := socket.ProviderWithCtxStub{Impl: &providerImpl{ns: ns}}
 		componentCtx.OutgoingService.AddService(
 			socket.ProviderName,
 			func(ctx context.Context, c zx.Channel) error {
-				go component.Serve(ctx, &stub, c, component.ServeOptions{
-					OnError: func(err error) {
-						_ = syslog.WarnTf(socket.ProviderName, "%s", err)
-					},
-				})
+				// Each connection is a separate client to the connect throttle
+				// and in the socket statistics.
+				client := ns.socketClients.connect(c)
+				stub := socket.ProviderWithCtxStub{Impl: &providerImpl{ns: ns, connectClient: ns.connectThrottle.newClient(), client: client}}
+				go func() {
+					component.Serve(ctx, &stub, c, component.ServeOptions{
+						OnError: func(err error) {
+							_ = syslog.WarnTf(socket.ProviderName, "%s", err)
+						},
+					})
+					ns.socketClients.disconnect(client)
+				}()
 				return nil
 			},
 		)
 	}
 
 	{
-		stub := rawsocket.ProviderWithCtxStub{Impl: &rawProviderImpl{ns: ns}}
 		componentCtx.OutgoingService.AddService(
 			rawsocket.ProviderName,
 			func(ctx context.Context, c zx.Channel) error {
-				go component.Serve(ctx, &stub, c, component.ServeOptions{
-					OnError: func(err error) {
-						_ = syslog.WarnTf(rawsocket.ProviderName, "%s", err)
-					},
-				})
+				client := ns.socketClients.connect(c)
+				stub := rawsocket.ProviderWithCtxStub{Impl: &rawProviderImpl{ns: ns, client: client}}
+				go func() {
+					component.Serve(ctx, &stub, c, component.ServeOptions{
+						OnError: func(err error) {
+							_ = syslog.WarnTf(rawsocket.ProviderName, "%s", err)
+						},
+					})
+					ns.socketClients.disconnect(client)
+				}()
 				return nil
 			},
 		)
 	}
 
 	{
-		stub := packetsocket.ProviderWithCtxStub{Impl: &packetProviderImpl{ns: ns}}
 		componentCtx.OutgoingService.AddService(
 			packetsocket.ProviderName,
 			func(ctx context.Context, c zx.Channel) error {
-				go component.Serve(ctx, &stub, c, component.ServeOptions{
-					OnError: func(err error) {
-						_ = syslog.WarnTf(packetsocket.ProviderName, "%s", err)
-					},
-				})
+				client := ns.socketClients.connect(c)
+				stub := packetsocket.ProviderWithCtxStub{Impl: &packetProviderImpl{ns: ns, client: client}}
+				go func() {
+					component.Serve(ctx, &stub, c, component.ServeOptions{
+						OnError: func(err error) {
+							_ = syslog.WarnTf(packetsocket.ProviderName, "%s", err)
+						},
+					})
+					ns.socketClients.disconnect(client)
+				}()
 				return nil
 			},
 		)
@@ -19,6 +19,7 @@ import (
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/bridge"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/eth"
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/ratelimit"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/routes"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/sync"
 	zxtime "go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/time"
@@ -85,6 +86,11 @@ type stats struct {
 		DHCPv6ManagedAddressOnly            tcpip.StatCounter
 		GlobalSLAACAndDHCPv6ManagedAddress  tcpip.StatCounter
 	}
+	ConnectThrottle connectThrottleStats
+	AddressPolicy   addressPolicyStats
+	SocketOptions   socketOptionStats
+	ICMPErrorPolicy icmpErrorPolicyStats
+	TCPDiagnostics  tcpDiagnosticsStats
 }
 
 // endpointsMap is a map from a monotonically increasing uint64 value to tcpip.Endpoint.
@@ -161,8 +167,53 @@ type Netstack struct {
 
 	endpoints endpointsMap
 
+	// listeners tracks accept activity of listening stream sockets in
+	// endpoints.
+	listeners listenersMap
+
+	// socketClients tracks the sockets in endpoints by the client that
+	// created them.
+	socketClients socketClientsMap
+
 	nicRemovedHandlers []NICRemovedHandler
 
+	// connectThrottle rate limits outbound connection attempts. It may be
+	// nil, in which case attempts are never throttled.
+	connectThrottle *connectThrottle
+
+	// icmpErrors enforces the ICMP error policy on every interface. It may be
+	// nil, in which case all errors the stack generates are sent.
+	icmpErrors *icmpErrorThrottle
+
+	// linkRateLimits holds the rate limits of interfaces by name, applied
+	// when the interface is added.
+	linkRateLimits map[string]ratelimit.Limit
+
+	// dhcpServers holds the configurations of DHCP servers by the name of
+	// the interface they serve, started when the interface is added.
+	dhcpServers map[string]dhcpServerConfig
+
+	// addressPolicy selects IPv6 source addresses for connecting sockets. It
+	// may be nil, in which case the stack's choice is always used.
+	addressPolicy *addressPolicyTable
+
+	// tcpKeepalive holds the keepalive defaults of new TCP sockets. It may be
+	// nil, in which case sockets keep the stack's defaults.
+	tcpKeepalive *tcpKeepalive
+
+	// tcpDiagnostics records the state transitions and terminations of a
+	// sample of TCP connections. It may be nil, in which case no connection
+	// is sampled.
+	tcpDiagnostics *tcpDiagnostics
+
+	// ndpConfigs holds the NDP configurations that the stack gives new
+	// interfaces, which tempAddrDefaults is part of.
+	ndpConfigs ipv6.NDPConfigurations
+
+	// tempAddrDefaults is the temporary address configuration of new
+	// interfaces.
+	tempAddrDefaults tempAddrConfig
+
 	featureFlags featureFlags
 }
 
@@ -207,6 +258,16 @@ type ifState struct {
 			// Used to restart the DHCP client when we go from down to up.
 			enabled bool
 		}
+		// dhcpServer is the DHCP server serving the interface's clients, if
+		// any.
+		dhcpServer struct {
+			*dhcp.Server
+			// cancel stops the server. It is nil iff Server is nil.
+			cancel context.CancelFunc
+		}
+		// tempAddrConfig configures the interface's temporary IPv6
+		// addresses.
+		tempAddrConfig tempAddrConfig
 	}
 
 	// metric is used by default for routes that originate from this NIC.
@@ -227,6 +288,13 @@ type ifState struct {
 
 	bridgeable *bridge.BridgeableEndpoint
 
+	// rateLimiter shapes the traffic sent on the interface. It is nil unless
+	// a limit is configured for the interface.
+	rateLimiter *ratelimit.Endpoint
+
+	// counterHistory holds periodic samples of the interface's counters.
+	counterHistory counterHistory
+
 	// TODO(https://fxbug.dev/86665): Bridged interfaces are disabled within
 	// gVisor upon creation and thus the bridge must keep track of them
 	// in order to re-enable them when the bridge is removed. This is a
@@ -434,6 +502,45 @@ func (ns *Netstack) DelRoute(r tcpip.Route) []routes.ExtendedRoute {
 	}
 }
 
+// AddSpecialRoute adds a static route of type typ, which must be
+// routes.RouteTypeBlackhole or routes.RouteTypeUnreachable, for destination.
+func (ns *Netstack) AddSpecialRoute(destination tcpip.Subnet, typ routes.RouteType, metric routes.Metric) error {
+	r, err := ns.specialRoute(destination, typ)
+	if err != nil {
+		return err
+	}
+	_ = syslog.Infof("adding %s route [%s] metric=%d", typ, destination, metric)
+
+	ns.routeTable.Lock()
+	defer ns.routeTable.Unlock()
+
+	ns.routeTable.AddSpecialRouteLocked(r, typ, metric)
+	ns.routeTable.UpdateStackLocked(ns.stack, ns.resetDestinationCache)
+	return nil
+}
+
+// specialRoute returns the route under which a route of type typ for
+// destination is stored in the route table.
+func (ns *Netstack) specialRoute(destination tcpip.Subnet, typ routes.RouteType) (tcpip.Route, error) {
+	r := tcpip.Route{Destination: destination}
+	switch typ {
+	case routes.RouteTypeBlackhole:
+		// Traffic routed to the loopback interface that is not addressed to it is
+		// dropped, as loopback never forwards.
+		for nicid, nicInfo := range ns.stack.NICInfo() {
+			if nicInfo.Flags.Loopback {
+				r.NIC = nicid
+				return r, nil
+			}
+		}
+		return tcpip.Route{}, fmt.Errorf("no loopback interface for %s route: %w", typ, routes.ErrNoSuchNIC)
+	case routes.RouteTypeUnreachable:
+		return r, nil
+	default:
+		return tcpip.Route{}, fmt.Errorf("unsupported route type %s", typ)
+	}
+}
+
 // GetExtendedRouteTable returns a copy of the current extended route table.
 func (ns *Netstack) GetExtendedRouteTable() []routes.ExtendedRoute {
 	return ns.routeTable.GetExtendedRouteTable()
@@ -811,6 +918,10 @@ func (ifs *ifState) onDownLocked(name string, closed bool) {
 	_ = ifs.ns.delRouteLocked(ipv6LinkLocalOnLinkRoute(ifs.nicid))
 
 	if closed {
+		if cancel := ifs.mu.dhcpServer.cancel; cancel != nil {
+			cancel()
+		}
+
 		switch err := ifs.ns.stack.RemoveNIC(ifs.nicid); err.(type) {
 		case nil:
 			ifs.ns.resetDestinationCache()
@@ -1049,6 +1160,7 @@ func (ns *Netstack) addLoopback() error {
 
 	ifs.mu.Lock()
 	nicid := ifs.nicid
+	ifs.mu.tempAddrConfig = tempAddrConfig{}
 	ifs.mu.Unlock()
 
 	// Loopback interfaces do not need NDP or DAD.
@@ -1187,6 +1299,38 @@ func (ns *Netstack) Bridge(nics []tcpip.NICID) (*ifState, error) {
 	return ifs, err
 }
 
+// SetBridgeVLANs enables VLAN filtering on the bridge with the given NIC ID,
+// so that frames are only forwarded between the bridged interfaces that are
+// members of their VLAN. pvid is the VLAN of the bridge's own interface, and
+// ports holds the VLAN membership of bridged interfaces by NIC ID; the others
+// are untagged members of bridge.DefaultVLAN.
+func (ns *Netstack) SetBridgeVLANs(nicid tcpip.NICID, pvid uint16, ports map[tcpip.NICID]bridge.PortVLANs) error {
+	nicInfos := ns.stack.NICInfo()
+	nicInfo, ok := nicInfos[nicid]
+	if !ok {
+		return fmt.Errorf("failed to find NIC %d", nicid)
+	}
+	b, ok := nicInfo.Context.(*ifState).controller.(*bridge.Endpoint)
+	if !ok {
+		return fmt.Errorf("NIC %d is not a bridge", nicid)
+	}
+	config := bridge.VLANConfig{
+		PVID:  pvid,
+		Ports: make(map[*bridge.BridgeableEndpoint]bridge.PortVLANs, len(ports)),
+	}
+	for id, vlans := range ports {
+		nicInfo, ok := nicInfos[id]
+		if !ok {
+			return fmt.Errorf("failed to find NIC %d", id)
+		}
+		config.Ports[nicInfo.Context.(*ifState).bridgeable] = vlans
+	}
+	if err := b.SetVLANFiltering(&config); err != nil {
+		return fmt.Errorf("NIC %d: %w", nicid, err)
+	}
+	return nil
+}
+
 func makeEndpointName(prefix, configName string) func(nicid tcpip.NICID) string {
 	return func(nicid tcpip.NICID) string {
 		if len(configName) == 0 {
@@ -1241,6 +1385,7 @@ func (ns *Netstack) addEndpoint(
 
 	ifs.mu.dhcp.running = func() bool { return false }
 	ifs.mu.dhcp.cancelLocked = func() {}
+	ifs.mu.tempAddrConfig = ns.tempAddrDefaults
 
 	ns.mu.Lock()
 	ifs.nicid = ns.mu.countNIC + 1
@@ -1252,7 +1397,18 @@ func (ns *Netstack) addEndpoint(
 	// Put sniffer as close as the NIC.
 	// A wrapper LinkEndpoint should encapsulate the underlying
 	// one, and manifest itself to 3rd party netstack.
-	ifs.bridgeable = bridge.NewEndpoint(sniffer.NewWithPrefix(packetsocket.New(ep), fmt.Sprintf("[%s(id=%d)] ", name, ifs.nicid)))
+	// The rate limiter sits above the sniffer so that dropped packets aren't
+	// captured.
+	ep = sniffer.NewWithPrefix(packetsocket.New(ep), fmt.Sprintf("[%s(id=%d)] ", name, ifs.nicid))
+	if limit, ok := ns.linkRateLimits[name]; ok {
+		ifs.rateLimiter = ratelimit.New(ep, ns.stack.Clock())
+		ifs.rateLimiter.SetLimit(limit)
+		ep = ifs.rateLimiter
+		_ = syslog.Infof("NIC %s: limiting outgoing traffic to %s", name, limit)
+	}
+	// ICMP errors are filtered above the rate limiter so that those the policy
+	// drops don't use up the interface's rate.
+	ifs.bridgeable = bridge.NewEndpoint(ns.icmpErrors.wrap(ep))
 	ep = ifs.bridgeable
 	ifs.endpoint = ep
 
@@ -1279,6 +1435,14 @@ func (ns *Netstack) addEndpoint(
 
 	ns.onInterfaceAddLocked(ifs, name)
 
+	if config, ok := ns.dhcpServers[name]; ok {
+		if err := ifs.startDHCPServerLocked(config); err != nil {
+			_ = syslog.Errorf("NIC %s: failed to start DHCP server: %s", name, err)
+		} else {
+			_ = syslog.Infof("NIC %s: serving DHCP as %s", name, config)
+		}
+	}
+
 	return ifs, nil
 }
 
@@ -1300,11 +1464,18 @@ func (ns *Netstack) getIfStateInfo(nicInfo map[tcpip.NICID]stack.NICInfo) map[tc
 			dnsServers:  dnsServers,
 			dhcpEnabled: ifs.mu.dhcp.enabled,
 		}
+		if !ni.Flags.Loopback {
+			config := ifs.mu.tempAddrConfig
+			info.tempAddrConfig = &config
+			info.temporaryAddresses = ns.temporaryAddresses(id)
+		}
 		if ifs.mu.dhcp.enabled {
 			info.dhcpInfo = ifs.mu.dhcp.Info()
 			info.dhcpStats = ifs.mu.dhcp.Stats()
 			info.dhcpStateRecentHistory = ifs.mu.dhcp.StateRecentHistory()
+			info.dhcpStateTransitions = ifs.mu.dhcp.StateTransitions()
 		}
+		info.dhcpServer = ifs.mu.dhcpServer.Server
 
 		for _, network := range []tcpip.NetworkProtocolNumber{header.IPv4ProtocolNumber, header.IPv6ProtocolNumber} {
 			{
@@ -1334,6 +1505,8 @@ func (ns *Netstack) getIfStateInfo(nicInfo map[tcpip.NICID]stack.NICInfo) map[tc
 
 		ifs.mu.Unlock()
 		info.controller = ifs.controller
+		info.rateLimiter = ifs.rateLimiter
+		info.counterHistory = ifs.counterHistory.snapshot()
 		ifStates[id] = info
 	}
 	return ifStates
@@ -29,7 +29,9 @@ import (
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/dhcp"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/dns"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/fidlconv"
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/bridge"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/eth/testutil"
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/link/ratelimit"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/routes"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/sync"
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/util"
@@ -797,6 +799,30 @@ func TestNICName(t *testing.T) {
 	}
 }
 
+func TestLinkRateLimit(t *testing.T) {
+	addGoleakCheck(t)
+	ns, _ := newNetstack(t, netstackTestOptions{})
+	const name = "limited"
+	limit := ratelimit.Limit{BytesPerSecond: 125000, BurstBytes: 16384}
+	ns.linkRateLimits = map[string]ratelimit.Limit{name: limit}
+
+	limited := addNoopEndpoint(t, ns, name)
+	t.Cleanup(limited.RemoveByUser)
+	if limited.rateLimiter == nil {
+		t.Fatalf("NIC %s has no rate limiter", name)
+	}
+	if got := limited.rateLimiter.Limit(); got != limit {
+		t.Errorf("got NIC %s limit = %s, want = %s", name, got, limit)
+	}
+
+	// Interfaces without a limit aren't wrapped in a rate limiter.
+	unlimited := addNoopEndpoint(t, ns, "")
+	t.Cleanup(unlimited.RemoveByUser)
+	if unlimited.rateLimiter != nil {
+		t.Errorf("got NIC %d rate limiter with limit %s, want none", unlimited.nicid, unlimited.rateLimiter.Limit())
+	}
+}
+
 func TestNotStartedByDefault(t *testing.T) {
 	addGoleakCheck(t)
 	ns, _ := newNetstack(t, netstackTestOptions{})
@@ -1447,6 +1473,47 @@ func TestAddRouteParameterValidation(t *testing.T) {
 	}
 }
 
+func TestSetBridgeVLANs(t *testing.T) {
+	addGoleakCheck(t)
+	ns, _ := newNetstack(t, netstackTestOptions{})
+	ifs1 := addLinkEndpoint(t, ns, "ep1", &noopEndpoint{linkAddress: "\x02\x03\x04\x05\x06\x07"})
+	t.Cleanup(ifs1.RemoveByUser)
+	ifs2 := addLinkEndpoint(t, ns, "ep2", &noopEndpoint{linkAddress: "\x02\x03\x04\x05\x06\x08"})
+	t.Cleanup(ifs2.RemoveByUser)
+	br, err := ns.Bridge([]tcpip.NICID{ifs1.nicid, ifs2.nicid})
+	if err != nil {
+		t.Fatalf("ns.Bridge(_) = %s", err)
+	}
+	t.Cleanup(br.RemoveByUser)
+
+	if err := ns.SetBridgeVLANs(ifs1.nicid, 10, nil); err == nil {
+		t.Errorf("got ns.SetBridgeVLANs(%d, _, _) = nil for a NIC that isn't a bridge, want error", ifs1.nicid)
+	}
+	if err := ns.SetBridgeVLANs(br.nicid, 10, map[tcpip.NICID]bridge.PortVLANs{ifs1.nicid + 100: {PVID: 10}}); err == nil {
+		t.Errorf("got ns.SetBridgeVLANs(%d, _, _) = nil for an unknown port, want error", br.nicid)
+	}
+
+	mtu := func() uint32 {
+		t.Helper()
+		nicInfo, ok := ns.stack.NICInfo()[br.nicid]
+		if !ok {
+			t.Fatalf("failed to find NIC %d", br.nicid)
+		}
+		return nicInfo.MTU
+	}
+	untaggedMTU := mtu()
+	if err := ns.SetBridgeVLANs(br.nicid, 10, map[tcpip.NICID]bridge.PortVLANs{
+		ifs1.nicid: {PVID: 10},
+		ifs2.nicid: {Tagged: []uint16{10}},
+	}); err != nil {
+		t.Fatalf("ns.SetBridgeVLANs(%d, _, _) = %s", br.nicid, err)
+	}
+	// Frames sent tagged on the second link carry a 4-byte tag.
+	if got, want := mtu(), untaggedMTU-4; got != want {
+		t.Errorf("got bridge MTU = %d, want = %d", got, want)
+	}
+}
+
 func TestDHCPAcquired(t *testing.T) {
 	addGoleakCheck(t)
 	ns, _ := newNetstack(t, netstackTestOptions{})
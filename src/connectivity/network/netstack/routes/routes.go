@@ -58,6 +58,40 @@ const (
 	HighPreference
 )
 
+// RouteType is the action taken on traffic matching a route.
+type RouteType int
+
+const (
+	// RouteTypeUnicast forwards matching traffic through Route.NIC, via
+	// Route.Gateway if set.
+	RouteTypeUnicast RouteType = iota
+
+	// RouteTypeBlackhole silently drops matching traffic. Blackhole routes are
+	// installed on Route.NIC, which is expected to be a loopback interface that
+	// discards traffic not addressed to it.
+	RouteTypeBlackhole
+
+	// RouteTypeUnreachable rejects matching traffic. Unreachable routes are not
+	// bound to an interface; their destination is removed from less specific
+	// routes so that the stack finds no route, failing local sends with a
+	// no-route error and answering forwarded traffic with ICMP destination
+	// unreachable.
+	RouteTypeUnreachable
+)
+
+func (t RouteType) String() string {
+	switch t {
+	case RouteTypeUnicast:
+		return "unicast"
+	case RouteTypeBlackhole:
+		return "blackhole"
+	case RouteTypeUnreachable:
+		return "unreachable"
+	default:
+		return fmt.Sprintf("RouteType(%d)", int(t))
+	}
+}
+
 // ExtendedRoute is a single route that contains the standard tcpip.Route plus
 // additional attributes.
 type ExtendedRoute struct {
@@ -65,6 +99,9 @@ type ExtendedRoute struct {
 	// gvisor.dev/gvisor/pkg lib.
 	Route tcpip.Route
 
+	// Type is the action taken on traffic matching the route.
+	Type RouteType
+
 	// Prf is the preference of the route when comparing routes to the same
 	// destination.
 	Prf Preference
@@ -98,7 +135,14 @@ func (er *ExtendedRoute) Match(addr tcpip.Address) bool {
 
 func (er *ExtendedRoute) String() string {
 	var out strings.Builder
-	fmt.Fprintf(&out, "%s", er.Route)
+	switch er.Type {
+	case RouteTypeUnicast:
+		fmt.Fprintf(&out, "%s", er.Route)
+	case RouteTypeUnreachable:
+		fmt.Fprintf(&out, "%s %s", er.Type, er.Route.Destination)
+	default:
+		fmt.Fprintf(&out, "%s %s", er.Type, er.Route)
+	}
 	if er.MetricTracksInterface {
 		fmt.Fprintf(&out, " metric[if] %d", er.Metric)
 	} else {
@@ -145,7 +189,7 @@ func (rt *RouteTable) dumpLocked() {
 func (rt *RouteTable) HasDefaultRouteLocked(nicid tcpip.NICID) (bool, bool) {
 	var v4, v6 bool
 	for _, er := range rt.routes {
-		if er.Route.NIC == nicid && er.Enabled {
+		if er.Route.NIC == nicid && er.Enabled && er.Type == RouteTypeUnicast {
 			if er.Route.Destination.Equal(header.IPv4EmptySubnet) {
 				v4 = true
 			} else if er.Route.Destination.Equal(header.IPv6EmptySubnet) {
@@ -166,21 +210,39 @@ func (rt *RouteTable) Set(r []ExtendedRoute) {
 func (rt *RouteTable) AddRouteLocked(route tcpip.Route, prf Preference, metric Metric, tracksInterface bool, dynamic bool, enabled bool) {
 	syslog.VLogTf(syslog.DebugVerbosity, tag, "RouteTable:Adding route %s with prf=%d metric=%d, trackIf=%t, dynamic=%t, enabled=%t", route, prf, metric, tracksInterface, dynamic, enabled)
 
-	// First check if the route already exists, and remove it.
-	for i, er := range rt.routes {
-		if er.Route == route {
-			rt.routes = append(rt.routes[:i], rt.routes[i+1:]...)
-			break
-		}
-	}
-
-	newEr := ExtendedRoute{
+	rt.insertLocked(ExtendedRoute{
 		Route:                 route,
 		Prf:                   prf,
 		Metric:                metric,
 		MetricTracksInterface: tracksInterface,
 		Dynamic:               dynamic,
 		Enabled:               enabled,
+	})
+}
+
+// AddSpecialRouteLocked inserts a static route of a type other than
+// RouteTypeUnicast. Blackhole routes must set route.NIC to a loopback
+// interface; unreachable routes must leave route.NIC and route.Gateway unset.
+func (rt *RouteTable) AddSpecialRouteLocked(route tcpip.Route, typ RouteType, metric Metric) {
+	syslog.VLogTf(syslog.DebugVerbosity, tag, "RouteTable:Adding %s route %s with metric=%d", typ, route, metric)
+
+	rt.insertLocked(ExtendedRoute{
+		Route:   route,
+		Type:    typ,
+		Prf:     MediumPreference,
+		Metric:  metric,
+		Enabled: true,
+	})
+}
+
+func (rt *RouteTable) insertLocked(newEr ExtendedRoute) {
+	// First check if the route already exists, and remove it. Routes of
+	// different types may share a destination and interface.
+	for i, er := range rt.routes {
+		if er.Route == newEr.Route && er.Type == newEr.Type {
+			rt.routes = append(rt.routes[:i], rt.routes[i+1:]...)
+			break
+		}
 	}
 
 	// Find the target position for the new route in the table so it remains
@@ -212,6 +274,14 @@ func (rt *RouteTable) AddRoute(route tcpip.Route, prf Preference, metric Metric,
 func (rt *RouteTable) DelRouteLocked(route tcpip.Route) []ExtendedRoute {
 	syslog.VLogTf(syslog.DebugVerbosity, tag, "RouteTable:Deleting route %s", route)
 
+	return rt.delLocked(func(er *ExtendedRoute) bool {
+		// Match any route if Gateway is empty.
+		return er.Route.Destination == route.Destination && er.Route.NIC == route.NIC && (len(route.Gateway) == 0 || er.Route.Gateway == route.Gateway)
+	})
+}
+
+// delLocked removes the routes for which match returns true, returning them.
+func (rt *RouteTable) delLocked(match func(*ExtendedRoute) bool) []ExtendedRoute {
 	var routesDeleted []ExtendedRoute
 	oldTable := rt.routes
 	rt.routes = oldTable[:0]
@@ -219,16 +289,13 @@ func (rt *RouteTable) DelRouteLocked(route tcpip.Route) []ExtendedRoute {
 		// Remove excess route table capacity instead of reusing old capacity.
 		rt.routes = make([]ExtendedRoute, 0, len(oldTable))
 	}
-	for _, er := range oldTable {
-		if er.Route.Destination == route.Destination && er.Route.NIC == route.NIC {
-			// Match any route if Gateway is empty.
-			if len(route.Gateway) == 0 || er.Route.Gateway == route.Gateway {
-				routesDeleted = append(routesDeleted, er)
-				continue
-			}
+	for i := range oldTable {
+		if match(&oldTable[i]) {
+			routesDeleted = append(routesDeleted, oldTable[i])
+			continue
 		}
 		// Not matched, remains in the route table.
-		rt.routes = append(rt.routes, er)
+		rt.routes = append(rt.routes, oldTable[i])
 	}
 
 	if len(routesDeleted) == 0 {
@@ -266,10 +333,19 @@ func (rt *RouteTable) GetExtendedRouteTable() ExtendedRouteTable {
 // UpdateStack updates stack with the current route table.
 func (rt *RouteTable) UpdateStackLocked(stack *stack.Stack, onUpdateSucceeded func()) {
 	t := make([]tcpip.Route, 0, len(rt.routes))
+	var unreachable []tcpip.Subnet
 	for _, er := range rt.routes {
-		if er.Enabled {
-			t = append(t, er.Route)
+		if !er.Enabled {
+			continue
+		}
+		if er.Type == RouteTypeUnreachable {
+			unreachable = append(unreachable, er.Route.Destination)
+			continue
 		}
+		t = append(t, er.Route)
+	}
+	for _, hole := range unreachable {
+		t = excludeSubnet(t, hole)
 	}
 	stack.SetRouteTable(t)
 
@@ -366,13 +442,43 @@ func (rt *RouteTable) FindNIC(addr tcpip.Address) (tcpip.NICID, error) {
 		if util.IsAny(er.Route.Destination.ID()) {
 			continue
 		}
-		if er.Match(addr) && er.Route.NIC > 0 {
+		if er.Match(addr) && er.Route.NIC > 0 && er.Type == RouteTypeUnicast {
 			return er.Route.NIC, nil
 		}
 	}
 	return 0, ErrNoSuchNIC
 }
 
+// excludeSubnet returns t with every address in hole removed from routes that
+// are no more specific than hole. Each such route is replaced in place by the
+// routes covering the remainder of its destination, so the relative order of
+// overlapping routes is preserved. Routes more specific than hole are kept.
+func excludeSubnet(t []tcpip.Route, hole tcpip.Subnet) []tcpip.Route {
+	holeID := hole.ID()
+	out := t[:0:0]
+	for _, r := range t {
+		id := r.Destination.ID()
+		if len(id) != len(holeID) || r.Destination.Prefix() > hole.Prefix() || !r.Destination.Contains(holeID) {
+			out = append(out, r)
+			continue
+		}
+		bits := len(holeID) * 8
+		for prefix := r.Destination.Prefix(); prefix < hole.Prefix(); prefix++ {
+			// The sibling of the hole's ancestor at prefix+1 bits.
+			mask := net.CIDRMask(prefix+1, bits)
+			sibling := net.IP(append([]byte(nil), holeID...)).Mask(mask)
+			sibling[prefix/8] ^= 0x80 >> (prefix % 8)
+			destination, err := tcpip.NewSubnet(tcpip.Address(sibling), tcpip.AddressMask(mask))
+			if err != nil {
+				panic(fmt.Sprintf("tcpip.NewSubnet(%s, %s): %s", sibling, net.IP(mask), err))
+			}
+			r.Destination = destination
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
 func (rt *RouteTable) sortRouteTableLocked() {
 	sort.SliceStable(rt.routes, func(i, j int) bool {
 		return Less(&rt.routes[i], &rt.routes[j])
@@ -406,6 +512,12 @@ func Less(ei, ej *ExtendedRoute) bool {
 		return riPrefix > rjPrefix
 	}
 
+	// Blackhole and unreachable routes win over unicast routes to the same
+	// destination.
+	if riSpecial, rjSpecial := ei.Type != RouteTypeUnicast, ej.Type != RouteTypeUnicast; riSpecial != rjSpecial {
+		return riSpecial
+	}
+
 	// On-link wins.
 	if riOnLink, rjOnLink := len(ri.Gateway) == 0, len(rj.Gateway) == 0; riOnLink != rjOnLink {
 		return riOnLink
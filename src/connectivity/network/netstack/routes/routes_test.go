@@ -620,6 +620,115 @@ func TestGetNetstackTable(t *testing.T) {
 	}
 }
 
+func TestSpecialRoutes(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		special []routes.ExtendedRoute
+		want    []tcpip.Route
+	}{
+		{
+			name: "Blackhole",
+			special: []routes.ExtendedRoute{
+				{Route: createRoute(1, "192.168.1.0/24", ""), Type: routes.RouteTypeBlackhole},
+			},
+			want: []tcpip.Route{
+				createRoute(1, "192.168.1.0/24", ""),
+				createRoute(4, "192.168.1.0/24", ""),
+				createRoute(4, "0.0.0.0/0", "192.168.1.1"),
+			},
+		},
+		{
+			name: "UnreachableCarvesLessSpecific",
+			special: []routes.ExtendedRoute{
+				{Route: createRoute(0, "10.0.0.0/9", ""), Type: routes.RouteTypeUnreachable},
+			},
+			want: []tcpip.Route{
+				createRoute(4, "192.168.1.0/24", ""),
+				createRoute(4, "128.0.0.0/1", "192.168.1.1"),
+				createRoute(4, "64.0.0.0/2", "192.168.1.1"),
+				createRoute(4, "32.0.0.0/3", "192.168.1.1"),
+				createRoute(4, "16.0.0.0/4", "192.168.1.1"),
+				createRoute(4, "0.0.0.0/5", "192.168.1.1"),
+				createRoute(4, "12.0.0.0/6", "192.168.1.1"),
+				createRoute(4, "8.0.0.0/7", "192.168.1.1"),
+				createRoute(4, "11.0.0.0/8", "192.168.1.1"),
+				createRoute(4, "10.128.0.0/9", "192.168.1.1"),
+			},
+		},
+		{
+			name: "UnreachableKeepsMoreSpecific",
+			special: []routes.ExtendedRoute{
+				{Route: createRoute(0, "192.168.0.0/16", ""), Type: routes.RouteTypeUnreachable},
+			},
+			want: []tcpip.Route{
+				createRoute(4, "192.168.1.0/24", ""),
+				createRoute(4, "0.0.0.0/1", "192.168.1.1"),
+				createRoute(4, "128.0.0.0/2", "192.168.1.1"),
+				createRoute(4, "224.0.0.0/3", "192.168.1.1"),
+				createRoute(4, "208.0.0.0/4", "192.168.1.1"),
+				createRoute(4, "200.0.0.0/5", "192.168.1.1"),
+				createRoute(4, "196.0.0.0/6", "192.168.1.1"),
+				createRoute(4, "194.0.0.0/7", "192.168.1.1"),
+				createRoute(4, "193.0.0.0/8", "192.168.1.1"),
+				createRoute(4, "192.0.0.0/9", "192.168.1.1"),
+				createRoute(4, "192.192.0.0/10", "192.168.1.1"),
+				createRoute(4, "192.128.0.0/11", "192.168.1.1"),
+				createRoute(4, "192.176.0.0/12", "192.168.1.1"),
+				createRoute(4, "192.160.0.0/13", "192.168.1.1"),
+				createRoute(4, "192.172.0.0/14", "192.168.1.1"),
+				createRoute(4, "192.170.0.0/15", "192.168.1.1"),
+				createRoute(4, "192.169.0.0/16", "192.168.1.1"),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var tb routes.RouteTable
+			tb.Set([]routes.ExtendedRoute{
+				createExtendedRoute(4, "192.168.1.0/24", "", 100, true, true, true),
+				createExtendedRoute(4, "0.0.0.0/0", "192.168.1.1", 100, true, true, true),
+			})
+			for _, er := range tc.special {
+				tb.AddSpecialRouteLocked(er.Route, er.Type, er.Metric)
+			}
+
+			var dummyStack stack.Stack
+			tb.UpdateStack(&dummyStack, func() {})
+			tableGot := dummyStack.GetRouteTable()
+
+			if len(tableGot) != len(tc.want) {
+				t.Fatalf("got route table\n%s\nwant\n%s", tableGot, tc.want)
+			}
+			for i := range tableGot {
+				if got, want := tableGot[i], tc.want[i]; got != want {
+					t.Errorf("got tableGot[%d] = %s, want = %s", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAddSpecialRouteKeepsOtherTypes(t *testing.T) {
+	unicast := createExtendedRoute(1, "10.0.0.0/8", "", 100, true, true, true)
+	blackhole := routes.ExtendedRoute{
+		Route:   unicast.Route,
+		Type:    routes.RouteTypeBlackhole,
+		Prf:     routes.MediumPreference,
+		Metric:  200,
+		Enabled: true,
+	}
+	var tb routes.RouteTable
+	tb.Set([]routes.ExtendedRoute{unicast})
+
+	// The blackhole route has the same destination and interface as the
+	// unicast route, but doesn't replace it.
+	tb.AddSpecialRouteLocked(blackhole.Route, blackhole.Type, 100)
+	tb.AddSpecialRouteLocked(blackhole.Route, blackhole.Type, blackhole.Metric)
+	want := []routes.ExtendedRoute{unicast, blackhole}
+	if got := tb.GetExtendedRouteTable(); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got route table %v, want %v", got, want)
+	}
+}
+
 func TestFindNIC(t *testing.T) {
 	for _, tc := range []struct {
 		name      string
@@ -0,0 +1,212 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"sort"
+	"sync"
+	"syscall/zx"
+
+	syslog "go.fuchsia.dev/fuchsia/src/lib/syslog/go"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+)
+
+const socketClientsTagName = "socket clients"
+
+// socketClient is a connection to one of the socket providers, through which
+// a client, usually a single component, creates sockets.
+//
+// Zircon doesn't reveal which process holds the other end of a channel, so a
+// client is identified by the koid of its end of the connection, which kernel
+// debug commands can map to the process that holds it.
+//
+// The fields of a socketClient are protected by the mutex of the
+// socketClientsMap that holds it.
+type socketClient struct {
+	koid uint64
+
+	// connections is the number of open connections with koid, which is only
+	// ever more than one when the koid couldn't be retrieved.
+	connections int
+	created     uint64
+	// open holds the client's sockets that are still open, by key.
+	open map[uint64]tcpip.Endpoint
+	// closed holds the traffic of the client's sockets that have closed.
+	closed socketTraffic
+}
+
+// socketTraffic counts the packets sent and received by sockets; for stream
+// sockets, these are TCP segments.
+type socketTraffic struct {
+	packetsSent     uint64
+	packetsReceived uint64
+}
+
+func (t *socketTraffic) add(ep tcpip.Endpoint) {
+	switch stats := ep.Stats().(type) {
+	case *tcp.Stats:
+		t.packetsSent += stats.SegmentsSent.Value()
+		t.packetsReceived += stats.SegmentsReceived.Value()
+	case *tcpip.TransportEndpointStats:
+		t.packetsSent += stats.PacketsSent.Value()
+		t.packetsReceived += stats.PacketsReceived.Value()
+	}
+}
+
+// socketClientSnapshot holds the statistics of a client at a point in time.
+type socketClientSnapshot struct {
+	koid      uint64
+	connected bool
+	created   uint64
+	open      uint64
+	// traffic includes the traffic of the client's open and closed sockets.
+	traffic socketTraffic
+}
+
+// socketClientsMap tracks the sockets created by each client of the socket
+// providers, so that their activity can be rolled up by client.
+//
+// Clients are forgotten once their connections and sockets are all closed.
+type socketClientsMap struct {
+	mu struct {
+		sync.Mutex
+		// clients holds the clients by koid.
+		clients map[uint64]*socketClient
+		// owners holds the client that created each socket, by key.
+		owners map[uint64]*socketClient
+	}
+}
+
+// connect returns the client for a new connection to a socket provider over
+// channel c.
+func (m *socketClientsMap) connect(c zx.Channel) *socketClient {
+	var koid uint64
+	if info, err := c.Handle().GetInfoHandleBasic(); err != nil {
+		_ = syslog.WarnTf(socketClientsTagName, "failed to get the koid of a client: %s", err)
+	} else {
+		koid = uint64(info.RelatedKoid)
+	}
+	return m.connectKoid(koid)
+}
+
+func (m *socketClientsMap) connectKoid(koid uint64) *socketClient {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.mu.clients == nil {
+		m.mu.clients = make(map[uint64]*socketClient)
+		m.mu.owners = make(map[uint64]*socketClient)
+	}
+	client, ok := m.mu.clients[koid]
+	if !ok {
+		client = &socketClient{
+			koid: koid,
+			open: make(map[uint64]tcpip.Endpoint),
+		}
+		m.mu.clients[koid] = client
+	}
+	client.connections++
+	return client
+}
+
+// disconnect records that a connection of client closed.
+func (m *socketClientsMap) disconnect(client *socketClient) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client.connections--
+	m.maybeForgetLocked(client)
+}
+
+func (m *socketClientsMap) maybeForgetLocked(client *socketClient) {
+	if client.connections == 0 && len(client.open) == 0 {
+		delete(m.mu.clients, client.koid)
+	}
+}
+
+// remove records that the socket with the given key closed.
+func (m *socketClientsMap) remove(key uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client, ok := m.mu.owners[key]
+	if !ok {
+		return
+	}
+	delete(m.mu.owners, key)
+	if ep, ok := client.open[key]; ok {
+		client.closed.add(ep)
+		delete(client.open, key)
+	}
+	m.maybeForgetLocked(client)
+}
+
+// owner returns the koid of the client that created the socket with the
+// given key.
+func (m *socketClientsMap) owner(key uint64) (uint64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client, ok := m.mu.owners[key]
+	if !ok {
+		return 0, false
+	}
+	return client.koid, true
+}
+
+// snapshot returns the statistics of the client with the given koid.
+func (m *socketClientsMap) snapshot(koid uint64) (socketClientSnapshot, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client, ok := m.mu.clients[koid]
+	if !ok {
+		return socketClientSnapshot{}, false
+	}
+	s := socketClientSnapshot{
+		koid:      client.koid,
+		connected: client.connections != 0,
+		created:   client.created,
+		open:      uint64(len(client.open)),
+		traffic:   client.closed,
+	}
+	for _, ep := range client.open {
+		s.traffic.add(ep)
+	}
+	return s, true
+}
+
+// koids returns the koids of the clients, in increasing order.
+func (m *socketClientsMap) koids() []uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	koids := make([]uint64, 0, len(m.mu.clients))
+	for koid := range m.mu.clients {
+		koids = append(koids, koid)
+	}
+	sort.Slice(koids, func(i, j int) bool { return koids[i] < koids[j] })
+	return koids
+}
+
+// onClientEndpoint records that client created e, which has been added to the
+// endpoints map. client may be nil if the endpoint wasn't created through a
+// provider connection.
+func (ns *Netstack) onClientEndpoint(client *socketClient, e *endpoint) {
+	if client == nil || e.key == 0 {
+		return
+	}
+	m := &ns.socketClients
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// The endpoint may have been removed already, e.g. if the peer of an
+	// accepted connection reset it. Holding the lock while checking ensures
+	// that it is otherwise removed from client after it is added.
+	if _, ok := ns.endpoints.Load(e.key); !ok {
+		return
+	}
+	e.client = client
+	client.created++
+	client.open[e.key] = e.ep
+	m.mu.owners[e.key] = client
+}
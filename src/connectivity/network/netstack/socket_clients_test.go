@@ -0,0 +1,110 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+func TestSocketClients(t *testing.T) {
+	addGoleakCheck(t)
+
+	ns, _ := newNetstack(t, netstackTestOptions{})
+	newEndpoint := func() *endpoint {
+		t.Helper()
+		ep, err := ns.stack.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, new(waiter.Queue))
+		if err != nil {
+			t.Fatalf("NewEndpoint(%d, %d, _) = %s", udp.ProtocolNumber, ipv4.ProtocolNumber, err)
+		}
+		t.Cleanup(ep.Close)
+		e := &endpoint{ep: ep, ns: ns}
+		ns.onAddEndpoint(e)
+		return e
+	}
+	send := func(e *endpoint, n int) {
+		for i := 0; i < n; i++ {
+			e.ep.Stats().(*tcpip.TransportEndpointStats).PacketsSent.Increment()
+		}
+	}
+	snapshot := func(koid uint64) socketClientSnapshot {
+		t.Helper()
+		s, ok := ns.socketClients.snapshot(koid)
+		if !ok {
+			t.Fatalf("client %d not found", koid)
+		}
+		return s
+	}
+	allowUnexported := cmp.AllowUnexported(socketClientSnapshot{}, socketTraffic{})
+
+	const koid = 1234
+	client := ns.socketClients.connectKoid(koid)
+	e1, e2 := newEndpoint(), newEndpoint()
+	ns.onClientEndpoint(client, e1)
+	ns.onClientEndpoint(client, e2)
+	send(e1, 2)
+	send(e2, 3)
+
+	// An endpoint that was removed before it was attributed to the client is
+	// not counted.
+	removed := newEndpoint()
+	ns.onRemoveEndpoint(removed.key)
+	ns.onClientEndpoint(client, removed)
+
+	for _, e := range []*endpoint{e1, e2} {
+		if got, ok := ns.socketClients.owner(e.key); !ok || got != koid {
+			t.Errorf("got owner(%d) = (%d, %t), want (%d, true)", e.key, got, ok, koid)
+		}
+	}
+	if _, ok := ns.socketClients.owner(removed.key); ok {
+		t.Errorf("removed endpoint %d has an owner", removed.key)
+	}
+	want := socketClientSnapshot{
+		koid:      koid,
+		connected: true,
+		created:   2,
+		open:      2,
+		traffic:   socketTraffic{packetsSent: 5},
+	}
+	if diff := cmp.Diff(want, snapshot(koid), allowUnexported); diff != "" {
+		t.Errorf("snapshot mismatch (-want +got):\n%s", diff)
+	}
+
+	// The traffic of closed sockets is still accounted for.
+	ns.onRemoveEndpoint(e1.key)
+	ns.socketClients.disconnect(client)
+	want.connected = false
+	want.open = 1
+	if diff := cmp.Diff(want, snapshot(koid), allowUnexported); diff != "" {
+		t.Errorf("snapshot mismatch after close (-want +got):\n%s", diff)
+	}
+
+	impl := socketClientsInspectImpl{value: &ns.socketClients}
+	if diff := cmp.Diff([]string{"1234"}, impl.ListChildren()); diff != "" {
+		t.Errorf("ListChildren() mismatch (-want +got):\n%s", diff)
+	}
+	if child := impl.GetChild("1234"); child == nil {
+		t.Errorf("GetChild(%q) = nil", "1234")
+	} else if got, want := len(child.ReadData().Metrics), 4; got != want {
+		t.Errorf("got %d metrics, want %d", got, want)
+	}
+
+	// The client is forgotten once it is disconnected and its sockets are all
+	// closed.
+	ns.onRemoveEndpoint(e2.key)
+	if _, ok := ns.socketClients.snapshot(koid); ok {
+		t.Errorf("client %d is still tracked", koid)
+	}
+	if children := impl.ListChildren(); len(children) != 0 {
+		t.Errorf("got ListChildren() = %s, want none", children)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	inspect "fidl/fuchsia/inspect/deprecated"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// Socket option levels, named after their Linux equivalents.
+const (
+	solSocket = "SOL_SOCKET"
+	solIP     = "SOL_IP"
+	solIPv6   = "SOL_IPV6"
+	solTCP    = "SOL_TCP"
+	solICMPv6 = "SOL_ICMPV6"
+)
+
+type socketOptionKey struct {
+	level, name string
+}
+
+// socketOptionCounters counts the calls accessing a single socket option.
+type socketOptionCounters struct {
+	Get tcpip.StatCounter
+	Set tcpip.StatCounter
+}
+
+// socketOptionStats counts the calls accessing each socket option, keyed by
+// (level, name), so that the options worth implementing or deprecating can be
+// picked based on their usage.
+//
+// The set of options in use is small and quickly stable, so counters are kept
+// in a sync.Map to avoid contention between sockets once they exist.
+//
+// The zero value is ready to use.
+type socketOptionStats struct {
+	// counters maps socketOptionKey to *socketOptionCounters.
+	counters sync.Map
+}
+
+func (s *socketOptionStats) countersFor(level, name string) *socketOptionCounters {
+	key := socketOptionKey{level: level, name: name}
+	if c, ok := s.counters.Load(key); ok {
+		return c.(*socketOptionCounters)
+	}
+	c, _ := s.counters.LoadOrStore(key, &socketOptionCounters{})
+	return c.(*socketOptionCounters)
+}
+
+// get records a call reading the option name at level.
+func (s *socketOptionStats) get(level, name string) {
+	s.countersFor(level, name).Get.Increment()
+}
+
+// set records a call modifying the option name at level.
+func (s *socketOptionStats) set(level, name string) {
+	s.countersFor(level, name).Set.Increment()
+}
+
+// snapshot returns the options accessed at least once, grouped by level.
+func (s *socketOptionStats) snapshot() map[string]map[string]*socketOptionCounters {
+	levels := make(map[string]map[string]*socketOptionCounters)
+	s.counters.Range(func(k, v interface{}) bool {
+		key := k.(socketOptionKey)
+		options, ok := levels[key.level]
+		if !ok {
+			options = make(map[string]*socketOptionCounters)
+			levels[key.level] = options
+		}
+		options[key.name] = v.(*socketOptionCounters)
+		return true
+	})
+	return levels
+}
+
+var _ inspectNode = (*socketOptionStats)(nil)
+
+func (s *socketOptionStats) asInspectInner(name string) inspectInner {
+	return &socketOptionStatsInspectImpl{
+		name:   name,
+		levels: s.snapshot(),
+	}
+}
+
+var _ inspectInner = (*socketOptionStatsInspectImpl)(nil)
+
+// socketOptionStatsInspectImpl exposes the socket options accessed at each
+// level as children, each with Get and Set counters.
+type socketOptionStatsInspectImpl struct {
+	name   string
+	levels map[string]map[string]*socketOptionCounters
+}
+
+func (impl *socketOptionStatsInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+	}
+}
+
+func (impl *socketOptionStatsInspectImpl) ListChildren() []string {
+	children := make([]string, 0, len(impl.levels))
+	for level := range impl.levels {
+		children = append(children, level)
+	}
+	sort.Strings(children)
+	return children
+}
+
+func (impl *socketOptionStatsInspectImpl) GetChild(childName string) inspectInner {
+	options, ok := impl.levels[childName]
+	if !ok {
+		return nil
+	}
+	return &socketOptionLevelInspectImpl{
+		name:    childName,
+		options: options,
+	}
+}
+
+var _ inspectInner = (*socketOptionLevelInspectImpl)(nil)
+
+type socketOptionLevelInspectImpl struct {
+	name    string
+	options map[string]*socketOptionCounters
+}
+
+func (impl *socketOptionLevelInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+	}
+}
+
+func (impl *socketOptionLevelInspectImpl) ListChildren() []string {
+	children := make([]string, 0, len(impl.options))
+	for name := range impl.options {
+		children = append(children, name)
+	}
+	sort.Strings(children)
+	return children
+}
+
+func (impl *socketOptionLevelInspectImpl) GetChild(childName string) inspectInner {
+	if c, ok := impl.options[childName]; ok {
+		return &statCounterInspectImpl{
+			name:  childName,
+			value: reflect.ValueOf(c).Elem(),
+		}
+	}
+	return nil
+}
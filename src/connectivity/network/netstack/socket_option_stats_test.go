@@ -0,0 +1,91 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"reflect"
+	"testing"
+
+	inspect "fidl/fuchsia/inspect/deprecated"
+)
+
+func TestSocketOptionStatsInspectImpl(t *testing.T) {
+	addGoleakCheck(t)
+
+	var s struct {
+		SocketOptions socketOptionStats
+	}
+	for i := 0; i < 3; i++ {
+		s.SocketOptions.set(solSocket, "SO_REUSEADDR")
+	}
+	s.SocketOptions.get(solSocket, "SO_REUSEADDR")
+	s.SocketOptions.get(solSocket, "SO_ERROR")
+	s.SocketOptions.set(solTCP, "TCP_NODELAY")
+
+	v := statCounterInspectImpl{
+		name:  "doesn't matter",
+		value: reflect.ValueOf(&s).Elem(),
+	}
+
+	expected := inspectNodeExpectation{
+		node: inspect.Object{
+			Name: "doesn't matter",
+		},
+		children: []inspectNodeExpectation{
+			{
+				node: inspect.Object{
+					Name: "SocketOptions",
+				},
+				children: []inspectNodeExpectation{
+					{
+						node: inspect.Object{
+							Name: solSocket,
+						},
+						children: []inspectNodeExpectation{
+							{
+								node: inspect.Object{
+									Name: "SO_ERROR",
+									Metrics: []inspect.Metric{
+										{Key: "Get", Value: inspect.MetricValueWithUintValue(1)},
+									},
+								},
+							},
+							{
+								node: inspect.Object{
+									Name: "SO_REUSEADDR",
+									Metrics: []inspect.Metric{
+										{Key: "Get", Value: inspect.MetricValueWithUintValue(1)},
+										{Key: "Set", Value: inspect.MetricValueWithUintValue(3)},
+									},
+								},
+							},
+						},
+					},
+					{
+						node: inspect.Object{
+							Name: solTCP,
+						},
+						children: []inspectNodeExpectation{
+							{
+								node: inspect.Object{
+									Name: "TCP_NODELAY",
+									Metrics: []inspect.Metric{
+										{Key: "Set", Value: inspect.MetricValueWithUintValue(1)},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if err := checkInspectRecurse(&v, expected); err != nil {
+		t.Error(err)
+	}
+}
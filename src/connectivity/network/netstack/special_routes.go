@@ -0,0 +1,94 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/routes"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// specialRouteConfig is a blackhole or unreachable route added at startup.
+type specialRouteConfig struct {
+	destination tcpip.Subnet
+	typ         routes.RouteType
+	metric      routes.Metric
+}
+
+func (c specialRouteConfig) String() string {
+	return fmt.Sprintf("%s,%s,%d", c.destination, c.typ, c.metric)
+}
+
+// parseSpecialRoute parses a route of the form prefix,type[,metric], e.g.
+// "10.0.0.0/8,blackhole" or "2001:db8::/32,unreachable,100".
+func parseSpecialRoute(s string) (specialRouteConfig, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 && len(parts) != 3 {
+		return specialRouteConfig{}, fmt.Errorf("%q is not of the form prefix,type[,metric]", s)
+	}
+	_, ipNet, err := net.ParseCIDR(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return specialRouteConfig{}, err
+	}
+	destination, err := tcpip.NewSubnet(tcpip.Address(ipNet.IP), tcpip.AddressMask(ipNet.Mask))
+	if err != nil {
+		return specialRouteConfig{}, err
+	}
+	var typ routes.RouteType
+	switch t := strings.TrimSpace(parts[1]); t {
+	case routes.RouteTypeBlackhole.String():
+		typ = routes.RouteTypeBlackhole
+	case routes.RouteTypeUnreachable.String():
+		typ = routes.RouteTypeUnreachable
+	default:
+		return specialRouteConfig{}, fmt.Errorf("unsupported route type %q", t)
+	}
+	var metric uint64
+	if len(parts) == 3 {
+		metric, err = strconv.ParseUint(strings.TrimSpace(parts[2]), 10, 32)
+		if err != nil {
+			return specialRouteConfig{}, fmt.Errorf("invalid metric: %w", err)
+		}
+	}
+	return specialRouteConfig{
+		destination: destination,
+		typ:         typ,
+		metric:      routes.Metric(metric),
+	}, nil
+}
+
+// specialRoutesFlag is a flag.Value that collects special routes.
+type specialRoutesFlag struct {
+	routes []specialRouteConfig
+}
+
+// String implements flag.Value.String.
+func (f *specialRoutesFlag) String() string {
+	var b strings.Builder
+	for i, r := range f.routes {
+		if i != 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(r.String())
+	}
+	return b.String()
+}
+
+// Set implements flag.Value.Set.
+func (f *specialRoutesFlag) Set(s string) error {
+	r, err := parseSpecialRoute(s)
+	if err != nil {
+		return err
+	}
+	f.routes = append(f.routes, r)
+	return nil
+}
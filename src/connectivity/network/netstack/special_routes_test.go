@@ -0,0 +1,129 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/routes"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+)
+
+func TestParseSpecialRoute(t *testing.T) {
+	for _, s := range []string{"10.0.0.0/8,blackhole", "2001:db8::/32,unreachable,100", " 0.0.0.0/0 , unreachable , 0 "} {
+		if _, err := parseSpecialRoute(s); err != nil {
+			t.Errorf("parseSpecialRoute(%q) = %s", s, err)
+		}
+	}
+	for _, s := range []string{"", "10.0.0.0/8", "10.0.0.0,blackhole", "10.0.0.0/8,unicast", "10.0.0.0/8,blackhole,-1", "10.0.0.0/8,blackhole,1,2"} {
+		if r, err := parseSpecialRoute(s); err == nil {
+			t.Errorf("parseSpecialRoute(%q) = %s, want error", s, r)
+		}
+	}
+
+	r, err := parseSpecialRoute("10.0.0.0/8,blackhole")
+	if err != nil {
+		t.Fatalf("parseSpecialRoute(_) = %s", err)
+	}
+	if got, want := r.String(), "10.0.0.0/8,blackhole,0"; got != want {
+		t.Errorf("got String() = %s, want = %s", got, want)
+	}
+}
+
+func TestAddSpecialRoute(t *testing.T) {
+	addGoleakCheck(t)
+	ns, _ := newNetstack(t, netstackTestOptions{})
+	ifState := addNoopEndpoint(t, ns, "")
+	t.Cleanup(ifState.RemoveByUser)
+	addAddressAndRoute(t, ns, ifState, tcpip.ProtocolAddress{
+		Protocol: ipv4.ProtocolNumber,
+		AddressWithPrefix: tcpip.AddressWithPrefix{
+			Address:   tcpip.Address("\xf0\xf0\xf0\xf0"),
+			PrefixLen: 24,
+		},
+	})
+	gateway := tcpip.Route{
+		Destination: mustParseSubnet("10.0.0.0/8"),
+		Gateway:     tcpip.Address("\xf0\xf0\xf0\xf1"),
+		NIC:         ifState.nicid,
+	}
+	if err := ns.AddRoute(gateway, metricNotSet, false /* dynamic */); err != nil {
+		t.Fatalf("ns.AddRoute(%s, metricNotSet, false): %s", gateway, err)
+	}
+
+	// Blackhole routes need a loopback interface to be installed on.
+	blackhole := mustParseSubnet("10.2.0.0/16")
+	if err := ns.AddSpecialRoute(blackhole, routes.RouteTypeBlackhole, metricNotSet); !errors.Is(err, routes.ErrNoSuchNIC) {
+		t.Errorf("got ns.AddSpecialRoute(%s, %s, _) = %v, want %s", blackhole, routes.RouteTypeBlackhole, err, routes.ErrNoSuchNIC)
+	}
+	if err := ns.addLoopback(); err != nil {
+		t.Fatalf("ns.addLoopback() = %s", err)
+	}
+	if err := ns.AddSpecialRoute(blackhole, routes.RouteTypeBlackhole, metricNotSet); err != nil {
+		t.Fatalf("ns.AddSpecialRoute(%s, %s, _) = %s", blackhole, routes.RouteTypeBlackhole, err)
+	}
+	unreachable := mustParseSubnet("10.1.0.0/16")
+	if err := ns.AddSpecialRoute(unreachable, routes.RouteTypeUnreachable, metricNotSet); err != nil {
+		t.Fatalf("ns.AddSpecialRoute(%s, %s, _) = %s", unreachable, routes.RouteTypeUnreachable, err)
+	}
+
+	types := make(map[tcpip.Subnet]routes.ExtendedRoute)
+	for _, er := range ns.GetExtendedRouteTable() {
+		if er.Type != routes.RouteTypeUnicast {
+			types[er.Route.Destination] = er
+		}
+	}
+	if er, ok := types[blackhole]; !ok || er.Type != routes.RouteTypeBlackhole || er.Route.NIC == ifState.nicid || er.Route.NIC == 0 {
+		t.Errorf("got route %s for %s, want a blackhole route on the loopback interface", &er, blackhole)
+	}
+	if er, ok := types[unreachable]; !ok || er.Type != routes.RouteTypeUnreachable || er.Route.NIC != 0 {
+		t.Errorf("got route %s for %s, want an unreachable route", &er, unreachable)
+	}
+
+	// Traffic to the unreachable subnet has no route, while the rest of the
+	// gateway's subnet is still routed through it.
+	for _, tc := range []struct {
+		addr    tcpip.Address
+		wantNIC tcpip.NICID
+	}{
+		{addr: tcpip.Address("\x0a\x01\x02\x03")},
+		{addr: tcpip.Address("\x0a\x03\x02\x03"), wantNIC: ifState.nicid},
+	} {
+		r, err := ns.stack.FindRoute(0, "", tc.addr, ipv4.ProtocolNumber, false /* multicastLoop */)
+		if tc.wantNIC == 0 {
+			if err == nil {
+				r.Release()
+				t.Errorf("got FindRoute(_, _, %s, _, _) = nil, want an error", tc.addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("FindRoute(_, _, %s, _, _) = %s", tc.addr, err)
+			continue
+		}
+		if got := r.NICID(); got != tc.wantNIC {
+			t.Errorf("got FindRoute(_, _, %s, _, _).NICID() = %d, want = %d", tc.addr, got, tc.wantNIC)
+		}
+		r.Release()
+	}
+}
+
+func mustParseSubnet(s string) tcpip.Subnet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	subnet, err := tcpip.NewSubnet(tcpip.Address(ipNet.IP), tcpip.AddressMask(ipNet.Mask))
+	if err != nil {
+		panic(err)
+	}
+	return subnet
+}
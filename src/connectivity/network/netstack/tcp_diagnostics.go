@@ -0,0 +1,565 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	syslog "go.fuchsia.dev/fuchsia/src/lib/syslog/go"
+
+	inspect "fidl/fuchsia/inspect/deprecated"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	tcpDiagnosticsTagName = "tcp diagnostics"
+
+	// maxTCPConnTransitions is the number of state transitions recorded per
+	// connection; later transitions replace the last one.
+	maxTCPConnTransitions = 32
+)
+
+// tcpTermination is the way a TCP connection ended.
+type tcpTermination int
+
+const (
+	// tcpTerminationNone is the termination of connections that are still
+	// open.
+	tcpTerminationNone tcpTermination = iota
+	// tcpTerminationClosed is the termination of connections that closed
+	// without error.
+	tcpTerminationClosed
+	// tcpTerminationPeerReset is the termination of connections reset by the
+	// peer.
+	tcpTerminationPeerReset
+	// tcpTerminationRefused is the termination of connections whose peer
+	// reset the handshake.
+	tcpTerminationRefused
+	// tcpTerminationTimeout is the termination of connections that timed
+	// out, e.g. because retransmissions or keepalive probes went unanswered.
+	tcpTerminationTimeout
+	// tcpTerminationLocalAbort is the termination of connections that were
+	// reset locally, e.g. by closing with a zero SO_LINGER timeout.
+	tcpTerminationLocalAbort
+	// tcpTerminationUnreachable is the termination of connections whose peer
+	// became unreachable.
+	tcpTerminationUnreachable
+)
+
+func (t tcpTermination) String() string {
+	switch t {
+	case tcpTerminationNone:
+		return "none"
+	case tcpTerminationClosed:
+		return "closed"
+	case tcpTerminationPeerReset:
+		return "peer_reset"
+	case tcpTerminationRefused:
+		return "refused"
+	case tcpTerminationTimeout:
+		return "timeout"
+	case tcpTerminationLocalAbort:
+		return "local_abort"
+	case tcpTerminationUnreachable:
+		return "unreachable"
+	default:
+		return fmt.Sprintf("tcpTermination(%d)", t)
+	}
+}
+
+// tcpTerminationOf returns the termination of a connection that failed with
+// err, one of the terminal errors of stream sockets.
+func tcpTerminationOf(err tcpip.Error) tcpTermination {
+	switch err.(type) {
+	case nil:
+		return tcpTerminationClosed
+	case *tcpip.ErrConnectionReset:
+		return tcpTerminationPeerReset
+	case *tcpip.ErrConnectionRefused:
+		return tcpTerminationRefused
+	case *tcpip.ErrTimeout:
+		return tcpTerminationTimeout
+	case *tcpip.ErrConnectionAborted:
+		return tcpTerminationLocalAbort
+	case *tcpip.ErrNetworkUnreachable, *tcpip.ErrHostUnreachable:
+		return tcpTerminationUnreachable
+	default:
+		panic(fmt.Sprintf("unexpected terminal error %#v", err))
+	}
+}
+
+// tcpDiagnosticsStats counts the terminations of sampled connections.
+type tcpDiagnosticsStats struct {
+	Sampled     tcpip.StatCounter
+	Closed      tcpip.StatCounter
+	PeerResets  tcpip.StatCounter
+	Refused     tcpip.StatCounter
+	Timeouts    tcpip.StatCounter
+	LocalAborts tcpip.StatCounter
+	Unreachable tcpip.StatCounter
+}
+
+func (s *tcpDiagnosticsStats) counter(t tcpTermination) *tcpip.StatCounter {
+	switch t {
+	case tcpTerminationClosed:
+		return &s.Closed
+	case tcpTerminationPeerReset:
+		return &s.PeerResets
+	case tcpTerminationRefused:
+		return &s.Refused
+	case tcpTerminationTimeout:
+		return &s.Timeouts
+	case tcpTerminationLocalAbort:
+		return &s.LocalAborts
+	case tcpTerminationUnreachable:
+		return &s.Unreachable
+	default:
+		panic(fmt.Sprintf("no counter for termination %s", t))
+	}
+}
+
+type tcpStateTransition struct {
+	at    tcpip.MonotonicTime
+	state tcp.EndpointState
+}
+
+// tcpConnRecord holds the diagnostics of a sampled TCP connection.
+type tcpConnRecord struct {
+	id uint64
+	// local and remote hold the connection's tuple once it is connected.
+	local, remote tcpip.FullAddress
+	transitions   []tcpStateTransition
+	termination   tcpTermination
+	// err is the terminal error of the connection, if any.
+	err tcpip.Error
+}
+
+// tcpDiagnostics records the state transitions and terminations of a sample
+// of TCP connections, so that peer resets, timeouts and local aborts can be
+// told apart.
+//
+// State transitions are observed when the endpoint notifies its waiters, so
+// a state that is left before any notification, such as SYN-SENT on a fast
+// handshake, may be missing.
+type tcpDiagnostics struct {
+	clock tcpip.Clock
+	stats *tcpDiagnosticsStats
+	// sampleRate is the number of new connections per sampled connection;
+	// zero disables sampling.
+	sampleRate uint
+
+	mu struct {
+		sync.Mutex
+		// seen is the number of connections seen.
+		seen   uint
+		nextID uint64
+		// active holds the trackers of open sampled connections by id.
+		active map[uint64]*tcpConnTracker
+		// closed is a ring buffer of the records of the most recently closed
+		// sampled connections.
+		closed []tcpConnRecord
+		// first is the index of the oldest record once closed is full.
+		first    int
+		capacity int
+	}
+}
+
+func newTCPDiagnostics(sampleRate uint, capacity int, clock tcpip.Clock, stats *tcpDiagnosticsStats) *tcpDiagnostics {
+	d := &tcpDiagnostics{
+		clock:      clock,
+		stats:      stats,
+		sampleRate: sampleRate,
+	}
+	d.mu.active = make(map[uint64]*tcpConnTracker)
+	d.mu.capacity = capacity
+	return d
+}
+
+// SampleRate returns the number of new connections per sampled connection.
+func (d *tcpDiagnostics) SampleRate() uint {
+	return d.sampleRate
+}
+
+// track starts recording the diagnostics of the new TCP endpoint ep, whose
+// events are notified on wq, if it is sampled. It returns nil otherwise.
+func (d *tcpDiagnostics) track(ep tcpip.Endpoint, wq *waiter.Queue) *tcpConnTracker {
+	if d == nil {
+		return nil
+	}
+	if d.sampleRate == 0 {
+		return nil
+	}
+	t := func() *tcpConnTracker {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.mu.seen++
+		if d.mu.seen%d.sampleRate != 0 {
+			return nil
+		}
+		d.mu.nextID++
+		t := &tcpConnTracker{
+			d:  d,
+			ep: ep,
+			wq: wq,
+		}
+		t.mu.record.id = d.mu.nextID
+		d.mu.active[t.mu.record.id] = t
+		return t
+	}()
+	if t == nil {
+		return nil
+	}
+	d.stats.Sampled.Increment()
+	t.observe()
+	t.entry = waiter.NewFunctionEntry(waiter.EventIn|waiter.EventOut|waiter.EventErr|waiter.EventHUp, func(waiter.EventMask) {
+		t.observe()
+	})
+	wq.EventRegister(&t.entry)
+	return t
+}
+
+// Records returns the records of the open sampled connections and of the
+// most recently closed ones, both sorted by id.
+func (d *tcpDiagnostics) Records() (active, closed []tcpConnRecord) {
+	d.mu.Lock()
+	trackers := make([]*tcpConnTracker, 0, len(d.mu.active))
+	for _, t := range d.mu.active {
+		trackers = append(trackers, t)
+	}
+	closed = make([]tcpConnRecord, 0, len(d.mu.closed))
+	closed = append(closed, d.mu.closed[d.mu.first:]...)
+	closed = append(closed, d.mu.closed[:d.mu.first]...)
+	d.mu.Unlock()
+
+	active = make([]tcpConnRecord, 0, len(trackers))
+	for _, t := range trackers {
+		t.observeTuple()
+		active = append(active, t.snapshot())
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].id < active[j].id })
+	return active, closed
+}
+
+func (d *tcpDiagnostics) onClosed(record tcpConnRecord) {
+	d.stats.counter(record.termination).Increment()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.mu.active, record.id)
+	if d.mu.capacity <= 0 {
+		return
+	}
+	if len(d.mu.closed) < d.mu.capacity {
+		d.mu.closed = append(d.mu.closed, record)
+		return
+	}
+	d.mu.closed[d.mu.first] = record
+	d.mu.first = (d.mu.first + 1) % len(d.mu.closed)
+}
+
+// tcpConnTracker records the diagnostics of a sampled TCP connection until
+// it closes.
+//
+// The methods of a nil *tcpConnTracker do nothing, so that callers need not
+// check whether their connection is sampled.
+type tcpConnTracker struct {
+	d     *tcpDiagnostics
+	ep    tcpip.Endpoint
+	wq    *waiter.Queue
+	entry waiter.Entry
+
+	mu struct {
+		sync.Mutex
+		record tcpConnRecord
+		// aborted is set when the connection is closed with a zero linger
+		// timeout, which resets it.
+		aborted bool
+		done    bool
+	}
+}
+
+// observe records the endpoint's state if it changed.
+//
+// It is called by waiter callbacks, and must not acquire the endpoint's
+// lock, which may be held by the notifier.
+func (t *tcpConnTracker) observe() {
+	if t == nil {
+		return
+	}
+	state := tcp.EndpointState(t.ep.State())
+	now := t.d.clock.NowMonotonic()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.mu.done {
+		return
+	}
+	r := &t.mu.record
+	if n := len(r.transitions); n == 0 || r.transitions[n-1].state != state {
+		transition := tcpStateTransition{at: now, state: state}
+		if n < maxTCPConnTransitions {
+			r.transitions = append(r.transitions, transition)
+		} else {
+			r.transitions[n-1] = transition
+		}
+	}
+}
+
+// observeTuple records the connection's tuple once it is connected.
+func (t *tcpConnTracker) observeTuple() {
+	t.mu.Lock()
+	known := t.mu.record.remote.Port != 0
+	t.mu.Unlock()
+	if known {
+		return
+	}
+	info, ok := t.ep.Info().(*stack.TransportEndpointInfo)
+	if !ok || info.ID.RemotePort == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mu.record.local = tcpip.FullAddress{NIC: info.BindNICID, Addr: info.ID.LocalAddress, Port: info.ID.LocalPort}
+	t.mu.record.remote = tcpip.FullAddress{Addr: info.ID.RemoteAddress, Port: info.ID.RemotePort}
+}
+
+// onError records the terminal error of the connection.
+func (t *tcpConnTracker) onError(err tcpip.Error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.mu.record.err == nil {
+		t.mu.record.err = err
+	}
+}
+
+// onAbort records that the connection was closed with a zero linger timeout.
+func (t *tcpConnTracker) onAbort() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mu.aborted = true
+}
+
+// finish records the final state and the termination of the connection,
+// which has hung up, and stops tracking it.
+//
+// It must not be called from waiter callbacks.
+func (t *tcpConnTracker) finish() {
+	if t == nil {
+		return
+	}
+	t.observe()
+	t.observeTuple()
+	record, ok := func() (tcpConnRecord, bool) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.mu.done {
+			return tcpConnRecord{}, false
+		}
+		t.mu.done = true
+		r := &t.mu.record
+		switch {
+		case r.err != nil:
+			r.termination = tcpTerminationOf(r.err)
+		case t.mu.aborted:
+			r.termination = tcpTerminationLocalAbort
+		default:
+			r.termination = tcpTerminationClosed
+		}
+		return t.snapshotLocked(), true
+	}()
+	if !ok {
+		return
+	}
+	t.wq.EventUnregister(&t.entry)
+	t.d.onClosed(record)
+	_ = syslog.DebugTf(tcpDiagnosticsTagName, "connection %d from %s to %s ended: %s", record.id, record.local.Addr, record.remote.Addr, record.termination)
+}
+
+func (t *tcpConnTracker) snapshot() tcpConnRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.snapshotLocked()
+}
+
+func (t *tcpConnTracker) snapshotLocked() tcpConnRecord {
+	r := t.mu.record
+	r.transitions = append([]tcpStateTransition(nil), r.transitions...)
+	return r
+}
+
+const (
+	tcpDiagnosticsActiveLabel = "Active"
+	tcpDiagnosticsClosedLabel = "Closed"
+)
+
+var _ inspectInner = (*tcpDiagnosticsInspectImpl)(nil)
+
+type tcpDiagnosticsInspectImpl struct {
+	value *tcpDiagnostics
+}
+
+func (impl *tcpDiagnosticsInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: "TCP Diagnostics",
+		Metrics: []inspect.Metric{
+			{Key: "SampleRate", Value: inspect.MetricValueWithUintValue(uint64(impl.value.SampleRate()))},
+		},
+	}
+}
+
+func (*tcpDiagnosticsInspectImpl) ListChildren() []string {
+	return []string{tcpDiagnosticsActiveLabel, tcpDiagnosticsClosedLabel}
+}
+
+func (impl *tcpDiagnosticsInspectImpl) GetChild(childName string) inspectInner {
+	active, closed := impl.value.Records()
+	switch childName {
+	case tcpDiagnosticsActiveLabel:
+		return &tcpConnRecordsInspectImpl{name: childName, value: active}
+	case tcpDiagnosticsClosedLabel:
+		return &tcpConnRecordsInspectImpl{name: childName, value: closed}
+	default:
+		return nil
+	}
+}
+
+var _ inspectInner = (*tcpConnRecordsInspectImpl)(nil)
+
+// tcpConnRecordsInspectImpl exposes connection records as children keyed by
+// connection id.
+type tcpConnRecordsInspectImpl struct {
+	name  string
+	value []tcpConnRecord
+}
+
+func (impl *tcpConnRecordsInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+	}
+}
+
+func (impl *tcpConnRecordsInspectImpl) ListChildren() []string {
+	children := make([]string, 0, len(impl.value))
+	for _, r := range impl.value {
+		children = append(children, strconv.FormatUint(r.id, 10))
+	}
+	return children
+}
+
+func (impl *tcpConnRecordsInspectImpl) GetChild(childName string) inspectInner {
+	for _, r := range impl.value {
+		if strconv.FormatUint(r.id, 10) == childName {
+			return &tcpConnRecordInspectImpl{name: childName, value: r}
+		}
+	}
+	_ = syslog.VLogTf(syslog.DebugVerbosity, inspect.InspectName, "GetChild(%s): no such connection", childName)
+	return nil
+}
+
+var _ inspectInner = (*tcpConnRecordInspectImpl)(nil)
+
+// tcpConnRecordInspectImpl exposes a connection record, with its state
+// transitions as children keyed by index, oldest first.
+type tcpConnRecordInspectImpl struct {
+	name  string
+	value tcpConnRecord
+}
+
+func (impl *tcpConnRecordInspectImpl) ReadData() inspect.Object {
+	r := impl.value
+	object := inspect.Object{
+		Name: impl.name,
+		Properties: []inspect.Property{
+			{Key: "Termination", Value: inspect.PropertyValueWithStr(r.termination.String())},
+		},
+	}
+	if r.remote.Port != 0 {
+		object.Properties = append(object.Properties,
+			inspect.Property{Key: "LocalAddress", Value: inspect.PropertyValueWithStr(formatTCPConnAddress(r.local))},
+			inspect.Property{Key: "RemoteAddress", Value: inspect.PropertyValueWithStr(formatTCPConnAddress(r.remote))},
+		)
+	}
+	if n := len(r.transitions); n != 0 {
+		object.Properties = append(object.Properties, inspect.Property{
+			Key:   "State",
+			Value: inspect.PropertyValueWithStr(r.transitions[n-1].state.String()),
+		})
+	}
+	if r.err != nil {
+		object.Properties = append(object.Properties, inspect.Property{
+			Key:   "Error",
+			Value: inspect.PropertyValueWithStr(r.err.String()),
+		})
+	}
+	return object
+}
+
+func (impl *tcpConnRecordInspectImpl) ListChildren() []string {
+	children := make([]string, 0, len(impl.value.transitions))
+	for i := range impl.value.transitions {
+		children = append(children, strconv.Itoa(i))
+	}
+	return children
+}
+
+func (impl *tcpConnRecordInspectImpl) GetChild(childName string) inspectInner {
+	index, err := strconv.ParseUint(childName, 10, 64)
+	if err != nil || index >= uint64(len(impl.value.transitions)) {
+		_ = syslog.VLogTf(syslog.DebugVerbosity, inspect.InspectName, "GetChild(%s): no such transition", childName)
+		return nil
+	}
+	return &tcpStateTransitionInspectImpl{
+		name:  childName,
+		value: impl.value.transitions[index],
+	}
+}
+
+var _ inspectInner = (*tcpStateTransitionInspectImpl)(nil)
+
+type tcpStateTransitionInspectImpl struct {
+	name  string
+	value tcpStateTransition
+}
+
+func (impl *tcpStateTransitionInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+		Properties: []inspect.Property{
+			{Key: "@time", Value: inspect.PropertyValueWithStr(strconv.FormatInt(impl.value.at.Sub(tcpip.MonotonicTime{}).Nanoseconds(), 10))},
+			{Key: "State", Value: inspect.PropertyValueWithStr(impl.value.state.String())},
+		},
+	}
+}
+
+func (*tcpStateTransitionInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*tcpStateTransitionInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
+
+func formatTCPConnAddress(addr tcpip.FullAddress) string {
+	if len(addr.Addr) == 16 {
+		return fmt.Sprintf("[%s]:%d", addr.Addr, addr.Port)
+	}
+	return fmt.Sprintf("%s:%d", addr.Addr, addr.Port)
+}
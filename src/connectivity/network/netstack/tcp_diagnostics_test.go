@@ -0,0 +1,208 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+func TestTCPTerminationOf(t *testing.T) {
+	for _, tc := range []struct {
+		err  tcpip.Error
+		want tcpTermination
+	}{
+		{err: nil, want: tcpTerminationClosed},
+		{err: &tcpip.ErrConnectionReset{}, want: tcpTerminationPeerReset},
+		{err: &tcpip.ErrConnectionRefused{}, want: tcpTerminationRefused},
+		{err: &tcpip.ErrTimeout{}, want: tcpTerminationTimeout},
+		{err: &tcpip.ErrConnectionAborted{}, want: tcpTerminationLocalAbort},
+		{err: &tcpip.ErrNetworkUnreachable{}, want: tcpTerminationUnreachable},
+		{err: &tcpip.ErrHostUnreachable{}, want: tcpTerminationUnreachable},
+	} {
+		if got := tcpTerminationOf(tc.err); got != tc.want {
+			t.Errorf("got tcpTerminationOf(%#v) = %s, want = %s", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestTCPDiagnosticsSampling(t *testing.T) {
+	addGoleakCheck(t)
+
+	ns, _ := newNetstack(t, netstackTestOptions{})
+	var stats tcpDiagnosticsStats
+	d := newTCPDiagnostics(2, 0, ns.stack.Clock(), &stats)
+
+	track := func() *tcpConnTracker {
+		t.Helper()
+		wq := new(waiter.Queue)
+		ep, err := ns.stack.NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, wq)
+		if err != nil {
+			t.Fatalf("NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, _) = %s", err)
+		}
+		t.Cleanup(ep.Close)
+		tracker := d.track(ep, wq)
+		t.Cleanup(tracker.finish)
+		return tracker
+	}
+	var sampled int
+	for i := 0; i < 4; i++ {
+		if track() != nil {
+			sampled++
+		}
+	}
+	if sampled != 2 {
+		t.Errorf("got %d sampled connections out of 4 with a sample rate of 2, want 2", sampled)
+	}
+	if got := stats.Sampled.Value(); got != 2 {
+		t.Errorf("got Sampled = %d, want 2", got)
+	}
+
+	d = newTCPDiagnostics(0, 0, ns.stack.Clock(), &stats)
+	if tracker := track(); tracker != nil {
+		t.Errorf("connection sampled with sampling disabled")
+	}
+
+	var nilDiagnostics *tcpDiagnostics
+	if tracker := nilDiagnostics.track(nil, nil); tracker != nil {
+		t.Errorf("connection sampled by nil diagnostics")
+	}
+}
+
+func TestTCPDiagnosticsClosedRecords(t *testing.T) {
+	var stats tcpDiagnosticsStats
+	d := newTCPDiagnostics(1, 2, faketime.NewManualClock(), &stats)
+	for id := uint64(1); id <= 3; id++ {
+		d.onClosed(tcpConnRecord{id: id, termination: tcpTerminationPeerReset})
+	}
+	_, closed := d.Records()
+	var ids []uint64
+	for _, r := range closed {
+		ids = append(ids, r.id)
+	}
+	if len(ids) != 2 || ids[0] != 2 || ids[1] != 3 {
+		t.Errorf("got closed record ids = %d, want [2 3]", ids)
+	}
+	if got := stats.PeerResets.Value(); got != 3 {
+		t.Errorf("got PeerResets = %d, want 3", got)
+	}
+}
+
+func TestTCPDiagnosticsLocalAbort(t *testing.T) {
+	addGoleakCheck(t)
+
+	ns, _ := newNetstack(t, netstackTestOptions{})
+	ns.tcpDiagnostics = newTCPDiagnostics(1, 4, ns.stack.Clock(), &ns.stats.TCPDiagnostics)
+	if err := ns.addLoopback(); err != nil {
+		t.Fatalf("ns.addLoopback() = %s", err)
+	}
+
+	listener := createEP(t, ns, new(waiter.Queue))
+	if err := listener.ep.Bind(tcpip.FullAddress{}); err != nil {
+		t.Fatalf("ep.Bind({}) = %s", err)
+	}
+	if err := listener.ep.Listen(1); err != nil {
+		t.Fatalf("ep.Listen(1) = %s", err)
+	}
+	connectAddr, err := listener.ep.GetLocalAddress()
+	if err != nil {
+		t.Fatalf("ep.GetLocalAddress() = %s", err)
+	}
+	client := createEP(t, ns, new(waiter.Queue))
+	if client.tcpDiag == nil {
+		t.Fatal("client connection not sampled with a sample rate of 1")
+	}
+
+	waitEntry, inCh := waiter.NewChannelEntry(waiter.EventIn)
+	listener.wq.EventRegister(&waitEntry)
+	defer listener.wq.EventUnregister(&waitEntry)
+
+	switch err := client.ep.Connect(connectAddr); err.(type) {
+	case *tcpip.ErrConnectStarted:
+	default:
+		t.Fatalf("ep.Connect(%#v) = %s", connectAddr, err)
+	}
+	<-inCh
+
+	server, _, err := listener.ep.Accept(nil)
+	if err != nil {
+		t.Fatalf("ep.Accept(nil) = %s", err)
+	}
+	defer server.Close()
+
+	id := client.tcpDiag.snapshot().id
+	findRecord := func(records []tcpConnRecord) (tcpConnRecord, bool) {
+		for _, r := range records {
+			if r.id == id {
+				return r, true
+			}
+		}
+		return tcpConnRecord{}, false
+	}
+
+	// Wait for the client to be established.
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for tcp.EndpointState(client.ep.State()) != tcp.StateEstablished {
+		<-ticker.C
+	}
+	client.tcpDiag.observe()
+	active, _ := ns.tcpDiagnostics.Records()
+	record, ok := findRecord(active)
+	if !ok {
+		t.Fatalf("client connection not found in active records %#v", active)
+	}
+	if record.remote.Port != connectAddr.Port {
+		t.Errorf("got remote port = %d, want = %d", record.remote.Port, connectAddr.Port)
+	}
+	if record.termination != tcpTerminationNone {
+		t.Errorf("got termination of an open connection = %s, want = %s", record.termination, tcpTerminationNone)
+	}
+
+	// Closing with a zero linger timeout resets the connection.
+	client.ep.SocketOptions().SetLinger(tcpip.LingerOption{Enabled: true})
+	client.tcpDiag.onAbort()
+	client.close()
+
+	for {
+		_, closed := ns.tcpDiagnostics.Records()
+		if record, ok = findRecord(closed); ok {
+			break
+		}
+		<-ticker.C
+	}
+	if record.termination != tcpTerminationLocalAbort {
+		t.Errorf("got termination = %s, want = %s", record.termination, tcpTerminationLocalAbort)
+	}
+	var established bool
+	for _, transition := range record.transitions {
+		if transition.state == tcp.StateEstablished {
+			established = true
+		}
+	}
+	if !established {
+		t.Errorf("got transitions = %#v, want %s among them", record.transitions, tcp.StateEstablished)
+	}
+	if got := ns.stats.TCPDiagnostics.LocalAborts.Value(); got != 1 {
+		t.Errorf("got LocalAborts = %d, want 1", got)
+	}
+
+	// Inspect exposes the closed connection.
+	closedInspect := (&tcpDiagnosticsInspectImpl{value: ns.tcpDiagnostics}).GetChild(tcpDiagnosticsClosedLabel)
+	if closedInspect == nil {
+		t.Fatalf("no %s child", tcpDiagnosticsClosedLabel)
+	}
+	if children := closedInspect.ListChildren(); len(children) != 1 {
+		t.Errorf("got %s children = %s, want 1", tcpDiagnosticsClosedLabel, children)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"fmt"
+	"time"
+
+	syslog "go.fuchsia.dev/fuchsia/src/lib/syslog/go"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const tcpKeepaliveTagName = "tcp keepalive"
+
+// tcpKeepaliveDefaults are the keepalive parameters of new TCP sockets. They
+// only take effect on sockets that enable SO_KEEPALIVE, and sockets may still
+// change them with TCP_KEEPIDLE, TCP_KEEPINTVL and TCP_KEEPCNT.
+type tcpKeepaliveDefaults struct {
+	// idle is the time a connection is idle before the first keepalive probe.
+	idle time.Duration
+	// interval is the time between keepalive probes.
+	interval time.Duration
+	// count is the number of unanswered probes before the connection is
+	// dropped.
+	count uint
+}
+
+// defaultTCPKeepalive holds the keepalive parameters of TCP sockets in gVisor,
+// which match Linux's.
+var defaultTCPKeepalive = tcpKeepaliveDefaults{
+	idle:     2 * time.Hour,
+	interval: 75 * time.Second,
+	count:    9,
+}
+
+func (d tcpKeepaliveDefaults) String() string {
+	return fmt.Sprintf("idle=%s interval=%s count=%d", d.idle, d.interval, d.count)
+}
+
+// validate checks that d is within the limits that sockets may set
+// themselves.
+func (d tcpKeepaliveDefaults) validate() error {
+	if d.idle < time.Second || d.idle > maxTCPKeepIdle*time.Second || d.idle%time.Second != 0 {
+		return fmt.Errorf("keepalive idle time %s must be a whole number of seconds between 1s and %ds", d.idle, maxTCPKeepIdle)
+	}
+	if d.interval < time.Second || d.interval > maxTCPKeepIntvl*time.Second || d.interval%time.Second != 0 {
+		return fmt.Errorf("keepalive interval %s must be a whole number of seconds between 1s and %ds", d.interval, maxTCPKeepIntvl)
+	}
+	if d.count < 1 || d.count > maxTCPKeepCnt {
+		return fmt.Errorf("keepalive count %d must be between 1 and %d", d.count, maxTCPKeepCnt)
+	}
+	return nil
+}
+
+// apply sets the keepalive parameters of the TCP endpoint ep.
+func (d tcpKeepaliveDefaults) apply(ep tcpip.Endpoint) tcpip.Error {
+	idle := tcpip.KeepaliveIdleOption(d.idle)
+	if err := ep.SetSockOpt(&idle); err != nil {
+		return err
+	}
+	interval := tcpip.KeepaliveIntervalOption(d.interval)
+	if err := ep.SetSockOpt(&interval); err != nil {
+		return err
+	}
+	return ep.SetSockOptInt(tcpip.KeepaliveCountOption, int(d.count))
+}
+
+// tcpKeepalive holds the keepalive defaults given to new TCP sockets.
+type tcpKeepalive struct {
+	defaults tcpKeepaliveDefaults
+}
+
+func newTCPKeepalive(defaults tcpKeepaliveDefaults) (*tcpKeepalive, error) {
+	if err := defaults.validate(); err != nil {
+		return nil, err
+	}
+	return &tcpKeepalive{defaults: defaults}, nil
+}
+
+// Defaults returns the keepalive defaults.
+func (k *tcpKeepalive) Defaults() tcpKeepaliveDefaults {
+	return k.defaults
+}
+
+// onNewEndpoint gives the new TCP endpoint ep the defaults, unless they're
+// the ones gVisor gives it already.
+func (k *tcpKeepalive) onNewEndpoint(ep tcpip.Endpoint) {
+	if k.defaults == defaultTCPKeepalive {
+		return
+	}
+	if err := k.defaults.apply(ep); err != nil {
+		_ = syslog.WarnTf(tcpKeepaliveTagName, "%p: failed to set keepalive defaults %s: %s", ep, k.defaults, err)
+	}
+}
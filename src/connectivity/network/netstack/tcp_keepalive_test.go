@@ -0,0 +1,94 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+func TestTCPKeepaliveDefaultsValidate(t *testing.T) {
+	if err := defaultTCPKeepalive.validate(); err != nil {
+		t.Errorf("defaultTCPKeepalive.validate() = %s", err)
+	}
+	for _, d := range []tcpKeepaliveDefaults{
+		{idle: 0, interval: time.Second, count: 1},
+		{idle: 1500 * time.Millisecond, interval: time.Second, count: 1},
+		{idle: (maxTCPKeepIdle + 1) * time.Second, interval: time.Second, count: 1},
+		{idle: time.Second, interval: 0, count: 1},
+		{idle: time.Second, interval: (maxTCPKeepIntvl + 1) * time.Second, count: 1},
+		{idle: time.Second, interval: time.Second, count: 0},
+		{idle: time.Second, interval: time.Second, count: maxTCPKeepCnt + 1},
+	} {
+		if err := d.validate(); err == nil {
+			t.Errorf("%s.validate() succeeded, want error", d)
+		}
+	}
+}
+
+func TestTCPKeepaliveOnNewEndpoint(t *testing.T) {
+	addGoleakCheck(t)
+
+	ns, _ := newNetstack(t, netstackTestOptions{})
+	newEndpoint := func() tcpip.Endpoint {
+		t.Helper()
+		ep, err := ns.stack.NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, new(waiter.Queue))
+		if err != nil {
+			t.Fatalf("NewEndpoint(%d, %d, _) = %s", tcp.ProtocolNumber, ipv4.ProtocolNumber, err)
+		}
+		t.Cleanup(ep.Close)
+		return ep
+	}
+	checkKeepalive := func(ep tcpip.Endpoint, want tcpKeepaliveDefaults) {
+		t.Helper()
+		var idle tcpip.KeepaliveIdleOption
+		if err := ep.GetSockOpt(&idle); err != nil {
+			t.Fatalf("GetSockOpt(&KeepaliveIdleOption) = %s", err)
+		}
+		var interval tcpip.KeepaliveIntervalOption
+		if err := ep.GetSockOpt(&interval); err != nil {
+			t.Fatalf("GetSockOpt(&KeepaliveIntervalOption) = %s", err)
+		}
+		count, err := ep.GetSockOptInt(tcpip.KeepaliveCountOption)
+		if err != nil {
+			t.Fatalf("GetSockOptInt(KeepaliveCountOption) = %s", err)
+		}
+		got := tcpKeepaliveDefaults{
+			idle:     time.Duration(idle),
+			interval: time.Duration(interval),
+			count:    uint(count),
+		}
+		if got != want {
+			t.Errorf("got keepalive %s, want %s", got, want)
+		}
+	}
+
+	// Endpoints are left untouched when given defaultTCPKeepalive, so it must
+	// match what gVisor gives them.
+	for _, defaults := range []tcpKeepaliveDefaults{
+		defaultTCPKeepalive,
+		{idle: time.Minute, interval: 10 * time.Second, count: 3},
+	} {
+		tcpKeepalive, err := newTCPKeepalive(defaults)
+		if err != nil {
+			t.Fatalf("newTCPKeepalive(%s) = %s", defaults, err)
+		}
+		ep := newEndpoint()
+		tcpKeepalive.onNewEndpoint(ep)
+		checkKeepalive(ep, defaults)
+	}
+
+	invalid := tcpKeepaliveDefaults{}
+	if _, err := newTCPKeepalive(invalid); err == nil {
+		t.Errorf("newTCPKeepalive(%s) succeeded, want error", invalid)
+	}
+}
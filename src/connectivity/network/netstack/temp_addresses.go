@@ -0,0 +1,265 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	syslog "go.fuchsia.dev/fuchsia/src/lib/syslog/go"
+
+	inspect "fidl/fuchsia/inspect/deprecated"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	tempAddrTagName = "temporary addresses"
+
+	temporaryAddressesLabel = "Temporary Addresses"
+)
+
+// tempAddrConfig configures the temporary SLAAC addresses of an interface,
+// described in RFC 8981.
+//
+// The stack generates a temporary address alongside each public SLAAC
+// address, and generates a new one regenAdvanceDuration before the current
+// one is deprecated, so that the interface always has a preferred temporary
+// address while the prefix is valid.
+type tempAddrConfig struct {
+	// enabled is whether temporary addresses are generated.
+	enabled bool
+	// preferTemporary is whether temporary addresses are preferred over
+	// public addresses as the source of outgoing connections, as per RFC 6724
+	// rule 7. Otherwise public addresses are preferred, and temporary
+	// addresses are only used by sockets bound to them.
+	preferTemporary bool
+	// validLifetime is the maximum time a temporary address is valid for.
+	validLifetime time.Duration
+	// preferredLifetime is the maximum time a temporary address is preferred
+	// for.
+	preferredLifetime time.Duration
+}
+
+// defaultTempAddrConfig holds the values of RFC 8981 section 3.8.
+var defaultTempAddrConfig = tempAddrConfig{
+	enabled:           true,
+	preferTemporary:   true,
+	validLifetime:     maxTempAddrValidLifetime,
+	preferredLifetime: maxTempAddrPreferredLifetime,
+}
+
+func (c tempAddrConfig) String() string {
+	return fmt.Sprintf("enabled=%t prefer_temporary=%t valid_lifetime=%s preferred_lifetime=%s", c.enabled, c.preferTemporary, c.validLifetime, c.preferredLifetime)
+}
+
+// validate checks that the stack is able to generate temporary addresses
+// with c's lifetimes.
+func (c tempAddrConfig) validate() error {
+	// As per RFC 8981 section 3.8, the preferred lifetime must be greater
+	// than the time in advance of deprecation at which a new address is
+	// generated.
+	if c.preferredLifetime <= regenAdvanceDuration {
+		return fmt.Errorf("preferred lifetime %s must be greater than %s", c.preferredLifetime, regenAdvanceDuration)
+	}
+	if c.validLifetime < c.preferredLifetime {
+		return fmt.Errorf("valid lifetime %s must not be less than the preferred lifetime %s", c.validLifetime, c.preferredLifetime)
+	}
+	return nil
+}
+
+// ndpConfigurations returns configs with the temporary address configuration
+// of c.
+func (c tempAddrConfig) ndpConfigurations(configs ipv6.NDPConfigurations) ipv6.NDPConfigurations {
+	configs.AutoGenTempGlobalAddresses = c.enabled
+	configs.MaxTempAddrValidLifetime = c.validLifetime
+	configs.MaxTempAddrPreferredLifetime = c.preferredLifetime
+	return configs
+}
+
+// ipv6AddressInfo describes an IPv6 address assigned to an interface.
+type ipv6AddressInfo struct {
+	addr      tcpip.AddressWithPrefix
+	temporary bool
+	lifetimes stack.AddressLifetimes
+}
+
+// ipv6Addresses returns the IPv6 addresses assigned to the NIC. Addresses
+// that are still tentative are left out.
+func (ns *Netstack) ipv6Addresses(nicID tcpip.NICID) []ipv6AddressInfo {
+	ep, err := ns.stack.GetNetworkEndpoint(nicID, ipv6.ProtocolNumber)
+	if err != nil {
+		return nil
+	}
+	addressable, ok := ep.(stack.AddressableEndpoint)
+	if !ok {
+		return nil
+	}
+	var infos []ipv6AddressInfo
+	for _, addr := range addressable.PermanentAddresses() {
+		addressEP := addressable.AcquireAssignedAddress(addr.Address, false /* allowTemp */, stack.NeverPrimaryEndpoint)
+		if addressEP == nil {
+			continue
+		}
+		infos = append(infos, ipv6AddressInfo{
+			addr:      addr,
+			temporary: addressEP.Temporary(),
+			lifetimes: addressEP.Lifetimes(),
+		})
+		addressEP.DecRef()
+	}
+	return infos
+}
+
+// temporaryAddresses returns the temporary addresses assigned to the NIC,
+// sorted by address.
+func (ns *Netstack) temporaryAddresses(nicID tcpip.NICID) []ipv6AddressInfo {
+	var temporary []ipv6AddressInfo
+	for _, info := range ns.ipv6Addresses(nicID) {
+		if info.temporary {
+			temporary = append(temporary, info)
+		}
+	}
+	sort.Slice(temporary, func(i, j int) bool {
+		return temporary[i].addr.Address < temporary[j].addr.Address
+	})
+	return temporary
+}
+
+// publicSourceAddress returns the public address to use instead of the
+// temporary source address src to reach dst on the NIC, if temporary
+// addresses aren't preferred.
+//
+// It runs on every IPv6 connect, so it returns early without looking at the
+// NIC's addresses unless avoidsTemporaryAddresses.
+func (ns *Netstack) publicSourceAddress(nicID tcpip.NICID, dst, src tcpip.Address) (tcpip.Address, bool) {
+	if !ns.avoidsTemporaryAddresses() {
+		return "", false
+	}
+	addrs := ns.ipv6Addresses(nicID)
+	if !isTemporary(addrs, src) {
+		return "", false
+	}
+	table := ns.addressPolicy
+	if table == nil {
+		table = defaultAddressPolicyTable
+	}
+	return table.publicSource(dst, src, addrs)
+}
+
+// avoidsTemporaryAddresses returns whether temporary addresses are generated
+// but public addresses are preferred as the source of outgoing connections.
+func (ns *Netstack) avoidsTemporaryAddresses() bool {
+	c := ns.tempAddrDefaults
+	return c.enabled && !c.preferTemporary
+}
+
+func isTemporary(addrs []ipv6AddressInfo, addr tcpip.Address) bool {
+	for _, info := range addrs {
+		if info.addr.Address == addr {
+			return info.temporary
+		}
+	}
+	return false
+}
+
+// publicSource returns the public address among addrs to use instead of the
+// temporary address src to reach dst, reversing RFC 6724 rule 7 (prefer
+// temporary addresses). Deprecated addresses and those that rules 1, 2, 3 and
+// 6 rank below src aren't considered; the remaining ones are ordered by rule
+// 8 (use longest matching prefix).
+func (t *addressPolicyTable) publicSource(dst, src tcpip.Address, addrs []ipv6AddressInfo) (tcpip.Address, bool) {
+	srcInfo := findAddressInfo(addrs, src)
+	var best tcpip.Address
+	for _, info := range addrs {
+		c := info.addr.Address
+		if info.temporary || info.lifetimes.Deprecated || t.compare(info, srcInfo, dst) < 0 {
+			continue
+		}
+		if len(best) == 0 || commonPrefixLen(c, dst) > commonPrefixLen(best, dst) {
+			best = c
+		}
+	}
+	return best, len(best) != 0
+}
+
+var _ inspectInner = (*tempAddrsInspectImpl)(nil)
+
+// tempAddrsInspectImpl exposes the temporary address configuration of a NIC
+// and its current temporary addresses, as children keyed by address.
+type tempAddrsInspectImpl struct {
+	name   string
+	config tempAddrConfig
+	addrs  []ipv6AddressInfo
+}
+
+func (impl *tempAddrsInspectImpl) ReadData() inspect.Object {
+	return inspect.Object{
+		Name: impl.name,
+		Properties: []inspect.Property{
+			{Key: "Enabled", Value: inspect.PropertyValueWithStr(strconv.FormatBool(impl.config.enabled))},
+			{Key: "PreferTemporary", Value: inspect.PropertyValueWithStr(strconv.FormatBool(impl.config.preferTemporary))},
+		},
+		Metrics: []inspect.Metric{
+			{Key: "ValidLifetimeSecs", Value: inspect.MetricValueWithUintValue(uint64(impl.config.validLifetime.Seconds()))},
+			{Key: "PreferredLifetimeSecs", Value: inspect.MetricValueWithUintValue(uint64(impl.config.preferredLifetime.Seconds()))},
+		},
+	}
+}
+
+func (impl *tempAddrsInspectImpl) ListChildren() []string {
+	children := make([]string, 0, len(impl.addrs))
+	for _, info := range impl.addrs {
+		children = append(children, info.addr.Address.String())
+	}
+	return children
+}
+
+func (impl *tempAddrsInspectImpl) GetChild(childName string) inspectInner {
+	for _, info := range impl.addrs {
+		if info.addr.Address.String() == childName {
+			return &tempAddrInspectImpl{
+				name:  childName,
+				value: info,
+			}
+		}
+	}
+	_ = syslog.VLogTf(syslog.DebugVerbosity, inspect.InspectName, "GetChild(%s): no such temporary address", childName)
+	return nil
+}
+
+var _ inspectInner = (*tempAddrInspectImpl)(nil)
+
+type tempAddrInspectImpl struct {
+	name  string
+	value ipv6AddressInfo
+}
+
+func (impl *tempAddrInspectImpl) ReadData() inspect.Object {
+	lifetimes := impl.value.lifetimes
+	return inspect.Object{
+		Name: impl.name,
+		Properties: []inspect.Property{
+			{Key: "PrefixLength", Value: inspect.PropertyValueWithStr(strconv.Itoa(impl.value.addr.PrefixLen))},
+			{Key: "Deprecated", Value: inspect.PropertyValueWithStr(strconv.FormatBool(lifetimes.Deprecated))},
+			{Key: "PreferredUntil", Value: inspect.PropertyValueWithStr(strconv.FormatInt(lifetimes.PreferredUntil.Sub(tcpip.MonotonicTime{}).Nanoseconds(), 10))},
+			{Key: "ValidUntil", Value: inspect.PropertyValueWithStr(strconv.FormatInt(lifetimes.ValidUntil.Sub(tcpip.MonotonicTime{}).Nanoseconds(), 10))},
+		},
+	}
+}
+
+func (*tempAddrInspectImpl) ListChildren() []string {
+	return nil
+}
+
+func (*tempAddrInspectImpl) GetChild(string) inspectInner {
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"testing"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/connectivity/network/netstack/util"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+func TestTempAddrConfigValidate(t *testing.T) {
+	if err := defaultTempAddrConfig.validate(); err != nil {
+		t.Errorf("defaultTempAddrConfig.validate() = %s", err)
+	}
+	for _, config := range []tempAddrConfig{
+		{validLifetime: time.Hour, preferredLifetime: regenAdvanceDuration},
+		{validLifetime: time.Hour, preferredLifetime: 2 * time.Hour},
+	} {
+		if err := config.validate(); err == nil {
+			t.Errorf("%s: validate() succeeded, want error", config)
+		}
+	}
+}
+
+func TestAddressPolicyTablePublicSource(t *testing.T) {
+	var (
+		temporary      = util.Parse("2600::7e3a:91c2:4b0d:1f55")
+		public         = util.Parse("2600::2")
+		otherPublic    = util.Parse("2601::2")
+		deprecated     = util.Parse("2600::3")
+		linkLocal      = util.Parse("fe80::2")
+		otherTemporary = util.Parse("2600::c1d2:e3f4:a5b6:c7d8")
+	)
+	info := func(addr tcpip.Address, temporary, deprecated bool) ipv6AddressInfo {
+		return ipv6AddressInfo{
+			addr:      tcpip.AddressWithPrefix{Address: addr, PrefixLen: 64},
+			temporary: temporary,
+			lifetimes: stack.AddressLifetimes{Deprecated: deprecated},
+		}
+	}
+	table := newAddressPolicyTable(defaultAddressPolicies)
+	for _, tc := range []struct {
+		name   string
+		addrs  []ipv6AddressInfo
+		want   tcpip.Address
+		wantOK bool
+	}{
+		{
+			name:   "longest matching public address",
+			addrs:  []ipv6AddressInfo{info(temporary, true, false), info(otherPublic, false, false), info(public, false, false)},
+			want:   public,
+			wantOK: true,
+		},
+		{
+			name:  "deprecated public address",
+			addrs: []ipv6AddressInfo{info(temporary, true, false), info(deprecated, false, true)},
+		},
+		{
+			name:  "public address of a smaller scope",
+			addrs: []ipv6AddressInfo{info(temporary, true, false), info(linkLocal, false, false)},
+		},
+		{
+			name:  "only temporary addresses",
+			addrs: []ipv6AddressInfo{info(temporary, true, false), info(otherTemporary, true, false)},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := table.publicSource(util.Parse("2600::1"), temporary, tc.addrs)
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("got publicSource(...) = (%s, %t), want = (%s, %t)", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestTemporaryAddresses(t *testing.T) {
+	var (
+		public    = util.Parse("2600::2")
+		temporary = util.Parse("2600::7e3a:91c2:4b0d:1f55")
+		dst       = util.Parse("2600::1")
+	)
+	preferPublic := defaultTempAddrConfig
+	preferPublic.preferTemporary = false
+
+	for _, tc := range []struct {
+		name       string
+		config     tempAddrConfig
+		wantPublic bool
+	}{
+		{name: "prefer temporary", config: defaultTempAddrConfig},
+		{name: "prefer public", config: preferPublic, wantPublic: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			addGoleakCheck(t)
+
+			ns, _ := newNetstack(t, netstackTestOptions{})
+			ns.tempAddrDefaults = tc.config
+			if err := ns.addLoopback(); err != nil {
+				t.Fatalf("ns.addLoopback() = %s", err)
+			}
+			ifs := installAndValidateIface(t, ns, addNoopEndpoint)
+
+			for _, addr := range []struct {
+				addr      tcpip.Address
+				temporary bool
+			}{
+				{addr: public},
+				{addr: temporary, temporary: true},
+			} {
+				protocolAddr := tcpip.ProtocolAddress{
+					Protocol:          header.IPv6ProtocolNumber,
+					AddressWithPrefix: tcpip.AddressWithPrefix{Address: addr.addr, PrefixLen: 64},
+				}
+				if ok, reason := ifs.addAddress(protocolAddr, stack.AddressProperties{Temporary: addr.temporary}); !ok {
+					t.Fatalf("ifs.addAddress(%s, {Temporary: %t}): %s", protocolAddr.AddressWithPrefix, addr.temporary, reason)
+				}
+			}
+
+			if got := ns.temporaryAddresses(ifs.nicid); len(got) != 1 || got[0].addr.Address != temporary {
+				t.Fatalf("got temporaryAddresses(%d) = %#v, want only %s", ifs.nicid, got, temporary)
+			}
+
+			// Inspect shows the temporary addresses of the interface, but not of
+			// the loopback interface.
+			for id, info := range ns.getIfStateInfo(ns.stack.NICInfo()) {
+				child := (&nicInfoInspectImpl{value: info}).GetChild(temporaryAddressesLabel)
+				if info.Flags.Loopback {
+					if child != nil {
+						t.Errorf("loopback NIC %d has a %s child", id, temporaryAddressesLabel)
+					}
+					continue
+				}
+				if child == nil {
+					t.Fatalf("NIC %d has no %s child", id, temporaryAddressesLabel)
+				}
+				if got, want := child.ListChildren(), []string{temporary.String()}; len(got) != 1 || got[0] != want[0] {
+					t.Errorf("got %s children = %s, want = %s", temporaryAddressesLabel, got, want)
+				}
+			}
+
+			src, ok := ns.publicSourceAddress(ifs.nicid, dst, temporary)
+			if tc.wantPublic {
+				if !ok || src != public {
+					t.Errorf("got publicSourceAddress(%d, %s, %s) = (%s, %t), want = (%s, true)", ifs.nicid, dst, temporary, src, ok, public)
+				}
+			} else if ok {
+				t.Errorf("got publicSourceAddress(%d, %s, %s) = %s, want none", ifs.nicid, dst, temporary, src)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	syslog "go.fuchsia.dev/fuchsia/src/lib/syslog/go"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+)
+
+const (
+	tunablesTagName = "tunables"
+
+	defaultTunablesProfile = "default"
+)
+
+type tunableKind int
+
+const (
+	tunableBool tunableKind = iota
+	tunableUint
+	tunableDuration
+	// A range is set as "min,default,max".
+	tunableRange
+)
+
+// tunable is a stack option that may be set at startup. Tunables can't be
+// changed once netstack is running: no protocol in this tree exposes them
+// for writing, so neither runtime changes nor a history of them is kept.
+type tunable struct {
+	name        string
+	description string
+	// network is the network protocol the option applies to, or 0 if it is a
+	// TCP option.
+	network tcpip.NetworkProtocolNumber
+	// option is a pointer to a value of the option's type.
+	option interface{}
+	kind   tunableKind
+}
+
+// allTunables is the set of tunables, sorted by name.
+var allTunables = []tunable{
+	{
+		name:        "ipv4.default_ttl",
+		description: "TTL of outgoing IPv4 packets on sockets that don't set IP_TTL",
+		network:     header.IPv4ProtocolNumber,
+		option:      new(tcpip.DefaultTTLOption),
+		kind:        tunableUint,
+	},
+	{
+		name:        "ipv6.default_hop_limit",
+		description: "hop limit of outgoing IPv6 packets on sockets that don't set IPV6_UNICAST_HOPS",
+		network:     header.IPv6ProtocolNumber,
+		option:      new(tcpip.DefaultTTLOption),
+		kind:        tunableUint,
+	},
+	{
+		name:        "tcp.delay",
+		description: "whether Nagle's algorithm is enabled on new TCP sockets",
+		option:      new(tcpip.TCPDelayEnabled),
+		kind:        tunableBool,
+	},
+	{
+		name:        "tcp.linger_timeout",
+		description: "maximum time a TCP socket stays in FIN-WAIT-2",
+		option:      new(tcpip.TCPLingerTimeoutOption),
+		kind:        tunableDuration,
+	},
+	{
+		name:        "tcp.max_rto",
+		description: "maximum TCP retransmission timeout",
+		option:      new(tcpip.TCPMaxRTOOption),
+		kind:        tunableDuration,
+	},
+	{
+		name:        "tcp.min_rto",
+		description: "minimum TCP retransmission timeout",
+		option:      new(tcpip.TCPMinRTOOption),
+		kind:        tunableDuration,
+	},
+	{
+		name:        "tcp.moderate_receive_buffer",
+		description: "whether TCP receive buffers are automatically tuned",
+		option:      new(tcpip.TCPModerateReceiveBufferOption),
+		kind:        tunableBool,
+	},
+	{
+		name:        "tcp.receive_buffer_size",
+		description: "minimum, default and maximum TCP receive buffer sizes in bytes",
+		option:      new(tcpip.TCPReceiveBufferSizeRangeOption),
+		kind:        tunableRange,
+	},
+	{
+		name:        "tcp.sack",
+		description: "whether TCP selective acknowledgements are enabled",
+		option:      new(tcpip.TCPSACKEnabled),
+		kind:        tunableBool,
+	},
+	{
+		name:        "tcp.send_buffer_size",
+		description: "minimum, default and maximum TCP send buffer sizes in bytes",
+		option:      new(tcpip.TCPSendBufferSizeRangeOption),
+		kind:        tunableRange,
+	},
+	{
+		name:        "tcp.syn_retries",
+		description: "number of SYN retransmissions before a TCP connection attempt fails",
+		option:      new(tcpip.TCPSynRetriesOption),
+		kind:        tunableUint,
+	},
+	{
+		name:        "tcp.time_wait_timeout",
+		description: "time a TCP socket stays in TIME-WAIT",
+		option:      new(tcpip.TCPTimeWaitTimeoutOption),
+		kind:        tunableDuration,
+	},
+}
+
+// tunableProfiles are sets of tunable values selected per product. Tunables
+// that a profile doesn't mention keep the stack's defaults.
+var tunableProfiles = map[string]map[string]string{
+	defaultTunablesProfile: {
+		"tcp.delay":                   "true",
+		"tcp.moderate_receive_buffer": "true",
+		"tcp.sack":                    "true",
+	},
+	// For products with little memory to spare for socket buffers.
+	"constrained": {
+		"tcp.delay":                   "true",
+		"tcp.moderate_receive_buffer": "true",
+		"tcp.receive_buffer_size":     "4096,65536,1048576",
+		"tcp.sack":                    "true",
+		"tcp.send_buffer_size":        "4096,65536,1048576",
+	},
+}
+
+func findTunable(name string) (*tunable, bool) {
+	i := sort.Search(len(allTunables), func(i int) bool {
+		return allTunables[i].name >= name
+	})
+	if i < len(allTunables) && allTunables[i].name == name {
+		return &allTunables[i], true
+	}
+	return nil, false
+}
+
+func (t *tunable) get(s *stack.Stack) (string, error) {
+	v := reflect.New(reflect.TypeOf(t.option).Elem())
+	var err tcpip.Error
+	if t.network != 0 {
+		err = s.NetworkProtocolOption(t.network, v.Interface().(tcpip.GettableNetworkProtocolOption))
+	} else {
+		err = s.TransportProtocolOption(tcp.ProtocolNumber, v.Interface().(tcpip.GettableTransportProtocolOption))
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s: %s", t.name, err)
+	}
+	return t.format(v.Elem()), nil
+}
+
+func (t *tunable) format(v reflect.Value) string {
+	switch t.kind {
+	case tunableBool:
+		return strconv.FormatBool(v.Bool())
+	case tunableUint:
+		return strconv.FormatUint(v.Uint(), 10)
+	case tunableDuration:
+		return time.Duration(v.Int()).String()
+	case tunableRange:
+		return fmt.Sprintf("%d,%d,%d", v.FieldByName("Min").Int(), v.FieldByName("Default").Int(), v.FieldByName("Max").Int())
+	default:
+		panic(fmt.Sprintf("unknown tunable kind %d", t.kind))
+	}
+}
+
+func (t *tunable) parse(value string) (reflect.Value, error) {
+	v := reflect.New(reflect.TypeOf(t.option).Elem())
+	switch t.kind {
+	case tunableBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.Elem().SetBool(b)
+	case tunableUint:
+		u, err := strconv.ParseUint(value, 10, v.Elem().Type().Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.Elem().SetUint(u)
+	case tunableDuration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if d < 0 {
+			return reflect.Value{}, fmt.Errorf("negative duration %s", d)
+		}
+		v.Elem().SetInt(int64(d))
+	case tunableRange:
+		parts := strings.Split(value, ",")
+		if len(parts) != 3 {
+			return reflect.Value{}, fmt.Errorf("%q is not of the form min,default,max", value)
+		}
+		var r [3]int64
+		for i, p := range parts {
+			n, err := strconv.ParseInt(strings.TrimSpace(p), 10, 64)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			r[i] = n
+		}
+		if r[0] <= 0 || r[0] > r[1] || r[1] > r[2] {
+			return reflect.Value{}, fmt.Errorf("%q must satisfy 0 < min <= default <= max", value)
+		}
+		v.Elem().FieldByName("Min").SetInt(r[0])
+		v.Elem().FieldByName("Default").SetInt(r[1])
+		v.Elem().FieldByName("Max").SetInt(r[2])
+	default:
+		panic(fmt.Sprintf("unknown tunable kind %d", t.kind))
+	}
+	return v, nil
+}
+
+func (t *tunable) set(s *stack.Stack, value string) error {
+	v, err := t.parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %w", t.name, err)
+	}
+	var tcpipErr tcpip.Error
+	if t.network != 0 {
+		tcpipErr = s.SetNetworkProtocolOption(t.network, v.Interface().(tcpip.SettableNetworkProtocolOption))
+	} else {
+		tcpipErr = s.SetTransportProtocolOption(tcp.ProtocolNumber, v.Interface().(tcpip.SettableTransportProtocolOption))
+	}
+	if tcpipErr != nil {
+		return fmt.Errorf("failed to set %s to %s: %s", t.name, value, tcpipErr)
+	}
+	return nil
+}
+
+// tunableValue is the current value of a tunable.
+type tunableValue struct {
+	name        string
+	description string
+	value       string
+}
+
+// listTunables returns the current values of all tunables of s, sorted by
+// name.
+func listTunables(s *stack.Stack) []tunableValue {
+	values := make([]tunableValue, 0, len(allTunables))
+	for i := range allTunables {
+		tunable := &allTunables[i]
+		value, err := tunable.get(s)
+		if err != nil {
+			value = err.Error()
+		}
+		values = append(values, tunableValue{
+			name:        tunable.name,
+			description: tunable.description,
+			value:       value,
+		})
+	}
+	return values
+}
+
+// applyTunables sets every tunable in the named profile on s, followed by
+// overrides. It is only called at startup.
+func applyTunables(s *stack.Stack, profile string, overrides [][2]string) error {
+	values, ok := tunableProfiles[profile]
+	if !ok {
+		return fmt.Errorf("unknown tunables profile %q", profile)
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	settings := make([][2]string, 0, len(names)+len(overrides))
+	for _, name := range names {
+		settings = append(settings, [2]string{name, values[name]})
+	}
+	settings = append(settings, overrides...)
+
+	for _, setting := range settings {
+		name, value := setting[0], setting[1]
+		tunable, ok := findTunable(name)
+		if !ok {
+			return fmt.Errorf("unknown tunable %q", name)
+		}
+		if err := tunable.set(s, value); err != nil {
+			return err
+		}
+		_ = syslog.InfoTf(tunablesTagName, "%s set to %s", name, value)
+	}
+	return nil
+}
+
+// tunableFlag is a flag.Value that collects name=value settings of tunables.
+type tunableFlag struct {
+	settings [][2]string
+}
+
+// String implements flag.Value.String.
+func (f *tunableFlag) String() string {
+	var b strings.Builder
+	for i, s := range f.settings {
+		if i != 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(s[0] + "=" + s[1])
+	}
+	return b.String()
+}
+
+// Set implements flag.Value.Set.
+func (f *tunableFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("%q is not of the form name=value", s)
+	}
+	name := s[:i]
+	if _, ok := findTunable(name); !ok {
+		return fmt.Errorf("unknown tunable %q", name)
+	}
+	f.settings = append(f.settings, [2]string{name, s[i+1:]})
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	tcpipstack "gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+)
+
+func newTestTunablesStack(t *testing.T) *tcpipstack.Stack {
+	t.Helper()
+
+	stk := tcpipstack.New(tcpipstack.Options{
+		NetworkProtocols:   []tcpipstack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+		TransportProtocols: []tcpipstack.TransportProtocolFactory{tcp.NewProtocol},
+	})
+	t.Cleanup(func() {
+		stk.Close()
+		stk.Wait()
+	})
+	return stk
+}
+
+func TestTunablesSorted(t *testing.T) {
+	if !sort.SliceIsSorted(allTunables, func(i, j int) bool {
+		return allTunables[i].name < allTunables[j].name
+	}) {
+		t.Fatal("allTunables must be sorted by name")
+	}
+	for profile, values := range tunableProfiles {
+		for name := range values {
+			if _, ok := findTunable(name); !ok {
+				t.Errorf("profile %s sets unknown tunable %s", profile, name)
+			}
+		}
+	}
+}
+
+func TestTunablesSetGet(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "ipv4.default_ttl", value: "32", want: "32"},
+		{name: "ipv6.default_hop_limit", value: "128", want: "128"},
+		{name: "tcp.delay", value: "false", want: "false"},
+		{name: "tcp.delay", value: "1", want: "true"},
+		{name: "tcp.min_rto", value: "500ms", want: "500ms"},
+		{name: "tcp.time_wait_timeout", value: "1m", want: "1m0s"},
+		{name: "tcp.receive_buffer_size", value: "4096, 8192,16384", want: "4096,8192,16384"},
+		{name: "tcp.syn_retries", value: "4", want: "4"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s=%s", test.name, test.value), func(t *testing.T) {
+			stk := newTestTunablesStack(t)
+			if err := applyTunables(stk, defaultTunablesProfile, [][2]string{{test.name, test.value}}); err != nil {
+				t.Fatalf("applyTunables(_, %s, %s=%s) = %s", defaultTunablesProfile, test.name, test.value, err)
+			}
+			tunable, ok := findTunable(test.name)
+			if !ok {
+				t.Fatalf("findTunable(%s) not found", test.name)
+			}
+			got, err := tunable.get(stk)
+			if err != nil {
+				t.Fatalf("get(%s) = %s", test.name, err)
+			}
+			if got != test.want {
+				t.Errorf("got get(%s) = %s, want = %s", test.name, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTunablesSetInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "tcp.unknown", value: "1"},
+		{name: "tcp.delay", value: "maybe"},
+		{name: "ipv4.default_ttl", value: "256"},
+		{name: "tcp.min_rto", value: "-1s"},
+		{name: "tcp.receive_buffer_size", value: "4096,8192"},
+		{name: "tcp.receive_buffer_size", value: "8192,4096,16384"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s=%s", test.name, test.value), func(t *testing.T) {
+			stk := newTestTunablesStack(t)
+			if err := applyTunables(stk, defaultTunablesProfile, [][2]string{{test.name, test.value}}); err == nil {
+				t.Errorf("applyTunables(_, %s, %s=%s) succeeded, want error", defaultTunablesProfile, test.name, test.value)
+			}
+		})
+	}
+}
+
+func TestApplyTunablesProfile(t *testing.T) {
+	stk := newTestTunablesStack(t)
+	if err := applyTunables(stk, "unknown", nil); err == nil {
+		t.Error("applyTunables(_, unknown, nil) succeeded, want error")
+	}
+	// Overrides are applied after the profile.
+	overrides := [][2]string{{"tcp.sack", "false"}}
+	if err := applyTunables(stk, "constrained", overrides); err != nil {
+		t.Fatalf("applyTunables(_, constrained, %s) = %s", overrides, err)
+	}
+	want := make(map[string]string)
+	for name, value := range tunableProfiles["constrained"] {
+		want[name] = value
+	}
+	want["tcp.sack"] = "false"
+
+	values := listTunables(stk)
+	if got, want := len(values), len(allTunables); got != want {
+		t.Errorf("got len(listTunables(_)) = %d, want = %d", got, want)
+	}
+	for _, v := range values {
+		if want, ok := want[v.name]; ok && v.value != want {
+			t.Errorf("got %s = %s, want = %s", v.name, v.value, want)
+		}
+	}
+}
+
+func TestTunableFlag(t *testing.T) {
+	var f tunableFlag
+	for _, s := range []string{"tcp.delay=false", "tcp.receive_buffer_size=1,2,3"} {
+		if err := f.Set(s); err != nil {
+			t.Fatalf("Set(%s) = %s", s, err)
+		}
+	}
+	if got, want := f.String(), "tcp.delay=false tcp.receive_buffer_size=1,2,3"; got != want {
+		t.Errorf("got String() = %s, want = %s", got, want)
+	}
+	for _, s := range []string{"tcp.delay", "=false", "tcp.unknown=1"} {
+		if err := f.Set(s); err == nil {
+			t.Errorf("Set(%s) succeeded, want error", s)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+
+	"fidl/fuchsia/net/interfaces"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
+	"gvisor.dev/gvisor/pkg/tcpip/link/pipe"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	dummyInterfacePrefix = "dummy"
+	vethInterfacePrefix  = "veth"
+
+	// virtualInterfaceMTU is the MTU of virtual interfaces, excluding the
+	// Ethernet header of veth interfaces.
+	virtualInterfaceMTU = 1500
+)
+
+var _ stack.LinkEndpoint = (*dummyEndpoint)(nil)
+
+// dummyEndpoint is a link endpoint that drops every packet written to it.
+type dummyEndpoint struct {
+	dispatcher stack.NetworkDispatcher
+}
+
+func (*dummyEndpoint) MTU() uint32 {
+	return virtualInterfaceMTU
+}
+
+func (*dummyEndpoint) Capabilities() stack.LinkEndpointCapabilities {
+	return 0
+}
+
+func (*dummyEndpoint) MaxHeaderLength() uint16 {
+	return 0
+}
+
+func (*dummyEndpoint) LinkAddress() tcpip.LinkAddress {
+	return ""
+}
+
+func (*dummyEndpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	return pkts.Len(), nil
+}
+
+func (ep *dummyEndpoint) Attach(dispatcher stack.NetworkDispatcher) {
+	ep.dispatcher = dispatcher
+}
+
+func (ep *dummyEndpoint) IsAttached() bool {
+	return ep.dispatcher != nil
+}
+
+func (*dummyEndpoint) Wait() {}
+
+func (*dummyEndpoint) ARPHardwareType() header.ARPHardwareType {
+	return header.ARPHardwareNone
+}
+
+func (*dummyEndpoint) AddHeader(stack.PacketBufferPtr) {}
+
+// addDummyInterface adds an interface that drops every packet sent through
+// it, like a Linux dummy interface. Addresses assigned to it are reachable
+// from the device itself, so services can bind to an address that doesn't
+// depend on any physical link being up.
+//
+// If name is empty, the interface is named after its NIC ID.
+func (ns *Netstack) addDummyInterface(name string) (*ifState, error) {
+	ifs, err := ns.addEndpoint(
+		makeEndpointName(dummyInterfacePrefix, name),
+		&dummyEndpoint{},
+		nil, /* controller */
+		nil, /* observer */
+		defaultInterfaceMetric,
+		qdiscConfig{},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := ifs.Up(); err != nil {
+		return nil, err
+	}
+	return ifs, nil
+}
+
+// addVethPair adds two Ethernet interfaces connected to each other, like a
+// Linux veth pair: frames sent through one are received by the other.
+//
+// If a name is empty, the interface is named after its NIC ID.
+func (ns *Netstack) addVethPair(name1, name2 string) (*ifState, *ifState, error) {
+	var linkAddrs [2]tcpip.LinkAddress
+	for i := range linkAddrs {
+		var err error
+		if linkAddrs[i], err = randomLinkAddress(); err != nil {
+			return nil, nil, err
+		}
+	}
+	ep1, ep2 := pipe.New(linkAddrs[0], linkAddrs[1], virtualInterfaceMTU+header.EthernetMinimumSize)
+
+	ifs1, err := ns.addEndpoint(
+		makeEndpointName(vethInterfacePrefix, name1),
+		ethernet.New(ep1),
+		nil, /* controller */
+		nil, /* observer */
+		defaultInterfaceMetric,
+		qdiscConfig{},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	ifs2, err := ns.addEndpoint(
+		makeEndpointName(vethInterfacePrefix, name2),
+		ethernet.New(ep2),
+		nil, /* controller */
+		nil, /* observer */
+		defaultInterfaceMetric,
+		qdiscConfig{},
+	)
+	if err != nil {
+		ifs1.RemoveByUser()
+		return nil, nil, err
+	}
+	for _, ifs := range []*ifState{ifs1, ifs2} {
+		if err := ifs.Up(); err != nil {
+			ifs1.RemoveByUser()
+			ifs2.RemoveByUser()
+			return nil, nil, err
+		}
+	}
+	return ifs1, ifs2, nil
+}
+
+// randomLinkAddress returns a random locally administered unicast MAC
+// address.
+func randomLinkAddress() (tcpip.LinkAddress, error) {
+	var b [header.EthernetAddressSize]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate a MAC address: %w", err)
+	}
+	b[0] = (b[0] | 0x02) &^ 0x01
+	return tcpip.LinkAddress(b[:]), nil
+}
+
+// virtualInterface describes virtual interfaces to add on startup.
+type virtualInterface struct {
+	kind  string
+	names []string
+}
+
+func (v virtualInterface) String() string {
+	if len(v.names) == 0 {
+		return v.kind
+	}
+	return v.kind + ":" + strings.Join(v.names, ",")
+}
+
+// parseVirtualInterface parses virtual interfaces of the form
+// dummy[:name] or veth[:name1,name2].
+func parseVirtualInterface(s string) (virtualInterface, error) {
+	kind, names, hasNames := strings.Cut(s, ":")
+	v := virtualInterface{kind: kind}
+	if hasNames {
+		v.names = strings.Split(names, ",")
+	}
+	switch kind {
+	case dummyInterfacePrefix:
+		if len(v.names) > 1 {
+			return virtualInterface{}, fmt.Errorf("%q: a dummy interface has a single name", s)
+		}
+	case vethInterfacePrefix:
+		if hasNames && len(v.names) != 2 {
+			return virtualInterface{}, fmt.Errorf("%q: a veth pair has two names", s)
+		}
+	default:
+		return virtualInterface{}, fmt.Errorf("%q is not of the form dummy[:name] or veth[:name1,name2]", s)
+	}
+	for _, name := range v.names {
+		if len(name) == 0 || len(name) > int(interfaces.InterfaceNameLength) {
+			return virtualInterface{}, fmt.Errorf("%q: interface names must be 1 to %d bytes long", s, interfaces.InterfaceNameLength)
+		}
+	}
+	return v, nil
+}
+
+// add adds the virtual interfaces described by v to ns.
+func (v virtualInterface) add(ns *Netstack) error {
+	names := append([]string(nil), v.names...)
+	for len(names) < 2 {
+		names = append(names, "")
+	}
+	switch v.kind {
+	case dummyInterfacePrefix:
+		_, err := ns.addDummyInterface(names[0])
+		return err
+	case vethInterfacePrefix:
+		_, _, err := ns.addVethPair(names[0], names[1])
+		return err
+	default:
+		panic(fmt.Sprintf("unknown virtual interface kind %q", v.kind))
+	}
+}
+
+// virtualInterfacesFlag is a flag.Value that collects virtual interfaces to
+// add on startup.
+type virtualInterfacesFlag struct {
+	interfaces []virtualInterface
+}
+
+// String implements flag.Value.String.
+func (f *virtualInterfacesFlag) String() string {
+	var b strings.Builder
+	for i, v := range f.interfaces {
+		if i != 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(v.String())
+	}
+	return b.String()
+}
+
+// Set implements flag.Value.Set.
+func (f *virtualInterfacesFlag) Set(s string) error {
+	v, err := parseVirtualInterface(s)
+	if err != nil {
+		return err
+	}
+	f.interfaces = append(f.interfaces, v)
+	return nil
+}
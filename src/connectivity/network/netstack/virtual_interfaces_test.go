@@ -0,0 +1,100 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+//go:build !build_with_native_toolchain
+
+package netstack
+
+import (
+	"fmt"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+func TestParseVirtualInterface(t *testing.T) {
+	for _, s := range []string{"dummy", "dummy:svc0", "veth", "veth:veth-a,veth-b"} {
+		v, err := parseVirtualInterface(s)
+		if err != nil {
+			t.Errorf("parseVirtualInterface(%q) = %s", s, err)
+		} else if got := v.String(); got != s {
+			t.Errorf("got parseVirtualInterface(%q).String() = %s", s, got)
+		}
+	}
+	for _, s := range []string{"", "tun", "dummy:", "dummy:a,b", "veth:a", "veth:a,", "dummy:an-interface-name-too-long"} {
+		if v, err := parseVirtualInterface(s); err == nil {
+			t.Errorf("parseVirtualInterface(%q) = %s, want error", s, v)
+		}
+	}
+}
+
+func TestVirtualInterfaces(t *testing.T) {
+	addGoleakCheck(t)
+
+	ns, _ := newNetstack(t, netstackTestOptions{})
+
+	dummy, err := ns.addDummyInterface("svc0")
+	if err != nil {
+		t.Fatalf("addDummyInterface(svc0) = %s", err)
+	}
+	veth1, veth2, err := ns.addVethPair("", "")
+	if err != nil {
+		t.Fatalf("addVethPair(\"\", \"\") = %s", err)
+	}
+
+	nicInfos := ns.stack.NICInfo()
+	for _, tc := range []struct {
+		ifs  *ifState
+		name string
+	}{
+		{ifs: dummy, name: "svc0"},
+		{ifs: veth1, name: fmt.Sprintf("veth%d", veth1.nicid)},
+		{ifs: veth2, name: fmt.Sprintf("veth%d", veth2.nicid)},
+	} {
+		info, ok := nicInfos[tc.ifs.nicid]
+		if !ok {
+			t.Errorf("missing NICInfo for NIC %d", tc.ifs.nicid)
+			continue
+		}
+		if info.Name != tc.name {
+			t.Errorf("got NIC %d name = %s, want = %s", tc.ifs.nicid, info.Name, tc.name)
+		}
+		if !info.Flags.Up {
+			t.Errorf("NIC %d (%s) is not up", tc.ifs.nicid, info.Name)
+		}
+	}
+
+	linkAddr1, linkAddr2 := nicInfos[veth1.nicid].LinkAddress, nicInfos[veth2.nicid].LinkAddress
+	if linkAddr1 == linkAddr2 {
+		t.Errorf("veth interfaces share link address %s", linkAddr1)
+	}
+	for _, linkAddr := range []string{string(linkAddr1), string(linkAddr2)} {
+		if len(linkAddr) != header.EthernetAddressSize || linkAddr[0]&0x01 != 0 {
+			t.Errorf("got link address %x, want a unicast MAC address", linkAddr)
+		}
+	}
+
+	// Frames sent through one end of the pair are received by the other.
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: bufferv2.MakeWithData(make([]byte, header.IPv4MinimumSize)),
+	})
+	pkt.EgressRoute.RemoteLinkAddress = linkAddr2
+	pkt.NetworkProtocolNumber = ipv4.ProtocolNumber
+	var pkts stack.PacketBufferList
+	pkts.PushBack(pkt)
+	n, tcpipErr := veth1.endpoint.WritePackets(pkts)
+	pkts.DecRef()
+	if tcpipErr != nil {
+		t.Fatalf("WritePackets(_) = %s", tcpipErr)
+	}
+	if n != 1 {
+		t.Fatalf("got WritePackets(_) = %d, want = 1", n)
+	}
+	if got := ns.stack.NICInfo()[veth2.nicid].Stats.Rx.Packets.Value(); got != 1 {
+		t.Errorf("got %d packets received by the other end of the pair, want = 1", got)
+	}
+}
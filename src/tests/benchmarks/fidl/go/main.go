@@ -54,8 +54,15 @@ func main() {
 	}
 }
 
+func allBenchmarks() []benchmark_suite.Benchmark {
+	var benchmarks []benchmark_suite.Benchmark
+	benchmarks = append(benchmarks, benchmark_suite.Benchmarks...)
+	benchmarks = append(benchmarks, benchmark_suite.TransportBenchmarks...)
+	return benchmarks
+}
+
 func stdout() {
-	for _, b := range benchmark_suite.Benchmarks {
+	for _, b := range allBenchmarks() {
 		result := testing.Benchmark(b.BenchFunc)
 		fmt.Printf("Benchmark%s    %s\n", b.Label, result)
 	}
@@ -63,7 +70,7 @@ func stdout() {
 
 func outputFile(outputFilename string) {
 	var results benchmarking.TestResultsFile
-	for _, b := range benchmark_suite.Benchmarks {
+	for _, b := range allBenchmarks() {
 		results = append(results, runFuchsiaPerfBenchmark(b, testSuite)...)
 	}
 
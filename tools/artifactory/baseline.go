@@ -0,0 +1,76 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Baseline is the object manifest of a previous upload to the same store. An
+// Uploader with a baseline makes a differential upload: objects whose
+// contents are unchanged since the baseline, but that don't exist yet under
+// their new names, are copied within the store from the objects that already
+// hold their contents instead of being uploaded again.
+type Baseline struct {
+	// records maps the name an object would have in the current upload to
+	// the record of the object in the previous upload.
+	records map[string]ObjectRecord
+}
+
+// NewBaseline returns a Baseline for the object manifest of a previous upload.
+//
+// Objects that were uploaded under prevNamespace are matched against objects
+// under namespace in the current upload; all other objects, like blobs and
+// debug binaries, are matched by name.
+func NewBaseline(records []ObjectRecord, prevNamespace, namespace string) *Baseline {
+	b := &Baseline{records: make(map[string]ObjectRecord, len(records))}
+	for _, r := range records {
+		name := r.Name
+		if prevNamespace != "" && strings.HasPrefix(name, prevNamespace+"/") {
+			name = namespace + strings.TrimPrefix(name, prevNamespace)
+		}
+		b.records[name] = r
+	}
+	return b
+}
+
+// lookup returns the record of the object in the previous upload that
+// corresponds to the named object, if its contents match sums.
+func (b *Baseline) lookup(name string, sums checksums) (ObjectRecord, bool) {
+	if b == nil {
+		return ObjectRecord{}, false
+	}
+	prev, ok := b.records[name]
+	if !ok {
+		return ObjectRecord{}, false
+	}
+	attrs, err := prev.attrs()
+	if err != nil || !sums.matches(attrs) {
+		return ObjectRecord{}, false
+	}
+	return prev, true
+}
+
+// attrs returns the attributes recorded for the object.
+func (r ObjectRecord) attrs() (*ObjectAttrs, error) {
+	md5, err := base64.StdEncoding.DecodeString(r.MD5)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MD5 hash for %s: %w", r.Name, err)
+	}
+	crc, err := base64.StdEncoding.DecodeString(r.CRC32C)
+	if err != nil || len(crc) != 4 {
+		return nil, fmt.Errorf("invalid CRC32C checksum for %s", r.Name)
+	}
+	return &ObjectAttrs{
+		Size:       r.Size,
+		MD5:        md5,
+		CRC32C:     binary.BigEndian.Uint32(crc),
+		HasCRC32C:  true,
+		Generation: r.Generation,
+	}, nil
+}
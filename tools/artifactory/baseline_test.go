@@ -0,0 +1,96 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// attrsCountingStore is a memStore that records the objects whose attributes
+// were requested.
+type attrsCountingStore struct {
+	*memStore
+	attrs []string
+}
+
+func (s *attrsCountingStore) Attrs(ctx context.Context, name string) (*ObjectAttrs, error) {
+	s.attrs = append(s.attrs, name)
+	return s.memStore.Attrs(ctx, name)
+}
+
+func TestDifferentialUpload(t *testing.T) {
+	ctx := context.Background()
+	store := &attrsCountingStore{memStore: &memStore{objects: make(map[string][]byte)}}
+	u := NewUploader(store, t.TempDir())
+
+	first := []Upload{
+		{Contents: []byte("blob"), Destination: "blobs/abc"},
+		{Contents: []byte("image"), Destination: "build1/images/zbi"},
+		{Contents: []byte("old"), Destination: "build1/build-ids.txt"},
+	}
+	prev, err := u.Upload(ctx, first)
+	if err != nil {
+		t.Fatalf("Upload() failed: %s", err)
+	}
+
+	u.SetBaseline(NewBaseline(prev, "build1", "build2"))
+	store.writes, store.attrs = nil, nil
+	second := []Upload{
+		{Contents: []byte("blob"), Destination: "blobs/abc"},
+		{Contents: []byte("image"), Destination: "build2/images/zbi"},
+		{Contents: []byte("new"), Destination: "build2/build-ids.txt"},
+		{Contents: []byte("blob2"), Destination: "blobs/def"},
+	}
+	records, err := u.Upload(ctx, second)
+	if err != nil {
+		t.Fatalf("Upload() failed: %s", err)
+	}
+
+	if diff := cmp.Diff([]string{"build2/build-ids.txt", "blobs/def"}, store.writes); diff != "" {
+		t.Errorf("unexpected writes (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"build2/images/zbi"}, store.copies); diff != "" {
+		t.Errorf("unexpected copies (-want +got):\n%s", diff)
+	}
+	// Every object is looked up, so that none is recorded without existing
+	// under its own name.
+	if diff := cmp.Diff([]string{"blobs/abc", "build2/images/zbi", "build2/build-ids.txt", "blobs/def"}, store.attrs); diff != "" {
+		t.Errorf("unexpected store lookups (-want +got):\n%s", diff)
+	}
+	wantRecords := []ObjectRecord{
+		{Name: "blobs/abc", Size: 4, Generation: 3, Skipped: true},
+		{Name: "build2/images/zbi", Size: 5, Generation: 4, CopiedFrom: "build1/images/zbi"},
+		{Name: "build2/build-ids.txt", Size: 3, Generation: 5},
+		{Name: "blobs/def", Size: 5, Generation: 6},
+	}
+	if diff := cmp.Diff(wantRecords, records, cmpopts.IgnoreFields(ObjectRecord{}, "MD5", "CRC32C")); diff != "" {
+		t.Errorf("unexpected records (-want +got):\n%s", diff)
+	}
+	for _, r := range records {
+		if _, ok := store.objects[r.Name]; !ok {
+			t.Errorf("%s was recorded but doesn't exist", r.Name)
+		}
+	}
+
+	t.Run("uploads objects missing from the store", func(t *testing.T) {
+		delete(store.objects, "build2/images/zbi")
+		store.writes, store.copies = nil, nil
+		u.SetBaseline(NewBaseline(records, "build2", "build3"))
+		records, err := u.Upload(ctx, []Upload{{Contents: []byte("image"), Destination: "build3/images/zbi"}})
+		if err != nil {
+			t.Fatalf("Upload() failed: %s", err)
+		}
+		if len(records) != 1 || records[0].CopiedFrom != "" {
+			t.Errorf("got records %+v, want an uploaded object", records)
+		}
+		if diff := cmp.Diff([]string{"build3/images/zbi"}, store.writes); diff != "" {
+			t.Errorf("unexpected writes (-want +got):\n%s", diff)
+		}
+	})
+}
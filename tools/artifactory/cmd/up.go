@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"runtime"
 	"strings"
 
 	"github.com/google/subcommands"
@@ -58,9 +59,19 @@ const (
 	// A list of all Public Platform Surface Areas.
 	ctsPlasaReportName = "test_coverage_report.plasa.json"
 
+	// Metrics of a direct upload.
+	uploadMetricsName = "upload_metrics.json"
+
+	// The index of a direct upload, uploaded last to mark it as complete.
+	buildIndexName = "index.json"
+
 	// The ELF sizes manifest.
 	elfSizesManifestName = "elf_sizes.json"
 
+	// The SBOM of the build and the links from uploaded objects to it.
+	sbomName      = "sbom.spdx.json"
+	sbomLinksName = "sbom_links.json"
+
 	// A mapping of fidl mangled names to api functions.
 	fidlMangledToApiMappingManifestName = "ctf_fidl_mangled_to_api_mapping.json"
 )
@@ -71,11 +82,38 @@ type upCommand struct {
 	// Whether to emit upload manifest JSON to this path instead of executing
 	// uploads.
 	uploadManifestJSONOutput string
+	// URL of the store to upload artifacts to directly.
+	destination string
+	// Path to which to write a manifest of the objects uploaded to
+	// destination.
+	objectManifestJSONOutput string
+	// Path to the object manifest of a previous build, against which to make
+	// a differential upload.
+	baselineObjectManifest string
+	// Namespace of the build that produced baselineObjectManifest.
+	baselineNamespace string
+	// Maximum number of objects to upload to destination at once.
+	uploadConcurrency int
+	// Maximum number of blocks to compress at once when staging compressed
+	// objects.
+	compressConcurrency int
+	// Number of retries that may be made across all requests to destination.
+	retryBudget int64
+	// Path to which to write the metrics of the upload to destination.
+	uploadMetricsJSONOutput string
+	// Key with which to sign the objects that should be signed: a path to an
+	// ed25519 private key, or a gcpkms:// URL.
+	signingKey string
+	// Path to an SPDX JSON SBOM of the build, to which to link the uploaded
+	// objects.
+	sbom string
 }
 
 func (upCommand) Name() string { return "up" }
 
-func (upCommand) Synopsis() string { return "emit a GCS upload manifest for a build" }
+func (upCommand) Synopsis() string {
+	return "emit a GCS upload manifest for a build, or upload it directly"
+}
 
 func (upCommand) Usage() string {
 	return `
@@ -93,11 +131,14 @@ Emits a GCS upload manifest for a build with the following structure:
 │   │   ├── buildid
 │   │   │   └── <debug binaries in debuginfod format>
 │   │   ├── $NAMESPACE
+│   │   │   ├── index.json
 │   │   │   ├── build-ids.json
 │   │   │   ├── build-ids.txt
 │   │   │   ├── jiri.snapshot
 │   │   │   ├── objs_to_refresh_ttl.txt
 │   │   │   ├── publickey.pem
+│   │   │   ├── sbom.spdx.json
+│   │   │   ├── sbom_links.json
 │   │   │   ├── images
 │   │   │   │   └── <images>
 │   │   │   │   └── transfer.json
@@ -132,6 +173,56 @@ Emits a GCS upload manifest for a build with the following structure:
 
 Where $GCS_BUCKET is defined by the infrastructure.
 
+If -destination is set, the artifacts are uploaded there directly, in the
+same layout. The scheme of the destination URL selects the storage backend:
+gs://<bucket> for GCS, s3://<bucket> for S3 or an S3-compatible service
+(configured by the standard AWS_* environment variables), and file://<dir> or
+a plain path for a local directory. Each object is verified against its MD5
+and CRC32C checksums, and objects that already exist with matching contents
+are skipped, so re-running an interrupted invocation only uploads the objects
+that are missing; GCS uploads also resume a dropped chunk within the same
+run. The upload metrics and build index are overwritten. A manifest of
+the resulting objects (name, size, checksums and generation) is written to
+-object-manifest-json-output for downstream consumers to verify against.
+
+If -baseline-object-manifest is also set to the object manifest of a previous
+build, only objects whose checksums changed since that build are uploaded.
+Objects under -baseline-namespace are compared against the same objects under
+-namespace. Unchanged objects are copied within the store instead of being
+uploaded again, and their entries in the object manifest carry a "copied_from"
+naming the object they were copied from.
+
+Uploads to -destination run -upload-concurrency at a time. When the store
+throttles requests, the concurrency is halved, and it recovers as uploads
+succeed. Failed requests are retried from a single -retry-budget shared by all
+objects. Metrics of the upload (objects and bytes uploaded, retries and
+throttle events) are uploaded to $NAMESPACE/upload_metrics.json, alongside
+build-ids.json, and written to -upload-metrics-json-output if set.
+
+After everything else, including the metrics, $NAMESPACE/index.json is
+uploaded. It lists each directory of the layout that the build uploaded to,
+with the number, total size and a SHA-256 digest of the objects under it.
+Since it is written last, its presence marks the build's upload as complete.
+
+Objects that are uploaded compressed are gzipped in 1MiB blocks, of which
+-compress-concurrency are compressed at once across all uploads; this also
+bounds the memory used for compression. The output is a single gzip stream that
+does not depend on the concurrency, so unchanged objects are still skipped.
+
+If -signing-key is set, a detached signature of each image, tool and build API
+module, of the image manifest and of the package repository metadata is
+uploaded next to it, with a .sig suffix. The key is either the path to a
+PEM-encoded ed25519 private key or gcpkms:// followed by the resource name of a
+Cloud KMS key version. Signatures are of the SHA-256 digest of the contents
+before compression, and the ID of the key is recorded in the upload manifest
+as the "signature_key_id" of each signed upload.
+
+If -sbom is set to an SPDX 2 JSON document describing the build, it is
+uploaded as $NAMESPACE/sbom.spdx.json, along with $NAMESPACE/sbom_links.json,
+which lists the SPDX IDs of the packages and files whose SHA-256 checksum
+matches each uploaded object, so that compliance tooling can map artifacts to
+their licenses.
+
 flags:
 
 `
@@ -140,6 +231,16 @@ flags:
 func (cmd *upCommand) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.namespace, "namespace", "", "Namespace under which to index artifacts.")
 	f.StringVar(&cmd.uploadManifestJSONOutput, "upload-manifest-json-output", "", "Whether to emit upload manifest to this path instead of executing uploads.")
+	f.StringVar(&cmd.destination, "destination", "", "URL to upload artifacts to directly: gs://<bucket>, s3://<bucket> or a local directory.")
+	f.StringVar(&cmd.objectManifestJSONOutput, "object-manifest-json-output", "", "Path to which to write a manifest of the objects uploaded to -destination.")
+	f.StringVar(&cmd.baselineObjectManifest, "baseline-object-manifest", "", "Path to the object manifest of a previous build; only objects changed since then are uploaded.")
+	f.StringVar(&cmd.baselineNamespace, "baseline-namespace", "", "Namespace of the build that produced -baseline-object-manifest.")
+	f.IntVar(&cmd.uploadConcurrency, "upload-concurrency", 16, "Maximum number of objects to upload to -destination at once.")
+	f.IntVar(&cmd.compressConcurrency, "compress-concurrency", runtime.GOMAXPROCS(0), "Maximum number of 1MiB blocks to compress at once when uploading compressed objects to -destination.")
+	f.Int64Var(&cmd.retryBudget, "retry-budget", artifactory.DefaultRetryBudget, "Number of retries that may be made across all requests to -destination.")
+	f.StringVar(&cmd.uploadMetricsJSONOutput, "upload-metrics-json-output", "", "Path to which to write the metrics of the upload to -destination.")
+	f.StringVar(&cmd.signingKey, "signing-key", "", "Path to an ed25519 private key, or gcpkms://<key version>, with which to sign images and manifests.")
+	f.StringVar(&cmd.sbom, "sbom", "", "Path to an SPDX JSON SBOM of the build, to upload and link the uploaded objects to.")
 }
 
 func (cmd upCommand) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -160,8 +261,20 @@ func (cmd upCommand) execute(ctx context.Context, buildDir string) error {
 	if cmd.namespace == "" {
 		return fmt.Errorf("-namespace is required")
 	}
-	if cmd.uploadManifestJSONOutput == "" {
-		return fmt.Errorf("-upload-manifest-json-output is required")
+	if cmd.uploadManifestJSONOutput == "" && cmd.destination == "" {
+		return fmt.Errorf("one of -upload-manifest-json-output or -destination is required")
+	}
+	if cmd.objectManifestJSONOutput != "" && cmd.destination == "" {
+		return fmt.Errorf("-object-manifest-json-output requires -destination")
+	}
+	if cmd.baselineObjectManifest != "" && cmd.destination == "" {
+		return fmt.Errorf("-baseline-object-manifest requires -destination")
+	}
+	if cmd.uploadMetricsJSONOutput != "" && cmd.destination == "" {
+		return fmt.Errorf("-upload-metrics-json-output requires -destination")
+	}
+	if cmd.baselineNamespace != "" && cmd.baselineObjectManifest == "" {
+		return fmt.Errorf("-baseline-namespace requires -baseline-object-manifest")
 	}
 
 	m, err := build.NewModules(buildDir)
@@ -188,6 +301,7 @@ func (cmd upCommand) execute(ctx context.Context, buildDir string) error {
 			Source:      metadataDir,
 			Destination: path.Join(packageNamespaceDir, metadataDirName),
 			Deduplicate: false,
+			Signed:      true,
 		},
 		{
 			Source:      keyDir,
@@ -300,12 +414,149 @@ func (cmd upCommand) execute(ctx context.Context, buildDir string) error {
 		return err
 	}
 
-	out, err := os.Create(cmd.uploadManifestJSONOutput)
+	// Signing and linking to the SBOM share the digests of the uploads, so
+	// that each object is read once.
+	var digests artifactory.Digests
+	if cmd.sbom != "" || cmd.signingKey != "" {
+		digests, err = artifactory.ComputeDigests(ctx, uploads)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cmd.sbom != "" {
+		sbom, err := sbomUploads(uploads, digests, cmd.sbom, cmd.namespace)
+		if err != nil {
+			return err
+		}
+		uploads = append(uploads, sbom...)
+	}
+
+	if cmd.signingKey != "" {
+		signer, err := artifactory.NewSigner(ctx, cmd.signingKey)
+		if err != nil {
+			return fmt.Errorf("failed to load -signing-key: %w", err)
+		}
+		uploads, err = artifactory.SignUploads(ctx, uploads, digests, signer)
+		if err != nil {
+			return err
+		}
+		logger.Infof(ctx, "signed uploads with key %s", signer.KeyID())
+	}
+
+	if cmd.uploadManifestJSONOutput != "" {
+		if err := writeJSON(cmd.uploadManifestJSONOutput, uploads); err != nil {
+			return err
+		}
+	}
+	if cmd.destination == "" {
+		return nil
+	}
+
+	store, err := artifactory.NewStore(ctx, cmd.destination)
+	if err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp("", "artifactory")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	uploader := artifactory.NewUploader(store, tmpDir)
+	uploader.SetMaxConcurrency(cmd.uploadConcurrency)
+	uploader.SetCompressConcurrency(cmd.compressConcurrency)
+	uploader.SetRetryBudget(cmd.retryBudget)
+	if cmd.baselineObjectManifest != "" {
+		var baseline []artifactory.ObjectRecord
+		if err := readJSON(cmd.baselineObjectManifest, &baseline); err != nil {
+			return fmt.Errorf("failed to read baseline object manifest: %w", err)
+		}
+		uploader.SetBaseline(artifactory.NewBaseline(baseline, cmd.baselineNamespace, cmd.namespace))
+	}
+	records, err := uploader.Upload(ctx, uploads)
+	if err != nil {
+		return err
+	}
+
+	metrics := uploader.Metrics()
+	logger.Infof(ctx, "uploaded %d objects (%d bytes) and skipped %d, with %d retries and %d throttle events",
+		metrics.ObjectsUploaded, metrics.BytesUploaded, metrics.ObjectsSkipped, metrics.Retries, metrics.ThrottleEvents)
+	metricsJSON, err := json.MarshalIndent(metrics, "", "  ")
+	if err != nil {
+		return err
+	}
+	metricsRecords, err := uploader.Upload(ctx, []artifactory.Upload{{
+		Contents:    metricsJSON,
+		Destination: path.Join(cmd.namespace, uploadMetricsName),
+		Overwrite:   true,
+	}})
+	if err != nil {
+		return err
+	}
+	records = append(records, metricsRecords...)
+	if cmd.uploadMetricsJSONOutput != "" {
+		if err := writeJSON(cmd.uploadMetricsJSONOutput, metrics); err != nil {
+			return err
+		}
+	}
+
+	// The index must be uploaded last: its presence tells consumers that
+	// every object it lists is in place.
+	indexJSON, err := json.MarshalIndent(artifactory.NewBuildIndex(cmd.namespace, records), "", "  ")
+	if err != nil {
+		return err
+	}
+	indexRecords, err := uploader.Upload(ctx, []artifactory.Upload{{
+		Contents:    indexJSON,
+		Destination: path.Join(cmd.namespace, buildIndexName),
+		Overwrite:   true,
+	}})
+	if err != nil {
+		return err
+	}
+	records = append(records, indexRecords...)
+
+	if cmd.objectManifestJSONOutput != "" {
+		return writeJSON(cmd.objectManifestJSONOutput, records)
+	}
+	return nil
+}
+
+// sbomUploads returns the uploads of the SBOM at sbomPath and of the links from
+// uploads, whose digests are given, to it.
+func sbomUploads(uploads []artifactory.Upload, digests artifactory.Digests, sbomPath, namespace string) ([]artifactory.Upload, error) {
+	sbom, err := artifactory.LoadSBOM(sbomPath)
+	if err != nil {
+		return nil, err
+	}
+	sbomDest := path.Join(namespace, sbomName)
+	links, err := artifactory.LinkSBOM(uploads, digests, sbom, sbomDest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to link uploads to the SBOM: %w", err)
+	}
+	linksJSON, err := json.MarshalIndent(links, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []artifactory.Upload{
+		{
+			Source:      sbomPath,
+			Destination: sbomDest,
+		},
+		{
+			Contents:    linksJSON,
+			Destination: path.Join(namespace, sbomLinksName),
+		},
+	}, nil
+}
+
+func writeJSON(filename string, v interface{}) error {
+	out, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
-	data, err := json.MarshalIndent(uploads, "", "  ")
+	data, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -313,6 +564,14 @@ func (cmd upCommand) execute(ctx context.Context, buildDir string) error {
 	return err
 }
 
+func readJSON(filename string, v interface{}) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
 // filterNonExistentFiles filters out files which do not exist. The associated
 // artifacts referenced by the build API manifests may not have been created,
 // and this is valid.
@@ -0,0 +1,212 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+const (
+	// compressBlockSize is the size of the blocks of input that are
+	// compressed concurrently.
+	compressBlockSize = 1 << 20
+
+	// flateWindowSize is the size of the window within which deflate finds
+	// back-references, and so of the dictionary each block is compressed with.
+	flateWindowSize = 32 << 10
+)
+
+var errWriterClosed = errors.New("write to closed writer")
+
+// SetCompressConcurrency sets the maximum number of blocks that are
+// compressed at once, across all of the objects that are compressed before
+// being uploaded. It also bounds the memory used for compression, which is
+// about twice this number of 1MiB blocks, plus one block per object being
+// compressed.
+func (u *Uploader) SetCompressConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	u.compressTokens = make(chan struct{}, n)
+}
+
+// parallelGzipWriter is an io.WriteCloser that gzips its input, compressing
+// blocks of it concurrently.
+//
+// The output is a single gzip member, like that of gzip.Writer, so any gzip
+// reader can decompress it. Each block is deflated with the end of the
+// previous block as its dictionary, so that back-references may cross block
+// boundaries, and is flushed to a byte boundary, so that the compressed blocks
+// may simply be concatenated. The output depends only on the input, not on how
+// many blocks are compressed at once.
+type parallelGzipWriter struct {
+	w         io.Writer
+	blockSize int
+	// tokens holds one token per block that is being compressed or waiting
+	// to be written out. It may be shared by several writers.
+	tokens chan struct{}
+
+	// buf holds the input of the next block.
+	buf []byte
+	// dict holds the last flateWindowSize bytes of the input before buf.
+	dict []byte
+	// crc and size are the CRC-32 and size, modulo 2^32, of the input so far,
+	// for the gzip trailer.
+	crc  uint32
+	size uint32
+
+	// blocks queues the blocks to write out, in order.
+	blocks chan chan compressedBlock
+	// done is closed once all of the blocks have been written out.
+	done   chan struct{}
+	closed bool
+
+	errMu sync.Mutex
+	// writeErr is the first error encountered writing out the blocks.
+	writeErr error
+}
+
+type compressedBlock struct {
+	data []byte
+	err  error
+}
+
+func newParallelGzipWriter(w io.Writer, blockSize int, tokens chan struct{}) *parallelGzipWriter {
+	z := &parallelGzipWriter{
+		w:         w,
+		blockSize: blockSize,
+		tokens:    tokens,
+		buf:       make([]byte, 0, blockSize),
+		blocks:    make(chan chan compressedBlock, cap(tokens)),
+		done:      make(chan struct{}),
+	}
+	go z.writeBlocks()
+	return z
+}
+
+func (z *parallelGzipWriter) err() error {
+	z.errMu.Lock()
+	defer z.errMu.Unlock()
+	return z.writeErr
+}
+
+func (z *parallelGzipWriter) setErr(err error) {
+	z.errMu.Lock()
+	defer z.errMu.Unlock()
+	if z.writeErr == nil {
+		z.writeErr = err
+	}
+}
+
+// writeBlocks writes the gzip header and then each compressed block to z.w as
+// it becomes ready, releasing its token.
+func (z *parallelGzipWriter) writeBlocks() {
+	defer close(z.done)
+	// The header of a gzip member with no optional fields, no modification
+	// time and an unknown OS, as written by gzip.Writer.
+	if _, err := z.w.Write([]byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255}); err != nil {
+		z.setErr(err)
+	}
+	for block := range z.blocks {
+		b := <-block
+		if b.err != nil {
+			z.setErr(b.err)
+		} else if z.err() == nil {
+			if _, err := z.w.Write(b.data); err != nil {
+				z.setErr(err)
+			}
+		}
+		<-z.tokens
+	}
+}
+
+func (z *parallelGzipWriter) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, errWriterClosed
+	}
+	n := 0
+	for len(p) > 0 {
+		if err := z.err(); err != nil {
+			return n, err
+		}
+		m := copy(z.buf[len(z.buf):z.blockSize], p)
+		z.buf = z.buf[:len(z.buf)+m]
+		n += m
+		p = p[m:]
+		if len(z.buf) == z.blockSize {
+			z.compressBlock(false)
+		}
+	}
+	return n, nil
+}
+
+// compressBlock starts compressing the buffered input as the next block,
+// waiting for a token first. The last block ends the deflate stream.
+func (z *parallelGzipWriter) compressBlock(last bool) {
+	data, dict := z.buf, z.dict
+	z.crc = crc32.Update(z.crc, crc32.IEEETable, data)
+	z.size += uint32(len(data))
+	if len(data) >= flateWindowSize {
+		z.dict = data[len(data)-flateWindowSize:]
+	} else {
+		z.dict = append(append([]byte(nil), dict...), data...)
+		if len(z.dict) > flateWindowSize {
+			z.dict = z.dict[len(z.dict)-flateWindowSize:]
+		}
+	}
+	z.buf = make([]byte, 0, z.blockSize)
+
+	z.tokens <- struct{}{}
+	block := make(chan compressedBlock, 1)
+	go func() {
+		data, err := deflateBlock(data, dict, last)
+		block <- compressedBlock{data: data, err: err}
+	}()
+	z.blocks <- block
+}
+
+func deflateBlock(data, dict []byte, last bool) ([]byte, error) {
+	var out bytes.Buffer
+	fw, err := flate.NewWriterDict(&out, flate.DefaultCompression, dict)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return nil, err
+	}
+	if last {
+		err = fw.Close()
+	} else {
+		err = fw.Flush()
+	}
+	return out.Bytes(), err
+}
+
+// Close compresses the remaining input, waits for all of the blocks to be
+// written out and writes the gzip trailer. It does not close the underlying
+// writer. Closing an already closed writer has no effect.
+func (z *parallelGzipWriter) Close() error {
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+	z.compressBlock(true)
+	close(z.blocks)
+	<-z.done
+	if err := z.err(); err != nil {
+		return err
+	}
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], z.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], z.size)
+	_, err := z.w.Write(trailer[:])
+	return err
+}
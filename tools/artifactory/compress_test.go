@@ -0,0 +1,101 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func parallelGzip(t *testing.T, data []byte, blockSize, concurrency int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	z := newParallelGzipWriter(&buf, blockSize, make(chan struct{}, concurrency))
+	// Write in uneven chunks so that writes straddle block boundaries.
+	for p := data; len(p) > 0; {
+		n := len(p)
+		if n > 37 {
+			n = 37
+		}
+		if _, err := z.Write(p[:n]); err != nil {
+			t.Fatalf("Write() = %s", err)
+		}
+		p = p[n:]
+	}
+	if err := z.Close(); err != nil {
+		t.Fatalf("Close() = %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParallelGzipWriter(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	random := make([]byte, 3*flateWindowSize+5)
+	r.Read(random)
+	repeated := bytes.Repeat([]byte("fuchsia host test "), 10000)
+
+	for _, tc := range []struct {
+		name      string
+		data      []byte
+		blockSize int
+	}{
+		{name: "empty", data: nil, blockSize: 1024},
+		{name: "single block", data: []byte("hello"), blockSize: 1024},
+		{name: "exact blocks", data: repeated[:4096], blockSize: 1024},
+		{name: "small blocks", data: repeated, blockSize: 1000},
+		{name: "blocks larger than the window", data: random, blockSize: flateWindowSize + 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			compressed := parallelGzip(t, tc.data, tc.blockSize, 4)
+
+			zr, err := gzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("gzip.NewReader() = %s", err)
+			}
+			// The output must be a single gzip member.
+			zr.Multistream(false)
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("failed to decompress: %s", err)
+			}
+			if !bytes.Equal(got, tc.data) {
+				t.Errorf("decompressed %d bytes that differ from the %d bytes written", len(got), len(tc.data))
+			}
+			if _, err := zr.Read(nil); err != io.EOF {
+				t.Errorf("got %v after the gzip member, want EOF", err)
+			}
+
+			if serial := parallelGzip(t, tc.data, tc.blockSize, 1); !bytes.Equal(compressed, serial) {
+				t.Errorf("output depends on the number of blocks compressed at once")
+			}
+		})
+	}
+}
+
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+func TestParallelGzipWriterError(t *testing.T) {
+	wantErr := errors.New("write failed")
+	z := newParallelGzipWriter(failingWriter{err: wantErr}, 16, make(chan struct{}, 2))
+	// Writes may succeed while earlier blocks are being compressed, but the
+	// error must be reported by the time the writer is closed.
+	z.Write(bytes.Repeat([]byte("x"), 100))
+	if err := z.Close(); !errors.Is(err, wantErr) {
+		t.Errorf("Close() = %v, want %s", err, wantErr)
+	}
+	if _, err := z.Write([]byte("x")); err == nil {
+		t.Errorf("Write() after Close() succeeded")
+	}
+}
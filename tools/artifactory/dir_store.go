@@ -0,0 +1,100 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// dirStore is a Store backed by a local directory. Objects are stored as files
+// at their names relative to the directory.
+type dirStore struct {
+	root string
+}
+
+func newDirStore(root string) (*dirStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("local destination must specify a directory")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &dirStore{root: root}, nil
+}
+
+func (s *dirStore) path(name string) string {
+	return filepath.Join(s.root, filepath.FromSlash(name))
+}
+
+func (s *dirStore) Attrs(_ context.Context, name string) (*ObjectAttrs, error) {
+	f, err := os.Open(s.path(name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", name, ErrObjectNotExist)
+		}
+		return nil, err
+	}
+	defer f.Close()
+	sums, err := computeChecksums(f)
+	if err != nil {
+		return nil, err
+	}
+	attrs := sums.attrs()
+	return &attrs, nil
+}
+
+// Write writes the object to a temporary file first and renames it into
+// place, so that an interrupted write never leaves a partial object behind.
+func (s *dirStore) Write(_ context.Context, name string, open func() (io.ReadCloser, error), _ ObjectAttrs, _ string) (*ObjectAttrs, error) {
+	dst := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return nil, err
+	}
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	sums, err := computeChecksums(io.TeeReader(r, f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(f.Name(), dst); err != nil {
+		return nil, err
+	}
+	attrs := sums.attrs()
+	return &attrs, nil
+}
+
+func (s *dirStore) Copy(ctx context.Context, src, dst string) (*ObjectAttrs, error) {
+	if _, err := os.Stat(s.path(src)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", src, ErrObjectNotExist)
+		}
+		return nil, err
+	}
+	return s.Write(ctx, dst, func() (io.ReadCloser, error) {
+		return os.Open(s.path(src))
+	}, ObjectAttrs{}, "")
+}
@@ -0,0 +1,134 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// The size of the chunks in which objects are sent to GCS, which bounds the
+	// memory buffered for each upload.
+	uploadChunkSize = 16 * 1024 * 1024
+
+	// How long a chunk of a resumable upload is retried before the whole
+	// upload fails and is left to the Uploader to restart.
+	chunkRetryDeadline = 2 * time.Minute
+)
+
+// gcsStore is a Store backed by a GCS bucket.
+type gcsStore struct {
+	bkt    *storage.BucketHandle
+	prefix string
+}
+
+func newGCSStore(ctx context.Context, bucket, prefix string) (*gcsStore, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("GCS destination must specify a bucket")
+	}
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	return &gcsStore{
+		bkt:    client.Bucket(bucket),
+		prefix: strings.Trim(prefix, "/"),
+	}, nil
+}
+
+func (s *gcsStore) object(name string) *storage.ObjectHandle {
+	return s.bkt.Object(path.Join(s.prefix, name))
+}
+
+func gcsObjectAttrs(attrs *storage.ObjectAttrs) *ObjectAttrs {
+	return &ObjectAttrs{
+		Size:       attrs.Size,
+		MD5:        attrs.MD5,
+		CRC32C:     attrs.CRC32C,
+		HasCRC32C:  true,
+		Generation: attrs.Generation,
+	}
+}
+
+func (s *gcsStore) Attrs(ctx context.Context, name string) (*ObjectAttrs, error) {
+	attrs, err := s.object(name).Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, fmt.Errorf("%s: %w", name, ErrObjectNotExist)
+		}
+		return nil, gcsError(err)
+	}
+	return gcsObjectAttrs(attrs), nil
+}
+
+func (s *gcsStore) Write(ctx context.Context, name string, open func() (io.ReadCloser, error), want ObjectAttrs, contentEncoding string) (*ObjectAttrs, error) {
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// A non-zero ChunkSize makes the writer use a resumable upload session.
+	// Retrying every chunk, even though the write has no preconditions, is
+	// safe because the session only commits the object once all of it has
+	// been received, and a retried chunk resumes from the last byte GCS
+	// committed instead of restarting the object.
+	w := s.object(name).Retryer(storage.WithPolicy(storage.RetryAlways)).NewWriter(ctx)
+	w.ChunkSize = uploadChunkSize
+	w.ChunkRetryDeadline = chunkRetryDeadline
+	w.MD5 = want.MD5
+	w.CRC32C = want.CRC32C
+	w.SendCRC32C = want.HasCRC32C
+	w.ContentEncoding = contentEncoding
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return nil, gcsError(err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, gcsError(err)
+	}
+	return gcsObjectAttrs(w.Attrs()), nil
+}
+
+func (s *gcsStore) Copy(ctx context.Context, src, dst string) (*ObjectAttrs, error) {
+	attrs, err := s.object(dst).CopierFrom(s.object(src)).Run(ctx)
+	if err != nil {
+		var apiErr *googleapi.Error
+		if errors.Is(err, storage.ErrObjectNotExist) || errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return nil, fmt.Errorf("%s: %w", src, ErrObjectNotExist)
+		}
+		return nil, gcsError(err)
+	}
+	return gcsObjectAttrs(attrs), nil
+}
+
+// gcsError classifies an error from GCS for the Uploader's retries: rate
+// limiting is reported as ErrThrottled, and any failure that isn't clearly
+// permanent as ErrTransient.
+func gcsError(err error) error {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return fmt.Errorf("%w: %s", ErrThrottled, err)
+		case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusPreconditionFailed:
+			return err
+		}
+	}
+	if errors.Is(err, storage.ErrBucketNotExist) || errors.Is(err, context.Canceled) {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrTransient, err)
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BuildIndexVersion is the version of the layout described by a BuildIndex.
+const BuildIndexVersion = 2
+
+// BuildIndex lists the objects uploaded for a build. It is uploaded after
+// every other object of the build, so that its presence marks the upload as
+// complete: consumers that find it may rely on all of the objects it accounts
+// for being in place, instead of racing a partial upload.
+type BuildIndex struct {
+	// Version is the version of the layout, BuildIndexVersion.
+	Version int `json:"version"`
+
+	// Namespace is the namespace of the build.
+	Namespace string `json:"namespace"`
+
+	// Namespaces summarizes the objects under each directory of the layout
+	// that the build uploaded to, ordered by name.
+	Namespaces []NamespaceIndex `json:"namespaces"`
+}
+
+// NamespaceIndex summarizes the objects uploaded for a build under one
+// directory of the layout, like $NAMESPACE/images or the shared blobs
+// directory.
+type NamespaceIndex struct {
+	// Name is the directory, relative to the destination. Objects directly
+	// under the build's namespace are listed under the namespace itself.
+	Name string `json:"name"`
+
+	// Objects is the number of objects, including copies and objects that
+	// already existed.
+	Objects int `json:"objects"`
+
+	// Bytes is the total size of the objects.
+	Bytes int64 `json:"bytes"`
+
+	// Digest is the hex-encoded SHA-256 hash of a line of the form
+	// "<name> <md5> <crc32c>\n" per object, in name order, with the checksums
+	// as in ObjectRecord. Consumers can recompute it from the object manifest
+	// or from a listing of the store.
+	Digest string `json:"digest"`
+}
+
+// NewBuildIndex returns the index of the objects uploaded for the build with
+// the given namespace.
+func NewBuildIndex(namespace string, records []ObjectRecord) BuildIndex {
+	byNamespace := make(map[string][]ObjectRecord)
+	for _, r := range records {
+		ns := indexNamespace(namespace, r.Name)
+		byNamespace[ns] = append(byNamespace[ns], r)
+	}
+
+	index := BuildIndex{
+		Version:    BuildIndexVersion,
+		Namespace:  namespace,
+		Namespaces: make([]NamespaceIndex, 0, len(byNamespace)),
+	}
+	for name, records := range byNamespace {
+		sort.Slice(records, func(i, j int) bool {
+			return records[i].Name < records[j].Name
+		})
+		ns := NamespaceIndex{Name: name, Objects: len(records)}
+		h := sha256.New()
+		for _, r := range records {
+			ns.Bytes += r.Size
+			fmt.Fprintf(h, "%s %s %s\n", r.Name, r.MD5, r.CRC32C)
+		}
+		ns.Digest = hex.EncodeToString(h.Sum(nil))
+		index.Namespaces = append(index.Namespaces, ns)
+	}
+	sort.Slice(index.Namespaces, func(i, j int) bool {
+		return index.Namespaces[i].Name < index.Namespaces[j].Name
+	})
+	return index
+}
+
+// indexNamespace returns the directory of the layout under which the named
+// object is listed: the first directory below the build's namespace for the
+// build's own objects, and the top-level directory for shared ones.
+func indexNamespace(namespace, name string) string {
+	prefix := ""
+	if strings.HasPrefix(name, namespace+"/") {
+		prefix = namespace + "/"
+		name = strings.TrimPrefix(name, prefix)
+	}
+	i := strings.Index(name, "/")
+	if i < 0 {
+		return strings.TrimSuffix(prefix, "/")
+	}
+	return prefix + name[:i]
+}
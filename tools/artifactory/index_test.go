@@ -0,0 +1,64 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewBuildIndex(t *testing.T) {
+	records := []ObjectRecord{
+		{Name: "build1/images/zbi", Size: 10, MD5: "bWQ1MQ==", CRC32C: "AAAAAQ=="},
+		{Name: "blobs/def", Size: 3, MD5: "bWQ1Mg==", CRC32C: "AAAAAg=="},
+		{Name: "build1/build-ids.txt", Size: 4, MD5: "bWQ1Mw==", CRC32C: "AAAAAw=="},
+		{Name: "blobs/abc", Size: 5, MD5: "bWQ1NA==", CRC32C: "AAAABA==", Skipped: true},
+		{Name: "build1/images/transfer.json", Size: 2, MD5: "bWQ1NQ==", CRC32C: "AAAABQ=="},
+		{Name: "build10/images/zbi", Size: 1, MD5: "bWQ1Ng==", CRC32C: "AAAABg=="},
+	}
+	digest := func(lines string) string {
+		sum := sha256.Sum256([]byte(lines))
+		return hex.EncodeToString(sum[:])
+	}
+
+	want := BuildIndex{
+		Version:   BuildIndexVersion,
+		Namespace: "build1",
+		Namespaces: []NamespaceIndex{
+			{
+				Name:    "blobs",
+				Objects: 2,
+				Bytes:   8,
+				Digest:  digest("blobs/abc bWQ1NA== AAAABA==\nblobs/def bWQ1Mg== AAAAAg==\n"),
+			},
+			{
+				Name:    "build1",
+				Objects: 1,
+				Bytes:   4,
+				Digest:  digest("build1/build-ids.txt bWQ1Mw== AAAAAw==\n"),
+			},
+			{
+				Name:    "build1/images",
+				Objects: 2,
+				Bytes:   12,
+				Digest:  digest("build1/images/transfer.json bWQ1NQ== AAAABQ==\nbuild1/images/zbi bWQ1MQ== AAAAAQ==\n"),
+			},
+			// Another build's namespace that shares a prefix with this one's
+			// is not mistaken for it.
+			{
+				Name:    "build10",
+				Objects: 1,
+				Bytes:   1,
+				Digest:  digest("build10/images/zbi bWQ1Ng== AAAABg==\n"),
+			},
+		},
+	}
+	if diff := cmp.Diff(want, NewBuildIndex("build1", records)); diff != "" {
+		t.Errorf("NewBuildIndex() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3Service       = "s3"
+	s3DefaultRegion = "us-east-1"
+	s3SignAlgorithm = "AWS4-HMAC-SHA256"
+	// The payload is verified by S3 against Content-MD5 and the CRC32C
+	// checksum instead of a SHA-256 hash, which would require reading each
+	// object an extra time.
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// s3Credentials are the credentials used to sign S3 requests.
+type s3Credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// s3Store is a Store backed by an S3 bucket. It speaks the S3 REST API
+// directly so that it works with any S3-compatible service.
+//
+// It is configured with the standard AWS environment variables:
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and AWS_REGION.
+// AWS_ENDPOINT_URL may be set to use a service other than AWS, in which case
+// path-style requests are made.
+//
+// Objects are uploaded with a single PUT request, so they are limited to 5GB.
+type s3Store struct {
+	client    *http.Client
+	endpoint  *url.URL
+	pathStyle bool
+	bucket    string
+	prefix    string
+	region    string
+	creds     s3Credentials
+	now       func() time.Time
+}
+
+func newS3Store(bucket, prefix string) (*s3Store, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("S3 destination must specify a bucket")
+	}
+	creds := s3Credentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKeyID == "" || creds.secretAccessKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to upload to S3")
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = s3DefaultRegion
+	}
+
+	s := &s3Store{
+		client: http.DefaultClient,
+		bucket: bucket,
+		prefix: strings.Trim(prefix, "/"),
+		region: region,
+		creds:  creds,
+		now:    time.Now,
+	}
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AWS_ENDPOINT_URL %q: %w", endpoint, err)
+		}
+		s.endpoint = u
+		s.pathStyle = true
+	} else {
+		s.endpoint = &url.URL{
+			Scheme: "https",
+			Host:   fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, region),
+		}
+	}
+	return s, nil
+}
+
+func (s *s3Store) objectURL(name string) *url.URL {
+	key := path.Join(s.prefix, name)
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = path.Join("/", u.Path, s.bucket, key)
+	} else {
+		u.Path = "/" + key
+	}
+	// Send the path exactly as it is signed.
+	u.RawPath = awsURIEscape(u.Path)
+	return &u
+}
+
+// do sends a signed request for the named object. Failures that may succeed on
+// retry are reported as ErrTransient, or ErrThrottled if S3 asked for requests
+// to slow down.
+func (s *s3Store) do(ctx context.Context, method, name string, header http.Header, body func() (io.ReadCloser, error), contentLength int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(name).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		r, err := body()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = r
+		req.ContentLength = contentLength
+	}
+	s.sign(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", ErrTransient, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s %s: %s", ErrThrottled, method, name, resp.Status)
+	case resp.StatusCode >= 500:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s %s: %s", ErrTransient, method, name, resp.Status)
+	}
+	return resp, nil
+}
+
+func (s *s3Store) Attrs(ctx context.Context, name string) (*ObjectAttrs, error) {
+	header := http.Header{}
+	header.Set("X-Amz-Checksum-Mode", "ENABLED")
+	resp, err := s.do(ctx, http.MethodHead, name, header, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%s: %w", name, ErrObjectNotExist)
+	default:
+		return nil, fmt.Errorf("HEAD %s: %s", name, resp.Status)
+	}
+	return s3ObjectAttrs(resp.Header, resp.ContentLength)
+}
+
+func (s *s3Store) Write(ctx context.Context, name string, open func() (io.ReadCloser, error), want ObjectAttrs, contentEncoding string) (*ObjectAttrs, error) {
+	header := http.Header{}
+	if len(want.MD5) != 0 {
+		header.Set("Content-Md5", base64.StdEncoding.EncodeToString(want.MD5))
+	}
+	if want.HasCRC32C {
+		header.Set("X-Amz-Checksum-Crc32c", encodeCRC32C(want.CRC32C))
+	}
+	if contentEncoding != "" {
+		header.Set("Content-Encoding", contentEncoding)
+	}
+	resp, err := s.do(ctx, http.MethodPut, name, header, open, want.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("PUT %s: %s: %s", name, resp.Status, msg)
+	}
+	// S3 has verified the contents against the checksums sent with them.
+	attrs, err := s3ObjectAttrs(resp.Header, want.Size)
+	if err != nil {
+		return nil, err
+	}
+	if !attrs.HasCRC32C && want.HasCRC32C {
+		// Some S3-compatible services don't echo the checksum back.
+		attrs.CRC32C, attrs.HasCRC32C = want.CRC32C, true
+	}
+	return attrs, nil
+}
+
+// Copy copies the object with a server-side CopyObject request, asking S3 to
+// compute the CRC32C checksum of the copy so that it can be verified like an
+// upload.
+func (s *s3Store) Copy(ctx context.Context, src, dst string) (*ObjectAttrs, error) {
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", awsURIEscape(path.Join("/", s.bucket, s.prefix, src)))
+	header.Set("X-Amz-Checksum-Algorithm", "CRC32C")
+	resp, err := s.do(ctx, http.MethodPut, dst, header, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%s: %w", src, ErrObjectNotExist)
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("copy %s to %s: %s: %s", src, dst, resp.Status, msg)
+	}
+	// A copy can fail after S3 has already responded with 200 OK, in which
+	// case the body holds an error instead of the result.
+	var result struct {
+		XMLName xml.Name
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.XMLName.Local != "CopyObjectResult" {
+		return nil, fmt.Errorf("%w: copy %s to %s failed", ErrTransient, src, dst)
+	}
+	return s.Attrs(ctx, dst)
+}
+
+// s3ObjectAttrs extracts the attributes of an object from the headers of a
+// response. The ETag is only the MD5 hash of an object that was uploaded in a
+// single part without server-side encryption by KMS, so it is ignored if it
+// doesn't look like one.
+func s3ObjectAttrs(header http.Header, size int64) (*ObjectAttrs, error) {
+	attrs := &ObjectAttrs{Size: size}
+	if etag := strings.Trim(header.Get("Etag"), `"`); len(etag) == 2*16 {
+		if md5, err := hex.DecodeString(etag); err == nil {
+			attrs.MD5 = md5
+		}
+	}
+	if crc := header.Get("X-Amz-Checksum-Crc32c"); crc != "" {
+		b, err := base64.StdEncoding.DecodeString(crc)
+		if err != nil || len(b) != 4 {
+			return nil, fmt.Errorf("invalid CRC32C checksum %q", crc)
+		}
+		attrs.CRC32C, attrs.HasCRC32C = binary.BigEndian.Uint32(b), true
+	}
+	return attrs, nil
+}
+
+func encodeCRC32C(crc uint32) string {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], crc)
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+// sign signs req with AWS Signature Version 4. See
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html.
+func (s *s3Store) sign(req *http.Request) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+	if s.creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEscape(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+
+	scope := strings.Join([]string{date, s.region, s3Service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3SignAlgorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + s.creds.secretAccessKey)
+	for _, part := range []string{date, s.region, s3Service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SignAlgorithm, s.creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsURIEscape escapes a URI path as required by Signature Version 4: every
+// byte other than an unreserved character or '/' is percent-encoded.
+func awsURIEscape(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
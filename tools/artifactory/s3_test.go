@@ -0,0 +1,165 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal S3-compatible server that verifies the checksums of
+// uploaded objects.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	auths   []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auths = append(f.auths, r.Header.Get("Authorization"))
+
+	switch r.Method {
+	case http.MethodHead:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.writeChecksums(w, data)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPut:
+		if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+			src, err := url.PathUnescape(src)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, ok := f.objects[src]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			f.objects[r.URL.Path] = data
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, "<CopyObjectResult><ETag>etag</ETag></CopyObjectResult>")
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sum := md5.Sum(data)
+		if r.Header.Get("Content-Md5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		sums, _ := computeChecksums(bytes.NewReader(data))
+		if r.Header.Get("X-Amz-Checksum-Crc32c") != encodeCRC32C(sums.crc32c) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = data
+		f.writeChecksums(w, data)
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) writeChecksums(w http.ResponseWriter, data []byte) {
+	sum := md5.Sum(data)
+	sums, _ := computeChecksums(bytes.NewReader(data))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	w.Header().Set("X-Amz-Checksum-Crc32c", encodeCRC32C(sums.crc32c))
+}
+
+func TestS3Store(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_ENDPOINT_URL", server.URL)
+
+	ctx := context.Background()
+	store, err := NewStore(ctx, "s3://bucket/prefix")
+	if err != nil {
+		t.Fatalf("NewStore() failed: %s", err)
+	}
+	store.(*s3Store).now = func() time.Time {
+		return time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	}
+	u := NewUploader(store, t.TempDir())
+	upload := Upload{Contents: []byte("contents"), Destination: "a b/c"}
+
+	records, err := u.Upload(ctx, []Upload{upload})
+	if err != nil {
+		t.Fatalf("Upload() failed: %s", err)
+	}
+	if len(records) != 1 || records[0].Skipped {
+		t.Fatalf("expected a single uploaded object, got %+v", records)
+	}
+	if _, ok := fake.objects["/bucket/prefix/a b/c"]; !ok {
+		t.Errorf("object was not uploaded to the expected path; got objects %v", fake.objects)
+	}
+
+	records, err = u.Upload(ctx, []Upload{upload})
+	if err != nil {
+		t.Fatalf("Upload() failed: %s", err)
+	}
+	if len(records) != 1 || !records[0].Skipped {
+		t.Errorf("expected the existing object to be skipped, got %+v", records)
+	}
+
+	attrs, err := store.Copy(ctx, "a b/c", "d/e")
+	if err != nil {
+		t.Fatalf("Copy() failed: %s", err)
+	}
+	if sums, _ := computeChecksums(strings.NewReader("contents")); !sums.matches(attrs) {
+		t.Errorf("got attributes %+v for the copy, want those of %q", attrs, "contents")
+	}
+	if _, err := store.Copy(ctx, "missing", "d/f"); !errors.Is(err, ErrObjectNotExist) {
+		t.Errorf("Copy() of a missing object returned %v, want ErrObjectNotExist", err)
+	}
+
+	wantPrefix := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20220304/eu-west-1/s3/aws4_request, SignedHeaders="
+	for _, auth := range fake.auths {
+		if !strings.HasPrefix(auth, wantPrefix) || !strings.Contains(auth, "x-amz-date") {
+			t.Errorf("unexpected Authorization header %q", auth)
+		}
+	}
+}
+
+func TestAWSURIEscape(t *testing.T) {
+	for in, want := range map[string]string{
+		"/bucket/a/b.txt":   "/bucket/a/b.txt",
+		"/bucket/a b+c":     "/bucket/a%20b%2Bc",
+		"/bucket/~_-.":      "/bucket/~_-.",
+		"/bucket/\x01\xff=": "/bucket/%01%FF%3D",
+	} {
+		if got := awsURIEscape(in); got != want {
+			t.Errorf("awsURIEscape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// spdxSHA256 is the SPDX name of the checksum algorithm by which objects are
+// linked to an SBOM.
+const spdxSHA256 = "SHA256"
+
+// SBOM is the part of an SPDX 2 JSON document that is needed to link uploaded
+// objects to it.
+type SBOM struct {
+	DocumentNamespace string        `json:"documentNamespace"`
+	Packages          []spdxElement `json:"packages"`
+	Files             []spdxElement `json:"files"`
+}
+
+type spdxElement struct {
+	SPDXID    string         `json:"SPDXID"`
+	Checksums []spdxChecksum `json:"checksums"`
+}
+
+type spdxChecksum struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"checksumValue"`
+}
+
+// LoadSBOM reads an SPDX 2 JSON document.
+func LoadSBOM(path string) (*SBOM, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sbom SBOM
+	if err := json.Unmarshal(data, &sbom); err != nil {
+		return nil, fmt.Errorf("failed to parse SBOM %s: %w", path, err)
+	}
+	return &sbom, nil
+}
+
+// SBOMLinks is a sidecar to an uploaded SBOM that links uploaded objects to
+// the SPDX packages and files that describe them.
+type SBOMLinks struct {
+	// SBOM is the destination of the SBOM itself.
+	SBOM string `json:"sbom"`
+
+	// DocumentNamespace is the SPDX document namespace of the SBOM, against
+	// which the SPDX IDs are resolved.
+	DocumentNamespace string `json:"document_namespace"`
+
+	// Objects are the objects that match an element of the SBOM, sorted by
+	// destination.
+	Objects []SBOMLink `json:"objects"`
+}
+
+// SBOMLink links an uploaded object to the SBOM.
+type SBOMLink struct {
+	// Destination is the destination of the object.
+	Destination string `json:"destination"`
+
+	// SPDXIDs are the IDs of the SPDX packages and files whose SHA-256
+	// checksum matches the object's contents.
+	SPDXIDs []string `json:"spdx_ids"`
+}
+
+// LinkSBOM links the objects of uploads to the elements of sbom, uploaded to
+// sbomDestination, whose SHA-256 checksums match the objects' digests, as
+// computed by ComputeDigests. Objects that match no element are left out.
+func LinkSBOM(uploads []Upload, digests Digests, sbom *SBOM, sbomDestination string) (*SBOMLinks, error) {
+	ids := make(map[string][]string)
+	for _, elements := range [][]spdxElement{sbom.Packages, sbom.Files} {
+		for _, e := range elements {
+			for _, c := range e.Checksums {
+				if c.Algorithm == spdxSHA256 {
+					digest := strings.ToLower(c.Value)
+					ids[digest] = append(ids[digest], e.SPDXID)
+				}
+			}
+		}
+	}
+
+	links := &SBOMLinks{
+		SBOM:              sbomDestination,
+		DocumentNamespace: sbom.DocumentNamespace,
+		Objects:           []SBOMLink{},
+	}
+	if len(ids) == 0 {
+		return links, nil
+	}
+	for _, upload := range uploads {
+		objects, err := expandUpload(upload)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			digest, ok := digests[object.Destination]
+			if !ok {
+				return nil, fmt.Errorf("no digest of %s", object.Destination)
+			}
+			if matches, ok := ids[hex.EncodeToString(digest)]; ok {
+				links.Objects = append(links.Objects, SBOMLink{
+					Destination: object.Destination,
+					SPDXIDs:     matches,
+				})
+			}
+		}
+	}
+	sort.Slice(links.Objects, func(i, j int) bool {
+		return links.Objects[i].Destination < links.Objects[j].Destination
+	})
+	return links, nil
+}
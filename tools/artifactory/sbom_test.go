@@ -0,0 +1,98 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLinkSBOM(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"blobs/aaaa":   "blob a",
+		"blobs/bbbb":   "blob b",
+		"zircon-a.zbi": "zbi",
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sha256Of := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	sbomPath := filepath.Join(dir, "sbom.spdx.json")
+	sbomJSON := `{
+  "spdxVersion": "SPDX-2.3",
+  "documentNamespace": "https://fuchsia.dev/spdx/build",
+  "packages": [
+    {
+      "SPDXID": "SPDXRef-Package-zbi",
+      "name": "zbi",
+      "checksums": [{"algorithm": "SHA256", "checksumValue": "` + strings.ToUpper(sha256Of("zbi")) + `"}]
+    }
+  ],
+  "files": [
+    {
+      "SPDXID": "SPDXRef-File-blob-a",
+      "fileName": "./blobs/aaaa",
+      "checksums": [
+        {"algorithm": "SHA1", "checksumValue": "da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+        {"algorithm": "SHA256", "checksumValue": "` + sha256Of("blob a") + `"}
+      ]
+    },
+    {
+      "SPDXID": "SPDXRef-File-zbi",
+      "fileName": "./zircon-a.zbi",
+      "checksums": [{"algorithm": "SHA256", "checksumValue": "` + sha256Of("zbi") + `"}]
+    }
+  ]
+}`
+	if err := os.WriteFile(sbomPath, []byte(sbomJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sbom, err := LoadSBOM(sbomPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploads := []Upload{
+		{Source: filepath.Join(dir, "zircon-a.zbi"), Destination: "ns/images/zircon-a.zbi", Compress: true},
+		{Source: filepath.Join(dir, "blobs"), Destination: "blobs", Deduplicate: true},
+		{Contents: []byte("build-ids"), Destination: "ns/build-ids.txt"},
+	}
+	digests, err := ComputeDigests(context.Background(), uploads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := LinkSBOM(uploads, digests, sbom, "ns/sbom.spdx.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &SBOMLinks{
+		SBOM:              "ns/sbom.spdx.json",
+		DocumentNamespace: "https://fuchsia.dev/spdx/build",
+		Objects: []SBOMLink{
+			{Destination: "blobs/aaaa", SPDXIDs: []string{"SPDXRef-File-blob-a"}},
+			{Destination: "ns/images/zircon-a.zbi", SPDXIDs: []string{"SPDXRef-Package-zbi", "SPDXRef-File-zbi"}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected links (-want +got):\n%s", diff)
+	}
+}
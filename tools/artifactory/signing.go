@@ -0,0 +1,237 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	// signatureSuffix is appended to the destination of an object to get the
+	// destination of its detached signature.
+	signatureSuffix = ".sig"
+
+	// kmsKeyPrefix prefixes the resource name of a Cloud KMS key version to
+	// select a KMS-backed Signer.
+	kmsKeyPrefix = "gcpkms://"
+
+	kmsEndpoint = "https://cloudkms.googleapis.com/v1/"
+	kmsScope    = "https://www.googleapis.com/auth/cloudkms"
+)
+
+// Signer signs uploaded objects.
+type Signer interface {
+	// KeyID identifies the key with which signatures can be verified.
+	KeyID() string
+
+	// Sign returns a signature of the SHA-256 digest of an object's contents.
+	Sign(ctx context.Context, digest []byte) ([]byte, error)
+}
+
+// NewSigner returns the Signer for the given key: either the path to a
+// PEM-encoded PKCS #8 ed25519 private key, or gcpkms:// followed by the
+// resource name of an asymmetric signing key version in Cloud KMS, e.g.
+// gcpkms://projects/<p>/locations/<l>/keyRings/<r>/cryptoKeys/<k>/cryptoKeyVersions/<v>.
+func NewSigner(ctx context.Context, key string) (Signer, error) {
+	if strings.HasPrefix(key, kmsKeyPrefix) {
+		return newKMSSigner(ctx, strings.TrimPrefix(key, kmsKeyPrefix))
+	}
+	return newEd25519Signer(key)
+}
+
+// ed25519Signer signs with a local ed25519 private key. Its key ID is the
+// hex-encoded SHA-256 digest of the public key.
+type ed25519Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+func newEd25519Signer(path string) (*ed25519Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM-encoded", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the private key in %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s holds a %T, not an ed25519 private key", path, parsed)
+	}
+	keyID := sha256.Sum256(key.Public().(ed25519.PublicKey))
+	return &ed25519Signer{key: key, keyID: hex.EncodeToString(keyID[:])}, nil
+}
+
+func (s *ed25519Signer) KeyID() string {
+	return s.keyID
+}
+
+func (s *ed25519Signer) Sign(_ context.Context, digest []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, digest), nil
+}
+
+// kmsSigner signs with a Cloud KMS key version, using the application default
+// credentials. Its key ID is the resource name of the key version.
+type kmsSigner struct {
+	client   *http.Client
+	endpoint string
+	name     string
+	// Whether the key is an Ed25519 key, which KMS only allows to sign raw
+	// messages rather than precomputed digests.
+	ed25519 bool
+}
+
+// The KMS algorithm of Ed25519 signing keys.
+const kmsEd25519Algorithm = "EC_SIGN_ED25519"
+
+func newKMSSigner(ctx context.Context, name string) (*kmsSigner, error) {
+	if !strings.Contains(name, "/cryptoKeyVersions/") {
+		return nil, fmt.Errorf("%q is not the resource name of a KMS key version", name)
+	}
+	client, err := google.DefaultClient(ctx, kmsScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KMS client: %w", err)
+	}
+	s := &kmsSigner{client: client, endpoint: kmsEndpoint, name: name}
+	if err := s.loadAlgorithm(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadAlgorithm looks up the algorithm of the key version, which determines
+// what Sign sends to KMS.
+func (s *kmsSigner) loadAlgorithm(ctx context.Context) error {
+	var version struct {
+		Algorithm string `json:"algorithm"`
+	}
+	if err := s.call(ctx, http.MethodGet, s.endpoint+s.name, nil, &version); err != nil {
+		return fmt.Errorf("failed to get KMS key version: %w", err)
+	}
+	s.ed25519 = version.Algorithm == kmsEd25519Algorithm
+	return nil
+}
+
+func (s *kmsSigner) KeyID() string {
+	return s.name
+}
+
+func (s *kmsSigner) Sign(ctx context.Context, digest []byte) ([]byte, error) {
+	var req struct {
+		Digest *kmsDigest `json:"digest,omitempty"`
+		Data   string     `json:"data,omitempty"`
+	}
+	encoded := base64.StdEncoding.EncodeToString(digest)
+	if s.ed25519 {
+		// Ed25519 keys sign the digest itself as the message, as
+		// ed25519Signer does.
+		req.Data = encoded
+	} else {
+		req.Digest = &kmsDigest{SHA256: encoded}
+	}
+	var resp struct {
+		Signature string `json:"signature"`
+	}
+	if err := s.call(ctx, http.MethodPost, s.endpoint+s.name+":asymmetricSign", req, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Signature)
+}
+
+type kmsDigest struct {
+	SHA256 string `json:"sha256"`
+}
+
+// call sends a request to the KMS API, with req as its JSON body if non-nil,
+// and decodes the JSON response into resp.
+func (s *kmsSigner) call(ctx context.Context, method, url string, req, resp interface{}) error {
+	var body io.Reader
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	if req != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s: %s", method, url, httpResp.Status, respBody)
+	}
+	if err := json.Unmarshal(respBody, resp); err != nil {
+		return fmt.Errorf("invalid response from KMS: %w", err)
+	}
+	return nil
+}
+
+// SignUploads returns uploads with a detached signature added for each object
+// that should be signed, at the object's destination with a ".sig" suffix. The
+// signatures are of the SHA-256 digests of the objects' contents before they
+// are archived or compressed, as computed by ComputeDigests, and the uploads
+// record the ID of the key with which to verify them.
+func SignUploads(ctx context.Context, uploads []Upload, digests Digests, signer Signer) ([]Upload, error) {
+	signed := make([]Upload, len(uploads))
+	copy(signed, uploads)
+	var signatures []Upload
+	for i, upload := range signed {
+		if !upload.Signed {
+			continue
+		}
+		objects, err := expandUpload(upload)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			digest, ok := digests[object.Destination]
+			if !ok {
+				return nil, fmt.Errorf("no digest of %s", object.Destination)
+			}
+			signature, err := signer.Sign(ctx, digest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to sign %s: %w", object.Destination, err)
+			}
+			signatures = append(signatures, Upload{
+				Contents:    signature,
+				Destination: object.Destination + signatureSuffix,
+			})
+		}
+		signed[i].SignatureKeyID = signer.KeyID()
+	}
+	return append(signed, signatures...), nil
+}
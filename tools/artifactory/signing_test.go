@@ -0,0 +1,188 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func writeEd25519Key(t *testing.T) (string, ed25519.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, pub
+}
+
+func TestSignUploads(t *testing.T) {
+	ctx := context.Background()
+	keyPath, pub := writeEd25519Key(t)
+	signer, err := NewSigner(ctx, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	contents := map[string][]byte{
+		"images.json":            []byte(`[{"name": "zircon-a"}]`),
+		"repository/root.json":   []byte(`{"signed": {"_type": "root"}}`),
+		"repository/1.root.json": []byte(`{"signed": {"_type": "root", "version": 1}}`),
+		"tool":                   []byte("tool"),
+	}
+	for name, data := range contents {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	uploads := []Upload{
+		{Source: filepath.Join(dir, "images.json"), Destination: "ns/images/images.json", Signed: true},
+		{Source: filepath.Join(dir, "repository"), Destination: "ns/packages/repository", Signed: true},
+		{Source: filepath.Join(dir, "tool"), Destination: "ns/tools/tool", Compress: true},
+		{Contents: []byte("build-ids"), Destination: "ns/build-ids.txt", Signed: true},
+	}
+	digests, err := ComputeDigests(ctx, uploads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := SignUploads(ctx, uploads, digests, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploads[0].SignatureKeyID != "" {
+		t.Errorf("SignUploads modified its input")
+	}
+
+	keyID := signer.KeyID()
+	want := []Upload{
+		{Source: filepath.Join(dir, "images.json"), Destination: "ns/images/images.json", Signed: true, SignatureKeyID: keyID},
+		{Source: filepath.Join(dir, "repository"), Destination: "ns/packages/repository", Signed: true, SignatureKeyID: keyID},
+		{Source: filepath.Join(dir, "tool"), Destination: "ns/tools/tool", Compress: true},
+		{Contents: []byte("build-ids"), Destination: "ns/build-ids.txt", Signed: true, SignatureKeyID: keyID},
+	}
+	if diff := cmp.Diff(want, got[:len(want)]); diff != "" {
+		t.Errorf("unexpected uploads (-want +got):\n%s", diff)
+	}
+
+	signed := map[string][]byte{
+		"ns/images/images.json.sig":              contents["images.json"],
+		"ns/packages/repository/root.json.sig":   contents["repository/root.json"],
+		"ns/packages/repository/1.root.json.sig": contents["repository/1.root.json"],
+		"ns/build-ids.txt.sig":                   []byte("build-ids"),
+	}
+	signatures := got[len(want):]
+	if len(signatures) != len(signed) {
+		t.Fatalf("got %d signatures, want %d: %+v", len(signatures), len(signed), signatures)
+	}
+	for _, sig := range signatures {
+		data, ok := signed[sig.Destination]
+		if !ok {
+			t.Errorf("unexpected signature %s", sig.Destination)
+			continue
+		}
+		digest := sha256.Sum256(data)
+		if !ed25519.Verify(pub, digest[:], sig.Contents) {
+			t.Errorf("%s doesn't verify", sig.Destination)
+		}
+	}
+}
+
+func TestKMSSigner(t *testing.T) {
+	const name = "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+	digest := sha256.Sum256([]byte("contents"))
+	encodedDigest := base64.StdEncoding.EncodeToString(digest[:])
+
+	for _, tc := range []struct {
+		algorithm  string
+		wantDigest string
+		wantData   string
+	}{
+		{
+			algorithm:  "EC_SIGN_P256_SHA256",
+			wantDigest: encodedDigest,
+		},
+		{
+			algorithm: "EC_SIGN_ED25519",
+			wantData:  encodedDigest,
+		},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					if want := "/v1/" + name; r.URL.Path != want {
+						t.Errorf("got key version request for %s, want %s", r.URL.Path, want)
+					}
+					json.NewEncoder(w).Encode(map[string]string{"algorithm": tc.algorithm})
+					return
+				}
+				if want := "/v1/" + name + ":asymmetricSign"; r.URL.Path != want {
+					t.Errorf("got request for %s, want %s", r.URL.Path, want)
+				}
+				var req struct {
+					Digest struct {
+						SHA256 string `json:"sha256"`
+					} `json:"digest"`
+					Data string `json:"data"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Error(err)
+				}
+				if req.Digest.SHA256 != tc.wantDigest {
+					t.Errorf("got digest %q, want %q", req.Digest.SHA256, tc.wantDigest)
+				}
+				if req.Data != tc.wantData {
+					t.Errorf("got data %q, want %q", req.Data, tc.wantData)
+				}
+				json.NewEncoder(w).Encode(map[string]string{
+					"signature": base64.StdEncoding.EncodeToString([]byte("signature")),
+				})
+			}))
+			defer server.Close()
+
+			ctx := context.Background()
+			signer := &kmsSigner{client: server.Client(), endpoint: server.URL + "/v1/", name: name}
+			if err := signer.loadAlgorithm(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if signer.KeyID() != name {
+				t.Errorf("got key ID %s, want %s", signer.KeyID(), name)
+			}
+			sig, err := signer.Sign(ctx, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(sig) != "signature" {
+				t.Errorf("got signature %q, want %q", sig, "signature")
+			}
+		})
+	}
+}
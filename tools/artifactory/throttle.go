@@ -0,0 +1,229 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+	"go.fuchsia.dev/fuchsia/tools/lib/retry"
+)
+
+const (
+	// DefaultRetryBudget is the number of retries an Uploader may make across
+	// all of its requests before giving up.
+	DefaultRetryBudget = 100
+
+	// The maximum number of attempts at any single request.
+	maxAttemptsPerRequest = 5
+)
+
+// UploadMetrics summarizes the work done by an Uploader.
+type UploadMetrics struct {
+	// ObjectsUploaded is the number of objects written to the store.
+	ObjectsUploaded int64 `json:"objects_uploaded"`
+
+	// ObjectsSkipped is the number of objects that were not uploaded because
+	// they already existed or were copied from the baseline.
+	ObjectsSkipped int64 `json:"objects_skipped"`
+
+	// BytesUploaded is the total size of the objects written to the store.
+	BytesUploaded int64 `json:"bytes_uploaded"`
+
+	// Retries is the number of requests that were retried after failing.
+	Retries int64 `json:"retries"`
+
+	// ThrottleEvents is the number of requests the store rejected because
+	// too many were being made.
+	ThrottleEvents int64 `json:"throttle_events"`
+
+	// MinConcurrency is the lowest number of concurrent uploads the uploader
+	// fell back to in response to throttling.
+	MinConcurrency int `json:"min_concurrency"`
+}
+
+// SetMaxConcurrency sets the maximum number of objects that are uploaded at
+// once. The number in flight is halved whenever the store throttles a
+// request, and grows back towards the maximum as uploads succeed.
+func (u *Uploader) SetMaxConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	u.maxConcurrency = n
+}
+
+// SetRetryBudget sets the number of retries that may be made across all
+// requests. Once it is spent, the next failure fails the upload.
+func (u *Uploader) SetRetryBudget(n int64) {
+	u.retries = newRetryBudget(n)
+}
+
+// Metrics returns the metrics of all uploads made so far.
+func (u *Uploader) Metrics() UploadMetrics {
+	u.metricsMu.Lock()
+	defer u.metricsMu.Unlock()
+	return u.metrics
+}
+
+func (u *Uploader) recordUploaded(size int64) {
+	u.metricsMu.Lock()
+	defer u.metricsMu.Unlock()
+	u.metrics.ObjectsUploaded++
+	u.metrics.BytesUploaded += size
+}
+
+func (u *Uploader) recordSkipped() {
+	u.metricsMu.Lock()
+	defer u.metricsMu.Unlock()
+	u.metrics.ObjectsSkipped++
+}
+
+func (u *Uploader) recordConcurrency(limiter *concurrencyLimiter) {
+	min := limiter.minLimit()
+	u.metricsMu.Lock()
+	defer u.metricsMu.Unlock()
+	if u.metrics.MinConcurrency == 0 || min < u.metrics.MinConcurrency {
+		u.metrics.MinConcurrency = min
+	}
+}
+
+// call makes a request to the store with f, retrying failures that may be
+// transient for as long as the retry budget lasts. Throttled requests also
+// lower the number of concurrent uploads.
+func (u *Uploader) call(ctx context.Context, limiter *concurrencyLimiter, f func() error) error {
+	attempt := 0
+	return retry.Retry(ctx, u.newBackoff(), func() error {
+		if attempt > 0 {
+			u.metricsMu.Lock()
+			u.metrics.Retries++
+			u.metricsMu.Unlock()
+		}
+		attempt++
+
+		err := f()
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, ErrThrottled):
+			u.metricsMu.Lock()
+			u.metrics.ThrottleEvents++
+			u.metricsMu.Unlock()
+			if limit := limiter.throttle(); limit > 0 {
+				logger.Warningf(ctx, "store is throttling uploads; reduced concurrency to %d", limit)
+			}
+		case !errors.Is(err, ErrTransient):
+			return retry.Fatal(err)
+		}
+		if !u.retries.take() {
+			return retry.Fatal(fmt.Errorf("retry budget exhausted: %w", err))
+		}
+		logger.Debugf(ctx, "retrying after failure: %s", err)
+		return err
+	}, nil)
+}
+
+// retryBudget is a number of retries shared between concurrent requests, so
+// that a store that is failing persistently fails the upload quickly instead
+// of every object being retried in turn.
+type retryBudget struct {
+	remaining int64
+}
+
+func newRetryBudget(n int64) *retryBudget {
+	return &retryBudget{remaining: n}
+}
+
+// take spends one retry, and returns false if none were left.
+func (b *retryBudget) take() bool {
+	return atomic.AddInt64(&b.remaining, -1) >= 0
+}
+
+// concurrencyLimiter limits the number of concurrent uploads. The limit is
+// adapted to throttling by the store: it is halved whenever a request is
+// throttled, and grows by one each time that many uploads succeed without
+// being throttled, up to the maximum.
+type concurrencyLimiter struct {
+	max int
+
+	mu        sync.Mutex
+	limit     int
+	min       int
+	inFlight  int
+	successes int
+	// changed is closed and replaced whenever an upload may start.
+	changed chan struct{}
+}
+
+func newConcurrencyLimiter(max int) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		max:     max,
+		limit:   max,
+		min:     max,
+		changed: make(chan struct{}),
+	}
+}
+
+// acquire waits until another upload may start.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release marks an upload started by acquire as finished. Only uploads that
+// succeeded count towards growing the limit again.
+func (l *concurrencyLimiter) release(succeeded bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if succeeded {
+		l.successes++
+		if l.successes >= l.limit && l.limit < l.max {
+			l.limit++
+			l.successes = 0
+		}
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// throttle halves the limit and returns the new limit, or 0 if it was already
+// at its minimum of one.
+func (l *concurrencyLimiter) throttle() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.successes = 0
+	if l.limit == 1 {
+		return 0
+	}
+	l.limit /= 2
+	if l.limit < l.min {
+		l.min = l.limit
+	}
+	return l.limit
+}
+
+func (l *concurrencyLimiter) minLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.min
+}
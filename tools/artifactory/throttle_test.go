@@ -0,0 +1,174 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/retry"
+)
+
+// failingStore is a thread-safe memStore whose writes fail with the queued
+// errors before succeeding.
+type failingStore struct {
+	mu       sync.Mutex
+	mem      *memStore
+	failures []error
+}
+
+func (s *failingStore) Attrs(ctx context.Context, name string) (*ObjectAttrs, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mem.Attrs(ctx, name)
+}
+
+func (s *failingStore) Write(ctx context.Context, name string, open func() (io.ReadCloser, error), want ObjectAttrs, contentEncoding string) (*ObjectAttrs, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.failures) > 0 {
+		err := s.failures[0]
+		s.failures = s.failures[1:]
+		return nil, err
+	}
+	return s.mem.Write(ctx, name, open, want, contentEncoding)
+}
+
+func (s *failingStore) Copy(ctx context.Context, src, dst string) (*ObjectAttrs, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mem.Copy(ctx, src, dst)
+}
+
+func newTestUploader(t *testing.T, store Store) *Uploader {
+	u := NewUploader(store, t.TempDir())
+	u.newBackoff = func() retry.Backoff {
+		return retry.WithMaxAttempts(retry.NewConstantBackoff(0), maxAttemptsPerRequest)
+	}
+	return u
+}
+
+func TestUploaderRetries(t *testing.T) {
+	ctx := context.Background()
+	var uploads []Upload
+	for i := 0; i < 8; i++ {
+		uploads = append(uploads, Upload{Contents: []byte{byte(i)}, Destination: fmt.Sprintf("buildid/%d", i)})
+	}
+	throttled := fmt.Errorf("%w: 429 Too Many Requests", ErrThrottled)
+	transient := fmt.Errorf("%w: 503 Internal Server Error", ErrTransient)
+
+	t.Run("throttling lowers concurrency", func(t *testing.T) {
+		store := &failingStore{
+			mem:      &memStore{objects: make(map[string][]byte)},
+			failures: []error{throttled, throttled, transient},
+		}
+		u := newTestUploader(t, store)
+		u.SetMaxConcurrency(4)
+		records, err := u.Upload(ctx, uploads)
+		if err != nil {
+			t.Fatalf("Upload() failed: %s", err)
+		}
+		if len(records) != len(uploads) {
+			t.Fatalf("got %d records, want %d", len(records), len(uploads))
+		}
+		for i, r := range records {
+			if r.Name != uploads[i].Destination {
+				t.Errorf("got record %d for %s, want %s", i, r.Name, uploads[i].Destination)
+			}
+		}
+		want := UploadMetrics{
+			ObjectsUploaded: 8,
+			BytesUploaded:   8,
+			Retries:         3,
+			ThrottleEvents:  2,
+			MinConcurrency:  1,
+		}
+		if diff := cmp.Diff(want, u.Metrics()); diff != "" {
+			t.Errorf("unexpected metrics (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("exhausted retry budget", func(t *testing.T) {
+		store := &failingStore{
+			mem:      &memStore{objects: make(map[string][]byte)},
+			failures: []error{transient, transient, transient},
+		}
+		u := newTestUploader(t, store)
+		u.SetRetryBudget(2)
+		if _, err := u.Upload(ctx, uploads); err == nil {
+			t.Errorf("expected Upload() to fail once the retry budget was spent")
+		}
+		if got := u.Metrics().Retries; got != 2 {
+			t.Errorf("got %d retries, want 2", got)
+		}
+	})
+
+	t.Run("permanent failures are not retried", func(t *testing.T) {
+		permanent := errors.New("403 Forbidden")
+		store := &failingStore{
+			mem:      &memStore{objects: make(map[string][]byte)},
+			failures: []error{permanent},
+		}
+		u := newTestUploader(t, store)
+		if _, err := u.Upload(ctx, uploads); !errors.Is(err, permanent) {
+			t.Errorf("got Upload() error %v, want %v", err, permanent)
+		}
+		if got := u.Metrics().Retries; got != 0 {
+			t.Errorf("got %d retries, want 0", got)
+		}
+	})
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := newConcurrencyLimiter(4)
+	for i := 0; i < 4; i++ {
+		if err := l.acquire(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := l.throttle(); got != 2 {
+		t.Errorf("got limit %d after throttling, want 2", got)
+	}
+	if got := l.throttle(); got != 1 {
+		t.Errorf("got limit %d after throttling, want 1", got)
+	}
+	if got := l.throttle(); got != 0 {
+		t.Errorf("got limit %d after throttling at the minimum, want 0", got)
+	}
+
+	// Nothing may start until the in-flight uploads drop below the limit.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := l.acquire(cancelled); err == nil {
+		t.Fatal("acquire() succeeded with more uploads in flight than the limit")
+	}
+	// Failed uploads don't count as successes.
+	l.release(false)
+	if got, want := l.limit, 1; got != want {
+		t.Errorf("got limit %d after a failure, want %d", got, want)
+	}
+	for i := 0; i < 3; i++ {
+		l.release(true)
+	}
+	if err := l.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	l.release(true)
+	// The limit grows by one after each limit's worth of successes: one
+	// success at a limit of 1, then two at a limit of 2.
+	if got, want := l.limit, 3; got != want {
+		t.Errorf("got limit %d after recovering, want %d", got, want)
+	}
+	if got := l.minLimit(); got != 1 {
+		t.Errorf("got minimum limit %d, want 1", got)
+	}
+}
@@ -29,6 +29,11 @@ type Upload struct {
 	// example, content-addressed uploads.
 	Deduplicate bool `json:"deduplicate,omitempty"`
 
+	// Overwrite gives a collision strategy. If true, then an existing object
+	// with different contents is replaced, for objects such as indexes that
+	// are expected to change when an upload is re-run.
+	Overwrite bool `json:"overwrite,omitempty"`
+
 	// Recursive tells whether to recursively upload all files in Source if
 	// Source is a directory.
 	Recursive bool `json:"recursive,omitempty"`
@@ -37,6 +42,11 @@ type Upload struct {
 	// private key is provided.
 	Signed bool `json:"signed,omitempty"`
 
+	// SignatureKeyID is the ID of the key with which the detached signatures
+	// of the object, or of the objects within Source if it is a directory, can
+	// be verified. It is set by SignUploads.
+	SignatureKeyID string `json:"signature_key_id,omitempty"`
+
 	// TarHeader tells whether or not to compress with tar and contains the
 	// associated header.
 	TarHeader *tar.Header `json:"tar_header,omitempty"`
@@ -0,0 +1,560 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+	"go.fuchsia.dev/fuchsia/tools/lib/retry"
+)
+
+var (
+	// ErrObjectNotExist is returned by a Store when an object does not exist.
+	ErrObjectNotExist = errors.New("object does not exist")
+
+	// ErrTransient is wrapped by errors returned by a Store for failures that
+	// may succeed if the request is retried.
+	ErrTransient = errors.New("transient failure")
+
+	// ErrThrottled is wrapped by errors returned by a Store when it rejected a
+	// request because too many were being made. Such requests may be retried
+	// once fewer requests are in flight.
+	ErrThrottled = errors.New("request throttled")
+)
+
+// ObjectAttrs describes an object in a Store.
+type ObjectAttrs struct {
+	// Size is the size of the object in bytes.
+	Size int64
+
+	// MD5 is the MD5 hash of the object's contents, if known.
+	MD5 []byte
+
+	// CRC32C is the CRC32C checksum of the object's contents. It is only
+	// meaningful if HasCRC32C is set.
+	CRC32C    uint32
+	HasCRC32C bool
+
+	// Generation is the version of the object, for stores that version
+	// objects.
+	Generation int64
+}
+
+// Store is a destination for uploaded objects.
+//
+// A Store makes a single attempt at each request; the Uploader retries
+// requests that fail with ErrTransient or ErrThrottled.
+type Store interface {
+	// Attrs returns the attributes of the named object, or an error wrapping
+	// ErrObjectNotExist if there is no such object.
+	Attrs(ctx context.Context, name string) (*ObjectAttrs, error)
+
+	// Write uploads the contents returned by open to the named object. want
+	// holds the size and checksums of the contents, which the store should use
+	// to reject corrupted uploads where it is able to. open may be called
+	// more than once to retry an upload.
+	Write(ctx context.Context, name string, open func() (io.ReadCloser, error), want ObjectAttrs, contentEncoding string) (*ObjectAttrs, error)
+
+	// Copy copies the object named src to dst within the store, without
+	// sending its contents through the client. It returns an error wrapping
+	// ErrObjectNotExist if there is no object named src.
+	Copy(ctx context.Context, src, dst string) (*ObjectAttrs, error)
+}
+
+// NewStore returns the Store for the given destination URL. The scheme of the
+// URL selects the backend:
+//
+//	gs://<bucket>[/<prefix>]   Google Cloud Storage
+//	s3://<bucket>[/<prefix>]   Amazon S3, or any S3-compatible service
+//	file://<dir>, or <dir>     a local directory
+func NewStore(ctx context.Context, destination string) (Store, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination %q: %w", destination, err)
+	}
+	switch u.Scheme {
+	case "gs":
+		return newGCSStore(ctx, u.Host, u.Path)
+	case "s3":
+		return newS3Store(u.Host, u.Path)
+	case "file":
+		return newDirStore(u.Path)
+	case "":
+		return newDirStore(destination)
+	default:
+		return nil, fmt.Errorf("unsupported destination scheme %q", u.Scheme)
+	}
+}
+
+// ObjectRecord describes an object in a Store after it has been uploaded, so
+// that downstream consumers can verify its integrity.
+type ObjectRecord struct {
+	// Name is the name of the object relative to the destination.
+	Name string `json:"name"`
+
+	// Size is the size of the object in bytes.
+	Size int64 `json:"size"`
+
+	// MD5 is the base64-encoded MD5 hash of the object's contents.
+	MD5 string `json:"md5"`
+
+	// CRC32C is the base64-encoded, big-endian CRC32C checksum of the object's
+	// contents, in the same format as reported by GCS.
+	CRC32C string `json:"crc32c"`
+
+	// Generation is the GCS generation of the object. It is zero for other
+	// stores.
+	Generation int64 `json:"generation"`
+
+	// Skipped is true if the object already existed and was not uploaded
+	// again.
+	Skipped bool `json:"skipped,omitempty"`
+
+	// CopiedFrom is set by differential uploads to the name of the object,
+	// relative to the destination, that this object was copied from within
+	// the store instead of being uploaded.
+	CopiedFrom string `json:"copied_from,omitempty"`
+}
+
+// checksums holds the checksums of some contents.
+type checksums struct {
+	size   int64
+	md5    []byte
+	crc32c uint32
+}
+
+func computeChecksums(r io.Reader) (checksums, error) {
+	md5Hash := md5.New()
+	crcHash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	n, err := io.Copy(io.MultiWriter(md5Hash, crcHash), r)
+	if err != nil {
+		return checksums{}, err
+	}
+	return checksums{
+		size:   n,
+		md5:    md5Hash.Sum(nil),
+		crc32c: crcHash.Sum32(),
+	}, nil
+}
+
+// matches returns whether attrs describes an object with the given contents.
+// Checksums that the store does not know are not compared, but at least one
+// must be known.
+func (c checksums) matches(attrs *ObjectAttrs) bool {
+	if attrs.Size != c.size || (len(attrs.MD5) == 0 && !attrs.HasCRC32C) {
+		return false
+	}
+	if attrs.HasCRC32C && attrs.CRC32C != c.crc32c {
+		return false
+	}
+	return len(attrs.MD5) == 0 || bytes.Equal(attrs.MD5, c.md5)
+}
+
+func (c checksums) attrs() ObjectAttrs {
+	return ObjectAttrs{
+		Size:      c.size,
+		MD5:       c.md5,
+		CRC32C:    c.crc32c,
+		HasCRC32C: true,
+	}
+}
+
+// checksums returns the checksums of the object that are known.
+func (a *ObjectAttrs) checksums() checksums {
+	return checksums{size: a.Size, md5: a.MD5, crc32c: a.CRC32C}
+}
+
+func newObjectRecord(name string, sums checksums, generation int64, skipped bool) ObjectRecord {
+	return ObjectRecord{
+		Name:       name,
+		Size:       sums.size,
+		MD5:        base64.StdEncoding.EncodeToString(sums.md5),
+		CRC32C:     encodeCRC32C(sums.crc32c),
+		Generation: generation,
+		Skipped:    skipped,
+	}
+}
+
+// Uploader uploads files to a Store, verifying the checksums of each object
+// and skipping objects that already exist with the same contents.
+type Uploader struct {
+	store Store
+	// tmpDir is where compressed or archived files are staged before they are
+	// uploaded.
+	tmpDir string
+	// baseline, if set, is the previous upload against which to make a
+	// differential upload.
+	baseline *Baseline
+	// maxConcurrency is the maximum number of objects uploaded at once.
+	maxConcurrency int
+	// retries is shared by all of the uploader's requests.
+	retries *retryBudget
+	// newBackoff returns the backoff between attempts at a single request.
+	newBackoff func() retry.Backoff
+	// compressTokens limits the number of blocks compressed at once by all
+	// of the uploader's parallelGzipWriters.
+	compressTokens chan struct{}
+
+	metricsMu sync.Mutex
+	metrics   UploadMetrics
+}
+
+// NewUploader returns an Uploader that uploads to the given store. tmpDir is
+// used to stage files that must be transformed before being uploaded.
+func NewUploader(store Store, tmpDir string) *Uploader {
+	return &Uploader{
+		store:          store,
+		tmpDir:         tmpDir,
+		maxConcurrency: 1,
+		retries:        newRetryBudget(DefaultRetryBudget),
+		compressTokens: make(chan struct{}, runtime.GOMAXPROCS(0)),
+		newBackoff: func() retry.Backoff {
+			return retry.WithMaxAttempts(retry.NewExponentialBackoff(time.Second, 30*time.Second, 2), maxAttemptsPerRequest)
+		},
+	}
+}
+
+// SetBaseline makes subsequent uploads differential against baseline: objects
+// that are unchanged since the baseline are copied from the existing objects
+// within the store instead of being uploaded again.
+func (u *Uploader) SetBaseline(baseline *Baseline) {
+	u.baseline = baseline
+}
+
+// Upload uploads all of the given uploads and returns a record of each
+// resulting object.
+func (u *Uploader) Upload(ctx context.Context, uploads []Upload) ([]ObjectRecord, error) {
+	var objects []Upload
+	for _, upload := range uploads {
+		expanded, err := expandUpload(upload)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, expanded...)
+	}
+
+	records := make([]ObjectRecord, len(objects))
+	limiter := newConcurrencyLimiter(u.maxConcurrency)
+	defer u.recordConcurrency(limiter)
+	g, gctx := errgroup.WithContext(ctx)
+	for i, object := range objects {
+		if err := limiter.acquire(gctx); err != nil {
+			break
+		}
+		i, object := i, object
+		g.Go(func() error {
+			record, err := u.uploadOne(gctx, limiter, object)
+			limiter.release(err == nil)
+			if err != nil {
+				return fmt.Errorf("failed to upload %s: %w", object.Destination, err)
+			}
+			records[i] = record
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// expandUpload expands an upload of a directory into uploads of the files
+// within it, recursing into subdirectories only if upload.Recursive is set.
+func expandUpload(upload Upload) ([]Upload, error) {
+	if upload.Source == "" {
+		return []Upload{upload}, nil
+	}
+	info, err := os.Stat(upload.Source)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []Upload{upload}, nil
+	}
+
+	var uploads []Upload
+	err = filepath.WalkDir(upload.Source, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != upload.Source && !upload.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(upload.Source, p)
+		if err != nil {
+			return err
+		}
+		u := upload
+		u.Source = p
+		u.Destination = path.Join(upload.Destination, filepath.ToSlash(rel))
+		uploads = append(uploads, u)
+		return nil
+	})
+	return uploads, err
+}
+
+// Digests maps the destinations of objects to the SHA-256 digests of their
+// contents before they are archived or compressed.
+type Digests map[string][]byte
+
+// ComputeDigests computes the digests of the objects of uploads, reading
+// several at once. It reads each object once, so that signing and linking to
+// an SBOM can share the result.
+func ComputeDigests(ctx context.Context, uploads []Upload) (Digests, error) {
+	var objects []Upload
+	for _, upload := range uploads {
+		expanded, err := expandUpload(upload)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, expanded...)
+	}
+
+	sums := make([][]byte, len(objects))
+	tokens := make(chan struct{}, runtime.GOMAXPROCS(0))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, object := range objects {
+		select {
+		case tokens <- struct{}{}:
+		case <-gctx.Done():
+		}
+		if gctx.Err() != nil {
+			break
+		}
+		i, object := i, object
+		g.Go(func() error {
+			defer func() { <-tokens }()
+			digest, err := contentsDigest(object)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", object.Destination, err)
+			}
+			sums[i] = digest
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	digests := make(Digests, len(objects))
+	for i, object := range objects {
+		digests[object.Destination] = sums[i]
+	}
+	return digests, nil
+}
+
+func contentsDigest(upload Upload) ([]byte, error) {
+	if upload.Source == "" {
+		digest := sha256.Sum256(upload.Contents)
+		return digest[:], nil
+	}
+	f, err := os.Open(upload.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func (u *Uploader) uploadOne(ctx context.Context, limiter *concurrencyLimiter, upload Upload) (ObjectRecord, error) {
+	open, cleanup, err := u.stage(upload)
+	if err != nil {
+		return ObjectRecord{}, err
+	}
+	defer cleanup()
+
+	r, err := open()
+	if err != nil {
+		return ObjectRecord{}, err
+	}
+	sums, err := computeChecksums(r)
+	r.Close()
+	if err != nil {
+		return ObjectRecord{}, err
+	}
+
+	var existing *ObjectAttrs
+	err = u.call(ctx, limiter, func() error {
+		var err error
+		existing, err = u.store.Attrs(ctx, upload.Destination)
+		return err
+	})
+	switch {
+	case err == nil:
+		if sums.matches(existing) {
+			logger.Debugf(ctx, "%s already exists with matching contents; skipping upload", upload.Destination)
+			u.recordSkipped()
+			return newObjectRecord(upload.Destination, sums, existing.Generation, true), nil
+		}
+		if upload.Deduplicate {
+			logger.Warningf(ctx, "%s already exists with different contents; keeping the existing object", upload.Destination)
+			u.recordSkipped()
+			return newObjectRecord(upload.Destination, existing.checksums(), existing.Generation, true), nil
+		}
+		if !upload.Overwrite {
+			return ObjectRecord{}, fmt.Errorf("object already exists with different contents")
+		}
+		logger.Debugf(ctx, "%s already exists with different contents; overwriting it", upload.Destination)
+	case !errors.Is(err, ErrObjectNotExist):
+		return ObjectRecord{}, err
+	}
+
+	if prev, ok := u.baseline.lookup(upload.Destination, sums); ok && prev.Name != upload.Destination {
+		record, err := u.copyFrom(ctx, limiter, prev.Name, upload.Destination, sums)
+		if !errors.Is(err, ErrObjectNotExist) {
+			return record, err
+		}
+		logger.Warningf(ctx, "baseline object %s no longer exists; uploading %s instead", prev.Name, upload.Destination)
+	}
+
+	var contentEncoding string
+	if upload.Compress {
+		contentEncoding = "gzip"
+	}
+	var attrs *ObjectAttrs
+	err = u.call(ctx, limiter, func() error {
+		var err error
+		attrs, err = u.store.Write(ctx, upload.Destination, open, sums.attrs(), contentEncoding)
+		return err
+	})
+	if err != nil {
+		return ObjectRecord{}, err
+	}
+	if !sums.matches(attrs) {
+		return ObjectRecord{}, fmt.Errorf("checksum mismatch after upload: got size=%d md5=%x crc32c=%08x, want size=%d md5=%x crc32c=%08x", attrs.Size, attrs.MD5, attrs.CRC32C, sums.size, sums.md5, sums.crc32c)
+	}
+	logger.Debugf(ctx, "uploaded %s (generation %d)", upload.Destination, attrs.Generation)
+	u.recordUploaded(sums.size)
+	return newObjectRecord(upload.Destination, sums, attrs.Generation, false), nil
+}
+
+// copyFrom copies the object named src, whose contents match sums, to dst.
+func (u *Uploader) copyFrom(ctx context.Context, limiter *concurrencyLimiter, src, dst string, sums checksums) (ObjectRecord, error) {
+	var attrs *ObjectAttrs
+	err := u.call(ctx, limiter, func() error {
+		var err error
+		attrs, err = u.store.Copy(ctx, src, dst)
+		return err
+	})
+	if err != nil {
+		return ObjectRecord{}, err
+	}
+	if !sums.matches(attrs) {
+		return ObjectRecord{}, fmt.Errorf("checksum mismatch after copying %s: got size=%d md5=%x crc32c=%08x, want size=%d md5=%x crc32c=%08x", src, attrs.Size, attrs.MD5, attrs.CRC32C, sums.size, sums.md5, sums.crc32c)
+	}
+	logger.Debugf(ctx, "%s is unchanged since the baseline; copied it from %s", dst, src)
+	u.recordSkipped()
+	record := newObjectRecord(dst, sums, attrs.Generation, false)
+	record.CopiedFrom = src
+	return record, nil
+}
+
+// stage returns a function that opens the exact contents to be uploaded for
+// upload, after archiving and compressing them as requested. The returned
+// cleanup function removes any staged files.
+func (u *Uploader) stage(upload Upload) (func() (io.ReadCloser, error), func(), error) {
+	noop := func() {}
+	if upload.Source == "" {
+		if !upload.Compress && upload.TarHeader == nil {
+			return func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(upload.Contents)), nil
+			}, noop, nil
+		}
+	} else if !upload.Compress && upload.TarHeader == nil {
+		return func() (io.ReadCloser, error) {
+			return os.Open(upload.Source)
+		}, noop, nil
+	}
+
+	f, err := os.CreateTemp(u.tmpDir, "artifactory")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+	if err := writeStaged(f, upload, u.compressTokens); err != nil {
+		f.Close()
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to stage %s: %w", upload.Destination, err)
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return func() (io.ReadCloser, error) {
+		return os.Open(f.Name())
+	}, cleanup, nil
+}
+
+func writeStaged(w io.Writer, upload Upload, compressTokens chan struct{}) error {
+	var src io.Reader = bytes.NewReader(upload.Contents)
+	if upload.Source != "" {
+		f, err := os.Open(upload.Source)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		src = f
+	}
+
+	var gzw *parallelGzipWriter
+	if upload.Compress {
+		gzw = newParallelGzipWriter(w, compressBlockSize, compressTokens)
+		// Wait for the blocks in flight if staging fails.
+		defer gzw.Close()
+		w = gzw
+	}
+	var tw *tar.Writer
+	if upload.TarHeader != nil {
+		tw = tar.NewWriter(w)
+		if err := tw.WriteHeader(upload.TarHeader); err != nil {
+			return err
+		}
+		w = tw
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	if tw != nil {
+		if err := tw.Close(); err != nil {
+			return err
+		}
+	}
+	if gzw != nil {
+		return gzw.Close()
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package artifactory
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// memStore is an in-memory Store.
+type memStore struct {
+	objects    map[string][]byte
+	generation int64
+	writes     []string
+	copies     []string
+}
+
+func (s *memStore) Attrs(_ context.Context, name string) (*ObjectAttrs, error) {
+	data, ok := s.objects[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrObjectNotExist)
+	}
+	sums, err := computeChecksums(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	attrs := sums.attrs()
+	attrs.Generation = s.generation
+	return &attrs, nil
+}
+
+func (s *memStore) Write(ctx context.Context, name string, open func() (io.ReadCloser, error), _ ObjectAttrs, _ string) (*ObjectAttrs, error) {
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s.generation++
+	s.objects[name] = data
+	s.writes = append(s.writes, name)
+	return s.Attrs(ctx, name)
+}
+
+func (s *memStore) Copy(ctx context.Context, src, dst string) (*ObjectAttrs, error) {
+	data, ok := s.objects[src]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", src, ErrObjectNotExist)
+	}
+	s.generation++
+	s.objects[dst] = data
+	s.copies = append(s.copies, dst)
+	return s.Attrs(ctx, dst)
+}
+
+func TestUploader(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"a":     "a",
+		"b":     "b",
+		"sub/c": "c",
+	} {
+		p := filepath.Join(dir, "src", name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := &memStore{objects: map[string][]byte{
+		// Already uploaded by a previous run.
+		"flat/a": []byte("a"),
+	}}
+	u := NewUploader(store, dir)
+	ctx := context.Background()
+
+	records, err := u.Upload(ctx, []Upload{
+		{Source: filepath.Join(dir, "src"), Destination: "flat"},
+		{Source: filepath.Join(dir, "src", "sub"), Destination: "gz", Compress: true},
+		{Contents: []byte("contents"), Destination: "contents"},
+	})
+	if err != nil {
+		t.Fatalf("Upload() failed: %s", err)
+	}
+
+	if diff := cmp.Diff([]string{"flat/b", "gz/c", "contents"}, store.writes); diff != "" {
+		t.Errorf("unexpected writes (-want +got):\n%s", diff)
+	}
+	wantRecords := []ObjectRecord{
+		{Name: "flat/a", Size: 1, Skipped: true},
+		{Name: "flat/b", Size: 1, Generation: 1},
+		{Name: "gz/c", Size: int64(len(store.objects["gz/c"])), Generation: 2},
+		{Name: "contents", Size: 8, Generation: 3},
+	}
+	if diff := cmp.Diff(wantRecords, records, cmpopts.IgnoreFields(ObjectRecord{}, "MD5", "CRC32C")); diff != "" {
+		t.Errorf("unexpected records (-want +got):\n%s", diff)
+	}
+	for _, r := range records {
+		if r.MD5 == "" || r.CRC32C == "" {
+			t.Errorf("record for %s is missing checksums: %+v", r.Name, r)
+		}
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(store.objects["gz/c"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(zr); err != nil || string(got) != "c" {
+		t.Errorf("got decompressed gz/c = %q, %v; want %q", got, err, "c")
+	}
+
+	t.Run("re-run skips matching objects", func(t *testing.T) {
+		store.writes = nil
+		if _, err := u.Upload(ctx, []Upload{{Source: filepath.Join(dir, "src"), Destination: "flat", Recursive: true}}); err != nil {
+			t.Fatalf("Upload() failed: %s", err)
+		}
+		if diff := cmp.Diff([]string{"flat/sub/c"}, store.writes); diff != "" {
+			t.Errorf("unexpected writes (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("mismatched contents", func(t *testing.T) {
+		store.writes = nil
+		upload := Upload{Contents: []byte("different"), Destination: "contents"}
+		if _, err := u.Upload(ctx, []Upload{upload}); err == nil {
+			t.Errorf("expected an error overwriting an object with different contents")
+		}
+		upload.Deduplicate = true
+		records, err := u.Upload(ctx, []Upload{upload})
+		if err != nil {
+			t.Fatalf("Upload() failed: %s", err)
+		}
+		if len(store.writes) != 0 || len(records) != 1 || !records[0].Skipped {
+			t.Errorf("expected deduplicated upload to keep the existing object, got writes %v and records %+v", store.writes, records)
+		}
+
+		upload.Deduplicate = false
+		upload.Overwrite = true
+		records, err = u.Upload(ctx, []Upload{upload})
+		if err != nil {
+			t.Fatalf("Upload() failed: %s", err)
+		}
+		if diff := cmp.Diff([]string{"contents"}, store.writes); diff != "" {
+			t.Errorf("unexpected writes (-want +got):\n%s", diff)
+		}
+		if len(records) != 1 || records[0].Skipped || records[0].Size != int64(len("different")) {
+			t.Errorf("expected the object to be overwritten, got records %+v", records)
+		}
+	})
+}
+
+func TestComputeDigests(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"a":       "a",
+		"sub/b":   "b",
+		"sub/c/d": "d",
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	uploads := []Upload{
+		{Source: filepath.Join(dir, "a"), Destination: "ns/a", Compress: true},
+		{Source: filepath.Join(dir, "sub"), Destination: "ns/sub", Recursive: true},
+		{Contents: []byte("e"), Destination: "ns/e"},
+	}
+	got, err := ComputeDigests(context.Background(), uploads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha256Of := func(s string) []byte {
+		sum := sha256.Sum256([]byte(s))
+		return sum[:]
+	}
+	want := Digests{
+		"ns/a":       sha256Of("a"),
+		"ns/sub/b":   sha256Of("b"),
+		"ns/sub/c/d": sha256Of("d"),
+		"ns/e":       sha256Of("e"),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected digests (-want +got):\n%s", diff)
+	}
+
+	uploads = append(uploads, Upload{Source: filepath.Join(dir, "missing"), Destination: "ns/missing"})
+	if _, err := ComputeDigests(context.Background(), uploads); err == nil {
+		t.Error("ComputeDigests succeeded with a missing source, want error")
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewStore(ctx, "file://"+t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore() failed: %s", err)
+	}
+	u := NewUploader(store, t.TempDir())
+	upload := Upload{Contents: []byte("contents"), Destination: "a/b/c"}
+
+	records, err := u.Upload(ctx, []Upload{upload})
+	if err != nil {
+		t.Fatalf("Upload() failed: %s", err)
+	}
+	if len(records) != 1 || records[0].Skipped {
+		t.Fatalf("expected a single uploaded object, got %+v", records)
+	}
+	attrs, err := store.Attrs(ctx, "a/b/c")
+	if err != nil {
+		t.Fatalf("Attrs() failed: %s", err)
+	}
+	if attrs.Size != int64(len(upload.Contents)) {
+		t.Errorf("got size %d, want %d", attrs.Size, len(upload.Contents))
+	}
+
+	// Uploading again should find the existing object.
+	records, err = u.Upload(ctx, []Upload{upload})
+	if err != nil {
+		t.Fatalf("Upload() failed: %s", err)
+	}
+	if len(records) != 1 || !records[0].Skipped {
+		t.Errorf("expected the existing object to be skipped, got %+v", records)
+	}
+
+	if _, err := store.Attrs(ctx, "nonexistent"); !errors.Is(err, ErrObjectNotExist) {
+		t.Errorf("got Attrs() error %v, want %v", err, ErrObjectNotExist)
+	}
+}
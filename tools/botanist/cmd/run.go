@@ -167,6 +167,8 @@ func (r *RunCommand) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&r.testrunnerFlags.SnapshotFile, "snapshot-output", "", "The output filename for the snapshot. This will be created in the output directory.")
 	f.BoolVar(&r.testrunnerFlags.PrefetchPackages, "prefetch-packages", false, "Prefetch any test packages in the background.")
 	f.BoolVar(&r.testrunnerFlags.UseSerial, "use-serial", false, "Use serial to run tests on the target.")
+	f.StringVar(&r.testrunnerFlags.ExpectedBuildVersion, "expected-build-version", "", "If set, check that the target is running this build version before running any tests, and fail if it isn't.")
+	f.BoolVar(&r.testrunnerFlags.RetryFailedCases, "retry-failed-cases", false, "When retrying a failed component v2 test, only rerun the test cases that failed, if they could be parsed from the test's output.")
 }
 
 func (r *RunCommand) execute(ctx context.Context, args []string) error {
@@ -594,6 +596,8 @@ func (r *RunCommand) runAgainstTarget(ctx context.Context, t targets.Target, arg
 		tf.IntVar(&testrunnerFlags.FfxExperimentLevel, "ffx-experiment-level", 0, "The level of experimental features to enable. If -ffx is not set, this will have no effect.")
 		tf.BoolVar(&testrunnerFlags.PrefetchPackages, "prefetch-packages", false, "Prefetch any test packages in the background.")
 		tf.BoolVar(&testrunnerFlags.UseSerial, "use-serial", false, "Use serial to run tests on the target.")
+		tf.StringVar(&testrunnerFlags.ExpectedBuildVersion, "expected-build-version", "", "If set, check that the target is running this build version before running any tests, and fail if it isn't.")
+		tf.BoolVar(&testrunnerFlags.RetryFailedCases, "retry-failed-cases", false, "When retrying a failed component v2 test, only rerun the test cases that failed, if they could be parsed from the test's output.")
 
 		// Once we remove "./testrunner" from the args we can remove this
 		// branch.
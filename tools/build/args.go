@@ -26,3 +26,15 @@ func (args Args) BoolValue(name string) (bool, error) {
 	err := json.Unmarshal(msg, &val)
 	return val, err
 }
+
+// StringValue returns the value of a string GN arg set in the build. If unset,
+// ErrArgNotSet will be returned.
+func (args Args) StringValue(name string) (string, error) {
+	msg, ok := args[name]
+	if !ok {
+		return "", ErrArgNotSet
+	}
+	var val string
+	err := json.Unmarshal(msg, &val)
+	return val, err
+}
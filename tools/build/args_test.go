@@ -12,7 +12,8 @@ import (
 func TestArgs(t *testing.T) {
 	argsJSON := []byte(`
 	{
-		"bool_var": true
+		"bool_var": true,
+		"string_var": "foo"
 	}`)
 	var args Args
 	if err := json.Unmarshal(argsJSON, &args); err != nil {
@@ -30,4 +31,19 @@ func TestArgs(t *testing.T) {
 	if err != ErrArgNotSet {
 		t.Fatalf("expected ErrArgNotSet and not %v", err)
 	}
+
+	strVal, err := args.StringValue("string_var")
+	if err != nil {
+		t.Fatalf("failed to determine value of string argument: %v", err)
+	} else if strVal != "foo" {
+		t.Fatalf("expected the value under |string_var| to be \"foo\", got %q", strVal)
+	}
+
+	if _, err := args.StringValue("nonexistent_var"); err != ErrArgNotSet {
+		t.Fatalf("expected ErrArgNotSet and not %v", err)
+	}
+
+	if _, err := args.StringValue("bool_var"); err == nil {
+		t.Fatalf("expected an error reading |bool_var| as a string")
+	}
 }
@@ -38,11 +38,12 @@ type TestListEntry struct {
 }
 
 type ExecutionDef struct {
-	Type            string `json:"type"`
-	ComponentURL    string `json:"component_url"`
-	TimeoutSeconds  int    `json:"timeout_seconds,omitempty"`
-	Parallel        uint16 `json:"parallel,omitempty"`
-	MaxSeverityLogs string `json:"max_severity_logs,omitempty"`
+	Type            string   `json:"type"`
+	ComponentURL    string   `json:"component_url"`
+	TimeoutSeconds  int      `json:"timeout_seconds,omitempty"`
+	Parallel        uint16   `json:"parallel,omitempty"`
+	MaxSeverityLogs string   `json:"max_severity_logs,omitempty"`
+	TestFilters     []string `json:"test_filters,omitempty"`
 }
 
 // TestTag represents arbitrary test metadata.
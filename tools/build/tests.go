@@ -66,6 +66,25 @@ type Test struct {
 	// Isolated specifies whether the test should run in its own shard.
 	Isolated bool `json:"isolated,omitempty"`
 
+	// SupportsTestSharding specifies whether the test implements Bazel's test
+	// sharding protocol: given the TEST_TOTAL_SHARDS and TEST_SHARD_INDEX
+	// environment variables, it runs only its share of its test cases. It is
+	// only supported for host tests.
+	SupportsTestSharding bool `json:"supports_test_sharding,omitempty"`
+
+	// Sandboxed specifies whether a host test should run in its own network
+	// namespace when testrunner sandboxes host tests with nsjail, so that it
+	// can't interfere with other tests, e.g. by listening on fixed ports.
+	// Unlike Isolated, it doesn't affect sharding.
+	Sandboxed bool `json:"sandboxed,omitempty"`
+
+	// SetupPath and TeardownPath are optional paths to host binaries run before
+	// and after a host test, with the same environment and output directory.
+	// The test fails if the setup fails, in which case it doesn't run, or if
+	// the teardown fails. The teardown runs even if the setup or test failed.
+	SetupPath    string `json:"setup_path,omitempty"`
+	TeardownPath string `json:"teardown_path,omitempty"`
+
 	// TimeoutSecs is the timeout for the test.
 	TimeoutSecs int `json:"timeout_secs,omitempty"`
 }
@@ -104,10 +123,15 @@ type Environment struct {
 	// and the value should be the name of the image to override with as defined
 	// in images.json.
 	ImageOverrides ImageOverrides `json:"image_overrides,omitempty"`
+
+	// Fallbacks are alternative dimensions, in order of preference, that the
+	// tests may be run on instead when no device matching Dimensions is
+	// available.
+	Fallbacks []DimensionSet `json:"fallbacks,omitempty"`
 }
 
 func (env Environment) TargetsEmulator() bool {
-	return env.Dimensions.DeviceType == "QEMU" || env.Dimensions.DeviceType == "AEMU"
+	return env.Dimensions.TargetsEmulator()
 }
 
 // ImageOverrides gives images by label that should override the default images.
@@ -135,3 +159,9 @@ type DimensionSet struct {
 	// Pool denotes the swarming pool to run a test in.
 	Pool string `json:"pool,omitempty"`
 }
+
+// TargetsEmulator returns whether the dimensions select an emulator rather
+// than a physical device.
+func (d DimensionSet) TargetsEmulator() bool {
+	return d.DeviceType == "QEMU" || d.DeviceType == "AEMU"
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// build is one of several builds, e.g. for different architectures, whose
+// coverage is merged into one report.
+type build struct {
+	name string
+	// summary is the path to the build's summary.json, optionally followed by
+	// `=<version>` as with -summary.
+	summary string
+}
+
+// buildsFlag is a flag.Value that collects builds given as
+// `<name>=<path>[=<version>]`.
+type buildsFlag []build
+
+func (f *buildsFlag) String() string {
+	var s []string
+	for _, b := range *f {
+		s = append(s, b.name+"="+b.summary)
+	}
+	return strings.Join(s, ",")
+}
+
+func (f *buildsFlag) Set(value string) error {
+	name, summary, ok := strings.Cut(value, "=")
+	if !ok || name == "" || summary == "" {
+		return fmt.Errorf("%q is not of the form <name>=<path>", value)
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("build name %q must not contain path separators", name)
+	}
+	for _, b := range *f {
+		if b.name == name {
+			return fmt.Errorf("build %q is given more than once", name)
+		}
+	}
+	*f = append(*f, build{name: name, summary: summary})
+	return nil
+}
+
+// splitBuildIDDirs splits the -build-id-dir arguments into the directories
+// shared by all builds and those given as `<build>=<path>` for one of builds.
+func splitBuildIDDirs(dirs []string, builds buildsFlag) (shared []string, perBuild map[string][]string) {
+	perBuild = make(map[string][]string)
+	for _, dir := range dirs {
+		if name, path, ok := strings.Cut(dir, "="); ok {
+			found := false
+			for _, b := range builds {
+				if b.name == name {
+					found = true
+					break
+				}
+			}
+			if found {
+				perBuild[name] = append(perBuild[name], path)
+				continue
+			}
+		}
+		shared = append(shared, dir)
+	}
+	return shared, perBuild
+}
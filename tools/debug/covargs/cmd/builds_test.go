@@ -0,0 +1,53 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildsFlag(t *testing.T) {
+	var f buildsFlag
+	for _, arg := range []string{"arm64=out/arm64/summary.json", "x64=out/x64/summary.json=14"} {
+		if err := f.Set(arg); err != nil {
+			t.Fatalf("Set(%q) failed: %s", arg, err)
+		}
+	}
+	want := buildsFlag{
+		{name: "arm64", summary: "out/arm64/summary.json"},
+		{name: "x64", summary: "out/x64/summary.json=14"},
+	}
+	if diff := cmp.Diff(want, f, cmp.AllowUnexported(build{})); diff != "" {
+		t.Errorf("unexpected builds (-want +got):\n%s", diff)
+	}
+
+	for _, arg := range []string{"", "arm64", "=summary.json", "arm64=", "a/b=summary.json", "x64=other.json"} {
+		if err := f.Set(arg); err == nil {
+			t.Errorf("Set(%q) succeeded, want error", arg)
+		}
+	}
+}
+
+func TestSplitBuildIDDirs(t *testing.T) {
+	builds := buildsFlag{{name: "arm64"}, {name: "x64"}}
+	shared, perBuild := splitBuildIDDirs([]string{
+		"out/arm64/.build-id",
+		"arm64=out/arm64/.build-id",
+		"x64=out/x64/.build-id",
+		"prebuilt=out/.build-id",
+	}, builds)
+	if diff := cmp.Diff([]string{"out/arm64/.build-id", "prebuilt=out/.build-id"}, shared); diff != "" {
+		t.Errorf("unexpected shared dirs (-want +got):\n%s", diff)
+	}
+	wantPerBuild := map[string][]string{
+		"arm64": {"out/arm64/.build-id"},
+		"x64":   {"out/x64/.build-id"},
+	}
+	if diff := cmp.Diff(wantPerBuild, perBuild); diff != "" {
+		t.Errorf("unexpected per-build dirs (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	// invocationsFile is the name of the file in the temporary directory that
+	// the log of tool invocations is written to.
+	invocationsFile = "invocations.json"
+
+	// maxInvocationOutput is the number of bytes of a tool's output kept in
+	// the log. Errors are usually reported last, so the end of the output is
+	// kept.
+	maxInvocationOutput = 16 * 1024
+)
+
+// invocation describes a single run of an external tool.
+type invocation struct {
+	Cmd   string    `json:"cmd"`
+	Args  []string  `json:"args"`
+	Start time.Time `json:"start"`
+	// DurationSecs is the wall time the tool took to run.
+	DurationSecs float64 `json:"duration_secs"`
+	// ExitCode is -1 if the tool couldn't be run or was killed by a signal.
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+	// Output is the end of the tool's output; OutputBytes is the size of
+	// the whole output.
+	Output          string `json:"output"`
+	OutputBytes     int    `json:"output_bytes"`
+	OutputTruncated bool   `json:"output_truncated"`
+}
+
+// invocationLog records the external tools run by covargs, so that slow or
+// failing steps can be diagnosed without running covargs again.
+type invocationLog struct {
+	mu          sync.Mutex
+	invocations []invocation
+}
+
+// invocations is the log of every tool run by this process.
+var invocations invocationLog
+
+// record adds a run of a to the log. output holds what the tool printed and
+// err is the error returned by running it.
+func (l *invocationLog) record(a Action, start time.Time, duration time.Duration, output *tailWriter, err error) {
+	inv := invocation{
+		Cmd:             a.Path,
+		Args:            a.Args,
+		Start:           start,
+		DurationSecs:    duration.Seconds(),
+		Output:          string(output.buf),
+		OutputBytes:     output.n,
+		OutputTruncated: output.n > len(output.buf),
+	}
+	if err != nil {
+		inv.Error = err.Error()
+		inv.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			inv.ExitCode = exitErr.ExitCode()
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.invocations = append(l.invocations, inv)
+}
+
+// write writes the log as JSON to path.
+func (l *invocationLog) write(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	invocations := l.invocations
+	if invocations == nil {
+		invocations = []invocation{}
+	}
+	data, err := json.MarshalIndent(invocations, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal invocations: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write invocations to %q: %w", path, err)
+	}
+	return nil
+}
+
+// tailWriter is an io.Writer that keeps the last maxInvocationOutput bytes
+// written to it.
+type tailWriter struct {
+	buf []byte
+	// n is the number of bytes written in total.
+	n int
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	w.buf = append(w.buf, p...)
+	if extra := len(w.buf) - maxInvocationOutput; extra > 0 {
+		w.buf = append(w.buf[:0], w.buf[extra:]...)
+	}
+	return len(p), nil
+}
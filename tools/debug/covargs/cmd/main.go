@@ -11,12 +11,15 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -24,6 +27,7 @@ import (
 
 	"go.fuchsia.dev/fuchsia/tools/debug/covargs"
 	"go.fuchsia.dev/fuchsia/tools/debug/covargs/api/llvm"
+	"go.fuchsia.dev/fuchsia/tools/debug/covargs/api/third_party/codecoverage"
 	"go.fuchsia.dev/fuchsia/tools/debug/symbolize"
 	"go.fuchsia.dev/fuchsia/tools/lib/cache"
 	"go.fuchsia.dev/fuchsia/tools/lib/color"
@@ -46,10 +50,13 @@ var (
 	colors          color.EnableColor
 	level           logger.LogLevel
 	summaryFile     flagmisc.StringsValue
+	builds          buildsFlag
 	buildIDDirPaths flagmisc.StringsValue
+	buildIDIndex    string
 	symbolServers   flagmisc.StringsValue
 	symbolCache     string
 	coverageReport  bool
+	coverageBadge   bool
 	dryRun          bool
 	skipFunctions   bool
 	outputDir       string
@@ -57,15 +64,23 @@ var (
 	llvmProfdata    flagmisc.StringsValue
 	outputFormat    string
 	jsonOutput      string
+	metricsOutput   string
 	reportDir       string
 	saveTemps       string
 	basePath        string
 	diffMappingFile string
+	diffFile        string
+	suppressionFile string
+	triageFile      string
 	compilationDir  string
 	pathRemapping   flagmisc.StringsValue
 	srcFiles        flagmisc.StringsValue
 	numThreads      int
 	jobs            int
+
+	uploadDestination string
+	uploadConcurrency int
+	uploadJSONOutput  string
 )
 
 func init() {
@@ -76,10 +91,17 @@ func init() {
 	flag.Var(&level, "level", "can be fatal, error, warning, info, debug or trace")
 	flag.Var(&summaryFile, "summary", "path to summary.json file. If given as `<path>=<version>`, the version should correspond "+
 		"to the llvm-profdata required to run with the profiles from this summary.json")
-	flag.Var(&buildIDDirPaths, "build-id-dir", "path to .build-id directory")
-	flag.Var(&symbolServers, "symbol-server", "a GCS URL or bucket name that contains debug binaries indexed by build ID")
+	flag.Var(&builds, "build", "a `<name>=<path>` to the summary.json of one of several builds, e.g. for different architectures, whose coverage "+
+		"is merged into one report that also breaks it down by build. May be repeated. The path may be followed by `=<version>` as with -summary. "+
+		"Can't be used with -summary, -diff or -diff-mapping")
+	flag.Var(&buildIDDirPaths, "build-id-dir", "path to .build-id directory. If given as `<build>=<path>`, where build is named by -build, "+
+		"the directory is only searched for the modules of that build")
+	flag.StringVar(&buildIDIndex, "build-id-index", "", "path to a file caching the debug binaries found in .build-id directories, "+
+		"which is created if it doesn't exist")
+	flag.Var(&symbolServers, "symbol-server", "a GCS URL or bucket name that contains debug binaries indexed by build ID, or the http(s) URL of a debuginfod server")
 	flag.StringVar(&symbolCache, "symbol-cache", "", "path to directory to store cached debug binaries in")
 	flag.BoolVar(&coverageReport, "coverage-report", true, "if set, generate a coverage report")
+	flag.BoolVar(&coverageBadge, "coverage-badge", false, "if set, also write a shields.io badge.json next to the coverage report's summary.json")
 	flag.BoolVar(&dryRun, "dry-run", false, "if set the system prints out commands that would be run instead of running them")
 	flag.BoolVar(&skipFunctions, "skip-functions", true, "if set, the coverage report enabled by the `report-dir` flag will not include function coverage")
 	flag.StringVar(&outputDir, "output-dir", "", "the directory to output results to")
@@ -88,16 +110,28 @@ func init() {
 	flag.StringVar(&llvmCov, "llvm-cov", "llvm-cov", "the location of llvm-cov")
 	flag.StringVar(&outputFormat, "format", "html", "the output format used for llvm-cov")
 	flag.StringVar(&jsonOutput, "json-output", "", "outputs profile information to the specified file")
-	flag.StringVar(&saveTemps, "save-temps", "", "save temporary artifacts in a directory")
+	flag.StringVar(&metricsOutput, "metrics-output", "", "if set, write the summary metrics of the coverage report to the specified file: "+
+		"the total and per top-level directory line, function and region coverage, and the number of instrumented and malformed modules")
+	flag.StringVar(&saveTemps, "save-temps", "", "save temporary artifacts in a directory, including invocations.json, which records the arguments, duration, exit status and output of each llvm-profdata and llvm-cov invocation")
 	flag.StringVar(&reportDir, "report-dir", "", "the directory to save the report to")
 	flag.StringVar(&basePath, "base", "", "base path for source tree")
 	flag.StringVar(&diffMappingFile, "diff-mapping", "", "path to diff mapping file")
+	flag.StringVar(&diffFile, "diff", "", "path to a unified diff. If given, the coverage of the lines it adds or changes is written to "+
+		"diff_coverage.json and diff_coverage.md in the directory given by -report-dir, for posting to code review. Paths in the diff are relative to -base")
+	flag.StringVar(&suppressionFile, "malformed-suppressions", "", "path to a JSON list of modules known to fail validation with llvm-cov, "+
+		"matched by `build_id` or by a `path` regular expression. Matching modules are reported separately from newly malformed modules")
+	flag.StringVar(&triageFile, "triage-corrupt-profiles", "", "if set, when llvm-profdata fails to merge the profiles, find the corrupt profiles "+
+		"by bisection and report the coverage of the remaining ones. The corrupt profiles and the tests that produced them are written to this JSON file")
 	flag.StringVar(&compilationDir, "compilation-dir", "", "the directory used as a base for relative coverage mapping paths, passed through to llvm-cov")
 	flag.Var(&pathRemapping, "path-equivalence", "<from>,<to> remapping of source file paths passed through to llvm-cov")
 	flag.Var(&srcFiles, "src-file", "path to a source file to generate coverage for. If provided, only coverage for these files will be generated.\n"+
 		"Multiple files can be specified with multiple instances of this flag.")
 	flag.IntVar(&numThreads, "num-threads", 0, "number of processing threads")
 	flag.IntVar(&jobs, "jobs", runtime.NumCPU(), "number of parallel jobs")
+	flag.StringVar(&uploadDestination, "upload-destination", "", "if set, upload the directories given by -output-dir and -report-dir "+
+		"to this URL (gs://<bucket>/<prefix> or a local directory) once they are generated")
+	flag.IntVar(&uploadConcurrency, "upload-concurrency", 16, "maximum number of files to upload at once")
+	flag.StringVar(&uploadJSONOutput, "upload-json-output", "", "outputs the name, URL and number of files of each uploaded directory to the specified file")
 }
 
 const llvmProfileSinkType = "llvm-profile"
@@ -150,6 +184,21 @@ func readSummary(summaryFiles []string) (map[string]runtests.DataSinkMap, error)
 	return versionedSinks, nil
 }
 
+// mergeError is returned when llvm-profdata fails to merge profiles.
+type mergeError struct {
+	cmd    string
+	err    error
+	output []byte
+}
+
+func (e *mergeError) Error() string {
+	return fmt.Sprintf("%s failed with %v:\n%s", e.cmd, e.err, string(e.output))
+}
+
+func (e *mergeError) Unwrap() error {
+	return e.err
+}
+
 type Action struct {
 	Path string   `json:"cmd"`
 	Args []string `json:"args"`
@@ -158,7 +207,12 @@ type Action struct {
 func (a Action) Run(ctx context.Context) ([]byte, error) {
 	logger.Debugf(ctx, "%s\n", a.String())
 	if !dryRun {
-		return exec.Command(a.Path, a.Args...).CombinedOutput()
+		start := time.Now()
+		output, err := exec.Command(a.Path, a.Args...).CombinedOutput()
+		var tail tailWriter
+		tail.Write(output)
+		invocations.record(a, start, time.Since(start), &tail, err)
+		return output, err
 	}
 	return nil, nil
 }
@@ -284,6 +338,16 @@ type partition struct {
 type profileEntry struct {
 	Profile string `json:"profile"`
 	Module  string `json:"module"`
+	// Build is the name of the build given by -build that the profile is
+	// from, if any.
+	Build string `json:"build,omitempty"`
+}
+
+// malformedModule is a module that failed validation with llvm-cov.
+type malformedModule struct {
+	buildID string
+	// known is set if the module matched a suppression.
+	known bool
 }
 
 // for testability.
@@ -372,23 +436,19 @@ func mergeEntries(ctx context.Context, vf versionFetcher, versionedSummaries map
 	return entries, nil
 }
 
-func process(ctx context.Context, repo symbolize.Repository) error {
+// readProfiles reads the profiles listed in summaryFiles and the build IDs of
+// the modules they were collected from, and partitions them by the
+// llvm-profdata tool, keyed by version in tools, that reads them.
+func readProfiles(ctx context.Context, summaryFiles []string, tools map[string]string) ([]profileEntry, map[string]*partition, error) {
 	partitions := make(map[string]*partition)
-	var err error
-
-	for _, profdata := range llvmProfdata {
-		version, tool := splitVersion(profdata)
+	for version, tool := range tools {
 		partitions[version] = &partition{tool: tool}
 	}
 
-	if _, ok := partitions[""]; !ok {
-		return fmt.Errorf("missing default llvm-profdata tool path")
-	}
-
 	// Read in all the data in summary file
-	summaries, err := readSummary(summaryFile)
+	summaries, err := readSummary(summaryFiles)
 	if err != nil {
-		return fmt.Errorf("parsing info: %w", err)
+		return nil, nil, fmt.Errorf("parsing info: %w", err)
 	}
 
 	vf := newProfrawVersionFetcher()
@@ -397,65 +457,106 @@ func process(ctx context.Context, repo symbolize.Repository) error {
 	entries, err := mergeEntries(ctx, vf, summaries, partitions)
 
 	if err != nil {
-		return fmt.Errorf("merging info: %w", err)
+		return nil, nil, fmt.Errorf("merging info: %w", err)
 	}
+	return entries, partitions, nil
+}
 
-	tempDir := saveTemps
-	if saveTemps == "" {
-		tempDir, err = os.MkdirTemp(saveTemps, "covargs")
-		if err != nil {
-			return fmt.Errorf("cannot create temporary dir: %w", err)
-		}
-		defer os.RemoveAll(tempDir)
+// profileInputs are the inputs llvm-cov needs to report coverage.
+type profileInputs struct {
+	// profdata is the path of the merged profile.
+	profdata string
+	// covFile is the path of the llvm-cov response file listing the modules.
+	covFile string
+	// modules are the valid instrumented modules, which are open until close
+	// is called.
+	modules []symbolize.FileCloser
+	// corrupt are the profiles left out because they failed to merge, if
+	// -triage-corrupt-profiles is set.
+	corrupt []corruptProfile
+	// malformed is the number of modules left out because they failed
+	// validation, of which newMalformed aren't known to be malformed.
+	malformed    int
+	newMalformed int
+}
+
+func (in *profileInputs) close() {
+	for _, module := range in.modules {
+		module.Close()
 	}
+}
 
-	if jsonOutput != "" {
-		file, err := os.Create(jsonOutput)
-		if err != nil {
-			return fmt.Errorf("creating profile output file: %w", err)
-		}
-		defer file.Close()
-		if err := json.NewEncoder(file).Encode(entries); err != nil {
-			return fmt.Errorf("writing profile information: %w", err)
-		}
+// mergeRawProfiles merges the raw profiles with the llvm-profdata tool into
+// mergedFile, listing them in the response file rspFile.
+func mergeRawProfiles(ctx context.Context, tool string, profiles []string, rspFile, mergedFile string) error {
+	// Make the llvm-profdata response file.
+	profdataFile, err := os.Create(rspFile)
+	if err != nil {
+		return fmt.Errorf("creating llvm-profdata.rsp file: %w", err)
 	}
 
+	for _, profile := range profiles {
+		fmt.Fprintf(profdataFile, "%s\n", profile)
+	}
+	profdataFile.Close()
+
+	args := []string{
+		"merge",
+		"--failure-mode=any",
+		"--sparse",
+		"--output", mergedFile,
+	}
+	if numThreads != 0 {
+		args = append(args, "--num-threads", strconv.Itoa(numThreads))
+	}
+	args = append(args, "@"+profdataFile.Name())
+	mergeCmd := Action{Path: tool, Args: args}
+	data, err := mergeCmd.Run(ctx)
+	if err != nil {
+		return &mergeError{cmd: mergeCmd.String(), err: err, output: data}
+	}
+	return nil
+}
+
+// mergeProfiles merges the profiles of each partition, and fetches from repo
+// the modules that the entries were collected from. Intermediate files are
+// written to tempDir.
+func mergeProfiles(ctx context.Context, repo symbolize.Repository, entries []profileEntry, partitions map[string]*partition, knownMalformed suppressions, tempDir string) (*profileInputs, error) {
 	profdataFiles := []string{}
+	var corrupt []corruptProfile
 	for version, partition := range partitions {
 		if len(partition.profiles) == 0 {
 			continue
 		}
 
-		// Make the llvm-profdata response file.
-		profdataFile, err := os.Create(filepath.Join(tempDir, fmt.Sprintf("llvm-profdata%s.rsp", version)))
-		if err != nil {
-			return fmt.Errorf("creating llvm-profdata.rsp file: %w", err)
-		}
-
-		for _, profile := range partition.profiles {
-			fmt.Fprintf(profdataFile, "%s\n", profile)
-		}
-		profdataFile.Close()
-
 		// Merge all raw profiles.
+		rspFile := filepath.Join(tempDir, fmt.Sprintf("llvm-profdata%s.rsp", version))
 		mergedFile := filepath.Join(tempDir, fmt.Sprintf("merged%s.profdata", version))
-		args := []string{
-			"merge",
-			"--failure-mode=any",
-			"--sparse",
-			"--output", mergedFile,
-		}
-		if numThreads != 0 {
-			args = append(args, "--num-threads", strconv.Itoa(numThreads))
-		}
-		args = append(args, "@"+profdataFile.Name())
-		mergeCmd := Action{Path: partition.tool, Args: args}
-		data, err := mergeCmd.Run(ctx)
+		err := mergeRawProfiles(ctx, partition.tool, partition.profiles, rspFile, mergedFile)
+		var mergeErr *mergeError
+		if errors.As(err, &mergeErr) && triageFile != "" {
+			logger.Errorf(ctx, "%v", err)
+			tool := partition.tool
+			merge := func(ctx context.Context, profiles []string) error {
+				return mergeRawProfiles(ctx, tool, profiles,
+					filepath.Join(tempDir, fmt.Sprintf("triage%s.rsp", version)),
+					filepath.Join(tempDir, fmt.Sprintf("triage%s.profdata", version)))
+			}
+			found, remaining, triageErr := triageProfiles(ctx, merge, partition.profiles, mergeErr)
+			if triageErr != nil {
+				return nil, triageErr
+			}
+			corrupt = append(corrupt, found...)
+			err = mergeRawProfiles(ctx, partition.tool, remaining, rspFile, mergedFile)
+		}
 		if err != nil {
-			return fmt.Errorf("%s failed with %v:\n%s", mergeCmd.String(), err, string(data))
+			return nil, err
 		}
 		profdataFiles = append(profdataFiles, mergedFile)
 	}
+	sort.Slice(corrupt, func(i, j int) bool {
+		return corrupt[i].Profile < corrupt[j].Profile
+	})
 
 	mergedFile := filepath.Join(tempDir, "merged.profdata")
 	args := []string{
@@ -471,30 +572,35 @@ func process(ctx context.Context, repo symbolize.Repository) error {
 	mergeCmd := Action{Path: partitions[""].tool, Args: args}
 	data, err := mergeCmd.Run(ctx)
 	if err != nil {
-		return fmt.Errorf("%s failed with %v:\n%s", mergeCmd.String(), err, string(data))
+		return nil, fmt.Errorf("%s failed with %v:\n%s", mergeCmd.String(), err, string(data))
 	}
 
 	// Gather the set of modules and coverage files
-	modules := []symbolize.FileCloser{}
+	in := &profileInputs{profdata: mergedFile, corrupt: corrupt}
 	files := make(chan symbolize.FileCloser)
-	malformedModules := make(chan string)
+	malformedModules := make(chan malformedModule)
+	buildIDs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		buildIDs = append(buildIDs, entry.Module)
+	}
+	fetched := symbolize.Prefetch(ctx, repo, buildIDs, symbolize.PrefetchOptions{
+		Parallelism: jobs,
+		Backoff: func() retry.Backoff {
+			return retry.WithMaxAttempts(retry.NewConstantBackoff(cloudFetchRetryBackoff), cloudFetchMaxAttempts)
+		},
+	})
 	s := make(chan struct{}, jobs)
 	var wg sync.WaitGroup
-	for _, entry := range entries {
+	for module, result := range fetched {
+		if result.Err != nil {
+			logger.Warningf(ctx, "module with build id %s not found: %v\n", module, result.Err)
+			continue
+		}
 		wg.Add(1)
-		go func(module string) {
+		go func(module string, file symbolize.FileCloser) {
 			defer wg.Done()
 			s <- struct{}{}
 			defer func() { <-s }()
-			var file symbolize.FileCloser
-			if err := retry.Retry(ctx, retry.WithMaxAttempts(retry.NewConstantBackoff(cloudFetchRetryBackoff), cloudFetchMaxAttempts), func() error {
-				var err error
-				file, err = repo.GetBuildObject(module)
-				return err
-			}, nil); err != nil {
-				logger.Warningf(ctx, "module with build id %s not found: %v\n", module, err)
-				return
-			}
 			if isInstrumented(file.String()) {
 				// Run llvm-cov with the individual module to make sure it's valid.
 				args := []string{
@@ -509,45 +615,72 @@ func process(ctx context.Context, repo symbolize.Repository) error {
 				showCmd := Action{Path: llvmCov, Args: args}
 				data, err := showCmd.Run(ctx)
 				if err != nil {
-					logger.Warningf(ctx, "module %s returned err %v:\n%s", module, err, string(data))
+					sup, known := knownMalformed.match(module, file.String())
+					if known {
+						logger.Infof(ctx, "known malformed module %s (%s) returned err %v", module, sup.Reason, err)
+					} else {
+						logger.Errorf(ctx, "new malformed module %s returned err %v:\n%s", module, err, string(data))
+					}
 					file.Close()
-					malformedModules <- module
+					malformedModules <- malformedModule{buildID: module, known: known}
 				} else {
 					files <- file
 				}
 			} else {
 				file.Close()
 			}
-		}(entry.Module)
+		}(module, result.File)
 	}
 	go func() {
 		wg.Wait()
 		close(malformedModules)
 		close(files)
 	}()
-	var malformed []string
+	var malformed, newMalformed []string
+	malformedDone := make(chan struct{})
 	go func() {
+		defer close(malformedDone)
 		for m := range malformedModules {
-			malformed = append(malformed, m)
+			malformed = append(malformed, m.buildID)
+			if !m.known {
+				newMalformed = append(newMalformed, m.buildID)
+			}
 		}
 	}()
 	for f := range files {
-		modules = append(modules, f)
-		// Make sure we close all modules in the case of error
-		defer f.Close()
+		in.modules = append(in.modules, f)
 	}
+	<-malformedDone
+	sort.Strings(malformed)
+	sort.Strings(newMalformed)
+	in.malformed = len(malformed)
+	in.newMalformed = len(newMalformed)
 
 	// Write the malformed modules to a file in order to keep track of the tests affected by fxbug.dev/74189.
 	if err := os.WriteFile(filepath.Join(tempDir, "malformed_binaries.txt"), []byte(strings.Join(malformed, "\n")), os.ModePerm); err != nil {
-		return fmt.Errorf("failed to write malformed binaries to a file: %w", err)
+		in.close()
+		return nil, fmt.Errorf("failed to write malformed binaries to a file: %w", err)
+	}
+	// Modules that aren't known to be malformed are written separately so that
+	// regressions stand out.
+	if err := os.WriteFile(filepath.Join(tempDir, "new_malformed_binaries.txt"), []byte(strings.Join(newMalformed, "\n")), os.ModePerm); err != nil {
+		in.close()
+		return nil, fmt.Errorf("failed to write new malformed binaries to a file: %w", err)
+	}
+	if len(newMalformed) > 0 {
+		logger.Errorf(ctx, "%d of %d malformed modules aren't known to be malformed: %s",
+			len(newMalformed), len(malformed), strings.Join(newMalformed, ", "))
+	} else if len(malformed) > 0 {
+		logger.Infof(ctx, "all %d malformed modules are known to be malformed", len(malformed))
 	}
 
 	// Make the llvm-cov response file
 	covFile, err := os.Create(filepath.Join(tempDir, "llvm-cov.rsp"))
 	if err != nil {
-		return fmt.Errorf("creating llvm-cov.rsp file: %w", err)
+		in.close()
+		return nil, fmt.Errorf("creating llvm-cov.rsp file: %w", err)
 	}
-	for i, module := range modules {
+	for i, module := range in.modules {
 		// llvm-cov expects a positional arg representing the first
 		// object file before it processes the rest of the positional
 		// args as source files, so we don't use an -object flag with
@@ -562,106 +695,429 @@ func process(ctx context.Context, repo symbolize.Repository) error {
 		fmt.Fprintf(covFile, "%s\n", srcFile)
 	}
 	covFile.Close()
+	in.covFile = covFile.Name()
 
-	if outputDir != "" {
-		// Make the output directory
-		err := os.MkdirAll(outputDir, os.ModePerm)
-		if err != nil {
-			return fmt.Errorf("creating output dir %s: %w", outputDir, err)
+	return in, nil
+}
+
+// showCoverage writes the llvm-cov report in the format given by -format to
+// dir.
+func showCoverage(ctx context.Context, in *profileInputs, covOpts covOptions, dir string) error {
+	// Make the output directory
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("creating output dir %s: %w", dir, err)
+	}
+
+	// Produce HTML report
+	args := []string{
+		"show",
+		"-format", outputFormat,
+		"-instr-profile", in.profdata,
+		"-output-dir", dir,
+	}
+	if covOpts.compilationDir != "" {
+		args = append(args, "-compilation-dir", covOpts.compilationDir)
+	}
+	for _, remapping := range pathRemapping {
+		args = append(args, "-path-equivalence", remapping)
+	}
+	args = append(args, "@"+in.covFile)
+	showCmd := Action{Path: llvmCov, Args: args}
+	data, err := showCmd.Run(ctx)
+	if err != nil {
+		return fmt.Errorf("%v:\n%s", err, string(data))
+	}
+	logger.Debugf(ctx, "%s\n", string(data))
+	return nil
+}
+
+// exportCoverage exports the coverage data in the JSON format of llvm-cov
+// export, which is also saved to coverage.json in tempDir.
+func exportCoverage(ctx context.Context, in *profileInputs, covOpts covOptions, tempDir string) (*bytes.Buffer, error) {
+	stderrFilename := filepath.Join(tempDir, "llvm-cov.stderr.log")
+	stderrFile, err := os.Create(stderrFilename)
+	if err != nil {
+		return nil, fmt.Errorf("creating export %q: %w", stderrFilename, err)
+	}
+	defer stderrFile.Close()
+
+	// Export data in machine readable format.
+	var b bytes.Buffer
+	args := []string{
+		"export",
+		"-instr-profile", in.profdata,
+		"-skip-expansions",
+	}
+	if covOpts.skipFunctions {
+		args = append(args, "-skip-functions")
+	}
+	for _, remapping := range pathRemapping {
+		args = append(args, "-path-equivalence", remapping)
+	}
+	args = append(args, "@"+in.covFile)
+	exportCmd := Action{Path: llvmCov, Args: args}
+	var stderr tailWriter
+	cmd := exec.Command(exportCmd.Path, exportCmd.Args...)
+	cmd.Stdout = &b
+	cmd.Stderr = io.MultiWriter(stderrFile, &stderr)
+	start := time.Now()
+	err = cmd.Run()
+	invocations.record(exportCmd, start, time.Since(start), &stderr, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export: %w", err)
+	}
+
+	coverageFilename := filepath.Join(tempDir, "coverage.json")
+	if err := os.WriteFile(coverageFilename, b.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("writing coverage %q: %w", coverageFilename, err)
+	}
+	return &b, nil
+}
+
+func process(ctx context.Context, repos map[string]*symbolize.CompositeRepo) error {
+	tools := make(map[string]string)
+	for _, profdata := range llvmProfdata {
+		version, tool := splitVersion(profdata)
+		tools[version] = tool
+	}
+
+	if _, ok := tools[""]; !ok {
+		return fmt.Errorf("missing default llvm-profdata tool path")
+	}
+
+	if diffFile != "" && reportDir == "" {
+		return fmt.Errorf("-diff requires -report-dir")
+	}
+
+	if metricsOutput != "" && (reportDir == "" || !coverageReport) {
+		return fmt.Errorf("-metrics-output requires -report-dir and -coverage-report")
+	}
+
+	if len(builds) > 0 {
+		if len(summaryFile) > 0 {
+			return fmt.Errorf("-build can't be used with -summary")
+		}
+		if diffFile != "" || diffMappingFile != "" {
+			return fmt.Errorf("-build can't be used with -diff or -diff-mapping")
+		}
+	}
+
+	// Make sure the tools are supported before doing any work, and adapt the
+	// llvm-cov command lines to its version.
+	for _, tool := range tools {
+		if _, err := probeLLVMVersion(ctx, tool, minLLVMProfdataVersion); err != nil {
+			return err
 		}
+	}
+	covVersion, err := probeLLVMVersion(ctx, llvmCov, minLLVMCovVersion)
+	if err != nil {
+		return err
+	}
+	covOpts, err := adaptCovOptions(ctx, covVersion, covOptions{
+		skipFunctions:  skipFunctions,
+		compilationDir: compilationDir,
+	})
+	if err != nil {
+		return err
+	}
 
-		// Produce HTML report
-		args := []string{
-			"show",
-			"-format", outputFormat,
-			"-instr-profile", mergedFile,
-			"-output-dir", outputDir,
+	var knownMalformed suppressions
+	if suppressionFile != "" {
+		if knownMalformed, err = loadSuppressions(suppressionFile); err != nil {
+			return err
 		}
-		if compilationDir != "" {
-			args = append(args, "-compilation-dir", compilationDir)
+	}
+
+	tempDir := saveTemps
+	if saveTemps == "" {
+		tempDir, err = os.MkdirTemp(saveTemps, "covargs")
+		if err != nil {
+			return fmt.Errorf("cannot create temporary dir: %w", err)
 		}
-		for _, remapping := range pathRemapping {
-			args = append(args, "-path-equivalence", remapping)
+		defer os.RemoveAll(tempDir)
+	}
+	// Record the tools that were run even if one of them failed.
+	defer func() {
+		if err := invocations.write(filepath.Join(tempDir, invocationsFile)); err != nil {
+			logger.Warningf(ctx, "%v\n", err)
 		}
-		args = append(args, "@"+covFile.Name())
-		showCmd := Action{Path: llvmCov, Args: args}
-		data, err := showCmd.Run(ctx)
+	}()
+
+	var entries []profileEntry
+	if len(builds) > 0 {
+		entries, err = processBuilds(ctx, repos, tools, covOpts, knownMalformed, tempDir)
+	} else {
+		entries, err = processBuild(ctx, repos[""], tools, covOpts, knownMalformed, tempDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	if uploadDestination != "" {
+		dirs := make(map[string]string)
+		if outputDir != "" {
+			dirs["output"] = outputDir
+		}
+		if reportDir != "" {
+			dirs["report"] = reportDir
+		}
+		uploads, err := covargs.UploadDirs(ctx, uploadDestination, dirs, uploadConcurrency, tempDir)
 		if err != nil {
-			return fmt.Errorf("%v:\n%s", err, string(data))
+			return fmt.Errorf("failed to upload results: %w", err)
+		}
+		for _, upload := range uploads {
+			logger.Infof(ctx, "uploaded %d files to %s", upload.Objects, upload.URL)
+		}
+		if uploadJSONOutput != "" {
+			if err := writeUploadJSONOutput(uploads); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// processBuild reports the coverage of the profiles listed by -summary.
+func processBuild(ctx context.Context, repo symbolize.Repository, tools map[string]string, covOpts covOptions, knownMalformed suppressions, tempDir string) ([]profileEntry, error) {
+	entries, partitions, err := readProfiles(ctx, summaryFile, tools)
+	if err != nil {
+		return nil, err
+	}
+
+	if jsonOutput != "" {
+		if err := writeJSONOutput(entries); err != nil {
+			return nil, err
+		}
+	}
+
+	in, err := mergeProfiles(ctx, repo, entries, partitions, knownMalformed, tempDir)
+	if err != nil {
+		return nil, err
+	}
+	defer in.close()
+
+	if triageFile != "" {
+		if err := reportCorruptProfiles(ctx, in.corrupt, "", summaryFile); err != nil {
+			return nil, err
+		}
+		if err := writeTriage(triageFile, in.corrupt); err != nil {
+			return nil, err
+		}
+	}
+
+	if outputDir != "" {
+		if err := showCoverage(ctx, in, covOpts, outputDir); err != nil {
+			return nil, err
 		}
-		logger.Debugf(ctx, "%s\n", string(data))
 	}
 
 	if reportDir != "" {
 		// Make the export directory
 		err := os.MkdirAll(reportDir, os.ModePerm)
 		if err != nil {
-			return fmt.Errorf("creating export dir %s: %w", reportDir, err)
+			return nil, fmt.Errorf("creating export dir %s: %w", reportDir, err)
 		}
 
-		stderrFilename := filepath.Join(tempDir, "llvm-cov.stderr.log")
-		stderrFile, err := os.Create(stderrFilename)
+		b, err := exportCoverage(ctx, in, covOpts, tempDir)
 		if err != nil {
-			return fmt.Errorf("creating export %q: %w", stderrFilename, err)
+			return nil, err
 		}
-		defer stderrFile.Close()
 
-		// Export data in machine readable format.
-		var b bytes.Buffer
-		args := []string{
-			"export",
-			"-instr-profile", mergedFile,
-			"-skip-expansions",
-		}
-		if skipFunctions {
-			args = append(args, "-skip-functions")
-		}
-		for _, remapping := range pathRemapping {
-			args = append(args, "-path-equivalence", remapping)
-		}
-		args = append(args, "@"+covFile.Name())
-		cmd := exec.Command(llvmCov, args...)
-		cmd.Stdout = &b
-		cmd.Stderr = stderrFile
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to export: %w", err)
+		var export llvm.Export
+		if coverageReport || diffFile != "" {
+			if err := json.NewDecoder(b).Decode(&export); err != nil {
+				return nil, fmt.Errorf("failed to load the exported file: %w", err)
+			}
 		}
 
-		coverageFilename := filepath.Join(tempDir, "coverage.json")
-		if err := os.WriteFile(coverageFilename, b.Bytes(), 0644); err != nil {
-			return fmt.Errorf("writing coverage %q: %w", coverageFilename, err)
-		}
+		if diffFile != "" {
+			file, err := os.Open(diffFile)
+			if err != nil {
+				return nil, fmt.Errorf("cannot open %q: %w", diffFile, err)
+			}
+			defer file.Close()
 
-		if coverageReport {
-			var export llvm.Export
-			if err := json.NewDecoder(&b).Decode(&export); err != nil {
-				return fmt.Errorf("failed to load the exported file: %w", err)
+			diff, err := covargs.ParseDiff(file)
+			if err != nil {
+				return nil, err
+			}
+			diffCoverage, err := covargs.ComputeDiffCoverage(&export, basePath, diff)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compute diff coverage: %w", err)
+			}
+			if err := covargs.SaveDiffCoverage(diffCoverage, reportDir); err != nil {
+				return nil, fmt.Errorf("failed to save diff coverage: %w", err)
 			}
+		}
 
+		if coverageReport {
 			var mapping *covargs.DiffMapping
 			if diffMappingFile != "" {
 				file, err := os.Open(diffMappingFile)
 				if err != nil {
-					return fmt.Errorf("cannot open %q: %w", diffMappingFile, err)
+					return nil, fmt.Errorf("cannot open %q: %w", diffMappingFile, err)
 				}
 				defer file.Close()
 
 				if err := json.NewDecoder(file).Decode(mapping); err != nil {
-					return fmt.Errorf("failed to load the diff mapping file: %w", err)
+					return nil, fmt.Errorf("failed to load the diff mapping file: %w", err)
 				}
 			}
 
 			files, err := covargs.ConvertFiles(&export, basePath, mapping)
 			if err != nil {
-				return fmt.Errorf("failed to convert files: %w", err)
+				return nil, fmt.Errorf("failed to convert files: %w", err)
+			}
+
+			report, err := covargs.SaveReport(files, shardSize, reportDir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to save report: %w", err)
+			}
+
+			if err := covargs.SaveSummary(covargs.Summarize(report.Summaries), coverageBadge, reportDir); err != nil {
+				return nil, fmt.Errorf("failed to save summary: %w", err)
 			}
 
-			if _, err := covargs.SaveReport(files, shardSize, reportDir); err != nil {
-				return fmt.Errorf("failed to save report: %w", err)
+			if metricsOutput != "" {
+				if err := saveMetrics(report, []*profileInputs{in}); err != nil {
+					return nil, err
+				}
 			}
 		}
 	}
 
+	return entries, nil
+}
+
+// processBuilds reports the coverage of each of the builds given by -build,
+// and merges their coverage into one report. The llvm-cov output of each
+// build is written to a subdirectory of -output-dir named after the build.
+func processBuilds(ctx context.Context, repos map[string]*symbolize.CompositeRepo, tools map[string]string, covOpts covOptions, knownMalformed suppressions, tempDir string) ([]profileEntry, error) {
+	var entries []profileEntry
+	var corrupt []corruptProfile
+	var inputs []*profileInputs
+	buildFiles := make(map[string][]*codecoverage.File)
+	for _, b := range builds {
+		buildTempDir := filepath.Join(tempDir, b.name)
+		if err := os.MkdirAll(buildTempDir, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("creating temporary dir for build %s: %w", b.name, err)
+		}
+
+		buildEntries, partitions, err := readProfiles(ctx, []string{b.summary}, tools)
+		if err != nil {
+			return nil, fmt.Errorf("build %s: %w", b.name, err)
+		}
+		for i := range buildEntries {
+			buildEntries[i].Build = b.name
+		}
+		entries = append(entries, buildEntries...)
+
+		in, err := mergeProfiles(ctx, repos[b.name], buildEntries, partitions, knownMalformed, buildTempDir)
+		if err != nil {
+			return nil, fmt.Errorf("build %s: %w", b.name, err)
+		}
+		defer in.close()
+		inputs = append(inputs, in)
+
+		if triageFile != "" {
+			if err := reportCorruptProfiles(ctx, in.corrupt, b.name, []string{b.summary}); err != nil {
+				return nil, fmt.Errorf("build %s: %w", b.name, err)
+			}
+			corrupt = append(corrupt, in.corrupt...)
+		}
+
+		if outputDir != "" {
+			if err := showCoverage(ctx, in, covOpts, filepath.Join(outputDir, b.name)); err != nil {
+				return nil, fmt.Errorf("build %s: %w", b.name, err)
+			}
+		}
+
+		if reportDir != "" && coverageReport {
+			data, err := exportCoverage(ctx, in, covOpts, buildTempDir)
+			if err != nil {
+				return nil, fmt.Errorf("build %s: %w", b.name, err)
+			}
+			var export llvm.Export
+			if err := json.NewDecoder(data).Decode(&export); err != nil {
+				return nil, fmt.Errorf("failed to load the exported file of build %s: %w", b.name, err)
+			}
+			if buildFiles[b.name], err = covargs.ConvertFiles(&export, basePath, nil); err != nil {
+				return nil, fmt.Errorf("failed to convert files of build %s: %w", b.name, err)
+			}
+		}
+	}
+
+	if triageFile != "" {
+		if err := writeTriage(triageFile, corrupt); err != nil {
+			return nil, err
+		}
+	}
+
+	if jsonOutput != "" {
+		if err := writeJSONOutput(entries); err != nil {
+			return nil, err
+		}
+	}
+
+	if reportDir != "" && coverageReport {
+		if err := os.MkdirAll(reportDir, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("creating export dir %s: %w", reportDir, err)
+		}
+		report, err := covargs.SaveBuildsReport(buildFiles, shardSize, reportDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save report: %w", err)
+		}
+		if err := covargs.SaveSummary(covargs.Summarize(report.Summaries), coverageBadge, reportDir); err != nil {
+			return nil, fmt.Errorf("failed to save summary: %w", err)
+		}
+		if metricsOutput != "" {
+			if err := saveMetrics(report, inputs); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// saveMetrics writes the metrics of report, whose modules are those of inputs,
+// to -metrics-output.
+func saveMetrics(report *codecoverage.CoverageReport, inputs []*profileInputs) error {
+	metrics := covargs.ComputeMetrics(report)
+	for _, in := range inputs {
+		metrics.Modules += len(in.modules)
+		metrics.MalformedModules += in.malformed
+		metrics.NewMalformedModules += in.newMalformed
+	}
+	if err := covargs.SaveMetrics(metrics, metricsOutput); err != nil {
+		return fmt.Errorf("failed to save metrics: %w", err)
+	}
+	return nil
+}
+
+func writeJSONOutput(entries []profileEntry) error {
+	file, err := os.Create(jsonOutput)
+	if err != nil {
+		return fmt.Errorf("creating profile output file: %w", err)
+	}
+	defer file.Close()
+	if err := json.NewEncoder(file).Encode(entries); err != nil {
+		return fmt.Errorf("writing profile information: %w", err)
+	}
+	return nil
+}
+
+func writeUploadJSONOutput(uploads []covargs.UploadedDir) error {
+	file, err := os.Create(uploadJSONOutput)
+	if err != nil {
+		return fmt.Errorf("creating upload output file: %w", err)
+	}
+	defer file.Close()
+	if err := json.NewEncoder(file).Encode(uploads); err != nil {
+		return fmt.Errorf("writing upload information: %w", err)
+	}
 	return nil
 }
 
@@ -671,9 +1127,34 @@ func main() {
 	log := logger.NewLogger(level, color.NewColor(colors), os.Stdout, os.Stderr, "")
 	ctx := logger.WithLogger(context.Background(), log)
 
-	var repo symbolize.CompositeRepo
-	for _, dir := range buildIDDirPaths {
-		repo.AddRepo(symbolize.NewBuildIDRepo(dir))
+	var index *symbolize.BuildIDIndex
+	if buildIDIndex != "" {
+		var err error
+		if index, err = symbolize.LoadBuildIDIndex(buildIDIndex); err != nil {
+			log.Fatalf("failed to load the build ID index: %v\n", err)
+		}
+	}
+	// Each build has its own repository, which searches its build ID
+	// directories before those shared by all builds and the symbol servers.
+	sharedDirs, buildDirs := splitBuildIDDirs(buildIDDirPaths, builds)
+	repos := make(map[string]*symbolize.CompositeRepo)
+	if len(builds) == 0 {
+		repos[""] = &symbolize.CompositeRepo{}
+	}
+	for _, b := range builds {
+		repos[b.name] = &symbolize.CompositeRepo{}
+	}
+	for name, repo := range repos {
+		for _, dir := range append(buildDirs[name], sharedDirs...) {
+			buildIDRepo := symbolize.NewBuildIDRepo(dir)
+			buildIDRepo.SetIndex(index)
+			repo.AddRepo(buildIDRepo)
+		}
+	}
+	addRepo := func(r symbolize.Repository) {
+		for _, repo := range repos {
+			repo.AddRepo(r)
+		}
 	}
 	var fileCache *cache.FileCache
 	if len(symbolServers) > 0 {
@@ -686,6 +1167,15 @@ func main() {
 		}
 	}
 	for _, symbolServer := range symbolServers {
+		if strings.HasPrefix(symbolServer, "http://") || strings.HasPrefix(symbolServer, "https://") {
+			debuginfodRepo, err := symbolize.NewDebuginfodRepo(symbolServer, fileCache)
+			if err != nil {
+				log.Fatalf("%v\n", err)
+			}
+			debuginfodRepo.SetTimeout(cloudFetchTimeout)
+			addRepo(debuginfodRepo)
+			continue
+		}
 		// TODO(atyfto): Remove when all consumers are passing GCS URLs.
 		if !strings.HasPrefix(symbolServer, "gs://") {
 			symbolServer = "gs://" + symbolServer
@@ -695,10 +1185,16 @@ func main() {
 			log.Fatalf("%v\n", err)
 		}
 		cloudRepo.SetTimeout(cloudFetchTimeout)
-		repo.AddRepo(cloudRepo)
+		addRepo(cloudRepo)
 	}
 
-	if err := process(ctx, &repo); err != nil {
+	err := process(ctx, repos)
+	if index != nil {
+		if err := index.Save(); err != nil {
+			log.Warningf("failed to save the build ID index: %v\n", err)
+		}
+	}
+	if err != nil {
 		log.Errorf("%v\n", err)
 		os.Exit(1)
 	}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -210,3 +211,52 @@ func TestMergeEntries(t *testing.T) {
 		})
 	}
 }
+
+func TestActionRunRecordsInvocations(t *testing.T) {
+	ctx := context.Background()
+	tempDir := t.TempDir()
+	invocations = invocationLog{}
+	okTool := getLLVMProfdata(t, filepath.Join(tempDir, "ok"), "output", false)
+	failingTool := getLLVMProfdata(t, filepath.Join(tempDir, "failing"), "", true)
+
+	if _, err := (Action{Path: okTool, Args: []string{"show"}}).Run(ctx); err != nil {
+		t.Fatalf("failed to run %s: %s", okTool, err)
+	}
+	if _, err := (Action{Path: failingTool, Args: []string{"merge"}}).Run(ctx); err == nil {
+		t.Fatalf("running %s unexpectedly succeeded", failingTool)
+	}
+
+	path := filepath.Join(tempDir, invocationsFile)
+	if err := invocations.write(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []invocation
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to unmarshal invocations: %s", err)
+	}
+	want := []invocation{
+		{Cmd: okTool, Args: []string{"show"}, Output: "output\n", OutputBytes: 7},
+		{Cmd: failingTool, Args: []string{"merge"}, ExitCode: 1, Error: "exit status 1"},
+	}
+	opts := cmpopts.IgnoreFields(invocation{}, "Start", "DurationSecs")
+	if diff := cmp.Diff(want, got, opts); diff != "" {
+		t.Errorf("unexpected invocations (-want +got):\n%s", diff)
+	}
+}
+
+func TestTailWriter(t *testing.T) {
+	var w tailWriter
+	w.Write([]byte("head"))
+	w.Write(bytes.Repeat([]byte("x"), maxInvocationOutput-2))
+	w.Write([]byte("tail"))
+	if got, want := w.n, maxInvocationOutput+6; got != want {
+		t.Errorf("got %d bytes written, want %d", got, want)
+	}
+	if got, want := string(w.buf), string(bytes.Repeat([]byte("x"), maxInvocationOutput-4))+"tail"; got != want {
+		t.Errorf("got %d bytes kept ending in %q, want %d bytes ending in %q", len(got), got[len(got)-8:], len(want), want[len(want)-8:])
+	}
+}
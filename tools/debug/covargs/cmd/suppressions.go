@@ -0,0 +1,67 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// suppression describes modules that are known to fail validation with
+// llvm-cov, so that they're reported separately from newly malformed modules.
+type suppression struct {
+	// BuildID matches the module with this build ID.
+	BuildID string `json:"build_id,omitempty"`
+	// Path is a regular expression matched against the path of the module's
+	// debug binary, e.g. to match all the binaries of a prebuilt.
+	Path string `json:"path,omitempty"`
+	// Reason explains why the modules are malformed, e.g. with a bug link.
+	Reason string `json:"reason,omitempty"`
+
+	pathRE *regexp.Regexp
+}
+
+// suppressions is a list of known malformed modules.
+type suppressions []suppression
+
+// loadSuppressions reads a JSON list of suppressions from path.
+func loadSuppressions(path string) (suppressions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suppressions: %w", err)
+	}
+	var s suppressions
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse suppressions %q: %w", path, err)
+	}
+	for i := range s {
+		if s[i].BuildID == "" && s[i].Path == "" {
+			return nil, fmt.Errorf("suppression %d in %q has neither a build_id nor a path", i, path)
+		}
+		if s[i].Path != "" {
+			if s[i].pathRE, err = regexp.Compile(s[i].Path); err != nil {
+				return nil, fmt.Errorf("suppression %d in %q has an invalid path pattern: %w", i, path, err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// match returns the suppression matching the module with the given build ID
+// and debug binary path, if any.
+func (s suppressions) match(buildID, path string) (suppression, bool) {
+	for _, sup := range s {
+		if sup.BuildID != "" && sup.BuildID != buildID {
+			continue
+		}
+		if sup.pathRE != nil && !sup.pathRE.MatchString(path) {
+			continue
+		}
+		return sup, true
+	}
+	return suppression{}, false
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSuppressions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "suppressions.json")
+	if err := os.WriteFile(path, []byte(`[
+		{"build_id": "0123abcd", "reason": "fxbug.dev/1"},
+		{"path": "prebuilt/third_party/foo/", "reason": "fxbug.dev/2"},
+		{"build_id": "4567cdef", "path": "\\.so\\.debug$", "reason": "fxbug.dev/3"}
+	]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadSuppressions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		buildID    string
+		path       string
+		wantReason string
+	}{
+		{
+			name:       "matching build ID",
+			buildID:    "0123abcd",
+			path:       "out/.build-id/01/23abcd.debug",
+			wantReason: "fxbug.dev/1",
+		},
+		{
+			name:       "matching path",
+			buildID:    "89abcdef",
+			path:       "/fuchsia/prebuilt/third_party/foo/.build-id/89/abcdef.debug",
+			wantReason: "fxbug.dev/2",
+		},
+		{
+			name:       "matching build ID and path",
+			buildID:    "4567cdef",
+			path:       "cache/libbar.so.debug",
+			wantReason: "fxbug.dev/3",
+		},
+		{
+			name:    "matching build ID but not path",
+			buildID: "4567cdef",
+			path:    "cache/bar.debug",
+		},
+		{
+			name:    "no match",
+			buildID: "deadbeef",
+			path:    "out/.build-id/de/adbeef.debug",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sup, ok := s.match(tc.buildID, tc.path)
+			if ok != (tc.wantReason != "") {
+				t.Fatalf("match(%q, %q) matched: %t, want %t", tc.buildID, tc.path, ok, !ok)
+			}
+			if sup.Reason != tc.wantReason {
+				t.Errorf("got reason %q, want %q", sup.Reason, tc.wantReason)
+			}
+		})
+	}
+}
+
+func TestLoadSuppressionsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		contents string
+	}{
+		{
+			name:     "invalid JSON",
+			contents: `{`,
+		},
+		{
+			name:     "empty suppression",
+			contents: `[{"reason": "fxbug.dev/1"}]`,
+		},
+		{
+			name:     "invalid path pattern",
+			contents: `[{"path": "foo("}]`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "suppressions.json")
+			if err := os.WriteFile(path, []byte(tc.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadSuppressions(path); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
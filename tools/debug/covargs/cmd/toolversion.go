@@ -0,0 +1,113 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+)
+
+const (
+	// minLLVMProfdataVersion is the oldest LLVM whose llvm-profdata covargs
+	// supports. It must support `show --binary-ids`, which is used to map
+	// profiles to modules.
+	minLLVMProfdataVersion = 13
+	// minLLVMCovVersion is the oldest LLVM whose llvm-cov covargs supports.
+	minLLVMCovVersion = 11
+
+	// llvmCovSkipFunctionsVersion is the first LLVM whose llvm-cov export
+	// supports -skip-functions.
+	llvmCovSkipFunctionsVersion = 13
+	// llvmCovCompilationDirVersion is the first LLVM whose llvm-cov supports
+	// -compilation-dir.
+	llvmCovCompilationDirVersion = 14
+)
+
+// llvmVersion is the version of an LLVM tool, as reported by --version.
+type llvmVersion struct {
+	major, minor, patch int
+}
+
+func (v llvmVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// supports returns whether v is at least the given major version. The zero
+// version, which is used when the tools aren't run, supports everything.
+func (v llvmVersion) supports(major int) bool {
+	return v == llvmVersion{} || v.major >= major
+}
+
+var llvmVersionRE = regexp.MustCompile(`LLVM version (\d+)\.(\d+)\.(\d+)`)
+
+// parseLLVMVersion parses the version from the output of an LLVM tool's
+// --version flag, e.g.:
+//
+//	LLVM (http://llvm.org/):
+//	  LLVM version 15.0.0git
+//	  Optimized build.
+func parseLLVMVersion(output string) (llvmVersion, error) {
+	m := llvmVersionRE.FindStringSubmatch(output)
+	if m == nil {
+		return llvmVersion{}, fmt.Errorf("no LLVM version found in:\n%s", output)
+	}
+	var v llvmVersion
+	for i, p := range []*int{&v.major, &v.minor, &v.patch} {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return llvmVersion{}, fmt.Errorf("invalid LLVM version %q: %w", m[0], err)
+		}
+		*p = n
+	}
+	return v, nil
+}
+
+// probeLLVMVersion returns the version of the LLVM tool at path, failing if
+// it's older than minMajor.
+func probeLLVMVersion(ctx context.Context, path string, minMajor int) (llvmVersion, error) {
+	if dryRun {
+		return llvmVersion{}, nil
+	}
+	versionCmd := Action{Path: path, Args: []string{"--version"}}
+	output, err := versionCmd.Run(ctx)
+	if err != nil {
+		return llvmVersion{}, fmt.Errorf("%s failed with %v:\n%s", versionCmd.String(), err, string(output))
+	}
+	v, err := parseLLVMVersion(string(output))
+	if err != nil {
+		return llvmVersion{}, fmt.Errorf("cannot determine the version of %s: %w", path, err)
+	}
+	if !v.supports(minMajor) {
+		return llvmVersion{}, fmt.Errorf("%s is from LLVM %s, but covargs requires LLVM %d or newer; "+
+			"use the llvm-profdata and llvm-cov of a newer toolchain", path, v, minMajor)
+	}
+	logger.Debugf(ctx, "%s is from LLVM %s\n", path, v)
+	return v, nil
+}
+
+// covOptions holds the llvm-cov options that depend on its version.
+type covOptions struct {
+	skipFunctions  bool
+	compilationDir string
+}
+
+// adaptCovOptions adapts opts to the version of llvm-cov, dropping the options
+// it doesn't support if they're only an optimization, and failing if they
+// would change the results.
+func adaptCovOptions(ctx context.Context, v llvmVersion, opts covOptions) (covOptions, error) {
+	if opts.skipFunctions && !v.supports(llvmCovSkipFunctionsVersion) {
+		logger.Warningf(ctx, "llvm-cov from LLVM %s doesn't support -skip-functions, the report will include function coverage\n", v)
+		opts.skipFunctions = false
+	}
+	if opts.compilationDir != "" && !v.supports(llvmCovCompilationDirVersion) {
+		return covOptions{}, fmt.Errorf("llvm-cov from LLVM %s doesn't support -compilation-dir, which requires LLVM %d or newer; "+
+			"use the llvm-cov of a newer toolchain or omit -compilation-dir", v, llvmCovCompilationDirVersion)
+	}
+	return opts, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLLVMVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		output  string
+		want    llvmVersion
+		wantErr bool
+	}{
+		{
+			name: "release",
+			output: `LLVM (http://llvm.org/):
+  LLVM version 14.0.6
+  Optimized build.
+`,
+			want: llvmVersion{14, 0, 6},
+		},
+		{
+			name: "development",
+			output: `Fuchsia LLVM (https://llvm.org/):
+  LLVM version 16.0.0git
+  Optimized build.
+  Default target: x86_64-unknown-linux-gnu
+`,
+			want: llvmVersion{16, 0, 0},
+		},
+		{
+			name:    "not LLVM",
+			output:  "usage: llvm-cov {export|report|show}",
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseLLVMVersion(tc.output)
+			if err != nil {
+				if !tc.wantErr {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if tc.wantErr {
+				t.Fatalf("got %s, want error", got)
+			}
+			if got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAdaptCovOptions(t *testing.T) {
+	opts := covOptions{
+		skipFunctions:  true,
+		compilationDir: "/out",
+	}
+
+	for _, tc := range []struct {
+		name    string
+		version llvmVersion
+		opts    covOptions
+		want    covOptions
+		wantErr bool
+	}{
+		{
+			name:    "current",
+			version: llvmVersion{16, 0, 0},
+			opts:    opts,
+			want:    opts,
+		},
+		{
+			name: "unknown",
+			opts: opts,
+			want: opts,
+		},
+		{
+			name:    "without -compilation-dir",
+			version: llvmVersion{13, 0, 1},
+			opts:    covOptions{skipFunctions: true},
+			want:    covOptions{skipFunctions: true},
+		},
+		{
+			name:    "with -compilation-dir",
+			version: llvmVersion{13, 0, 1},
+			opts:    opts,
+			wantErr: true,
+		},
+		{
+			name:    "without -skip-functions",
+			version: llvmVersion{12, 0, 0},
+			opts:    covOptions{skipFunctions: true},
+			want:    covOptions{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := adaptCovOptions(context.Background(), tc.version, tc.opts)
+			if err != nil {
+				if !tc.wantErr {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if tc.wantErr {
+				t.Fatalf("got %+v, want error", got)
+			}
+			if got != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProbeLLVMVersion(t *testing.T) {
+	tool := filepath.Join(t.TempDir(), "llvm-cov")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\necho 'LLVM (http://llvm.org/):'\necho '  LLVM version 12.0.1'\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	got, err := probeLLVMVersion(ctx, tool, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (llvmVersion{12, 0, 1}); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if _, err := probeLLVMVersion(ctx, tool, 13); err == nil {
+		t.Errorf("got no error for a tool older than the minimum version")
+	}
+}
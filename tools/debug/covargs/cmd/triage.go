@@ -0,0 +1,158 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+// corruptProfile is a raw profile that llvm-profdata fails to merge, which
+// was left out of the report.
+type corruptProfile struct {
+	Profile string `json:"profile"`
+	// Build is the name of the build given by -build that the profile is
+	// from, if any.
+	Build string `json:"build,omitempty"`
+	// Tests are the tests that produced the profile.
+	Tests []string `json:"tests"`
+	// Error is the output of llvm-profdata when merging the profile alone.
+	Error string `json:"error"`
+}
+
+// profileTriage is the JSON written to the file given by
+// -triage-corrupt-profiles.
+type profileTriage struct {
+	CorruptProfiles []corruptProfile `json:"corrupt_profiles"`
+}
+
+// mergeFunc merges profiles, returning a *mergeError if llvm-profdata fails
+// to merge them.
+type mergeFunc func(ctx context.Context, profiles []string) error
+
+// triageProfiles isolates the profiles that fail to merge by bisection, and
+// returns them along with the remaining profiles. It's called once merging
+// all of profiles has failed with failure.
+func triageProfiles(ctx context.Context, merge mergeFunc, profiles []string, failure *mergeError) ([]corruptProfile, []string, error) {
+	logger.Infof(ctx, "looking for corrupt profiles among %d profiles", len(profiles))
+	corrupt, err := bisectProfiles(ctx, merge, profiles, failure)
+	if err != nil {
+		return nil, nil, err
+	}
+	isCorrupt := make(map[string]bool)
+	for _, c := range corrupt {
+		isCorrupt[c.Profile] = true
+	}
+	var remaining []string
+	for _, profile := range profiles {
+		if !isCorrupt[profile] {
+			remaining = append(remaining, profile)
+		}
+	}
+	if len(remaining) == 0 {
+		return nil, nil, fmt.Errorf("all %d profiles failed to merge: %w", len(profiles), failure)
+	}
+	return corrupt, remaining, nil
+}
+
+// bisectProfiles returns the profiles that fail to merge on their own, given
+// that merging all of profiles failed with failure.
+func bisectProfiles(ctx context.Context, merge mergeFunc, profiles []string, failure *mergeError) ([]corruptProfile, error) {
+	if len(profiles) == 1 {
+		return []corruptProfile{{Profile: profiles[0], Error: strings.TrimSpace(string(failure.output))}}, nil
+	}
+	mid := len(profiles) / 2
+	var corrupt []corruptProfile
+	for _, half := range [][]string{profiles[:mid], profiles[mid:]} {
+		err := merge(ctx, half)
+		var mergeErr *mergeError
+		if errors.As(err, &mergeErr) {
+			c, err := bisectProfiles(ctx, merge, half, mergeErr)
+			if err != nil {
+				return nil, err
+			}
+			corrupt = append(corrupt, c...)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if len(corrupt) == 0 {
+		return nil, fmt.Errorf("%d profiles fail to merge together although each half merges, so no corrupt profile can be isolated: %w", len(profiles), failure)
+	}
+	return corrupt, nil
+}
+
+// profileTests returns the names of the tests that produced each profile
+// listed in summaryFiles, which may be followed by `=<version>` as with
+// -summary.
+func profileTests(summaryFiles []string) (map[string][]string, error) {
+	tests := make(map[string][]string)
+	for _, summaryFile := range summaryFiles {
+		_, summaryFile := splitVersion(summaryFile)
+		data, err := os.ReadFile(summaryFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %q: %w", summaryFile, err)
+		}
+		var summary runtests.TestSummary
+		if err := json.Unmarshal(data, &summary); err != nil {
+			return nil, fmt.Errorf("cannot decode %q: %w", summaryFile, err)
+		}
+		dir := filepath.Dir(summaryFile)
+		for _, detail := range summary.Tests {
+			for _, sink := range detail.DataSinks[llvmProfileSinkType] {
+				profile := filepath.Join(dir, sink.File)
+				tests[profile] = append(tests[profile], detail.Name)
+			}
+		}
+	}
+	for _, names := range tests {
+		sort.Strings(names)
+	}
+	return tests, nil
+}
+
+// reportCorruptProfiles fills in the tests that produced the corrupt profiles
+// of the build with the given name, which are listed in summaryFiles, and
+// logs them.
+func reportCorruptProfiles(ctx context.Context, corrupt []corruptProfile, build string, summaryFiles []string) error {
+	if len(corrupt) == 0 {
+		return nil
+	}
+	tests, err := profileTests(summaryFiles)
+	if err != nil {
+		return fmt.Errorf("failed to find the tests that produced corrupt profiles: %w", err)
+	}
+	for i := range corrupt {
+		corrupt[i].Build = build
+		corrupt[i].Tests = tests[corrupt[i].Profile]
+		logger.Errorf(ctx, "left corrupt profile %s produced by %s out of the report:\n%s",
+			corrupt[i].Profile, strings.Join(corrupt[i].Tests, ", "), corrupt[i].Error)
+	}
+	return nil
+}
+
+// writeTriage writes the corrupt profiles to path.
+func writeTriage(path string, corrupt []corruptProfile) error {
+	if corrupt == nil {
+		corrupt = []corruptProfile{}
+	}
+	data, err := json.MarshalIndent(profileTriage{CorruptProfiles: corrupt}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the corrupt profiles: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write the corrupt profiles: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+// corruptMockProfdata is a mock llvm-profdata that fails to merge the
+// profiles listed in its response file if any of their names contains
+// "corrupt".
+const corruptMockProfdata = `#!/bin/bash
+for arg in "$@"; do
+  if [[ "$arg" == @* ]] && grep -q corrupt "${arg#@}"; then
+    echo "malformed instrumentation profile data"
+    exit 1
+  fi
+done
+`
+
+func TestTriageProfiles(t *testing.T) {
+	ctx := context.Background()
+	tempDir := t.TempDir()
+	tool := filepath.Join(tempDir, "llvm-profdata")
+	if err := os.WriteFile(tool, []byte(corruptMockProfdata), os.ModePerm); err != nil {
+		t.Fatalf("failed to write mock llvm-profdata tool: %s", err)
+	}
+	merges := 0
+	merge := func(ctx context.Context, profiles []string) error {
+		merges++
+		return mergeRawProfiles(ctx, tool, profiles, filepath.Join(tempDir, "triage.rsp"), filepath.Join(tempDir, "triage.profdata"))
+	}
+
+	for _, tc := range []struct {
+		name          string
+		profiles      []string
+		wantCorrupt   []string
+		wantRemaining []string
+		wantErr       bool
+	}{
+		{
+			name:          "one corrupt profile",
+			profiles:      []string{"a", "b", "c", "corrupt-d", "e", "f", "g", "h"},
+			wantCorrupt:   []string{"corrupt-d"},
+			wantRemaining: []string{"a", "b", "c", "e", "f", "g", "h"},
+		},
+		{
+			name:          "several corrupt profiles",
+			profiles:      []string{"corrupt-a", "b", "c", "corrupt-d", "e"},
+			wantCorrupt:   []string{"corrupt-a", "corrupt-d"},
+			wantRemaining: []string{"b", "c", "e"},
+		},
+		{
+			name:     "all profiles are corrupt",
+			profiles: []string{"corrupt-a", "corrupt-b"},
+			wantErr:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := merge(ctx, tc.profiles)
+			var mergeErr *mergeError
+			if !errors.As(err, &mergeErr) {
+				t.Fatalf("merge() = %v, want a merge error", err)
+			}
+			corrupt, remaining, err := triageProfiles(ctx, merge, tc.profiles, mergeErr)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("got err: %v, want err: %t", err, tc.wantErr)
+			}
+			var corruptProfiles []string
+			for _, c := range corrupt {
+				corruptProfiles = append(corruptProfiles, c.Profile)
+				if c.Error != "malformed instrumentation profile data" {
+					t.Errorf("got error %q for %s, want the output of llvm-profdata", c.Error, c.Profile)
+				}
+			}
+			if diff := cmp.Diff(tc.wantCorrupt, corruptProfiles); diff != "" {
+				t.Errorf("unexpected corrupt profiles (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantRemaining, remaining); diff != "" {
+				t.Errorf("unexpected remaining profiles (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// Bisection takes two merges per halving to find a corrupt profile.
+	profiles := make([]string, 64)
+	for i := range profiles {
+		profiles[i] = fmt.Sprintf("p%d", i)
+	}
+	profiles[40] = "corrupt"
+	var mergeErr *mergeError
+	if err := merge(ctx, profiles); !errors.As(err, &mergeErr) {
+		t.Fatalf("merge() = %v, want a merge error", err)
+	}
+	merges = 0
+	if _, _, err := triageProfiles(ctx, merge, profiles, mergeErr); err != nil {
+		t.Fatalf("triageProfiles() = %s", err)
+	}
+	if merges != 12 {
+		t.Errorf("got %d merges to find one corrupt profile among %d, want 12", merges, len(profiles))
+	}
+}
+
+func TestBisectProfilesCannotIsolate(t *testing.T) {
+	// Profiles that only fail to merge together can't be pinned on one of
+	// them.
+	merge := func(ctx context.Context, profiles []string) error {
+		if len(profiles) > 2 {
+			return &mergeError{cmd: "llvm-profdata merge", err: errors.New("exit status 1")}
+		}
+		return nil
+	}
+	failure := &mergeError{cmd: "llvm-profdata merge", err: errors.New("exit status 1")}
+	if _, err := bisectProfiles(context.Background(), merge, []string{"a", "b", "c", "d"}, failure); err == nil {
+		t.Errorf("bisectProfiles() succeeded, want an error")
+	}
+}
+
+func TestReportCorruptProfiles(t *testing.T) {
+	tempDir := t.TempDir()
+	summary := runtests.TestSummary{
+		Tests: []runtests.TestDetails{
+			{
+				Name:      "foo",
+				DataSinks: runtests.DataSinkMap{llvmProfileSinkType: []runtests.DataSink{{Name: "p0", File: "llvm-profile/p0"}}},
+			},
+			{
+				Name: "bar",
+				DataSinks: runtests.DataSinkMap{llvmProfileSinkType: []runtests.DataSink{
+					{Name: "p0", File: "llvm-profile/p0"},
+					{Name: "p1", File: "llvm-profile/p1"},
+				}},
+			},
+		},
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatalf("failed to marshal summary: %s", err)
+	}
+	summaryFile := filepath.Join(tempDir, "summary.json")
+	if err := os.WriteFile(summaryFile, data, os.ModePerm); err != nil {
+		t.Fatalf("failed to write summary file: %s", err)
+	}
+
+	corrupt := []corruptProfile{
+		{Profile: filepath.Join(tempDir, "llvm-profile/p0"), Error: "bad"},
+		{Profile: filepath.Join(tempDir, "llvm-profile/p1"), Error: "worse"},
+	}
+	if err := reportCorruptProfiles(context.Background(), corrupt, "x64", []string{summaryFile + "=version"}); err != nil {
+		t.Fatalf("reportCorruptProfiles() = %s", err)
+	}
+	triageFile := filepath.Join(tempDir, "triage.json")
+	if err := writeTriage(triageFile, corrupt); err != nil {
+		t.Fatalf("writeTriage() = %s", err)
+	}
+
+	data, err = os.ReadFile(triageFile)
+	if err != nil {
+		t.Fatalf("failed to read triage file: %s", err)
+	}
+	var got profileTriage
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to decode triage file: %s", err)
+	}
+	want := profileTriage{
+		CorruptProfiles: []corruptProfile{
+			{Profile: filepath.Join(tempDir, "llvm-profile/p0"), Build: "x64", Tests: []string{"bar", "foo"}, Error: "bad"},
+			{Profile: filepath.Join(tempDir, "llvm-profile/p1"), Build: "x64", Tests: []string{"bar"}, Error: "worse"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected triage (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package covargs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/tools/debug/covargs/api/llvm"
+)
+
+// ChangedLines maps each file modified by a diff, relative to the root of the
+// source tree, to the numbers of the lines it added or changed in the new
+// version of the file.
+type ChangedLines map[string][]int
+
+// Diff is the result of parsing a unified diff.
+type Diff struct {
+	Changed ChangedLines
+	// Unparseable lists the files whose changes couldn't be read from the
+	// diff, such as binary files or files with malformed hunks.
+	Unparseable []string
+}
+
+var hunkHeaderRE = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// ParseDiff parses a unified diff, as produced by `git diff` or `diff -u`,
+// and returns the lines added to each file.
+func ParseDiff(r io.Reader) (*Diff, error) {
+	d := &Diff{Changed: ChangedLines{}}
+	unparseable := map[string]bool{}
+
+	// The file the current hunk applies to, and the number of lines of the
+	// hunk remaining in the old and new versions of the file.
+	var file string
+	var oldLeft, newLeft, lineNumber int
+	// skip is set when the remaining hunks of the current file can't be read.
+	skip := false
+
+	markUnparseable := func(path string) {
+		if path != "" && !unparseable[path] {
+			unparseable[path] = true
+			d.Unparseable = append(d.Unparseable, path)
+		}
+		skip = true
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		l := s.Text()
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(l, "+"):
+				d.Changed[file] = append(d.Changed[file], lineNumber)
+				lineNumber++
+				newLeft--
+			case strings.HasPrefix(l, "-"):
+				oldLeft--
+			case strings.HasPrefix(l, " "), l == "":
+				lineNumber++
+				oldLeft--
+				newLeft--
+			case strings.HasPrefix(l, `\`):
+				// "\ No newline at end of file"
+			default:
+				markUnparseable(file)
+				oldLeft, newLeft = 0, 0
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(l, "diff "):
+			file, skip = "", false
+		case strings.HasPrefix(l, "+++ "):
+			file, skip = diffPath(l[len("+++ "):]), false
+		case strings.HasPrefix(l, "Binary files "):
+			// Binary files a/foo and b/foo differ
+			if i := strings.LastIndex(l, " and "); i >= 0 {
+				markUnparseable(diffPath(strings.TrimSuffix(l[i+len(" and "):], " differ")))
+			}
+		case strings.HasPrefix(l, "@@ "):
+			if skip {
+				continue
+			}
+			m := hunkHeaderRE.FindStringSubmatch(l)
+			if m == nil {
+				markUnparseable(file)
+				continue
+			}
+			oldLeft, newLeft = 1, 1
+			if m[1] != "" {
+				oldLeft, _ = strconv.Atoi(m[1])
+			}
+			lineNumber, _ = strconv.Atoi(m[2])
+			if m[3] != "" {
+				newLeft, _ = strconv.Atoi(m[3])
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read diff: %w", err)
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		markUnparseable(file)
+	}
+	// A file whose hunks were partially read is reported as unparseable only.
+	for path := range unparseable {
+		delete(d.Changed, path)
+	}
+	delete(d.Changed, "")
+	return d, nil
+}
+
+// diffPath returns the path of a file in a diff header, without the "a/" or
+// "b/" prefix added by git. It is empty for /dev/null, i.e. deleted files.
+func diffPath(p string) string {
+	// GNU diff follows the path with a tab and a timestamp.
+	if i := strings.IndexByte(p, '\t'); i >= 0 {
+		p = p[:i]
+	}
+	if p == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
+		p = p[len("b/"):]
+	}
+	return p
+}
+
+// DiffFileCoverage is the coverage of the lines changed in a single file.
+type DiffFileCoverage struct {
+	Path      string `json:"path"`
+	Covered   []int  `json:"covered"`
+	Uncovered []int  `json:"uncovered"`
+}
+
+// DiffCoverage is the coverage of the lines changed by a diff. Changed lines
+// that aren't coverable, such as comments, and changes to files without
+// coverage data aren't included.
+type DiffCoverage struct {
+	Files       []DiffFileCoverage `json:"files"`
+	Covered     int                `json:"covered"`
+	Uncovered   int                `json:"uncovered"`
+	Unparseable []string           `json:"unparseable"`
+}
+
+// ComputeDiffCoverage computes the line coverage of the lines changed by a
+// diff from data in LLVM coverage JSON format. base is the root of the source
+// tree that the paths in the diff are relative to.
+func ComputeDiffCoverage(export *llvm.Export, base string, diff *Diff) (*DiffCoverage, error) {
+	counts := map[string]map[int]int{}
+	for _, d := range export.Data {
+		for _, f := range d.Files {
+			if f.Segments == nil {
+				continue
+			}
+			abs, err := filepath.Abs(f.Filename)
+			if err != nil {
+				return nil, err
+			}
+			rel, err := filepath.Rel(base, abs)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := diff.Changed[rel]; !ok {
+				continue
+			}
+			ld, _ := extractData(f.Segments)
+			if counts[rel] == nil {
+				counts[rel] = map[int]int{}
+			}
+			// The same file may be covered by several binaries.
+			for _, l := range ld {
+				counts[rel][l.line] += l.count
+			}
+		}
+	}
+
+	c := &DiffCoverage{
+		Files:       []DiffFileCoverage{},
+		Unparseable: append([]string{}, diff.Unparseable...),
+	}
+	sort.Strings(c.Unparseable)
+	for path, lines := range diff.Changed {
+		fileCounts, ok := counts[path]
+		if !ok {
+			continue
+		}
+		fc := DiffFileCoverage{Path: path, Covered: []int{}, Uncovered: []int{}}
+		for _, l := range lines {
+			count, ok := fileCounts[l]
+			if !ok {
+				continue
+			}
+			if count > 0 {
+				fc.Covered = append(fc.Covered, l)
+			} else {
+				fc.Uncovered = append(fc.Uncovered, l)
+			}
+		}
+		if len(fc.Covered) == 0 && len(fc.Uncovered) == 0 {
+			continue
+		}
+		sort.Ints(fc.Covered)
+		sort.Ints(fc.Uncovered)
+		c.Covered += len(fc.Covered)
+		c.Uncovered += len(fc.Uncovered)
+		c.Files = append(c.Files, fc)
+	}
+	sort.Slice(c.Files, func(i, j int) bool {
+		return c.Files[i].Path < c.Files[j].Path
+	})
+	return c, nil
+}
+
+// Markdown returns a summary of the coverage suitable for posting as a code
+// review comment.
+func (c *DiffCoverage) Markdown() string {
+	var b strings.Builder
+	total := c.Covered + c.Uncovered
+	if total == 0 {
+		b.WriteString("No coverable lines were changed.\n")
+	} else {
+		fmt.Fprintf(&b, "**%d of %d** changed lines covered (%.1f%%).\n",
+			c.Covered, total, float64(c.Covered)*100/float64(total))
+	}
+	if len(c.Files) > 0 {
+		b.WriteString("\n| File | Covered | Uncovered lines |\n|---|---|---|\n")
+		for _, f := range c.Files {
+			fmt.Fprintf(&b, "| `%s` | %d/%d | %s |\n",
+				f.Path, len(f.Covered), len(f.Covered)+len(f.Uncovered), lineRanges(f.Uncovered))
+		}
+	}
+	if len(c.Unparseable) > 0 {
+		b.WriteString("\nCoverage couldn't be computed for changes to:\n\n")
+		for _, path := range c.Unparseable {
+			fmt.Fprintf(&b, "* `%s`\n", path)
+		}
+	}
+	return b.String()
+}
+
+// lineRanges formats sorted line numbers as comma-separated ranges, e.g.
+// "3-5, 9".
+func lineRanges(lines []int) string {
+	var ranges []string
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(lines[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// SaveDiffCoverage writes the coverage of the lines changed by a diff to
+// diff_coverage.json and diff_coverage.md in dir.
+func SaveDiffCoverage(c *DiffCoverage, dir string) error {
+	if err := saveJSON(c, filepath.Join(dir, "diff_coverage.json")); err != nil {
+		return err
+	}
+	filename := filepath.Join(dir, "diff_coverage.md")
+	if err := os.WriteFile(filename, []byte(c.Markdown()), 0644); err != nil {
+		return fmt.Errorf("cannot write %q: %w", filename, err)
+	}
+	return nil
+}
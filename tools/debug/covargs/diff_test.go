@@ -0,0 +1,177 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package covargs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/tools/debug/covargs/api/llvm"
+)
+
+const testDiff = `diff --git a/src/foo.cc b/src/foo.cc
+index 1234567..89abcde 100644
+--- a/src/foo.cc
++++ b/src/foo.cc
+@@ -1,3 +1,4 @@
+ int x;
++int y;
+-int z;
+ int w;
++int v;
+@@ -5,0 +6,2 @@ int main() {
++// A comment.
++
+diff --git a/src/bar.cc b/src/bar.cc
+new file mode 100644
+--- /dev/null
++++ b/src/bar.cc
+@@ -0,0 +1 @@
++int bar;
+diff --git a/src/old.cc b/src/old.cc
+deleted file mode 100644
+--- a/src/old.cc
++++ /dev/null
+@@ -1,2 +0,0 @@
+-int old;
+--- not a header
+diff --git a/logo.png b/logo.png
+Binary files a/logo.png and b/logo.png differ
+diff --git a/src/broken.cc b/src/broken.cc
+--- a/src/broken.cc
++++ b/src/broken.cc
+@@ -1 +1 @@
++int broken;
+garbage
+`
+
+func TestParseDiff(t *testing.T) {
+	d, err := ParseDiff(strings.NewReader(testDiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Diff{
+		Changed: ChangedLines{
+			"src/foo.cc": {2, 4, 6, 7},
+			"src/bar.cc": {1},
+		},
+		Unparseable: []string{"logo.png", "src/broken.cc"},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("got %+v, want %+v", d, want)
+	}
+}
+
+func TestDiffCoverage(t *testing.T) {
+	base, err := filepath.Abs("/path/to/fuchsia")
+	if err != nil {
+		t.Fatal(err)
+	}
+	export := &llvm.Export{
+		Data: []llvm.Data{
+			{
+				Files: []llvm.File{
+					{
+						// Lines 1 to 3 are executed 5 times, lines 4 and 5 never.
+						Filename: filepath.Join(base, "src/foo.cc"),
+						Segments: []llvm.Segment{
+							{1, 1, 5, true, true, false},
+							{3, 1, 0, true, true, false},
+							{5, 1, 0, false, false, false},
+						},
+					},
+					{
+						Filename: filepath.Join(base, "src/unchanged.cc"),
+						Segments: []llvm.Segment{
+							{1, 1, 0, true, true, false},
+							{2, 1, 0, false, false, false},
+						},
+					},
+				},
+			},
+		},
+	}
+	diff, err := ParseDiff(strings.NewReader(testDiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := ComputeDiffCoverage(export, base, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DiffCoverage{
+		Files: []DiffFileCoverage{
+			{
+				Path:      "src/foo.cc",
+				Covered:   []int{2},
+				Uncovered: []int{4},
+			},
+		},
+		Covered:     1,
+		Uncovered:   1,
+		Unparseable: []string{"logo.png", "src/broken.cc"},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+
+	wantMarkdown := "**1 of 2** changed lines covered (50.0%).\n" +
+		"\n" +
+		"| File | Covered | Uncovered lines |\n" +
+		"|---|---|---|\n" +
+		"| `src/foo.cc` | 1/2 | 4 |\n" +
+		"\n" +
+		"Coverage couldn't be computed for changes to:\n" +
+		"\n" +
+		"* `logo.png`\n" +
+		"* `src/broken.cc`\n"
+	if got := c.Markdown(); got != wantMarkdown {
+		t.Errorf("got markdown:\n%s\nwant:\n%s", got, wantMarkdown)
+	}
+
+	dir := t.TempDir()
+	if err := SaveDiffCoverage(c, dir); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "diff_coverage.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved DiffCoverage
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&saved, want) {
+		t.Errorf("got saved coverage %+v, want %+v", saved, want)
+	}
+	b, err = os.ReadFile(filepath.Join(dir, "diff_coverage.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != wantMarkdown {
+		t.Errorf("got saved markdown:\n%s\nwant:\n%s", b, wantMarkdown)
+	}
+}
+
+func TestLineRanges(t *testing.T) {
+	for _, tc := range []struct {
+		lines []int
+		want  string
+	}{
+		{nil, ""},
+		{[]int{3}, "3"},
+		{[]int{3, 4, 5, 9}, "3-5, 9"},
+		{[]int{1, 3, 4}, "1, 3-4"},
+	} {
+		if got := lineRanges(tc.lines); got != tc.want {
+			t.Errorf("lineRanges(%v) = %q, want %q", tc.lines, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package covargs
+
+import (
+	"sort"
+
+	"go.fuchsia.dev/fuchsia/tools/debug/covargs/api/third_party/codecoverage"
+)
+
+// MergeBuilds combines the coverage of several builds of the same source tree,
+// e.g. for different architectures, keyed by build name, into the coverage of
+// their union.
+//
+// A line is coverable if it is coverable in any build, and its count is the
+// sum of its counts in each build. A block of a line is uncovered only if it
+// is uncovered in every build that executes the line. The line summary of a
+// file is computed from the merged lines; the function, region and branch
+// summaries can't be combined from line data, so those of the build that
+// covers the most are used.
+func MergeBuilds(builds map[string][]*codecoverage.File) []*codecoverage.File {
+	names := make([]string, 0, len(builds))
+	for name := range builds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	byPath := map[string][]*codecoverage.File{}
+	var paths []string
+	for _, name := range names {
+		for _, f := range builds[name] {
+			if f == nil {
+				continue
+			}
+			if _, ok := byPath[f.Path]; !ok {
+				paths = append(paths, f.Path)
+			}
+			byPath[f.Path] = append(byPath[f.Path], f)
+		}
+	}
+	sort.Strings(paths)
+
+	files := make([]*codecoverage.File, 0, len(paths))
+	for _, path := range paths {
+		if fs := byPath[path]; len(fs) == 1 {
+			files = append(files, fs[0])
+		} else {
+			files = append(files, mergeFiles(fs))
+		}
+	}
+	return files
+}
+
+func expandLines(f *codecoverage.File) map[int]int {
+	lines := map[int]int{}
+	for _, r := range f.Lines {
+		for l := int(r.First); l <= int(r.Last); l++ {
+			lines[l] += int(r.Count)
+		}
+	}
+	return lines
+}
+
+func expandBlocks(f *codecoverage.File) blockData {
+	blocks := blockData{}
+	for _, cr := range f.UncoveredBlocks {
+		for _, r := range cr.Ranges {
+			blocks[int(cr.Line)] = append(blocks[int(cr.Line)], block{int(r.First), int(r.Last)})
+		}
+	}
+	return blocks
+}
+
+// mergeFiles merges the coverage of the same file in several builds.
+func mergeFiles(fs []*codecoverage.File) *codecoverage.File {
+	counts := map[int]int{}
+	buildLines := make([]map[int]int, len(fs))
+	buildBlocks := make([]blockData, len(fs))
+	for i, f := range fs {
+		buildLines[i] = expandLines(f)
+		buildBlocks[i] = expandBlocks(f)
+		for l, count := range buildLines[i] {
+			counts[l] += count
+		}
+	}
+
+	var ld lineData
+	bd := blockData{}
+	covered := 0
+	for l, count := range counts {
+		ld = append(ld, line{l, count})
+		if count == 0 {
+			continue
+		}
+		covered++
+		// Keep the blocks that every build executing the line leaves
+		// uncovered.
+		var uncovered map[block]bool
+		for i := range fs {
+			if buildLines[i][l] == 0 {
+				continue
+			}
+			blocks := map[block]bool{}
+			for _, b := range buildBlocks[i][l] {
+				if uncovered == nil || uncovered[b] {
+					blocks[b] = true
+				}
+			}
+			uncovered = blocks
+		}
+		for b := range uncovered {
+			bd[l] = append(bd[l], b)
+		}
+		sort.Slice(bd[l], func(i, j int) bool {
+			return bd[l][i].first < bd[l][j].first
+		})
+	}
+	sort.Slice(ld, func(i, j int) bool {
+		return ld[i].line < ld[j].line
+	})
+	lr, cr := compressData(ld, bd)
+	sort.Slice(cr, func(i, j int) bool {
+		return cr[i].Line < cr[j].Line
+	})
+
+	file := &codecoverage.File{
+		Path:            fs[0].Path,
+		Lines:           lr,
+		UncoveredBlocks: cr,
+	}
+	for _, f := range fs {
+		if f.Revision != "" {
+			file.Revision = f.Revision
+			file.Timestamp = f.Timestamp
+			break
+		}
+	}
+	for _, name := range []string{"function", "region", "line", "branch"} {
+		m := &codecoverage.Metric{Name: name}
+		if name == "line" {
+			m.Covered = int32(covered)
+			m.Total = int32(len(counts))
+		} else {
+			for _, f := range fs {
+				for _, n := range f.Summaries {
+					if n.Name == name && n.Covered >= m.Covered {
+						m.Covered = n.Covered
+						m.Total = n.Total
+					}
+				}
+			}
+		}
+		file.Summaries = append(file.Summaries, m)
+	}
+	return file
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package covargs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/tools/debug/covargs/api/third_party/codecoverage"
+)
+
+func testBuilds() map[string][]*codecoverage.File {
+	return map[string][]*codecoverage.File{
+		"arm64": {
+			{
+				Path: "//src/common.cc",
+				Lines: []*codecoverage.LineRange{
+					{First: 1, Last: 2, Count: 1},
+					{First: 3, Last: 3, Count: 0},
+				},
+				UncoveredBlocks: []*codecoverage.ColumnRanges{
+					{Line: 2, Ranges: []*codecoverage.ColumnRange{{First: 1, Last: 4}, {First: 8, Last: -1}}},
+				},
+				Summaries: []*codecoverage.Metric{
+					{Name: "function", Covered: 1, Total: 2},
+					{Name: "region", Covered: 2, Total: 4},
+					{Name: "line", Covered: 2, Total: 3},
+					{Name: "branch", Covered: 0, Total: 0},
+				},
+				Revision:  "abc",
+				Timestamp: 1,
+			},
+			{
+				Path: "//src/arm64.cc",
+				Lines: []*codecoverage.LineRange{
+					{First: 1, Last: 1, Count: 5},
+				},
+				Summaries: []*codecoverage.Metric{
+					{Name: "line", Covered: 1, Total: 1},
+				},
+			},
+		},
+		"x64": {
+			{
+				Path: "//src/common.cc",
+				Lines: []*codecoverage.LineRange{
+					{First: 2, Last: 2, Count: 3},
+					{First: 3, Last: 3, Count: 2},
+					{First: 4, Last: 4, Count: 0},
+				},
+				UncoveredBlocks: []*codecoverage.ColumnRanges{
+					{Line: 2, Ranges: []*codecoverage.ColumnRange{{First: 8, Last: -1}}},
+				},
+				Summaries: []*codecoverage.Metric{
+					{Name: "function", Covered: 2, Total: 2},
+					{Name: "region", Covered: 1, Total: 4},
+					{Name: "line", Covered: 2, Total: 3},
+					{Name: "branch", Covered: 0, Total: 0},
+				},
+			},
+		},
+	}
+}
+
+func TestMergeBuilds(t *testing.T) {
+	builds := testBuilds()
+	files := MergeBuilds(builds)
+
+	want := []*codecoverage.File{
+		builds["arm64"][1],
+		{
+			Path: "//src/common.cc",
+			Lines: []*codecoverage.LineRange{
+				{First: 1, Last: 1, Count: 1},
+				{First: 2, Last: 2, Count: 4},
+				{First: 3, Last: 3, Count: 2},
+				{First: 4, Last: 4, Count: 0},
+			},
+			UncoveredBlocks: []*codecoverage.ColumnRanges{
+				{Line: 2, Ranges: []*codecoverage.ColumnRange{{First: 8, Last: -1}}},
+			},
+			Summaries: []*codecoverage.Metric{
+				{Name: "function", Covered: 2, Total: 2},
+				{Name: "region", Covered: 2, Total: 4},
+				{Name: "line", Covered: 3, Total: 4},
+				{Name: "branch", Covered: 0, Total: 0},
+			},
+			Revision:  "abc",
+			Timestamp: 1,
+		},
+	}
+	if !reflect.DeepEqual(files, want) {
+		b, _ := json.MarshalIndent(files, "", "  ")
+		t.Errorf("unexpected merged files:\n%s", b)
+	}
+}
+
+func TestSaveBuildsReport(t *testing.T) {
+	testDir := t.TempDir()
+	if _, err := SaveBuildsReport(testBuilds(), 1, testDir); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(testDir, "index.json"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	var index Index
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if want := []string{"arm64", "x64"}; !reflect.DeepEqual(index.Builds, want) {
+		t.Error("expected", want, "but got", index.Builds)
+	}
+	if len(index.Shards) != 2 {
+		t.Error("expected 2 shards but got", len(index.Shards))
+	}
+
+	var src *IndexDir
+	for i := range index.Dirs {
+		if index.Dirs[i].Path == "//src/" {
+			src = &index.Dirs[i]
+		}
+	}
+	if src == nil {
+		t.Fatal("no //src/ directory in", index.Dirs)
+	}
+	if want := (Coverage{Covered: 4, Total: 5, Percentage: 80}); src.Lines != want {
+		t.Error("expected", want, "but got", src.Lines)
+	}
+	for build, want := range map[string]Coverage{
+		"arm64": {Covered: 3, Total: 4, Percentage: 75},
+		"x64":   {Covered: 2, Total: 3, Percentage: 66.67},
+	} {
+		if got := src.Builds[build].Lines; got != want {
+			t.Errorf("expected %v for %s but got %v", want, build, got)
+		}
+	}
+
+	b, err = os.ReadFile(filepath.Join(testDir, "index.html"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	for _, header := range []string{"<th>arm64 lines</th>", "<th>x64 lines</th>"} {
+		if !strings.Contains(string(b), header) {
+			t.Errorf("index.html doesn't have a %s column", header)
+		}
+	}
+}
@@ -7,7 +7,9 @@ package covargs
 import (
 	"bytes"
 	"compress/zlib"
+	"encoding/json"
 	"fmt"
+	"html/template"
 	"math"
 	"os"
 	"os/exec"
@@ -417,13 +419,27 @@ func saveReport(report *codecoverage.CoverageReport, filename string) error {
 }
 
 // SaveReport saves compresses coverage data to disk, optionally sharding the
-// data into multiple files each of the same size.
+// data into multiple files each of the same size. It also writes index.json
+// and index.html, which describe the report and link to its shards, so that
+// the report can be browsed once it is uploaded.
 func SaveReport(files []*codecoverage.File, shardSize int, dir string) (*codecoverage.CoverageReport, error) {
+	return saveShardedReport(files, nil, shardSize, dir)
+}
+
+// SaveBuildsReport saves the coverage of several builds, keyed by build name,
+// as merged by MergeBuilds, like SaveReport. Its index also breaks down the
+// coverage of each directory by build.
+func SaveBuildsReport(builds map[string][]*codecoverage.File, shardSize int, dir string) (*codecoverage.CoverageReport, error) {
+	return saveShardedReport(MergeBuilds(builds), builds, shardSize, dir)
+}
+
+func saveShardedReport(files []*codecoverage.File, builds map[string][]*codecoverage.File, shardSize int, dir string) (*codecoverage.CoverageReport, error) {
 	dirs, summaries := ComputeSummaries(files)
 	report := &codecoverage.CoverageReport{
 		Dirs:      dirs,
 		Summaries: summaries,
 	}
+	var shards []IndexShard
 	if numFiles := len(files); numFiles > shardSize {
 		const filename = "files%0*d.json.gz"
 		numShards := int(math.Ceil(float64(numFiles) / float64(shardSize)))
@@ -442,6 +458,12 @@ func SaveReport(files []*codecoverage.File, shardSize int, dir string) (*codecov
 				return nil, fmt.Errorf("failed to save report %q: %w", filename, err)
 			}
 			fileShards[i] = filename
+			shards = append(shards, IndexShard{
+				Name:  filename,
+				Files: to - from,
+				First: files[from].Path,
+				Last:  files[to-1].Path,
+			})
 		}
 		report.FileShards = fileShards
 	} else {
@@ -451,5 +473,316 @@ func SaveReport(files []*codecoverage.File, shardSize int, dir string) (*codecov
 	if err := saveReport(report, filepath.Join(dir, filename)); err != nil {
 		return nil, fmt.Errorf("failed to save report %q: %w", filename, err)
 	}
+	if err := saveIndex(newIndex(filename, shards, report, builds), dir); err != nil {
+		return nil, fmt.Errorf("failed to save index: %w", err)
+	}
 	return report, nil
 }
+
+// Coverage is the number of covered and total items of a metric.
+type Coverage struct {
+	Covered int64 `json:"covered"`
+	Total   int64 `json:"total"`
+	// Percentage is Covered as a percentage of Total, rounded to two decimal
+	// places. It is 0 if Total is 0.
+	Percentage float64 `json:"percentage"`
+}
+
+func newCoverage(summaries []*codecoverage.Metric, name string) Coverage {
+	var c Coverage
+	for _, m := range summaries {
+		if m.Name == name {
+			c.Covered += int64(m.Covered)
+			c.Total += int64(m.Total)
+		}
+	}
+	c.Percentage = percentage(c.Covered, c.Total)
+	return c
+}
+
+func percentage(covered, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(covered)*10000/float64(total)) / 100
+}
+
+// IndexCoverage is the line and function coverage of a set of files.
+type IndexCoverage struct {
+	Lines     Coverage `json:"lines"`
+	Functions Coverage `json:"functions"`
+}
+
+func newIndexCoverage(summaries []*codecoverage.Metric) IndexCoverage {
+	return IndexCoverage{
+		Lines:     newCoverage(summaries, "line"),
+		Functions: newCoverage(summaries, "function"),
+	}
+}
+
+// IndexShard describes one of the files a report's files are sharded into.
+type IndexShard struct {
+	// Name is the name of the shard, relative to the report directory.
+	Name string `json:"name"`
+	// Files is the number of files in the shard.
+	Files int `json:"files"`
+	// First and Last are the paths of the first and last files in the shard.
+	First string `json:"first"`
+	Last  string `json:"last"`
+}
+
+// IndexDir is the coverage of the files under a directory.
+type IndexDir struct {
+	// Path is the path of the directory, e.g. "//src/".
+	Path string `json:"path"`
+	IndexCoverage
+	// Builds is the coverage of the directory in each build, keyed by build
+	// name, if the report merges several builds.
+	Builds map[string]IndexCoverage `json:"builds,omitempty"`
+}
+
+// Index describes a saved report, so that it can be navigated without
+// downloading and decompressing the report.
+type Index struct {
+	// Report is the name of the top-level report, relative to the report
+	// directory.
+	Report string `json:"report"`
+	// Shards lists the shards of the report, in order. It is empty if the
+	// report isn't sharded.
+	Shards []IndexShard `json:"shards"`
+	// Builds lists the names of the builds merged into the report, if any.
+	Builds []string `json:"builds,omitempty"`
+	// Summary is the coverage of the whole report.
+	Summary IndexCoverage `json:"summary"`
+	// Dirs is the coverage of each directory, sorted by path.
+	Dirs []IndexDir `json:"dirs"`
+}
+
+func newIndex(filename string, shards []IndexShard, report *codecoverage.CoverageReport, builds map[string][]*codecoverage.File) Index {
+	index := Index{
+		Report:  filename,
+		Shards:  shards,
+		Summary: newIndexCoverage(report.Summaries),
+		Dirs:    make([]IndexDir, 0, len(report.Dirs)),
+	}
+	if index.Shards == nil {
+		index.Shards = []IndexShard{}
+	}
+	buildDirs := map[string]map[string]IndexCoverage{}
+	for name, files := range builds {
+		index.Builds = append(index.Builds, name)
+		dirs, _ := ComputeSummaries(files)
+		for _, d := range dirs {
+			if buildDirs[d.Path] == nil {
+				buildDirs[d.Path] = map[string]IndexCoverage{}
+			}
+			buildDirs[d.Path][name] = newIndexCoverage(d.Summaries)
+		}
+	}
+	sort.Strings(index.Builds)
+	for _, d := range report.Dirs {
+		index.Dirs = append(index.Dirs, IndexDir{
+			Path:          d.Path,
+			IndexCoverage: newIndexCoverage(d.Summaries),
+			Builds:        buildDirs[d.Path],
+		})
+	}
+	sort.Slice(index.Dirs, func(i, j int) bool {
+		return index.Dirs[i].Path < index.Dirs[j].Path
+	})
+	return index
+}
+
+var indexTemplate = template.Must(template.New("index.html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage report</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { padding: 2px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+</style>
+</head>
+<body>
+<h1>Coverage report</h1>
+<p>
+Lines: {{.Summary.Lines.Covered}}/{{.Summary.Lines.Total}} ({{.Summary.Lines.Percentage}}%),
+functions: {{.Summary.Functions.Covered}}/{{.Summary.Functions.Total}} ({{.Summary.Functions.Percentage}}%).
+</p>
+<p>Report: <a href="{{.Report}}">{{.Report}}</a>, index: <a href="index.json">index.json</a></p>
+{{- if .Shards}}
+<h2>Shards</h2>
+<table>
+<tr><th>Shard</th><th>Files</th><th>First</th><th>Last</th></tr>
+{{- range .Shards}}
+<tr><td><a href="{{.Name}}">{{.Name}}</a></td><td>{{.Files}}</td><td>{{.First}}</td><td>{{.Last}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<h2>Directories</h2>
+<table>
+<tr><th>Directory</th><th>Lines</th><th>%</th><th>Functions</th><th>%</th>{{range .Builds}}<th>{{.}} lines</th><th>%</th>{{end}}</tr>
+{{- range $dir := .Dirs}}
+<tr><td>{{.Path}}</td><td>{{.Lines.Covered}}/{{.Lines.Total}}</td><td>{{.Lines.Percentage}}</td><td>{{.Functions.Covered}}/{{.Functions.Total}}</td><td>{{.Functions.Percentage}}</td>
+{{- range $build := $.Builds}}{{with index $dir.Builds $build}}<td>{{.Lines.Covered}}/{{.Lines.Total}}</td><td>{{.Lines.Percentage}}</td>{{end}}{{end}}</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// saveIndex writes the index to index.json and index.html in dir.
+func saveIndex(index Index, dir string) error {
+	if err := saveJSON(index, filepath.Join(dir, "index.json")); err != nil {
+		return err
+	}
+	filename := filepath.Join(dir, "index.html")
+	var b bytes.Buffer
+	if err := indexTemplate.Execute(&b, index); err != nil {
+		return fmt.Errorf("cannot render %q: %w", filename, err)
+	}
+	if err := os.WriteFile(filename, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("cannot write %q: %w", filename, err)
+	}
+	return nil
+}
+
+// Summary is a small, stable summary of the line coverage of a report,
+// suitable for consumers such as README badges that don't want to parse the
+// full report.
+type Summary struct {
+	// Lines is the total number of coverable lines.
+	Lines int64 `json:"lines"`
+	// Covered is the number of lines executed at least once.
+	Covered int64 `json:"covered"`
+	// Percentage is Covered as a percentage of Lines, rounded to two decimal
+	// places. It is 0 if there are no coverable lines.
+	Percentage float64 `json:"percentage"`
+}
+
+// Badge is a shields.io endpoint badge.
+// See https://shields.io/endpoint.
+type Badge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// Summarize computes the summary for the top-level summaries of a report.
+func Summarize(summaries []*codecoverage.Metric) Summary {
+	var s Summary
+	for _, m := range summaries {
+		if m.Name == "line" {
+			s.Lines += int64(m.Total)
+			s.Covered += int64(m.Covered)
+		}
+	}
+	s.Percentage = percentage(s.Covered, s.Lines)
+	return s
+}
+
+// Badge returns the shields.io badge for the summary.
+func (s Summary) Badge() Badge {
+	var color string
+	switch p := s.Percentage; {
+	case p >= 90:
+		color = "brightgreen"
+	case p >= 75:
+		color = "green"
+	case p >= 60:
+		color = "yellowgreen"
+	case p >= 40:
+		color = "yellow"
+	case p >= 20:
+		color = "orange"
+	default:
+		color = "red"
+	}
+	return Badge{
+		SchemaVersion: 1,
+		Label:         "coverage",
+		Message:       strconv.FormatFloat(s.Percentage, 'f', -1, 64) + "%",
+		Color:         color,
+	}
+}
+
+func saveJSON(v interface{}, filename string) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot marshal %q: %w", filename, err)
+	}
+	if err := os.WriteFile(filename, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write %q: %w", filename, err)
+	}
+	return nil
+}
+
+// SaveSummary writes the summary of a report to summary.json in dir, and
+// if badge is set, its shields.io badge to badge.json.
+func SaveSummary(summary Summary, badge bool, dir string) error {
+	if err := saveJSON(summary, filepath.Join(dir, "summary.json")); err != nil {
+		return err
+	}
+	if badge {
+		if err := saveJSON(summary.Badge(), filepath.Join(dir, "badge.json")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MetricsCoverage is the line, function and region coverage of a set of files.
+type MetricsCoverage struct {
+	Lines     Coverage `json:"lines"`
+	Functions Coverage `json:"functions"`
+	Regions   Coverage `json:"regions"`
+}
+
+func newMetricsCoverage(summaries []*codecoverage.Metric) MetricsCoverage {
+	return MetricsCoverage{
+		Lines:     newCoverage(summaries, "line"),
+		Functions: newCoverage(summaries, "function"),
+		Regions:   newCoverage(summaries, "region"),
+	}
+}
+
+// Metrics are the summary numbers of a report, for dashboards that track
+// coverage over time without parsing the report.
+type Metrics struct {
+	MetricsCoverage
+	// Dirs is the coverage of each top-level directory, keyed by path, e.g.
+	// "//src/".
+	Dirs map[string]MetricsCoverage `json:"dirs"`
+	// Modules is the number of instrumented modules whose coverage is
+	// reported.
+	Modules int `json:"modules"`
+	// MalformedModules is the number of modules left out of the report
+	// because they failed validation with llvm-cov, of which
+	// NewMalformedModules aren't known to be malformed.
+	MalformedModules    int `json:"malformed_modules"`
+	NewMalformedModules int `json:"new_malformed_modules"`
+}
+
+// ComputeMetrics computes the coverage metrics of a report. The counts of
+// modules are left for the caller to set.
+func ComputeMetrics(report *codecoverage.CoverageReport) Metrics {
+	metrics := Metrics{
+		MetricsCoverage: newMetricsCoverage(report.Summaries),
+		Dirs:            map[string]MetricsCoverage{},
+	}
+	for _, d := range report.Dirs {
+		// Top-level directories have a single path component, e.g. "//src/".
+		if d.Path != "//" && strings.Count(d.Path, "/") == 3 {
+			metrics.Dirs[d.Path] = newMetricsCoverage(d.Summaries)
+		}
+	}
+	return metrics
+}
+
+// SaveMetrics writes the metrics to filename.
+func SaveMetrics(metrics Metrics, filename string) error {
+	return saveJSON(metrics, filename)
+}
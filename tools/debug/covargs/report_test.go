@@ -5,9 +5,13 @@
 package covargs
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 
 	"go.fuchsia.dev/fuchsia/tools/debug/covargs/api/llvm"
@@ -601,6 +605,248 @@ func TestSave(t *testing.T) {
 					t.Error("expected", tt.numFiles, "but got", numFiles)
 				}
 			}
+
+			b, err := os.ReadFile(filepath.Join(testDir, "index.json"))
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			var index Index
+			if err := json.Unmarshal(b, &index); err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			var shards []string
+			numFiles := 0
+			for _, shard := range index.Shards {
+				shards = append(shards, shard.Name)
+				numFiles += shard.Files
+			}
+			if !reflect.DeepEqual(shards, tt.fileShards) {
+				t.Error("expected", tt.fileShards, "but got", shards)
+			}
+			if tt.numShards > 0 && numFiles != tt.numFiles {
+				t.Error("expected", tt.numFiles, "but got", numFiles)
+			}
+
+			b, err = os.ReadFile(filepath.Join(testDir, "index.html"))
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			for _, name := range append([]string{"all.json.gz"}, tt.fileShards...) {
+				if link := fmt.Sprintf("<a href=%q>", name); !strings.Contains(string(b), link) {
+					t.Errorf("index.html doesn't link to %s", name)
+				}
+			}
 		})
 	}
 }
+
+func TestIndex(t *testing.T) {
+	files := []*codecoverage.File{
+		{
+			Path: "//a/x.cc",
+			Summaries: []*codecoverage.Metric{
+				{Name: "function", Covered: 1, Total: 2},
+				{Name: "line", Covered: 3, Total: 4},
+			},
+		},
+		{
+			Path: "//a/b/y.cc",
+			Summaries: []*codecoverage.Metric{
+				{Name: "function", Covered: 0, Total: 1},
+				{Name: "line", Covered: 0, Total: 2},
+			},
+		},
+	}
+	dirs, summaries := ComputeSummaries(files)
+	shards := []IndexShard{{Name: "files1.json.gz", Files: 2, First: "//a/x.cc", Last: "//a/b/y.cc"}}
+	index := newIndex("all.json.gz", shards, &codecoverage.CoverageReport{Dirs: dirs, Summaries: summaries}, nil)
+
+	want := Index{
+		Report: "all.json.gz",
+		Shards: shards,
+		Summary: IndexCoverage{
+			Lines:     Coverage{Covered: 3, Total: 6, Percentage: 50},
+			Functions: Coverage{Covered: 1, Total: 3, Percentage: 33.33},
+		},
+		Dirs: []IndexDir{
+			{
+				Path: "//",
+				IndexCoverage: IndexCoverage{
+					Lines:     Coverage{Covered: 3, Total: 6, Percentage: 50},
+					Functions: Coverage{Covered: 1, Total: 3, Percentage: 33.33},
+				},
+			},
+			{
+				Path: "//a/",
+				IndexCoverage: IndexCoverage{
+					Lines:     Coverage{Covered: 3, Total: 6, Percentage: 50},
+					Functions: Coverage{Covered: 1, Total: 3, Percentage: 33.33},
+				},
+			},
+			{
+				Path: "//a/b/",
+				IndexCoverage: IndexCoverage{
+					Lines:     Coverage{Covered: 0, Total: 2, Percentage: 0},
+					Functions: Coverage{Covered: 0, Total: 1, Percentage: 0},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(index, want) {
+		t.Errorf("expected %+v but got %+v", want, index)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name      string
+		summaries []*codecoverage.Metric
+		want      Summary
+		wantBadge Badge
+	}{
+		{
+			name: "empty",
+			summaries: []*codecoverage.Metric{
+				{Name: "line"},
+			},
+			want:      Summary{},
+			wantBadge: Badge{SchemaVersion: 1, Label: "coverage", Message: "0%", Color: "red"},
+		},
+		{
+			name: "partial",
+			summaries: []*codecoverage.Metric{
+				{Name: "function", Covered: int32(1), Total: int32(1)},
+				{Name: "line", Covered: int32(2), Total: int32(3)},
+			},
+			want:      Summary{Lines: 3, Covered: 2, Percentage: 66.67},
+			wantBadge: Badge{SchemaVersion: 1, Label: "coverage", Message: "66.67%", Color: "yellowgreen"},
+		},
+		{
+			name: "full",
+			summaries: []*codecoverage.Metric{
+				{Name: "line", Covered: int32(20), Total: int32(20)},
+			},
+			want:      Summary{Lines: 20, Covered: 20, Percentage: 100},
+			wantBadge: Badge{SchemaVersion: 1, Label: "coverage", Message: "100%", Color: "brightgreen"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := Summarize(tt.summaries)
+			if summary != tt.want {
+				t.Error("expected", tt.want, "but got", summary)
+			}
+			if badge := summary.Badge(); badge != tt.wantBadge {
+				t.Error("expected", tt.wantBadge, "but got", badge)
+			}
+		})
+	}
+}
+
+func TestSaveSummary(t *testing.T) {
+	testDir := t.TempDir()
+	summary := Summary{Lines: 4, Covered: 3, Percentage: 75}
+	if err := SaveSummary(summary, true, testDir); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(testDir, "summary.json"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	const wantSummary = "{\n  \"lines\": 4,\n  \"covered\": 3,\n  \"percentage\": 75\n}\n"
+	if got := string(b); got != wantSummary {
+		t.Errorf("expected %q but got %q", wantSummary, got)
+	}
+
+	b, err = os.ReadFile(filepath.Join(testDir, "badge.json"))
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	var badge Badge
+	if err := json.Unmarshal(b, &badge); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if want := summary.Badge(); badge != want {
+		t.Error("expected", want, "but got", badge)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	files := []*codecoverage.File{
+		{
+			Path: "//a/x.cc",
+			Summaries: []*codecoverage.Metric{
+				{Name: "function", Covered: 1, Total: 2},
+				{Name: "region", Covered: 2, Total: 8},
+				{Name: "line", Covered: 3, Total: 4},
+			},
+		},
+		{
+			Path: "//a/b/y.cc",
+			Summaries: []*codecoverage.Metric{
+				{Name: "function", Covered: 0, Total: 1},
+				{Name: "region", Covered: 0, Total: 2},
+				{Name: "line", Covered: 0, Total: 2},
+			},
+		},
+		{
+			Path: "//c/z.cc",
+			Summaries: []*codecoverage.Metric{
+				{Name: "function", Covered: 1, Total: 1},
+				{Name: "region", Covered: 2, Total: 2},
+				{Name: "line", Covered: 2, Total: 2},
+			},
+		},
+	}
+	dirs, summaries := ComputeSummaries(files)
+	metrics := ComputeMetrics(&codecoverage.CoverageReport{Dirs: dirs, Summaries: summaries})
+
+	want := Metrics{
+		MetricsCoverage: MetricsCoverage{
+			Lines:     Coverage{Covered: 5, Total: 8, Percentage: 62.5},
+			Functions: Coverage{Covered: 2, Total: 4, Percentage: 50},
+			Regions:   Coverage{Covered: 4, Total: 12, Percentage: 33.33},
+		},
+		Dirs: map[string]MetricsCoverage{
+			"//a/": {
+				Lines:     Coverage{Covered: 3, Total: 6, Percentage: 50},
+				Functions: Coverage{Covered: 1, Total: 3, Percentage: 33.33},
+				Regions:   Coverage{Covered: 2, Total: 10, Percentage: 20},
+			},
+			"//c/": {
+				Lines:     Coverage{Covered: 2, Total: 2, Percentage: 100},
+				Functions: Coverage{Covered: 1, Total: 1, Percentage: 100},
+				Regions:   Coverage{Covered: 2, Total: 2, Percentage: 100},
+			},
+		},
+	}
+	if !reflect.DeepEqual(metrics, want) {
+		t.Errorf("expected %+v but got %+v", want, metrics)
+	}
+
+	metrics.Modules = 3
+	metrics.MalformedModules = 2
+	metrics.NewMalformedModules = 1
+	filename := filepath.Join(t.TempDir(), "metrics.json")
+	if err := SaveMetrics(metrics, filename); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	var got Metrics
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if !reflect.DeepEqual(got, metrics) {
+		t.Errorf("expected %+v but got %+v", metrics, got)
+	}
+	for _, key := range []string{`"lines"`, `"regions"`, `"dirs"`, `"modules": 3`, `"malformed_modules": 2`, `"new_malformed_modules": 1`} {
+		if !strings.Contains(string(b), key) {
+			t.Errorf("expected %s in %s", key, b)
+		}
+	}
+}
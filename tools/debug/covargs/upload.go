@@ -0,0 +1,79 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package covargs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/tools/artifactory"
+)
+
+// UploadedDir describes a directory of coverage results after it has been
+// uploaded.
+type UploadedDir struct {
+	// Name is the name the directory was uploaded under, relative to the
+	// upload destination.
+	Name string `json:"name"`
+
+	// URL is the URL of the uploaded directory.
+	URL string `json:"url"`
+
+	// Objects is the number of files in the directory.
+	Objects int `json:"objects"`
+}
+
+// UploadDirs recursively uploads each of the directories in dirs, keyed by the
+// name to upload them under, to destination, which may be any URL accepted by
+// artifactory.NewStore. Up to concurrency files are uploaded at once; objects
+// on GCS are written with resumable uploads, so that a transient failure only
+// resends the chunk in flight. tmpDir is used to stage files before they are
+// uploaded.
+func UploadDirs(ctx context.Context, destination string, dirs map[string]string, concurrency int, tmpDir string) ([]UploadedDir, error) {
+	store, err := artifactory.NewStore(ctx, destination)
+	if err != nil {
+		return nil, err
+	}
+	uploader := artifactory.NewUploader(store, tmpDir)
+	uploader.SetMaxConcurrency(concurrency)
+
+	names := make([]string, 0, len(dirs))
+	for name := range dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Upload all of the directories together so that their files share the
+	// same pool of concurrent uploads.
+	var uploads []artifactory.Upload
+	for _, name := range names {
+		uploads = append(uploads, artifactory.Upload{
+			Source:      dirs[name],
+			Destination: name,
+			Recursive:   true,
+		})
+	}
+	records, err := uploader.Upload(ctx, uploads)
+	if err != nil {
+		return nil, fmt.Errorf("uploading coverage results: %w", err)
+	}
+
+	var uploaded []UploadedDir
+	for _, name := range names {
+		dir := UploadedDir{
+			Name: name,
+			URL:  strings.TrimSuffix(destination, "/") + "/" + name,
+		}
+		for _, record := range records {
+			if strings.HasPrefix(record.Name, name+"/") {
+				dir.Objects++
+			}
+		}
+		uploaded = append(uploaded, dir)
+	}
+	return uploaded, nil
+}
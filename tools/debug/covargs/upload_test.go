@@ -0,0 +1,61 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package covargs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUploadDirs(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"report/summary.json":        "{}",
+		"report/files/a.json":        "a",
+		"report/files/nested/b.json": "b",
+		"html/index.html":            "<html></html>",
+	}
+	for name, contents := range files {
+		p := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := t.TempDir()
+	destination := "file://" + dst
+	dirs := map[string]string{
+		"report": filepath.Join(src, "report"),
+		"html":   filepath.Join(src, "html"),
+	}
+	got, err := UploadDirs(context.Background(), destination, dirs, 4, t.TempDir())
+	if err != nil {
+		t.Fatalf("UploadDirs() failed: %s", err)
+	}
+	want := []UploadedDir{
+		{Name: "html", URL: destination + "/html", Objects: 1},
+		{Name: "report", URL: destination + "/report", Objects: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UploadDirs() = %+v, want %+v", got, want)
+	}
+
+	for name, contents := range files {
+		data, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Errorf("%s was not uploaded: %s", name, err)
+			continue
+		}
+		if string(data) != contents {
+			t.Errorf("got %q uploaded to %s, want %q", data, name, contents)
+		}
+	}
+}
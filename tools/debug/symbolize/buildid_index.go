@@ -0,0 +1,146 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package symbolize
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The version of the on-disk format of a BuildIDIndex. Index files with any
+// other version are discarded.
+const buildIDIndexVersion = 1
+
+// buildIDIndexEntry records a debug binary whose build ID was verified, along
+// with the state of the file at the time.
+type buildIDIndexEntry struct {
+	BuildID string `json:"build_id"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime_ns"`
+}
+
+type buildIDIndexFile struct {
+	Version int                          `json:"version"`
+	Entries map[string]buildIDIndexEntry `json:"entries"`
+}
+
+// BuildIDIndex is a persistent index of the debug binaries found in .build-id
+// directories, keyed by their paths.
+//
+// Verifying that a file in a .build-id directory has the expected build ID
+// means opening it and reading its ELF notes. The index remembers the files
+// that were verified so that later runs only need to stat them; an entry is
+// discarded as soon as the size or modification time of its file changes.
+type BuildIDIndex struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]buildIDIndexEntry
+	dirty   bool
+}
+
+// LoadBuildIDIndex loads the index stored at path. A missing, unreadable or
+// outdated index file results in an empty index, which is written to path by
+// Save.
+func LoadBuildIDIndex(path string) (*BuildIDIndex, error) {
+	index := &BuildIDIndex{
+		path:    path,
+		entries: make(map[string]buildIDIndexEntry),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var file buildIDIndexFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Version != buildIDIndexVersion {
+		// The index is only a cache, so rebuild it rather than failing.
+		index.dirty = true
+		return index, nil
+	}
+	if file.Entries != nil {
+		index.entries = file.Entries
+	}
+	return index, nil
+}
+
+// lookup returns whether path is known to be the debug binary for buildID,
+// and has not changed since it was verified.
+func (i *BuildIDIndex) lookup(path, buildID string) bool {
+	i.mu.Lock()
+	entry, ok := i.entries[path]
+	i.mu.Unlock()
+	if !ok || entry.BuildID != buildID {
+		return false
+	}
+	fi, err := os.Stat(path)
+	if err == nil && fi.Size() == entry.Size && fi.ModTime().UnixNano() == entry.ModTime {
+		return true
+	}
+	i.mu.Lock()
+	delete(i.entries, path)
+	i.dirty = true
+	i.mu.Unlock()
+	return false
+}
+
+// add records that path was verified to be the debug binary for buildID.
+func (i *BuildIDIndex) add(path, buildID string) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.entries[path] = buildIDIndexEntry{
+		BuildID: buildID,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime().UnixNano(),
+	}
+	i.dirty = true
+}
+
+// Save writes the index back to its file if it changed since it was loaded.
+func (i *BuildIDIndex) Save() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.dirty {
+		return nil
+	}
+	data, err := json.Marshal(buildIDIndexFile{
+		Version: buildIDIndexVersion,
+		Entries: i.entries,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(i.path), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it into place so that concurrent
+	// runs never see a partially written index.
+	f, err := os.CreateTemp(filepath.Dir(i.path), filepath.Base(i.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("writing build ID index: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), i.path); err != nil {
+		return err
+	}
+	i.dirty = false
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package symbolize
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildIDIndex(t *testing.T) {
+	const buildID = "5bf6a28a259b95b4f20ffbcea0cbb149"
+	elf, err := os.ReadFile(filepath.Join(*testDataDir, "gobug.elf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	debug := filepath.Join(dir, buildID[:2], buildID[2:]+".debug")
+	if err := os.MkdirAll(filepath.Dir(debug), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(debug, elf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexPath := filepath.Join(t.TempDir(), "index.json")
+
+	getBuildObject := func(index *BuildIDIndex) error {
+		repo := NewBuildIDRepo(dir)
+		repo.SetIndex(index)
+		_, err := repo.GetBuildObject(buildID)
+		return err
+	}
+
+	index, err := LoadBuildIDIndex(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := getBuildObject(index); err != nil {
+		t.Fatalf("GetBuildObject(%s) failed: %s", buildID, err)
+	}
+	if err := index.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the file without changing its size or modification time. A
+	// reloaded index still trusts it, which shows that it isn't read again.
+	fi, err := os.Stat(debug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(debug, make([]byte, len(elf)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(debug, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	index, err = LoadBuildIDIndex(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := getBuildObject(index); err != nil {
+		t.Errorf("GetBuildObject(%s) with the index failed: %s", buildID, err)
+	}
+	if err := getBuildObject(nil); err == nil {
+		t.Errorf("GetBuildObject(%s) without the index succeeded for a corrupt file", buildID)
+	}
+
+	// Once the file changes, its entry is invalidated and it is verified again.
+	mtime := fi.ModTime().Add(time.Second)
+	if err := os.Chtimes(debug, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := getBuildObject(index); err == nil {
+		t.Errorf("GetBuildObject(%s) succeeded for a corrupt file after it changed", buildID)
+	}
+}
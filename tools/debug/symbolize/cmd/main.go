@@ -40,6 +40,7 @@ var (
 	symbolCache     string
 	symbolIndex     string
 	buildIDDirPaths argList
+	buildIDIndex    string
 	colors          color.EnableColor
 	jsonOutput      string
 	idsPaths        argList
@@ -60,10 +61,12 @@ func init() {
 		defaultSymbolIndex = filepath.Join(homeDir, ".fuchsia", "debug", "symbol-index")
 	}
 
-	flag.Var(&symbolServers, "symbol-server", "a GCS URL or bucket name that contains debug binaries indexed by build ID")
+	flag.Var(&symbolServers, "symbol-server", "a GCS URL or bucket name that contains debug binaries indexed by build ID, or the http(s) URL of a debuginfod server")
 	flag.StringVar(&symbolCache, "symbol-cache", "", "path to directory to store cached debug binaries in")
 	flag.StringVar(&symbolIndex, "symbol-index", defaultSymbolIndex, "path to the symbol-index file")
 	flag.Var(&buildIDDirPaths, "build-id-dir", "path to .build-id directory")
+	flag.StringVar(&buildIDIndex, "build-id-index", "", "path to a file caching the debug binaries found in .build-id directories, "+
+		"which is created if it doesn't exist")
 	flag.StringVar(&llvmSymboPath, "llvm-symbolizer", "llvm-symbolizer", "path to llvm-symbolizer")
 	flag.Var(&idsPaths, "ids", "(deprecated) alias for -ids-txt")
 	flag.Var(&idsPaths, "ids-txt", "path to ids.txt")
@@ -86,9 +89,22 @@ func main() {
 	ctx := logger.WithLogger(context.Background(), log)
 
 	symbolizer := symbolize.NewLLVMSymbolizer(llvmSymboPath, llvmSymboRestartInterval)
+	var index *symbolize.BuildIDIndex
+	if buildIDIndex != "" {
+		var err error
+		if index, err = symbolize.LoadBuildIDIndex(buildIDIndex); err != nil {
+			log.Fatalf("failed to load the build ID index: %s", err)
+		}
+	}
+	newBuildIDRepo := func(dir string) symbolize.Repository {
+		repo := symbolize.NewBuildIDRepo(dir)
+		repo.SetIndex(index)
+		return repo
+	}
+
 	var repo symbolize.CompositeRepo
 	for _, dir := range buildIDDirPaths {
-		repo.AddRepo(symbolize.NewBuildIDRepo(dir))
+		repo.AddRepo(newBuildIDRepo(dir))
 	}
 	for _, idsPath := range idsPaths {
 		repo.AddRepo(symbolize.NewIDsTxtRepo(idsPath, idsRel))
@@ -110,7 +126,7 @@ func main() {
 			for _, entry := range index {
 				if fi, err := os.Stat(entry.SymbolPath); !os.IsNotExist(err) {
 					if fi.IsDir() {
-						repo.AddRepo(symbolize.NewBuildIDRepo(entry.SymbolPath))
+						repo.AddRepo(newBuildIDRepo(entry.SymbolPath))
 					} else {
 						repo.AddRepo(symbolize.NewIDsTxtRepo(entry.SymbolPath, idsRel))
 					}
@@ -131,6 +147,15 @@ func main() {
 		}
 	}
 	for _, symbolServer := range symbolServers {
+		if strings.HasPrefix(symbolServer, "http://") || strings.HasPrefix(symbolServer, "https://") {
+			debuginfodRepo, err := symbolize.NewDebuginfodRepo(symbolServer, filecache)
+			if err != nil {
+				log.Fatalf("%v\n", err)
+			}
+			debuginfodRepo.SetTimeout(cloudFetchTimeout)
+			repo.AddRepo(debuginfodRepo)
+			continue
+		}
 		// TODO(atyfto): Remove when all consumers are passing GCS URLs.
 		if !strings.HasPrefix(symbolServer, "gs://") {
 			symbolServer = "gs://" + symbolServer
@@ -168,6 +193,12 @@ func main() {
 		symbolize.NewBacktracePresenter(os.Stdout, presenter))
 	symbolize.Consume(trash)
 
+	if index != nil {
+		if err := index.Save(); err != nil {
+			log.Warningf("failed to save the build ID index: %s", err)
+		}
+	}
+
 	// Once the pipeline has finished output all triggers
 	if jsonOutput != "" {
 		file, err := os.Create(jsonOutput)
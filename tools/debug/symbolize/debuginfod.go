@@ -0,0 +1,91 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package symbolize
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/cache"
+)
+
+// DebuginfodRepo represents a repository served by a debuginfod server, which
+// serves the debug binary for each build ID at /buildid/<build ID>/debuginfo.
+type DebuginfodRepo struct {
+	client  *http.Client
+	baseURL *url.URL
+	cache   *cache.FileCache
+	timeout *time.Duration
+}
+
+// NewDebuginfodRepo creates a DebuginfodRepo for the server at serverURL,
+// which must be an http or https URL. Downloaded binaries are stored in cache.
+// No timeout on GetBuildObject is set until SetTimeout is called.
+func NewDebuginfodRepo(serverURL string, cache *cache.FileCache) (*DebuginfodRepo, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("debuginfod server URL must be http or https: %s", serverURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return &DebuginfodRepo{
+		client:  http.DefaultClient,
+		baseURL: u,
+		cache:   cache,
+	}, nil
+}
+
+// SetTimeout sets the maximum duration that GetBuildObject will wait before
+// canceling the download from the server.
+func (d *DebuginfodRepo) SetTimeout(t time.Duration) {
+	d.timeout = &t
+}
+
+// GetBuildObject checks the cache for the debug object. If available it uses
+// that. Otherwise it downloads the object, adds it to the cache, and returns
+// the local reference.
+func (d *DebuginfodRepo) GetBuildObject(buildID string) (FileCloser, error) {
+	out, err := d.cache.Get(buildIDKey(buildID))
+	if err == nil {
+		return out, nil
+	}
+	ctx := context.Background()
+	if d.timeout != nil {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, *d.timeout)
+		defer cancel()
+	}
+	u := *d.baseURL
+	u.Path += "/buildid/" + url.PathEscape(strings.ToLower(buildID)) + "/debuginfo"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("timed out while fetching %s", buildID)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s from %s: %s", buildID, d.baseURL, resp.Status)
+	}
+	out, err = d.cache.Add(buildIDKey(buildID), resp.Body)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("timed out while fetching %s", buildID)
+		}
+		return nil, err
+	}
+	return out, nil
+}
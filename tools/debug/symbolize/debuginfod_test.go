@@ -0,0 +1,64 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package symbolize
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/cache"
+)
+
+func TestDebuginfodRepo(t *testing.T) {
+	const buildID = "5bf6a28a259b95b4f20ffbcea0cbb149"
+	contents := []byte("debug binary")
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if r.URL.Path != "/prefix/buildid/"+buildID+"/debuginfo" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(contents)
+	}))
+	defer server.Close()
+
+	fileCache, err := cache.GetFileCache(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := NewDebuginfodRepo(server.URL+"/prefix/", fileCache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		file, err := repo.GetBuildObject(buildID)
+		if err != nil {
+			t.Fatalf("GetBuildObject(%s) failed: %s", buildID, err)
+		}
+		data, err := os.ReadFile(file.String())
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != string(contents) {
+			t.Errorf("got %q for %s, want %q", data, buildID, contents)
+		}
+	}
+	if len(requests) != 1 {
+		t.Errorf("got %d requests, want 1 with the second lookup served from the cache: %v", len(requests), requests)
+	}
+
+	if _, err := repo.GetBuildObject("0123456789abcdef"); err == nil {
+		t.Errorf("GetBuildObject succeeded for a build ID unknown to the server")
+	}
+
+	if _, err := NewDebuginfodRepo("gs://bucket", fileCache); err == nil {
+		t.Errorf("NewDebuginfodRepo succeeded for a GCS URL")
+	}
+}
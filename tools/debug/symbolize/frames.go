@@ -0,0 +1,119 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package symbolize
+
+import (
+	"context"
+	"io"
+)
+
+// Frame is a symbolized frame of a backtrace.
+type Frame struct {
+	// Num is the number of the frame within its backtrace, starting from 0
+	// for the innermost frame.
+	Num uint64 `json:"num"`
+
+	// Addr is the address of the frame in the process.
+	Addr uint64 `json:"addr"`
+
+	// Module is the module that contains Addr. It is the zero Module if no
+	// mapped module contains Addr.
+	Module Module `json:"module"`
+
+	// ModRelAddr is Addr relative to the start of Module.
+	ModRelAddr uint64 `json:"mod_rel_addr"`
+
+	// Locations are the source locations of the frame, from the innermost
+	// inlined function to the function that was actually called. It is empty
+	// if the frame could not be symbolized.
+	Locations []Location `json:"locations,omitempty"`
+
+	// Message is the text that followed the frame in the markup, if any.
+	Message string `json:"message,omitempty"`
+}
+
+// Location is a location in a source file. Fields that the symbolizer could
+// not determine are left empty.
+type Location struct {
+	Function string `json:"function,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+// FrameSink receives the frames symbolized by SymbolizeMarkup.
+type FrameSink interface {
+	// WriteFrame is called for each frame, in the order in which the frames
+	// appear in the markup.
+	WriteFrame(Frame) error
+
+	// Close is called once all of the frames have been written.
+	Close() error
+}
+
+// SymbolizeMarkup reads symbolizer markup from r, symbolizes the backtraces
+// within it using the binaries in repo, and writes each frame to every one of
+// sinks. It returns once r is exhausted and the sinks are closed, or ctx is
+// done. symbolizer must already be started.
+//
+// After a sink fails, no more frames are written to any sink, and the first
+// error is returned.
+func SymbolizeMarkup(ctx context.Context, r io.Reader, repo Repository, symbolizer Symbolizer, sinks ...FrameSink) error {
+	c := &frameCollector{sinks: sinks}
+	lines := NewDemuxer(repo, symbolizer).Start(ctx, StartParsing(ctx, r))
+	Consume(ComposePostProcessors(ctx, lines, c))
+
+	err := c.err
+	for _, s := range sinks {
+		if closeErr := s.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// frameCollector is a PostProcessor that writes the backtrace frames in the
+// lines it forwards to sinks.
+type frameCollector struct {
+	sinks []FrameSink
+	// err is the first error returned by a sink.
+	err error
+}
+
+func (c *frameCollector) Process(line OutputLine, out chan<- OutputLine) {
+	for _, node := range line.line {
+		if bt, ok := node.(*BacktraceElement); ok && c.err == nil {
+			frame := newFrame(bt)
+			for _, s := range c.sinks {
+				if err := s.WriteFrame(frame); err != nil {
+					c.err = err
+					break
+				}
+			}
+		}
+	}
+	out <- line
+}
+
+func newFrame(bt *BacktraceElement) Frame {
+	info := bt.info
+	frame := Frame{
+		Num:        bt.num,
+		Addr:       info.addr,
+		Module:     info.mod,
+		ModRelAddr: info.addr - info.seg.Vaddr + info.seg.ModRelAddr,
+		Message:    bt.msg,
+	}
+	for _, loc := range info.locs {
+		frame.Locations = append(frame.Locations, Location{
+			Function: loc.function.Unwrap(""),
+			File:     loc.file.Unwrap(""),
+			Line:     loc.line,
+		})
+	}
+	return frame
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package symbolize
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type frameRecorder struct {
+	frames []Frame
+	err    error
+	closed bool
+}
+
+func (r *frameRecorder) WriteFrame(frame Frame) error {
+	r.frames = append(r.frames, frame)
+	return r.err
+}
+
+func (r *frameRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func newFramesTestSymbolizer() Symbolizer {
+	return newMockSymbolizer([]mockModule{
+		{
+			filepath.Join(*testDataDir, "libc.elf"),
+			map[uint64][]SourceLocation{
+				0x429c0: {{NewOptStr("math.h"), 51, NewOptStr("__DOUBLE_FLOAT")}, {NewOptStr("atan2.c"), 49, NewOptStr("atan2")}},
+				0x43680: {{NewOptStr("pow.c"), 23, NewOptStr("pow")}},
+			},
+		},
+	})
+}
+
+const framesTestMarkup = "{{{module:1:libc.so:elf:4fcb712aa6387724a9f465a32cd8c14b}}}\n" +
+	"{{{mmap:0x12345000:0xcf6bc:load:1:rx:0x0}}}\n" +
+	"Backtrace:\n" +
+	"{{{bt:0:0x12388680}}}\n" +
+	"{{{bt:1:0x123879c0}}}\n" +
+	"{{{bt:2:0xdeadbeef:sp 0xdeadbaaf}}}\n"
+
+func TestSymbolizeMarkup(t *testing.T) {
+	libc := Module{Name: "libc.so", Build: "4fcb712aa6387724a9f465a32cd8c14b", Id: 1}
+	want := []Frame{
+		{
+			Num:        0,
+			Addr:       0x12388680,
+			Module:     libc,
+			ModRelAddr: 0x43680,
+			Locations:  []Location{{Function: "pow", File: "pow.c", Line: 23}},
+		},
+		{
+			Num:        1,
+			Addr:       0x123879c0,
+			Module:     libc,
+			ModRelAddr: 0x429c0,
+			Locations: []Location{
+				{Function: "__DOUBLE_FLOAT", File: "math.h", Line: 51},
+				{Function: "atan2", File: "atan2.c", Line: 49},
+			},
+		},
+		{
+			Num:        2,
+			Addr:       0xdeadbeef,
+			ModRelAddr: 0xdeadbeef,
+			Message:    "sp 0xdeadbaaf",
+		},
+	}
+
+	recorder := &frameRecorder{}
+	var jsonOut, textOut bytes.Buffer
+	err := SymbolizeMarkup(context.Background(), strings.NewReader(framesTestMarkup),
+		getTestBinaries(), newFramesTestSymbolizer(), recorder, NewJSONSink(&jsonOut), NewTextSink(&textOut))
+	if err != nil {
+		t.Fatalf("SymbolizeMarkup() = %s", err)
+	}
+	if !recorder.closed {
+		t.Errorf("sink was not closed")
+	}
+	if diff := cmp.Diff(want, recorder.frames); diff != "" {
+		t.Errorf("unexpected frames (-want +got):\n%s", diff)
+	}
+
+	var jsonFrames []Frame
+	dec := json.NewDecoder(&jsonOut)
+	for dec.More() {
+		var frame Frame
+		if err := dec.Decode(&frame); err != nil {
+			t.Fatalf("failed to decode JSON sink output: %s", err)
+		}
+		jsonFrames = append(jsonFrames, frame)
+	}
+	if diff := cmp.Diff(want, jsonFrames); diff != "" {
+		t.Errorf("unexpected JSON sink output (-want +got):\n%s", diff)
+	}
+
+	wantText := "    #0    0x0000000012388680 in pow pow.c:23 <libc.so>+0x43680\n" +
+		"    #1.1  0x00000000123879c0 in __DOUBLE_FLOAT math.h:51 <libc.so>+0x429c0\n" +
+		"    #1    0x00000000123879c0 in atan2 atan2.c:49 <libc.so>+0x429c0\n" +
+		"    #2    0x00000000deadbeef in <>+0xdeadbeef sp 0xdeadbaaf\n"
+	if diff := cmp.Diff(wantText, textOut.String()); diff != "" {
+		t.Errorf("unexpected text sink output (-want +got):\n%s", diff)
+	}
+}
+
+func TestSymbolizeMarkupSinkError(t *testing.T) {
+	wantErr := errors.New("sink failed")
+	failing := &frameRecorder{err: wantErr}
+	other := &frameRecorder{}
+	err := SymbolizeMarkup(context.Background(), strings.NewReader(framesTestMarkup),
+		getTestBinaries(), newFramesTestSymbolizer(), failing, other)
+	if !errors.Is(err, wantErr) {
+		t.Errorf("SymbolizeMarkup() = %v, want %s", err, wantErr)
+	}
+	// No frames are written after the first failure, but the markup is still
+	// consumed and every sink is closed.
+	if len(failing.frames) != 1 || len(other.frames) != 0 {
+		t.Errorf("got %d and %d frames written, want 1 and 0", len(failing.frames), len(other.frames))
+	}
+	if !failing.closed || !other.closed {
+		t.Errorf("sinks were not all closed")
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package symbolize
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// PprofSink is a FrameSink that aggregates backtraces into a profile in the
+// gzipped profile.proto format read by pprof, with one sample per distinct
+// backtrace counting the number of times it occurred. The profile is written
+// when the sink is closed.
+//
+// Frames are addressed relative to their module, as the same module may be
+// loaded at different addresses in the processes that logged the backtraces.
+type PprofSink struct {
+	out io.Writer
+
+	// stack holds the location IDs of the backtrace being read, innermost
+	// first, and lastNum the number of its last frame.
+	stack   []uint64
+	lastNum uint64
+
+	samples     []pprofSample
+	sampleIndex map[string]int
+
+	locations     []pprofLocation
+	locationIDs   map[pprofLocationKey]uint64
+	functions     []pprofFunction
+	functionIDs   map[pprofFunction]uint64
+	mappings      []Module
+	mappingIDs    map[Module]uint64
+	strings       []string
+	stringIndices map[string]int64
+}
+
+type pprofSample struct {
+	locationIDs []uint64
+	count       int64
+}
+
+type pprofLocationKey struct {
+	build      string
+	name       string
+	modRelAddr uint64
+}
+
+type pprofLocation struct {
+	mappingID uint64
+	address   uint64
+	// lines holds a function ID and line per source location, innermost
+	// first.
+	lines [][2]uint64
+}
+
+type pprofFunction struct {
+	name string
+	file string
+}
+
+// NewPprofSink returns a PprofSink that writes to out.
+func NewPprofSink(out io.Writer) *PprofSink {
+	return &PprofSink{
+		out:           out,
+		sampleIndex:   make(map[string]int),
+		locationIDs:   make(map[pprofLocationKey]uint64),
+		functionIDs:   make(map[pprofFunction]uint64),
+		mappingIDs:    make(map[Module]uint64),
+		strings:       []string{""},
+		stringIndices: map[string]int64{"": 0},
+	}
+}
+
+func (s *PprofSink) WriteFrame(frame Frame) error {
+	// Frames are numbered from 0 within each backtrace, so a number that does
+	// not increase starts a new one.
+	if len(s.stack) > 0 && frame.Num <= s.lastNum {
+		s.flushSample()
+	}
+	s.stack = append(s.stack, s.locationID(frame))
+	s.lastNum = frame.Num
+	return nil
+}
+
+func (s *PprofSink) Close() error {
+	s.flushSample()
+	w := gzip.NewWriter(s.out)
+	if _, err := w.Write(s.encode()); err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+	return nil
+}
+
+func (s *PprofSink) flushSample() {
+	if len(s.stack) == 0 {
+		return
+	}
+	key := fmt.Sprint(s.stack)
+	if i, ok := s.sampleIndex[key]; ok {
+		s.samples[i].count++
+	} else {
+		s.sampleIndex[key] = len(s.samples)
+		s.samples = append(s.samples, pprofSample{locationIDs: s.stack, count: 1})
+	}
+	s.stack = nil
+}
+
+func (s *PprofSink) locationID(frame Frame) uint64 {
+	key := pprofLocationKey{frame.Module.Build, frame.Module.Name, frame.ModRelAddr}
+	if id, ok := s.locationIDs[key]; ok {
+		return id
+	}
+	loc := pprofLocation{address: frame.ModRelAddr}
+	if frame.Module != (Module{}) {
+		loc.mappingID = s.mappingID(frame.Module)
+	}
+	for _, l := range frame.Locations {
+		loc.lines = append(loc.lines, [2]uint64{s.functionID(pprofFunction{l.Function, l.File}), uint64(l.Line)})
+	}
+	s.locations = append(s.locations, loc)
+	id := uint64(len(s.locations))
+	s.locationIDs[key] = id
+	return id
+}
+
+func (s *PprofSink) functionID(f pprofFunction) uint64 {
+	if id, ok := s.functionIDs[f]; ok {
+		return id
+	}
+	s.functions = append(s.functions, f)
+	id := uint64(len(s.functions))
+	s.functionIDs[f] = id
+	return id
+}
+
+func (s *PprofSink) mappingID(mod Module) uint64 {
+	// The ID a module is given in the markup is only meaningful within one
+	// process.
+	mod.Id = 0
+	if id, ok := s.mappingIDs[mod]; ok {
+		return id
+	}
+	s.mappings = append(s.mappings, mod)
+	id := uint64(len(s.mappings))
+	s.mappingIDs[mod] = id
+	return id
+}
+
+func (s *PprofSink) stringIndex(str string) uint64 {
+	if i, ok := s.stringIndices[str]; ok {
+		return uint64(i)
+	}
+	i := int64(len(s.strings))
+	s.strings = append(s.strings, str)
+	s.stringIndices[str] = i
+	return uint64(i)
+}
+
+// Field numbers of the messages in
+// https://github.com/google/pprof/blob/main/proto/profile.proto.
+const (
+	profileSampleType  = 1
+	profileSample      = 2
+	profileMapping     = 3
+	profileLocation    = 4
+	profileFunction    = 5
+	profileStringTable = 6
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	mappingID              = 1
+	mappingFilename        = 5
+	mappingBuildID         = 6
+	mappingHasFunctions    = 7
+	mappingHasFilenames    = 8
+	mappingHasLineNumbers  = 9
+	mappingHasInlineFrames = 10
+
+	locationID        = 1
+	locationMappingID = 2
+	locationAddress   = 3
+	locationLine      = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+)
+
+// encode returns the profile as a serialized profile.proto message.
+func (s *PprofSink) encode() []byte {
+	var p protoBuffer
+
+	var valueType protoBuffer
+	valueType.uint64(valueTypeType, s.stringIndex("backtraces"))
+	valueType.uint64(valueTypeUnit, s.stringIndex("count"))
+	p.message(profileSampleType, valueType)
+
+	for _, sample := range s.samples {
+		var b protoBuffer
+		b.packed(sampleLocationID, sample.locationIDs)
+		b.packed(sampleValue, []uint64{uint64(sample.count)})
+		p.message(profileSample, b)
+	}
+	for i, mod := range s.mappings {
+		var b protoBuffer
+		b.uint64(mappingID, uint64(i+1))
+		b.uint64(mappingFilename, s.stringIndex(mod.Name))
+		b.uint64(mappingBuildID, s.stringIndex(mod.Build))
+		b.bool(mappingHasFunctions, true)
+		b.bool(mappingHasFilenames, true)
+		b.bool(mappingHasLineNumbers, true)
+		b.bool(mappingHasInlineFrames, true)
+		p.message(profileMapping, b)
+	}
+	for i, loc := range s.locations {
+		var b protoBuffer
+		b.uint64(locationID, uint64(i+1))
+		b.uint64(locationMappingID, loc.mappingID)
+		b.uint64(locationAddress, loc.address)
+		for _, line := range loc.lines {
+			var l protoBuffer
+			l.uint64(lineFunctionID, line[0])
+			l.uint64(lineLine, line[1])
+			b.message(locationLine, l)
+		}
+		p.message(profileLocation, b)
+	}
+	for i, f := range s.functions {
+		var b protoBuffer
+		b.uint64(functionID, uint64(i+1))
+		b.uint64(functionName, s.stringIndex(f.name))
+		b.uint64(functionSystemName, s.stringIndex(f.name))
+		b.uint64(functionFilename, s.stringIndex(f.file))
+		p.message(profileFunction, b)
+	}
+	// The string table is written last, as encoding the other messages adds
+	// to it.
+	for _, str := range s.strings {
+		p.string(profileStringTable, str)
+	}
+	return p.data
+}
+
+// protoBuffer encodes protocol buffer fields. Zero-valued scalar fields are
+// omitted, as in proto3.
+type protoBuffer struct {
+	data []byte
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuffer) key(field, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.varint(x)
+}
+
+func (b *protoBuffer) bool(field int, x bool) {
+	if x {
+		b.uint64(field, 1)
+	}
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *protoBuffer) string(field int, s string) {
+	b.bytes(field, []byte(s))
+}
+
+func (b *protoBuffer) packed(field int, xs []uint64) {
+	var p protoBuffer
+	for _, x := range xs {
+		p.varint(x)
+	}
+	b.bytes(field, p.data)
+}
+
+func (b *protoBuffer) message(field int, m protoBuffer) {
+	b.bytes(field, m.data)
+}
@@ -0,0 +1,168 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package symbolize
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type protoField struct {
+	num    int
+	varint uint64
+	bytes  []byte
+}
+
+// parseProto splits a serialized protocol buffer message into its fields.
+func parseProto(t *testing.T, data []byte) []protoField {
+	t.Helper()
+	var fields []protoField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("malformed field key")
+		}
+		data = data[n:]
+		f := protoField{num: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				t.Fatalf("malformed varint in field %d", f.num)
+			}
+			data = data[n:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				t.Fatalf("malformed length of field %d", f.num)
+			}
+			f.bytes = data[n : n+int(size)]
+			data = data[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d in field %d", key&7, f.num)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// parsePacked decodes a packed repeated field of varints.
+func parsePacked(t *testing.T, data []byte) []uint64 {
+	t.Helper()
+	var xs []uint64
+	for len(data) > 0 {
+		x, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("malformed packed varint")
+		}
+		xs = append(xs, x)
+		data = data[n:]
+	}
+	return xs
+}
+
+func TestPprofSink(t *testing.T) {
+	libc := Module{Name: "libc.so", Build: "4fcb712aa6387724a9f465a32cd8c14b", Id: 1}
+	pow := Frame{Num: 0, Addr: 0x12388680, Module: libc, ModRelAddr: 0x43680, Locations: []Location{{Function: "pow", File: "pow.c", Line: 23}}}
+	atan2 := Frame{Num: 1, Addr: 0x123879c0, Module: libc, ModRelAddr: 0x429c0, Locations: []Location{
+		{Function: "__DOUBLE_FLOAT", File: "math.h", Line: 51},
+		{Function: "atan2", File: "atan2.c", Line: 49},
+	}}
+	// The same module loaded elsewhere by another process.
+	relocated := pow
+	relocated.Addr = 0x22388680
+	relocated.Module.Id = 2
+	unknown := Frame{Num: 0, Addr: 0xdeadbeef, ModRelAddr: 0xdeadbeef}
+
+	var buf bytes.Buffer
+	sink := NewPprofSink(&buf)
+	for _, frame := range []Frame{pow, atan2, relocated, atan2, unknown, pow} {
+		if err := sink.WriteFrame(frame); err != nil {
+			t.Fatalf("WriteFrame() = %s", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() = %s", err)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() = %s", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("failed to decompress profile: %s", err)
+	}
+
+	type sample struct {
+		LocationIDs []uint64
+		Values      []uint64
+	}
+	var samples []sample
+	var strs []string
+	counts := make(map[int]int)
+	for _, f := range parseProto(t, data) {
+		counts[f.num]++
+		switch f.num {
+		case profileSample:
+			var s sample
+			for _, sf := range parseProto(t, f.bytes) {
+				switch sf.num {
+				case sampleLocationID:
+					s.LocationIDs = parsePacked(t, sf.bytes)
+				case sampleValue:
+					s.Values = parsePacked(t, sf.bytes)
+				}
+			}
+			samples = append(samples, s)
+		case profileStringTable:
+			strs = append(strs, string(f.bytes))
+		}
+	}
+
+	// Frames are numbered in their backtrace, so the profile holds three
+	// backtraces, two of which are the same.
+	wantSamples := []sample{
+		{LocationIDs: []uint64{1, 2}, Values: []uint64{2}},
+		{LocationIDs: []uint64{3}, Values: []uint64{1}},
+		{LocationIDs: []uint64{1}, Values: []uint64{1}},
+	}
+	if diff := cmp.Diff(wantSamples, samples); diff != "" {
+		t.Errorf("unexpected samples (-want +got):\n%s", diff)
+	}
+	wantCounts := map[int]int{
+		profileSampleType: 1,
+		profileSample:     3,
+		profileMapping:    1,
+		profileLocation:   3,
+		profileFunction:   3,
+	}
+	for num, want := range wantCounts {
+		if counts[num] != want {
+			t.Errorf("got %d instances of field %d, want %d", counts[num], num, want)
+		}
+	}
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("string table must start with the empty string, got %q", strs)
+	}
+	wantStrs := map[string]bool{
+		"backtraces": true, "count": true, "libc.so": true, "4fcb712aa6387724a9f465a32cd8c14b": true,
+		"pow": true, "pow.c": true, "__DOUBLE_FLOAT": true, "math.h": true, "atan2": true, "atan2.c": true,
+	}
+	for _, s := range strs[1:] {
+		if !wantStrs[s] {
+			t.Errorf("unexpected string %q in string table", s)
+		}
+		delete(wantStrs, s)
+	}
+	for s := range wantStrs {
+		t.Errorf("string %q is missing from string table", s)
+	}
+}
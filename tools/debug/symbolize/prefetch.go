@@ -0,0 +1,90 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package symbolize
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/retry"
+)
+
+// PrefetchOptions configures Prefetch.
+type PrefetchOptions struct {
+	// Parallelism is the maximum number of build IDs fetched at once. It
+	// defaults to the number of CPUs.
+	Parallelism int
+
+	// Backoff returns the policy for retrying a failed fetch. Each build ID
+	// gets its own backoff. If nil, fetches are not retried.
+	Backoff func() retry.Backoff
+}
+
+// PrefetchResult is the result of fetching a single build ID.
+type PrefetchResult struct {
+	// File is the debug binary, if it was found. It must be closed by the
+	// caller.
+	File FileCloser
+
+	// Err is the error from the last attempt to fetch the binary, if it
+	// could not be found.
+	Err error
+}
+
+// Prefetch fetches the debug binaries for a batch of build IDs from repo,
+// which is useful for repositories whose GetBuildObject makes slow network
+// requests. Duplicate build IDs are only fetched once. The returned map has a
+// result for each distinct build ID.
+func Prefetch(ctx context.Context, repo Repository, buildIDs []string, opts PrefetchOptions) map[string]PrefetchResult {
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+	newBackoff := opts.Backoff
+	if newBackoff == nil {
+		newBackoff = func() retry.Backoff {
+			return retry.WithMaxAttempts(retry.NewConstantBackoff(0), 1)
+		}
+	}
+
+	seen := make(map[string]struct{})
+	var unique []string
+	for _, buildID := range buildIDs {
+		if _, ok := seen[buildID]; !ok {
+			seen[buildID] = struct{}{}
+			unique = append(unique, buildID)
+		}
+	}
+
+	results := make(map[string]PrefetchResult, len(unique))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallelism)
+	for _, buildID := range unique {
+		wg.Add(1)
+		go func(buildID string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			var result PrefetchResult
+			result.Err = retry.Retry(ctx, newBackoff(), func() error {
+				var err error
+				result.File, err = repo.GetBuildObject(buildID)
+				return err
+			}, nil)
+			if result.Err != nil {
+				result.File = nil
+			}
+
+			mu.Lock()
+			results[buildID] = result
+			mu.Unlock()
+		}(buildID)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package symbolize
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/retry"
+)
+
+// flakyRepo fails the first attempts at each build ID, and never finds
+// build IDs that aren't in files.
+type flakyRepo struct {
+	failures int
+	files    map[string]string
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func (r *flakyRepo) GetBuildObject(buildID string) (FileCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts[buildID]++
+	file, ok := r.files[buildID]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", buildID)
+	}
+	if r.attempts[buildID] <= r.failures {
+		return nil, fmt.Errorf("transient failure fetching %s", buildID)
+	}
+	return NopFileCloser(file), nil
+}
+
+func TestPrefetch(t *testing.T) {
+	repo := &flakyRepo{
+		failures: 1,
+		files: map[string]string{
+			"aaaa": "/aaaa.debug",
+			"bbbb": "/bbbb.debug",
+		},
+		attempts: make(map[string]int),
+	}
+	opts := PrefetchOptions{
+		Parallelism: 2,
+		Backoff: func() retry.Backoff {
+			return retry.WithMaxAttempts(retry.NewConstantBackoff(0), 3)
+		},
+	}
+	results := Prefetch(context.Background(), repo, []string{"aaaa", "bbbb", "aaaa", "cccc", "aaaa"}, opts)
+
+	if len(results) != 3 {
+		t.Errorf("got %d results, want 3: %v", len(results), results)
+	}
+	for buildID, want := range repo.files {
+		result := results[buildID]
+		if result.Err != nil {
+			t.Errorf("Prefetch failed for %s: %s", buildID, result.Err)
+		} else if got := result.File.String(); got != want {
+			t.Errorf("got %s for %s, want %s", got, buildID, want)
+		}
+	}
+	if result := results["cccc"]; result.Err == nil || result.File != nil {
+		t.Errorf("got %+v for a missing build ID, want an error", result)
+	}
+
+	// Each build ID was only fetched once despite duplicates, with one retry
+	// after the transient failure, and missing ones used all their attempts.
+	want := map[string]int{"aaaa": 2, "bbbb": 2, "cccc": 3}
+	for buildID, n := range want {
+		if got := repo.attempts[buildID]; got != n {
+			t.Errorf("got %d attempts for %s, want %d", got, buildID, n)
+		}
+	}
+}
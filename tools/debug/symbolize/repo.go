@@ -238,18 +238,41 @@ func (c *CompositeRepo) GetBuildObject(buildID string) (FileCloser, error) {
 	return nil, fmt.Errorf("could not find file for %s: %v", buildID, err)
 }
 
-type NewBuildIDRepo string
+// BuildIDRepo is a Repository backed by a .build-id directory, which holds
+// each debug binary at <dir>/<first two hex digits>/<rest>.debug.
+type BuildIDRepo struct {
+	dir   string
+	index *BuildIDIndex
+}
+
+// NewBuildIDRepo returns a BuildIDRepo for the .build-id directory dir.
+func NewBuildIDRepo(dir string) *BuildIDRepo {
+	return &BuildIDRepo{dir: dir}
+}
 
-func (b NewBuildIDRepo) GetBuildObject(buildID string) (FileCloser, error) {
+// SetIndex sets a BuildIDIndex used to skip verifying the build IDs of debug
+// binaries that were already verified and have not changed since. The index
+// may be shared between repositories.
+func (b *BuildIDRepo) SetIndex(index *BuildIDIndex) {
+	b.index = index
+}
+
+func (b *BuildIDRepo) GetBuildObject(buildID string) (FileCloser, error) {
 	if len(buildID) < 4 {
 		return nil, errors.New("build ID must be the hex representation of at least 2 bytes")
 	}
 	bin := elflib.BinaryFileRef{
-		Filepath: filepath.Join(string(b), buildID[:2], buildID[2:]) + ".debug",
+		Filepath: filepath.Join(b.dir, buildID[:2], buildID[2:]) + ".debug",
 		BuildID:  buildID,
 	}
+	if b.index != nil && b.index.lookup(bin.Filepath, buildID) {
+		return NopFileCloser(bin.Filepath), nil
+	}
 	if err := bin.Verify(); err != nil {
 		return nil, err
 	}
+	if b.index != nil {
+		b.index.add(bin.Filepath, buildID)
+	}
 	return NopFileCloser(bin.Filepath), nil
 }
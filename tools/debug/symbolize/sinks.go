@@ -0,0 +1,74 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package symbolize
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// JSONSink is a FrameSink that writes each frame to a stream as a JSON object
+// on its own line.
+type JSONSink struct {
+	enc *json.Encoder
+}
+
+// NewJSONSink returns a JSONSink that writes to out.
+func NewJSONSink(out io.Writer) *JSONSink {
+	return &JSONSink{enc: json.NewEncoder(out)}
+}
+
+func (s *JSONSink) WriteFrame(frame Frame) error {
+	return s.enc.Encode(frame)
+}
+
+func (s *JSONSink) Close() error {
+	return nil
+}
+
+// TextSink is a FrameSink that writes frames in the same format as
+// BacktracePresenter, with inlined functions on separate lines.
+type TextSink struct {
+	out io.Writer
+}
+
+// NewTextSink returns a TextSink that writes to out.
+func NewTextSink(out io.Writer) *TextSink {
+	return &TextSink{out: out}
+}
+
+func (s *TextSink) WriteFrame(frame Frame) error {
+	if len(frame.Locations) == 0 {
+		_, err := fmt.Fprintf(s.out, "    #%-4d %#016x in <%s>+%#x %s\n", frame.Num, frame.Addr, frame.Module.Name, frame.ModRelAddr, frame.Message)
+		return err
+	}
+	for i, loc := range frame.Locations {
+		i = len(frame.Locations) - i - 1
+		frameStr := fmt.Sprintf("#%d", frame.Num)
+		if i != 0 {
+			frameStr = fmt.Sprintf("#%d.%d", frame.Num, i)
+		}
+		line := fmt.Sprintf("    %-5s %#016x", frameStr, frame.Addr)
+		if loc.Function != "" {
+			line += fmt.Sprintf(" in %s", loc.Function)
+		}
+		if loc.File != "" {
+			line += fmt.Sprintf(" %s:%d", loc.File, loc.Line)
+		}
+		line += fmt.Sprintf(" <%s>+%#x", frame.Module.Name, frame.ModRelAddr)
+		if frame.Message != "" {
+			line += " " + frame.Message
+		}
+		if _, err := fmt.Fprintln(s.out, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TextSink) Close() error {
+	return nil
+}
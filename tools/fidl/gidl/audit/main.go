@@ -10,7 +10,6 @@ import (
 	"os"
 	"path/filepath"
 
-	"go.fuchsia.dev/fuchsia/tools/fidl/gidl/config"
 	"go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
 	"go.fuchsia.dev/fuchsia/tools/fidl/gidl/parser"
 )
@@ -50,6 +49,7 @@ var allWireFormats = []ir.WireFormat{
 type auditFlags struct {
 	corpusName *string
 	language   *string
+	matrix     *bool
 }
 
 func (f auditFlags) valid() bool {
@@ -60,8 +60,8 @@ func (f auditFlags) valid() bool {
 	if _, ok := corpusLanguages[*f.corpusName]; !ok {
 		panic("corpus listed in corpusPaths but not corpusLanguages")
 	}
-	if *f.language == "" {
-		fmt.Printf("-language must be specified\n")
+	if *f.language == "" && !*f.matrix {
+		fmt.Printf("-language or -matrix must be specified\n")
 		return false
 	}
 	return true
@@ -70,6 +70,8 @@ func (f auditFlags) valid() bool {
 var flags = auditFlags{
 	corpusName: flag.String("corpus", "conformance", "corpus name (conformance or benchmark)"),
 	language:   flag.String("language", "", "language to filter to"),
+	matrix: flag.Bool("matrix", false,
+		"print a CSV matrix of whether each test runs for each language of the corpus, or why it is excluded"),
 }
 
 func main() {
@@ -94,6 +96,14 @@ func main() {
 	}
 	all := parseAllGidlIr(gidlFiles)
 
+	if *flags.matrix {
+		if err := writeMatrix(os.Stdout, all, corpusLanguages[*flags.corpusName]); err != nil {
+			fmt.Printf("failed to write the coverage matrix: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	filtered := filter(all, *flags.language)
 
 	fmt.Printf("Disabled tests for %s\n", *flags.language)
@@ -166,13 +176,7 @@ func parseAllGidlIr(paths []string) ir.All {
 
 func filter(input ir.All, language string) ir.All {
 	shouldKeep := func(allowlist *ir.LanguageList, denylist *ir.LanguageList) bool {
-		if denylist != nil && denylist.Includes(language) {
-			return true
-		}
-		if allowlist != nil {
-			return !allowlist.Includes(language)
-		}
-		return ir.LanguageList(config.DefaultBindingsDenylist).Includes(language)
+		return ir.ExclusionForBinding(language, allowlist, denylist) != ir.NotExcluded
 	}
 	var output ir.All
 	for _, def := range input.EncodeSuccess {
@@ -0,0 +1,66 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"io"
+
+	"go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+)
+
+const included = "included"
+
+type matrixRow struct {
+	kind, name          string
+	allowlist, denylist *ir.LanguageList
+}
+
+func matrixRows(all ir.All) []matrixRow {
+	var rows []matrixRow
+	for _, t := range all.EncodeSuccess {
+		rows = append(rows, matrixRow{"encode_success", t.Name, t.BindingsAllowlist, t.BindingsDenylist})
+	}
+	for _, t := range all.DecodeSuccess {
+		rows = append(rows, matrixRow{"decode_success", t.Name, t.BindingsAllowlist, t.BindingsDenylist})
+	}
+	for _, t := range all.EncodeFailure {
+		rows = append(rows, matrixRow{"encode_failure", t.Name, t.BindingsAllowlist, t.BindingsDenylist})
+	}
+	for _, t := range all.DecodeFailure {
+		rows = append(rows, matrixRow{"decode_failure", t.Name, t.BindingsAllowlist, t.BindingsDenylist})
+	}
+	for _, t := range all.Benchmark {
+		rows = append(rows, matrixRow{"benchmark", t.Name, t.BindingsAllowlist, t.BindingsDenylist})
+	}
+	return rows
+}
+
+// writeMatrix writes a CSV coverage matrix with a row per test and a column
+// per language. Each cell is either "included" or the reason the test is
+// excluded for the language (see ir.Exclusion). The rows are in the order of
+// the tests in all, grouped by kind, so failure tests can be told apart from
+// success tests.
+func writeMatrix(w io.Writer, all ir.All, languages []string) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(append([]string{"kind", "name"}, languages...)); err != nil {
+		return err
+	}
+	for _, row := range matrixRows(all) {
+		record := []string{row.kind, row.name}
+		for _, language := range languages {
+			cell := included
+			if exclusion := ir.ExclusionForBinding(language, row.allowlist, row.denylist); exclusion != ir.NotExcluded {
+				cell = string(exclusion)
+			}
+			record = append(record, cell)
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,39 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+)
+
+func TestWriteMatrix(t *testing.T) {
+	all := ir.All{
+		EncodeSuccess: []ir.EncodeSuccess{
+			{Name: "Everywhere"},
+			{Name: "NotInA", BindingsDenylist: &ir.LanguageList{"a"}},
+		},
+		DecodeFailure: []ir.DecodeFailure{
+			{Name: "OnlyInB", BindingsAllowlist: &ir.LanguageList{"b"}},
+			{Name: "DeniedInB", BindingsAllowlist: &ir.LanguageList{"b"}, BindingsDenylist: &ir.LanguageList{"b"}},
+		},
+	}
+
+	var b strings.Builder
+	if err := writeMatrix(&b, all, []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `kind,name,a,b
+encode_success,Everywhere,included,included
+encode_success,NotInA,denylist,included
+decode_failure,OnlyInB,allowlist,included
+decode_failure,DeniedInB,allowlist,denylist
+`
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
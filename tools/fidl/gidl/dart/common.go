@@ -14,6 +14,17 @@ import (
 	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
 )
 
+// dependencyPackages returns the packages of the libraries that the
+// conformance library depends on, e.g. "fidl_test_dependency". Types are
+// referred to by their unqualified names, so they are imported unprefixed.
+func dependencyPackages(fidl fidlgen.Root) []string {
+	var packages []string
+	for _, lib := range gidlmixer.DependencyLibraries(fidl) {
+		packages = append(packages, "fidl_"+strings.ReplaceAll(lib.Name, ".", "_"))
+	}
+	return packages
+}
+
 func buildHandleDefs(defs []gidlir.HandleDef) string {
 	if len(defs) == 0 {
 		return ""
@@ -25,6 +25,7 @@ var (
 )
 
 type tmplInput struct {
+	DependencyPackages []string
 	EncodeSuccessCases []encodeSuccessCase
 	DecodeSuccessCases []decodeSuccessCase
 	EncodeFailureCases []encodeFailureCase
@@ -68,6 +69,7 @@ func GenerateConformanceTests(gidl gidlir.All, fidl fidlgen.Root, config gidlcon
 	}
 	var buf bytes.Buffer
 	err = conformanceTmpl.Execute(&buf, tmplInput{
+		DependencyPackages: dependencyPackages(fidl),
 		EncodeSuccessCases: encodeSuccessCases,
 		DecodeSuccessCases: decodeSuccessCases,
 		EncodeFailureCases: encodeFailureCases,
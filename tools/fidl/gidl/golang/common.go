@@ -40,6 +40,27 @@ func (w withGoFmt) Execute(wr io.Writer, data interface{}) error {
 	return err
 }
 
+// dependencyImport is the import of the Go bindings of a library that the
+// conformance library depends on.
+type dependencyImport struct {
+	// Path is the import path, e.g. "fidl/test/dependency".
+	Path string
+	// Type is a type in the package, used to keep the import from being
+	// unused.
+	Type string
+}
+
+func dependencyImports(fidl fidlgen.Root) []dependencyImport {
+	var imports []dependencyImport
+	for _, lib := range gidlmixer.DependencyLibraries(fidl) {
+		imports = append(imports, dependencyImport{
+			Path: "fidl/" + strings.ReplaceAll(strings.ToLower(lib.Name), ".", "/"),
+			Type: identifierName(lib.Decl),
+		})
+	}
+	return imports
+}
+
 func buildBytes(bytes []byte) string {
 	var builder strings.Builder
 	builder.WriteString("[]byte{\n")
@@ -25,6 +25,7 @@ var (
 )
 
 type conformanceTmplInput struct {
+	DependencyImports  []dependencyImport
 	EncodeSuccessCases []encodeSuccessCase
 	DecodeSuccessCases []decodeSuccessCase
 	EncodeFailureCases []encodeFailureCase
@@ -69,6 +70,7 @@ func GenerateConformanceTests(gidl gidlir.All, fidl fidlgen.Root, config gidlcon
 		return nil, err
 	}
 	input := conformanceTmplInput{
+		DependencyImports:  dependencyImports(fidl),
 		EncodeSuccessCases: encodeSuccessCases,
 		DecodeSuccessCases: decodeSuccessCases,
 		EncodeFailureCases: encodeFailureCases,
@@ -0,0 +1,67 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package golang
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"text/template"
+
+	gidlconfig "go.fuchsia.dev/fuchsia/tools/fidl/gidl/config"
+	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+	gidlmixer "go.fuchsia.dev/fuchsia/tools/fidl/gidl/mixer"
+	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+var (
+	//go:embed round_trip.tmpl
+	roundTripTmplText string
+
+	roundTripTmpl = template.Must(template.New("roundTripTmpl").Parse(roundTripTmplText))
+)
+
+type roundTripTmplInput struct {
+	DependencyImports []dependencyImport
+	RoundTripCases    []roundTripCase
+}
+
+type roundTripCase struct {
+	Name, Context, Type, Bytes string
+}
+
+// GenerateRoundTripTests generates Go tests that decode the bytes of each
+// success case and check that re-encoding the decoded value reproduces them.
+// The output is meant to be compiled in the same package as the output of
+// GenerateConformanceTests.
+func GenerateRoundTripTests(gidl gidlir.All, fidl fidlgen.Root, config gidlconfig.GeneratorConfig) ([]byte, error) {
+	schema := gidlmixer.BuildSchema(fidl)
+	input := roundTripTmplInput{DependencyImports: dependencyImports(fidl)}
+	for _, decodeSuccess := range gidlir.RoundTripCases(gidl) {
+		// Decoded handles would have to be moved back out of the value to be
+		// re-encoded, which the one-way tests already cover.
+		if len(decodeSuccess.HandleDefs) != 0 {
+			continue
+		}
+		decl, err := schema.ExtractDeclaration(decodeSuccess.Value, decodeSuccess.HandleDefs)
+		if err != nil {
+			return nil, fmt.Errorf("round trip %s: %s", decodeSuccess.Name, err)
+		}
+		for _, encoding := range decodeSuccess.Encodings {
+			if !wireFormatSupported(encoding.WireFormat) {
+				continue
+			}
+			input.RoundTripCases = append(input.RoundTripCases, roundTripCase{
+				Name:    testCaseName(decodeSuccess.Name, encoding.WireFormat),
+				Context: marshalerContext(encoding.WireFormat),
+				Type:    declName(decl),
+				Bytes:   buildBytes(encoding.Bytes),
+			})
+		}
+	}
+	var buf bytes.Buffer
+	err := withGoFmt{roundTripTmpl}.Execute(&buf, input)
+	return buf.Bytes(), err
+}
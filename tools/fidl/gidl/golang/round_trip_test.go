@@ -0,0 +1,116 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package golang
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	gidlconfig "go.fuchsia.dev/fuchsia/tools/fidl/gidl/config"
+	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+// roundTripFidl declares the empty struct used by the round trip test cases.
+const roundTripFidl = `{
+	"name": "test.conformance",
+	"struct_declarations": [{"name": "test.conformance/EmptyStruct", "members": []}]
+}`
+
+func generateRoundTripTests(t *testing.T, gidl gidlir.All) string {
+	t.Helper()
+	var fidl fidlgen.Root
+	if err := json.Unmarshal([]byte(roundTripFidl), &fidl); err != nil {
+		t.Fatal(err)
+	}
+	out, err := GenerateRoundTripTests(gidl, fidl, gidlconfig.GeneratorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// roundTripCase returns the encode and decode success cases that a
+// bidirectional "success" test is split into.
+func roundTripCase(name string, bytes []byte) (gidlir.EncodeSuccess, gidlir.DecodeSuccess) {
+	value := gidlir.Record{Name: "EmptyStruct"}
+	encodeSuccess := gidlir.EncodeSuccess{
+		Name:      name,
+		Value:     value,
+		Encodings: []gidlir.HandleDispositionEncoding{{WireFormat: gidlir.V2WireFormat, Bytes: bytes}},
+	}
+	decodeSuccess := gidlir.DecodeSuccess{
+		Name:      name,
+		Value:     value,
+		Encodings: []gidlir.Encoding{{WireFormat: gidlir.V2WireFormat, Bytes: bytes}},
+	}
+	return encodeSuccess, decodeSuccess
+}
+
+var emptyStructBytes = []byte{0, 0, 0, 0, 0, 0, 0, 0}
+
+func TestGenerateRoundTripTests(t *testing.T) {
+	encodeSuccess, decodeSuccess := roundTripCase("Success", emptyStructBytes)
+	out := generateRoundTripTests(t, gidlir.All{
+		EncodeSuccess: []gidlir.EncodeSuccess{encodeSuccess},
+		DecodeSuccess: []gidlir.DecodeSuccess{decodeSuccess},
+	})
+	for _, want := range []string{
+		`name := "Success_v2"`,
+		"var value conformance.EmptyStruct",
+		"fidl.MarshalerContext{UseV2WireFormat: true}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestGenerateRoundTripTestsSkipsCases(t *testing.T) {
+	// Only decoded, so the bytes needn't be the value's encoding.
+	_, decodeOnly := roundTripCase("DecodeOnly", emptyStructBytes)
+	// Decoded as different bytes than those it's encoded as.
+	mismatchedEncode, mismatchedDecode := roundTripCase("Mismatched", emptyStructBytes)
+	mismatchedDecode.Encodings[0].Bytes = []byte{0, 0, 0, 0, 0, 0, 0, 1}
+	handlesEncode, handlesDecode := roundTripCase("Handles", emptyStructBytes)
+	handlesDecode.HandleDefs = []gidlir.HandleDef{{Subtype: fidlgen.HandleSubtypeEvent}}
+
+	out := generateRoundTripTests(t, gidlir.All{
+		EncodeSuccess: []gidlir.EncodeSuccess{mismatchedEncode, handlesEncode},
+		DecodeSuccess: []gidlir.DecodeSuccess{decodeOnly, mismatchedDecode, handlesDecode},
+	})
+	for _, unwanted := range []string{"DecodeOnly", "Mismatched", "Handles"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("output contains %q:\n%s", unwanted, out)
+		}
+	}
+}
+
+func TestGenerateRoundTripTestsImportsDependencies(t *testing.T) {
+	var fidl fidlgen.Root
+	if err := json.Unmarshal([]byte(`{
+		"name": "test.conformance",
+		"struct_declarations": [
+			{"name": "test.conformance/EmptyStruct", "members": []},
+			{"name": "test.dependency/DependencyStruct", "members": []}
+		],
+		"library_dependencies": [{"name": "test.dependency"}, {"name": "zx"}]
+	}`), &fidl); err != nil {
+		t.Fatal(err)
+	}
+	out, err := GenerateRoundTripTests(gidlir.All{}, fidl, gidlconfig.GeneratorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"fidl/test/dependency"`,
+		"type _ = dependency.DependencyStruct",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package golang
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"text/template"
+
+	gidlconfig "go.fuchsia.dev/fuchsia/tools/fidl/gidl/config"
+	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+	gidlmixer "go.fuchsia.dev/fuchsia/tools/fidl/gidl/mixer"
+	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+var (
+	//go:embed transport_benchmarks.tmpl
+	transportBenchmarkTmplText string
+
+	transportBenchmarkTmpl = template.Must(template.New("transportBenchmarkTmpl").Parse(transportBenchmarkTmplText))
+)
+
+// largeMessageSizes are the payload sizes, in bytes, of the raw channel
+// round-trip benchmarks. The last one is ZX_CHANNEL_MAX_MSG_BYTES.
+var largeMessageSizes = []int{1024, 8192, 32768, 65536}
+
+type transportBenchmarkTmplInput struct {
+	Benchmarks        []transportBenchmark
+	LargeMessageSizes []int
+}
+
+type transportBenchmark struct {
+	Name, ChromeperfPath, Value string
+}
+
+// GenerateTransportBenchmarks generates Go benchmarks that measure the cost of
+// moving messages over a channel, as opposed to encoding or decoding them.
+// The output is meant to be compiled in the same package as the output of
+// GenerateBenchmarks, which already measures sending events.
+func GenerateTransportBenchmarks(gidl gidlir.All, fidl fidlgen.Root, config gidlconfig.GeneratorConfig) ([]byte, error) {
+	schema := gidlmixer.BuildSchema(fidl)
+	input := transportBenchmarkTmplInput{
+		LargeMessageSizes: largeMessageSizes,
+	}
+	for _, gidlBenchmark := range gidl.Benchmark {
+		// Handles are consumed when a message is written to a channel, so
+		// values containing them cannot be resent on every iteration.
+		if len(gidlBenchmark.HandleDefs) != 0 {
+			continue
+		}
+		decl, err := schema.ExtractDeclaration(gidlBenchmark.Value, gidlBenchmark.HandleDefs)
+		if err != nil {
+			return nil, fmt.Errorf("benchmark %s: %s", gidlBenchmark.Name, err)
+		}
+		input.Benchmarks = append(input.Benchmarks, transportBenchmark{
+			Name:           goBenchmarkName(gidlBenchmark.Name),
+			ChromeperfPath: gidlBenchmark.Name,
+			Value:          visit(gidlBenchmark.Value, decl),
+		})
+	}
+	var buf bytes.Buffer
+	err := withGoFmt{transportBenchmarkTmpl}.Execute(&buf, input)
+	return buf.Bytes(), err
+}
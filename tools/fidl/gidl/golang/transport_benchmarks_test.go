@@ -0,0 +1,63 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package golang
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	gidlconfig "go.fuchsia.dev/fuchsia/tools/fidl/gidl/config"
+	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+func generateTransportBenchmarks(t *testing.T, gidl gidlir.All) string {
+	t.Helper()
+	out, err := GenerateTransportBenchmarks(gidl, fidlgen.Root{}, gidlconfig.GeneratorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "transport_benchmarks.go", out, 0); err != nil {
+		t.Fatalf("generated invalid Go: %s\n%s", err, out)
+	}
+	return string(out)
+}
+
+func TestGenerateTransportBenchmarksLargeMessages(t *testing.T) {
+	out := generateTransportBenchmarks(t, gidlir.All{})
+	for _, size := range largeMessageSizes {
+		for _, want := range []string{
+			fmt.Sprintf("func BenchmarkChannelRoundTripBytes%d(b *testing.B) {", size),
+			fmt.Sprintf("\"Transport/ChannelRoundTrip/Bytes%d\"", size),
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("output doesn't contain %q:\n%s", want, out)
+			}
+		}
+	}
+}
+
+func TestGenerateTransportBenchmarksSkipsHandles(t *testing.T) {
+	out := generateTransportBenchmarks(t, gidlir.All{
+		Benchmark: []gidlir.Benchmark{{
+			Name:                     "Channel",
+			HandleDefs:               []gidlir.HandleDef{{Subtype: fidlgen.HandleSubtypeChannel}},
+			EnableSendEventBenchmark: true,
+		}},
+	})
+	for _, unwanted := range []string{
+		"BenchmarkChannelRoundTripChannel",
+		"Transport/ChannelRoundTrip/Channel",
+		// Sending events is measured by GenerateBenchmarks.
+		"SendEvent",
+	} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("output contains %q:\n%s", unwanted, out)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package golden generates a text listing of the canonical encoding of every
+// GIDL success case. The listing is checked in so that changes to encoders,
+// and to the GIDL files themselves, show up in review as byte-level diffs.
+package golden
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	gidlconfig "go.fuchsia.dev/fuchsia/tools/fidl/gidl/config"
+	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+const header = `# Canonical encodings of the GIDL success cases.
+# Generated by gidl -type golden. DO NOT EDIT.
+`
+
+// Bytes are listed 8 per line, the FIDL alignment, so that out-of-line
+// objects start on a new line.
+const bytesPerLine = 8
+
+type goldenCase struct {
+	name       string
+	wireFormat gidlir.WireFormat
+	body       string
+}
+
+// GenerateGoldens lists, for each encode success case and wire format, the
+// encoded bytes and handle dispositions. The output is sorted by case name and
+// wire format, so it doesn't depend on the order of the GIDL files.
+func GenerateGoldens(gidl gidlir.All, fidl fidlgen.Root, config gidlconfig.GeneratorConfig) ([]byte, error) {
+	var cases []goldenCase
+	for _, encodeSuccess := range gidl.EncodeSuccess {
+		for _, encoding := range encodeSuccess.Encodings {
+			body, err := formatEncoding(encoding, encodeSuccess.HandleDefs)
+			if err != nil {
+				return nil, fmt.Errorf("%s (%s): %w", encodeSuccess.Name, encoding.WireFormat, err)
+			}
+			cases = append(cases, goldenCase{
+				name:       encodeSuccess.Name,
+				wireFormat: encoding.WireFormat,
+				body:       body,
+			})
+		}
+	}
+	sort.SliceStable(cases, func(i, j int) bool {
+		if cases[i].name != cases[j].name {
+			return cases[i].name < cases[j].name
+		}
+		return cases[i].wireFormat < cases[j].wireFormat
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	for _, c := range cases {
+		fmt.Fprintf(&buf, "\n%s %s\n%s", c.name, c.wireFormat, c.body)
+	}
+	return buf.Bytes(), nil
+}
+
+func formatEncoding(encoding gidlir.HandleDispositionEncoding, defs []gidlir.HandleDef) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "  bytes (%d):\n", len(encoding.Bytes))
+	for i := 0; i < len(encoding.Bytes); i += bytesPerLine {
+		end := i + bytesPerLine
+		if end > len(encoding.Bytes) {
+			end = len(encoding.Bytes)
+		}
+		b.WriteString("   ")
+		for _, v := range encoding.Bytes[i:end] {
+			fmt.Fprintf(&b, " %02x", v)
+		}
+		b.WriteString("\n")
+	}
+	if len(encoding.HandleDispositions) == 0 {
+		return b.String(), nil
+	}
+	b.WriteString("  handle_dispositions:\n")
+	for _, hd := range encoding.HandleDispositions {
+		if int(hd.Handle) < 0 || int(hd.Handle) >= len(defs) {
+			return "", fmt.Errorf("handle #%d is not defined", hd.Handle)
+		}
+		fmt.Fprintf(&b, "    #%d %s type=%d rights=%#x\n",
+			hd.Handle, defs[hd.Handle].Subtype, uint32(hd.Type), uint32(hd.Rights))
+	}
+	return b.String(), nil
+}
+
+// parseGoldens splits the output of GenerateGoldens into its cases, keyed by
+// their "<name> <wire format>" line.
+func parseGoldens(content []byte) map[string]string {
+	cases := make(map[string]string)
+	for _, block := range strings.Split(string(content), "\n\n")[1:] {
+		key, body, _ := strings.Cut(strings.TrimSuffix(block, "\n"), "\n")
+		cases[key] = body + "\n"
+	}
+	return cases
+}
+
+// Diff compares goldens generated by GenerateGoldens, returning a description
+// of the cases that were added, removed or changed in got relative to want, or
+// the empty string if there are no differences.
+func Diff(want, got []byte) string {
+	if bytes.Equal(want, got) {
+		return ""
+	}
+	wantCases, gotCases := parseGoldens(want), parseGoldens(got)
+	var keys []string
+	for key := range wantCases {
+		keys = append(keys, key)
+	}
+	for key := range gotCases {
+		if _, ok := wantCases[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		wantBody, inWant := wantCases[key]
+		gotBody, inGot := gotCases[key]
+		switch {
+		case !inWant:
+			fmt.Fprintf(&b, "added %s\n%s", key, gotBody)
+		case !inGot:
+			fmt.Fprintf(&b, "removed %s\n%s", key, wantBody)
+		case wantBody != gotBody:
+			fmt.Fprintf(&b, "changed %s\n- want:\n%s- got:\n%s", key, wantBody, gotBody)
+		}
+	}
+	if b.Len() == 0 {
+		// Only the header differs.
+		return "the header differs; regenerate the goldens\n"
+	}
+	return b.String()
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package golden
+
+import (
+	"strings"
+	"testing"
+
+	gidlconfig "go.fuchsia.dev/fuchsia/tools/fidl/gidl/config"
+	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+func generate(t *testing.T, gidl gidlir.All) []byte {
+	t.Helper()
+	out, err := GenerateGoldens(gidl, fidlgen.Root{}, gidlconfig.GeneratorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestGenerateGoldens(t *testing.T) {
+	gidl := gidlir.All{
+		EncodeSuccess: []gidlir.EncodeSuccess{
+			{
+				Name: "StructWithHandle",
+				Encodings: []gidlir.HandleDispositionEncoding{{
+					WireFormat: gidlir.V2WireFormat,
+					Bytes:      []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0},
+					HandleDispositions: []gidlir.HandleDisposition{{
+						Handle: 0,
+						Type:   fidlgen.ObjectType(4),
+						Rights: fidlgen.HandleRights(3),
+					}},
+				}},
+				HandleDefs: []gidlir.HandleDef{{Subtype: fidlgen.HandleSubtypeChannel}},
+			},
+			{
+				Name: "String",
+				Encodings: []gidlir.HandleDispositionEncoding{
+					{
+						WireFormat: gidlir.V2WireFormat,
+						Bytes:      []byte{1, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 'a', 0, 0, 0, 0, 0, 0, 0},
+					},
+					{
+						WireFormat: gidlir.V1WireFormat,
+						Bytes:      []byte{1, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 'a', 0, 0, 0, 0, 0, 0, 0},
+					},
+				},
+			},
+		},
+	}
+
+	want := header + `
+String v1
+  bytes (24):
+    01 00 00 00 00 00 00 00
+    ff ff ff ff ff ff ff ff
+    61 00 00 00 00 00 00 00
+
+String v2
+  bytes (24):
+    01 00 00 00 00 00 00 00
+    ff ff ff ff ff ff ff ff
+    61 00 00 00 00 00 00 00
+
+StructWithHandle v2
+  bytes (8):
+    ff ff ff ff 00 00 00 00
+  handle_dispositions:
+    #0 channel type=4 rights=0x3
+`
+	if got := string(generate(t, gidl)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGenerateGoldensUndefinedHandle(t *testing.T) {
+	gidl := gidlir.All{
+		EncodeSuccess: []gidlir.EncodeSuccess{{
+			Name: "UndefinedHandle",
+			Encodings: []gidlir.HandleDispositionEncoding{{
+				WireFormat:         gidlir.V2WireFormat,
+				Bytes:              []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0},
+				HandleDispositions: []gidlir.HandleDisposition{{Handle: 1}},
+			}},
+		}},
+	}
+	if _, err := GenerateGoldens(gidl, fidlgen.Root{}, gidlconfig.GeneratorConfig{}); err == nil {
+		t.Errorf("got no error for an undefined handle")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	encodeSuccess := func(name string, bytes ...byte) gidlir.EncodeSuccess {
+		return gidlir.EncodeSuccess{
+			Name: name,
+			Encodings: []gidlir.HandleDispositionEncoding{{
+				WireFormat: gidlir.V2WireFormat,
+				Bytes:      bytes,
+			}},
+		}
+	}
+	want := generate(t, gidlir.All{
+		EncodeSuccess: []gidlir.EncodeSuccess{
+			encodeSuccess("Changed", 1, 0, 0, 0, 0, 0, 0, 0),
+			encodeSuccess("Removed", 2, 0, 0, 0, 0, 0, 0, 0),
+			encodeSuccess("Unchanged", 3, 0, 0, 0, 0, 0, 0, 0),
+		},
+	})
+
+	if diff := Diff(want, want); diff != "" {
+		t.Errorf("got a diff between identical goldens:\n%s", diff)
+	}
+
+	got := generate(t, gidlir.All{
+		EncodeSuccess: []gidlir.EncodeSuccess{
+			encodeSuccess("Added", 4, 0, 0, 0, 0, 0, 0, 0),
+			encodeSuccess("Changed", 5, 0, 0, 0, 0, 0, 0, 0),
+			encodeSuccess("Unchanged", 3, 0, 0, 0, 0, 0, 0, 0),
+		},
+	})
+	diff := Diff(want, got)
+	for _, line := range []string{"added Added v2", "changed Changed v2", "removed Removed v2"} {
+		if !strings.Contains(diff, line+"\n") {
+			t.Errorf("diff doesn't contain %q:\n%s", line, diff)
+		}
+	}
+	if strings.Contains(diff, "Unchanged") {
+		t.Errorf("diff mentions an unchanged case:\n%s", diff)
+	}
+}
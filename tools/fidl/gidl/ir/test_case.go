@@ -60,13 +60,14 @@ type DecodeFailure struct {
 }
 
 type Benchmark struct {
-	Name                     string
-	Value                    Record
-	HandleDefs               []HandleDef
-	BindingsAllowlist        *LanguageList
-	BindingsDenylist         *LanguageList
-	EnableSendEventBenchmark bool
-	EnableEchoCallBenchmark  bool
+	Name                      string
+	Value                     Record
+	HandleDefs                []HandleDef
+	BindingsAllowlist         *LanguageList
+	BindingsDenylist          *LanguageList
+	EnableSendEventBenchmark  bool
+	EnableEchoCallBenchmark   bool
+	EnableAllocationBenchmark bool
 }
 
 type LanguageList []string
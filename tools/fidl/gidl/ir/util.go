@@ -5,6 +5,7 @@
 package ir
 
 import (
+	"bytes"
 	"fmt"
 	"reflect"
 
@@ -33,18 +34,44 @@ func Merge(input []All) All {
 	return output
 }
 
+// Exclusion is the reason a test doesn't run for a binding.
+type Exclusion string
+
+const (
+	// NotExcluded means that the test runs for the binding.
+	NotExcluded Exclusion = ""
+	// ExcludedByDenylist means that the binding is in the test's
+	// bindings_denylist.
+	ExcludedByDenylist Exclusion = "denylist"
+	// ExcludedByAllowlist means that the test has a bindings_allowlist that
+	// doesn't include the binding.
+	ExcludedByAllowlist Exclusion = "allowlist"
+	// ExcludedByDefault means that the test has no bindings_allowlist and the
+	// binding is in config.DefaultBindingsDenylist.
+	ExcludedByDefault Exclusion = "default_denylist"
+)
+
+// ExclusionForBinding returns why a test with the given bindings allowlist and
+// denylist is excluded for binding, or NotExcluded if it runs.
+func ExclusionForBinding(binding string, allowlist *LanguageList, denylist *LanguageList) Exclusion {
+	if denylist != nil && denylist.Includes(binding) {
+		return ExcludedByDenylist
+	}
+	if allowlist != nil {
+		if allowlist.Includes(binding) {
+			return NotExcluded
+		}
+		return ExcludedByAllowlist
+	}
+	if LanguageList(config.DefaultBindingsDenylist).Includes(binding) {
+		return ExcludedByDefault
+	}
+	return NotExcluded
+}
+
 func FilterByBinding(input All, binding string) All {
 	shouldKeep := func(binding string, allowlist *LanguageList, denylist *LanguageList) bool {
-		if denylist != nil && denylist.Includes(binding) {
-			return false
-		}
-		if allowlist != nil {
-			return allowlist.Includes(binding)
-		}
-		if LanguageList(config.DefaultBindingsDenylist).Includes(binding) {
-			return false
-		}
-		return true
+		return ExclusionForBinding(binding, allowlist, denylist) == NotExcluded
 	}
 	var output All
 	for _, def := range input.EncodeSuccess {
@@ -84,17 +111,52 @@ func ValidateAllType(input All, generatorType string) {
 		}
 	}
 	switch generatorType {
-	case "conformance":
+	case "conformance", "round_trip":
 		forbid(input.Benchmark)
-	case "benchmark":
+	case "benchmark", "transport_benchmark":
 		forbid(input.EncodeSuccess, input.DecodeSuccess, input.EncodeFailure, input.DecodeFailure)
-	case "measure_tape":
+	case "measure_tape", "golden":
 		forbid(input.Benchmark)
 	default:
 		panic(fmt.Sprintf("unexpected generator type: %s", generatorType))
 	}
 }
 
+// RoundTripCases returns the decode success test cases whose bytes are also
+// the expected encoding of their value, i.e. those that come from "success"
+// tests rather than standalone "decode_success" tests. Decoding the bytes of
+// these cases and re-encoding the value must reproduce the bytes exactly.
+// Only encodings whose bytes match the encode success case are kept.
+func RoundTripCases(input All) []DecodeSuccess {
+	encodings := make(map[string]map[WireFormat][]byte)
+	for _, encodeSuccess := range input.EncodeSuccess {
+		byWireFormat := make(map[WireFormat][]byte)
+		for _, encoding := range encodeSuccess.Encodings {
+			byWireFormat[encoding.WireFormat] = encoding.Bytes
+		}
+		encodings[encodeSuccess.Name] = byWireFormat
+	}
+	var output []DecodeSuccess
+	for _, decodeSuccess := range input.DecodeSuccess {
+		byWireFormat, ok := encodings[decodeSuccess.Name]
+		if !ok {
+			continue
+		}
+		var kept []Encoding
+		for _, encoding := range decodeSuccess.Encodings {
+			if expected, ok := byWireFormat[encoding.WireFormat]; ok && bytes.Equal(expected, encoding.Bytes) {
+				kept = append(kept, encoding)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		decodeSuccess.Encodings = kept
+		output = append(output, decodeSuccess)
+	}
+	return output
+}
+
 // ContainsUnknownField returns if the value or any subvalue contains an unknown
 // field.
 // Intended to allow bindings that don't support unknown fields to skip test
@@ -31,12 +31,14 @@ type benchmark struct {
 	ValueBuild, ValueVar                                      string
 	HandleDefs                                                string
 	EnableSendEventBenchmark, EnableEchoCallBenchmark         bool
+	EnableAllocationBenchmark                                 bool
 }
 
 type benchmarkTmplInput struct {
-	FidlLibrary string
-	FidlInclude string
-	Benchmarks  []benchmark
+	FidlLibrary            string
+	FidlInclude            string
+	HasAllocationBenchmark bool
+	Benchmarks             []benchmark
 }
 
 // Generate generates Low-Level C++ benchmarks.
@@ -56,17 +58,19 @@ func GenerateBenchmarks(gidl gidlir.All, fidl fidlgen.Root, config gidlconfig.Ge
 		}
 		valBuild, valVar := libllcpp.BuildValueAllocator("allocator", gidlBenchmark.Value, decl, libllcpp.HandleReprRaw)
 		tmplInput.Benchmarks = append(tmplInput.Benchmarks, benchmark{
-			Path:                     gidlBenchmark.Name,
-			Name:                     benchmarkName(gidlBenchmark.Name),
-			Type:                     benchmarkTypeFromValue(config.CppBenchmarksFidlLibrary, gidlBenchmark.Value),
-			EventProtocolType:        benchmarkProtocolFromValue(config.CppBenchmarksFidlLibrary, gidlBenchmark.Value) + "EventProtocol",
-			EchoCallProtocolType:     benchmarkProtocolFromValue(config.CppBenchmarksFidlLibrary, gidlBenchmark.Value) + "EchoCall",
-			ValueBuild:               valBuild,
-			ValueVar:                 valVar,
-			HandleDefs:               libhlcpp.BuildHandleDefs(gidlBenchmark.HandleDefs),
-			EnableSendEventBenchmark: gidlBenchmark.EnableSendEventBenchmark,
-			EnableEchoCallBenchmark:  gidlBenchmark.EnableEchoCallBenchmark,
+			Path:                      gidlBenchmark.Name,
+			Name:                      benchmarkName(gidlBenchmark.Name),
+			Type:                      benchmarkTypeFromValue(config.CppBenchmarksFidlLibrary, gidlBenchmark.Value),
+			EventProtocolType:         benchmarkProtocolFromValue(config.CppBenchmarksFidlLibrary, gidlBenchmark.Value) + "EventProtocol",
+			EchoCallProtocolType:      benchmarkProtocolFromValue(config.CppBenchmarksFidlLibrary, gidlBenchmark.Value) + "EchoCall",
+			ValueBuild:                valBuild,
+			ValueVar:                  valVar,
+			HandleDefs:                libhlcpp.BuildHandleDefs(gidlBenchmark.HandleDefs),
+			EnableSendEventBenchmark:  gidlBenchmark.EnableSendEventBenchmark,
+			EnableEchoCallBenchmark:   gidlBenchmark.EnableEchoCallBenchmark,
+			EnableAllocationBenchmark: gidlBenchmark.EnableAllocationBenchmark,
 		})
+		tmplInput.HasAllocationBenchmark = tmplInput.HasAllocationBenchmark || gidlBenchmark.EnableAllocationBenchmark
 	}
 	var buf bytes.Buffer
 	if err := benchmarkTmpl.Execute(&buf, tmplInput); err != nil {
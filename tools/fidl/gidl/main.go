@@ -22,9 +22,11 @@ import (
 	gidldynfidl "go.fuchsia.dev/fuchsia/tools/fidl/gidl/dynfidl"
 	gidlcorpus "go.fuchsia.dev/fuchsia/tools/fidl/gidl/fuzzer_corpus"
 	gidlgolang "go.fuchsia.dev/fuchsia/tools/fidl/gidl/golang"
+	gidlgolden "go.fuchsia.dev/fuchsia/tools/fidl/gidl/golden"
 	gidlhlcpp "go.fuchsia.dev/fuchsia/tools/fidl/gidl/hlcpp"
 	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
 	gidlllcpp "go.fuchsia.dev/fuchsia/tools/fidl/gidl/llcpp"
+	gidlmixer "go.fuchsia.dev/fuchsia/tools/fidl/gidl/mixer"
 	gidlparser "go.fuchsia.dev/fuchsia/tools/fidl/gidl/parser"
 	gidlreference "go.fuchsia.dev/fuchsia/tools/fidl/gidl/reference"
 	gidlrust "go.fuchsia.dev/fuchsia/tools/fidl/gidl/rust"
@@ -64,14 +66,33 @@ var benchmarkGenerators = map[string]Generator{
 	"driver_llcpp": gidldriverllcpp.GenerateBenchmarks,
 }
 
+// Only Go implements transport benchmarks; other bindings have no benchmark
+// runner in this tree to run them.
+var transportBenchmarkGenerators = map[string]Generator{
+	"go": gidlgolang.GenerateTransportBenchmarks,
+}
+
+var roundTripGenerators = map[string]Generator{
+	"go":   gidlgolang.GenerateRoundTripTests,
+	"rust": gidlrust.GenerateRoundTripTests,
+}
+
 var measureTapeGenerators = map[string]Generator{
 	"rust": gidlrust.GenerateMeasureTapeTests,
 }
 
+// Goldens don't depend on the bindings, so there is a single "golden" language.
+var goldenGenerators = map[string]Generator{
+	"golden": gidlgolden.GenerateGoldens,
+}
+
 var allGenerators = map[string]map[string]Generator{
-	"conformance":  conformanceGenerators,
-	"benchmark":    benchmarkGenerators,
-	"measure_tape": measureTapeGenerators,
+	"conformance":         conformanceGenerators,
+	"benchmark":           benchmarkGenerators,
+	"transport_benchmark": transportBenchmarkGenerators,
+	"measure_tape":        measureTapeGenerators,
+	"round_trip":          roundTripGenerators,
+	"golden":              goldenGenerators,
 }
 
 var allGeneratorTypes = func() []string {
@@ -117,6 +138,7 @@ func (l *listOfStrings) Set(s string) error {
 // GIDLFlags stores the command-line flags for the GIDL program.
 type GIDLFlags struct {
 	JSONPath                   *string
+	DepJSONPaths               listOfStrings
 	Language                   *string
 	Type                       *string
 	Out                        *string
@@ -125,6 +147,7 @@ type GIDLFlags struct {
 	FuzzerCorpusHostDir        *string
 	FuzzerCorpusPackageDataDir *string
 	FilterTypes                listOfStrings
+	Verify                     *bool
 }
 
 // valid indicates whether the parsed Flags are valid to be used.
@@ -147,7 +170,10 @@ var flags = GIDLFlags{
 		"output directory for fuzzer_corpus"),
 	FuzzerCorpusPackageDataDir: flag.String("fuzzer-corpus-package-data-dir", "",
 		"directory to which fuzzer_corpus output files are mapped in their fuchsia package's data directory"),
-	FilterTypes: nil,
+	Verify: flag.Bool("verify", false,
+		"with -type golden, compare the output to the existing -out file instead of writing it, and fail if they differ"),
+	DepJSONPaths: nil,
+	FilterTypes:  nil,
 }
 
 func parseGidlIr(filename string) gidlir.All {
@@ -179,6 +205,7 @@ func parseFidlJSONIr(filename string) fidlgen.Root {
 }
 
 func main() {
+	flag.Var(&flags.DepJSONPaths, "dep-json", "relative path to the FIDL intermediate representation of a dependent library (repeatable)")
 	flag.Var(&flags.FilterTypes, "filter-type", "List of types to filter to (for measure tape backends)")
 	flag.Parse()
 
@@ -208,24 +235,22 @@ func main() {
 	for _, path := range flag.Args() {
 		parsedGidlFiles = append(parsedGidlFiles, parseGidlIr(path))
 	}
-	gidl := gidlir.FilterByBinding(gidlir.Merge(parsedGidlFiles), *flags.Language)
-
-	// For simplicity, we do not allow FIDL that GIDL depends on to have
-	// dependent libraries, with the exception of zx. This makes it much simpler
-	// to have everything in the IR, and avoid cross-references.
-
-	if len(ir.Libraries) == 1 && ir.Libraries[0].Name == "zx" {
-		ir.Libraries = make([]fidlgen.Library, 0)
+	gidl := gidlir.Merge(parsedGidlFiles)
+	if *flags.Type != "golden" {
+		// Goldens list every case, whichever bindings run it.
+		gidl = gidlir.FilterByBinding(gidl, *flags.Language)
 	}
 
-	if len(ir.Libraries) != 0 {
-		var libs []string
-		for _, l := range ir.Libraries {
-			libs = append(libs, string(l.Name))
-		}
-		panic(fmt.Sprintf(
-			"GIDL does not work with FIDL libraries with dependents, found: %s",
-			strings.Join(libs, ",")))
+	// Types from dependent libraries are resolved by merging their IR into the
+	// main library's IR. Only zx may be omitted, since GIDL never needs its
+	// declarations.
+	var deps []fidlgen.Root
+	for _, path := range flags.DepJSONPaths {
+		deps = append(deps, parseFidlJSONIr(path))
+	}
+	ir, err := gidlmixer.MergeDependencies(ir, deps)
+	if err != nil {
+		panic(err)
 	}
 
 	language := *flags.Language
@@ -252,6 +277,20 @@ func main() {
 		log.Fatalf("no -out path specified for main file")
 	}
 
+	if *flags.Verify {
+		if *flags.Type != "golden" {
+			log.Fatalf("-verify is only supported with -type golden")
+		}
+		want, err := os.ReadFile(*flags.Out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if diff := gidlgolden.Diff(want, mainFile); diff != "" {
+			log.Fatalf("%s doesn't match the generated goldens; if the changes are intended, regenerate it without -verify:\n%s", *flags.Out, diff)
+		}
+		return
+	}
+
 	if *flags.Language == "fuzzer_corpus" {
 		// The fuzzer corpus manifest must always be written so that the build
 		// system tries to rebuild the package. The individual files within the
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
 
 	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
 	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
@@ -831,6 +832,96 @@ func BuildSchema(fidl fidlgen.Root) Schema {
 	return Schema{libraryName: string(fidl.Name), types: types}
 }
 
+// MergeDependencies returns a copy of fidl that also contains the
+// declarations of the given dependency libraries, so that a Schema built from
+// it can resolve type references that cross library boundaries. Every library
+// fidl depends on, other than zx, must be present in deps.
+func MergeDependencies(fidl fidlgen.Root, deps []fidlgen.Root) (fidlgen.Root, error) {
+	depsByName := make(map[string]fidlgen.Root, len(deps))
+	for _, dep := range deps {
+		depsByName[string(dep.Name)] = dep
+	}
+	var missing []string
+	for _, lib := range fidl.Libraries {
+		name := string(lib.Name)
+		if _, ok := depsByName[name]; !ok && name != "zx" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) != 0 {
+		return fidlgen.Root{}, fmt.Errorf("missing IR for dependent FIDL libraries: %s", strings.Join(missing, ","))
+	}
+
+	// Copy every slice before appending so that the caller's Root is never
+	// modified through a shared backing array.
+	merged := fidl
+	merged.Bits = append([]fidlgen.Bits(nil), fidl.Bits...)
+	merged.Enums = append([]fidlgen.Enum(nil), fidl.Enums...)
+	merged.Structs = append([]fidlgen.Struct(nil), fidl.Structs...)
+	merged.Tables = append([]fidlgen.Table(nil), fidl.Tables...)
+	merged.Unions = append([]fidlgen.Union(nil), fidl.Unions...)
+	merged.Protocols = append([]fidlgen.Protocol(nil), fidl.Protocols...)
+	for _, dep := range deps {
+		if dep.Name == fidl.Name {
+			continue
+		}
+		merged.Bits = append(merged.Bits, dep.Bits...)
+		merged.Enums = append(merged.Enums, dep.Enums...)
+		merged.Structs = append(merged.Structs, dep.Structs...)
+		merged.Tables = append(merged.Tables, dep.Tables...)
+		merged.Unions = append(merged.Unions, dep.Unions...)
+		merged.Protocols = append(merged.Protocols, dep.Protocols...)
+	}
+	return merged, nil
+}
+
+// DependencyLibrary is a library, other than zx, that the FIDL IR given to
+// GIDL depends on.
+type DependencyLibrary struct {
+	// Name is the name of the library, e.g. "test.dependency".
+	Name string
+	// Decl is the qualified name of a type declared in the library, for
+	// backends that must refer to the library for its import to be used.
+	Decl string
+}
+
+// DependencyLibraries returns the libraries other than zx that fidl depends on
+// and which declare types, whose declarations MergeDependencies added to fidl.
+// Generated code must import them to refer to those types. Libraries without
+// types are omitted, since no GIDL value can refer to them.
+func DependencyLibraries(fidl fidlgen.Root) []DependencyLibrary {
+	var names []string
+	for i := range fidl.Bits {
+		names = append(names, string(fidl.Bits[i].Name))
+	}
+	for i := range fidl.Enums {
+		names = append(names, string(fidl.Enums[i].Name))
+	}
+	for i := range fidl.Structs {
+		names = append(names, string(fidl.Structs[i].Name))
+	}
+	for i := range fidl.Tables {
+		names = append(names, string(fidl.Tables[i].Name))
+	}
+	for i := range fidl.Unions {
+		names = append(names, string(fidl.Unions[i].Name))
+	}
+	var libs []DependencyLibrary
+	for _, lib := range fidl.Libraries {
+		libName := string(lib.Name)
+		if libName == "zx" || libName == string(fidl.Name) {
+			continue
+		}
+		for _, name := range names {
+			if strings.HasPrefix(name, libName+"/") {
+				libs = append(libs, DependencyLibrary{Name: libName, Decl: name})
+				break
+			}
+		}
+	}
+	return libs
+}
+
 // ExtractDeclaration extract the top-level declaration for the provided value,
 // and ensures the value conforms to the schema. It also takes a list of handle
 // definitions in scope, which can be nil if there are no handles.
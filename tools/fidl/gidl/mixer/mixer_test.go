@@ -11,6 +11,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
@@ -1060,3 +1061,70 @@ func TestVectorDeclConformsWithHandles(t *testing.T) {
 		},
 	)
 }
+
+func unmarshalRoot(t *testing.T, s string) fidlgen.Root {
+	t.Helper()
+	var root fidlgen.Root
+	if err := json.Unmarshal([]byte(s), &root); err != nil {
+		t.Fatalf("failed to unmarshal %s: %s", s, err)
+	}
+	return root
+}
+
+func TestMergeDependencies(t *testing.T) {
+	root := unmarshalRoot(t, `{
+		"name": "test.main",
+		"struct_declarations": [{"name": "test.main/MainStruct"}],
+		"library_dependencies": [{"name": "test.dep"}, {"name": "zx"}]
+	}`)
+	dep := unmarshalRoot(t, `{
+		"name": "test.dep",
+		"struct_declarations": [{"name": "test.dep/DepStruct"}]
+	}`)
+	merged, err := MergeDependencies(root, []fidlgen.Root{dep})
+	if err != nil {
+		t.Fatalf("MergeDependencies failed: %s", err)
+	}
+	if len(root.Structs) != 1 {
+		t.Errorf("MergeDependencies modified its input: got %d structs, want 1", len(root.Structs))
+	}
+	schema := BuildSchema(merged)
+	for _, name := range []string{"test.main/MainStruct", "test.dep/DepStruct"} {
+		if _, ok := schema.lookupDeclByQualifiedName(name, false); !ok {
+			t.Errorf("lookupDeclByQualifiedName(%q) failed", name)
+		}
+	}
+}
+
+func TestMergeDependenciesMissing(t *testing.T) {
+	root := unmarshalRoot(t, `{
+		"name": "test.main",
+		"library_dependencies": [{"name": "test.dep"}]
+	}`)
+	if _, err := MergeDependencies(root, nil); err == nil {
+		t.Errorf("expected error for missing dependency IR")
+	}
+}
+
+func TestDependencyLibraries(t *testing.T) {
+	root := unmarshalRoot(t, `{
+		"name": "test.main",
+		"struct_declarations": [{"name": "test.main/MainStruct"}],
+		"library_dependencies": [{"name": "test.dep"}, {"name": "test.empty"}, {"name": "zx"}]
+	}`)
+	dep := unmarshalRoot(t, `{
+		"name": "test.dep",
+		"enum_declarations": [{"name": "test.dep/DepEnum", "type": "uint32"}],
+		"struct_declarations": [{"name": "test.dep/DepStruct"}]
+	}`)
+	// Declares no types, so nothing can refer to it.
+	empty := unmarshalRoot(t, `{"name": "test.empty"}`)
+	merged, err := MergeDependencies(root, []fidlgen.Root{dep, empty})
+	if err != nil {
+		t.Fatalf("MergeDependencies failed: %s", err)
+	}
+	expected := []DependencyLibrary{{Name: "test.dep", Decl: "test.dep/DepEnum"}}
+	if actual := DependencyLibraries(merged); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("DependencyLibraries returned %v, want %v", actual, expected)
+	}
+}
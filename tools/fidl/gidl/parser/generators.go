@@ -46,7 +46,9 @@ func (p *Parser) parseColonSize() (uint64, error) {
 	if err != nil {
 		return 0, p.newParseError(tok, "error parsing byte size: %v", err)
 	}
-	if size == 0 {
+	// Sizes substituted for a parameter may be zero, so that a parameter can
+	// cover empty vectors.
+	if size == 0 && !tok.substituted {
 		return 0, p.newParseError(tok, "expected non-zero byte size")
 	}
 	return size, nil
@@ -84,6 +84,7 @@ const (
 	tLsquare
 	tRsquare
 	tHash
+	tDollar
 )
 
 var tokenKindStrings = []string{
@@ -103,6 +104,7 @@ var tokenKindStrings = []string{
 	"[",
 	"]",
 	"#",
+	"$",
 }
 
 var (
@@ -132,6 +134,9 @@ type token struct {
 	kind         tokenKind
 	value        string
 	line, column int
+	// substituted is set on tokens that replaced a reference to a parameter
+	// of a parameterized section.
+	substituted bool
 }
 
 func (t token) String() string {
@@ -157,6 +162,7 @@ const (
 	isBindingsDenylist
 	isEnableSendEventBenchmark
 	isEnableEchoCallBenchmark
+	isEnableAllocationBenchmark
 )
 
 func (kind bodyElement) String() string {
@@ -183,6 +189,8 @@ func (kind bodyElement) String() string {
 		return "enable_send_event_benchmark"
 	case isEnableEchoCallBenchmark:
 		return "enable_echo_call_benchmark"
+	case isEnableAllocationBenchmark:
+		return "enable_allocation_benchmark"
 	default:
 		panic("unsupported kind")
 	}
@@ -246,15 +254,16 @@ func toIrHandleDispositionEncodings(v []encodingData) []ir.HandleDispositionEnco
 }
 
 type body struct {
-	Type                     string
-	Value                    ir.Record
-	Encodings                []encodingData
-	HandleDefs               []ir.HandleDef
-	Err                      ir.ErrorCode
-	BindingsAllowlist        *ir.LanguageList
-	BindingsDenylist         *ir.LanguageList
-	EnableSendEventBenchmark bool
-	EnableEchoCallBenchmark  bool
+	Type                      string
+	Value                     ir.Record
+	Encodings                 []encodingData
+	HandleDefs                []ir.HandleDef
+	Err                       ir.ErrorCode
+	BindingsAllowlist         *ir.LanguageList
+	BindingsDenylist          *ir.LanguageList
+	EnableSendEventBenchmark  bool
+	EnableEchoCallBenchmark   bool
+	EnableAllocationBenchmark bool
 }
 
 func (b *body) addEncoding(e encodingData) error {
@@ -420,19 +429,21 @@ var sections = map[string]sectionMetadata{
 		optionalKinds: map[bodyElement]struct{}{
 			isHandleDefs: {}, isBindingsAllowlist: {}, isBindingsDenylist: {},
 			isEnableSendEventBenchmark: {}, isEnableEchoCallBenchmark: {},
+			isEnableAllocationBenchmark: {},
 		},
 		rightsConfiguration: rightsConfiguration{
 			allowRights: false,
 		},
 		setter: func(name string, body body, all *ir.All) {
 			benchmark := ir.Benchmark{
-				Name:                     name,
-				Value:                    body.Value,
-				HandleDefs:               body.HandleDefs,
-				BindingsAllowlist:        body.BindingsAllowlist,
-				BindingsDenylist:         body.BindingsDenylist,
-				EnableSendEventBenchmark: body.EnableSendEventBenchmark,
-				EnableEchoCallBenchmark:  body.EnableEchoCallBenchmark,
+				Name:                      name,
+				Value:                     body.Value,
+				HandleDefs:                body.HandleDefs,
+				BindingsAllowlist:         body.BindingsAllowlist,
+				BindingsDenylist:          body.BindingsDenylist,
+				EnableSendEventBenchmark:  body.EnableSendEventBenchmark,
+				EnableEchoCallBenchmark:   body.EnableEchoCallBenchmark,
+				EnableAllocationBenchmark: body.EnableAllocationBenchmark,
 			}
 			all.Benchmark = append(all.Benchmark, benchmark)
 		},
@@ -444,6 +455,13 @@ func (p *Parser) parseSection(all *ir.All) error {
 	if err != nil {
 		return err
 	}
+	params, err := p.parseSectionParams()
+	if err != nil {
+		return err
+	}
+	if params != nil {
+		return p.parseTemplatedBody(section, name, params, all)
+	}
 	body, err := p.parseBody(section.requiredKinds, section.optionalKinds, section.rightsConfiguration)
 	if err != nil {
 		return err
@@ -627,6 +645,8 @@ func (p *Parser) parseSingleBodyElement(result *body, all map[bodyElement]struct
 		}
 		result.EnableSendEventBenchmark = boolValue
 		kind = isEnableSendEventBenchmark
+	case "params":
+		return p.newParseError(tok, "params must be the first element of the body")
 	case "enable_echo_call_benchmark":
 		value, err := p.parseValue(rightsConfiguration)
 		if err != nil {
@@ -638,6 +658,17 @@ func (p *Parser) parseSingleBodyElement(result *body, all map[bodyElement]struct
 		}
 		result.EnableEchoCallBenchmark = boolValue
 		kind = isEnableEchoCallBenchmark
+	case "enable_allocation_benchmark":
+		value, err := p.parseValue(rightsConfiguration)
+		if err != nil {
+			return err
+		}
+		boolValue, ok := value.(bool)
+		if !ok {
+			return p.newParseError(tok, "expected boolean value")
+		}
+		result.EnableAllocationBenchmark = boolValue
+		kind = isEnableAllocationBenchmark
 	default:
 		return p.newParseError(tok, "must be type, value, bytes, err, bindings_allowlist or bindings_denylist")
 	}
@@ -674,6 +705,20 @@ func (p *Parser) parseHandleRestrict(rightsConfiguration rightsConfiguration) (i
 		}
 
 		switch labelTok.value {
+		case "type":
+			if !rightsConfiguration.allowRights {
+				return ir.HandleWithRights{}, fmt.Errorf("handle types are disabled for this section")
+			}
+
+			valueTok, err := p.consumeToken(tText)
+			if err != nil {
+				return ir.HandleWithRights{}, err
+			}
+			subtype, ok := ir.HandleSubtypeByName(valueTok.value)
+			if !ok {
+				return ir.HandleWithRights{}, p.newParseError(valueTok, "invalid handle subtype: %s", valueTok.value)
+			}
+			objectType = fidlgen.ObjectTypeFromHandleSubtype(subtype)
 		case "rights":
 			if !rightsConfiguration.allowRights {
 				return ir.HandleWithRights{}, fmt.Errorf("rights are disabled for this section")
@@ -1411,19 +1456,19 @@ func (p *Parser) nextToken() (token, error) {
 func (p *Parser) scanToken() (token, error) {
 	// eof
 	if tok := p.scanner.Scan(); tok == scanner.EOF {
-		return token{tEof, "", 0, 0}, nil
+		return token{kind: tEof}, nil
 	}
 	pos := p.scanner.Position
 
 	// unit tokens
 	text := p.scanner.TokenText()
 	if kind, ok := textToTokenKind[text]; ok {
-		return token{kind, text, pos.Line, pos.Column}, nil
+		return token{kind: kind, value: text, line: pos.Line, column: pos.Column}, nil
 	}
 
 	// string
 	if text[0] == '"' {
-		tok := token{tString, "", pos.Line, pos.Column}
+		tok := token{kind: tString, line: pos.Line, column: pos.Column}
 		s, err := strconv.Unquote(text)
 		if err != nil {
 			return tok, p.newParseError(tok, "improperly escaped string, %s: %s", err, text)
@@ -1433,7 +1478,7 @@ func (p *Parser) scanToken() (token, error) {
 	}
 
 	// text
-	return token{tText, text, pos.Line, pos.Column}, nil
+	return token{kind: tText, value: text, line: pos.Line, column: pos.Column}, nil
 }
 
 type parseError struct {
@@ -55,6 +55,18 @@ func TestParseValues(t *testing.T) {
 			Rights: fidlgen.HandleRightsRead | fidlgen.HandleRightsWrite,
 		},
 		},
+		{gidl: `restrict(#123, type: channel, rights: read + write)`, expectedValue: ir.HandleWithRights{
+			Handle: ir.Handle(123),
+			Type:   fidlgen.ObjectTypeChannel,
+			Rights: fidlgen.HandleRightsRead | fidlgen.HandleRightsWrite,
+		},
+		},
+		{gidl: `restrict(#123, type: event)`, expectedValue: ir.HandleWithRights{
+			Handle: ir.Handle(123),
+			Type:   fidlgen.ObjectTypeEvent,
+			Rights: fidlgen.HandleRightsSameRights,
+		},
+		},
 		{gidl: `SomeRecord {}`, expectedValue: ir.Record{
 			Name: "SomeRecord",
 		}},
@@ -162,7 +174,8 @@ func TestFailsParseValues(t *testing.T) {
 		{gidl: `"\xwrong"`, expectedErrorSubstr: "improperly escaped string"},
 		{gidl: `#-1`, expectedErrorSubstr: `want "<text>", got "-"`},
 		{gidl: `SomeRecord { 0x01020304: 5, }`, expectedErrorSubstr: "unexpected tokenKind"},
-		{gidl: `restrict(#123, type: channel, rights: read + write)`, expectedErrorSubstr: "unknown restrict label"},
+		{gidl: `restrict(#123, koid: 5)`, expectedErrorSubstr: "unknown restrict label"},
+		{gidl: `restrict(#123, type: fifo)`, expectedErrorSubstr: "invalid handle subtype"},
 		{gidl: `[repeat(1):0]`, expectedErrorSubstr: "expected non-zero"},
 	}
 	for _, tc := range testCases {
@@ -181,6 +194,7 @@ func TestFailsParseValuesRightsDisabled(t *testing.T) {
 	}
 	testCases := []testCase{
 		{gidl: `restrict(#123, rights: read)`, expectedErrorSubstr: "rights are disabled for this section"},
+		{gidl: `restrict(#123, type: channel)`, expectedErrorSubstr: "handle types are disabled for this section"},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.gidl, func(t *testing.T) {
@@ -1625,17 +1639,17 @@ func checkFailure(t *testing.T, err error, errorSubstr string) {
 func TestTokenizationSuccess(t *testing.T) {
 	cases := map[string][]token{
 		"1,2,3": {
-			{tText, "1", 1, 1},
-			{tComma, ",", 1, 2},
-			{tText, "2", 1, 3},
-			{tComma, ",", 1, 4},
-			{tText, "3", 1, 5},
-			{tEof, "", 0, 0},
+			{kind: tText, value: "1", line: 1, column: 1},
+			{kind: tComma, value: ",", line: 1, column: 2},
+			{kind: tText, value: "2", line: 1, column: 3},
+			{kind: tComma, value: ",", line: 1, column: 4},
+			{kind: tText, value: "3", line: 1, column: 5},
+			{kind: tEof},
 		},
 		"'1', '22'": {
-			{tText, "'1'", 1, 1},
-			{tComma, ",", 1, 4},
-			{tText, "'22'", 1, 6},
+			{kind: tText, value: "'1'", line: 1, column: 1},
+			{kind: tComma, value: ",", line: 1, column: 4},
+			{kind: tText, value: "'22'", line: 1, column: 6},
 		},
 	}
 	for input, expecteds := range cases {
@@ -1659,11 +1673,11 @@ func TestTokenizationSuccess(t *testing.T) {
 }
 func TestVariousStringFuncs(t *testing.T) {
 	cases := map[fmt.Stringer]string{
-		tComma:                          ",",
-		tEof:                            "<eof>",
-		token{tComma, "whatever", 0, 0}: ",",
-		token{tText, "me me me", 0, 0}:  "me me me",
-		isValue:                         "value",
+		tComma:                                 ",",
+		tEof:                                   "<eof>",
+		token{kind: tComma, value: "whatever"}: ",",
+		token{kind: tText, value: "me me me"}:  "me me me",
+		isValue:                                "value",
 	}
 	for value, expected := range cases {
 		actual := value.String()
@@ -1672,3 +1686,186 @@ func TestVariousStringFuncs(t *testing.T) {
 		}
 	}
 }
+
+func TestParseParameterizedCase(t *testing.T) {
+	gidl := `
+	decode_success("VectorOfBytes-${n}") {
+		params = {
+			n = [0, 3],
+			pad = [8, 5],
+		},
+		value = VectorOfBytes {
+			v: [repeat(0x01):$n],
+		},
+		bytes = {
+			v1 = [
+				num($n):8, // length
+				repeat(0xff):8, // alloc present
+				repeat(0x01):$n, padding:$pad,
+			],
+		},
+	}`
+	all, err := parse(gidl)
+	expectedAll := ir.All{
+		DecodeSuccess: []ir.DecodeSuccess{
+			{
+				Name: "VectorOfBytes-0",
+				Value: ir.Record{
+					Name: "VectorOfBytes",
+					Fields: []ir.Field{
+						{
+							Key:   ir.FieldKey{Name: "v"},
+							Value: []ir.Value{},
+						},
+					},
+				},
+				Encodings: []ir.Encoding{{
+					WireFormat: ir.V1WireFormat,
+					Bytes: []byte{
+						0, 0, 0, 0, 0, 0, 0, 0,
+						255, 255, 255, 255, 255, 255, 255, 255,
+						0, 0, 0, 0, 0, 0, 0, 0,
+					},
+				}},
+			},
+			{
+				Name: "VectorOfBytes-3",
+				Value: ir.Record{
+					Name: "VectorOfBytes",
+					Fields: []ir.Field{
+						{
+							Key:   ir.FieldKey{Name: "v"},
+							Value: []ir.Value{uint64(1), uint64(1), uint64(1)},
+						},
+					},
+				},
+				Encodings: []ir.Encoding{{
+					WireFormat: ir.V1WireFormat,
+					Bytes: []byte{
+						3, 0, 0, 0, 0, 0, 0, 0,
+						255, 255, 255, 255, 255, 255, 255, 255,
+						1, 1, 1, 0, 0, 0, 0, 0,
+					},
+				}},
+			},
+		},
+	}
+	checkMatch(t, all, expectedAll, err)
+}
+
+func TestParseParameterizedCaseRange(t *testing.T) {
+	gidl := `
+	encode_failure("Int8-${x}") {
+		params = { x = range(-1, 1) },
+		value = Int8 { x: $x },
+		err = STRICT_UNION_UNKNOWN_FIELD,
+	}`
+	all, err := parse(gidl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var values []ir.Value
+	for _, c := range all.EncodeFailure {
+		names = append(names, c.Name)
+		values = append(values, c.Value.Fields[0].Value)
+	}
+	if diff := cmp.Diff([]string{"Int8--1", "Int8-0", "Int8-1"}, names); diff != "" {
+		t.Errorf("unexpected names (-want +got)\n%s", diff)
+	}
+	if diff := cmp.Diff([]ir.Value{int64(-1), uint64(0), uint64(1)}, values); diff != "" {
+		t.Errorf("unexpected values (-want +got)\n%s", diff)
+	}
+}
+
+func TestParseParameterizedCaseFailures(t *testing.T) {
+	testCases := []struct {
+		params       string
+		errSubstring string
+	}{
+		{
+			params:       `{}`,
+			errSubstring: "at least one parameter",
+		},
+		{
+			params:       `{ n = [] }`,
+			errSubstring: "at least one value",
+		},
+		{
+			params:       `{ n = [1], n = [2] }`,
+			errSubstring: "duplicate parameter",
+		},
+		{
+			params:       `{ n = [1, 2], m = [1] }`,
+			errSubstring: "has 1 values",
+		},
+		{
+			params:       `{ n = range(2, 1) }`,
+			errSubstring: "is empty",
+		},
+		{
+			params:       `{ n = range(0, 100000) }`,
+			errSubstring: "more than",
+		},
+		{
+			params:       `{ n = [Foo {}] }`,
+			errSubstring: "unexpected tokenKind",
+		},
+		{
+			params:       `{ m = [1, 2] }`,
+			errSubstring: "undefined parameter 'n'",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.params, func(t *testing.T) {
+			_, err := parse(fmt.Sprintf(`
+			encode_failure("Value-${m}") {
+				params = %s,
+				value = Value { x: $n },
+				err = STRICT_UNION_UNKNOWN_FIELD,
+			}`, tc.params))
+			checkFailure(t, err, tc.errSubstring)
+		})
+	}
+}
+
+func TestParseFailsParameterizedCaseLiteralZeroSize(t *testing.T) {
+	gidl := `
+	decode_success("VectorOfBytes-${n}") {
+		params = { n = [0, 3] },
+		value = VectorOfBytes {
+			v: [repeat(0x01):$n],
+		},
+		bytes = {
+			v1 = [
+				num($n):8, // length
+				repeat(0xff):8, // alloc present
+				repeat(0x01):$n, padding:0,
+			],
+		},
+	}`
+	_, err := parse(gidl)
+	checkFailure(t, err, "non-zero")
+}
+
+func TestParseFailsParameterizedCaseDuplicateName(t *testing.T) {
+	gidl := `
+	encode_failure("Value") {
+		params = { n = [1, 2] },
+		value = Value { x: $n },
+		err = STRICT_UNION_UNKNOWN_FIELD,
+	}`
+	_, err := parse(gidl)
+	checkFailure(t, err, "same name")
+}
+
+func TestParseFailsParamsNotFirst(t *testing.T) {
+	gidl := `
+	encode_failure("Value-${n}") {
+		value = Value { x: 1 },
+		params = { n = [1, 2] },
+		err = STRICT_UNION_UNKNOWN_FIELD,
+	}`
+	_, err := parse(gidl)
+	checkFailure(t, err, "params must be the first element")
+}
@@ -0,0 +1,285 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+)
+
+// maxRangeValues bounds the number of values of a range(), to catch typos that
+// would otherwise expand to an enormous number of test cases.
+const maxRangeValues = 4096
+
+// templateParam is a parameter of a section, along with the values it is bound
+// to. Each value is the sequence of tokens that replaces references to the
+// parameter.
+type templateParam struct {
+	name   string
+	values [][]token
+}
+
+// parseSectionParams parses the `params` element of a section body if it is
+// the first element. It consumes the opening brace of the body if it returns
+// params, and leaves it to be parsed by parseBody otherwise.
+func (p *Parser) parseSectionParams() ([]templateParam, error) {
+	lacco, err := p.consumeToken(tLacco)
+	if err != nil {
+		return nil, err
+	}
+	tok, err := p.peekToken()
+	if err != nil {
+		return nil, err
+	}
+	if tok.kind != tText || tok.value != "params" {
+		p.lookaheads = append([]token{lacco}, p.lookaheads...)
+		return nil, nil
+	}
+	p.nextToken()
+	if _, err := p.consumeToken(tEqual); err != nil {
+		return nil, err
+	}
+	var params []templateParam
+	seen := make(map[string]struct{})
+	if err := p.parseCommaSeparated(tLacco, tRacco, func() error {
+		nameTok, err := p.consumeToken(tText)
+		if err != nil {
+			return err
+		}
+		if _, ok := seen[nameTok.value]; ok {
+			return p.newParseError(nameTok, "duplicate parameter '%s'", nameTok.value)
+		}
+		seen[nameTok.value] = struct{}{}
+		if _, err := p.consumeToken(tEqual); err != nil {
+			return err
+		}
+		values, err := p.parseParamValues()
+		if err != nil {
+			return err
+		}
+		if len(params) > 0 && len(values) != len(params[0].values) {
+			return p.newParseError(nameTok, "parameter '%s' has %d values, but '%s' has %d",
+				nameTok.value, len(values), params[0].name, len(params[0].values))
+		}
+		params = append(params, templateParam{name: nameTok.value, values: values})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(params) == 0 {
+		return nil, p.newParseError(tok, "params must declare at least one parameter")
+	}
+	if p.peekTokenKind(tComma) {
+		p.nextToken()
+	}
+	return params, nil
+}
+
+// parseParamValues parses either a list of literals, e.g. `[0, -1, "a"]`, or
+// an inclusive range of integers, e.g. `range(0, 3)`.
+func (p *Parser) parseParamValues() ([][]token, error) {
+	tok, err := p.peekToken()
+	if err != nil {
+		return nil, err
+	}
+	if tok.kind == tText && tok.value == "range" {
+		p.nextToken()
+		return p.parseParamRange()
+	}
+	var values [][]token
+	if err := p.parseCommaSeparated(tLsquare, tRsquare, func() error {
+		tok, err := p.nextToken()
+		if err != nil {
+			return err
+		}
+		switch tok.kind {
+		case tText, tString:
+			values = append(values, []token{tok})
+		case tNeg:
+			numTok, err := p.consumeToken(tText)
+			if err != nil {
+				return err
+			}
+			values = append(values, []token{tok, numTok})
+		default:
+			return p.newParseError(tok, "parameter values must be literals")
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, p.newParseError(tok, "a parameter must have at least one value")
+	}
+	return values, nil
+}
+
+func (p *Parser) parseParamRange() ([][]token, error) {
+	lparen, err := p.consumeToken(tLparen)
+	if err != nil {
+		return nil, err
+	}
+	first, err := p.parseRangeBound()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consumeToken(tComma); err != nil {
+		return nil, err
+	}
+	last, err := p.parseRangeBound()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consumeToken(tRparen); err != nil {
+		return nil, err
+	}
+	if last < first {
+		return nil, p.newParseError(lparen, "range(%d, %d) is empty", first, last)
+	}
+	if uint64(last-first) >= maxRangeValues {
+		return nil, p.newParseError(lparen, "range(%d, %d) has more than %d values", first, last, maxRangeValues)
+	}
+	var values [][]token
+	for i := first; ; i++ {
+		if i < 0 {
+			values = append(values, []token{
+				{kind: tNeg, value: "-", line: lparen.line, column: lparen.column},
+				{kind: tText, value: strconv.FormatInt(-i, 10), line: lparen.line, column: lparen.column},
+			})
+		} else {
+			values = append(values, []token{
+				{kind: tText, value: strconv.FormatInt(i, 10), line: lparen.line, column: lparen.column},
+			})
+		}
+		if i == last {
+			break
+		}
+	}
+	return values, nil
+}
+
+func (p *Parser) parseRangeBound() (int64, error) {
+	neg := p.peekTokenKind(tNeg)
+	if neg {
+		p.nextToken()
+	}
+	tok, err := p.consumeToken(tText)
+	if err != nil {
+		return 0, err
+	}
+	val, err := strconv.ParseInt(tok.value, 0, 64)
+	if err != nil {
+		return 0, p.newParseError(tok, "invalid range bound: %s", tok.value)
+	}
+	if neg {
+		return -val, nil
+	}
+	return val, nil
+}
+
+// parseTemplatedBody parses the rest of a section body once per binding of
+// params, and adds a test case for each. The opening brace of the body and its
+// params must have been consumed.
+func (p *Parser) parseTemplatedBody(section sectionMetadata, name string, params []templateParam, all *ir.All) error {
+	lacco := token{kind: tLacco, value: "{"}
+	bodyTokens, err := p.consumeBodyTokens()
+	if err != nil {
+		return err
+	}
+	if len(bodyTokens) > 0 {
+		lacco.line, lacco.column = bodyTokens[0].line, bodyTokens[0].column
+	}
+	names := make(map[string]struct{})
+	for i := range params[0].values {
+		binding := make(map[string][]token)
+		for _, param := range params {
+			binding[param.name] = param.values[i]
+		}
+		tokens, err := p.substituteParams(bodyTokens, binding)
+		if err != nil {
+			return err
+		}
+		boundName := expandParamsInName(name, params, i)
+		if _, ok := names[boundName]; ok {
+			return p.newParseError(lacco, "parameterized test %q has the same name for several bindings; reference the parameters in its name, e.g. ${%s}", name, params[0].name)
+		}
+		names[boundName] = struct{}{}
+
+		p.lookaheads = append([]token{lacco}, tokens...)
+		body, err := p.parseBody(section.requiredKinds, section.optionalKinds, section.rightsConfiguration)
+		if err != nil {
+			return err
+		}
+		if len(p.lookaheads) != 0 {
+			return p.newParseError(p.lookaheads[0], "unexpected token after body")
+		}
+		section.setter(boundName, body, all)
+	}
+	return nil
+}
+
+// consumeBodyTokens consumes the tokens of a body up to and including its
+// closing brace.
+func (p *Parser) consumeBodyTokens() ([]token, error) {
+	var tokens []token
+	for depth := 1; depth > 0; {
+		tok, err := p.nextToken()
+		if err != nil {
+			return nil, err
+		}
+		switch tok.kind {
+		case tEof:
+			return nil, p.newParseError(tok, "unexpected end of input in body")
+		case tLacco:
+			depth++
+		case tRacco:
+			depth--
+		}
+		tokens = append(tokens, tok)
+	}
+	return tokens, nil
+}
+
+// substituteParams replaces the references to parameters, e.g. `$n`, in
+// tokens by the tokens of the values they are bound to.
+func (p *Parser) substituteParams(tokens []token, binding map[string][]token) ([]token, error) {
+	var result []token
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].kind != tDollar {
+			result = append(result, tokens[i])
+			continue
+		}
+		ref := tokens[i]
+		if i+1 == len(tokens) || tokens[i+1].kind != tText {
+			return nil, p.newParseError(ref, "expected parameter name after $")
+		}
+		i++
+		value, ok := binding[tokens[i].value]
+		if !ok {
+			return nil, p.newParseError(tokens[i], "undefined parameter '%s'", tokens[i].value)
+		}
+		for _, tok := range value {
+			tok.line, tok.column = ref.line, ref.column
+			tok.substituted = true
+			result = append(result, tok)
+		}
+	}
+	return result, nil
+}
+
+// expandParamsInName replaces the references to parameters in the name of a
+// parameterized test, e.g. `${n}`, by the values of the i-th binding.
+func expandParamsInName(name string, params []templateParam, i int) string {
+	for _, param := range params {
+		var value strings.Builder
+		for _, tok := range param.values[i] {
+			value.WriteString(tok.value)
+		}
+		name = strings.ReplaceAll(name, "${"+param.name+"}", value.String())
+	}
+	return name
+}
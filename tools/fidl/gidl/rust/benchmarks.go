@@ -25,20 +25,21 @@ var (
 )
 
 type benchmarkTmplInput struct {
-	NumBenchmarks int
-	CrateSuffix   string
-	Benchmarks    []benchmark
+	NumBenchmarks           int
+	NumAllocationBenchmarks int
+	CrateSuffix             string
+	Benchmarks              []benchmark
 }
 type benchmark struct {
-	Name, ChromeperfPath, HandleDefs, Value, ValueType string
-	EnableSendEventBenchmark, EnableEchoCallBenchmark  bool
+	Name, ChromeperfPath, HandleDefs, Value, ValueType                           string
+	EnableSendEventBenchmark, EnableEchoCallBenchmark, EnableAllocationBenchmark bool
 }
 
 // GenerateBenchmarks generates Rust benchmarks.
 func GenerateBenchmarks(gidl gidlir.All, fidl fidlgen.Root, config gidlconfig.GeneratorConfig) ([]byte, error) {
 	schema := gidlmixer.BuildSchema(fidl)
 	var benchmarks []benchmark
-	nBenchmarks := 0
+	nBenchmarks, nAllocationBenchmarks := 0, 0
 	for _, gidlBenchmark := range gidl.Benchmark {
 		decl, err := schema.ExtractDeclaration(gidlBenchmark.Value, gidlBenchmark.HandleDefs)
 		if err != nil {
@@ -46,13 +47,14 @@ func GenerateBenchmarks(gidl gidlir.All, fidl fidlgen.Root, config gidlconfig.Ge
 		}
 		value := visit(gidlBenchmark.Value, decl)
 		benchmarks = append(benchmarks, benchmark{
-			Name:                     benchmarkName(gidlBenchmark.Name),
-			ChromeperfPath:           gidlBenchmark.Name,
-			HandleDefs:               buildHandleDefs(gidlBenchmark.HandleDefs),
-			Value:                    value,
-			ValueType:                declName(decl),
-			EnableSendEventBenchmark: gidlBenchmark.EnableSendEventBenchmark,
-			EnableEchoCallBenchmark:  gidlBenchmark.EnableEchoCallBenchmark,
+			Name:                      benchmarkName(gidlBenchmark.Name),
+			ChromeperfPath:            gidlBenchmark.Name,
+			HandleDefs:                buildHandleDefs(gidlBenchmark.HandleDefs),
+			Value:                     value,
+			ValueType:                 declName(decl),
+			EnableSendEventBenchmark:  gidlBenchmark.EnableSendEventBenchmark,
+			EnableEchoCallBenchmark:   gidlBenchmark.EnableEchoCallBenchmark,
+			EnableAllocationBenchmark: gidlBenchmark.EnableAllocationBenchmark,
 		})
 		nBenchmarks += 3
 		if gidlBenchmark.EnableSendEventBenchmark {
@@ -61,11 +63,15 @@ func GenerateBenchmarks(gidl gidlir.All, fidl fidlgen.Root, config gidlconfig.Ge
 		if gidlBenchmark.EnableEchoCallBenchmark {
 			nBenchmarks++
 		}
+		if gidlBenchmark.EnableAllocationBenchmark {
+			nAllocationBenchmarks += 2
+		}
 	}
 	input := benchmarkTmplInput{
-		NumBenchmarks: nBenchmarks,
-		CrateSuffix:   config.RustBenchmarksFidlLibrary,
-		Benchmarks:    benchmarks,
+		NumBenchmarks:           nBenchmarks,
+		NumAllocationBenchmarks: nAllocationBenchmarks,
+		CrateSuffix:             config.RustBenchmarksFidlLibrary,
+		Benchmarks:              benchmarks,
 	}
 	var buf bytes.Buffer
 	err := benchmarkTmpl.Execute(&buf, input)
@@ -15,6 +15,17 @@ import (
 	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
 )
 
+// dependencyCrates returns the names under which the crates of the libraries
+// that the conformance library depends on are imported, e.g. "test_dependency"
+// for fidl_test_dependency, matching the paths built by identifierName.
+func dependencyCrates(fidl fidlgen.Root) []string {
+	var crates []string
+	for _, lib := range gidlmixer.DependencyLibraries(fidl) {
+		crates = append(crates, strings.ReplaceAll(lib.Name, ".", "_"))
+	}
+	return crates
+}
+
 func buildHandleDefs(defs []gidlir.HandleDef) string {
 	if len(defs) == 0 {
 		return ""
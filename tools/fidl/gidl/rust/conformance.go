@@ -25,6 +25,7 @@ var (
 )
 
 type conformanceTmplInput struct {
+	DependencyCrates   []string
 	EncodeSuccessCases []encodeSuccessCase
 	DecodeSuccessCases []decodeSuccessCase
 	EncodeFailureCases []encodeFailureCase
@@ -36,7 +37,7 @@ type encodeSuccessCase struct {
 }
 
 type decodeSuccessCase struct {
-	Name, Context, HandleDefs, ValueType, Value, Bytes, Handles, ForgetHandles string
+	Name, Context, HandleDefs, ValueType, Value, Bytes, Handles, ForgetHandles, HandleChecks string
 }
 
 type encodeFailureCase struct {
@@ -67,6 +68,7 @@ func GenerateConformanceTests(gidl gidlir.All, fidl fidlgen.Root, config gidlcon
 		return nil, err
 	}
 	input := conformanceTmplInput{
+		DependencyCrates:   dependencyCrates(fidl),
 		EncodeSuccessCases: encodeSuccessCases,
 		DecodeSuccessCases: decodeSuccessCases,
 		EncodeFailureCases: encodeFailureCases,
@@ -114,6 +116,7 @@ func decodeSuccessCases(gidlDecodeSuccesses []gidlir.DecodeSuccess, schema gidlm
 		// Start with "self.0" because this code is placed in a drop(&mut self)
 		// function, where self is a wrapper around valueType.
 		forgetHandles := buildForgetHandles("self.0", decodeSuccess.Value, decl)
+		handleChecks := buildHandleChecks("value", decodeSuccess.Value, decl)
 		for _, encoding := range decodeSuccess.Encodings {
 			if !wireFormatSupported(encoding.WireFormat) {
 				continue
@@ -127,6 +130,7 @@ func decodeSuccessCases(gidlDecodeSuccesses []gidlir.DecodeSuccess, schema gidlm
 				Bytes:         gidllibrust.BuildBytes(encoding.Bytes),
 				Handles:       buildHandles(encoding.Handles),
 				ForgetHandles: forgetHandles,
+				HandleChecks:  handleChecks,
 			})
 		}
 	}
@@ -0,0 +1,107 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rust
+
+import (
+	"fmt"
+	"strings"
+
+	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+	gidlmixer "go.fuchsia.dev/fuchsia/tools/fidl/gidl/mixer"
+	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+// Returns Rust code that asserts that the handles in expr (an expression of
+// type "&_") have the object type and rights that value restricts them to.
+func buildHandleChecks(expr string, value gidlir.Value, decl gidlmixer.Declaration) string {
+	var b handleCheckBuilder
+	b.visit(expr, value, decl)
+	return strings.TrimSpace(b.String())
+}
+
+type handleCheckBuilder struct {
+	strings.Builder
+}
+
+func (b *handleCheckBuilder) write(format string, args ...interface{}) {
+	b.WriteString(fmt.Sprintf(format, args...))
+}
+
+func (b *handleCheckBuilder) visit(expr string, value gidlir.Value, decl gidlmixer.Declaration) {
+	if value == nil {
+		return
+	}
+	if decl.IsNullable() {
+		expr = fmt.Sprintf("%s.as_ref().unwrap()", expr)
+	}
+	switch value := value.(type) {
+	case gidlir.HandleWithRights:
+		if value.Type == fidlgen.ObjectTypeNone && value.Rights == fidlgen.HandleRightsSameRights {
+			return
+		}
+		b.write("{\n\tlet info = (%s).as_handle_ref().basic_info().unwrap();\n", expr)
+		if value.Type != fidlgen.ObjectTypeNone {
+			b.write("\tassert_eq!(info.object_type, ObjectType::from_raw(%d));\n", value.Type)
+		}
+		if value.Rights != fidlgen.HandleRightsSameRights {
+			b.write("\tassert_eq!(info.rights, Rights::from_bits(%d).unwrap());\n", value.Rights)
+		}
+		b.write("}\n")
+	case gidlir.Record:
+		decl := decl.(gidlmixer.RecordDeclaration)
+		switch decl.(type) {
+		case *gidlmixer.StructDecl:
+			for _, field := range value.Fields {
+				fieldDecl, ok := decl.Field(field.Key.Name)
+				if !ok {
+					panic(fmt.Sprintf("field %s not found", field.Key.Name))
+				}
+				b.visit(fmt.Sprintf("(&%s.%s)", expr, field.Key.Name), field.Value, fieldDecl)
+			}
+		case *gidlmixer.TableDecl:
+			for _, field := range value.Fields {
+				if field.Key.IsUnknown() {
+					continue
+				}
+				fieldDecl, ok := decl.Field(field.Key.Name)
+				if !ok {
+					panic(fmt.Sprintf("field %s not found", field.Key.Name))
+				}
+				b.visit(fmt.Sprintf("%s.%s.as_ref().unwrap()", expr, field.Key.Name), field.Value, fieldDecl)
+			}
+		case *gidlmixer.UnionDecl:
+			if len(value.Fields) != 1 {
+				panic(fmt.Sprintf("union has %d fields, expected 1", len(value.Fields)))
+			}
+			field := value.Fields[0]
+			if field.Key.IsUnknown() {
+				break
+			}
+			fieldDecl, ok := decl.Field(field.Key.Name)
+			if !ok {
+				panic(fmt.Sprintf("field %s not found", field.Key.Name))
+			}
+			// Use another builder so that we only emit the match statement if
+			// there are any handles within to check.
+			var inner handleCheckBuilder
+			inner.visit("x", field.Value, fieldDecl)
+			if inner.Len() == 0 {
+				break
+			}
+			b.write(`match %s {
+	%s::%s(x) => {
+		%s
+	}
+	_ => unreachable!(),
+}
+`, expr, declName(decl), fidlgen.ToUpperCamelCase(field.Key.Name), inner.String())
+		}
+	case []gidlir.Value:
+		elemDecl := decl.(gidlmixer.ListDeclaration).Elem()
+		for i, elem := range value {
+			b.visit(fmt.Sprintf("(&%s[%d])", expr, i), elem, elemDecl)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rust
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+	gidlmixer "go.fuchsia.dev/fuchsia/tools/fidl/gidl/mixer"
+	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+// handleStructFidl declares a struct with a handle, a nullable handle and a
+// vector of handles.
+const handleStructFidl = `{
+	"name": "test.conformance",
+	"struct_declarations": [{
+		"name": "test.conformance/HandleStruct",
+		"members": [
+			{"name": "h", "type": {"kind": "handle", "subtype": "channel", "nullable": false}},
+			{"name": "opt", "type": {"kind": "handle", "subtype": "channel", "nullable": true}},
+			{"name": "v", "type": {
+				"kind": "vector",
+				"element_type": {"kind": "handle", "subtype": "channel", "nullable": false},
+				"nullable": false
+			}}
+		]
+	}]
+}`
+
+func TestBuildHandleChecks(t *testing.T) {
+	var fidl fidlgen.Root
+	if err := json.Unmarshal([]byte(handleStructFidl), &fidl); err != nil {
+		t.Fatal(err)
+	}
+	decl, err := gidlmixer.BuildSchema(fidl).ExtractDeclarationByName("HandleStruct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restricted := gidlir.HandleWithRights{
+		Type:   fidlgen.ObjectTypeChannel,
+		Rights: fidlgen.HandleRightsRead | fidlgen.HandleRightsWrite,
+	}
+	unrestricted := gidlir.HandleWithRights{
+		Type:   fidlgen.ObjectTypeNone,
+		Rights: fidlgen.HandleRightsSameRights,
+	}
+	const restrictedChecks = `{
+	let info = (%s).as_handle_ref().basic_info().unwrap();
+	assert_eq!(info.object_type, ObjectType::from_raw(4));
+	assert_eq!(info.rights, Rights::from_bits(12).unwrap());
+}`
+
+	for _, tc := range []struct {
+		name     string
+		field    string
+		value    gidlir.Value
+		expected string
+	}{
+		{
+			name:     "restricted handle",
+			field:    "h",
+			value:    restricted,
+			expected: fmt.Sprintf(restrictedChecks, "(&value.h)"),
+		},
+		{
+			name:  "unrestricted handle",
+			field: "h",
+			value: unrestricted,
+		},
+		{
+			name:  "type only",
+			field: "h",
+			value: gidlir.HandleWithRights{Type: fidlgen.ObjectTypeChannel, Rights: fidlgen.HandleRightsSameRights},
+			expected: `{
+	let info = ((&value.h)).as_handle_ref().basic_info().unwrap();
+	assert_eq!(info.object_type, ObjectType::from_raw(4));
+}`,
+		},
+		{
+			name:     "nullable handle",
+			field:    "opt",
+			value:    restricted,
+			expected: fmt.Sprintf(restrictedChecks, "(&value.opt).as_ref().unwrap()"),
+		},
+		{
+			name:  "absent nullable handle",
+			field: "opt",
+			value: nil,
+		},
+		{
+			name:     "vector of handles",
+			field:    "v",
+			value:    []gidlir.Value{unrestricted, restricted},
+			expected: fmt.Sprintf(restrictedChecks, "(&(&value.v)[1])"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			value := gidlir.Record{
+				Name:   "HandleStruct",
+				Fields: []gidlir.Field{{Key: gidlir.FieldKey{Name: tc.field}, Value: tc.value}},
+			}
+			if actual := buildHandleChecks("value", value, decl); actual != tc.expected {
+				t.Errorf("got:\n%s\nwant:\n%s", actual, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package rust
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"text/template"
+
+	gidlconfig "go.fuchsia.dev/fuchsia/tools/fidl/gidl/config"
+	gidlir "go.fuchsia.dev/fuchsia/tools/fidl/gidl/ir"
+	gidllibrust "go.fuchsia.dev/fuchsia/tools/fidl/gidl/librust"
+	gidlmixer "go.fuchsia.dev/fuchsia/tools/fidl/gidl/mixer"
+	"go.fuchsia.dev/fuchsia/tools/fidl/lib/fidlgen"
+)
+
+var (
+	//go:embed round_trip.tmpl
+	roundTripTmplText string
+
+	roundTripTmpl = template.Must(template.New("roundTripTmpl").Parse(roundTripTmplText))
+)
+
+type roundTripTmplInput struct {
+	DependencyCrates []string
+	RoundTripCases   []roundTripCase
+}
+
+type roundTripCase struct {
+	Name, Context, ValueType, Bytes string
+}
+
+// GenerateRoundTripTests generates Rust tests that decode the bytes of each
+// success case and check that re-encoding the decoded value reproduces them.
+func GenerateRoundTripTests(gidl gidlir.All, fidl fidlgen.Root, config gidlconfig.GeneratorConfig) ([]byte, error) {
+	schema := gidlmixer.BuildSchema(fidl)
+	input := roundTripTmplInput{DependencyCrates: dependencyCrates(fidl)}
+	for _, decodeSuccess := range gidlir.RoundTripCases(gidl) {
+		// Decoded handles would have to be moved back out of the value to be
+		// re-encoded, which the one-way tests already cover.
+		if len(decodeSuccess.HandleDefs) != 0 {
+			continue
+		}
+		decl, err := schema.ExtractDeclaration(decodeSuccess.Value, decodeSuccess.HandleDefs)
+		if err != nil {
+			return nil, fmt.Errorf("round trip %s: %s", decodeSuccess.Name, err)
+		}
+		for _, encoding := range decodeSuccess.Encodings {
+			if !wireFormatSupported(encoding.WireFormat) {
+				continue
+			}
+			input.RoundTripCases = append(input.RoundTripCases, roundTripCase{
+				Name:      testCaseName(decodeSuccess.Name, encoding.WireFormat),
+				Context:   encodingContext(encoding.WireFormat),
+				ValueType: declName(decl),
+				Bytes:     gidllibrust.BuildBytes(encoding.Bytes),
+			})
+		}
+	}
+	var buf bytes.Buffer
+	err := roundTripTmpl.Execute(&buf, input)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,173 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testsharder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+)
+
+// reservedDimensions are the Swarming dimensions set from a shard's
+// environment, which board profiles may not override.
+var reservedDimensions = map[string]struct{}{
+	"device_type": {},
+	"os":          {},
+	"cpu":         {},
+	"testbed":     {},
+	"pool":        {},
+}
+
+// BenchmarkEnvTag is the environment tag that marks the shards of an
+// environment as benchmark runs.
+const BenchmarkEnvTag = "benchmark"
+
+// BenchmarkConfig describes how testrunner isolates the tests of a benchmark
+// shard from other activity on the device.
+type BenchmarkConfig struct {
+	// SetupCommand is run on the host once before any test in the shard runs.
+	// It is expected to pin the device's CPU performance governor and stop any
+	// services that compete with the benchmarks. It runs with the same
+	// environment as host tests, so it can reach the device.
+	SetupCommand []string `json:"setup_command,omitempty"`
+
+	// ThermalCommand is run on the host before and after each test and must
+	// print the device's current temperature in degrees Celsius to stdout.
+	ThermalCommand []string `json:"thermal_command,omitempty"`
+
+	// MaxTemperature is the temperature in degrees Celsius that the device must
+	// be at or below before a test starts.
+	MaxTemperature float64 `json:"max_temperature_celsius,omitempty"`
+
+	// ThermalTimeoutSecs is how long to wait for the device to cool down to
+	// MaxTemperature before running the test anyway. Defaults to 5 minutes.
+	ThermalTimeoutSecs int `json:"thermal_timeout_secs,omitempty"`
+}
+
+// BoardProfile holds the defaults for the shards that run on a device type,
+// so that knowledge about boards is kept in a config file rather than in the
+// recipes that run the shards.
+type BoardProfile struct {
+	// DeviceType is the device type of the environments the profile applies
+	// to.
+	DeviceType string `json:"device_type"`
+
+	// TestTimeoutSecs is the default timeout of the tests that run on the
+	// device type. It takes precedence over -per-test-timeout-secs, but not
+	// over the timeouts declared for tests in tests.json. If zero, no default
+	// is applied.
+	TestTimeoutSecs int `json:"test_timeout_secs,omitempty"`
+
+	// UseSerial specifies whether tests should be run on the device over
+	// serial rather than SSH.
+	UseSerial bool `json:"use_serial,omitempty"`
+
+	// Dimensions are Swarming dimensions to target in addition to those of
+	// the shard's environment.
+	Dimensions map[string]string `json:"dimensions,omitempty"`
+
+	// Benchmark describes how to isolate the tests of the benchmark shards
+	// that run on the device type, i.e. those of environments tagged with
+	// BenchmarkEnvTag.
+	Benchmark *BenchmarkConfig `json:"benchmark,omitempty"`
+}
+
+// LoadBoardProfiles loads the board profiles from a json manifest, keyed by
+// device type.
+func LoadBoardProfiles(manifestPath string) (map[string]BoardProfile, error) {
+	bytes, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []BoardProfile
+	if err := json.Unmarshal(bytes, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", manifestPath, err)
+	}
+
+	ret := make(map[string]BoardProfile)
+	for _, profile := range profiles {
+		if profile.DeviceType == "" {
+			return nil, fmt.Errorf("a board profile must have a non-empty device_type")
+		}
+		if _, ok := ret[profile.DeviceType]; ok {
+			return nil, fmt.Errorf("multiple board profiles for device type %q", profile.DeviceType)
+		}
+		if profile.TestTimeoutSecs < 0 {
+			return nil, fmt.Errorf("board profile for %q has a negative test_timeout_secs", profile.DeviceType)
+		}
+		if b := profile.Benchmark; b != nil && b.MaxTemperature > 0 && len(b.ThermalCommand) == 0 {
+			return nil, fmt.Errorf("board profile for %q sets max_temperature_celsius without a thermal_command", profile.DeviceType)
+		}
+		for key := range profile.Dimensions {
+			if _, ok := reservedDimensions[key]; ok {
+				return nil, fmt.Errorf("board profile for %q may not set the %q dimension, which is set by the test environment", profile.DeviceType, key)
+			}
+		}
+		ret[profile.DeviceType] = profile
+	}
+	return ret, nil
+}
+
+// ApplyBoardTestTimeouts sets the timeout of the tests in shards whose device
+// type has a profile with a test timeout. Timeouts already declared for tests
+// in tests.json take precedence.
+//
+// It must be called before shards are split by duration, so that the shard
+// timeouts account for the test timeouts.
+func ApplyBoardTestTimeouts(shards []*Shard, profiles map[string]BoardProfile) {
+	for _, shard := range shards {
+		profile, ok := profiles[shard.Env.Dimensions.DeviceType]
+		if !ok || profile.TestTimeoutSecs == 0 {
+			continue
+		}
+		for i := range shard.Tests {
+			if shard.Tests[i].Test.TimeoutSecs == 0 {
+				shard.Tests[i].Timeout = time.Duration(profile.TestTimeoutSecs) * time.Second
+			}
+		}
+	}
+}
+
+// ApplyBoardProfiles sets the connection preference and extra dimensions of
+// the shards whose device type has a profile. Profiles are looked up by the
+// device type of the shard's primary dimensions, so they don't apply to the
+// fallbacks of an environment.
+//
+// It also marks the shards of environments tagged with BenchmarkEnvTag as
+// benchmark runs, isolated as described by their profile, if any.
+func ApplyBoardProfiles(shards []*Shard, profiles map[string]BoardProfile) {
+	for _, shard := range shards {
+		profile, ok := profiles[shard.Env.Dimensions.DeviceType]
+		if isBenchmarkEnv(shard.Env) {
+			shard.Benchmark = &BenchmarkConfig{}
+			if profile.Benchmark != nil {
+				*shard.Benchmark = *profile.Benchmark
+			}
+		}
+		if !ok {
+			continue
+		}
+		shard.UseSerial = profile.UseSerial
+		if len(profile.Dimensions) == 0 {
+			continue
+		}
+		shard.ExtraDimensions = make(map[string]string, len(profile.Dimensions))
+		for key, value := range profile.Dimensions {
+			shard.ExtraDimensions[key] = value
+		}
+	}
+}
+
+func isBenchmarkEnv(env build.Environment) bool {
+	for _, tag := range env.Tags {
+		if tag == BenchmarkEnvTag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testsharder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+)
+
+func TestLoadBoardProfiles(t *testing.T) {
+	testCases := []struct {
+		name     string
+		manifest string
+		want     map[string]BoardProfile
+		wantErr  bool
+	}{
+		{
+			name: "valid profiles",
+			manifest: `[
+				{"device_type": "NUC", "test_timeout_secs": 600, "dimensions": {"kvm": "1"},
+				 "benchmark": {"thermal_command": ["thermal.sh"], "max_temperature_celsius": 50}},
+				{"device_type": "Vim3", "use_serial": true}
+			]`,
+			want: map[string]BoardProfile{
+				"NUC": {
+					DeviceType:      "NUC",
+					TestTimeoutSecs: 600,
+					Dimensions:      map[string]string{"kvm": "1"},
+					Benchmark: &BenchmarkConfig{
+						ThermalCommand: []string{"thermal.sh"},
+						MaxTemperature: 50,
+					},
+				},
+				"Vim3": {
+					DeviceType: "Vim3",
+					UseSerial:  true,
+				},
+			},
+		},
+		{
+			name:     "missing device type",
+			manifest: `[{"test_timeout_secs": 600}]`,
+			wantErr:  true,
+		},
+		{
+			name:     "duplicate device type",
+			manifest: `[{"device_type": "NUC"}, {"device_type": "NUC", "use_serial": true}]`,
+			wantErr:  true,
+		},
+		{
+			name:     "negative timeout",
+			manifest: `[{"device_type": "NUC", "test_timeout_secs": -1}]`,
+			wantErr:  true,
+		},
+		{
+			name:     "reserved dimension",
+			manifest: `[{"device_type": "NUC", "dimensions": {"pool": "other"}}]`,
+			wantErr:  true,
+		},
+		{
+			name:     "max temperature without thermal command",
+			manifest: `[{"device_type": "NUC", "benchmark": {"max_temperature_celsius": 50}}]`,
+			wantErr:  true,
+		},
+		{
+			name:     "malformed manifest",
+			manifest: `{"device_type": "NUC"}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "board_profiles.json")
+			if err := os.WriteFile(path, []byte(tc.manifest), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadBoardProfiles(path)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("LoadBoardProfiles() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadBoardProfiles() failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("LoadBoardProfiles() returned wrong profiles (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func boardProfileShards() []*Shard {
+	return []*Shard{
+		{
+			Name: "NUC",
+			Env:  build.Environment{Dimensions: build.DimensionSet{DeviceType: "NUC"}},
+			Tests: []Test{
+				{Test: build.Test{Name: "test1", OS: fuchsia}, Timeout: 5 * time.Minute},
+				{Test: build.Test{Name: "test2", OS: fuchsia, TimeoutSecs: 60}, Timeout: time.Minute},
+			},
+		},
+		{
+			Name: "Vim3",
+			Env:  build.Environment{Dimensions: build.DimensionSet{DeviceType: "Vim3"}},
+			Tests: []Test{
+				{Test: build.Test{Name: "test3", OS: fuchsia}, Timeout: 5 * time.Minute},
+			},
+		},
+		{
+			Name: "Linux",
+			Env:  build.Environment{Dimensions: build.DimensionSet{OS: "Linux"}},
+			Tests: []Test{
+				{Test: build.Test{Name: "test4", OS: linux}, Timeout: 5 * time.Minute},
+			},
+		},
+		{
+			Name: "NUC-benchmark",
+			Env:  build.Environment{Dimensions: build.DimensionSet{DeviceType: "NUC"}, Tags: []string{BenchmarkEnvTag}},
+			Tests: []Test{
+				{Test: build.Test{Name: "test5", OS: fuchsia}, Timeout: 5 * time.Minute},
+			},
+		},
+		{
+			Name: "Vim3-benchmark",
+			Env:  build.Environment{Dimensions: build.DimensionSet{DeviceType: "Vim3"}, Tags: []string{BenchmarkEnvTag}},
+			Tests: []Test{
+				{Test: build.Test{Name: "test6", OS: fuchsia}, Timeout: 5 * time.Minute},
+			},
+		},
+	}
+}
+
+var testBoardProfiles = map[string]BoardProfile{
+	"NUC": {
+		DeviceType:      "NUC",
+		TestTimeoutSecs: 600,
+		Dimensions:      map[string]string{"kvm": "1"},
+		Benchmark:       &BenchmarkConfig{SetupCommand: []string{"setup.sh"}},
+	},
+	"Vim3": {
+		DeviceType: "Vim3",
+		UseSerial:  true,
+	},
+}
+
+func TestApplyBoardTestTimeouts(t *testing.T) {
+	shards := boardProfileShards()
+	ApplyBoardTestTimeouts(shards, testBoardProfiles)
+
+	want := map[string]time.Duration{
+		// Overridden by the NUC profile.
+		"test1": 10 * time.Minute,
+		// Declared in tests.json.
+		"test2": time.Minute,
+		// The Vim3 profile has no test timeout.
+		"test3": 5 * time.Minute,
+		// Host tests have no profile.
+		"test4": 5 * time.Minute,
+		"test5": 10 * time.Minute,
+		"test6": 5 * time.Minute,
+	}
+	for _, shard := range shards {
+		for _, test := range shard.Tests {
+			if test.Timeout != want[test.Name] {
+				t.Errorf("Test %s has wrong timeout %s, wanted %s", test.Name, test.Timeout, want[test.Name])
+			}
+		}
+	}
+}
+
+func TestApplyBoardProfiles(t *testing.T) {
+	shards := boardProfileShards()
+	ApplyBoardProfiles(shards, testBoardProfiles)
+
+	type shardDefaults struct {
+		UseSerial       bool
+		ExtraDimensions map[string]string
+		Benchmark       *BenchmarkConfig
+	}
+	want := map[string]shardDefaults{
+		"NUC":   {ExtraDimensions: map[string]string{"kvm": "1"}},
+		"Vim3":  {UseSerial: true},
+		"Linux": {},
+		"NUC-benchmark": {
+			ExtraDimensions: map[string]string{"kvm": "1"},
+			Benchmark:       &BenchmarkConfig{SetupCommand: []string{"setup.sh"}},
+		},
+		// Benchmark shards are run one at a time even without a profile
+		// that describes how to isolate them.
+		"Vim3-benchmark": {UseSerial: true, Benchmark: &BenchmarkConfig{}},
+	}
+	for _, shard := range shards {
+		got := shardDefaults{UseSerial: shard.UseSerial, ExtraDimensions: shard.ExtraDimensions, Benchmark: shard.Benchmark}
+		if diff := cmp.Diff(want[shard.Name], got); diff != "" {
+			t.Errorf("Shard %s has wrong defaults (-want +got):\n%s", shard.Name, diff)
+		}
+	}
+
+	// Shards must not share the profile's dimensions.
+	shards[0].ExtraDimensions["kvm"] = "0"
+	if got := testBoardProfiles["NUC"].Dimensions["kvm"]; got != "1" {
+		t.Errorf("Modifying a shard's dimensions modified the profile")
+	}
+	shards[3].Benchmark.SetupCommand = nil
+	if testBoardProfiles["NUC"].Benchmark.SetupCommand == nil {
+		t.Errorf("Modifying a shard's benchmark config modified the profile")
+	}
+}
@@ -36,6 +36,7 @@ type testsharderFlags struct {
 	outputFile                     string
 	tags                           flagmisc.StringsValue
 	modifiersPath                  string
+	boardProfilesPath              string
 	targetTestCount                int
 	targetDurationSecs             int
 	perTestTimeoutSecs             int
@@ -52,6 +53,9 @@ type testsharderFlags struct {
 	skipUnaffected                 bool
 	perShardPackageRepos           bool
 	cacheTestPackages              bool
+	local                          bool
+	localDevices                   flagmisc.StringsValue
+	localScript                    string
 }
 
 func parseFlags() testsharderFlags {
@@ -60,6 +64,7 @@ func parseFlags() testsharderFlags {
 	flag.StringVar(&flags.outputFile, "output-file", "", "path to a file which will contain the shards as JSON, default is stdout")
 	flag.Var(&flags.tags, "tag", "environment tags on which to filter; only the tests that match all tags will be sharded")
 	flag.StringVar(&flags.modifiersPath, "modifiers", "", "path to the json manifest containing tests to modify")
+	flag.StringVar(&flags.boardProfilesPath, "board-profiles", "", "path to the json manifest containing the default test timeout, serial preference, extra dimensions and benchmark isolation of each device type")
 	flag.IntVar(&flags.targetDurationSecs, "target-duration-secs", 0, "approximate duration that each shard should run in")
 	flag.IntVar(&flags.maxShardsPerEnvironment, "max-shards-per-env", 8, "maximum shards allowed per environment. If <= 0, no max will be set")
 	// TODO(fxbug.dev/10456): Support different timeouts for different tests.
@@ -82,6 +87,9 @@ func parseFlags() testsharderFlags {
 	flag.BoolVar(&flags.skipUnaffected, "skip-unaffected", false, "whether the shards should ignore hermetic, unaffected tests")
 	flag.BoolVar(&flags.perShardPackageRepos, "per-shard-package-repos", false, "whether to construct a local package repo for each shard")
 	flag.BoolVar(&flags.cacheTestPackages, "cache-test-packages", false, "whether the test packages should be cached on disk in the local package repo")
+	flag.BoolVar(&flags.local, "local", false, "whether to shard for local devices instead of the infrastructure: all tests are placed into one shard per -local-device")
+	flag.Var(&flags.localDevices, "local-device", "nodename of a local device to shard across; may be repeated. If unset, a single shard targeting the default device is produced. Requires -local")
+	flag.StringVar(&flags.localScript, "local-script", "", "path to which to write a bash script that runs the local shards. Requires -local")
 	flag.Usage = usage
 
 	flag.Parse()
@@ -118,6 +126,7 @@ func mainImpl(ctx context.Context) error {
 }
 
 type buildModules interface {
+	Args() build.Args
 	Images() []build.Image
 	Platforms() []build.DimensionSet
 	TestSpecs() []build.TestSpec
@@ -132,6 +141,10 @@ func execute(ctx context.Context, flags testsharderFlags, m buildModules) error
 		return fmt.Errorf("max-shard-size and target-duration-secs cannot both be set")
 	}
 
+	if !flags.local && (len(flags.localDevices) > 0 || flags.localScript != "") {
+		return fmt.Errorf("-local-device and -local-script require -local")
+	}
+
 	perTestTimeout := time.Duration(flags.perTestTimeoutSecs) * time.Second
 
 	if err := testsharder.ValidateTests(m.TestSpecs(), m.Platforms()); err != nil {
@@ -153,6 +166,15 @@ func execute(ctx context.Context, flags testsharderFlags, m buildModules) error
 		testsharder.ApplyTestTimeouts(shards, perTestTimeout)
 	}
 
+	var boardProfiles map[string]testsharder.BoardProfile
+	if flags.boardProfilesPath != "" {
+		boardProfiles, err = testsharder.LoadBoardProfiles(flags.boardProfilesPath)
+		if err != nil {
+			return err
+		}
+		testsharder.ApplyBoardTestTimeouts(shards, boardProfiles)
+	}
+
 	testDurations := testsharder.NewTestDurationsMap(m.TestDurations())
 	shards = testsharder.AddExpectedDurationTags(shards, testDurations)
 
@@ -168,6 +190,13 @@ func execute(ctx context.Context, flags testsharderFlags, m buildModules) error
 		}
 	}
 
+	// Pull out the tests that are pinned to named shards before any
+	// partitioning or balancing so they end up exactly where requested.
+	namedShards, shards, err := testsharder.SplitOutNamedShards(shards)
+	if err != nil {
+		return err
+	}
+
 	// Remove the multiplied shards from the set of shards to analyze for
 	// affected tests, as we want to run these shards regardless of whether
 	// the associated tests are affected.
@@ -202,6 +231,10 @@ func execute(ctx context.Context, flags testsharderFlags, m buildModules) error
 		if err != nil {
 			return err
 		}
+		namedShards, err = testsharder.ApplyModifiers(namedShards, affectedModifiers)
+		if err != nil {
+			return err
+		}
 	} else {
 		// If no affected-tests file was provided, we don't know which tests
 		// were affected, so run all tests.
@@ -222,6 +255,9 @@ func execute(ctx context.Context, flags testsharderFlags, m buildModules) error
 		}
 		affectedShards, _ := testsharder.PartitionShards(nonMultipliedShards, affected, testsharder.AffectedShardPrefix)
 		shards = affectedShards
+		// Pinning a test to a shard doesn't exempt it from the filter. The
+		// named shards keep their names, and those left empty are dropped.
+		namedShards, _ = testsharder.PartitionShards(namedShards, affected, "")
 	} else {
 		// Filter out the affected, hermetic shards from the non-multiplied shards.
 		hermeticAndAffected := func(t testsharder.Test) bool {
@@ -262,6 +298,17 @@ func execute(ctx context.Context, flags testsharderFlags, m buildModules) error
 	multipliedAffectedShards = testsharder.SplitOutMultipliers(ctx, multipliedAffectedShards, testDurations, targetDuration, flags.targetTestCount, testsharder.AffectedShardPrefix)
 	shards = append(multipliedAffectedShards, shards...)
 	shards = append(shards, multipliedShards...)
+	testsharder.ApplyNamedShardTimeouts(namedShards, testDurations)
+	shards = append(shards, namedShards...)
+
+	if flags.local {
+		// Local devices run everything that would otherwise be spread across
+		// environments, and there are no results to upload for skipped
+		// shards.
+		shards = testsharder.LocalShards(shards, flags.localDevices, testDurations)
+		skippedShards = nil
+	}
+	testsharder.WarnSharedIsolationGroups(ctx, shards)
 
 	if flags.imageDeps || flags.hermeticDeps || flags.ffxDeps {
 		for _, s := range shards {
@@ -303,6 +350,24 @@ func execute(ctx context.Context, flags testsharderFlags, m buildModules) error
 		testsharder.ApplyRealmLabel(shards, flags.realmLabel)
 	}
 
+	testsharder.ApplyBoardProfiles(shards, boardProfiles)
+
+	product, board, err := buildInfo(m.Args())
+	if err != nil {
+		return err
+	}
+	// Skipped shards are included so that results uploaded for them are
+	// attributed to the right product and board.
+	testsharder.ApplyBuildInfo(shards, product, board)
+	testsharder.ApplyBuildInfo(skippedShards, product, board)
+
+	// The script is written once the tests have all their options.
+	if flags.localScript != "" {
+		if err := writeLocalScript(flags.localScript, shards, flags.localDevices, flags.buildDir); err != nil {
+			return err
+		}
+	}
+
 	// Add back the skipped shards so that we can process and upload results
 	// downstream.
 	shards = append(shards, skippedShards...)
@@ -325,3 +390,33 @@ func execute(ctx context.Context, flags testsharderFlags, m buildModules) error
 	}
 	return nil
 }
+
+// buildInfo returns the product and board the build was configured with. They
+// are empty if the build doesn't record them.
+func buildInfo(args build.Args) (string, string, error) {
+	var values [2]string
+	for i, name := range []string{"build_info_product", "build_info_board"} {
+		val, err := args.StringValue(name)
+		if err != nil && !errors.Is(err, build.ErrArgNotSet) {
+			return "", "", fmt.Errorf("failed to read %s from args.json: %w", name, err)
+		}
+		values[i] = val
+	}
+	return values[0], values[1], nil
+}
+
+func writeLocalScript(path string, shards []*testsharder.Shard, nodenames []string, buildDir string) error {
+	absBuildDir, err := filepath.Abs(buildDir)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := testsharder.WriteLocalScript(f, shards, nodenames, absBuildDir); err != nil {
+		return fmt.Errorf("failed to write local script: %w", err)
+	}
+	return f.Close()
+}
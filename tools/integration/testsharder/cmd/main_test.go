@@ -6,6 +6,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -455,7 +456,78 @@ func TestExecute(t *testing.T) {
 	}
 }
 
+func TestExecuteAffectedOnlyNamedShards(t *testing.T) {
+	buildDir := t.TempDir()
+	if err := jsonutil.WriteToFile(
+		filepath.Join(buildDir, testListPath),
+		build.TestList{SchemaID: "experimental"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	flags := testsharderFlags{
+		buildDir:           buildDir,
+		outputFile:         filepath.Join(t.TempDir(), "shards.json"),
+		affectedOnly:       true,
+		targetDurationSecs: 5,
+		modifiersPath: writeTempJSONFile(t, []testsharder.TestModifier{
+			{Name: packageURL("foo"), TotalRuns: -1, ShardName: "warm"},
+			{Name: packageURL("bar"), TotalRuns: -1, ShardName: "warm"},
+		}),
+		affectedTestsPath: writeTempFile(t, packageURL("foo")+"\n"),
+	}
+	m := &fakeModules{
+		testSpecs: []build.TestSpec{
+			fuchsiaTestSpec("foo"),
+			fuchsiaTestSpec("bar"),
+			fuchsiaTestSpec("baz"),
+		},
+	}
+	if err := execute(context.Background(), flags, m); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the affected test is run, even though the unaffected bar is
+	// pinned to the same shard.
+	got := make(map[string][]string)
+	for _, shard := range readShards(t, flags.outputFile) {
+		for _, test := range shard.Tests {
+			got[shard.Name] = append(got[shard.Name], test.Name)
+		}
+	}
+	want := map[string][]string{"warm": {packageURL("foo")}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected shards (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	args := build.Args{
+		"build_info_product": json.RawMessage(`"core"`),
+		"build_info_board":   json.RawMessage(`"x64"`),
+	}
+	product, board, err := buildInfo(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product != "core" || board != "x64" {
+		t.Errorf("got product %q and board %q, want \"core\" and \"x64\"", product, board)
+	}
+
+	product, board, err = buildInfo(build.Args{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product != "" || board != "" {
+		t.Errorf("got product %q and board %q for a build without them, want empty strings", product, board)
+	}
+
+	if _, _, err := buildInfo(build.Args{"build_info_board": json.RawMessage(`true`)}); err == nil {
+		t.Errorf("expected an error for a non-string build_info_board")
+	}
+}
+
 type fakeModules struct {
+	args                build.Args
 	images              []build.Image
 	testSpecs           []build.TestSpec
 	testList            string
@@ -463,6 +535,8 @@ type fakeModules struct {
 	packageRepositories []build.PackageRepo
 }
 
+func (m *fakeModules) Args() build.Args { return m.args }
+
 func (m *fakeModules) Platforms() []build.DimensionSet {
 	return []build.DimensionSet{
 		{
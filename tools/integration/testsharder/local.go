@@ -0,0 +1,183 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testsharder
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// LocalShardPrefix is the prefix of the names of shards produced by
+// LocalShards.
+const LocalShardPrefix = "local"
+
+// LocalShards collapses shards into one shard per local device, so that
+// developers can use the same sharding logic as the infrastructure against
+// their own devices. Tests are balanced across the devices by expected
+// duration. If no device nodenames are given, a single shard targeting the
+// default device is returned.
+//
+// A test that runs in several environments is only run once. The local shards
+// take the environment of the first shard that targets a Fuchsia device, as
+// steps such as adding image deps rely on it, or that of the first shard if
+// none does.
+func LocalShards(shards []*Shard, nodenames []string, testDurations TestDurationsMap) []*Shard {
+	merged := &Shard{Name: LocalShardPrefix}
+	if len(shards) > 0 {
+		merged.Env = shards[0].Env
+	}
+	for _, s := range shards {
+		if s.Env.Dimensions.DeviceType != "" {
+			merged.Env = s.Env
+			break
+		}
+	}
+	seen := make(map[string]struct{})
+	for _, s := range shards {
+		for _, t := range s.Tests {
+			if _, ok := seen[t.Name]; ok {
+				continue
+			}
+			seen[t.Name] = struct{}{}
+			merged.Tests = append(merged.Tests, t)
+		}
+	}
+	if len(merged.Tests) == 0 {
+		return nil
+	}
+	if len(nodenames) == 0 {
+		return shardByTime(merged, testDurations, 1)
+	}
+
+	localShards := shardByTime(merged, testDurations, min(len(nodenames), len(merged.Tests)))
+	for i, s := range localShards {
+		s.Name = localShardName(nodenames[i])
+	}
+	return localShards
+}
+
+func localShardName(nodename string) string {
+	return fmt.Sprintf("%s-%s", LocalShardPrefix, nodename)
+}
+
+// WriteLocalScript writes a bash script that runs the given shards, as
+// produced by LocalShards, from within buildDir. It should be called once all
+// modifiers have been applied to the tests, so that they are run with the same
+// options as in the infrastructure. The shards for different
+// devices run in parallel and the script fails if any test fails.
+func WriteLocalScript(w io.Writer, shards []*Shard, nodenames []string, buildDir string) error {
+	var b strings.Builder
+	b.WriteString("#!/bin/bash\n")
+	b.WriteString("# Generated by `testsharder -local`. Do not edit.\n\n")
+	b.WriteString("set -o pipefail\n\n")
+	fmt.Fprintf(&b, "cd %s || exit 1\n\n", shellQuote(buildDir))
+
+	// Map each shard back to the device it targets.
+	devices := make(map[string]string)
+	for _, n := range nodenames {
+		devices[localShardName(n)] = n
+	}
+
+	for i, s := range shards {
+		fmt.Fprintf(&b, "# %s: %d tests\n", s.Name, len(s.Tests))
+		fmt.Fprintf(&b, "shard_%d() {\n", i)
+		b.WriteString("  local status=0\n")
+		for _, t := range s.Tests {
+			runs := t.Runs
+			if runs < 1 {
+				runs = 1
+			}
+			cmd := localTestCommand(t, devices[s.Name])
+			if runs == 1 {
+				fmt.Fprintf(&b, "  %s || status=1\n", cmd)
+			} else {
+				fmt.Fprintf(&b, "  for _ in $(seq %d); do %s || status=1; done\n", runs, cmd)
+			}
+		}
+		b.WriteString("  return $status\n")
+		b.WriteString("}\n\n")
+	}
+
+	b.WriteString("pids=()\n")
+	for i := range shards {
+		fmt.Fprintf(&b, "shard_%d &\npids+=($!)\n", i)
+	}
+	b.WriteString("status=0\n")
+	b.WriteString("for pid in \"${pids[@]}\"; do\n  wait \"$pid\" || status=1\ndone\n")
+	b.WriteString("exit $status\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// localTestCommand returns the shell command that runs t once. If nodename is
+// empty, the command targets the default device. Fuchsia tests are passed the
+// same options as testrunner passes them.
+func localTestCommand(t Test, nodename string) string {
+	if t.OS != "fuchsia" {
+		return shellQuote("./" + t.Path)
+	}
+	var args []string
+	if !t.IsComponentV2() {
+		args = []string{"fx"}
+		if nodename != "" {
+			args = append(args, "-d", nodename)
+		}
+		// Tests without a package, e.g. those in bootfs, are left to fx
+		// to find.
+		if t.PackageURL == "" {
+			return shellJoin(append(args, "test", t.Name))
+		}
+		args = append(args, "shell", "run-test-component")
+		if t.LogSettings.MaxSeverity != "" {
+			args = append(args, fmt.Sprintf("--max-log-severity=%s", t.LogSettings.MaxSeverity))
+		}
+		if t.Timeout > 0 {
+			args = append(args, fmt.Sprintf("--timeout=%d", int(t.Timeout/time.Second)))
+		}
+		if t.RealmLabel != "" {
+			args = append(args, "--realm-label", t.RealmLabel)
+		}
+		args = append(args, t.PackageURL)
+		return shellJoin(args)
+	}
+	args = []string{"ffx"}
+	if nodename != "" {
+		args = append(args, "-t", nodename)
+	}
+	args = append(args, "test", "run")
+	if t.LogSettings.MaxSeverity != "" {
+		args = append(args, "--max-severity-logs", t.LogSettings.MaxSeverity)
+	}
+	if t.Parallel != 0 {
+		args = append(args, "--parallel", fmt.Sprintf("%d", t.Parallel))
+	}
+	if t.Timeout > 0 {
+		args = append(args, "--timeout", fmt.Sprintf("%d", int(t.Timeout/time.Second)))
+	}
+	args = append(args, t.PackageURL)
+	return shellJoin(args)
+}
+
+func shellJoin(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, a := range args {
+		quoted = append(quoted, shellQuote(a))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes s for use as a single word in a POSIX shell command, if
+// necessary.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=+@", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
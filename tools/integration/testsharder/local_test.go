@@ -0,0 +1,134 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testsharder
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+)
+
+func TestLocalShards(t *testing.T) {
+	env1 := build.Environment{Dimensions: build.DimensionSet{DeviceType: "QEMU"}}
+	env2 := build.Environment{Dimensions: build.DimensionSet{DeviceType: "NUC"}}
+	env3 := build.Environment{Dimensions: build.DimensionSet{OS: "linux"}}
+	shards := []*Shard{
+		fuchsiaShard(env1, 1, 2, 3),
+		// Test 1 also runs in env2 but should only run once locally.
+		fuchsiaShard(env2, 1, 4),
+		shard(env3, "linux", 5),
+	}
+	testDurations := NewTestDurationsMap([]build.TestDuration{
+		{Name: "*", MedianDuration: time.Second},
+	})
+
+	t.Run("default device", func(t *testing.T) {
+		got := LocalShards(shards, nil, testDurations)
+		if len(got) != 1 {
+			t.Fatalf("got %d shards, want 1", len(got))
+		}
+		if got[0].Name != LocalShardPrefix {
+			t.Errorf("got shard name %q, want %q", got[0].Name, LocalShardPrefix)
+		}
+		// The shard targets a device like those of the merged shards.
+		if diff := cmp.Diff(env1, got[0].Env); diff != "" {
+			t.Errorf("unexpected shard environment (-want +got):\n%s", diff)
+		}
+		assertShardsContainTests(t, got, [][]string{{
+			fullTestName(1, "fuchsia"),
+			fullTestName(2, "fuchsia"),
+			fullTestName(3, "fuchsia"),
+			fullTestName(4, "fuchsia"),
+			fullTestName(5, "linux"),
+		}})
+	})
+
+	t.Run("multiple devices", func(t *testing.T) {
+		got := LocalShards(shards, []string{"foo", "bar"}, testDurations)
+		var names []string
+		var total int
+		for _, s := range got {
+			names = append(names, s.Name)
+			total += len(s.Tests)
+		}
+		if diff := cmp.Diff([]string{"local-foo", "local-bar"}, names); diff != "" {
+			t.Errorf("unexpected shard names (-want +got):\n%s", diff)
+		}
+		if total != 5 {
+			t.Errorf("got %d tests across shards, want 5", total)
+		}
+	})
+
+	t.Run("more devices than tests", func(t *testing.T) {
+		got := LocalShards(shards[2:], []string{"foo", "bar"}, testDurations)
+		if len(got) != 1 || got[0].Name != "local-foo" {
+			t.Errorf("expected a single shard for the first device, got %+v", got)
+		}
+		if len(got) > 0 {
+			if diff := cmp.Diff(env3, got[0].Env); diff != "" {
+				t.Errorf("unexpected shard environment (-want +got):\n%s", diff)
+			}
+		}
+	})
+}
+
+func TestWriteLocalScript(t *testing.T) {
+	v2Test := Test{
+		Test: build.Test{
+			Name:       "fuchsia-pkg://fuchsia.com/foo#meta/foo.cm",
+			PackageURL: "fuchsia-pkg://fuchsia.com/foo#meta/foo.cm",
+			OS:         "fuchsia",
+			LogSettings: build.LogSettings{
+				MaxSeverity: "ERROR",
+			},
+			Parallel: 4,
+		},
+		Runs:    2,
+		Timeout: time.Minute,
+	}
+	v1Test := Test{
+		Test: build.Test{
+			Name:       "fuchsia-pkg://fuchsia.com/baz#meta/baz.cmx",
+			PackageURL: "fuchsia-pkg://fuchsia.com/baz#meta/baz.cmx",
+			OS:         "fuchsia",
+		},
+		RealmLabel: "testrunner",
+		Timeout:    time.Minute,
+	}
+	hostTest := Test{
+		Test: build.Test{
+			Name: "host_x64/bar test",
+			Path: "host_x64/bar test",
+			OS:   "linux",
+		},
+		Runs: 1,
+	}
+	shards := []*Shard{
+		{Name: "local-foo", Tests: []Test{v2Test, v1Test}},
+		{Name: "local-bar", Tests: []Test{hostTest}},
+	}
+
+	var b strings.Builder
+	if err := WriteLocalScript(&b, shards, []string{"foo", "bar"}, "/out/default"); err != nil {
+		t.Fatalf("WriteLocalScript() failed: %s", err)
+	}
+	script := b.String()
+	for _, want := range []string{
+		"cd /out/default || exit 1\n",
+		"  for _ in $(seq 2); do ffx -t foo test run --max-severity-logs ERROR --parallel 4 --timeout 60 'fuchsia-pkg://fuchsia.com/foo#meta/foo.cm' || status=1; done\n",
+		"  fx -d foo shell run-test-component --timeout=60 --realm-label testrunner 'fuchsia-pkg://fuchsia.com/baz#meta/baz.cmx' || status=1\n",
+		"  './host_x64/bar test' || status=1\n",
+		"shard_0 &\n",
+		"shard_1 &\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script does not contain %q:\n%s", want, script)
+		}
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"go.fuchsia.dev/fuchsia/tools/build"
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
 	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
 )
 
@@ -58,6 +59,10 @@ var errMultipleDefaultModifiers = fmt.Errorf("too many default modifiers, only o
 // contain an affected test.
 var errSkippedAffectedTest = fmt.Errorf("attempted to skip an affected test")
 
+// SplitOutNamedShards will return an error that unwraps to this if tests from
+// different environments are pinned to the same shard name.
+var errNamedShardMultipleEnvs = fmt.Errorf("tests pinned to the same shard must share an environment")
+
 func ExtractDeps(shards []*Shard, fuchsiaBuildDir string) error {
 	for _, shard := range shards {
 		if err := extractDepsFromShard(shard, fuchsiaBuildDir); err != nil {
@@ -345,6 +350,61 @@ func PartitionShards(shards []*Shard, partitionFunc func(Test) bool, prefix stri
 	return matchingShards, nonmatchingShards
 }
 
+// SplitOutNamedShards removes the tests that are pinned to a shard by name
+// from shards and groups them into shards with exactly those names. The named
+// shards are returned first, in order of first appearance, followed by the
+// remaining shards. Named shards are not meant to be rebalanced further, so
+// their timeouts must be set by ApplyNamedShardTimeouts once all modifiers
+// have been applied to them.
+func SplitOutNamedShards(shards []*Shard) ([]*Shard, []*Shard, error) {
+	var namedShards []*Shard
+	namedShardsByName := make(map[string]*Shard)
+	remainingShards := make([]*Shard, 0, len(shards))
+	for _, shard := range shards {
+		var remaining []Test
+		for _, test := range shard.Tests {
+			if test.ShardName == "" {
+				remaining = append(remaining, test)
+				continue
+			}
+			named, ok := namedShardsByName[test.ShardName]
+			if !ok {
+				named = &Shard{
+					Name: test.ShardName,
+					Env:  shard.Env,
+				}
+				namedShardsByName[test.ShardName] = named
+				namedShards = append(namedShards, named)
+			} else if fmt.Sprintf("%v", named.Env) != fmt.Sprintf("%v", shard.Env) {
+				// Compare the whole environments rather than their names,
+				// which leave out e.g. image overrides, so that distinct
+				// environments are never merged into one shard.
+				return nil, nil, fmt.Errorf("%w: shard %q has tests for %+v and %+v",
+					errNamedShardMultipleEnvs, test.ShardName, named.Env, shard.Env)
+			}
+			named.Tests = append(named.Tests, test)
+		}
+		if len(remaining) > 0 {
+			shard.Tests = remaining
+			remainingShards = append(remainingShards, shard)
+		}
+	}
+	return namedShards, remainingShards, nil
+}
+
+// ApplyNamedShardTimeouts sets the timeouts of the shards returned by
+// SplitOutNamedShards from the expected durations and number of runs of their
+// tests.
+func ApplyNamedShardTimeouts(namedShards []*Shard, testDurations TestDurationsMap) {
+	for _, named := range namedShards {
+		var duration time.Duration
+		for _, test := range named.Tests {
+			duration += testDurations.Get(test).MedianDuration * time.Duration(test.minRequiredRuns())
+		}
+		named.TimeoutSecs = int(computeShardTimeout(subshard{duration, named.Tests}).Seconds())
+	}
+}
+
 // MarkShardsSkipped marks the entire set of shards skipped.
 func MarkShardsSkipped(shards []*Shard) ([]*Shard, error) {
 	var newShards []*Shard
@@ -427,10 +487,11 @@ func WithTargetDuration(
 				// If any single test is expected to take longer than `targetDuration`,
 				// it's no use creating shards whose entire expected runtimes are
 				// shorter than that one test. So in that case we use the longest test's
-				// expected duration as the target duration.
+				// expected duration as the target duration. Tests that can be
+				// split into parts are exempt, since they're split instead.
 				for _, t := range shard.Tests {
 					duration := testDurations.Get(t).MedianDuration
-					if duration > targetDuration {
+					if duration > targetDuration && !t.testShardable() {
 						targetDuration = duration
 					}
 					shardDuration += duration * time.Duration(t.minRequiredRuns())
@@ -520,6 +581,76 @@ func (h *subshardHeap) Pop() interface{} {
 	return s
 }
 
+// popSubshard removes and returns the subshard with the lowest duration that
+// has no test in the isolation group, or the subshard with the lowest duration
+// if they all do.
+func popSubshard(h *subshardHeap, group string) subshard {
+	if group == "" {
+		return heap.Pop(h).(subshard)
+	}
+	var skipped []subshard
+	defer func() {
+		for _, ss := range skipped {
+			heap.Push(h, ss)
+		}
+	}()
+	for h.Len() > 0 {
+		ss := heap.Pop(h).(subshard)
+		if !ss.hasIsolationGroup(group) {
+			return ss
+		}
+		skipped = append(skipped, ss)
+	}
+	// All of the subshards have a test in the group. Take the first one
+	// popped, which has the lowest duration.
+	ss := skipped[0]
+	skipped = skipped[1:]
+	return ss
+}
+
+func (s subshard) hasIsolationGroup(group string) bool {
+	for _, test := range s.tests {
+		if test.IsolationGroup == group {
+			return true
+		}
+	}
+	return false
+}
+
+// WarnSharedIsolationGroups logs a warning for each shard that runs more than
+// one test of an isolation group. Groups are only honored when shards are
+// split by duration, and even then a group may have more tests than there are
+// shards.
+func WarnSharedIsolationGroups(ctx context.Context, shards []*Shard) {
+	for _, s := range shards {
+		for _, group := range sharedIsolationGroups(s) {
+			logger.Warningf(ctx, "shard %s runs more than one test of isolation group %q", s.Name, group)
+		}
+	}
+}
+
+// sharedIsolationGroups returns the isolation groups that more than one test
+// in the shard belongs to, in order of first appearance.
+func sharedIsolationGroups(s *Shard) []string {
+	testsPerGroup := make(map[string]map[string]struct{})
+	var groups []string
+	for _, test := range s.Tests {
+		if test.IsolationGroup == "" {
+			continue
+		}
+		tests, ok := testsPerGroup[test.IsolationGroup]
+		if !ok {
+			tests = make(map[string]struct{})
+			testsPerGroup[test.IsolationGroup] = tests
+		}
+		tests[test.Name] = struct{}{}
+		if len(tests) == 2 {
+			groups = append(groups, test.IsolationGroup)
+		}
+	}
+	return groups
+}
+
 // shardByTime breaks a single original shard into numNewShards subshards such
 // that each subshard has approximately the same expected total duration.
 //
@@ -529,8 +660,18 @@ func (h *subshardHeap) Pop() interface{} {
 // successively allocates each test to the subshard with the lowest total
 // expected duration so far.
 //
+// Host tests that support Bazel's test sharding protocol and are expected to
+// take longer than a subshard's share of the total duration are split into
+// parts, each assigned to a different subshard, instead of running whole.
+//
 // Within each returned shard, tests will be sorted pseudo-randomly.
 func shardByTime(shard *Shard, testDurations TestDurationsMap, numNewShards int) []*Shard {
+	var totalDuration time.Duration
+	for _, test := range shard.Tests {
+		totalDuration += testDurations.Get(test).MedianDuration * time.Duration(test.minRequiredRuns())
+	}
+	durationPerShard := totalDuration / time.Duration(numNewShards)
+
 	sort.Slice(shard.Tests, func(index1, index2 int) bool {
 		test1, test2 := shard.Tests[index1], shard.Tests[index2]
 		duration1 := testDurations.Get(test1).MedianDuration
@@ -561,6 +702,27 @@ func shardByTime(shard *Shard, testDurations TestDurationsMap, numNewShards int)
 		if splitAcrossShards {
 			shardsPerTest = numNewShards
 		}
+		if !splitAcrossShards && test.testShardable() && durationPerShard > 0 {
+			duration := testDurations.Get(test).MedianDuration
+			if parts := min(divRoundUp(int(duration), int(durationPerShard)), numNewShards); parts > 1 {
+				// Pop the subshards for all the parts before pushing any
+				// back, so that each part lands in a different subshard.
+				subshards := make([]subshard, 0, parts)
+				for i := 0; i < parts; i++ {
+					testCopy := test
+					testCopy.TestTotalShards = parts
+					testCopy.TestShardIndex = i
+					ss := popSubshard(&h, test.IsolationGroup)
+					ss.duration += duration / time.Duration(parts) * time.Duration(testCopy.minRequiredRuns())
+					ss.tests = append(ss.tests, testCopy)
+					subshards = append(subshards, ss)
+				}
+				for _, ss := range subshards {
+					heap.Push(&h, ss)
+				}
+				continue
+			}
+		}
 		runsPerShard := divRoundUp(test.minRequiredRuns(), shardsPerTest)
 		extra := runsPerShard*shardsPerTest - test.minRequiredRuns()
 		for i := 0; i < shardsPerTest; i++ {
@@ -578,8 +740,9 @@ func shardByTime(shard *Shard, testDurations TestDurationsMap, numNewShards int)
 				testCopy.Runs = runs
 			}
 			// Assign this test to the subshard with the lowest total expected
-			// duration at this iteration of the for loop.
-			ss := heap.Pop(&h).(subshard)
+			// duration at this iteration of the for loop, avoiding the
+			// subshards that already have a test in its isolation group.
+			ss := popSubshard(&h, test.IsolationGroup)
 			ss.duration += testDurations.Get(test).MedianDuration * time.Duration(testCopy.minRequiredRuns())
 			ss.tests = append(ss.tests, testCopy)
 			heap.Push(&h, ss)
@@ -608,8 +771,22 @@ func shardByTime(shard *Shard, testDurations TestDurationsMap, numNewShards int)
 		// likely to non-hermetically conflict with each other. Using a
 		// deterministic hash ensures that given tests A and B in the same
 		// shard, A will *always* run before B or vice versa.
+		// Tests in the same isolation group that had to share a subshard are
+		// kept together and run in order of name, so that they conflict the
+		// same way in every build.
 		sort.Slice(subshard.tests, func(i, j int) bool {
-			return hash(subshard.tests[i].Name) < hash(subshard.tests[j].Name)
+			test1, test2 := subshard.tests[i], subshard.tests[j]
+			key1, key2 := hash(test1.Name), hash(test2.Name)
+			if test1.IsolationGroup != "" {
+				key1 = hash(test1.IsolationGroup)
+			}
+			if test2.IsolationGroup != "" {
+				key2 = hash(test2.IsolationGroup)
+			}
+			if key1 == key2 {
+				return test1.Name < test2.Name
+			}
+			return key1 < key2
 		})
 		name := shard.Name
 		if numNewShards > 1 {
@@ -698,6 +875,14 @@ func ApplyRealmLabel(shards []*Shard, realmLabel string) {
 	}
 }
 
+// ApplyBuildInfo sets the product and board on all shards provided.
+func ApplyBuildInfo(shards []*Shard, product, board string) {
+	for _, shard := range shards {
+		shard.Product = product
+		shard.Board = board
+	}
+}
+
 // ApplyTestTimeouts sets the timeout field on every test to the specified
 // duration. Timeouts already declared for tests in tests.json take precedence.
 func ApplyTestTimeouts(shards []*Shard, perTestTimeout time.Duration) {
@@ -830,6 +830,134 @@ func TestPartitionShards(t *testing.T) {
 	}
 }
 
+func TestSplitOutNamedShards(t *testing.T) {
+	env1 := build.Environment{
+		Dimensions: build.DimensionSet{DeviceType: "QEMU"},
+		Tags:       []string{},
+	}
+	env2 := build.Environment{
+		Dimensions: build.DimensionSet{DeviceType: "NUC"},
+		Tags:       []string{},
+	}
+	// env1WithOverrides differs from env1 only in a field that isn't part of
+	// the environment's name.
+	env1WithOverrides := env1
+	env1WithOverrides.ImageOverrides = build.ImageOverrides{ZBI: "other-zbi"}
+	pin := func(s *Shard, shardName string, indices ...int) *Shard {
+		for _, i := range indices {
+			s.Tests[i].ShardName = shardName
+		}
+		return s
+	}
+	namedShard := func(name string, env build.Environment, tests ...Test) *Shard {
+		return &Shard{Name: name, Tests: tests, Env: env}
+	}
+	pinnedTest := func(id int, os, shardName string) Test {
+		test := makeTest(id, os)
+		test.ShardName = shardName
+		return test
+	}
+
+	testCases := []struct {
+		name              string
+		shards            []*Shard
+		expectedNamed     []*Shard
+		expectedRemaining []*Shard
+		err               error
+	}{
+		{
+			name: "no pinned tests",
+			shards: []*Shard{
+				shard(env1, "fuchsia", 1, 2, 3),
+			},
+			expectedRemaining: []*Shard{
+				shard(env1, "fuchsia", 1, 2, 3),
+			},
+		},
+		{
+			name: "pinned tests are grouped by shard name",
+			shards: []*Shard{
+				pin(shard(env1, "fuchsia", 1, 2, 3), "warm", 0, 2),
+				pin(shard(env2, "fuchsia", 4, 5), "other", 1),
+			},
+			expectedNamed: []*Shard{
+				namedShard("warm", env1, pinnedTest(1, "fuchsia", "warm"), pinnedTest(3, "fuchsia", "warm")),
+				namedShard("other", env2, pinnedTest(5, "fuchsia", "other")),
+			},
+			expectedRemaining: []*Shard{
+				shard(env1, "fuchsia", 2),
+				shard(env2, "fuchsia", 4),
+			},
+		},
+		{
+			name: "shards with only pinned tests are removed",
+			shards: []*Shard{
+				pin(shard(env1, "fuchsia", 1), "warm", 0),
+				shard(env2, "fuchsia", 2),
+			},
+			expectedNamed: []*Shard{
+				namedShard("warm", env1, pinnedTest(1, "fuchsia", "warm")),
+			},
+			expectedRemaining: []*Shard{
+				shard(env2, "fuchsia", 2),
+			},
+		},
+		{
+			name: "same shard name across environments",
+			shards: []*Shard{
+				pin(shard(env1, "fuchsia", 1), "warm", 0),
+				pin(shard(env2, "fuchsia", 2), "warm", 0),
+			},
+			err: errNamedShardMultipleEnvs,
+		},
+		{
+			name: "same shard name across environments with the same name",
+			shards: []*Shard{
+				pin(shard(env1, "fuchsia", 1), "warm", 0),
+				pin(shard(env1WithOverrides, "fuchsia", 2), "warm", 0),
+			},
+			err: errNamedShardMultipleEnvs,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			named, remaining, err := SplitOutNamedShards(tc.shards)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got err %v, want %v", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+			assertEqual(t, tc.expectedNamed, named)
+			assertEqual(t, tc.expectedRemaining, remaining)
+		})
+	}
+}
+
+func TestApplyNamedShardTimeouts(t *testing.T) {
+	env := build.Environment{
+		Dimensions: build.DimensionSet{DeviceType: "QEMU"},
+		Tags:       []string{},
+	}
+	testDurations := TestDurationsMap{
+		"*": {MedianDuration: time.Minute},
+	}
+	named := shard(env, "fuchsia", 1, 2)
+	named.Name = "warm"
+	// Modifiers applied after the tests were split out multiply one of them,
+	// which the timeout must account for.
+	named.Tests[0].RunAlgorithm = StopOnFailure
+	named.Tests[0].Runs = 5
+
+	ApplyNamedShardTimeouts([]*Shard{named}, testDurations)
+
+	want := int(computeShardTimeout(subshard{6 * time.Minute, named.Tests}).Seconds())
+	if named.TimeoutSecs != want {
+		t.Errorf("got TimeoutSecs %d, want %d", named.TimeoutSecs, want)
+	}
+}
+
 func TestMarkShardsSkipped(t *testing.T) {
 	env1 := build.Environment{
 		Dimensions: build.DimensionSet{DeviceType: "QEMU"},
@@ -1083,6 +1211,117 @@ func TestWithTargetDuration(t *testing.T) {
 		assertShardsContainTests(t, actual, expectedTests)
 	})
 
+	t.Run("splits long tests supporting test sharding across shards", func(t *testing.T) {
+		input := []*Shard{shard(env1, "linux", 1, 2, 3, 4, 5, 6)}
+		input[0].Tests[0].SupportsTestSharding = true
+		hostTest := func(id int) string {
+			return fullTestName(id, "linux")
+		}
+		durations := TestDurationsMap{
+			"*":         {MedianDuration: 1},
+			hostTest(1): {MedianDuration: 10},
+		}
+		// The total duration is 15, so three shards are needed, and test 1
+		// takes two shards' worth of time.
+		actual, _ := WithTargetDuration(input, 5, 0, 0, durations)
+		expectedTests := [][]string{
+			{hostTest(1)},
+			{hostTest(1)},
+			{hostTest(2), hostTest(3), hostTest(4), hostTest(5), hostTest(6)},
+		}
+		assertShardsContainTests(t, actual, expectedTests)
+
+		var indices []int
+		for _, s := range actual {
+			for _, test := range s.Tests {
+				if test.Name != hostTest(1) {
+					if test.TestTotalShards != 0 {
+						t.Errorf("test %s was split into %d parts, want it to run whole", test.Name, test.TestTotalShards)
+					}
+					continue
+				}
+				if test.TestTotalShards != 2 {
+					t.Errorf("got test %s split into %d parts, want 2", test.Name, test.TestTotalShards)
+				}
+				indices = append(indices, test.TestShardIndex)
+			}
+		}
+		sort.Ints(indices)
+		if !reflect.DeepEqual(indices, []int{0, 1}) {
+			t.Errorf("got test shard indices %v, want [0 1]", indices)
+		}
+	})
+
+	t.Run("doesn't split fuchsia tests", func(t *testing.T) {
+		input := []*Shard{shard(env1, "fuchsia", 1, 2, 3, 4, 5, 6)}
+		input[0].Tests[0].SupportsTestSharding = true
+		durations := TestDurationsMap{
+			"*":     {MedianDuration: 1},
+			test(1): {MedianDuration: 10},
+		}
+		actual, _ := WithTargetDuration(input, 5, 0, 0, durations)
+		expectedTests := [][]string{
+			{test(1)},
+			{test(2), test(3), test(4), test(5), test(6)},
+		}
+		assertShardsContainTests(t, actual, expectedTests)
+	})
+
+	t.Run("spreads tests in an isolation group across shards", func(t *testing.T) {
+		input := []*Shard{shard(env1, "fuchsia", 1, 2, 3, 4, 5, 6)}
+		input[0].Tests[0].IsolationGroup = "ports"
+		input[0].Tests[2].IsolationGroup = "ports"
+		actual, _ := WithTargetDuration(input, 4, 0, 0, defaultDurations)
+		if len(actual) != 2 {
+			t.Fatalf("got %d shards, want 2", len(actual))
+		}
+		for _, s := range actual {
+			var group []string
+			for _, test := range s.Tests {
+				if test.IsolationGroup != "" {
+					group = append(group, test.Name)
+				}
+			}
+			if len(group) != 1 {
+				t.Errorf("shard %s has tests %v of the isolation group, want exactly one", s.Name, group)
+			}
+		}
+	})
+
+	t.Run("runs tests in an isolation group that must share a shard together", func(t *testing.T) {
+		input := []*Shard{shard(env1, "fuchsia", 1, 2, 3, 4, 5, 6)}
+		for _, i := range []int{0, 2, 4} {
+			input[0].Tests[i].IsolationGroup = "ports"
+		}
+		actual, _ := WithTargetDuration(input, 4, 0, 0, defaultDurations)
+		if len(actual) != 2 {
+			t.Fatalf("got %d shards, want 2", len(actual))
+		}
+		numInGroup := 0
+		for _, s := range actual {
+			// The tests of the group must be consecutive and in order of name.
+			var group []string
+			last := -1
+			for i, test := range s.Tests {
+				if test.IsolationGroup == "" {
+					continue
+				}
+				if last >= 0 && i != last+1 {
+					t.Errorf("tests of the isolation group aren't consecutive in shard %s", s.Name)
+				}
+				last = i
+				group = append(group, test.Name)
+			}
+			if !sort.StringsAreSorted(group) {
+				t.Errorf("got tests %v of the isolation group in shard %s, want them sorted by name", group, s.Name)
+			}
+			numInGroup += len(group)
+		}
+		if numInGroup != 3 {
+			t.Errorf("got %d tests of the isolation group, want 3", numInGroup)
+		}
+	})
+
 	t.Run("produces shards of similar expected durations", func(t *testing.T) {
 		input := []*Shard{shard(env1, "fuchsia", 1, 2, 3, 4, 5)}
 		durations := TestDurationsMap{
@@ -1462,6 +1701,31 @@ func TestApplyRealmLabel(t *testing.T) {
 	})
 }
 
+func TestApplyBuildInfo(t *testing.T) {
+	shards := []*Shard{
+		{Name: "foo", Tests: []Test{{Test: build.Test{Name: "test1", OS: linux, CPU: x64}}}},
+		{Name: "bar", Tests: []Test{{Test: build.Test{Name: "test2", OS: linux, CPU: "arm64"}}}},
+	}
+
+	ApplyBuildInfo(shards, "core", "x64")
+
+	expected := []*Shard{
+		{
+			Name:    "foo",
+			Tests:   []Test{{Test: build.Test{Name: "test1", OS: linux, CPU: x64}}},
+			Product: "core",
+			Board:   "x64",
+		},
+		{
+			Name:    "bar",
+			Tests:   []Test{{Test: build.Test{Name: "test2", OS: linux, CPU: "arm64"}}},
+			Product: "core",
+			Board:   "x64",
+		},
+	}
+	assertEqual(t, expected, shards)
+}
+
 func TestComputeShardTimeout(t *testing.T) {
 	tests := []struct {
 		name string
@@ -1546,3 +1810,16 @@ func TestApplyTestTimeouts(t *testing.T) {
 		}
 	}
 }
+
+func TestSharedIsolationGroups(t *testing.T) {
+	env := build.Environment{Dimensions: build.DimensionSet{DeviceType: "QEMU"}}
+	s := shard(env, "fuchsia", 1, 2, 3, 4, 5)
+	s.Tests[0].IsolationGroup = "ports"
+	s.Tests[1].IsolationGroup = "services"
+	s.Tests[3].IsolationGroup = "ports"
+	// A test listed twice is still a single test of its group.
+	s.Tests = append(s.Tests, s.Tests[1])
+	if got, want := sharedIsolationGroups(s), []string{"ports"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sharedIsolationGroups() = %v, want %v", got, want)
+	}
+}
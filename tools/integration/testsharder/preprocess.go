@@ -49,6 +49,13 @@ func validateAgainst(spec build.TestSpec, platforms []build.DimensionSet) error
 	for _, env := range spec.Envs {
 		if !resolvesToOneOf(env, platforms) {
 			badEnvs = append(badEnvs, env)
+			continue
+		}
+		for _, fallback := range env.Fallbacks {
+			if !resolvesToOneOf(build.Environment{Dimensions: fallback}, platforms) {
+				badEnvs = append(badEnvs, env)
+				break
+			}
 		}
 	}
 	if len(badEnvs) > 0 {
@@ -102,4 +102,14 @@ func TestValidation(t *testing.T) {
 		spec := getSpec(t)
 		validate(t, []build.TestSpec{spec}, true)
 	})
+	t.Run("test with a non-matching fallback is invalid", func(t *testing.T) {
+		spec := getSpec(t)
+		spec.Envs[0].Fallbacks = []build.DimensionSet{{DeviceType: "nuc"}, {OS: "Mac"}}
+		validate(t, []build.TestSpec{spec}, false)
+	})
+	t.Run("test with matching fallbacks is valid", func(t *testing.T) {
+		spec := getSpec(t)
+		spec.Envs[0].Fallbacks = []build.DimensionSet{{DeviceType: "nuc"}, {DeviceType: "qemu"}}
+		validate(t, []build.TestSpec{spec}, true)
+	})
 }
@@ -36,6 +36,29 @@ type Shard struct {
 	// Env is a generalized notion of the execution environment for the shard.
 	Env build.Environment `json:"environment"`
 
+	// Product and Board are the product and board the build was configured
+	// with, as recorded in the build API. They let the task that runs the
+	// shard select the images and SSH keys matching the build when a single
+	// build covers multiple boards.
+	Product string `json:"product,omitempty"`
+	Board   string `json:"board,omitempty"`
+
+	// UseSerial specifies whether the tests should be run on the device over
+	// serial rather than SSH. It is set from the board profile of the shard's
+	// device type.
+	UseSerial bool `json:"use_serial,omitempty"`
+
+	// ExtraDimensions are Swarming dimensions that the task that runs the
+	// shard should target in addition to those of Env. They are set from the
+	// board profile of the shard's device type.
+	ExtraDimensions map[string]string `json:"extra_dimensions,omitempty"`
+
+	// Benchmark, if set, marks the shard as a benchmark run, whose tests
+	// testrunner runs one at a time isolated as described. It is set for the
+	// shards of environments tagged with BenchmarkEnvTag, from the board
+	// profile of the shard's device type.
+	Benchmark *BenchmarkConfig `json:"benchmark,omitempty"`
+
 	// Deps is the list of runtime dependencies required to be present on the host
 	// at shard execution time. It is a list of paths relative to the fuchsia
 	// build directory.
@@ -196,7 +219,7 @@ func MakeShards(specs []build.TestSpec, testListEntries map[string]build.TestLis
 				shards = append(shards, &Shard{
 					Name:  fmt.Sprintf("%s-%s", environmentName(env), normalizeTestName(spec.Test.Name)),
 					Tests: []Test{test},
-					Env:   env,
+					Env:   withFallbacksFor(env, []Test{test}),
 				})
 			} else {
 				tests = append(tests, test)
@@ -206,13 +229,38 @@ func MakeShards(specs []build.TestSpec, testListEntries map[string]build.TestLis
 			shards = append(shards, &Shard{
 				Name:  environmentName(env),
 				Tests: tests,
-				Env:   env,
+				Env:   withFallbacksFor(env, tests),
 			})
 		}
 	}
 	return shards
 }
 
+// withFallbacksFor returns env with only the fallbacks that all of tests can
+// run on, so that schedulers never degrade to an emulator for tests that
+// require a physical device.
+func withFallbacksFor(env build.Environment, tests []Test) build.Environment {
+	if len(env.Fallbacks) == 0 {
+		return env
+	}
+	emulatorCompatible := true
+	for i := range tests {
+		if !tests[i].EmulatorCompatible() {
+			emulatorCompatible = false
+			break
+		}
+	}
+	var fallbacks []build.DimensionSet
+	for _, fallback := range env.Fallbacks {
+		if fallback.TargetsEmulator() && !emulatorCompatible {
+			continue
+		}
+		fallbacks = append(fallbacks, fallback)
+	}
+	env.Fallbacks = fallbacks
+	return env
+}
+
 // EnvironmentName returns a name for an environment.
 func environmentName(env build.Environment) string {
 	tokens := []string{}
@@ -295,4 +295,42 @@ func TestMakeShards(t *testing.T) {
 		}
 		assertEqual(t, expected, actual)
 	})
+
+	t.Run("emulator fallbacks are dropped for emulator-incompatible tests", func(t *testing.T) {
+		nuc7 := build.DimensionSet{DeviceType: "NUC7"}
+		withFallbacks := func(env build.Environment, fallbacks ...build.DimensionSet) build.Environment {
+			env2 := env
+			env2.Fallbacks = fallbacks
+			return env2
+		}
+		nuc11 := withFallbacks(build.Environment{
+			Dimensions: build.DimensionSet{DeviceType: "NUC11"},
+			Tags:       []string{},
+		}, nuc7, env1.Dimensions)
+		incompatible := build.TestListEntry{
+			Name: fullTestName(2, "fuchsia"),
+			Tags: []build.TestTag{{Key: "emulator_compatible", Value: "false"}},
+		}
+
+		actual := MakeShards([]build.TestSpec{spec(1, nuc11)}, nil, basicOpts)
+		assertEqual(t, []*Shard{fuchsiaShard(nuc11, 1)}, actual)
+
+		actual = MakeShards(
+			[]build.TestSpec{spec(1, nuc11), spec(2, nuc11)},
+			map[string]build.TestListEntry{
+				fullTestName(2, "fuchsia"): incompatible,
+			},
+			basicOpts,
+		)
+		test2 := makeTest(2, "fuchsia")
+		test2.Tags = incompatible.Tags
+		expected := []*Shard{
+			{
+				Name:  environmentName(nuc11),
+				Tests: []Test{makeTest(1, "fuchsia"), test2},
+				Env:   withFallbacks(nuc11, nuc7),
+			},
+		}
+		assertEqual(t, expected, actual)
+	})
 }
@@ -52,6 +52,26 @@ type Test struct {
 
 	// Tags are test metadata copied over from test-list.json.
 	Tags []build.TestTag `json:"tags,omitempty"`
+
+	// TestTotalShards is the number of parts a test supporting Bazel's test
+	// sharding protocol was split into, and TestShardIndex the part to run,
+	// to be passed to the test as TEST_TOTAL_SHARDS and TEST_SHARD_INDEX.
+	// TestShardIndex is only meaningful if TestTotalShards is set.
+	TestTotalShards int `json:"test_total_shards,omitempty"`
+	TestShardIndex  int `json:"test_shard_index,omitempty"`
+
+	// TestFilters restricts the test cases run to those matching any of the
+	// filters. It is only set by testrunner, to retry just the failed cases of
+	// a component v2 test.
+	TestFilters []string `json:"-"`
+
+	// ShardName is the name of the shard this test is pinned to by a
+	// modifier, if any. It is only used while sharding.
+	ShardName string `json:"-"`
+
+	// IsolationGroup is the group of tests this test conflicts with when run
+	// on the same device, if any. It is only used while sharding.
+	IsolationGroup string `json:"-"`
 }
 
 func (t *Test) applyModifier(m TestModifier) {
@@ -75,6 +95,12 @@ func (t *Test) applyModifier(m TestModifier) {
 	if m.Affected {
 		t.Affected = true
 	}
+	if m.ShardName != "" {
+		t.ShardName = m.ShardName
+	}
+	if m.IsolationGroup != "" {
+		t.IsolationGroup = m.IsolationGroup
+	}
 }
 
 func (t *Test) minRequiredRuns() int {
@@ -95,6 +121,23 @@ func (t *Test) applyTestListTags(tl build.TestListEntry) {
 	t.Tags = tl.Tags
 }
 
+// EmulatorCompatible returns whether the test may run on an emulator. Tests
+// are assumed to be compatible unless they are tagged otherwise.
+func (t *Test) EmulatorCompatible() bool {
+	for _, tag := range t.Tags {
+		if tag.Key == "emulator_compatible" && tag.Value == "false" {
+			return false
+		}
+	}
+	return true
+}
+
+// testShardable returns whether the test can be split into parts using Bazel's
+// test sharding protocol.
+func (t *Test) testShardable() bool {
+	return t.SupportsTestSharding && t.OS != fuchsia
+}
+
 func (t *Test) Hermetic() bool {
 	for _, tag := range t.Tags {
 		if tag.Key == "hermetic" && tag.Value == "true" {
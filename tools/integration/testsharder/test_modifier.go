@@ -54,6 +54,17 @@ type TestModifier struct {
 	// MaxAttempts is the max number of times to run this test if it fails.
 	// This is the max attempts per run as specified by the `TotalRuns` field.
 	MaxAttempts int `json:"max_attempts,omitempty"`
+
+	// ShardName, if set, forces the test into a shard with this exact name
+	// instead of letting testsharder balance it across shards. The shard is
+	// created if no other test is pinned to it.
+	ShardName string `json:"shard_name,omitempty"`
+
+	// IsolationGroup, if set, puts the test in a group of tests that must not
+	// run on the same device, e.g. because they bind the same ports or
+	// register the same global services. Tests in a group are spread across
+	// different shards where possible.
+	IsolationGroup string `json:"isolation_group,omitempty"`
 }
 
 // ModifierMatch is the calculated match of a single test in a single environment
@@ -10,6 +10,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"runtime"
 	"syscall"
 	"time"
 
@@ -54,6 +55,24 @@ type RunOptions struct {
 	// Dir is the directory in which the subprocess should be run. It inherits
 	// Runner.Dir if unset.
 	Dir string
+
+	// ResourceUsage, if set, is filled in with the resources used by the
+	// subprocess once it has exited.
+	ResourceUsage *ResourceUsage
+}
+
+// ResourceUsage is the resources used by a subprocess, including those used
+// by any descendant processes that it waited for.
+type ResourceUsage struct {
+	// UserTime is the CPU time spent in user mode.
+	UserTime time.Duration
+
+	// SystemTime is the CPU time spent in kernel mode.
+	SystemTime time.Duration
+
+	// MaxRSS is the peak resident set size, in bytes, of the subprocess or
+	// of its largest waited-for descendant.
+	MaxRSS int64
 }
 
 // Run runs a command until completion or until a context is canceled, in
@@ -128,6 +147,7 @@ func (r *Runner) Run(ctx context.Context, command []string, options RunOptions)
 	select {
 	case err := <-errs:
 		// Process is done so no need to worry about cleanup. Just exit.
+		recordResourceUsage(cmd, options.ResourceUsage)
 		return err
 	case <-ctx.Done():
 		if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
@@ -150,6 +170,7 @@ func (r *Runner) Run(ctx context.Context, command []string, options RunOptions)
 			// Wait for the subprocess to complete after killing it.
 			<-errs
 		}
+		recordResourceUsage(cmd, options.ResourceUsage)
 		// Return the context error instead of the error returned by cmd.Wait()
 		// to indicate to the caller that the command failed as a result of a
 		// context cancellation; in this case the error returned by cmd.Wait()
@@ -175,3 +196,23 @@ func killProcess(ctx context.Context, cmd *exec.Cmd, pgidSet bool) {
 		}
 	}
 }
+
+// recordResourceUsage fills in usage, if set, with the resources used by the
+// exited subprocess `cmd`.
+func recordResourceUsage(cmd *exec.Cmd, usage *ResourceUsage) {
+	if usage == nil || cmd.ProcessState == nil {
+		return
+	}
+	*usage = ResourceUsage{
+		UserTime:   cmd.ProcessState.UserTime(),
+		SystemTime: cmd.ProcessState.SystemTime(),
+	}
+	if rusage, ok := cmd.ProcessState.SysUsage().(*syscall.Rusage); ok {
+		usage.MaxRSS = int64(rusage.Maxrss)
+		// Linux reports the max RSS in kilobytes, whereas Mac OS reports it in
+		// bytes.
+		if runtime.GOOS != "darwin" {
+			usage.MaxRSS *= 1024
+		}
+	}
+}
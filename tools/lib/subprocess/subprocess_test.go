@@ -49,6 +49,28 @@ func TestRun(t *testing.T) {
 		}
 	})
 
+	t.Run("should record resource usage", func(t *testing.T) {
+		// Allocate a few MiB in a shell variable so that the peak RSS is
+		// noticeably larger than zero.
+		script := writeScript(
+			t,
+			`#!/bin/bash
+			x=$(head -c 4194304 /dev/zero | tr '\0' 'x')
+			echo ${#x}`,
+		)
+		r := Runner{}
+		var usage ResourceUsage
+		if err := r.Run(ctx, []string{script}, RunOptions{Stdout: io.Discard, ResourceUsage: &usage}); err != nil {
+			t.Fatal(err)
+		}
+		if usage.MaxRSS < 4*1024*1024 {
+			t.Errorf("Expected a max RSS of at least 4MiB, got %d bytes", usage.MaxRSS)
+		}
+		if usage.UserTime+usage.SystemTime <= 0 {
+			t.Errorf("Expected non-zero CPU time, got %+v", usage)
+		}
+	})
+
 	t.Run("should error if the context completes before the command", func(t *testing.T) {
 		ctx, cancel := context.WithCancel(ctx)
 		cancel()
@@ -9,7 +9,9 @@ import (
 	"io"
 	"net"
 	"sync"
+	"time"
 
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
 	"go.fuchsia.dev/fuchsia/tools/lib/retry"
 
 	"github.com/pkg/sftp"
@@ -25,10 +27,15 @@ type Client struct {
 	// the remote.
 	connectBackoff retry.Backoff
 
+	// How the client detects that the remote has stopped responding.
+	keepalive KeepaliveConfig
+
 	// The following fields are protected by this mutex.
 	mu        sync.Mutex
 	conn      *Conn
 	connected bool
+	// The number of times the client has reconnected.
+	reconnects int
 }
 
 // NewClient creates a new ssh client to the address.
@@ -38,7 +45,20 @@ func NewClient(
 	config *ssh.ClientConfig,
 	connectBackoff retry.Backoff,
 ) (*Client, error) {
-	conn, err := newConn(ctx, resolver, config, connectBackoff)
+	return NewClientWithKeepalive(ctx, resolver, config, connectBackoff, DefaultKeepaliveConfig())
+}
+
+// NewClientWithKeepalive is like NewClient, but detects that the remote has
+// stopped responding according to keepalive, which is also used for any
+// reconnections.
+func NewClientWithKeepalive(
+	ctx context.Context,
+	resolver Resolver,
+	config *ssh.ClientConfig,
+	connectBackoff retry.Backoff,
+	keepalive KeepaliveConfig,
+) (*Client, error) {
+	conn, err := newConn(ctx, resolver, config, connectBackoff, keepalive)
 	if err != nil {
 		return nil, err
 	}
@@ -47,6 +67,7 @@ func NewClient(
 		resolver:       resolver,
 		config:         config,
 		connectBackoff: connectBackoff,
+		keepalive:      keepalive,
 		conn:           conn,
 		connected:      true,
 	}, nil
@@ -82,8 +103,10 @@ func (c *Client) ReconnectWithBackoff(ctx context.Context, backoff retry.Backoff
 	// Disconnect if we are connected.
 	c.Close()
 
-	conn, err := newConn(ctx, c.resolver, c.config, backoff)
+	startTime := time.Now()
+	conn, err := newConn(ctx, c.resolver, c.config, backoff, c.keepalive)
 	if err != nil {
+		logger.Warningf(ctx, "failed to reconnect over ssh after %s: %s", time.Since(startTime).Truncate(time.Millisecond), err)
 		return err
 	}
 
@@ -100,8 +123,12 @@ func (c *Client) ReconnectWithBackoff(ctx context.Context, backoff retry.Backoff
 	} else {
 		c.conn = conn
 		c.connected = true
+		c.reconnects++
+		reconnects := c.reconnects
 
 		c.mu.Unlock()
+
+		logger.Infof(ctx, "reconnected to %s over ssh in %s (reconnection #%d)", conn.addr, time.Since(startTime).Truncate(time.Millisecond), reconnects)
 	}
 
 	return nil
@@ -30,11 +30,39 @@ const (
 	// ping within this amount of time.
 	defaultKeepaliveTimeout = 12 * time.Second
 
+	// The number of consecutive keepalive pings that must go unanswered
+	// before the connection is canceled.
+	defaultKeepaliveMaxMissed = 1
+
 	// A conventionally-used request name for checking the status of an SSH connection.
 	// We deliberately do not use the same name as OpenSSH to make debugging this library easier.
 	keepaliveFuchsia = "keepalive@fuchsia.com"
 )
 
+// KeepaliveConfig controls how a connection detects that the server has
+// stopped responding.
+type KeepaliveConfig struct {
+	// Interval is the time between keepalive pings.
+	Interval time.Duration
+
+	// Timeout is how long to wait for a response to a ping before counting it
+	// as missed.
+	Timeout time.Duration
+
+	// MaxMissed is the number of consecutive missed pings after which the
+	// connection is closed. Values below 1 are treated as 1.
+	MaxMissed int
+}
+
+// DefaultKeepaliveConfig returns the keepalive settings used by NewClient.
+func DefaultKeepaliveConfig() KeepaliveConfig {
+	return KeepaliveConfig{
+		Interval:  defaultKeepaliveInterval,
+		Timeout:   defaultKeepaliveTimeout,
+		MaxMissed: defaultKeepaliveMaxMissed,
+	}
+}
+
 // Conn is a wrapper around ssh that supports keepalive and auto-reconnection.
 type Conn struct {
 	mu struct {
@@ -42,12 +70,15 @@ type Conn struct {
 		client *ssh.Client
 	}
 
+	// The address of the server.
+	addr net.Addr
+
 	shuttingDown chan struct{}
 }
 
 // newConn creates a new ssh client to the address and launches a goroutine to
 // send keepalive pings as long as the client is connected.
-func newConn(ctx context.Context, resolver Resolver, config *ssh.ClientConfig, backoff retry.Backoff) (*Conn, error) {
+func newConn(ctx context.Context, resolver Resolver, config *ssh.ClientConfig, backoff retry.Backoff, keepalive KeepaliveConfig) (*Conn, error) {
 	conn, err := connect(ctx, resolver, config, backoff)
 	if err != nil {
 		return nil, err
@@ -75,12 +106,12 @@ func newConn(ctx context.Context, resolver Resolver, config *ssh.ClientConfig, b
 			}
 		}()
 
-		t := time.NewTicker(defaultKeepaliveInterval)
+		t := time.NewTicker(keepalive.Interval)
 		defer t.Stop()
 		timeout := func() <-chan time.Time {
-			return time.After(defaultKeepaliveTimeout)
+			return time.After(keepalive.Timeout)
 		}
-		conn.keepalive(keepaliveCtx, s.session, t.C, timeout)
+		conn.keepalive(keepaliveCtx, s.session, t.C, timeout, keepalive.MaxMissed)
 	}()
 	return conn, nil
 }
@@ -116,6 +147,7 @@ func connect(ctx context.Context, resolver Resolver, config *ssh.ClientConfig, b
 	}
 
 	c := Conn{
+		addr:         addr,
 		shuttingDown: make(chan struct{}),
 	}
 	c.mu.client = client
@@ -348,13 +380,18 @@ func (c *Conn) NewSFTPClient() (*sftp.Client, error) {
 // channel.
 // After sending a ping, we call the `timeout` function and wait until either we
 // receive a response or we receive something on the channel returned by
-// `timeout`.
-func (c *Conn) keepalive(ctx context.Context, session *ssh.Session, ticks <-chan time.Time, timeout func() <-chan time.Time) {
+// `timeout`. The connection is closed once `maxMissed` consecutive pings time
+// out.
+func (c *Conn) keepalive(ctx context.Context, session *ssh.Session, ticks <-chan time.Time, timeout func() <-chan time.Time, maxMissed int) {
 	if timeout == nil {
 		timeout = func() <-chan time.Time {
 			return nil
 		}
 	}
+	if maxMissed < 1 {
+		maxMissed = 1
+	}
+	missed := 0
 	for {
 		// Sleep until the next poll cycle or until the client is closed.
 		select {
@@ -392,22 +429,26 @@ func (c *Conn) keepalive(ctx context.Context, session *ssh.Session, ticks <-chan
 				select {
 				case <-c.shuttingDown:
 				default:
-					logger.Debugf(
-						ctx,
-						"error sending keepalive to %s, disconnecting: %s",
-						c.mu.client.RemoteAddr(),
-						err,
-					)
+					logger.Warningf(ctx, "error sending keepalive to %s, disconnecting: %s", c.addr, err)
 				}
 				if err := c.Close(); err != nil {
 					logger.Debugf(ctx, "error disconnecting: %s", err)
 				}
 				return
 			}
+			if missed > 0 {
+				logger.Infof(ctx, "ssh server %s is responding to keepalives again after %d missed", c.addr, missed)
+			}
+			missed = 0
 
 		case t := <-timeout():
 			timeoutDuration := t.Sub(sendTime)
-			logger.Debugf(ctx, "ssh keepalive timed out after %.3fs, disconnecting", timeoutDuration.Seconds())
+			missed++
+			if missed < maxMissed {
+				logger.Warningf(ctx, "ssh keepalive to %s timed out after %.3fs (%d of %d missed)", c.addr, timeoutDuration.Seconds(), missed, maxMissed)
+				continue
+			}
+			logger.Warningf(ctx, "ssh keepalive to %s timed out after %.3fs, %d missed in a row, disconnecting", c.addr, timeoutDuration.Seconds(), missed)
 			if err := c.Close(); err != nil {
 				logger.Debugf(ctx, "error disconnecting: %s", err)
 			}
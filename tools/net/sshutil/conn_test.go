@@ -83,7 +83,7 @@ func TestKeepalive(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		go conn.keepalive(ctx, session, keepaliveTicks, nil)
+		go conn.keepalive(ctx, session, keepaliveTicks, nil, 1)
 
 		keepaliveTicks <- time.Now()
 
@@ -105,8 +105,33 @@ func TestKeepalive(t *testing.T) {
 		}
 		go conn.keepalive(ctx, session, keepaliveTicks, func() <-chan time.Time {
 			return keepaliveTimeouts
-		})
+		}, 1)
+
+		keepaliveTicks <- time.Now()
+
+		<-conn.DisconnectionListener()
+	})
+
+	t.Run("tolerates missed keepalives up to the limit", func(t *testing.T) {
+		// The server never replies, so every ping times out.
+		conn, _ := setUpConn(ctx, t, nil, func(ssh.Channel, *ssh.Request) {})
+
+		keepaliveTimeouts := make(chan time.Time, 2)
+		keepaliveTimeouts <- time.Now()
+		keepaliveTimeouts <- time.Now()
 
+		keepaliveTicks := make(chan time.Time)
+		session, err := conn.mu.client.NewSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		go conn.keepalive(ctx, session, keepaliveTicks, func() <-chan time.Time {
+			return keepaliveTimeouts
+		}, 2)
+
+		keepaliveTicks <- time.Now()
+		// The second tick is only received if the first missed ping didn't
+		// close the connection.
 		keepaliveTicks <- time.Now()
 
 		<-conn.DisconnectionListener()
@@ -129,7 +154,7 @@ func TestKeepalive(t *testing.T) {
 		keepaliveTicks := make(chan time.Time)
 		keepaliveComplete := make(chan struct{})
 		go func() {
-			conn.keepalive(ctx, session, keepaliveTicks, nil)
+			conn.keepalive(ctx, session, keepaliveTicks, nil, 1)
 			close(keepaliveComplete)
 		}()
 
@@ -148,7 +173,7 @@ func TestKeepalive(t *testing.T) {
 			t.Fatal(err)
 		}
 		go func() {
-			conn.keepalive(ctx, session, nil, nil)
+			conn.keepalive(ctx, session, nil, nil, 1)
 			close(keepaliveComplete)
 		}()
 
@@ -38,6 +38,8 @@ func ParseSummary(filePath string) (*runtests.TestSummary, error) {
 	if err := json.Unmarshal(content, &summary); err != nil {
 		return nil, err
 	}
+	// Each run of a test is reported as a separate result.
+	summary.Tests = runtests.FlattenAttempts(summary.Tests)
 	return &summary, nil
 }
 
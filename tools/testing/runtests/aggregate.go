@@ -0,0 +1,148 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package runtests
+
+// AggregateAttempts folds the entries of tests that were run more than once
+// into a single entry per test, recording each run in Attempts. The
+// aggregated entry takes its position from the test's first run.
+//
+// The top-level fields of an aggregated entry describe the test as a whole:
+// Verdict, and Flaky, which is set for flakes, come from the results of all
+// attempts; Result and Cases come from the last attempt that failed if the
+// test is a flake, so that a test that failed and then passed on a retry isn't
+// reported as passing, and from the last attempt otherwise; GNLabel comes from
+// the last attempt; StartTime is that of the first attempt; DurationMillis
+// and the CPU times of ResourceUsage are the totals across attempts, and its
+// MaxRSSBytes the peak; and OutputFiles and DataSinks are the union of those
+// of all attempts. Tests that were only run once keep their entry as it is,
+// apart from the Verdict and run counts that every aggregated entry gets.
+func AggregateAttempts(tests []TestDetails) []TestDetails {
+	runs := make(map[string][]TestDetails)
+	var order []string
+	for _, test := range tests {
+		if _, ok := runs[test.Name]; !ok {
+			order = append(order, test.Name)
+		}
+		runs[test.Name] = append(runs[test.Name], test)
+	}
+
+	aggregated := make([]TestDetails, 0, len(order))
+	for _, name := range order {
+		attempts := runs[name]
+		if len(attempts) == 1 {
+			test := attempts[0]
+			setVerdict(&test, attempts)
+			aggregated = append(aggregated, test)
+			continue
+		}
+		last := attempts[len(attempts)-1]
+		test := TestDetails{
+			Name:                 name,
+			GNLabel:              last.GNLabel,
+			StartTime:            attempts[0].StartTime,
+			IsTestingFailureMode: last.IsTestingFailureMode,
+			Affected:             last.Affected,
+			Tags:                 last.Tags,
+		}
+		for _, a := range attempts {
+			test.OutputFiles = append(test.OutputFiles, a.OutputFiles...)
+			test.DurationMillis += a.DurationMillis
+			for sink, files := range a.DataSinks {
+				if test.DataSinks == nil {
+					test.DataSinks = DataSinkMap{}
+				}
+				test.DataSinks[sink] = append(test.DataSinks[sink], files...)
+			}
+			if u := a.ResourceUsage; u != nil {
+				if test.ResourceUsage == nil {
+					test.ResourceUsage = &ResourceUsage{}
+				}
+				test.ResourceUsage.UserCPUMillis += u.UserCPUMillis
+				test.ResourceUsage.SystemCPUMillis += u.SystemCPUMillis
+				if u.MaxRSSBytes > test.ResourceUsage.MaxRSSBytes {
+					test.ResourceUsage.MaxRSSBytes = u.MaxRSSBytes
+				}
+			}
+			test.Attempts = append(test.Attempts, TestAttempt{
+				Result:         a.Result,
+				StartTime:      a.StartTime,
+				DurationMillis: a.DurationMillis,
+				OutputFiles:    a.OutputFiles,
+				Cases:          a.Cases,
+				DataSinks:      a.DataSinks,
+				ResourceUsage:  a.ResourceUsage,
+			})
+		}
+		setVerdict(&test, attempts)
+		// Report a flaky test with its last failed attempt, so that it isn't
+		// taken as passing.
+		decisive := last
+		if test.Verdict == VerdictFlake {
+			for _, a := range attempts {
+				if IsFailure(a.Result) {
+					decisive = a
+				}
+			}
+		}
+		test.Result = decisive.Result
+		test.Cases = decisive.Cases
+		test.Flaky = test.Verdict == VerdictFlake
+		aggregated = append(aggregated, test)
+	}
+	return aggregated
+}
+
+// setVerdict sets the Verdict and run counts of test from its attempts.
+func setVerdict(test *TestDetails, attempts []TestDetails) {
+	test.Runs = len(attempts)
+	test.FailedRuns = 0
+	for _, a := range attempts {
+		if IsFailure(a.Result) {
+			test.FailedRuns++
+		}
+	}
+	switch test.FailedRuns {
+	case 0:
+		test.Verdict = VerdictPass
+	case test.Runs:
+		test.Verdict = VerdictFail
+	default:
+		test.Verdict = VerdictFlake
+	}
+}
+
+// FlattenAttempts is the inverse of AggregateAttempts: it expands each
+// aggregated entry into one entry per attempt, as produced by runners that
+// don't aggregate. Entries without attempts only lose their Verdict and run
+// counts.
+func FlattenAttempts(tests []TestDetails) []TestDetails {
+	var flattened []TestDetails
+	for _, test := range tests {
+		if len(test.Attempts) == 0 {
+			test.Verdict = ""
+			test.Runs = 0
+			test.FailedRuns = 0
+			flattened = append(flattened, test)
+			continue
+		}
+		for _, a := range test.Attempts {
+			flattened = append(flattened, TestDetails{
+				Name:                 test.Name,
+				GNLabel:              test.GNLabel,
+				OutputFiles:          a.OutputFiles,
+				Result:               a.Result,
+				Cases:                a.Cases,
+				DataSinks:            a.DataSinks,
+				StartTime:            a.StartTime,
+				DurationMillis:       a.DurationMillis,
+				IsTestingFailureMode: test.IsTestingFailureMode,
+				Affected:             test.Affected,
+				Tags:                 test.Tags,
+				ResourceUsage:        a.ResourceUsage,
+			})
+		}
+	}
+	return flattened
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package runtests
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAggregateAttempts(t *testing.T) {
+	start := time.Unix(0, 0).UTC()
+	tests := []TestDetails{
+		{
+			Name:           "a",
+			Result:         TestFailure,
+			StartTime:      start,
+			DurationMillis: 5,
+			OutputFiles:    []string{"a/0/stdout-and-stderr.txt"},
+			Cases:          []TestCaseResult{{CaseName: "case", Status: TestFailure}},
+			DataSinks:      DataSinkMap{"llvm-profile": {{Name: "0", File: "0.profraw"}}},
+			ResourceUsage:  &ResourceUsage{UserCPUMillis: 4, SystemCPUMillis: 1, MaxRSSBytes: 2048},
+		},
+		{
+			Name:           "b",
+			Result:         TestSuccess,
+			StartTime:      start,
+			DurationMillis: 1,
+			OutputFiles:    []string{"b/0/stdout-and-stderr.txt"},
+		},
+		{
+			Name:           "a",
+			Result:         TestSuccess,
+			StartTime:      start.Add(time.Second),
+			DurationMillis: 7,
+			OutputFiles:    []string{"a/1/stdout-and-stderr.txt"},
+			Cases:          []TestCaseResult{{CaseName: "case", Status: TestSuccess}},
+			DataSinks:      DataSinkMap{"llvm-profile": {{Name: "1", File: "1.profraw"}}},
+			ResourceUsage:  &ResourceUsage{UserCPUMillis: 6, SystemCPUMillis: 1, MaxRSSBytes: 1024},
+		},
+	}
+
+	aggregated := AggregateAttempts(tests)
+	want := []TestDetails{
+		{
+			Name:           "a",
+			Result:         TestFailure,
+			StartTime:      start,
+			DurationMillis: 12,
+			OutputFiles:    []string{"a/0/stdout-and-stderr.txt", "a/1/stdout-and-stderr.txt"},
+			Cases:          tests[0].Cases,
+			DataSinks: DataSinkMap{"llvm-profile": {
+				{Name: "0", File: "0.profraw"},
+				{Name: "1", File: "1.profraw"},
+			}},
+			Flaky:         true,
+			Verdict:       VerdictFlake,
+			Runs:          2,
+			FailedRuns:    1,
+			ResourceUsage: &ResourceUsage{UserCPUMillis: 10, SystemCPUMillis: 2, MaxRSSBytes: 2048},
+			Attempts: []TestAttempt{
+				{
+					Result:         TestFailure,
+					StartTime:      start,
+					DurationMillis: 5,
+					OutputFiles:    tests[0].OutputFiles,
+					Cases:          tests[0].Cases,
+					DataSinks:      tests[0].DataSinks,
+					ResourceUsage:  tests[0].ResourceUsage,
+				},
+				{
+					Result:         TestSuccess,
+					StartTime:      start.Add(time.Second),
+					DurationMillis: 7,
+					OutputFiles:    tests[2].OutputFiles,
+					Cases:          tests[2].Cases,
+					DataSinks:      tests[2].DataSinks,
+					ResourceUsage:  tests[2].ResourceUsage,
+				},
+			},
+		},
+		{
+			Name:           "b",
+			Result:         TestSuccess,
+			StartTime:      start,
+			DurationMillis: 1,
+			OutputFiles:    tests[1].OutputFiles,
+			Verdict:        VerdictPass,
+			Runs:           1,
+		},
+	}
+	if !reflect.DeepEqual(aggregated, want) {
+		t.Errorf("AggregateAttempts() = %+v, want %+v", aggregated, want)
+	}
+
+	flattened := FlattenAttempts(aggregated)
+	wantFlattened := []TestDetails{tests[0], tests[2], tests[1]}
+	if !reflect.DeepEqual(flattened, wantFlattened) {
+		t.Errorf("FlattenAttempts() = %+v, want %+v", flattened, wantFlattened)
+	}
+}
+
+func TestAggregateAttemptsVerdict(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		results    []TestResult
+		want       TestVerdict
+		wantResult TestResult
+	}{
+		{name: "single pass", results: []TestResult{TestSuccess}, want: VerdictPass, wantResult: TestSuccess},
+		{name: "single failure", results: []TestResult{TestFailure}, want: VerdictFail, wantResult: TestFailure},
+		{name: "skipped", results: []TestResult{TestSkipped, TestSkipped}, want: VerdictPass, wantResult: TestSkipped},
+		{name: "repeated failures", results: []TestResult{TestFailure, TestAborted}, want: VerdictFail, wantResult: TestAborted},
+		{name: "pass after skip", results: []TestResult{TestSkipped, TestSuccess}, want: VerdictPass, wantResult: TestSuccess},
+		{name: "pass after failure", results: []TestResult{TestFailure, TestSuccess}, want: VerdictFlake, wantResult: TestFailure},
+		{name: "pass after timeout", results: []TestResult{TestAborted, TestSuccess, TestSuccess}, want: VerdictFlake, wantResult: TestAborted},
+		{name: "failure after passes", results: []TestResult{TestSuccess, TestSuccess, TestFailure}, want: VerdictFlake, wantResult: TestFailure},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var tests []TestDetails
+			wantFailed := 0
+			for _, result := range tc.results {
+				tests = append(tests, TestDetails{Name: "test", Result: result})
+				if IsFailure(result) {
+					wantFailed++
+				}
+			}
+			aggregated := AggregateAttempts(tests)
+			if len(aggregated) != 1 {
+				t.Fatalf("got %d aggregated entries, want 1", len(aggregated))
+			}
+			test := aggregated[0]
+			if test.Verdict != tc.want || test.Runs != len(tc.results) || test.FailedRuns != wantFailed {
+				t.Errorf("got (Verdict, Runs, FailedRuns) = (%q, %d, %d), want (%q, %d, %d)",
+					test.Verdict, test.Runs, test.FailedRuns, tc.want, len(tc.results), wantFailed)
+			}
+			if test.Result != tc.wantResult {
+				t.Errorf("got result %q, want %q", test.Result, tc.wantResult)
+			}
+			if wantFlaky := tc.want == VerdictFlake; test.Flaky != wantFlaky {
+				t.Errorf("got flaky %t, want %t", test.Flaky, wantFlaky)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@
 package runtests
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -20,6 +21,7 @@ import (
 // DataSinkCopier copies data sinks from a remote host after a runtests invocation.
 type DataSinkCopier struct {
 	viewer    remoteViewer
+	runner    remoteRunner
 	sshClient *sshutil.Client
 }
 
@@ -32,6 +34,7 @@ func NewDataSinkCopier(client *sshutil.Client) (*DataSinkCopier, error) {
 	viewer := &sftpViewer{sftpClient}
 	copier := &DataSinkCopier{
 		viewer:    viewer,
+		runner:    client,
 		sshClient: client,
 	}
 	return copier, nil
@@ -42,6 +45,14 @@ func (c DataSinkCopier) Copy(references []DataSinkReference, localDir string) (D
 	return copyDataSinks(c.viewer, references, localDir)
 }
 
+// CopyBatch copies the same data sinks as Copy, but streams them from the
+// target with a tar invocation per remote directory instead of fetching each
+// file over SFTP. It requires tar on the target; callers may fall back to Copy
+// if it fails for other reasons than a lost connection.
+func (c DataSinkCopier) CopyBatch(ctx context.Context, references []DataSinkReference, localDir string) (DataSinkMap, error) {
+	return copyDataSinksBatch(ctx, c.runner, references, localDir)
+}
+
 // GetReferences returns a map of test name to a reference to the remote data sinks.
 func (c DataSinkCopier) GetReferences(remoteDir string) (map[string]DataSinkReference, error) {
 	return getDataSinkReferences(c.viewer, remoteDir)
@@ -0,0 +1,208 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package runtests
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+)
+
+const (
+	// maxFilesPerBatch bounds the number of files named on the command line of
+	// a single remote tar invocation.
+	maxFilesPerBatch = 500
+
+	// batchProgressInterval is how often progress is logged during a batch
+	// copy.
+	batchProgressInterval = 10 * time.Second
+)
+
+// remoteRunner runs commands on a remote host.
+type remoteRunner interface {
+	Run(ctx context.Context, command []string, stdout io.Writer, stderr io.Writer) error
+}
+
+// batchCopyStats tracks the progress of a batch copy.
+type batchCopyStats struct {
+	total      int
+	copied     int
+	bytes      int64
+	duplicates int
+	lastLog    time.Time
+}
+
+func (s *batchCopyStats) log(ctx context.Context, force bool) {
+	now := time.Now()
+	if !force && now.Sub(s.lastLog) < batchProgressInterval {
+		return
+	}
+	s.lastLog = now
+	logger.Debugf(ctx, "copied %d/%d data sinks (%d bytes, %d duplicates)", s.copied, s.total, s.bytes, s.duplicates)
+}
+
+// copyDataSinksBatch copies the same data sinks as copyDataSinks, but streams
+// them from the target as tar archives instead of fetching each file
+// separately, which avoids a round trip per file. Files whose contents are
+// identical to a file already copied are hard-linked to it rather than
+// written again.
+func copyDataSinksBatch(ctx context.Context, runner remoteRunner, references []DataSinkReference, localOutputDir string) (DataSinkMap, error) {
+	sinks := DataSinkMap{}
+	filesByDir := make(map[string][]string)
+	copied := make(map[string]struct{})
+	for _, ref := range references {
+		for name, files := range ref.Sinks {
+			if _, ok := sinks[name]; !ok {
+				sinks[name] = []DataSink{}
+			}
+			for _, file := range files {
+				if _, ok := copied[file.File]; ok {
+					continue
+				}
+				copied[file.File] = struct{}{}
+				filesByDir[ref.RemoteDir] = append(filesByDir[ref.RemoteDir], file.File)
+				sinks[name] = append(sinks[name], file)
+			}
+		}
+	}
+
+	var dirs []string
+	for dir := range filesByDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	stats := &batchCopyStats{total: len(copied), lastLog: time.Now()}
+	byHash := make(map[[sha256.Size]byte]string)
+	for _, dir := range dirs {
+		files := filesByDir[dir]
+		for len(files) > 0 {
+			n := len(files)
+			if n > maxFilesPerBatch {
+				n = maxFilesPerBatch
+			}
+			if err := copyBatch(ctx, runner, dir, files[:n], localOutputDir, byHash, stats); err != nil {
+				return nil, err
+			}
+			files = files[n:]
+		}
+	}
+	if stats.total > 0 {
+		stats.log(ctx, true)
+	}
+	return sinks, nil
+}
+
+// copyBatch copies files from remoteDir to localOutputDir with a single remote
+// tar invocation.
+func copyBatch(ctx context.Context, runner remoteRunner, remoteDir string, files []string, localOutputDir string, byHash map[[sha256.Size]byte]string, stats *batchCopyStats) error {
+	command := append([]string{"tar", "-c", "-f", "-", "-C", remoteDir}, files...)
+	pr, pw := io.Pipe()
+	var stderr strings.Builder
+	runErr := make(chan error, 1)
+	go func() {
+		err := runner.Run(ctx, command, pw, &stderr)
+		pw.CloseWithError(err)
+		runErr <- err
+	}()
+
+	expected := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		expected[path.Clean(file)] = struct{}{}
+	}
+	extractErr := extractBatch(ctx, tar.NewReader(pr), expected, localOutputDir, byHash, stats)
+	// Drain the pipe so that the remote command can exit if extraction
+	// stopped early.
+	io.Copy(io.Discard, pr)
+	if err := <-runErr; err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("failed to archive data sinks in %s: %w: %s", remoteDir, err, msg)
+		}
+		return fmt.Errorf("failed to archive data sinks in %s: %w", remoteDir, err)
+	}
+	if extractErr != nil {
+		return fmt.Errorf("failed to extract data sinks from %s: %w", remoteDir, extractErr)
+	}
+	if len(expected) > 0 {
+		var missing []string
+		for file := range expected {
+			missing = append(missing, file)
+		}
+		sort.Strings(missing)
+		return fmt.Errorf("data sinks missing from the archive of %s: %s", remoteDir, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func extractBatch(ctx context.Context, tr *tar.Reader, expected map[string]struct{}, localOutputDir string, byHash map[[sha256.Size]byte]string, stats *batchCopyStats) error {
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		if _, ok := expected[name]; !ok {
+			return fmt.Errorf("unexpected file %q in archive", hdr.Name)
+		}
+		delete(expected, name)
+
+		dest := filepath.Join(localOutputDir, filepath.FromSlash(name))
+		sum, err := writeFileWithHash(dest, tr)
+		if err != nil {
+			return err
+		}
+		stats.copied++
+		stats.bytes += hdr.Size
+		if first, ok := byHash[sum]; ok {
+			// Replace the new copy with a link to the identical one. If
+			// linking isn't supported the copy is left in place.
+			tmp := dest + ".dup"
+			if err := os.Link(first, tmp); err == nil {
+				if err := os.Rename(tmp, dest); err != nil {
+					os.Remove(tmp)
+					return err
+				}
+				stats.duplicates++
+			}
+		} else {
+			byHash[sum] = dest
+		}
+		stats.log(ctx, false)
+	}
+}
+
+func writeFileWithHash(dest string, r io.Reader) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	if err := os.MkdirAll(filepath.Dir(dest), 0o777); err != nil {
+		return sum, err
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, f.Close()
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package runtests
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeRunner serves tar archives of the requested files from an in-memory
+// map of remote directory to file contents.
+type fakeRunner struct {
+	files    map[string]map[string]string
+	commands [][]string
+}
+
+func (r *fakeRunner) Run(_ context.Context, command []string, stdout io.Writer, _ io.Writer) error {
+	r.commands = append(r.commands, command)
+	if len(command) < 6 || command[0] != "tar" || command[4] != "-C" {
+		return fmt.Errorf("unexpected command %v", command)
+	}
+	dir := r.files[command[5]]
+	tw := tar.NewWriter(stdout)
+	for _, name := range command[6:] {
+		contents, ok := dir[name]
+		if !ok {
+			return fmt.Errorf("tar: %s: No such file or directory", name)
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(contents)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tw, contents); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func TestCopyDataSinksBatch(t *testing.T) {
+	runner := &fakeRunner{
+		files: map[string]map[string]string{
+			"REMOTE_DIR1": {
+				"a/sink1": "profile",
+				"a/sink2": "other profile",
+			},
+			"REMOTE_DIR2": {
+				"b/sink3": "profile",
+			},
+		},
+	}
+	refs := []DataSinkReference{
+		{
+			Sinks: DataSinkMap{
+				"llvm-profile": {
+					{Name: "sink1", File: "a/sink1"},
+					{Name: "sink2", File: "a/sink2"},
+				},
+			},
+			RemoteDir: "REMOTE_DIR1",
+		},
+		{
+			Sinks: DataSinkMap{
+				"llvm-profile": {
+					// Already copied from the first reference.
+					{Name: "sink1", File: "a/sink1"},
+					{Name: "sink3", File: "b/sink3"},
+				},
+			},
+			RemoteDir: "REMOTE_DIR2",
+		},
+	}
+	copier := DataSinkCopier{runner: runner}
+	localDir := t.TempDir()
+	sinks, err := copier.CopyBatch(context.Background(), refs, localDir)
+	if err != nil {
+		t.Fatalf("failed to copy data sinks: %s", err)
+	}
+
+	expectedSinks := DataSinkMap{
+		"llvm-profile": {
+			{Name: "sink1", File: "a/sink1"},
+			{Name: "sink2", File: "a/sink2"},
+			{Name: "sink3", File: "b/sink3"},
+		},
+	}
+	if !reflect.DeepEqual(sinks, expectedSinks) {
+		t.Errorf("got data sinks %v, expected %v", sinks, expectedSinks)
+	}
+	if len(runner.commands) != 2 {
+		t.Errorf("ran %d remote commands, expected one per remote directory: %v", len(runner.commands), runner.commands)
+	}
+
+	for dir, files := range runner.files {
+		for name, contents := range files {
+			b, err := os.ReadFile(filepath.Join(localDir, name))
+			if err != nil {
+				t.Errorf("sink %s from %s was not copied: %s", name, dir, err)
+			} else if string(b) != contents {
+				t.Errorf("got %q for %s, expected %q", b, name, contents)
+			}
+		}
+	}
+
+	// Sinks with identical contents are deduplicated.
+	fi1, err := os.Stat(filepath.Join(localDir, "a/sink1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi3, err := os.Stat(filepath.Join(localDir, "b/sink3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(fi1, fi3) {
+		t.Errorf("identical data sinks were not deduplicated")
+	}
+}
+
+func TestCopyDataSinksBatchMissingFile(t *testing.T) {
+	runner := &fakeRunner{
+		files: map[string]map[string]string{"REMOTE_DIR": {}},
+	}
+	refs := []DataSinkReference{
+		{
+			Sinks:     DataSinkMap{"sink": {{Name: "missing", File: "missing"}}},
+			RemoteDir: "REMOTE_DIR",
+		},
+	}
+	copier := DataSinkCopier{runner: runner}
+	if _, err := copier.CopyBatch(context.Background(), refs, t.TempDir()); err == nil {
+		t.Errorf("expected an error copying a missing data sink")
+	}
+}
@@ -43,6 +43,62 @@ const (
 	TestSkipped TestResult = "SKIP"
 )
 
+// TestVerdict classifies a test by the results of all of its runs.
+type TestVerdict string
+
+const (
+	// VerdictPass means that none of the test's runs failed.
+	VerdictPass TestVerdict = "pass"
+
+	// VerdictFail means that all of the test's runs failed.
+	VerdictFail TestVerdict = "fail"
+
+	// VerdictFlake means that some, but not all, of the test's runs failed.
+	VerdictFlake TestVerdict = "flake"
+)
+
+// FailureClass classifies why a run of a suite of tests failed, so that the
+// infrastructure can decide between retrying the task and failing the change
+// under test.
+type FailureClass string
+
+const (
+	// FailureClassConnection means that the runner couldn't connect, or
+	// reconnect, to the target.
+	FailureClassConnection FailureClass = "connection_failure"
+
+	// FailureClassDeviceUnresponsive means that the target stopped responding
+	// while tests were running.
+	FailureClassDeviceUnresponsive FailureClass = "device_unresponsive"
+
+	// FailureClassTestTimeout means that tests timed out, and none failed
+	// because of the infrastructure.
+	FailureClassTestTimeout FailureClass = "test_timeout"
+
+	// FailureClassTestFailure means that tests failed, and none failed
+	// because of the infrastructure.
+	FailureClassTestFailure FailureClass = "test_failure"
+
+	// FailureClassTooling means that the runner itself failed, e.g. because
+	// of invalid inputs or an error writing outputs.
+	FailureClassTooling FailureClass = "tooling_error"
+
+	// FailureClassUnknown means that the runner failed for a reason it
+	// couldn't classify.
+	FailureClassUnknown FailureClass = "unknown"
+)
+
+// IsInfraFailure returns whether the failure is caused by the infrastructure
+// rather than by the tests, in which case retrying the task may succeed.
+func (c FailureClass) IsInfraFailure() bool {
+	switch c {
+	case FailureClassConnection, FailureClassDeviceUnresponsive, FailureClassTooling:
+		return true
+	default:
+		return false
+	}
+}
+
 // IsFailure returns whether a test result corresponds to any failure condition
 // (failure, timeout, etc.).
 func IsFailure(tr TestResult) bool {
@@ -58,6 +114,10 @@ type TestSummary struct {
 	// Outputs gives the suite-wide outputs, mapping canonical name of the
 	// output to its path.
 	Outputs map[string]string `json:"outputs,omitempty"`
+
+	// Classification classifies why the run failed, if it did: either
+	// because tests failed, or because the runner couldn't run them all.
+	Classification FailureClass `json:"classification,omitempty"`
 }
 
 // DataSink is a data sink exported by the test.
@@ -108,6 +168,67 @@ type TestDetails struct {
 
 	// Tags contain test metadata.
 	Tags []build.TestTag `json:"tags"`
+
+	// Attempts holds the individual runs of a test that was run more than
+	// once, in the order they were run. It is only set in aggregated
+	// summaries; see AggregateAttempts.
+	Attempts []TestAttempt `json:"attempts,omitempty"`
+
+	// Flaky is true if some, but not all, of the attempts of an aggregated
+	// test failed, i.e. if its Verdict is VerdictFlake.
+	Flaky bool `json:"flaky,omitempty"`
+
+	// Verdict classifies the test by the results of all of its runs, so that
+	// consumers don't need to inspect Attempts. It is only set in aggregated
+	// summaries, for every test.
+	Verdict TestVerdict `json:"verdict,omitempty"`
+
+	// Runs is the number of times the test was run, and FailedRuns the number
+	// of those runs that failed. They are only set in aggregated summaries.
+	Runs       int `json:"runs,omitempty"`
+	FailedRuns int `json:"failed_runs,omitempty"`
+
+	// ResourceUsage is the resources used by the test's process. It is only
+	// set for tests run as local subprocesses.
+	ResourceUsage *ResourceUsage `json:"resource_usage,omitempty"`
+}
+
+// TestAttempt is the result of a single run of a test that was run more than
+// once.
+type TestAttempt struct {
+	// Result is the result of the run.
+	Result TestResult `json:"result"`
+
+	// StartTime is the UTC time when the run was started.
+	StartTime time.Time `json:"start_time"`
+
+	// DurationMillis is how long the run took.
+	DurationMillis int64 `json:"duration_milliseconds"`
+
+	// OutputFiles are paths to the run's output files.
+	OutputFiles []string `json:"output_files"`
+
+	// Cases is individual test case results of the run.
+	Cases []TestCaseResult `json:"cases"`
+
+	// DataSinks gives the data sinks produced by the run.
+	DataSinks DataSinkMap `json:"data_sinks,omitempty"`
+
+	// ResourceUsage is the resources used by the run's process, if known.
+	ResourceUsage *ResourceUsage `json:"resource_usage,omitempty"`
+}
+
+// ResourceUsage is the resources used by a test's process, including those
+// used by any descendant processes it waited for.
+type ResourceUsage struct {
+	// UserCPUMillis is the CPU time spent in user mode.
+	UserCPUMillis int64 `json:"user_cpu_milliseconds"`
+
+	// SystemCPUMillis is the CPU time spent in kernel mode.
+	SystemCPUMillis int64 `json:"system_cpu_milliseconds"`
+
+	// MaxRSSBytes is the peak resident set size of the largest process.
+	MaxRSSBytes int64 `json:"max_rss_bytes"`
 }
 
 // TestCaseResult contains the details of a single test case, nested within a
@@ -522,5 +522,11 @@ func infraToolLogChecks() []FailureModeCheck {
 			String: fmt.Sprintf("botanist FATAL: %s", testrunnerconstants.SkippedRunningTestsMsg),
 			Type:   swarmingOutputType,
 		},
+		// testrunner fails with this error when the target is running a
+		// different build than the one the tests come from.
+		&stringInLogCheck{
+			String: fmt.Sprintf("botanist FATAL: %s", testrunnerconstants.BuildVersionMismatchMsg),
+			Type:   swarmingOutputType,
+		},
 	}
 }
@@ -16,10 +16,11 @@ import (
 )
 
 func usage() {
-	fmt.Printf(`testparser [-file <path>]
+	fmt.Printf(`testparser [-file <path>] [-format json|junit] [-name <name>]
 
 Reads test logs from either <path> or stdin, and writes a JSON formatted summary to stdout
-of any error messages parsed from the logs.
+of any error messages parsed from the logs. With -format junit, a JUnit XML report is
+written instead.
 `)
 }
 
@@ -31,11 +32,18 @@ func indentJSON(jsonBytes []byte) ([]byte, error) {
 
 func main() {
 	inputPath := flag.String("file", "", "Path to a file to be parsed. Optional; defaults to stdin.")
+	format := flag.String("format", "json", "Output format, either json or junit.")
+	name := flag.String("name", "", "Name of the test, used as the name of the JUnit report and of the suite of cases without one.")
 	flag.Usage = usage
 
 	// Parse any global flags (e.g. those for glog)
 	flag.Parse()
 
+	if *format != "json" && *format != "junit" {
+		fmt.Fprintf(os.Stderr, "Unknown output format %q\n", *format)
+		os.Exit(1)
+	}
+
 	var inputBytes []byte
 	var err error
 	if *inputPath != "" {
@@ -53,6 +61,13 @@ func main() {
 	}
 
 	result := testparser.Parse(inputBytes)
+	if *format == "junit" {
+		if err := testparser.WriteJUnitXML(os.Stdout, *name, result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JUnit XML: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 	jsonData, err := json.Marshal(result)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error marshaling JSON: %s\n", err)
@@ -0,0 +1,124 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testparser
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr,omitempty"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+
+	duration time.Duration
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteJUnitXML writes cases to w as a JUnit XML report, the format consumed
+// by most external CI systems. Cases are grouped into a <testsuite> per
+// SuiteName in the order the suites first appear; cases without a suite name
+// are grouped under name, which is also used as the name of the report.
+// Failed cases are reported as failures and aborted cases as errors.
+func WriteJUnitXML(w io.Writer, name string, cases []runtests.TestCaseResult) error {
+	report := junitTestSuites{Name: name}
+	suiteIndex := make(map[string]int)
+	var total time.Duration
+	for _, c := range cases {
+		suiteName := c.SuiteName
+		if suiteName == "" {
+			suiteName = name
+		}
+		i, ok := suiteIndex[suiteName]
+		if !ok {
+			i = len(report.Suites)
+			suiteIndex[suiteName] = i
+			report.Suites = append(report.Suites, junitTestSuite{Name: suiteName})
+		}
+		suite := &report.Suites[i]
+
+		caseName := c.CaseName
+		if caseName == "" {
+			caseName = c.DisplayName
+		}
+		tc := junitTestCase{
+			Name:      caseName,
+			ClassName: suiteName,
+			Time:      junitSeconds(c.Duration),
+		}
+		switch c.Status {
+		case runtests.TestFailure:
+			tc.Failure = &junitFailure{Message: c.FailReason, Type: c.Format}
+			suite.Failures++
+		case runtests.TestAborted:
+			tc.Error = &junitFailure{Message: c.FailReason, Type: c.Format}
+			suite.Errors++
+		case runtests.TestSkipped:
+			tc.Skipped = &struct{}{}
+			suite.Skipped++
+		}
+		suite.Tests++
+		suite.duration += c.Duration
+		suite.Cases = append(suite.Cases, tc)
+		total += c.Duration
+	}
+	for i := range report.Suites {
+		suite := &report.Suites[i]
+		suite.Time = junitSeconds(suite.duration)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Skipped += suite.Skipped
+	}
+	report.Time = junitSeconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("failed to encode JUnit XML: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testparser
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+func TestWriteJUnitXML(t *testing.T) {
+	cases := []runtests.TestCaseResult{
+		{
+			DisplayName: "Suite.Pass",
+			SuiteName:   "Suite",
+			CaseName:    "Pass",
+			Status:      runtests.TestSuccess,
+			Duration:    1500 * time.Millisecond,
+			Format:      "GoogleTest",
+		},
+		{
+			DisplayName: "Suite.Fail",
+			SuiteName:   "Suite",
+			CaseName:    "Fail",
+			Status:      runtests.TestFailure,
+			Duration:    time.Second,
+			Format:      "GoogleTest",
+			FailReason:  `expected "a" < "b"`,
+		},
+		{
+			DisplayName: "timeout",
+			Status:      runtests.TestAborted,
+		},
+		{
+			DisplayName: "Other.Skip",
+			SuiteName:   "Other",
+			CaseName:    "Skip",
+			Status:      runtests.TestSkipped,
+		},
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="foo_test" tests="4" failures="1" errors="1" skipped="1" time="2.500">
+	<testsuite name="Suite" tests="2" failures="1" errors="0" skipped="0" time="2.500">
+		<testcase name="Pass" classname="Suite" time="1.500"></testcase>
+		<testcase name="Fail" classname="Suite" time="1.000">
+			<failure message="expected &#34;a&#34; &lt; &#34;b&#34;" type="GoogleTest"></failure>
+		</testcase>
+	</testsuite>
+	<testsuite name="foo_test" tests="1" failures="0" errors="1" skipped="0" time="0.000">
+		<testcase name="timeout" classname="foo_test" time="0.000">
+			<error></error>
+		</testcase>
+	</testsuite>
+	<testsuite name="Other" tests="1" failures="0" errors="0" skipped="1" time="0.000">
+		<testcase name="Skip" classname="Other" time="0.000">
+			<skipped></skipped>
+		</testcase>
+	</testsuite>
+</testsuites>
+`
+	var buf bytes.Buffer
+	if err := WriteJUnitXML(&buf, "foo_test", cases); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("WriteJUnitXML returned wrong output (-want +got):\n%s", diff)
+	}
+}
@@ -8,13 +8,46 @@ package testparser
 import (
 	"bytes"
 	"regexp"
+	"sync"
 
 	"go.fuchsia.dev/fuchsia/src/connectivity/network/testing/conformance/parseoutput"
 	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
 )
 
+// CaseParser parses the lines of a test's stdout, starting at the line that
+// matched its preamble pattern, into test case results.
+type CaseParser func(lines [][]byte) []runtests.TestCaseResult
+
+var (
+	registeredMu       sync.Mutex
+	registeredPatterns []*regexp.Regexp
+	registeredParsers  = make(map[*regexp.Regexp]CaseParser)
+)
+
+// Register adds a parser for a test output format that isn't supported by
+// this package. Parse calls parse when preamble matches a line of stdout
+// before the preamble of any other format. The built-in formats take
+// precedence over registered ones whose preambles match the same line, and
+// registered formats take precedence in the order they were registered.
+//
+// Register is typically called from an init function. It panics if preamble
+// or parse is nil or if preamble is already registered.
+func Register(preamble *regexp.Regexp, parse CaseParser) {
+	if preamble == nil || parse == nil {
+		panic("testparser: Register called with a nil preamble or parser")
+	}
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	if _, ok := registeredParsers[preamble]; ok {
+		panic("testparser: Register called twice for preamble " + preamble.String())
+	}
+	registeredPatterns = append(registeredPatterns, preamble)
+	registeredParsers[preamble] = parse
+}
+
 // Parse takes stdout from a test program and returns structured results.
-// Internally, a variety of test program stdout formats are supported.
+// Internally, a variety of test program stdout formats are supported, in
+// addition to any formats added with Register.
 // If no structured results were identified, an empty slice is returned.
 func Parse(stdout []byte) []runtests.TestCaseResult {
 	lines := bytes.Split(stdout, []byte{'\n'})
@@ -28,6 +61,9 @@ func Parse(stdout []byte) []runtests.TestCaseResult {
 		zirconUtestPreamblePattern,
 		parseoutput.TestPreamblePattern,
 	}
+	registeredMu.Lock()
+	res = append(res, registeredPatterns...)
+	registeredMu.Unlock()
 	remainingLines, match := firstMatch(lines, res)
 
 	var cases []runtests.TestCaseResult
@@ -48,6 +84,13 @@ func Parse(stdout []byte) []runtests.TestCaseResult {
 		cases = parseZirconUtest(remainingLines)
 	case parseoutput.TestPreamblePattern:
 		cases = parseNetworkConformanceTest(remainingLines)
+	default:
+		if match != nil {
+			registeredMu.Lock()
+			parse := registeredParsers[match]
+			registeredMu.Unlock()
+			cases = parse(remainingLines)
+		}
 	}
 
 	// Ensure that an empty set of cases is serialized to JSON as an empty
@@ -7,6 +7,8 @@ package testparser
 import (
 	"bytes"
 	"encoding/json"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -70,6 +72,37 @@ func TestParseNoTestCases(t *testing.T) {
 	testCase(t, "non-test output", "[]")
 }
 
+func TestParseRegistered(t *testing.T) {
+	preamble := regexp.MustCompile(`^== custom test output ==$`)
+	Register(preamble, func(lines [][]byte) []runtests.TestCaseResult {
+		var cases []runtests.TestCaseResult
+		for _, line := range lines[1:] {
+			if name := strings.TrimPrefix(string(line), "ok "); name != string(line) {
+				cases = append(cases, runtests.TestCaseResult{
+					DisplayName: name,
+					CaseName:    name,
+					Status:      runtests.TestSuccess,
+					Format:      "Custom",
+				})
+			}
+		}
+		return cases
+	})
+	stdout := `
+setting up
+== custom test output ==
+ok first
+ok second
+`
+	testCaseCmp(t, stdout, []runtests.TestCaseResult{
+		{DisplayName: "first", CaseName: "first", Status: runtests.TestSuccess, Format: "Custom"},
+		{DisplayName: "second", CaseName: "second", Status: runtests.TestSuccess, Format: "Custom"},
+	})
+
+	// Built-in formats are still recognized.
+	testCaseCmp(t, "non-test output", []runtests.TestCaseResult{})
+}
+
 func TestParseTrfTest(t *testing.T) {
 	stdout := `
 Running test 'fuchsia-pkg://fuchsia.com/f2fs-fs-tests#meta/f2fs-unittest.cm'
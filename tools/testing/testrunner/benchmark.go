@@ -0,0 +1,150 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder"
+	"go.fuchsia.dev/fuchsia/tools/lib/clock"
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+	"go.fuchsia.dev/fuchsia/tools/lib/subprocess"
+)
+
+const (
+	// The default amount of time to wait for the device to cool down before
+	// running a benchmark anyway.
+	defaultThermalTimeout = 5 * time.Minute
+
+	// How often to check the device temperature while waiting for it to cool
+	// down.
+	thermalPollInterval = 10 * time.Second
+
+	// Tags added to the results of tests run in a benchmark shard.
+	benchmarkStartTemperatureTag = "benchmark_start_temperature_celsius"
+	benchmarkEndTemperatureTag   = "benchmark_end_temperature_celsius"
+	benchmarkCooldownTag         = "benchmark_cooldown_ms"
+	benchmarkThermalStableTag    = "benchmark_thermal_stable"
+)
+
+// benchmarkEnv runs the host-side hooks of the BenchmarkConfig of a benchmark
+// shard.
+type benchmarkEnv struct {
+	config testsharder.BenchmarkConfig
+	runner cmdRunner
+}
+
+func newBenchmarkEnv(config testsharder.BenchmarkConfig, dir string, env []string) *benchmarkEnv {
+	return &benchmarkEnv{
+		config: config,
+		runner: newRunner(dir, env),
+	}
+}
+
+// setup runs the configured setup command, if any.
+func (b *benchmarkEnv) setup(ctx context.Context) error {
+	if len(b.config.SetupCommand) == 0 {
+		return nil
+	}
+	logger.Debugf(ctx, "running benchmark setup command: %s", b.config.SetupCommand)
+	if err := b.runner.Run(ctx, b.config.SetupCommand, subprocess.RunOptions{}); err != nil {
+		return fmt.Errorf("benchmark setup command failed: %w", err)
+	}
+	return nil
+}
+
+// temperature returns the current device temperature in degrees Celsius.
+func (b *benchmarkEnv) temperature(ctx context.Context) (float64, error) {
+	var stdout bytes.Buffer
+	if err := b.runner.Run(ctx, b.config.ThermalCommand, subprocess.RunOptions{Stdout: &stdout}); err != nil {
+		return 0, fmt.Errorf("thermal command failed: %w", err)
+	}
+	temp, err := strconv.ParseFloat(strings.TrimSpace(stdout.String()), 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse thermal command output %q: %w", stdout.String(), err)
+	}
+	return temp, nil
+}
+
+// cooldown waits until the device temperature is at or below the configured
+// maximum or the thermal timeout expires. It returns the temperature that the
+// test will start at and whether the device reached the maximum temperature.
+func (b *benchmarkEnv) cooldown(ctx context.Context) (float64, bool, error) {
+	timeout := defaultThermalTimeout
+	if b.config.ThermalTimeoutSecs > 0 {
+		timeout = time.Duration(b.config.ThermalTimeoutSecs) * time.Second
+	}
+	deadline := clock.Now(ctx).Add(timeout)
+	for {
+		temp, err := b.temperature(ctx)
+		if err != nil {
+			return 0, false, err
+		}
+		if b.config.MaxTemperature <= 0 || temp <= b.config.MaxTemperature {
+			return temp, true, nil
+		}
+		if !clock.Now(ctx).Before(deadline) {
+			logger.Warningf(ctx, "device still at %.1fC after waiting %s to cool down to %.1fC", temp, timeout, b.config.MaxTemperature)
+			return temp, false, nil
+		}
+		logger.Debugf(ctx, "device at %.1fC, waiting to cool down to %.1fC", temp, b.config.MaxTemperature)
+		select {
+		case <-ctx.Done():
+			return 0, false, ctx.Err()
+		case <-clock.After(ctx, thermalPollInterval):
+		}
+	}
+}
+
+// benchmarkRun is the thermal state of the device before a test of a
+// benchmark shard.
+type benchmarkRun struct {
+	startTemp float64
+	stable    bool
+	cooldown  time.Duration
+}
+
+// prepare waits for the device to cool down before a test runs. It must be
+// called before the test's timeout starts, so that the time spent cooling down
+// doesn't count against it. It returns nil if the config has no thermal
+// command.
+func (b *benchmarkEnv) prepare(ctx context.Context) (*benchmarkRun, error) {
+	if len(b.config.ThermalCommand) == 0 {
+		return nil, nil
+	}
+	cooldownStart := clock.Now(ctx)
+	startTemp, stable, err := b.cooldown(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &benchmarkRun{
+		startTemp: startTemp,
+		stable:    stable,
+		cooldown:  clock.Now(ctx).Sub(cooldownStart),
+	}, nil
+}
+
+// annotate tags result with the thermal state of the device before and after
+// the test.
+func (b *benchmarkEnv) annotate(ctx context.Context, run *benchmarkRun, result *TestResult) {
+	tags := []build.TestTag{
+		{Key: benchmarkStartTemperatureTag, Value: strconv.FormatFloat(run.startTemp, 'f', 1, 64)},
+		{Key: benchmarkCooldownTag, Value: strconv.FormatInt(run.cooldown.Milliseconds(), 10)},
+		{Key: benchmarkThermalStableTag, Value: strconv.FormatBool(run.stable)},
+	}
+	if endTemp, err := b.temperature(ctx); err != nil {
+		logger.Warningf(ctx, "failed to read device temperature after %s: %s", result.Name, err)
+	} else {
+		tags = append(tags, build.TestTag{Key: benchmarkEndTemperatureTag, Value: strconv.FormatFloat(endTemp, 'f', 1, 64)})
+	}
+	// Don't modify the tags of the test, which may be shared with other runs.
+	result.Tags = append(append([]build.TestTag(nil), result.Tags...), tags...)
+}
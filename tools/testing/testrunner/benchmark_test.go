@@ -0,0 +1,252 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder"
+	"go.fuchsia.dev/fuchsia/tools/lib/clock"
+	"go.fuchsia.dev/fuchsia/tools/lib/subprocess"
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+	"go.fuchsia.dev/fuchsia/tools/testing/tap"
+)
+
+// fakeThermalRunner prints the next of a series of temperatures each time it
+// is run.
+type fakeThermalRunner struct {
+	temps []string
+	cmds  [][]string
+}
+
+func (r *fakeThermalRunner) Run(_ context.Context, command []string, options subprocess.RunOptions) error {
+	r.cmds = append(r.cmds, command)
+	if options.Stdout == nil {
+		return nil
+	}
+	if len(r.temps) == 0 {
+		return fmt.Errorf("no more temperatures")
+	}
+	var temp string
+	temp, r.temps = r.temps[0], r.temps[1:]
+	_, err := io.WriteString(options.Stdout, temp+"\n")
+	return err
+}
+
+func TestBenchmarkSetup(t *testing.T) {
+	runner := &fakeThermalRunner{}
+	env := &benchmarkEnv{
+		config: testsharder.BenchmarkConfig{SetupCommand: []string{"setup.sh", "--governor=performance"}},
+		runner: runner,
+	}
+	if err := env.setup(context.Background()); err != nil {
+		t.Fatalf("setup() failed: %s", err)
+	}
+	if diff := cmp.Diff([][]string{{"setup.sh", "--governor=performance"}}, runner.cmds); diff != "" {
+		t.Errorf("unexpected commands (-want +got):\n%s", diff)
+	}
+}
+
+func TestBenchmarkPrepareAndAnnotate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config testsharder.BenchmarkConfig
+		temps  []string
+		// The number of times the device is expected to be waited on to cool
+		// down.
+		waits    int
+		wantTags []build.TestTag
+	}{
+		{
+			name:   "already cool",
+			config: testsharder.BenchmarkConfig{MaxTemperature: 50},
+			temps:  []string{"40", "42.3"},
+			wantTags: []build.TestTag{
+				{Key: benchmarkStartTemperatureTag, Value: "40.0"},
+				{Key: benchmarkCooldownTag, Value: "0"},
+				{Key: benchmarkThermalStableTag, Value: "true"},
+				{Key: benchmarkEndTemperatureTag, Value: "42.3"},
+			},
+		},
+		{
+			name:   "waits to cool down",
+			config: testsharder.BenchmarkConfig{MaxTemperature: 50},
+			temps:  []string{"60", "55", "45", "47"},
+			waits:  2,
+			wantTags: []build.TestTag{
+				{Key: benchmarkStartTemperatureTag, Value: "45.0"},
+				{Key: benchmarkCooldownTag, Value: "20000"},
+				{Key: benchmarkThermalStableTag, Value: "true"},
+				{Key: benchmarkEndTemperatureTag, Value: "47.0"},
+			},
+		},
+		{
+			name:   "gives up cooling down",
+			config: testsharder.BenchmarkConfig{MaxTemperature: 50, ThermalTimeoutSecs: 15},
+			temps:  []string{"60", "60", "59", "61"},
+			waits:  2,
+			wantTags: []build.TestTag{
+				{Key: benchmarkStartTemperatureTag, Value: "59.0"},
+				{Key: benchmarkCooldownTag, Value: "20000"},
+				{Key: benchmarkThermalStableTag, Value: "false"},
+				{Key: benchmarkEndTemperatureTag, Value: "61.0"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeClock := clock.NewFakeClock()
+			ctx := clock.NewContext(context.Background(), fakeClock)
+
+			tc.config.ThermalCommand = []string{"thermal.sh"}
+			env := &benchmarkEnv{
+				config: tc.config,
+				runner: &fakeThermalRunner{temps: tc.temps},
+			}
+
+			type prepareResult struct {
+				run *benchmarkRun
+				err error
+			}
+			ch := make(chan prepareResult, 1)
+			go func() {
+				run, err := env.prepare(ctx)
+				ch <- prepareResult{run, err}
+			}()
+			for i := 0; i < tc.waits; i++ {
+				<-fakeClock.AfterCalledChan()
+				fakeClock.Advance(thermalPollInterval)
+			}
+
+			var res prepareResult
+			select {
+			case res = <-ch:
+			case <-time.After(10 * time.Second):
+				t.Fatalf("prepare() did not complete after %d cooldown waits", tc.waits)
+			}
+			if res.err != nil {
+				t.Fatalf("prepare() failed: %s", res.err)
+			}
+			result := &TestResult{Name: "bench"}
+			env.annotate(ctx, res.run, result)
+			if diff := cmp.Diff(tc.wantTags, result.Tags); diff != "" {
+				t.Errorf("unexpected tags (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRunAndOutputTestsBenchmark(t *testing.T) {
+	ctx := clock.NewContext(context.Background(), clock.NewFakeClock())
+	var tests []testsharder.Test
+	for _, name := range []string{"a", "b"} {
+		tests = append(tests, testsharder.Test{
+			Test:         build.Test{Name: name, OS: "fuchsia", PackageURL: "fuchsia-pkg://fuchsia.com/" + name + "#meta/" + name + ".cm"},
+			RunAlgorithm: testsharder.StopOnFailure,
+			Runs:         1,
+			Timeout:      time.Minute,
+		})
+	}
+	// The benchmark hooks must not hide the optional interfaces of the
+	// tester, such as the ability to recover the target.
+	tester := &fakeRecoverableTester{fakeTester: &fakeTester{
+		runTest: func(_ context.Context, test testsharder.Test, _, _ io.Writer) (runtests.TestResult, error) {
+			if test.Name == "a" {
+				return "", fmt.Errorf("fatal error")
+			}
+			return runtests.TestSuccess, nil
+		},
+	}}
+	testerForTest := func(testsharder.Test) (Tester, *[]runtests.DataSinkReference, error) {
+		return tester, &[]runtests.DataSinkReference{}, nil
+	}
+	outputs, err := CreateTestOutputs(tap.NewProducer(io.Discard), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := runOptions{
+		recovery: &recoveryPolicy{afterFatalFailures: 1, maxRecoveries: 1},
+		bench: &benchmarkEnv{
+			config: testsharder.BenchmarkConfig{ThermalCommand: []string{"thermal.sh"}, MaxTemperature: 50},
+			runner: &fakeThermalRunner{temps: []string{"40", "41", "42", "43"}},
+		},
+	}
+	if err := runAndOutputTests(ctx, tests, testerForTest, outputs, t.TempDir(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if tester.rebootCalls != 1 {
+		t.Errorf("got %d reboots, want 1", tester.rebootCalls)
+	}
+	wantStartTemps := map[string]string{"a": "40.0", "b": "42.0"}
+	for _, test := range outputs.Summary.Tests {
+		var got string
+		for _, tag := range test.Tags {
+			if tag.Key == benchmarkStartTemperatureTag {
+				got = tag.Value
+			}
+		}
+		if got != wantStartTemps[test.Name] {
+			t.Errorf("%s started at %q, want %q", test.Name, got, wantStartTemps[test.Name])
+		}
+	}
+}
+
+func TestExecuteBenchmarkShard(t *testing.T) {
+	// Only the benchmark shard runs the setup command, once before its tests.
+	marker := filepath.Join(t.TempDir(), "setup-done")
+	shards := []testShard{
+		{
+			name: "regular",
+			tests: []testsharder.Test{
+				{Test: build.Test{Name: "foo", OS: "fuchsia", PackageURL: "fuchsia-pkg://foo/foo.cm"}, Runs: 1},
+			},
+		},
+		{
+			name: "bench",
+			tests: []testsharder.Test{
+				{Test: build.Test{Name: "bar", OS: "fuchsia", PackageURL: "fuchsia-pkg://foo/bar.cm"}, Runs: 1},
+			},
+			benchmark: &testsharder.BenchmarkConfig{SetupCommand: []string{"mkdir", marker}},
+		},
+	}
+
+	oldSerialTester := serialTester
+	defer func() {
+		serialTester = oldSerialTester
+	}()
+	var setupDoneBefore []bool
+	serialTester = func(_ context.Context, _ string) (Tester, error) {
+		return &fakeTester{
+			runTest: func(_ context.Context, _ testsharder.Test, _, _ io.Writer) (runtests.TestResult, error) {
+				_, err := os.Stat(marker)
+				setupDoneBefore = append(setupDoneBefore, err == nil)
+				return runtests.TestSuccess, nil
+			},
+		}, nil
+	}
+
+	o, err := CreateTestOutputs(tap.NewProducer(io.Discard), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if err := execute(context.Background(), shards, o, nil, net.IPAddr{}, "", "socketpath", t.TempDir(), TestrunnerFlags{}, nil, nil); err != nil {
+		t.Fatalf("execute() failed: %s", err)
+	}
+	if diff := cmp.Diff([]bool{false, true}, setupDoneBefore); diff != "" {
+		t.Errorf("unexpected setup state before each test (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+	"go.fuchsia.dev/fuchsia/tools/testing/testrunner/constants"
+)
+
+// The file on the target holding the version of the build it's running.
+const targetBuildVersionPath = "/config/build-info/version"
+
+// for testability
+var readTargetBuildVersion = func(ctx context.Context, connector *sshConnector, addr net.IPAddr, sshKeyFile string) (string, error) {
+	client, err := connector.connect(ctx, addr, sshKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to establish an SSH connection: %w", err)
+	}
+	defer client.Close()
+
+	var stdout, stderr bytes.Buffer
+	if err := client.Run(ctx, []string{"cat", targetBuildVersionPath}, &stdout, &stderr); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w: %s", targetBuildVersionPath, err, stderr.String())
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// checkBuildVersion returns an error if the target isn't running the build
+// version expected by the tests, so that new tests aren't run against stale
+// images.
+func checkBuildVersion(ctx context.Context, connector *sshConnector, expected string, addr net.IPAddr, sshKeyFile string) error {
+	version, err := readTargetBuildVersion(ctx, connector, addr, sshKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to get the target's build version: %w", err)
+	}
+	if version != expected {
+		return fmt.Errorf("%s: target build version is %q, want %q", constants.BuildVersionMismatchMsg, version, expected)
+	}
+	logger.Infof(ctx, "target is running the expected build version %q", version)
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/tools/testing/testrunner/constants"
+)
+
+func TestCheckBuildVersion(t *testing.T) {
+	ctx := context.Background()
+	readErr := errors.New("ssh failed")
+
+	for _, tc := range []struct {
+		name          string
+		targetVersion string
+		readErr       error
+		wantErr       error
+		wantMismatch  bool
+	}{
+		{
+			name:          "matching version",
+			targetVersion: "8.20221015.1.1",
+		},
+		{
+			name:          "mismatched version",
+			targetVersion: "8.20221014.3.1",
+			wantMismatch:  true,
+		},
+		{
+			name:    "failed to read version",
+			readErr: readErr,
+			wantErr: readErr,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			oldReadTargetBuildVersion := readTargetBuildVersion
+			defer func() {
+				readTargetBuildVersion = oldReadTargetBuildVersion
+			}()
+			readTargetBuildVersion = func(context.Context, *sshConnector, net.IPAddr, string) (string, error) {
+				return tc.targetVersion, tc.readErr
+			}
+
+			err := checkBuildVersion(ctx, nil, "8.20221015.1.1", net.IPAddr{}, "key")
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Errorf("got error %v, want %v", err, tc.wantErr)
+				}
+			} else if tc.wantMismatch {
+				if err == nil || !strings.HasPrefix(err.Error(), constants.BuildVersionMismatchMsg) {
+					t.Errorf("got error %v, want an error starting with %q", err, constants.BuildVersionMismatchMsg)
+				}
+			} else if err != nil {
+				t.Errorf("got unexpected error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"errors"
+
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+// failureClassPriority orders the classes from the one that best explains a
+// failed run to the one that explains it least. Failures caused by the
+// infrastructure come first, as tests that failed alongside them may have
+// failed because of them.
+var failureClassPriority = []runtests.FailureClass{
+	runtests.FailureClassDeviceUnresponsive,
+	runtests.FailureClassConnection,
+	runtests.FailureClassTooling,
+	runtests.FailureClassUnknown,
+	runtests.FailureClassTestTimeout,
+	runtests.FailureClassTestFailure,
+}
+
+// classifiedError is an error returned by a tester along with its class.
+type classifiedError struct {
+	class runtests.FailureClass
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// classifyError returns err wrapped with class. Errors that are already
+// classified keep their class, as the innermost error is the one closest to
+// the root cause.
+func classifyError(class runtests.FailureClass, err error) error {
+	if err == nil {
+		return nil
+	}
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return err
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// errorClass returns the class err was wrapped with. Errors that weren't
+// classified are runtests.FailureClassTestTimeout if they come from the
+// context's deadline expiring or it being canceled, e.g. at the end of the
+// shard's timeout, and runtests.FailureClassUnknown otherwise.
+func errorClass(err error) runtests.FailureClass {
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.class
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return runtests.FailureClassTestTimeout
+	}
+	return runtests.FailureClassUnknown
+}
+
+// summaryClass returns the class of the failures of tests, given the class of
+// the fatal error that ended the last run of some of them, by name. Only the
+// final result of each test counts, so that a test that passed when retried
+// doesn't fail the run. It returns an empty class if no test failed.
+func summaryClass(tests []runtests.TestDetails, fatalErrorClasses map[string]runtests.FailureClass) runtests.FailureClass {
+	last := make(map[string]runtests.TestResult)
+	var order []string
+	for _, test := range tests {
+		if _, ok := last[test.Name]; !ok {
+			order = append(order, test.Name)
+		}
+		last[test.Name] = test.Result
+	}
+	classes := make(map[runtests.FailureClass]struct{})
+	for _, name := range order {
+		if !runtests.IsFailure(last[name]) {
+			continue
+		}
+		if class, ok := fatalErrorClasses[name]; ok {
+			classes[class] = struct{}{}
+		} else if last[name] == runtests.TestAborted {
+			classes[runtests.FailureClassTestTimeout] = struct{}{}
+		} else {
+			classes[runtests.FailureClassTestFailure] = struct{}{}
+		}
+	}
+	for _, class := range failureClassPriority {
+		if _, ok := classes[class]; ok {
+			return class
+		}
+	}
+	return ""
+}
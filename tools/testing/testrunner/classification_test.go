@@ -0,0 +1,121 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+func TestClassifyError(t *testing.T) {
+	if err := classifyError(runtests.FailureClassConnection, nil); err != nil {
+		t.Errorf("classifyError(_, nil) = %s, want nil", err)
+	}
+
+	baseErr := errors.New("EOF")
+	err := classifyError(runtests.FailureClassDeviceUnresponsive, baseErr)
+	if !errors.Is(err, baseErr) {
+		t.Errorf("classified error %s doesn't wrap %s", err, baseErr)
+	}
+	if err.Error() != baseErr.Error() {
+		t.Errorf("got message %q, want %q", err.Error(), baseErr.Error())
+	}
+
+	// Wrapping keeps the class, and so does classifying again.
+	err = fmt.Errorf("gave up: %w", err)
+	err = classifyError(runtests.FailureClassConnection, err)
+	if got := errorClass(err); got != runtests.FailureClassDeviceUnresponsive {
+		t.Errorf("got class %q, want %q", got, runtests.FailureClassDeviceUnresponsive)
+	}
+
+	if got := errorClass(baseErr); got != runtests.FailureClassUnknown {
+		t.Errorf("got class %q for an unclassified error, want %q", got, runtests.FailureClassUnknown)
+	}
+	// Running out of time isn't an infrastructure failure.
+	for _, err := range []error{
+		context.DeadlineExceeded,
+		fmt.Errorf("test foo_test: %w", context.Canceled),
+	} {
+		if got := errorClass(err); got != runtests.FailureClassTestTimeout {
+			t.Errorf("got class %q for %s, want %q", got, err, runtests.FailureClassTestTimeout)
+		}
+	}
+}
+
+func TestSummaryClass(t *testing.T) {
+	testCases := []struct {
+		name              string
+		tests             []runtests.TestDetails
+		fatalErrorClasses map[string]runtests.FailureClass
+		want              runtests.FailureClass
+	}{
+		{
+			name: "all passed",
+			tests: []runtests.TestDetails{
+				{Name: "a", Result: runtests.TestSuccess},
+			},
+		},
+		{
+			name: "passed on retry",
+			tests: []runtests.TestDetails{
+				{Name: "a", Result: runtests.TestFailure},
+				{Name: "a", Result: runtests.TestSuccess},
+			},
+		},
+		{
+			name: "test failure",
+			tests: []runtests.TestDetails{
+				{Name: "a", Result: runtests.TestFailure},
+				{Name: "b", Result: runtests.TestSuccess},
+			},
+			want: runtests.FailureClassTestFailure,
+		},
+		{
+			name: "timeout outranks failure",
+			tests: []runtests.TestDetails{
+				{Name: "a", Result: runtests.TestFailure},
+				{Name: "b", Result: runtests.TestAborted},
+			},
+			want: runtests.FailureClassTestTimeout,
+		},
+		{
+			name: "fatal error outranks test failures",
+			tests: []runtests.TestDetails{
+				{Name: "a", Result: runtests.TestFailure},
+				{Name: "b", Result: runtests.TestAborted},
+				{Name: "c", Result: runtests.TestAborted},
+			},
+			fatalErrorClasses: map[string]runtests.FailureClass{
+				"b": runtests.FailureClassConnection,
+				"c": runtests.FailureClassDeviceUnresponsive,
+			},
+			want: runtests.FailureClassDeviceUnresponsive,
+		},
+		{
+			name: "fatal error of a test that passed on retry",
+			tests: []runtests.TestDetails{
+				{Name: "a", Result: runtests.TestAborted},
+				{Name: "a", Result: runtests.TestSuccess},
+				{Name: "b", Result: runtests.TestFailure},
+			},
+			fatalErrorClasses: map[string]runtests.FailureClass{
+				"a": runtests.FailureClassConnection,
+			},
+			want: runtests.FailureClassTestFailure,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := summaryClass(tc.tests, tc.fatalErrorClasses); got != tc.want {
+				t.Errorf("summaryClass() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
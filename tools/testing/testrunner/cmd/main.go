@@ -20,9 +20,12 @@ import (
 )
 
 func usage() {
-	fmt.Printf(`testrunner [flags] tests-file
+	fmt.Printf(`testrunner [flags] tests-file...
 
-Executes all tests found in the JSON [tests-file]
+Executes all tests found in the JSON [tests-file]s, one after the other. A
+[tests-file] may also be a directory, whose JSON files are run in lexical
+order. All tests files share the connections to the target, the outputs and
+the final snapshot.
 Fuchsia tests require both the node address of the fuchsia instance and a private
 SSH key corresponding to a authorized key to be set in the environment under
 %s and %s respectively.
@@ -45,11 +48,28 @@ func main() {
 	flag.IntVar(&flags.FfxExperimentLevel, "ffx-experiment-level", 0, "The level of experimental features to enable. If -ffx is not set, this will have no effect.")
 	flag.BoolVar(&flags.PrefetchPackages, "prefetch-packages", false, "Prefetch any test packages in the background.")
 	flag.BoolVar(&flags.UseSerial, "use-serial", false, "Use serial to run tests on the target.")
+	flag.BoolVar(&flags.AggregateSummary, "aggregate-summary", false, "Aggregate the runs of each test into a single summary.json entry with attempts and a verdict, instead of writing one entry per run.")
+	flag.StringVar(&flags.TriageBundle, "triage-bundle", "", "If set and any test fails, collect crash reports, logs and netstack inspect data from the target into a directory of this name in the output directory, with an index.json describing its contents.")
+	flag.StringVar(&flags.UpdatedGoldens, "updated-goldens", "", "If set, collect the goldens that failed host tests wrote to $FUCHSIA_TEST_OUTDIR/updated_goldens into a directory of this name in the output directory, with a manifest.json listing them, so they can be copied over the source tree in one step.")
+	flag.IntVar(&flags.RecoverAfterFatalFailures, "recover-after-fatal-failures", 0, "Reboot the target after this many consecutive tests hit fatal errors, such as an unresponsive target, and keep running tests. If 0, stop at the first fatal error.")
+	flag.IntVar(&flags.MaxRecoveries, "max-recoveries", 3, "The maximum number of times to reboot the target to recover from fatal errors.")
+	flag.StringVar(&flags.StatusAddr, "status-addr", "", "If set, serve the shard's progress, including the running test and the tail of its output, as JSON over HTTP at /status on this address, e.g. localhost:0.")
+	flag.BoolVar(&flags.HTMLReport, "html-report", false, "Also write a self-contained results.html page summarizing the run to the output directory.")
+	flag.StringVar(&flags.EmulatorConfig, "emulator-config", "", "Optional path to a botanist config describing a single QEMU or AEMU target. If set, testrunner launches the emulator with the images in -images, runs the tests against it and shuts it down afterwards.")
+	flag.StringVar(&flags.ImageManifest, "images", "", "Path to the image manifest to boot the emulator with. Required with -emulator-config.")
+	flag.StringVar(&flags.SSHKey, "ssh", "", "Path to a private SSH key authorized by the emulator's images. If unset, tests are run against the emulator over serial.")
+	flag.StringVar(&flags.ExpectedBuildVersion, "expected-build-version", "", "If set, check that the target is running this build version, as found in /config/build-info/version, before running any tests, and fail if it isn't.")
+	flag.BoolVar(&flags.RetryFailedCases, "retry-failed-cases", false, "When retrying a failed component v2 test, only rerun the test cases that failed, using run-test-suite's --test-filter, if they could be parsed from the test's output.")
+	flag.DurationVar(&flags.SSHKeepaliveInterval, "ssh-keepalive-interval", 0, "The interval between keepalive pings sent over SSH connections to the target. Defaults to 1s.")
+	flag.DurationVar(&flags.SSHKeepaliveTimeout, "ssh-keepalive-timeout", 0, "How long to wait for a reply to an SSH keepalive ping before counting it as missed. Defaults to 12s.")
+	flag.IntVar(&flags.SSHKeepaliveMaxMissed, "ssh-keepalive-max-missed", 0, "The number of consecutive SSH keepalive pings that may go unanswered before the connection to the target is considered dead and reestablished. Defaults to 1.")
+	flag.BoolVar(&flags.SSHMultiplex, "ssh-multiplex", false, "Share a single SSH connection to the target between running tests, copying data sinks, prefetching packages and checking the build version, instead of connecting separately for each.")
+	flag.StringVar(&flags.CollectorsConfig, "collectors-config", "", "Optional path to a JSON config listing host binaries to run after each test, with the test's name, result and output directory, to collect extra diagnostics into the output directory.")
 
 	flag.Usage = usage
 	flag.Parse()
 
-	if flags.Help || flag.NArg() != 1 {
+	if flags.Help || flag.NArg() == 0 {
 		flag.Usage()
 		flag.PrintDefaults()
 		return
@@ -63,7 +83,7 @@ func main() {
 	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
 
-	if err := testrunner.SetupAndExecute(ctx, flags, flag.Arg(0)); err != nil {
+	if err := testrunner.SetupAndExecute(ctx, flags, flag.Args()...); err != nil {
 		logger.Fatalf(ctx, err.Error())
 	}
 }
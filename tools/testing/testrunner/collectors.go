@@ -0,0 +1,200 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder"
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+	"go.fuchsia.dev/fuchsia/tools/lib/subprocess"
+)
+
+const (
+	// The default amount of time a host collector may run for after a test.
+	defaultCollectorTimeout = time.Minute
+
+	// Environment variables describing the test run to host collectors.
+	collectorTestNameEnvKey   = "TESTRUNNER_TEST_NAME"
+	collectorTestResultEnvKey = "TESTRUNNER_TEST_RESULT"
+	collectorTestOutDirEnvKey = "TESTRUNNER_TEST_OUT_DIR"
+)
+
+// ArtifactCollector collects product-specific diagnostics, such as driver logs
+// or kernel counters, after each run of a test.
+type ArtifactCollector interface {
+	// Name identifies the collector in logs.
+	Name() string
+
+	// Collect is called after every run of every test with the test's result
+	// and the run's own output directory, outDir. Any files it adds to outDir
+	// are recorded and uploaded with the run's other outputs. An error is
+	// logged but doesn't affect the test's result.
+	Collect(ctx context.Context, test testsharder.Test, result *TestResult, outDir string) error
+}
+
+var registeredCollectors []ArtifactCollector
+
+// RegisterArtifactCollector adds c to the collectors run after each test. It
+// is meant to be called from the init() function of a file that is only built
+// into testrunner for a given product, e.g. by a build tag.
+func RegisterArtifactCollector(c ArtifactCollector) {
+	registeredCollectors = append(registeredCollectors, c)
+}
+
+// CollectorsConfig lists host binaries to run as artifact collectors.
+type CollectorsConfig struct {
+	Collectors []HostCollector `json:"collectors"`
+}
+
+// HostCollector is an ArtifactCollector that runs a host binary after each
+// test. The binary is passed the test's name, result and output directory as
+// arguments after Command, and in the TESTRUNNER_TEST_NAME,
+// TESTRUNNER_TEST_RESULT and TESTRUNNER_TEST_OUT_DIR environment variables.
+type HostCollector struct {
+	// CollectorName identifies the collector in logs. Defaults to the first
+	// element of Command.
+	CollectorName string `json:"name,omitempty"`
+
+	// Command is the binary to run, followed by any arguments.
+	Command []string `json:"command"`
+
+	// TimeoutSecs is how long the binary may run for. Defaults to a minute.
+	TimeoutSecs int `json:"timeout_secs,omitempty"`
+
+	// OnlyOnFailure limits the collector to runs that didn't pass.
+	OnlyOnFailure bool `json:"only_on_failure,omitempty"`
+}
+
+func (c *HostCollector) Name() string {
+	if c.CollectorName != "" {
+		return c.CollectorName
+	}
+	return c.Command[0]
+}
+
+func (c *HostCollector) Collect(ctx context.Context, test testsharder.Test, result *TestResult, outDir string) error {
+	if c.OnlyOnFailure && result.Passed() {
+		return nil
+	}
+	timeout := defaultCollectorTimeout
+	if c.TimeoutSecs > 0 {
+		timeout = time.Duration(c.TimeoutSecs) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	env := append(os.Environ(),
+		fmt.Sprintf("%s=%s", collectorTestNameEnvKey, test.Name),
+		fmt.Sprintf("%s=%s", collectorTestResultEnvKey, result.Result),
+		fmt.Sprintf("%s=%s", collectorTestOutDirEnvKey, outDir),
+	)
+	cmd := append(append([]string(nil), c.Command...), test.Name, string(result.Result), outDir)
+	return newRunner("", env).Run(ctx, cmd, subprocess.RunOptions{})
+}
+
+func loadCollectorsConfig(path string) (*CollectorsConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", path, err)
+	}
+	var config CollectorsConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %q: %w", path, err)
+	}
+	for i, c := range config.Collectors {
+		if len(c.Command) == 0 {
+			return nil, fmt.Errorf("collector %d in %q has no command", i, path)
+		}
+	}
+	return &config, nil
+}
+
+// artifactCollectors returns the registered collectors followed by those in
+// the config at configPath, if any.
+func artifactCollectors(configPath string) ([]ArtifactCollector, error) {
+	collectors := append([]ArtifactCollector(nil), registeredCollectors...)
+	if configPath == "" {
+		return collectors, nil
+	}
+	config, err := loadCollectorsConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	for i := range config.Collectors {
+		collectors = append(collectors, &config.Collectors[i])
+	}
+	return collectors, nil
+}
+
+// collectArtifacts runs collectors after a run of test, before its result is
+// recorded. The collectors are given the run's output directory, or outDir if
+// the result doesn't have one, and the files they add to it are added to the
+// result's output files so that they're recorded with the run. The collectors
+// run in order, and one failing doesn't stop the others.
+func collectArtifacts(ctx context.Context, collectors []ArtifactCollector, test testsharder.Test, result *TestResult, outDir string) error {
+	if len(collectors) == 0 {
+		return nil
+	}
+	if result.OutputDir == "" {
+		result.OutputDir = outDir
+	}
+	before, err := listFiles(result.OutputDir)
+	if err != nil {
+		return err
+	}
+	for _, c := range collectors {
+		if ctx.Err() != nil {
+			break
+		}
+		logger.Debugf(ctx, "running artifact collector %s for %s", c.Name(), test.Name)
+		if err := c.Collect(ctx, test, result, result.OutputDir); err != nil {
+			logger.Warningf(ctx, "artifact collector %s failed for %s: %s", c.Name(), test.Name, err)
+		}
+	}
+	after, err := listFiles(result.OutputDir)
+	if err != nil {
+		return err
+	}
+	var added []string
+	for f := range after {
+		if !before[f] {
+			added = append(added, f)
+		}
+	}
+	sort.Strings(added)
+	result.OutputFiles = append(result.OutputFiles, added...)
+	return nil
+}
+
+// listFiles returns the paths of the regular files in dir, relative to dir.
+func listFiles(dir string) (map[string]bool, error) {
+	files := make(map[string]bool)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[rel] = true
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to list the outputs in %s: %w", dir, err)
+	}
+	return files, nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder"
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+type fakeCollector struct {
+	name string
+	err  error
+	// files are written to the output dir by each call.
+	files []string
+	calls []string
+}
+
+func (c *fakeCollector) Name() string {
+	return c.name
+}
+
+func (c *fakeCollector) Collect(_ context.Context, test testsharder.Test, result *TestResult, outDir string) error {
+	c.calls = append(c.calls, fmt.Sprintf("%s %s %s", test.Name, result.Result, outDir))
+	for _, f := range c.files {
+		path := filepath.Join(outDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(c.name), 0o600); err != nil {
+			return err
+		}
+	}
+	return c.err
+}
+
+func TestHostCollector(t *testing.T) {
+	test := testsharder.Test{Test: build.Test{Name: "foo_test"}}
+	testCases := []struct {
+		name      string
+		collector HostCollector
+		result    runtests.TestResult
+		wantCmds  [][]string
+	}{
+		{
+			name:      "passed",
+			collector: HostCollector{Command: []string{"collect.sh", "--verbose"}},
+			result:    runtests.TestSuccess,
+			wantCmds:  [][]string{{"collect.sh", "--verbose", "foo_test", "PASS", "out"}},
+		},
+		{
+			name:      "failed",
+			collector: HostCollector{Command: []string{"collect.sh"}, OnlyOnFailure: true},
+			result:    runtests.TestFailure,
+			wantCmds:  [][]string{{"collect.sh", "foo_test", "FAIL", "out"}},
+		},
+		{
+			name:      "skipped after pass",
+			collector: HostCollector{Command: []string{"collect.sh"}, OnlyOnFailure: true},
+			result:    runtests.TestSuccess,
+		},
+	}
+	oldRunner := newRunner
+	defer func() { newRunner = oldRunner }()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			runner := &fakeCmdRunner{}
+			var gotEnv []string
+			newRunner = func(dir string, env []string) cmdRunner {
+				gotEnv = env
+				return runner
+			}
+			result := &TestResult{Name: test.Name, Result: tc.result}
+			if err := tc.collector.Collect(context.Background(), test, result, "out"); err != nil {
+				t.Fatalf("Collect() failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.wantCmds, runner.cmds); diff != "" {
+				t.Errorf("unexpected commands (-want +got):\n%s", diff)
+			}
+			if len(tc.wantCmds) == 0 {
+				return
+			}
+			for _, want := range []string{
+				collectorTestNameEnvKey + "=foo_test",
+				collectorTestResultEnvKey + "=" + string(tc.result),
+				collectorTestOutDirEnvKey + "=out",
+			} {
+				found := false
+				for _, v := range gotEnv {
+					if v == want {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("collector environment is missing %s", want)
+				}
+			}
+		})
+	}
+}
+
+func TestArtifactCollectors(t *testing.T) {
+	registered := &fakeCollector{name: "registered"}
+	oldCollectors := registeredCollectors
+	defer func() { registeredCollectors = oldCollectors }()
+	registeredCollectors = nil
+	RegisterArtifactCollector(registered)
+
+	configPath := filepath.Join(t.TempDir(), "collectors.json")
+	config := `{"collectors": [{"name": "driver_logs", "command": ["driver_logs.sh"]}, {"command": ["counters.sh"], "only_on_failure": true}]}`
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	collectors, err := artifactCollectors(configPath)
+	if err != nil {
+		t.Fatalf("artifactCollectors() failed: %s", err)
+	}
+	var names []string
+	for _, c := range collectors {
+		names = append(names, c.Name())
+	}
+	if diff := cmp.Diff([]string{"registered", "driver_logs", "counters.sh"}, names); diff != "" {
+		t.Errorf("unexpected collectors (-want +got):\n%s", diff)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"collectors": [{"name": "empty"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := artifactCollectors(configPath); err == nil {
+		t.Errorf("artifactCollectors() succeeded with a collector without a command, want error")
+	}
+}
+
+func TestCollectArtifacts(t *testing.T) {
+	failing := &fakeCollector{name: "failing", err: fmt.Errorf("collector failed")}
+	other := &fakeCollector{name: "other", files: []string{"counters.txt", "logs/driver.log"}}
+	collectors := []ArtifactCollector{failing, other}
+	test := testsharder.Test{Test: build.Test{Name: "foo_test"}}
+
+	t.Run("result without output dir", func(t *testing.T) {
+		failing.calls, other.calls = nil, nil
+		outDir := t.TempDir()
+		result := &TestResult{Name: test.Name, Result: runtests.TestAborted}
+		if err := collectArtifacts(context.Background(), collectors, test, result, outDir); err != nil {
+			t.Fatalf("collectArtifacts() failed: %s", err)
+		}
+		want := []string{"foo_test ABORT " + outDir}
+		if diff := cmp.Diff(want, failing.calls); diff != "" {
+			t.Errorf("unexpected calls to the failing collector (-want +got):\n%s", diff)
+		}
+		// A failing collector doesn't stop the ones after it.
+		if diff := cmp.Diff(want, other.calls); diff != "" {
+			t.Errorf("unexpected calls to the other collector (-want +got):\n%s", diff)
+		}
+		if result.OutputDir != outDir {
+			t.Errorf("got output dir %q, want %q", result.OutputDir, outDir)
+		}
+		if diff := cmp.Diff([]string{"counters.txt", filepath.Join("logs", "driver.log")}, result.OutputFiles); diff != "" {
+			t.Errorf("unexpected output files (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("result with output dir", func(t *testing.T) {
+		failing.calls, other.calls = nil, nil
+		testOutDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(testOutDir, "serial.log"), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		result := &TestResult{Name: test.Name, Result: runtests.TestFailure, OutputDir: testOutDir, OutputFiles: []string{"serial.log"}}
+		if err := collectArtifacts(context.Background(), collectors, test, result, t.TempDir()); err != nil {
+			t.Fatalf("collectArtifacts() failed: %s", err)
+		}
+		// The collectors add to the test's own output dir, so that its
+		// outputs aren't mixed up with other tests'.
+		if diff := cmp.Diff([]string{"foo_test FAIL " + testOutDir}, other.calls); diff != "" {
+			t.Errorf("unexpected calls to the other collector (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff([]string{"serial.log", "counters.txt", filepath.Join("logs", "driver.log")}, result.OutputFiles); diff != "" {
+			t.Errorf("unexpected output files (-want +got):\n%s", diff)
+		}
+	})
+}
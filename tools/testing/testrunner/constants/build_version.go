@@ -0,0 +1,10 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package constants
+
+// BuildVersionMismatchMsg is the prefix of the error returned by testrunner
+// when the target is running a different build than the one the tests come
+// from.
+const BuildVersionMismatchMsg = "target is running a different build than the tests"
@@ -0,0 +1,181 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	botanistconstants "go.fuchsia.dev/fuchsia/tools/botanist/constants"
+	"go.fuchsia.dev/fuchsia/tools/botanist/targets"
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+	"go.fuchsia.dev/fuchsia/tools/lib/serial"
+)
+
+const (
+	// How long to wait for a launched emulator to accept commands.
+	emulatorReadyTimeout = 5 * time.Minute
+
+	// How long to wait for a launched emulator to shut down.
+	emulatorStopTimeout = time.Minute
+
+	// The name of the file in the output directory to write the serial log
+	// of a launched emulator to.
+	emulatorSerialLogName = "serial_log.txt"
+)
+
+// for testability
+var (
+	deriveTarget = targets.DeriveTarget
+	startTargets = targets.StartTargets
+	stopTargets  = targets.StopTargets
+)
+
+// emulator is a QEMU or AEMU instance launched by testrunner itself to run
+// tests against, as botanist would in CI.
+type emulator struct {
+	target targets.Target
+	// serialLogDone is closed once the serial log is no longer being
+	// captured.
+	serialLogDone chan struct{}
+}
+
+// startEmulator boots the emulator described by the botanist target config at
+// flags.EmulatorConfig with the images listed in flags.ImageManifest, and
+// waits until it accepts commands over SSH, or over serial if flags.UseSerial
+// is set or no SSH key was given.
+//
+// The emulator's nodename, address, SSH key and serial socket are then
+// exported to the environment as botanist exports them to testrunner, so that
+// the rest of the run, including host tests that talk to the target, finds
+// the emulator as it would find a CI target.
+func startEmulator(ctx context.Context, flags TestrunnerFlags, outDir string) (*emulator, error) {
+	if flags.ImageManifest == "" {
+		return nil, fmt.Errorf("an image manifest is required to launch an emulator")
+	}
+	data, err := os.ReadFile(flags.EmulatorConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read emulator config: %w", err)
+	}
+	// The config has the same format as botanist's, so that a shard's
+	// config can be reused as is.
+	var objs []json.RawMessage
+	if err := json.Unmarshal(data, &objs); err != nil {
+		return nil, fmt.Errorf("could not unmarshal emulator config as a JSON list: %w", err)
+	}
+	if len(objs) != 1 {
+		return nil, fmt.Errorf("emulator config must describe exactly one target, found %d", len(objs))
+	}
+	var typed struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(objs[0], &typed); err != nil {
+		return nil, fmt.Errorf("invalid emulator config: %w", err)
+	}
+	if typed.Type != "qemu" && typed.Type != "aemu" {
+		return nil, fmt.Errorf("emulator config has unsupported type %q, want \"qemu\" or \"aemu\"", typed.Type)
+	}
+
+	sshKey := flags.SSHKey
+	if sshKey != "" {
+		// Some tools like ffx require the SSH key path to be absolute
+		// (https://fxbug.dev/101081).
+		if sshKey, err = filepath.Abs(sshKey); err != nil {
+			return nil, err
+		}
+	}
+	t, err := deriveTarget(ctx, objs[0], targets.Options{SSHKey: sshKey})
+	if err != nil {
+		return nil, err
+	}
+	if err := t.StartSerialServer(); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	e := &emulator{
+		target:        t,
+		serialLogDone: make(chan struct{}),
+	}
+	if t.SerialSocketPath() != "" {
+		go func() {
+			defer close(e.serialLogDone)
+			serialLogPath := filepath.Join(outDir, emulatorSerialLogName)
+			if err := t.CaptureSerialLog(serialLogPath); err != nil {
+				logger.Warningf(ctx, "failed to capture emulator serial log: %s", err)
+			}
+		}()
+	} else {
+		close(e.serialLogDone)
+	}
+
+	logger.Infof(ctx, "launching %s emulator %s", typed.Type, t.Nodename())
+	if err := startTargets(ctx, targets.StartOptions{ImageManifest: flags.ImageManifest}, []targets.Target{t}); err != nil {
+		e.stop(ctx)
+		return nil, fmt.Errorf("failed to start emulator: %w", err)
+	}
+
+	env := map[string]string{
+		botanistconstants.NodenameEnvKey:     t.Nodename(),
+		botanistconstants.SerialSocketEnvKey: t.SerialSocketPath(),
+	}
+	if err := func() error {
+		readyCtx, cancel := context.WithTimeout(ctx, emulatorReadyTimeout)
+		defer cancel()
+		if flags.UseSerial || sshKey == "" {
+			socket, err := serial.NewSocket(readyCtx, t.SerialSocketPath())
+			if err != nil {
+				return err
+			}
+			defer socket.Close()
+			return waitForSerialShell(readyCtx, socket)
+		}
+		client, err := t.SSHClient()
+		if err != nil {
+			return err
+		}
+		client.Close()
+		addr, err := t.IPv6()
+		if err != nil {
+			return err
+		}
+		env[botanistconstants.SSHKeyEnvKey] = sshKey
+		env[botanistconstants.DeviceAddrEnvKey] = addr.String()
+		env[botanistconstants.IPv6AddrEnvKey] = addr.String()
+		return nil
+	}(); err != nil {
+		e.stop(ctx)
+		return nil, fmt.Errorf("emulator did not become ready: %w", err)
+	}
+	logger.Infof(ctx, "emulator %s is ready", t.Nodename())
+
+	for k, v := range env {
+		if err := os.Setenv(k, v); err != nil {
+			e.stop(ctx)
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// stop shuts the emulator down and waits for its serial log to be written.
+func (e *emulator) stop(ctx context.Context) {
+	// The run's context may already be canceled, e.g. on SIGINT, but the
+	// emulator must still be shut down.
+	stopCtx, cancel := context.WithTimeout(context.Background(), emulatorStopTimeout)
+	defer cancel()
+	stopTargets(stopCtx, []targets.Target{e.target})
+	select {
+	case <-e.serialLogDone:
+	case <-stopCtx.Done():
+		logger.Warningf(ctx, "timed out waiting for the emulator serial log to be written")
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	botanistconstants "go.fuchsia.dev/fuchsia/tools/botanist/constants"
+	"go.fuchsia.dev/fuchsia/tools/botanist/targets"
+	"go.fuchsia.dev/fuchsia/tools/net/sshutil"
+)
+
+// fakeEmulatorTarget is a target whose SSH server is reachable as soon as it
+// is started. Methods that startEmulator doesn't call panic.
+type fakeEmulatorTarget struct {
+	targets.Target
+	sshErr error
+}
+
+func (t *fakeEmulatorTarget) Nodename() string {
+	return "fake-emulator"
+}
+
+func (t *fakeEmulatorTarget) StartSerialServer() error {
+	return nil
+}
+
+func (t *fakeEmulatorTarget) SerialSocketPath() string {
+	return ""
+}
+
+func (t *fakeEmulatorTarget) SSHClient() (*sshutil.Client, error) {
+	if t.sshErr != nil {
+		return nil, t.sshErr
+	}
+	return &sshutil.Client{}, nil
+}
+
+func (t *fakeEmulatorTarget) IPv6() (*net.IPAddr, error) {
+	return &net.IPAddr{IP: net.ParseIP("fe80::1"), Zone: "qemu"}, nil
+}
+
+func TestStartEmulator(t *testing.T) {
+	ctx := context.Background()
+	startErr := errors.New("failed to boot")
+	sshErr := errors.New("connection refused")
+
+	for _, tc := range []struct {
+		name          string
+		config        string
+		noManifest    bool
+		startErr      error
+		sshErr        error
+		wantErr       string
+		wantStopped   bool
+		wantNoTargets bool
+	}{
+		{
+			name:   "qemu over ssh",
+			config: `[{"type": "qemu"}]`,
+		},
+		{
+			name:   "aemu over ssh",
+			config: `[{"type": "aemu"}]`,
+		},
+		{
+			name:          "no image manifest",
+			config:        `[{"type": "qemu"}]`,
+			noManifest:    true,
+			wantErr:       "an image manifest is required",
+			wantNoTargets: true,
+		},
+		{
+			name:          "config is not a list",
+			config:        `{"type": "qemu"}`,
+			wantErr:       "could not unmarshal emulator config",
+			wantNoTargets: true,
+		},
+		{
+			name:          "more than one target",
+			config:        `[{"type": "qemu"}, {"type": "qemu"}]`,
+			wantErr:       "exactly one target, found 2",
+			wantNoTargets: true,
+		},
+		{
+			name:          "unsupported type",
+			config:        `[{"type": "nuc"}]`,
+			wantErr:       `unsupported type "nuc"`,
+			wantNoTargets: true,
+		},
+		{
+			name:        "failed to start",
+			config:      `[{"type": "qemu"}]`,
+			startErr:    startErr,
+			wantErr:     startErr.Error(),
+			wantStopped: true,
+		},
+		{
+			name:        "not ready",
+			config:      `[{"type": "qemu"}]`,
+			sshErr:      sshErr,
+			wantErr:     sshErr.Error(),
+			wantStopped: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Restore the environment startEmulator exports to once the test
+			// is done.
+			for _, k := range []string{
+				botanistconstants.NodenameEnvKey,
+				botanistconstants.SerialSocketEnvKey,
+				botanistconstants.SSHKeyEnvKey,
+				botanistconstants.DeviceAddrEnvKey,
+				botanistconstants.IPv6AddrEnvKey,
+			} {
+				t.Setenv(k, "")
+			}
+
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "emulator.json")
+			if err := os.WriteFile(configPath, []byte(tc.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			flags := TestrunnerFlags{
+				EmulatorConfig: configPath,
+				ImageManifest:  filepath.Join(tmpDir, "images.json"),
+				SSHKey:         filepath.Join(tmpDir, "id_ed25519"),
+			}
+			if tc.noManifest {
+				flags.ImageManifest = ""
+			}
+
+			target := &fakeEmulatorTarget{sshErr: tc.sshErr}
+			var derived, started, stopped []targets.Target
+			var gotManifest string
+			oldDeriveTarget, oldStartTargets, oldStopTargets := deriveTarget, startTargets, stopTargets
+			defer func() {
+				deriveTarget, startTargets, stopTargets = oldDeriveTarget, oldStartTargets, oldStopTargets
+			}()
+			deriveTarget = func(_ context.Context, _ []byte, opts targets.Options) (targets.Target, error) {
+				if opts.SSHKey != flags.SSHKey {
+					t.Errorf("derived target with SSH key %q, want %q", opts.SSHKey, flags.SSHKey)
+				}
+				derived = append(derived, target)
+				return target, nil
+			}
+			startTargets = func(_ context.Context, opts targets.StartOptions, ts []targets.Target) error {
+				gotManifest = opts.ImageManifest
+				started = append(started, ts...)
+				return tc.startErr
+			}
+			stopTargets = func(_ context.Context, ts []targets.Target) {
+				stopped = append(stopped, ts...)
+			}
+
+			e, err := startEmulator(ctx, flags, filepath.Join(tmpDir, "out"))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("startEmulator() got error: %v, want error containing %q", err, tc.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("startEmulator() failed: %s", err)
+			}
+
+			if tc.wantNoTargets {
+				if len(derived) != 0 {
+					t.Errorf("derived %d targets from an invalid config", len(derived))
+				}
+				return
+			}
+			if len(started) != 1 || started[0] != target {
+				t.Errorf("started targets %v, want the derived target", started)
+			}
+			if gotManifest != flags.ImageManifest {
+				t.Errorf("started with image manifest %q, want %q", gotManifest, flags.ImageManifest)
+			}
+			if tc.wantStopped {
+				if len(stopped) != 1 || stopped[0] != target {
+					t.Errorf("stopped targets %v, want the derived target", stopped)
+				}
+				return
+			}
+			if len(stopped) != 0 {
+				t.Errorf("stopped a running emulator")
+			}
+
+			for k, want := range map[string]string{
+				botanistconstants.NodenameEnvKey:   "fake-emulator",
+				botanistconstants.SSHKeyEnvKey:     flags.SSHKey,
+				botanistconstants.DeviceAddrEnvKey: "fe80::1%qemu",
+				botanistconstants.IPv6AddrEnvKey:   "fe80::1%qemu",
+			} {
+				if got := os.Getenv(k); got != want {
+					t.Errorf("got %s=%q, want %q", k, got, want)
+				}
+			}
+
+			e.stop(ctx)
+			if len(stopped) != 1 || stopped[0] != target {
+				t.Errorf("stop() stopped targets %v, want the derived target", stopped)
+			}
+		})
+	}
+}
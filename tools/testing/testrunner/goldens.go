@@ -0,0 +1,186 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder"
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+	"go.fuchsia.dev/fuchsia/tools/lib/osmisc"
+)
+
+const (
+	// UpdatedGoldensDirName is the directory within $FUCHSIA_TEST_OUTDIR
+	// where a host test that failed because its goldens are out of date
+	// writes the goldens it expected, at their paths relative to the root of
+	// the source tree.
+	UpdatedGoldensDirName = "updated_goldens"
+
+	// GoldensManifestFilename is the name of the manifest written to the
+	// root of the directory that updated goldens are collected into.
+	GoldensManifestFilename = "manifest.json"
+
+	// goldensFilesDirName is the directory within the collection directory
+	// that holds the updated goldens, laid out like the source tree.
+	goldensFilesDirName = "files"
+)
+
+// UpdatedGolden describes a golden file updated by a failed host test.
+type UpdatedGolden struct {
+	// Path is the path of the golden relative to the root of the source tree.
+	Path string `json:"path"`
+	// File is the path of the updated golden relative to the collection
+	// directory.
+	File string `json:"file"`
+	// Test is the name of the test that updated the golden.
+	Test string `json:"test"`
+	// RunIndex is the run of the test that updated the golden.
+	RunIndex int `json:"run_index"`
+}
+
+// GoldensManifest is the contents of the manifest of the updated goldens.
+type GoldensManifest struct {
+	// Goldens are the updated goldens, sorted by path.
+	Goldens []UpdatedGolden `json:"goldens"`
+}
+
+// goldenCollector is an ArtifactCollector that collects the updated goldens
+// of failed host tests into dir, so that they can all be copied over the
+// source tree at once.
+type goldenCollector struct {
+	dir string
+
+	mu      sync.Mutex
+	goldens map[string]UpdatedGolden
+}
+
+func newGoldenCollector(dir string) *goldenCollector {
+	return &goldenCollector{dir: dir, goldens: make(map[string]UpdatedGolden)}
+}
+
+func (c *goldenCollector) Name() string {
+	return "updated goldens"
+}
+
+func (c *goldenCollector) Collect(ctx context.Context, test testsharder.Test, result *TestResult, outDir string) error {
+	if test.OS == "fuchsia" {
+		return nil
+	}
+	if result.Passed() {
+		// The goldens of earlier failed runs of a flaky test that has now
+		// passed must not overwrite the checked-in ones.
+		return c.drop(test.Name)
+	}
+	srcDir := filepath.Join(outDir, UpdatedGoldensDirName)
+	if _, err := os.Stat(srcDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			if !d.IsDir() {
+				logger.Warningf(ctx, "ignoring updated golden %s of %s, which isn't a regular file", path, test.Name)
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		golden := UpdatedGolden{
+			Path:     filepath.ToSlash(rel),
+			File:     filepath.ToSlash(filepath.Join(goldensFilesDirName, rel)),
+			Test:     test.Name,
+			RunIndex: result.RunIndex,
+		}
+		if prev, ok := c.goldens[golden.Path]; ok && prev.Test != golden.Test {
+			logger.Warningf(ctx, "golden %s was updated by both %s and %s, keeping the latter", golden.Path, prev.Test, golden.Test)
+		}
+		if err := copyGolden(path, filepath.Join(c.dir, golden.File)); err != nil {
+			return err
+		}
+		c.goldens[golden.Path] = golden
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to collect updated goldens: %w", err)
+	}
+	// The manifest is rewritten after each test so that it is complete even
+	// if the run is interrupted.
+	return c.writeManifest()
+}
+
+// drop forgets the goldens updated by the named test.
+func (c *goldenCollector) drop(testName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dropped := false
+	for path, golden := range c.goldens {
+		if golden.Test != testName {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, golden.File)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove updated golden: %w", err)
+		}
+		delete(c.goldens, path)
+		dropped = true
+	}
+	if !dropped {
+		return nil
+	}
+	return c.writeManifest()
+}
+
+func (c *goldenCollector) writeManifest() error {
+	manifest := GoldensManifest{Goldens: make([]UpdatedGolden, 0, len(c.goldens))}
+	for _, golden := range c.goldens {
+		manifest.Goldens = append(manifest.Goldens, golden)
+	}
+	sort.Slice(manifest.Goldens, func(i, j int) bool {
+		return manifest.Goldens[i].Path < manifest.Goldens[j].Path
+	})
+	f, err := osmisc.CreateFile(filepath.Join(c.dir, GoldensManifestFilename))
+	if err != nil {
+		return fmt.Errorf("failed to create goldens manifest: %w", err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return fmt.Errorf("failed to write goldens manifest: %w", err)
+	}
+	return nil
+}
+
+func copyGolden(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := osmisc.CreateFile(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,105 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/tools/build"
+	"go.fuchsia.dev/fuchsia/tools/integration/testsharder"
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+func writeUpdatedGoldens(t *testing.T, outDir string, goldens map[string]string) {
+	t.Helper()
+	for path, contents := range goldens {
+		path = filepath.Join(outDir, UpdatedGoldensDirName, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGoldenCollector(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c := newGoldenCollector(dir)
+
+	collect := func(test testsharder.Test, result runtests.TestResult, runIndex int, goldens map[string]string) {
+		t.Helper()
+		outDir := t.TempDir()
+		writeUpdatedGoldens(t, outDir, goldens)
+		if err := c.Collect(ctx, test, &TestResult{Name: test.Name, Result: result, RunIndex: runIndex}, outDir); err != nil {
+			t.Fatalf("Collect() failed: %s", err)
+		}
+	}
+	hostTest := func(name string) testsharder.Test {
+		return testsharder.Test{Test: build.Test{Name: name, OS: "linux"}}
+	}
+
+	collect(hostTest("foo_test"), runtests.TestFailure, 0, map[string]string{
+		"src/foo/goldens/a.golden": "old a",
+		"src/foo/goldens/b.golden": "b",
+	})
+	collect(hostTest("foo_test"), runtests.TestFailure, 1, map[string]string{
+		"src/foo/goldens/a.golden": "new a",
+	})
+	collect(hostTest("bar_test"), runtests.TestSuccess, 0, map[string]string{
+		"src/bar/passed.golden": "passed",
+	})
+	collect(testsharder.Test{Test: build.Test{Name: "baz_test", OS: "fuchsia"}}, runtests.TestFailure, 0, map[string]string{
+		"src/baz/target.golden": "target",
+	})
+	collect(hostTest("qux_test"), runtests.TestFailure, 0, nil)
+	// The goldens of a flaky test are dropped once it passes.
+	collect(hostTest("flaky_test"), runtests.TestFailure, 0, map[string]string{
+		"src/flaky/flaky.golden": "flaky",
+	})
+	collect(hostTest("flaky_test"), runtests.TestSuccess, 1, nil)
+
+	b, err := os.ReadFile(filepath.Join(dir, GoldensManifestFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest GoldensManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	want := GoldensManifest{Goldens: []UpdatedGolden{
+		{Path: "src/foo/goldens/a.golden", File: "files/src/foo/goldens/a.golden", Test: "foo_test", RunIndex: 1},
+		{Path: "src/foo/goldens/b.golden", File: "files/src/foo/goldens/b.golden", Test: "foo_test", RunIndex: 0},
+	}}
+	if diff := cmp.Diff(want, manifest); diff != "" {
+		t.Errorf("unexpected manifest (-want +got):\n%s", diff)
+	}
+
+	wantContents := map[string]string{
+		"src/foo/goldens/a.golden": "new a",
+		"src/foo/goldens/b.golden": "b",
+	}
+	for path, contents := range wantContents {
+		got, err := os.ReadFile(filepath.Join(dir, goldensFilesDirName, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != contents {
+			t.Errorf("got %s contents %q, want %q", path, got, contents)
+		}
+	}
+	for _, path := range []string{"src/bar/passed.golden", "src/baz/target.golden", "src/flaky/flaky.golden"} {
+		if _, err := os.Stat(filepath.Join(dir, goldensFilesDirName, path)); !os.IsNotExist(err) {
+			t.Errorf("%s shouldn't have been collected", path)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+// HTMLReportFilename is the name of the HTML results page written to the
+// output directory when TestOutputs.HTMLReport is set.
+const HTMLReportFilename = "results.html"
+
+// htmlReport is the data rendered by htmlReportTemplate.
+type htmlReport struct {
+	Tests  []runtests.TestDetails
+	Counts []resultCount
+}
+
+type resultCount struct {
+	Result runtests.TestResult
+	Count  int
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"millis": func(ms int64) time.Duration { return time.Duration(ms) * time.Millisecond },
+	"failed": func(r runtests.TestResult) bool {
+		return r == runtests.TestFailure || r == runtests.TestAborted
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Test results</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+.PASS { color: #188038; }
+.FAIL, .ABORT { color: #d93025; font-weight: bold; }
+.SKIP { color: #80868b; }
+.cases { margin: 4px 0 4px 1em; font-size: 90%; }
+</style>
+</head>
+<body>
+<h1>Test results</h1>
+<p>{{range $i, $c := .Counts}}{{if $i}}, {{end}}<span class="{{$c.Result}}">{{$c.Count}} {{$c.Result}}</span>{{end}}</p>
+<table>
+<tr><th>Test</th><th>Result</th><th>Duration</th><th>Outputs</th></tr>
+{{range .Tests}}<tr>
+<td>{{.Name}}{{if .GNLabel}}<br><small>{{.GNLabel}}</small>{{end}}
+{{if .Cases}}<details class="cases"{{if failed .Result}} open{{end}}><summary>{{len .Cases}} cases</summary>
+<table>
+{{range .Cases}}<tr><td>{{.DisplayName}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{.Duration}}</td><td>{{.FailReason}}{{range .OutputFiles}} <a href="{{.}}">{{.}}</a>{{end}}</td></tr>
+{{end}}</table>
+</details>{{end}}
+{{if .Attempts}}<details class="cases"><summary>{{len .Attempts}} attempts{{if .Flaky}} (flaky){{end}}</summary>
+<table>
+{{range $i, $a := .Attempts}}<tr><td>attempt {{$i}}</td><td class="{{$a.Result}}">{{$a.Result}}</td><td>{{millis $a.DurationMillis}}</td><td>{{range $a.OutputFiles}}<a href="{{.}}">{{.}}</a> {{end}}</td></tr>
+{{end}}</table>
+</details>{{end}}
+</td>
+<td class="{{.Result}}">{{.Result}}{{if .Flaky}} (flaky){{end}}</td>
+<td>{{millis .DurationMillis}}</td>
+<td>{{range .OutputFiles}}<a href="{{.}}">{{.}}</a><br>{{end}}{{range $name, $sinks := .DataSinks}}{{range $sinks}}<a href="{{.File}}">{{$name}}: {{.Name}}</a><br>{{end}}{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// writeHTMLReport renders a self-contained results page for summary. Links to
+// output files and data sinks are relative to the directory the summary's
+// paths are relative to, where the page should be written.
+func writeHTMLReport(w io.Writer, summary runtests.TestSummary) error {
+	counts := make(map[runtests.TestResult]int)
+	for _, test := range summary.Tests {
+		counts[test.Result]++
+	}
+	report := htmlReport{Tests: summary.Tests}
+	for result, count := range counts {
+		report.Counts = append(report.Counts, resultCount{Result: result, Count: count})
+	}
+	sort.Slice(report.Counts, func(i, j int) bool {
+		return report.Counts[i].Result < report.Counts[j].Result
+	})
+	if err := htmlReportTemplate.Execute(w, report); err != nil {
+		return fmt.Errorf("failed to render the HTML report: %w", err)
+	}
+	return nil
+}
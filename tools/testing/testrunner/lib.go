@@ -16,6 +16,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -30,6 +31,7 @@ import (
 	"go.fuchsia.dev/fuchsia/tools/lib/logger"
 	"go.fuchsia.dev/fuchsia/tools/lib/osmisc"
 	"go.fuchsia.dev/fuchsia/tools/lib/streams"
+	"go.fuchsia.dev/fuchsia/tools/net/sshutil"
 	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
 	"go.fuchsia.dev/fuchsia/tools/testing/tap"
 	"go.fuchsia.dev/fuchsia/tools/testing/testparser"
@@ -81,18 +83,86 @@ type TestrunnerFlags struct {
 
 	// Whether to use serial to run tests on the target.
 	UseSerial bool
+
+	// Whether to aggregate the runs of each test into a single summary entry
+	// instead of writing one entry per run.
+	AggregateSummary bool
+
+	// Whether to write an HTML results page to the output directory.
+	HTMLReport bool
+
+	// The name of a directory in the outDir to collect crash reports, logs
+	// and inspect data from the target into if any test fails.
+	TriageBundle string
+
+	// The name of a directory in the outDir to collect the updated goldens of
+	// failed host tests into.
+	UpdatedGoldens string
+
+	// The number of consecutive tests that must hit a fatal error before the
+	// target is rebooted so the remaining tests can run. If zero, the run is
+	// stopped at the first fatal error instead.
+	RecoverAfterFatalFailures int
+
+	// The maximum number of times the target may be rebooted to recover from
+	// fatal errors during a run.
+	MaxRecoveries int
+
+	// The address to serve the shard's status on, if any.
+	StatusAddr string
+
+	// The path to a botanist config describing a QEMU or AEMU target. If set,
+	// testrunner launches the emulator itself and runs the tests against it.
+	EmulatorConfig string
+
+	// The path to the image manifest to boot the emulator with.
+	ImageManifest string
+
+	// The path to a private SSH key authorized by the emulator's images.
+	SSHKey string
+
+	// The build version the target is expected to run. If set, testrunner
+	// checks it over SSH before running any tests.
+	ExpectedBuildVersion string
+
+	// Whether to retry only the failed cases of component v2 tests, rather
+	// than the whole test, when the failed cases are known.
+	RetryFailedCases bool
+
+	// The path to a JSON CollectorsConfig listing host binaries to run after
+	// each test to collect extra diagnostics.
+	CollectorsConfig string
+
+	// The interval between SSH keepalive pings to the target, how long to
+	// wait for a reply to each, and how many may go unanswered in a row
+	// before the connection is considered dead. Defaults are used if unset.
+	SSHKeepaliveInterval  time.Duration
+	SSHKeepaliveTimeout   time.Duration
+	SSHKeepaliveMaxMissed int
+
+	// Whether to share a single SSH connection to the target between running
+	// tests, copying data sinks and the other commands run on the target.
+	SSHMultiplex bool
 }
 
-func SetupAndExecute(ctx context.Context, flags TestrunnerFlags, testsPath string) error {
+// SetupAndExecute runs the tests of each of the shards in testsPaths, in
+// order. A path may be a tests file or a directory, whose JSON files are run
+// in lexical order. The shards share the connections to the target, the
+// outputs and the final snapshot and data sink collection.
+func SetupAndExecute(ctx context.Context, flags TestrunnerFlags, testsPaths ...string) error {
 	// Our mDNS library doesn't use the logger library.
 	// This flags are repeated in the main function, we can remove this once we
 	// don't call testrunner on its own.
 	const logFlags = log.Ltime | log.Lmicroseconds | log.Lshortfile
 	log.SetFlags(logFlags)
 
-	tests, err := loadTests(testsPath)
+	shards, err := loadShards(testsPaths)
 	if err != nil {
-		return fmt.Errorf("failed to load tests from %q: %w", testsPath, err)
+		return err
+	}
+	numTests := 0
+	for _, shard := range shards {
+		numTests += len(shard.tests)
 	}
 
 	// Configure a test outputs object, responsible for producing TAP output,
@@ -107,6 +177,14 @@ func SetupAndExecute(ctx context.Context, flags TestrunnerFlags, testsPath strin
 	}
 	logger.Debugf(ctx, "test output directory: %s", testOutDir)
 
+	if flags.EmulatorConfig != "" {
+		emu, err := startEmulator(ctx, flags, testOutDir)
+		if err != nil {
+			return err
+		}
+		defer emu.stop(ctx)
+	}
+
 	var addr net.IPAddr
 	if deviceAddr, ok := os.LookupEnv(botanistconstants.DeviceAddrEnvKey); ok {
 		addrPtr, err := net.ResolveIPAddr("ip", deviceAddr)
@@ -117,6 +195,21 @@ func SetupAndExecute(ctx context.Context, flags TestrunnerFlags, testsPath strin
 	}
 	sshKeyFile := os.Getenv(botanistconstants.SSHKeyEnvKey)
 	serialSocketPath := os.Getenv(botanistconstants.SerialSocketEnvKey)
+
+	connector := newSSHConnector(sshutil.KeepaliveConfig{
+		Interval:  flags.SSHKeepaliveInterval,
+		Timeout:   flags.SSHKeepaliveTimeout,
+		MaxMissed: flags.SSHKeepaliveMaxMissed,
+	}, flags.SSHMultiplex)
+	defer connector.close()
+
+	if flags.ExpectedBuildVersion != "" {
+		if flags.UseSerial || sshKeyFile == "" {
+			logger.Warningf(ctx, "cannot check the target's build version without SSH, skipping the check")
+		} else if err := checkBuildVersion(ctx, connector, flags.ExpectedBuildVersion, addr, sshKeyFile); err != nil {
+			return err
+		}
+	}
 	// If the TestOutDirEnvKey was set, that means testrunner is being run
 	// in an infra setting and thus needs an isolated environment.
 	_, needsIsolatedEnv := os.LookupEnv(constants.TestOutDirEnvKey)
@@ -135,13 +228,40 @@ func SetupAndExecute(ctx context.Context, flags TestrunnerFlags, testsPath strin
 	defer cleanUp()
 
 	tapProducer := tap.NewProducer(os.Stdout)
-	tapProducer.Plan(len(tests))
+	tapProducer.Plan(numTests)
 	outputs, err := CreateTestOutputs(tapProducer, testOutDir)
 	if err != nil {
 		return fmt.Errorf("failed to create test outputs: %w", err)
 	}
+	outputs.AggregateRuns = flags.AggregateSummary
+	outputs.HTMLReport = flags.HTMLReport
+
+	var status *shardStatus
+	if flags.StatusAddr != "" {
+		status = newShardStatus(ctx, numTests)
+		statusCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		statusAddr, err := serveShardStatus(statusCtx, flags.StatusAddr, status)
+		if err != nil {
+			return fmt.Errorf("failed to start status server: %w", err)
+		}
+		logger.Infof(ctx, "serving shard status at http://%s/status", statusAddr)
+	}
+
+	collectors, err := artifactCollectors(flags.CollectorsConfig)
+	if err != nil {
+		return err
+	}
+	if flags.UpdatedGoldens != "" {
+		collectors = append(collectors, newGoldenCollector(filepath.Join(testOutDir, flags.UpdatedGoldens)))
+	}
 
-	execErr := execute(ctx, tests, outputs, addr, sshKeyFile, serialSocketPath, testOutDir, flags)
+	execErr := execute(ctx, shards, outputs, connector, addr, sshKeyFile, serialSocketPath, testOutDir, flags, collectors, status)
+	if execErr != nil {
+		// The error that stopped the run explains its failure better than the
+		// results of the tests that ran before it.
+		outputs.Summary.Classification = errorClass(execErr)
+	}
 	if err := outputs.Close(); err != nil {
 		if execErr == nil {
 			return err
@@ -153,7 +273,7 @@ func SetupAndExecute(ctx context.Context, flags TestrunnerFlags, testsPath strin
 
 // for testability
 var (
-	sshTester    = NewFuchsiaSSHTester
+	sshTester    = newFuchsiaSSHTester
 	serialTester = NewFuchsiaSerialTester
 )
 
@@ -217,13 +337,16 @@ var ffxInstance = func(
 
 func execute(
 	ctx context.Context,
-	tests []testsharder.Test,
+	shards []testShard,
 	outputs *TestOutputs,
+	connector *sshConnector,
 	addr net.IPAddr,
 	sshKeyFile,
 	serialSocketPath,
 	outDir string,
 	flags TestrunnerFlags,
+	collectors []ArtifactCollector,
+	status *shardStatus,
 ) error {
 	var fuchsiaSinks, localSinks []runtests.DataSinkReference
 	var fuchsiaTester, localTester Tester
@@ -243,7 +366,11 @@ func execute(
 			go func() {
 				defer wg.Done()
 				resolveLog := filepath.Join(outDir, "resolve.log")
-				if err := ResolveTestPackages(resolveCtx, tests, addr, sshKeyFile, resolveLog); err != nil {
+				var tests []testsharder.Test
+				for _, shard := range shards {
+					tests = append(tests, shard.tests...)
+				}
+				if err := resolveTestPackages(resolveCtx, connector, tests, addr, sshKeyFile, resolveLog); err != nil {
 					logger.Warningf(ctx, "package pre-fetching routine failed: %s", err)
 				}
 			}()
@@ -265,14 +392,14 @@ func execute(
 			ctx, ffxPath, ffxExperimentLevel, flags.LocalWD, localEnv, addr, os.Getenv(botanistconstants.NodenameEnvKey),
 			sshKeyFile, outputs.OutDir)
 		if err != nil {
-			return err
+			return classifyError(runtests.FailureClassConnection, err)
 		}
 		if ffx != nil {
 			defer ffx.Stop()
 			t, err := sshTester(
-				ctx, addr, sshKeyFile, outputs.OutDir, serialSocketPath, flags.UseRuntests)
+				ctx, connector, addr, sshKeyFile, outputs.OutDir, serialSocketPath, flags.UseRuntests)
 			if err != nil {
-				return fmt.Errorf("failed to initialize fuchsia tester: %w", err)
+				return classifyError(runtests.FailureClassConnection, fmt.Errorf("failed to initialize fuchsia tester: %w", err))
 			}
 			ffxTester := NewFFXTester(ffx, t, outputs.OutDir, ffxExperimentLevel)
 			defer func() {
@@ -304,7 +431,7 @@ func execute(
 				var err error
 				if !flags.UseSerial && sshKeyFile != "" {
 					fuchsiaTester, err = sshTester(
-						ctx, addr, sshKeyFile, outputs.OutDir, serialSocketPath, flags.UseRuntests)
+						ctx, connector, addr, sshKeyFile, outputs.OutDir, serialSocketPath, flags.UseRuntests)
 				} else {
 					if serialSocketPath == "" {
 						return nil, nil, fmt.Errorf("%q must be set if %q is not set", botanistconstants.SerialSocketEnvKey, botanistconstants.SSHKeyEnvKey)
@@ -312,7 +439,7 @@ func execute(
 					fuchsiaTester, err = serialTester(ctx, serialSocketPath)
 				}
 				if err != nil {
-					return nil, nil, fmt.Errorf("failed to initialize fuchsia tester: %w", err)
+					return nil, nil, classifyError(runtests.FailureClassConnection, fmt.Errorf("failed to initialize fuchsia tester: %w", err))
 				}
 			}
 			return fuchsiaTester, &fuchsiaSinks, nil
@@ -328,7 +455,7 @@ func execute(
 			if !flags.UseSerial && fuchsiaTester == nil && sshKeyFile != "" {
 				var err error
 				fuchsiaTester, err = sshTester(
-					ctx, addr, sshKeyFile, outputs.OutDir, serialSocketPath, flags.UseRuntests)
+					ctx, connector, addr, sshKeyFile, outputs.OutDir, serialSocketPath, flags.UseRuntests)
 				if err != nil {
 					logger.Errorf(ctx, "failed to initialize fuchsia tester: %s", err)
 				}
@@ -347,8 +474,39 @@ func execute(
 	}
 
 	var finalError error
-	if err := runAndOutputTests(ctx, tests, testerForTest, outputs, outDir); err != nil {
-		finalError = err
+	opts := runOptions{
+		// The recovery budget is shared by all shards of the run.
+		recovery: &recoveryPolicy{
+			afterFatalFailures: flags.RecoverAfterFatalFailures,
+			maxRecoveries:      flags.MaxRecoveries,
+		},
+		retryFailedCases: flags.RetryFailedCases,
+		collectors:       collectors,
+		status:           status,
+		ffxRuns:          new(int),
+	}
+	for i, shard := range shards {
+		if len(shards) > 1 {
+			logger.Infof(ctx, "running shard %s (%d of %d) with %d tests", shard.name, i+1, len(shards), len(shard.tests))
+		}
+		shardOpts := opts
+		var err error
+		if shard.benchmark != nil {
+			shardOpts.bench = newBenchmarkEnv(*shard.benchmark, flags.LocalWD, localEnv)
+			err = shardOpts.bench.setup(ctx)
+		}
+		if err == nil {
+			err = runAndOutputTests(ctx, shard.tests, testerForTest, outputs, outDir, shardOpts)
+		}
+		if err != nil {
+			// The remaining shards would likely hit the same error, e.g. if
+			// the target is unresponsive, so don't run them.
+			if len(shards) > 1 {
+				err = fmt.Errorf("shard %s: %w", shard.name, err)
+			}
+			finalError = err
+			break
+		}
 	}
 
 	if fuchsiaTester != nil {
@@ -374,6 +532,11 @@ func execute(
 				// return this error. Log it so we can keep track of it, but don't fail.
 				logger.Errorf(snapshotCtx, err.Error())
 			}
+			if c, ok := t.(triageCollector); ok && flags.TriageBundle != "" && len(failedTests(outputs.Summary)) > 0 {
+				if err := collectTriageBundle(snapshotCtx, c, outputs, flags.TriageBundle, flags.SnapshotFile); err != nil {
+					logger.Errorf(snapshotCtx, "failed to collect triage bundle: %s", err)
+				}
+			}
 			if ctx.Err() != nil {
 				// If the original context was cancelled, just return the context error.
 				return ctx.Err()
@@ -424,24 +587,91 @@ func validateTest(test testsharder.Test) error {
 	return nil
 }
 
-func loadTests(path string) ([]testsharder.Test, error) {
-	bytes, err := os.ReadFile(path)
+// loadTests loads a tests file, which holds either a list of tests or a shard
+// as written by testsharder. The properties of a shard, e.g. whether it is a
+// benchmark run, apply to its tests.
+func loadTests(path string) (testShard, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read %q: %w", path, err)
+		return testShard{}, fmt.Errorf("failed to read %q: %w", path, err)
 	}
 
-	var tests []testsharder.Test
-	if err := json.Unmarshal(bytes, &tests); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal %q: %w", path, err)
+	var shard testShard
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var s testsharder.Shard
+		if err := json.Unmarshal(data, &s); err != nil {
+			return testShard{}, fmt.Errorf("failed to unmarshal %q: %w", path, err)
+		}
+		shard.tests = s.Tests
+		shard.benchmark = s.Benchmark
+	} else if err := json.Unmarshal(data, &shard.tests); err != nil {
+		return testShard{}, fmt.Errorf("failed to unmarshal %q: %w", path, err)
 	}
 
-	for _, test := range tests {
+	for _, test := range shard.tests {
 		if err := validateTest(test); err != nil {
+			return testShard{}, err
+		}
+	}
+
+	return shard, nil
+}
+
+// testShard is a list of tests to run, loaded from a tests file.
+type testShard struct {
+	// name identifies the shard in logs. It is the tests file's name without
+	// its extension.
+	name  string
+	tests []testsharder.Test
+	// benchmark, if set, marks the shard as a benchmark run, whose tests are
+	// run one at a time isolated as described.
+	benchmark *testsharder.BenchmarkConfig
+}
+
+// loadShards loads the shards to run from paths, which may be tests files or
+// directories of tests files.
+//
+// A test may not be in more than one shard, as the runs of each test are
+// recorded in the same output directory and summary entry.
+func loadShards(paths []string) ([]testShard, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tests: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		// Glob returns the matches in lexical order.
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
 			return nil, err
 		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no tests files in directory %q", path)
+		}
+		files = append(files, matches...)
 	}
 
-	return tests, nil
+	var shards []testShard
+	shardForTest := make(map[string]int)
+	for i, file := range files {
+		shard, err := loadTests(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tests from %q: %w", file, err)
+		}
+		for _, test := range shard.tests {
+			if other, ok := shardForTest[test.Name]; ok && other != i {
+				return nil, fmt.Errorf("test %q is in both %q and %q", test.Name, files[other], file)
+			}
+			shardForTest[test.Name] = i
+		}
+		shard.name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		shards = append(shards, shard)
+	}
+	return shards, nil
 }
 
 type multiTester interface {
@@ -459,14 +689,52 @@ type testToRun struct {
 	totalDuration time.Duration
 }
 
+// recoveryPolicy controls when runAndOutputTests reboots the target after
+// tests hit fatal errors.
+type recoveryPolicy struct {
+	// afterFatalFailures is the number of consecutive fatal errors after
+	// which the target is rebooted. Zero disables recovery.
+	afterFatalFailures int
+	// maxRecoveries is the maximum number of reboots in a run.
+	maxRecoveries int
+	// recoveries is the number of reboots so far in the run.
+	recoveries int
+}
+
+// runOptions controls how runAndOutputTests runs tests.
+type runOptions struct {
+	// recovery controls when the target is rebooted after tests hit fatal
+	// errors. If nil, the target is never rebooted.
+	recovery *recoveryPolicy
+	// retryFailedCases is whether retries of component v2 tests only run the
+	// cases that failed in the previous run.
+	retryFailedCases bool
+	// bench, if set, isolates the tests of a benchmark shard from thermal
+	// throttling. Its tests are then run one at a time.
+	bench *benchmarkEnv
+	// collectors are run after each run of a test, before its result is
+	// recorded.
+	collectors []ArtifactCollector
+	// status, if set, is updated with the progress and output of the tests.
+	status *shardStatus
+	// ffxRuns, if set, counts the batches of tests run with ffx so far. It is
+	// shared by all shards of the run so that each batch gets its own output
+	// directory, as ffx requires the directory to start empty.
+	ffxRuns *int
+}
+
 // runAndOutputTests runs all the tests, possibly with retries, and records the
-// results to `outputs`.
+// results to `outputs`. If a test hits a fatal error and the tester can reboot
+// the target, the test is recorded as aborted and the target is rebooted as
+// allowed by `opts.recovery`, so the remaining tests can still run. After each
+// run of a test, `opts.collectors` are run on its output directory.
 func runAndOutputTests(
 	ctx context.Context,
 	tests []testsharder.Test,
 	testerForTest func(testsharder.Test) (Tester, *[]runtests.DataSinkReference, error),
 	outputs *TestOutputs,
 	globalOutDir string,
+	opts runOptions,
 ) error {
 	// Since only a single goroutine writes to and reads from the queue it would
 	// be more appropriate to use a true Queue data structure, but we'd need to
@@ -483,7 +751,8 @@ func runAndOutputTests(
 			return err
 		}
 		mtForTest, ok := t.(multiTester)
-		if ok && mtForTest.EnabledForTest(test) {
+		// Benchmarks are run one at a time, so they are never batched.
+		if ok && opts.bench == nil && mtForTest.EnabledForTest(test) {
 			multiTests = append(multiTests, testToRun{Test: test})
 			if mt == nil {
 				mt = mtForTest
@@ -494,7 +763,7 @@ func runAndOutputTests(
 	}
 
 	// Run ffx tests first.
-	if err := runMultipleTests(ctx, multiTests, mt, globalOutDir, outputs); err != nil {
+	if err := runMultipleTests(ctx, multiTests, mt, globalOutDir, outputs, opts); err != nil {
 		return err
 	}
 
@@ -503,6 +772,7 @@ func runAndOutputTests(
 	// would need to close the channel when it became empty. That would require
 	// a length check within the loop body anyway, and it's more robust to put
 	// the length check in the for loop condition.
+	consecutiveFatalFailures := 0
 	for len(testQueue) > 0 {
 		test := <-testQueue
 
@@ -513,6 +783,15 @@ func runAndOutputTests(
 
 		runIndex := test.previousRuns
 
+		var benchRun *benchmarkRun
+		if opts.bench != nil {
+			// Wait for the device to cool down before the test's timeout
+			// starts.
+			if benchRun, err = opts.bench.prepare(ctx); err != nil {
+				return err
+			}
+		}
+
 		// Use a temp directory for the output directory which we will move to the
 		// actual outDir once the test completes. Otherwise, when run in a swarming
 		// task, a test that doesn't properly clean up its processes could still be
@@ -523,30 +802,66 @@ func runAndOutputTests(
 			return err
 		}
 		defer os.RemoveAll(tmpOutDir)
-		result, err := runTestOnce(ctx, test.Test, t, tmpOutDir)
+		startTime := clock.Now(ctx)
+		opts.status.startTest(test.Name, runIndex)
+		result, err := runTestOnce(ctx, test.Test, t, tmpOutDir, opts.status)
 		if err != nil {
-			return err
+			rt, ok := t.(recoverableTester)
+			if !ok || opts.recovery == nil || opts.recovery.afterFatalFailures <= 0 || ctx.Err() != nil {
+				return err
+			}
+			logger.Errorf(ctx, "Test %s hit a fatal error: %s", test.Name, err)
+			consecutiveFatalFailures++
+			if consecutiveFatalFailures >= opts.recovery.afterFatalFailures {
+				if opts.recovery.recoveries >= opts.recovery.maxRecoveries {
+					return fmt.Errorf("%w (gave up after rebooting the target %d times)", err, opts.recovery.recoveries)
+				}
+				opts.recovery.recoveries++
+				logger.Warningf(ctx, "rebooting the target after %d consecutive fatal errors", consecutiveFatalFailures)
+				if rebootErr := rt.RebootAndReconnect(ctx); rebootErr != nil {
+					return fmt.Errorf("%w (failed to recover the target: %s)", err, rebootErr)
+				}
+				consecutiveFatalFailures = 0
+			}
+			result = BaseTestResultFromTest(test.Test)
+			result.Result = runtests.TestAborted
+			result.FailReason = err.Error()
+			result.FatalErrorClass = errorClass(err)
+			result.StartTime = startTime
+			result.EndTime = clock.Now(ctx)
+		} else {
+			consecutiveFatalFailures = 0
+		}
+		if benchRun != nil {
+			opts.bench.annotate(ctx, benchRun, result)
 		}
+		opts.status.finishTest(result.Result)
 		result.RunIndex = runIndex
-		if err := outputs.Record(ctx, *result); err != nil {
+		if err := collectArtifacts(ctx, opts.collectors, test.Test, result, tmpOutDir); err != nil {
 			return err
 		}
+		if err := outputs.Record(ctx, *result); err != nil {
+			return classifyError(runtests.FailureClassTooling, err)
+		}
 		// At this point, outputs.Record() should have moved all important output
 		// files to somewhere within the outputs.OutDir, so the rest of the contents
 		// of tmpOutDir can be moved to the designated output directory for the test
 		// within globalOutDir so they can be uploaded with the swarming task outputs.
 		outDir := filepath.Join(globalOutDir, url.PathEscape(strings.ReplaceAll(test.Name, ":", "")), strconv.Itoa(runIndex))
 		if err := os.MkdirAll(outDir, 0o700); err != nil {
-			return err
+			return classifyError(runtests.FailureClassTooling, err)
 		}
 		if err := osmisc.CopyDir(tmpOutDir, outDir); err != nil {
-			return fmt.Errorf("failed to move test outputs: %w", err)
+			return classifyError(runtests.FailureClassTooling, fmt.Errorf("failed to move test outputs: %w", err))
 		}
 
 		test.previousRuns++
 		test.totalDuration += result.Duration()
 
 		if shouldKeepGoing(test.Test, result, test.totalDuration) {
+			if opts.retryFailedCases {
+				test.TestFilters = failedCaseFilters(test.Test, result)
+			}
 			// Schedule the test to be run again.
 			testQueue <- test
 		}
@@ -574,18 +889,52 @@ func shouldKeepGoing(test testsharder.Test, lastResult *TestResult, testTotalDur
 	return true
 }
 
-func runMultipleTests(ctx context.Context, multiTests []testToRun, mt multiTester, globalOutDir string, outputs *TestOutputs) error {
+// failedCaseFilters returns filters selecting the failed cases of a component
+// v2 test to retry after it failed, or nil if the whole test should be rerun.
+// Only retries of tests that failed are filtered, and only if the cases were
+// parsed from run-test-suite's output, so that their names can be passed back
+// to it. Tests that timed out or failed outside of a test case, e.g. because
+// they crashed, are rerun in full.
+func failedCaseFilters(test testsharder.Test, result *TestResult) []string {
+	if !test.IsComponentV2() || test.RunAlgorithm != testsharder.StopOnSuccess || result.Result != runtests.TestFailure {
+		return nil
+	}
+	var filters []string
+	for _, c := range result.Cases {
+		if c.Status == runtests.TestSuccess || c.Status == runtests.TestSkipped {
+			continue
+		}
+		if c.Format != "FTF" || c.CaseName == "" {
+			return nil
+		}
+		filters = append(filters, c.CaseName)
+	}
+	// Cases aren't necessarily parsed in the order they ran in.
+	sort.Strings(filters)
+	return filters
+}
+
+func runMultipleTests(ctx context.Context, multiTests []testToRun, mt multiTester, globalOutDir string, outputs *TestOutputs, opts runOptions) error {
+	ffxRuns := opts.ffxRuns
+	if ffxRuns == nil {
+		ffxRuns = new(int)
+	}
 	multiTestRunIndex := 0
 	skippedTests := 0
 	for len(multiTests) > 0 {
-		outDir := filepath.Join(globalOutDir, "ffx_tests", strconv.Itoa(multiTestRunIndex))
+		outDir := filepath.Join(globalOutDir, "ffx_tests", strconv.Itoa(*ffxRuns))
+		*ffxRuns++
 
 		var tests []testsharder.Test
 		for _, t := range multiTests {
 			tests = append(tests, t.Test)
 		}
 
-		testResults, err := mt.TestMultiple(ctx, tests, streams.Stdout(ctx), streams.Stderr(ctx), outDir)
+		opts.status.startBatch(len(tests), multiTestRunIndex)
+		stdout := io.MultiWriter(streams.Stdout(ctx), opts.status)
+		stderr := io.MultiWriter(streams.Stderr(ctx), opts.status)
+		testResults, err := mt.TestMultiple(ctx, tests, stdout, stderr, outDir)
+		opts.status.finishBatch()
 		if err != nil {
 			return err
 		}
@@ -604,12 +953,29 @@ func runMultipleTests(ctx context.Context, multiTests []testToRun, mt multiTeste
 				// ran.
 				skippedTests++
 			} else {
-				if err := outputs.Record(ctx, *result); err != nil {
+				opts.status.recordBatchResult(result.Name, result.Result)
+				// The tests of a run share its output directory, so give
+				// the collectors a temporary one for tests without their own.
+				if len(opts.collectors) > 0 && result.OutputDir == "" {
+					tmpOutDir, err := os.MkdirTemp("", "")
+					if err != nil {
+						return err
+					}
+					defer os.RemoveAll(tmpOutDir)
+					result.OutputDir = tmpOutDir
+				}
+				if err := collectArtifacts(ctx, opts.collectors, multiTests[i].Test, result, result.OutputDir); err != nil {
 					return err
 				}
+				if err := outputs.Record(ctx, *result); err != nil {
+					return classifyError(runtests.FailureClassTooling, err)
+				}
 			}
 			multiTests[i].totalDuration += result.Duration()
 			if shouldKeepGoing(multiTests[i].Test, result, multiTests[i].totalDuration) {
+				if opts.retryFailedCases {
+					multiTests[i].TestFilters = failedCaseFilters(multiTests[i].Test, result)
+				}
 				retryTests = append(retryTests, multiTests[i])
 			}
 		}
@@ -645,6 +1011,7 @@ func runTestOnce(
 	test testsharder.Test,
 	t Tester,
 	outDir string,
+	status *shardStatus,
 ) (*TestResult, error) {
 	// The test case parser specifically uses stdout, so we need to have a
 	// dedicated stdout buffer.
@@ -664,6 +1031,10 @@ func runTestOnce(
 	if _, ok := t.(*FuchsiaSerialTester); ok && againstQEMU {
 		multistdout = io.MultiWriter(stdio, stdout)
 	}
+	if status != nil {
+		multistdout = io.MultiWriter(multistdout, status)
+		multistderr = io.MultiWriter(multistderr, status)
+	}
 
 	startTime := clock.Now(ctx)
 
@@ -673,6 +1044,13 @@ func runTestOnce(
 	// exceed the test's timeout, so we give enough time for the tester to
 	// complete those steps as well.
 	outerTestTimeout := test.Timeout + testTimeoutGracePeriod
+	// Host tests run their setup and teardown binaries with the test's
+	// timeout too.
+	for _, path := range []string{test.SetupPath, test.TeardownPath} {
+		if path != "" {
+			outerTestTimeout += test.Timeout
+		}
+	}
 
 	var timeoutCh <-chan time.Time
 	if test.Timeout > 0 {
@@ -795,7 +795,7 @@ func TestRunAndOutputTests(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			err = runAndOutputTests(ctx, tc.tests, testerForTest, outputs, mkdtemp(t, "outputs"))
+			err = runAndOutputTests(ctx, tc.tests, testerForTest, outputs, mkdtemp(t, "outputs"), runOptions{})
 			if tc.wantErr != (err != nil) {
 				t.Errorf("want err: %t, got %s", tc.wantErr, err)
 			}
@@ -820,6 +820,303 @@ func TestRunAndOutputTests(t *testing.T) {
 	}
 }
 
+type fakeRecoverableTester struct {
+	*fakeTester
+	rebootCalls int
+}
+
+func (t *fakeRecoverableTester) RebootAndReconnect(_ context.Context) error {
+	t.rebootCalls++
+	return nil
+}
+
+func TestRunAndOutputTestsRecovery(t *testing.T) {
+	var tests []testsharder.Test
+	for _, name := range []string{"a", "b", "c"} {
+		tests = append(tests, testsharder.Test{
+			Test:         build.Test{Name: name, OS: "linux", Path: filepath.Join("path", "to", name)},
+			RunAlgorithm: testsharder.StopOnFailure,
+			Runs:         1,
+			Timeout:      time.Minute,
+		})
+	}
+
+	testCases := []struct {
+		name     string
+		recovery recoveryPolicy
+		// shards is the number of shards of the same tests to run, which
+		// share the recovery budget. Defaults to 1.
+		shards          int
+		expectedResults []runtests.TestDetails
+		wantReboots     int
+		wantErr         bool
+	}{
+		{
+			name:     "reboots after consecutive fatal errors",
+			recovery: recoveryPolicy{afterFatalFailures: 2, maxRecoveries: 1},
+			expectedResults: []runtests.TestDetails{
+				timedOutTest("a", 0, 0),
+				timedOutTest("b", 0, 0),
+				succeededTest("c", 0, 0),
+			},
+			wantReboots: 1,
+		},
+		{
+			name:     "recoveries are shared across shards",
+			recovery: recoveryPolicy{afterFatalFailures: 2, maxRecoveries: 1},
+			shards:   2,
+			expectedResults: []runtests.TestDetails{
+				timedOutTest("a", 0, 0),
+				timedOutTest("b", 0, 0),
+				succeededTest("c", 0, 0),
+				timedOutTest("a", 0, 0),
+			},
+			wantErr:     true,
+			wantReboots: 1,
+		},
+		{
+			name:        "gives up after max recoveries",
+			recovery:    recoveryPolicy{afterFatalFailures: 1, maxRecoveries: 0},
+			wantErr:     true,
+			wantReboots: 0,
+		},
+		{
+			name:     "disabled",
+			recovery: recoveryPolicy{},
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := clock.NewContext(context.Background(), clock.NewFakeClock())
+			tester := &fakeRecoverableTester{fakeTester: &fakeTester{
+				runTest: func(_ context.Context, test testsharder.Test, _, _ io.Writer) (runtests.TestResult, error) {
+					if test.Name == "c" {
+						return runtests.TestSuccess, nil
+					}
+					return "", fmt.Errorf("fatal error")
+				},
+			}}
+			testerForTest := func(testsharder.Test) (Tester, *[]runtests.DataSinkReference, error) {
+				return tester, &[]runtests.DataSinkReference{}, nil
+			}
+			outputs, err := CreateTestOutputs(tap.NewProducer(io.Discard), mkdtemp(t, "results"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			shards := tc.shards
+			if shards == 0 {
+				shards = 1
+			}
+			for i := 0; i < shards; i++ {
+				err = runAndOutputTests(ctx, tests, testerForTest, outputs, mkdtemp(t, "outputs"), runOptions{recovery: &tc.recovery})
+				if err != nil {
+					break
+				}
+			}
+			if tc.wantErr != (err != nil) {
+				t.Errorf("want err: %t, got %s", tc.wantErr, err)
+			}
+			opts := cmp.Options{
+				cmpopts.EquateEmpty(),
+				cmpopts.IgnoreFields(runtests.TestDetails{}, "StartTime"),
+			}
+			if diff := cmp.Diff(tc.expectedResults, outputs.Summary.Tests, opts...); diff != "" {
+				t.Errorf("test results diff (-want +got): %s", diff)
+			}
+			if tester.rebootCalls != tc.wantReboots {
+				t.Errorf("got %d reboots, want %d", tester.rebootCalls, tc.wantReboots)
+			}
+		})
+	}
+}
+
+func TestRunAndOutputTestsRetryFailedCases(t *testing.T) {
+	const url = "fuchsia-pkg://fuchsia.com/foo#meta/foo.cm"
+	outputs := []string{
+		"[PASSED]\tFoo.Pass\n[FAILED]\tFoo.Fail1\n[FAILED]\tFoo.Fail2\n",
+		"[PASSED]\tFoo.Fail1\n[FAILED]\tFoo.Fail2\n",
+		"[PASSED]\tFoo.Fail2\n",
+	}
+
+	testCases := []struct {
+		name             string
+		retryFailedCases bool
+		wantFilters      [][]string
+	}{
+		{
+			name:             "enabled",
+			retryFailedCases: true,
+			wantFilters:      [][]string{nil, {"Foo.Fail1", "Foo.Fail2"}, {"Foo.Fail2"}},
+		},
+		{
+			name:        "disabled",
+			wantFilters: [][]string{nil, nil, nil},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := clock.NewContext(context.Background(), clock.NewFakeClock())
+			tests := []testsharder.Test{
+				{
+					Test:         build.Test{Name: url, OS: "fuchsia", PackageURL: url},
+					RunAlgorithm: testsharder.StopOnSuccess,
+					Runs:         3,
+					Timeout:      time.Minute,
+				},
+			}
+			var gotFilters [][]string
+			tester := &fakeTester{
+				runTest: func(_ context.Context, test testsharder.Test, stdout, _ io.Writer) (runtests.TestResult, error) {
+					runIndex := len(gotFilters)
+					gotFilters = append(gotFilters, test.TestFilters)
+					fmt.Fprintf(stdout, "Running test '%s'\n%s", url, outputs[runIndex])
+					if runIndex < len(outputs)-1 {
+						return runtests.TestFailure, nil
+					}
+					return runtests.TestSuccess, nil
+				},
+			}
+			testerForTest := func(testsharder.Test) (Tester, *[]runtests.DataSinkReference, error) {
+				return tester, &[]runtests.DataSinkReference{}, nil
+			}
+			testOutputs, err := CreateTestOutputs(tap.NewProducer(io.Discard), mkdtemp(t, "results"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := runAndOutputTests(ctx, tests, testerForTest, testOutputs, mkdtemp(t, "outputs"), runOptions{retryFailedCases: tc.retryFailedCases}); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.wantFilters, gotFilters); diff != "" {
+				t.Errorf("unexpected test filters (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRunTestOnceSetupTeardownTimeout(t *testing.T) {
+	fakeClock := clock.NewFakeClock()
+	ctx := clock.NewContext(context.Background(), fakeClock)
+	test := testsharder.Test{
+		Test: build.Test{
+			Name:         "foo",
+			OS:           "linux",
+			Path:         "host_x64/foo",
+			SetupPath:    "host_x64/foo_setup",
+			TeardownPath: "host_x64/foo_teardown",
+		},
+		Timeout: time.Minute,
+	}
+	tester := &fakeTester{
+		runTest: func(context.Context, testsharder.Test, io.Writer, io.Writer) (runtests.TestResult, error) {
+			// The setup, test and teardown may each take up to the test's
+			// timeout.
+			fakeClock.Advance(3*test.Timeout - time.Second)
+			return runtests.TestSuccess, nil
+		},
+	}
+	result, err := runTestOnce(ctx, test, tester, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Result != runtests.TestSuccess {
+		t.Errorf("got result %s, want %s", result.Result, runtests.TestSuccess)
+	}
+}
+
+func TestFailedCaseFilters(t *testing.T) {
+	v2Test := testsharder.Test{
+		Test:         build.Test{PackageURL: "fuchsia-pkg://fuchsia.com/foo#meta/foo.cm"},
+		RunAlgorithm: testsharder.StopOnSuccess,
+	}
+	ftfCase := func(name string, status runtests.TestResult) runtests.TestCaseResult {
+		return runtests.TestCaseResult{CaseName: name, Status: status, Format: "FTF"}
+	}
+
+	testCases := []struct {
+		name   string
+		test   testsharder.Test
+		result TestResult
+		want   []string
+	}{
+		{
+			name: "failed cases",
+			test: v2Test,
+			result: TestResult{
+				Result: runtests.TestFailure,
+				Cases: []runtests.TestCaseResult{
+					ftfCase("Foo.Pass", runtests.TestSuccess),
+					ftfCase("Foo.Skip", runtests.TestSkipped),
+					ftfCase("Foo.Fail", runtests.TestFailure),
+					ftfCase("Foo.Hang", runtests.TestAborted),
+				},
+			},
+			want: []string{"Foo.Fail", "Foo.Hang"},
+		},
+		{
+			name: "no failed cases",
+			test: v2Test,
+			result: TestResult{
+				Result: runtests.TestFailure,
+				Cases:  []runtests.TestCaseResult{ftfCase("Foo.Pass", runtests.TestSuccess)},
+			},
+		},
+		{
+			name: "timed out",
+			test: v2Test,
+			result: TestResult{
+				Result: runtests.TestAborted,
+				Cases:  []runtests.TestCaseResult{ftfCase("Foo.Fail", runtests.TestFailure)},
+			},
+		},
+		{
+			name: "cases not parsed from run-test-suite",
+			test: v2Test,
+			result: TestResult{
+				Result: runtests.TestFailure,
+				Cases: []runtests.TestCaseResult{
+					{CaseName: "Foo.Fail", Status: runtests.TestFailure, Format: "GoogleTest"},
+				},
+			},
+		},
+		{
+			name: "v1 test",
+			test: testsharder.Test{
+				Test:         build.Test{PackageURL: "fuchsia-pkg://fuchsia.com/foo#meta/foo.cmx"},
+				RunAlgorithm: testsharder.StopOnSuccess,
+			},
+			result: TestResult{
+				Result: runtests.TestFailure,
+				Cases:  []runtests.TestCaseResult{ftfCase("Foo.Fail", runtests.TestFailure)},
+			},
+		},
+		{
+			name: "multiplied test",
+			test: testsharder.Test{
+				Test:         v2Test.Test,
+				RunAlgorithm: testsharder.StopOnFailure,
+			},
+			result: TestResult{
+				Result: runtests.TestFailure,
+				Cases:  []runtests.TestCaseResult{ftfCase("Foo.Fail", runtests.TestFailure)},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := failedCaseFilters(tc.test, &tc.result)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected filters (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 // mkdtemp creates a new temporary directory within t.TempDir.
 func mkdtemp(t *testing.T, pattern string) string {
 	t.Helper()
@@ -830,6 +1127,206 @@ func mkdtemp(t *testing.T, pattern string) string {
 	return dir
 }
 
+func TestLoadShards(t *testing.T) {
+	writeTests := func(t *testing.T, path string, names ...string) {
+		t.Helper()
+		var entries []string
+		for _, name := range names {
+			entries = append(entries, fmt.Sprintf(`{"name": %q, "os": "linux", "path": "/foo/%s", "runs": 1}`, name, name))
+		}
+		if err := os.WriteFile(path, []byte("["+strings.Join(entries, ",")+"]"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shardNames := func(shards []testShard) []string {
+		var names []string
+		for _, shard := range shards {
+			var tests []string
+			for _, test := range shard.tests {
+				tests = append(tests, test.Name)
+			}
+			names = append(names, fmt.Sprintf("%s:%s", shard.name, strings.Join(tests, "+")))
+		}
+		return names
+	}
+
+	dir := t.TempDir()
+	shardDir := filepath.Join(dir, "shards")
+	if err := os.Mkdir(shardDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeTests(t, filepath.Join(shardDir, "b.json"), "test3")
+	writeTests(t, filepath.Join(shardDir, "a.json"), "test1", "test2")
+	if err := os.WriteFile(filepath.Join(shardDir, "README"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	writeTests(t, filepath.Join(dir, "single.json"), "test4")
+
+	shards, err := loadShards([]string{filepath.Join(dir, "single.json"), shardDir})
+	if err != nil {
+		t.Fatalf("loadShards() failed: %s", err)
+	}
+	want := []string{"single:test4", "a:test1+test2", "b:test3"}
+	if diff := cmp.Diff(want, shardNames(shards)); diff != "" {
+		t.Errorf("loadShards() returned wrong shards (-want +got):\n%s", diff)
+	}
+
+	// A tests file may also hold a shard as written by testsharder.
+	benchShard := `{"name": "bench", "tests": [{"name": "test5", "os": "linux", "path": "/foo/test5", "runs": 1}], "benchmark": {"setup_command": ["setup.sh"]}}`
+	if err := os.WriteFile(filepath.Join(dir, "bench.json"), []byte(benchShard), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	shards, err = loadShards([]string{filepath.Join(dir, "single.json"), filepath.Join(dir, "bench.json")})
+	if err != nil {
+		t.Fatalf("loadShards() failed: %s", err)
+	}
+	if diff := cmp.Diff([]string{"single:test4", "bench:test5"}, shardNames(shards)); diff != "" {
+		t.Errorf("loadShards() returned wrong shards (-want +got):\n%s", diff)
+	}
+	if shards[0].benchmark != nil {
+		t.Errorf("got benchmark config %+v for a list of tests, want none", shards[0].benchmark)
+	}
+	wantBench := &testsharder.BenchmarkConfig{SetupCommand: []string{"setup.sh"}}
+	if diff := cmp.Diff(wantBench, shards[1].benchmark); diff != "" {
+		t.Errorf("loadShards() returned wrong benchmark config (-want +got):\n%s", diff)
+	}
+
+	writeTests(t, filepath.Join(dir, "duplicate.json"), "test1")
+	if _, err := loadShards([]string{shardDir, filepath.Join(dir, "duplicate.json")}); err == nil {
+		t.Errorf("loadShards() succeeded with a test in two shards, want error")
+	}
+	if _, err := loadShards([]string{t.TempDir()}); err == nil {
+		t.Errorf("loadShards() succeeded with an empty directory, want error")
+	}
+	if _, err := loadShards([]string{filepath.Join(dir, "missing.json")}); err == nil {
+		t.Errorf("loadShards() succeeded with a missing file, want error")
+	}
+}
+
+func TestExecuteMultipleShards(t *testing.T) {
+	shards := []testShard{
+		{
+			name: "first",
+			tests: []testsharder.Test{
+				{Test: build.Test{Name: "foo", OS: "fuchsia", PackageURL: "fuchsia-pkg://foo/foo.cm"}, Runs: 1},
+				{Test: build.Test{Name: "bar", OS: "fuchsia", PackageURL: "fuchsia-pkg://foo/bar.cm"}, Runs: 1},
+			},
+		},
+		{
+			name: "second",
+			tests: []testsharder.Test{
+				{Test: build.Test{Name: "baz", OS: "fuchsia", PackageURL: "fuchsia-pkg://foo/baz.cm"}, Runs: 1},
+			},
+		},
+	}
+
+	oldSerialTester := serialTester
+	defer func() {
+		serialTester = oldSerialTester
+	}()
+	fuchsiaTester := &fakeTester{}
+	testersCreated := 0
+	serialTester = func(_ context.Context, _ string) (Tester, error) {
+		testersCreated++
+		return fuchsiaTester, nil
+	}
+
+	var buf bytes.Buffer
+	o, err := CreateTestOutputs(tap.NewProducer(&buf), mkdtemp(t, "outputs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if err := execute(context.Background(), shards, o, nil, net.IPAddr{}, "", "socketpath", t.TempDir(), TestrunnerFlags{}, nil, nil); err != nil {
+		t.Fatalf("execute() failed: %s", err)
+	}
+
+	if testersCreated != 1 {
+		t.Errorf("created %d serial testers, want 1", testersCreated)
+	}
+	// The shards share the tester, which is finalized once after all tests
+	// ran.
+	want := []string{testFunc, testFunc, testFunc, runSnapshotFunc, copySinksFunc, closeFunc}
+	if diff := cmp.Diff(want, fuchsiaTester.funcCalls); diff != "" {
+		t.Errorf("Unexpected command run (-want +got):\n%s", diff)
+	}
+	var ran []string
+	for _, test := range o.Summary.Tests {
+		ran = append(ran, test.Name)
+	}
+	if diff := cmp.Diff([]string{"foo", "bar", "baz"}, ran); diff != "" {
+		t.Errorf("Unexpected test order (-want +got):\n%s", diff)
+	}
+}
+
+func TestExecuteMultipleShardsWithFFX(t *testing.T) {
+	shards := []testShard{
+		{
+			name: "first",
+			tests: []testsharder.Test{
+				{Test: build.Test{Name: "foo", OS: "fuchsia", PackageURL: "fuchsia-pkg://foo/foo.cm"}, Runs: 1},
+				{Test: build.Test{Name: "bar", OS: "fuchsia", PackageURL: "fuchsia-pkg://foo/bar.cm"}, Runs: 1},
+			},
+		},
+		{
+			name: "second",
+			tests: []testsharder.Test{
+				{Test: build.Test{Name: "baz", OS: "fuchsia", PackageURL: "fuchsia-pkg://foo/baz.cm"}, Runs: 1},
+			},
+		},
+	}
+
+	oldSSHTester := sshTester
+	oldFFXInstance := ffxInstance
+	defer func() {
+		sshTester = oldSSHTester
+		ffxInstance = oldFFXInstance
+	}()
+	sshTester = func(_ context.Context, _ *sshConnector, _ net.IPAddr, _, _, _ string, _ bool) (Tester, error) {
+		return &fakeTester{}, nil
+	}
+	ffx := &ffxutil.MockFFXInstance{}
+	ffxInstance = func(_ context.Context, _ string, _ int, _ string, _ []string, _ net.IPAddr, _, _, _ string) (FFXInstance, error) {
+		return ffx, nil
+	}
+
+	var buf bytes.Buffer
+	o, err := CreateTestOutputs(tap.NewProducer(&buf), mkdtemp(t, "outputs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	outDir := t.TempDir()
+	status := newShardStatus(context.Background(), 3)
+	if err := execute(context.Background(), shards, o, nil, net.IPAddr{}, "sshkey", "", outDir, TestrunnerFlags{FfxExperimentLevel: 2}, nil, status); err != nil {
+		t.Fatalf("execute() failed: %s", err)
+	}
+	if got := status.snapshot(); got.RunsCompleted != 3 || got.Current != nil {
+		t.Errorf("got status %+v, want 3 completed runs and no running test", got)
+	}
+
+	// Each shard's batch is run in its own output directory, as ffx
+	// requires the directory to start empty.
+	if got := strings.Count(strings.Join(ffx.CmdsCalled, ","), "test"); got != 2 {
+		t.Errorf("ran ffx test %d times, want 2", got)
+	}
+	for _, dir := range []string{"0", "1"} {
+		if _, err := os.Stat(filepath.Join(outDir, "ffx_tests", dir)); err != nil {
+			t.Errorf("missing ffx output directory: %s", err)
+		}
+	}
+	var ran []string
+	for _, test := range o.Summary.Tests {
+		// The early boot sinks are recorded as a test of their own.
+		if test.Name != earlyBootSinksTestName {
+			ran = append(ran, test.Name)
+		}
+	}
+	if diff := cmp.Diff([]string{"foo", "bar", "baz"}, ran); diff != "" {
+		t.Errorf("Unexpected tests recorded (-want +got):\n%s", diff)
+	}
+}
+
 func TestExecute(t *testing.T) {
 	tests := []testsharder.Test{
 		{
@@ -898,7 +1395,7 @@ func TestExecute(t *testing.T) {
 				ffxInstance = oldFFXInstance
 			}()
 			fuchsiaTester := &fakeTester{}
-			sshTester = func(_ context.Context, _ net.IPAddr, _, _, _ string, _ bool) (Tester, error) {
+			sshTester = func(_ context.Context, _ *sshConnector, _ net.IPAddr, _, _, _ string, _ bool) (Tester, error) {
 				if c.wantErr {
 					return nil, fmt.Errorf("failed to get tester")
 				}
@@ -925,8 +1422,8 @@ func TestExecute(t *testing.T) {
 				t.Fatal(err)
 			}
 			defer o.Close()
-			err = execute(context.Background(), tests, o, net.IPAddr{}, c.sshKeyFile, c.serialSocketPath, t.TempDir(),
-				TestrunnerFlags{SnapshotFile: "snapshot.zip", FfxExperimentLevel: 2})
+			err = execute(context.Background(), []testShard{{name: "tests", tests: tests}}, o, nil, net.IPAddr{}, c.sshKeyFile, c.serialSocketPath, t.TempDir(),
+				TestrunnerFlags{SnapshotFile: "snapshot.zip", FfxExperimentLevel: 2}, nil, nil)
 			if c.wantErr {
 				if err == nil {
 					t.Errorf("got nil error, want an error for failing to initialize a tester")
@@ -25,9 +25,22 @@ import (
 // TestOutputs manages the test runner's output drivers. Upon completion, if tar output is
 // initialized, a TAR archive containing all other outputs is produced.
 type TestOutputs struct {
-	OutDir  string
+	OutDir string
+	// Summary holds one entry per run of each test. The entries of tests that
+	// were run more than once are aggregated when the summary is written if
+	// AggregateRuns is set.
 	Summary runtests.TestSummary
-	tap     *tap.Producer
+	// AggregateRuns enables the aggregation of multiple runs of a test into a
+	// single entry with attempts in the written summary. Consumers that expect
+	// one entry per run must flatten such summaries.
+	AggregateRuns bool
+	// HTMLReport enables writing a self-contained HTML results page next
+	// to the summary.
+	HTMLReport bool
+	tap        *tap.Producer
+	// fatalErrorClasses maps the name of each test whose latest run was
+	// aborted by a fatal error to the class of that error.
+	fatalErrorClasses map[string]runtests.FailureClass
 }
 
 func CreateTestOutputs(producer *tap.Producer, outdir string) (*TestOutputs, error) {
@@ -151,8 +164,18 @@ func (o *TestOutputs) Record(ctx context.Context, result TestResult) error {
 		DataSinks:      result.DataSinks.Sinks,
 		Affected:       result.Affected,
 		Tags:           result.Tags,
+		ResourceUsage:  result.ResourceUsage,
 	})
 
+	if result.FatalErrorClass != "" {
+		if o.fatalErrorClasses == nil {
+			o.fatalErrorClasses = make(map[string]runtests.FailureClass)
+		}
+		o.fatalErrorClasses[result.Name] = result.FatalErrorClass
+	} else {
+		delete(o.fatalErrorClasses, result.Name)
+	}
+
 	desc := fmt.Sprintf("%s (%s)", result.Name, duration)
 	if o.tap != nil {
 		o.tap.Ok(result.Passed(), desc)
@@ -188,7 +211,14 @@ func (o *TestOutputs) Close() error {
 	if o.OutDir == "" {
 		return nil
 	}
-	summaryBytes, err := json.Marshal(o.Summary)
+	summary := o.Summary
+	if summary.Classification == "" {
+		summary.Classification = summaryClass(summary.Tests, o.fatalErrorClasses)
+	}
+	if o.AggregateRuns {
+		summary.Tests = runtests.AggregateAttempts(summary.Tests)
+	}
+	summaryBytes, err := json.Marshal(summary)
 	if err != nil {
 		return err
 	}
@@ -198,6 +228,16 @@ func (o *TestOutputs) Close() error {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
 	defer s.Close()
-	_, err = io.Copy(s, bytes.NewBuffer(summaryBytes))
-	return err
+	if _, err := io.Copy(s, bytes.NewBuffer(summaryBytes)); err != nil {
+		return err
+	}
+	if o.HTMLReport {
+		r, err := osmisc.CreateFile(filepath.Join(o.OutDir, HTMLReportFilename))
+		if err != nil {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+		defer r.Close()
+		return writeHTMLReport(r, summary)
+	}
+	return nil
 }
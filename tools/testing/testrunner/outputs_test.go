@@ -95,6 +95,11 @@ func TestRecordingOfOutputs(t *testing.T) {
 			StartTime: start,
 			EndTime:   start.Add(10 * time.Millisecond),
 			Stdio:     []byte("STDERR_B"),
+			ResourceUsage: &runtests.ResourceUsage{
+				UserCPUMillis:   8,
+				SystemCPUMillis: 1,
+				MaxRSSBytes:     1 << 20,
+			},
 		},
 	}
 
@@ -162,6 +167,11 @@ func TestRecordingOfOutputs(t *testing.T) {
 			Result:         runtests.TestSuccess,
 			StartTime:      start,
 			DurationMillis: 10,
+			ResourceUsage: &runtests.ResourceUsage{
+				UserCPUMillis:   8,
+				SystemCPUMillis: 1,
+				MaxRSSBytes:     1 << 20,
+			},
 			// The data sinks will be added through a call to updateDataSinks().
 			DataSinks: runtests.DataSinkMap{
 				"sinks": []runtests.DataSink{
@@ -174,7 +184,10 @@ func TestRecordingOfOutputs(t *testing.T) {
 		}},
 	}
 
-	summaryBytes, err := json.Marshal(&expectedSummary)
+	// The written summary classifies the failure of test_a.
+	writtenSummary := expectedSummary
+	writtenSummary.Classification = runtests.FailureClassTestFailure
+	summaryBytes, err := json.Marshal(&writtenSummary)
 	if err != nil {
 		t.Fatalf("failed to marshal expected summary: %v", err)
 	}
@@ -259,3 +272,116 @@ ok 2 test_b (10ms)
 		t.Errorf("Diff in out dir contents (-want +got):\n%s", diff)
 	}
 }
+
+func TestSummaryAggregatesRuns(t *testing.T) {
+	start := time.Unix(0, 0)
+	results := []TestResult{
+		{
+			Name:      "test_a",
+			Result:    runtests.TestFailure,
+			StartTime: start,
+			EndTime:   start.Add(5 * time.Millisecond),
+		},
+		{
+			Name:      "test_a",
+			Result:    runtests.TestSuccess,
+			StartTime: start.Add(time.Second),
+			EndTime:   start.Add(time.Second + 7*time.Millisecond),
+			RunIndex:  1,
+		},
+	}
+
+	for _, aggregate := range []bool{false, true} {
+		o, err := CreateTestOutputs(nil, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.AggregateRuns = aggregate
+		for _, result := range results {
+			if err := o.Record(context.Background(), result); err != nil {
+				t.Fatalf("failed to record result of %q: %v", result.Name, err)
+			}
+		}
+		if err := o.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := os.ReadFile(filepath.Join(o.OutDir, runtests.TestSummaryFilename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var summary runtests.TestSummary
+		if err := json.Unmarshal(b, &summary); err != nil {
+			t.Fatal(err)
+		}
+		if !aggregate {
+			if len(summary.Tests) != 2 {
+				t.Errorf("got %d entries in flat summary, want 2", len(summary.Tests))
+			}
+			continue
+		}
+		if len(summary.Tests) != 1 {
+			t.Fatalf("got %d entries in aggregated summary, want 1", len(summary.Tests))
+		}
+		test := summary.Tests[0]
+		if test.Result != runtests.TestFailure || !test.Flaky || test.DurationMillis != 12 {
+			t.Errorf("got aggregated entry %+v, want a flaky failure lasting 12ms", test)
+		}
+		if test.Verdict != runtests.VerdictFlake || test.Runs != 2 || test.FailedRuns != 1 {
+			t.Errorf("got (Verdict, Runs, FailedRuns) = (%q, %d, %d), want (%q, 2, 1)", test.Verdict, test.Runs, test.FailedRuns, runtests.VerdictFlake)
+		}
+		wantOutputs := [][]string{
+			{filepath.Join("test_a", "0", runtests.TestOutputFilename)},
+			{filepath.Join("test_a", "1", runtests.TestOutputFilename)},
+		}
+		var gotOutputs [][]string
+		for _, attempt := range test.Attempts {
+			gotOutputs = append(gotOutputs, attempt.OutputFiles)
+		}
+		if diff := cmp.Diff(wantOutputs, gotOutputs); diff != "" {
+			t.Errorf("Diff in per-attempt outputs (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestHTMLReport(t *testing.T) {
+	start := time.Unix(0, 0)
+	o, err := CreateTestOutputs(nil, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.HTMLReport = true
+	result := TestResult{
+		Name:      "foo_test",
+		Result:    runtests.TestFailure,
+		StartTime: start,
+		EndTime:   start.Add(3 * time.Second),
+		Stdio:     []byte("stdio"),
+		Cases: []runtests.TestCaseResult{
+			{DisplayName: "Foo.<Bar>", Status: runtests.TestFailure, FailReason: "expected 1"},
+		},
+	}
+	if err := o.Record(context.Background(), result); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(o.OutDir, HTMLReportFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(b)
+	for _, want := range []string{
+		"1 FAIL",
+		"Foo.&lt;Bar&gt;",
+		"expected 1",
+		"3s",
+		`href="` + o.Summary.Tests[0].OutputFiles[0] + `"`,
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("HTML report does not contain %q:\n%s", want, report)
+		}
+	}
+}
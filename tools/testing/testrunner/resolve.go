@@ -19,7 +19,11 @@ import (
 
 // ResolveTestPackages resolves all test packages serially used by the given slice of tests.
 func ResolveTestPackages(ctx context.Context, tests []testsharder.Test, addr net.IPAddr, sshKeyFile, resolveLog string) error {
-	client, err := sshToTarget(ctx, addr, sshKeyFile)
+	return resolveTestPackages(ctx, newSSHConnector(sshutil.KeepaliveConfig{}, false), tests, addr, sshKeyFile, resolveLog)
+}
+
+func resolveTestPackages(ctx context.Context, connector *sshConnector, tests []testsharder.Test, addr net.IPAddr, sshKeyFile, resolveLog string) error {
+	client, err := connector.connect(ctx, addr, sshKeyFile)
 	if err != nil {
 		return fmt.Errorf("failed to establish an SSH connection: %w", err)
 	}
@@ -26,6 +26,10 @@ type TestResult struct {
 	// FailReason is the error message from a failed test.
 	FailReason string
 
+	// FatalErrorClass is the class of the fatal error that aborted the test,
+	// if any.
+	FatalErrorClass runtests.FailureClass
+
 	// Cases describes individual test cases.
 	Cases []runtests.TestCaseResult
 
@@ -52,6 +56,10 @@ type TestResult struct {
 
 	// Tags contain test metadata.
 	Tags []build.TestTag
+
+	// ResourceUsage is the resources used by the test's process. It is only
+	// set for tests run as local subprocesses.
+	ResourceUsage *runtests.ResourceUsage
 }
 
 // Passed indicates whether the test completed successfully. This will be false
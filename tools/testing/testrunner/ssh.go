@@ -0,0 +1,127 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+	"go.fuchsia.dev/fuchsia/tools/net/sshutil"
+)
+
+// for testability
+var dialSSH = func(ctx context.Context, addr net.IPAddr, sshKeyFile string, keepalive sshutil.KeepaliveConfig) (*sshutil.Client, error) {
+	key, err := os.ReadFile(sshKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key file: %w", err)
+	}
+	config, err := sshutil.DefaultSSHConfig(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create an SSH client config: %w", err)
+	}
+
+	return sshutil.NewClientWithKeepalive(
+		ctx,
+		sshutil.ConstantAddrResolver{
+			Addr: &net.TCPAddr{
+				IP:   addr.IP,
+				Port: sshutil.SSHPort,
+				Zone: addr.Zone,
+			},
+		},
+		config,
+		sshutil.DefaultConnectBackoff(),
+		keepalive,
+	)
+}
+
+// sshConnector makes the SSH connections to the target.
+//
+// If multiplex is set, a single connection to each target is shared by the
+// tester, the data sink copier, package prefetching and the build version
+// check, rather than each of them connecting separately. SSH multiplexes
+// their commands over the connection, and reconnecting it on behalf of one
+// of them reconnects it for all.
+type sshConnector struct {
+	keepalive sshutil.KeepaliveConfig
+	multiplex bool
+
+	mu     sync.Mutex
+	shared map[string]*sshutil.Client
+}
+
+// newSSHConnector returns an sshConnector, using the default keepalive
+// settings for any that are unset in keepalive.
+func newSSHConnector(keepalive sshutil.KeepaliveConfig, multiplex bool) *sshConnector {
+	defaults := sshutil.DefaultKeepaliveConfig()
+	if keepalive.Interval <= 0 {
+		keepalive.Interval = defaults.Interval
+	}
+	if keepalive.Timeout <= 0 {
+		keepalive.Timeout = defaults.Timeout
+	}
+	if keepalive.MaxMissed <= 0 {
+		keepalive.MaxMissed = defaults.MaxMissed
+	}
+	return &sshConnector{
+		keepalive: keepalive,
+		multiplex: multiplex,
+		shared:    make(map[string]*sshutil.Client),
+	}
+}
+
+// connect returns a connection to the target at addr. The caller must close
+// it when done, which leaves shared connections open for other users.
+func (c *sshConnector) connect(ctx context.Context, addr net.IPAddr, sshKeyFile string) (*targetSSHClient, error) {
+	if !c.multiplex {
+		client, err := dialSSH(ctx, addr, sshKeyFile, c.keepalive)
+		if err != nil {
+			return nil, err
+		}
+		return &targetSSHClient{Client: client}, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := addr.String() + " " + sshKeyFile
+	if client, ok := c.shared[key]; ok {
+		return &targetSSHClient{Client: client, shared: true}, nil
+	}
+	client, err := dialSSH(ctx, addr, sshKeyFile, c.keepalive)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf(ctx, "sharing the SSH connection to %s", addr.String())
+	c.shared[key] = client
+	return &targetSSHClient{Client: client, shared: true}, nil
+}
+
+// close closes the shared connections.
+func (c *sshConnector) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, client := range c.shared {
+		client.Close()
+		delete(c.shared, key)
+	}
+}
+
+// targetSSHClient is an SSH connection to the target made by an sshConnector.
+type targetSSHClient struct {
+	*sshutil.Client
+	// Whether the connection is shared, in which case it is closed by the
+	// sshConnector rather than by Close.
+	shared bool
+}
+
+func (c *targetSSHClient) Close() {
+	if !c.shared {
+		c.Client.Close()
+	}
+}
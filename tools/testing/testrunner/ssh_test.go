@@ -0,0 +1,100 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/net/sshutil"
+)
+
+func TestSSHConnector(t *testing.T) {
+	oldDialSSH := dialSSH
+	defer func() { dialSSH = oldDialSSH }()
+
+	var dials int
+	var gotKeepalive sshutil.KeepaliveConfig
+	var dialErr error
+	dialSSH = func(_ context.Context, _ net.IPAddr, _ string, keepalive sshutil.KeepaliveConfig) (*sshutil.Client, error) {
+		dials++
+		gotKeepalive = keepalive
+		if dialErr != nil {
+			return nil, dialErr
+		}
+		return &sshutil.Client{}, nil
+	}
+
+	ctx := context.Background()
+	addr := net.IPAddr{IP: net.IPv4(192, 168, 0, 2)}
+	otherAddr := net.IPAddr{IP: net.IPv4(192, 168, 0, 3)}
+
+	t.Run("dedicated connections", func(t *testing.T) {
+		dials = 0
+		c := newSSHConnector(sshutil.KeepaliveConfig{MaxMissed: 3}, false)
+		defer c.close()
+		first, err := c.connect(ctx, addr, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := c.connect(ctx, addr, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dials != 2 || first.Client == second.Client {
+			t.Errorf("got %d dials for 2 connections, want a dedicated connection for each", dials)
+		}
+		if first.shared || second.shared {
+			t.Errorf("dedicated connections are marked as shared")
+		}
+		want := sshutil.DefaultKeepaliveConfig()
+		want.MaxMissed = 3
+		if gotKeepalive != want {
+			t.Errorf("got keepalive config %+v, want %+v", gotKeepalive, want)
+		}
+	})
+
+	t.Run("multiplexed connections", func(t *testing.T) {
+		dials = 0
+		c := newSSHConnector(sshutil.KeepaliveConfig{Interval: 5 * time.Second}, true)
+		defer c.close()
+
+		dialErr = fmt.Errorf("connection refused")
+		if _, err := c.connect(ctx, addr, "key"); err == nil {
+			t.Errorf("connect() succeeded, want error")
+		}
+		// A failed connection isn't shared.
+		dialErr = nil
+		first, err := c.connect(ctx, addr, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		first.Close()
+		second, err := c.connect(ctx, addr, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dials != 2 || first.Client != second.Client {
+			t.Errorf("got %d dials, want the connection to be shared after the failed attempt", dials)
+		}
+		if !second.shared {
+			t.Errorf("multiplexed connection isn't marked as shared")
+		}
+		if gotKeepalive.Interval != 5*time.Second {
+			t.Errorf("got keepalive interval %s, want 5s", gotKeepalive.Interval)
+		}
+
+		other, err := c.connect(ctx, otherAddr, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dials != 3 || other.Client == first.Client {
+			t.Errorf("connections to different targets are shared")
+		}
+	})
+}
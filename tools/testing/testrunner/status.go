@@ -0,0 +1,203 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/clock"
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+// maxStatusOutputTail is the number of bytes of the running test's most recent
+// output that are kept for the status server.
+const maxStatusOutputTail = 16 * 1024
+
+// ShardStatus is the state of the shard served by the status server.
+type ShardStatus struct {
+	StartTime      time.Time `json:"start_time"`
+	ElapsedMillis  int64     `json:"elapsed_millis"`
+	TestsTotal     int       `json:"tests_total"`
+	RunsCompleted  int       `json:"runs_completed"`
+	RunsFailed     int       `json:"runs_failed"`
+	LastFailedTest string    `json:"last_failed_test,omitempty"`
+	// Current is the test that is running, if any.
+	Current *RunningTest `json:"current,omitempty"`
+}
+
+// RunningTest describes the test that is currently running.
+type RunningTest struct {
+	Name          string    `json:"name"`
+	RunIndex      int       `json:"run_index"`
+	StartTime     time.Time `json:"start_time"`
+	ElapsedMillis int64     `json:"elapsed_millis"`
+	// OutputTail is the end of the test's combined stdout and stderr.
+	OutputTail string `json:"output_tail"`
+}
+
+// shardStatus tracks the progress of a shard. Its methods are safe to call on
+// a nil receiver, in which case they do nothing, so that callers don't need to
+// check whether the status server is enabled.
+type shardStatus struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	status    ShardStatus
+	running   bool
+	outputBuf []byte
+}
+
+func newShardStatus(ctx context.Context, testsTotal int) *shardStatus {
+	s := &shardStatus{
+		now: func() time.Time { return clock.Now(ctx) },
+	}
+	s.status.StartTime = s.now()
+	s.status.TestsTotal = testsTotal
+	return s
+}
+
+// startTest records that a run of a test has started.
+func (s *shardStatus) startTest(name string, runIndex int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Current = &RunningTest{
+		Name:      name,
+		RunIndex:  runIndex,
+		StartTime: s.now(),
+	}
+	s.running = true
+	s.outputBuf = s.outputBuf[:0]
+}
+
+// finishTest records the result of the running test.
+func (s *shardStatus) finishTest(result runtests.TestResult) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var name string
+	if s.status.Current != nil {
+		name = s.status.Current.Name
+	}
+	s.recordRunLocked(name, result)
+	s.status.Current = nil
+	s.running = false
+}
+
+// startBatch records that a run of a batch of tests, which ffx runs together,
+// has started. The batch is reported as the running test until finishBatch is
+// called; the results of its tests are then recorded with recordBatchResult.
+func (s *shardStatus) startBatch(size int, runIndex int) {
+	s.startTest(fmt.Sprintf("batch of %d tests run by ffx", size), runIndex)
+}
+
+// recordBatchResult records the result of a test of the running batch.
+func (s *shardStatus) recordBatchResult(name string, result runtests.TestResult) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recordRunLocked(name, result)
+}
+
+// finishBatch records that the running batch is done.
+func (s *shardStatus) finishBatch() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Current = nil
+	s.running = false
+}
+
+func (s *shardStatus) recordRunLocked(name string, result runtests.TestResult) {
+	s.status.RunsCompleted++
+	if runtests.IsFailure(result) {
+		s.status.RunsFailed++
+		if name != "" {
+			s.status.LastFailedTest = name
+		}
+	}
+}
+
+// Write appends to the running test's output tail.
+func (s *shardStatus) Write(p []byte) (int, error) {
+	if s == nil {
+		return len(p), nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return len(p), nil
+	}
+	s.outputBuf = append(s.outputBuf, p...)
+	if n := len(s.outputBuf); n > maxStatusOutputTail {
+		s.outputBuf = append(s.outputBuf[:0], s.outputBuf[n-maxStatusOutputTail:]...)
+	}
+	return len(p), nil
+}
+
+// snapshot returns the current status.
+func (s *shardStatus) snapshot() ShardStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	status := s.status
+	status.ElapsedMillis = now.Sub(status.StartTime).Milliseconds()
+	if s.status.Current != nil {
+		current := *s.status.Current
+		current.ElapsedMillis = now.Sub(current.StartTime).Milliseconds()
+		current.OutputTail = string(s.outputBuf)
+		status.Current = &current
+	}
+	return status
+}
+
+func (s *shardStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(s.snapshot())
+}
+
+// serveShardStatus serves the shard's status as JSON at /status on addr until
+// ctx is canceled. It returns the address that the server listens on.
+func serveShardStatus(ctx context.Context, addr string, s *shardStatus) (net.Addr, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/status", s)
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Warningf(ctx, "status server stopped: %s", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	return l.Addr(), nil
+}
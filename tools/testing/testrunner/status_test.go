@@ -0,0 +1,111 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/clock"
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+func TestShardStatus(t *testing.T) {
+	fakeClock := clock.NewFakeClock()
+	ctx, cancel := context.WithCancel(clock.NewContext(context.Background(), fakeClock))
+	defer cancel()
+
+	status := newShardStatus(ctx, 2)
+	addr, err := serveShardStatus(ctx, "localhost:0", status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func() ShardStatus {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("http://%s/status", addr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var s ShardStatus
+		if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	status.startTest("foo", 0)
+	status.finishTest(runtests.TestFailure)
+	fakeClock.Advance(time.Second)
+	status.startTest("bar", 1)
+	fmt.Fprint(status, strings.Repeat("a", maxStatusOutputTail))
+	fmt.Fprint(status, "last line\n")
+	fakeClock.Advance(2 * time.Second)
+
+	got := get()
+	if got.TestsTotal != 2 || got.RunsCompleted != 1 || got.RunsFailed != 1 || got.LastFailedTest != "foo" {
+		t.Errorf("got status %+v, want one failed run of foo out of 2 tests", got)
+	}
+	if got.ElapsedMillis != 3000 {
+		t.Errorf("got %dms elapsed, want 3000ms", got.ElapsedMillis)
+	}
+	if got.Current == nil {
+		t.Fatalf("got no running test, want bar")
+	}
+	if got.Current.Name != "bar" || got.Current.RunIndex != 1 || got.Current.ElapsedMillis != 2000 {
+		t.Errorf("got running test %+v, want run 1 of bar running for 2000ms", got.Current)
+	}
+	if len(got.Current.OutputTail) != maxStatusOutputTail || !strings.HasSuffix(got.Current.OutputTail, "last line\n") {
+		t.Errorf("got %d bytes of output ending in %q, want the last %d bytes", len(got.Current.OutputTail), got.Current.OutputTail[len(got.Current.OutputTail)-10:], maxStatusOutputTail)
+	}
+
+	status.finishTest(runtests.TestSuccess)
+	// Output written between tests is not attributed to either.
+	fmt.Fprint(status, "stray output")
+	if got := get(); got.Current != nil || got.RunsCompleted != 2 {
+		t.Errorf("got status %+v, want no running test after 2 runs", got)
+	}
+
+	// A nil status, used when the server is disabled, ignores updates.
+	var nilStatus *shardStatus
+	nilStatus.startTest("foo", 0)
+	nilStatus.finishTest(runtests.TestSuccess)
+	nilStatus.startBatch(2, 0)
+	nilStatus.recordBatchResult("foo", runtests.TestSuccess)
+	nilStatus.finishBatch()
+	if _, err := nilStatus.Write([]byte("output")); err != nil {
+		t.Errorf("Write to a nil status failed: %s", err)
+	}
+}
+
+func TestShardStatusBatch(t *testing.T) {
+	fakeClock := clock.NewFakeClock()
+	ctx := clock.NewContext(context.Background(), fakeClock)
+	status := newShardStatus(ctx, 3)
+
+	status.startBatch(3, 0)
+	fmt.Fprint(status, "batch output\n")
+	got := status.snapshot()
+	if got.Current == nil || got.Current.Name != "batch of 3 tests run by ffx" || got.Current.OutputTail != "batch output\n" {
+		t.Errorf("got running test %+v, want the batch with its output", got.Current)
+	}
+	status.finishBatch()
+	status.recordBatchResult("foo", runtests.TestSuccess)
+	status.recordBatchResult("bar", runtests.TestFailure)
+	status.recordBatchResult("baz", runtests.TestSuccess)
+
+	got = status.snapshot()
+	if got.Current != nil {
+		t.Errorf("got running test %+v after the batch finished, want none", got.Current)
+	}
+	if got.RunsCompleted != 3 || got.RunsFailed != 1 || got.LastFailedTest != "bar" {
+		t.Errorf("got status %+v, want one failed run of bar out of 3 runs", got)
+	}
+}
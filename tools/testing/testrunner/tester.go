@@ -19,6 +19,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -74,12 +75,40 @@ const (
 	llvmProfileExtension = ".profraw"
 	llvmProfileSinkType  = "llvm-profile"
 
+	// Environment variables of Bazel's test sharding protocol, passed to host
+	// tests that testsharder split into parts.
+	testTotalShardsEnvKey     = "TEST_TOTAL_SHARDS"
+	testShardIndexEnvKey      = "TEST_SHARD_INDEX"
+	testShardStatusFileEnvKey = "TEST_SHARD_STATUS_FILE"
+	// The name of the file in a test's output directory that the test
+	// touches to acknowledge that it supports test sharding.
+	testShardStatusFileName = "test_shard_status"
+
 	testStartedTimeout = 5 * time.Second
 
 	// The name of the test to associate early boot data sinks with.
 	earlyBootSinksTestName = "early_boot_sinks"
+
+	// How long to wait for the target to accept commands again after
+	// rebooting it.
+	rebootTimeout = 5 * time.Minute
+
+	// Printed by the shell once the target accepts commands after a reboot.
+	serialReadyMarker = "testrunner-serial-ready"
+
+	// The name of the file in a test's output directory to which everything
+	// read from serial during the test is written.
+	serialLogFilename = "serial_log.txt"
 )
 
+// The command used to reboot the target.
+var rebootCommand = []string{"dm", "reboot"}
+
+// How long to wait after requesting a reboot before trying to reach the
+// target again, so as not to reach it before it goes down. Exposed for
+// testability.
+var rebootSettleDelay = 10 * time.Second
+
 // Tester describes the interface for all different types of testers.
 type Tester interface {
 	Test(context.Context, testsharder.Test, io.Writer, io.Writer, string) (*TestResult, error)
@@ -103,6 +132,15 @@ var newTempDir = func(dir, pattern string) (string, error) {
 	return os.MkdirTemp(dir, pattern)
 }
 
+// recoverableTester is implemented by testers that can reboot the target and
+// reconnect to it after it becomes unresponsive.
+type recoverableTester interface {
+	Tester
+	// RebootAndReconnect reboots the target and waits until tests can be run
+	// on it again.
+	RebootAndReconnect(ctx context.Context) error
+}
+
 // For testability
 type sshClient interface {
 	Close()
@@ -115,6 +153,7 @@ type dataSinkCopier interface {
 	GetAllDataSinks(remoteDir string) ([]runtests.DataSink, error)
 	GetReferences(remoteDir string) (map[string]runtests.DataSinkReference, error)
 	Copy(sinks []runtests.DataSinkReference, localDir string) (runtests.DataSinkMap, error)
+	CopyBatch(ctx context.Context, sinks []runtests.DataSinkReference, localDir string) (runtests.DataSinkMap, error)
 	Reconnect() error
 	Close() error
 }
@@ -122,6 +161,17 @@ type dataSinkCopier interface {
 // For testability
 type serialClient interface {
 	runDiagnostics(ctx context.Context) error
+	reboot(ctx context.Context) error
+}
+
+// sleep waits for d or until ctx is canceled.
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-clock.After(ctx, d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // BaseTestResultFromTest returns a TestResult for a Tester.Test() to modify
@@ -206,26 +256,44 @@ func (t *SubprocessTester) Test(ctx context.Context, test testsharder.Test, stdo
 	profileAbsDir := filepath.Join(t.localOutputDir, profileRelDir)
 	os.MkdirAll(profileAbsDir, os.ModePerm)
 
-	r := newRunner(t.dir, append(
+	shardEnv := testShardEnv(test, outDir)
+	env := append(
 		t.env,
 		fmt.Sprintf("%s=%s", constants.TestOutDirEnvKey, outDir),
 		// When host-side tests are instrumented for profiling, executing
 		// them will write a profile to the location under this environment variable.
 		fmt.Sprintf("%s=%s", llvmProfileEnvKey, filepath.Join(profileAbsDir, "%m"+llvmProfileExtension)),
-	))
-	if test.Timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, test.Timeout)
-		defer cancel()
+	)
+	for k, v := range shardEnv {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	r := newRunner(t.dir, env)
+	// run runs cmd, which is either the test or one of its setup and teardown
+	// binaries, each with the test's timeout. runTestOnce allows for this
+	// when it enforces the overall timeout.
+	run := func(cmd []string, usage *subprocess.ResourceUsage) error {
+		ctx := ctx
+		if test.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, test.Timeout)
+			defer cancel()
+		}
+		return r.Run(ctx, cmd, subprocess.RunOptions{Stdout: stdout, Stderr: stderr, ResourceUsage: usage})
+	}
+	// wrapCmd wraps cmd in the sandbox, if any.
+	wrapCmd := func(cmd []string) ([]string, error) {
+		return cmd, nil
+	}
+	if test.Sandboxed && t.sProps == nil {
+		logger.Warningf(ctx, "test %s requests a sandbox but testrunner wasn't given nsjail, so it will share the host's network", test.Name)
 	}
-	testCmd := []string{test.Path}
 	if t.sProps != nil {
 		testCmdBuilder := &NsJailCmdBuilder{
 			Bin: t.sProps.nsjailPath,
-			// TODO(rudymathu): Eventually, this should be a more fine grained
-			// property that disables network isolation only on tests that explicitly
-			// request it.
-			IsolateNetwork: false,
+			// Only tests that opt in get their own network namespace, as
+			// many tests need to reach emulators or devices over the host's
+			// network.
+			IsolateNetwork: test.Sandboxed,
 			MountPoints: []*MountPt{
 				{
 					Src:      t.localOutputDir,
@@ -335,6 +403,9 @@ func (t *SubprocessTester) Test(ctx context.Context, test testsharder.Test, stdo
 		for _, key := range environment.TempDirEnvVars() {
 			envOverrides[key] = "/tmp"
 		}
+		for k, v := range shardEnv {
+			envOverrides[k] = v
+		}
 		testCmdBuilder.ForwardEnv(envOverrides)
 
 		// Set the root of the NsJail and the working directory.
@@ -406,19 +477,64 @@ func (t *SubprocessTester) Test(ctx context.Context, test testsharder.Test, stdo
 			}
 		}
 		testCmdBuilder.AddDefaultMounts()
-		testCmd, err = testCmdBuilder.Build(testCmd)
+		wrapCmd = testCmdBuilder.Build
+	}
+	testCmd, err := wrapCmd([]string{test.Path})
+	if err != nil {
+		testResult.FailReason = err.Error()
+		return testResult, nil
+	}
+	// runCompanion runs the setup or teardown binary at path, if set.
+	runCompanion := func(path string) error {
+		if path == "" {
+			return nil
+		}
+		cmd, err := wrapCmd([]string{path})
 		if err != nil {
-			testResult.FailReason = err.Error()
-			return testResult, nil
+			return err
 		}
+		return run(cmd, nil)
 	}
-	err := r.Run(ctx, testCmd, subprocess.RunOptions{Stdout: stdout, Stderr: stderr})
-	if err == nil {
-		testResult.Result = runtests.TestSuccess
-	} else if errors.Is(err, context.DeadlineExceeded) {
+
+	if err := runCompanion(test.SetupPath); errors.Is(err, context.DeadlineExceeded) {
 		testResult.Result = runtests.TestAborted
+		testResult.FailReason = fmt.Sprintf("setup %s timed out", test.SetupPath)
+	} else if err != nil {
+		testResult.FailReason = fmt.Sprintf("setup %s failed: %s", test.SetupPath, err)
 	} else {
-		testResult.FailReason = err.Error()
+		var usage subprocess.ResourceUsage
+		err := run(testCmd, &usage)
+		if usage != (subprocess.ResourceUsage{}) {
+			// When sandboxed, this also covers the test since nsjail waits for it.
+			testResult.ResourceUsage = &runtests.ResourceUsage{
+				UserCPUMillis:   usage.UserTime.Milliseconds(),
+				SystemCPUMillis: usage.SystemTime.Milliseconds(),
+				MaxRSSBytes:     usage.MaxRSS,
+			}
+		}
+		if err == nil {
+			testResult.Result = runtests.TestSuccess
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			testResult.Result = runtests.TestAborted
+		} else {
+			testResult.FailReason = err.Error()
+		}
+	}
+	// The teardown runs even if the setup or the test failed, so that it can
+	// clean up after them.
+	if err := runCompanion(test.TeardownPath); err != nil {
+		if testResult.Result == runtests.TestSuccess {
+			testResult.Result = runtests.TestFailure
+			testResult.FailReason = fmt.Sprintf("teardown %s failed: %s", test.TeardownPath, err)
+		} else {
+			logger.Warningf(ctx, "teardown %s of test %s failed: %s", test.TeardownPath, test.Name, err)
+		}
+	}
+	if statusFile, ok := shardEnv[testShardStatusFileEnvKey]; ok {
+		if _, err := os.Stat(statusFile); err != nil {
+			logger.Warningf(ctx, "test %s was split into %d parts but didn't acknowledge %s, so each part may have run all of its test cases",
+				test.Name, test.TestTotalShards, testShardStatusFileEnvKey)
+		}
 	}
 
 	var sinks []runtests.DataSink
@@ -449,6 +565,19 @@ func (t *SubprocessTester) Test(ctx context.Context, test testsharder.Test, stdo
 	return testResult, nil
 }
 
+// testShardEnv returns the environment variables telling a test which part of
+// it to run, if testsharder split it into parts.
+func testShardEnv(test testsharder.Test, outDir string) map[string]string {
+	if test.TestTotalShards <= 0 {
+		return nil
+	}
+	return map[string]string{
+		testTotalShardsEnvKey:     strconv.Itoa(test.TestTotalShards),
+		testShardIndexEnvKey:      strconv.Itoa(test.TestShardIndex),
+		testShardStatusFileEnvKey: filepath.Join(outDir, testShardStatusFileName),
+	}
+}
+
 func (t *SubprocessTester) EnsureSinks(ctx context.Context, sinkRefs []runtests.DataSinkReference, _ *TestOutputs) error {
 	// Nothing to actually copy; if any profiles were emitted, they would have
 	// been written directly to the output directory. We verify here that all
@@ -498,6 +627,18 @@ func (s *serialSocket) runDiagnostics(ctx context.Context) error {
 	return serial.RunDiagnostics(ctx, socket)
 }
 
+func (s *serialSocket) reboot(ctx context.Context) error {
+	if s.socketPath == "" {
+		return fmt.Errorf("serialSocketPath not set")
+	}
+	socket, err := serial.NewSocket(ctx, s.socketPath)
+	if err != nil {
+		return fmt.Errorf("newSerialSocket failed: %w", err)
+	}
+	defer socket.Close()
+	return serial.RunCommands(ctx, socket, []serial.Command{{Cmd: rebootCommand}})
+}
+
 // for testability
 type FFXInstance interface {
 	SetStdoutStderr(stdout, stderr io.Writer)
@@ -581,6 +722,7 @@ func (t *FFXTester) TestMultiple(ctx context.Context, tests []testsharder.Test,
 					TimeoutSeconds:  int(test.Timeout.Seconds()),
 					Parallel:        test.Parallel,
 					MaxSeverityLogs: test.LogSettings.MaxSeverity,
+					TestFilters:     test.TestFilters,
 				},
 				Tags: test.Tags,
 			})
@@ -893,30 +1035,6 @@ func (t *FFXTester) RunSnapshot(ctx context.Context, snapshotFile string) error
 	return err
 }
 
-func sshToTarget(ctx context.Context, addr net.IPAddr, sshKeyFile string) (*sshutil.Client, error) {
-	key, err := os.ReadFile(sshKeyFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read SSH key file: %w", err)
-	}
-	config, err := sshutil.DefaultSSHConfig(key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create an SSH client config: %w", err)
-	}
-
-	return sshutil.NewClient(
-		ctx,
-		sshutil.ConstantAddrResolver{
-			Addr: &net.TCPAddr{
-				IP:   addr.IP,
-				Port: sshutil.SSHPort,
-				Zone: addr.Zone,
-			},
-		},
-		config,
-		sshutil.DefaultConnectBackoff(),
-	)
-}
-
 // FuchsiaSSHTester executes fuchsia tests over an SSH connection.
 type FuchsiaSSHTester struct {
 	client                      sshClient
@@ -925,18 +1043,29 @@ type FuchsiaSSHTester struct {
 	localOutputDir              string
 	connectionErrorRetryBackoff retry.Backoff
 	serialSocket                serialClient
+	// batchCopyFailed is set once copying data sinks in a batch fails for a
+	// reason other than a lost connection, e.g. because the target has no
+	// tar, after which they are only copied one file at a time.
+	batchCopyFailed bool
 }
 
 // NewFuchsiaSSHTester returns a FuchsiaSSHTester associated to a fuchsia
 // instance of given nodename, the private key paired with an authorized one
 // and the directive of whether `runtests` should be used to execute the test.
 func NewFuchsiaSSHTester(ctx context.Context, addr net.IPAddr, sshKeyFile, localOutputDir, serialSocketPath string, useRuntests bool) (Tester, error) {
-	client, err := sshToTarget(ctx, addr, sshKeyFile)
+	return newFuchsiaSSHTester(ctx, newSSHConnector(sshutil.KeepaliveConfig{}, false), addr, sshKeyFile, localOutputDir, serialSocketPath, useRuntests)
+}
+
+// newFuchsiaSSHTester is like NewFuchsiaSSHTester, but connects to the target
+// with connector.
+func newFuchsiaSSHTester(ctx context.Context, connector *sshConnector, addr net.IPAddr, sshKeyFile, localOutputDir, serialSocketPath string, useRuntests bool) (Tester, error) {
+	client, err := connector.connect(ctx, addr, sshKeyFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to establish an SSH connection: %w", err)
 	}
-	copier, err := runtests.NewDataSinkCopier(client)
+	copier, err := runtests.NewDataSinkCopier(client.Client)
 	if err != nil {
+		client.Close()
 		return nil, err
 	}
 	return &FuchsiaSSHTester{
@@ -1031,7 +1160,7 @@ func (t *FuchsiaSSHTester) Test(ctx context.Context, test testsharder.Test, stdo
 		// If we continue to experience a connection error after several retries
 		// then the device has likely become unresponsive and there's no use in
 		// continuing to try to run tests, so mark the error as fatal.
-		return nil, testErr
+		return nil, classifyError(runtests.FailureClassDeviceUnresponsive, testErr)
 	}
 
 	if t.isTimeoutError(test, testErr) {
@@ -1117,9 +1246,25 @@ func (t *FuchsiaSSHTester) copySinks(ctx context.Context, sinkRefs []runtests.Da
 		}
 		startTime := clock.Now(ctx)
 
-		// Copy() is assumed to be idempotent and thus safe to retry, which is
-		// the case for the SFTP-based data sink copier.
-		sinkMap, err := t.copier.Copy(sinkRefs, localOutputDir)
+		// CopyBatch() and Copy() are assumed to be idempotent and thus safe to
+		// retry, which is the case for the tar and SFTP-based data sink copier.
+		var sinkMap runtests.DataSinkMap
+		var err error
+		if !t.batchCopyFailed {
+			sinkMap, err = t.copier.CopyBatch(ctx, sinkRefs, localOutputDir)
+			if err != nil {
+				if sshutil.IsConnectionError(err) {
+					logger.Warningf(ctx, "connection lost while downlading data sinks: %s", err)
+					disconnected = true
+					return err
+				}
+				logger.Warningf(ctx, "failed to download data sinks in a batch, copying each file from now on: %s", err)
+				t.batchCopyFailed = true
+			}
+		}
+		if t.batchCopyFailed {
+			sinkMap, err = t.copier.Copy(sinkRefs, localOutputDir)
+		}
 		if err != nil {
 			if errors.Is(err, sftp.ErrSSHFxConnectionLost) {
 				logger.Warningf(ctx, "connection lost while downlading data sinks: %s", err)
@@ -1164,6 +1309,33 @@ func (t *FuchsiaSSHTester) RunSnapshot(ctx context.Context, snapshotFile string)
 	return err
 }
 
+// RebootAndReconnect reboots the device over serial, or over SSH if serial
+// isn't available, and then reestablishes the SSH connection.
+func (t *FuchsiaSSHTester) RebootAndReconnect(ctx context.Context) error {
+	if err := t.serialSocket.reboot(ctx); err != nil {
+		logger.Warningf(ctx, "failed to reboot over serial, rebooting over SSH: %s", err)
+		rebootCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		// The connection is expected to drop as the device reboots.
+		if err := t.client.Run(rebootCtx, rebootCommand, io.Discard, io.Discard); err != nil && !sshutil.IsConnectionError(err) {
+			return fmt.Errorf("failed to reboot the device: %w", err)
+		}
+	}
+	if err := sleep(ctx, rebootSettleDelay); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, rebootTimeout)
+	defer cancel()
+	return retry.Retry(ctx, retry.NewConstantBackoff(5*time.Second), func() error {
+		return t.reconnect(ctx)
+	}, nil)
+}
+
+// runTriageCommand runs a command on the device to collect a triage artifact.
+func (t *FuchsiaSSHTester) runTriageCommand(ctx context.Context, command []string, stdout io.Writer) error {
+	return t.runSSHCommandWithRetry(ctx, command, stdout, os.Stderr)
+}
+
 // Close terminates the underlying SSH connection. The object is no longer
 // usable after calling this method.
 func (t *FuchsiaSSHTester) Close() error {
@@ -1207,6 +1379,36 @@ func (w *lastWriteSaver) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// timestampWriter is an io.Writer that prefixes each line written to the
+// underlying writer with the time at which its first byte was written.
+type timestampWriter struct {
+	w   io.Writer
+	now func() time.Time
+	// midLine is true if the last byte written wasn't a newline.
+	midLine bool
+}
+
+func (w *timestampWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	var buf bytes.Buffer
+	for len(p) > 0 {
+		if !w.midLine {
+			fmt.Fprintf(&buf, "[%s] ", w.now().UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+		}
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line = p[:i+1]
+		}
+		buf.Write(line)
+		w.midLine = line[len(line)-1] != '\n'
+		p = p[len(line):]
+	}
+	if _, err := w.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 // parseOutKernelReader is an io.Reader that reads from the underlying reader
 // everything not pertaining to a kernel log. A kernel log is distinguished by
 // a line that starts with the timestamp represented as a float inside brackets.
@@ -1344,7 +1546,7 @@ func (r *parseOutKernelReader) lineWithoutKernelLog(line []byte, isTruncated boo
 	return line
 }
 
-func (t *FuchsiaSerialTester) Test(ctx context.Context, test testsharder.Test, stdout, _ io.Writer, _ string) (*TestResult, error) {
+func (t *FuchsiaSerialTester) Test(ctx context.Context, test testsharder.Test, stdout, _ io.Writer, outDir string) (*TestResult, error) {
 	testResult := BaseTestResultFromTest(test)
 	command, err := commandForTest(&test, true, "", test.Timeout)
 	if err != nil {
@@ -1353,6 +1555,19 @@ func (t *FuchsiaSerialTester) Test(ctx context.Context, test testsharder.Test, s
 	}
 	logger.Debugf(ctx, "starting: %s", command)
 
+	// Serial is often the only diagnostics channel, so keep everything read
+	// from it during the test, including the kernel logs filtered out of
+	// stdout.
+	var socket io.Reader = t.socket
+	if serialLog, err := osmisc.CreateFile(filepath.Join(outDir, serialLogFilename)); err != nil {
+		logger.Warningf(ctx, "failed to create serial log: %s", err)
+	} else {
+		defer serialLog.Close()
+		socket = io.TeeReader(t.socket, &timestampWriter{w: serialLog, now: time.Now})
+		testResult.OutputFiles = []string{serialLogFilename}
+		testResult.OutputDir = outDir
+	}
+
 	// TODO(fxbug.dev/86771): Currently, serial output is coming out jumbled,
 	// so the started string sometimes comes after the completed string, resulting
 	// in a timeout because we fail to read the completed string after the
@@ -1364,12 +1579,12 @@ func (t *FuchsiaSerialTester) Test(ctx context.Context, test testsharder.Test, s
 	// completion. Thus we save the last read from the socket and replay it when searching for completion.
 	// lastWrite := &lastWriteSaver{}
 	t.socket.SetIOTimeout(testStartedTimeout)
-	reader := io.TeeReader(t.socket, &lastWrite)
+	reader := io.TeeReader(socket, &lastWrite)
 	commandStarted := false
 	var readErr error
 	for i := 0; i < startSerialCommandMaxAttempts; i++ {
 		if err := serial.RunCommands(ctx, t.socket, []serial.Command{{Cmd: command}}); err != nil {
-			return nil, fmt.Errorf("failed to write to serial socket: %w", err)
+			return nil, classifyError(runtests.FailureClassConnection, fmt.Errorf("failed to write to serial socket: %w", err))
 		}
 		startedCtx, cancel := newTestStartedContext(ctx)
 		startedStr := runtests.StartedSignature + test.Name
@@ -1389,13 +1604,13 @@ func (t *FuchsiaSerialTester) Test(ctx context.Context, test testsharder.Test, s
 			constants.FailedToStartSerialTestMsg, startSerialCommandMaxAttempts, readErr)
 		// In practice, repeated failure to run a test means that the device has
 		// become unresponsive and we won't have any luck running later tests.
-		return nil, err
+		return nil, classifyError(runtests.FailureClassDeviceUnresponsive, err)
 	}
 
 	t.socket.SetIOTimeout(test.Timeout + 30*time.Second)
 	testOutputReader := io.TeeReader(
 		// See comment above lastWrite declaration.
-		&parseOutKernelReader{ctx: ctx, reader: io.MultiReader(&lastWrite, t.socket)},
+		&parseOutKernelReader{ctx: ctx, reader: io.MultiReader(&lastWrite, socket)},
 		// Writes to stdout as it reads from the above reader.
 		stdout)
 	if success, err := runtests.TestPassed(ctx, testOutputReader, test.Name); err != nil {
@@ -1406,7 +1621,7 @@ func (t *FuchsiaSerialTester) Test(ctx context.Context, test testsharder.Test, s
 			// EOF indicates that serial has become disconnected. That is
 			// unlikely to be caused by this test and we're unlikely to be able
 			// to keep running tests.
-			return nil, err
+			return nil, classifyError(runtests.FailureClassDeviceUnresponsive, err)
 		}
 		testResult.FailReason = "test failed"
 		return testResult, nil
@@ -1415,6 +1630,39 @@ func (t *FuchsiaSerialTester) Test(ctx context.Context, test testsharder.Test, s
 	return testResult, nil
 }
 
+// RebootAndReconnect reboots the device over serial and waits until the
+// shell accepts commands again.
+func (t *FuchsiaSerialTester) RebootAndReconnect(ctx context.Context) error {
+	if err := serial.RunCommands(ctx, t.socket, []serial.Command{{Cmd: rebootCommand}}); err != nil {
+		return fmt.Errorf("failed to write to serial socket: %w", err)
+	}
+	if err := sleep(ctx, rebootSettleDelay); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, rebootTimeout)
+	defer cancel()
+	return waitForSerialShell(ctx, t.socket)
+}
+
+// waitForSerialShell waits until the shell on the other end of socket runs
+// commands.
+func waitForSerialShell(ctx context.Context, socket socketConn) error {
+	// The marker is split into two quoted halves that the shell joins back
+	// together, so that the console's echo of the command itself doesn't match.
+	half := len(serialReadyMarker) / 2
+	cmd := []string{"echo", fmt.Sprintf("%q%q", serialReadyMarker[:half], serialReadyMarker[half:])}
+	socket.SetIOTimeout(testStartedTimeout)
+	return retry.Retry(ctx, retry.NewConstantBackoff(time.Second), func() error {
+		if err := serial.RunCommands(ctx, socket, []serial.Command{{Cmd: cmd}}); err != nil {
+			return fmt.Errorf("failed to write to serial socket: %w", err)
+		}
+		readyCtx, cancel := newTestStartedContext(ctx)
+		defer cancel()
+		_, err := iomisc.ReadUntilMatchString(readyCtx, socket, serialReadyMarker)
+		return err
+	}, nil)
+}
+
 func (t *FuchsiaSerialTester) EnsureSinks(_ context.Context, _ []runtests.DataSinkReference, _ *TestOutputs) error {
 	return nil
 }
@@ -1461,6 +1709,9 @@ func commandForTest(test *testsharder.Test, useRuntests bool, remoteOutputDir st
 			if timeout > 0 {
 				command = append(command, "--timeout", fmt.Sprintf("%d", int64(timeout.Seconds())))
 			}
+			for _, filter := range test.TestFilters {
+				command = append(command, "--test-filter", filter)
+			}
 		} else {
 			command = []string{runTestComponentName}
 			if test.LogSettings.MaxSeverity != "" {
@@ -63,7 +63,8 @@ func (c *fakeSSHClient) Reconnect(_ context.Context) error {
 }
 
 type fakeSerialClient struct {
-	runCalls int
+	runCalls    int
+	rebootCalls int
 }
 
 func (c *fakeSerialClient) runDiagnostics(_ context.Context) error {
@@ -71,15 +72,26 @@ func (c *fakeSerialClient) runDiagnostics(_ context.Context) error {
 	return nil
 }
 
+func (c *fakeSerialClient) reboot(_ context.Context) error {
+	c.rebootCalls++
+	return nil
+}
+
 type fakeCmdRunner struct {
-	runErrs  []error
-	runCalls int
-	lastCmd  []string
+	runErrs       []error
+	runCalls      int
+	lastCmd       []string
+	cmds          [][]string
+	resourceUsage subprocess.ResourceUsage
 }
 
-func (r *fakeCmdRunner) Run(_ context.Context, command []string, _ subprocess.RunOptions) error {
+func (r *fakeCmdRunner) Run(_ context.Context, command []string, options subprocess.RunOptions) error {
 	r.runCalls++
 	r.lastCmd = command
+	r.cmds = append(r.cmds, command)
+	if options.ResourceUsage != nil {
+		*options.ResourceUsage = r.resourceUsage
+	}
 	if r.runErrs == nil {
 		return nil
 	}
@@ -109,6 +121,104 @@ func TestSubprocessTester(t *testing.T) {
 		return "/newtmp", nil
 	}
 
+	// wantNsjailCmd returns the command expected to run passingTest with host
+	// test sandboxing.
+	wantNsjailCmd := func(isolateNetwork bool) []string {
+		cmd := []string{
+			"./fake_nsjail",
+			"--disable_clone_newcgroup",
+			"--quiet",
+			"--bindmount_ro",
+			"/bin:/bin",
+			"--bindmount_ro",
+			"/dev/kvm:/dev/kvm",
+			"--bindmount_ro",
+			"/dev/net/tun:/dev/net/tun",
+			"--bindmount",
+			"/dev/null:/dev/null",
+			"--bindmount_ro",
+			"/dev/urandom:/dev/urandom",
+			"--bindmount_ro",
+			"/dev/zero:/dev/zero",
+			"--bindmount_ro",
+			"/etc/alternatives/awk:/etc/alternatives/awk",
+			"--bindmount_ro",
+			"/etc/host.conf:/etc/host.conf",
+			"--bindmount_ro",
+			"/etc/hosts:/etc/hosts",
+			"--bindmount_ro",
+			"/etc/nsswitch.conf:/etc/nsswitch.conf",
+			"--bindmount_ro",
+			"/etc/passwd:/etc/passwd",
+			"--bindmount_ro",
+			"/etc/resolv.conf:/etc/resolv.conf",
+			"--bindmount_ro",
+			"/etc/ssl/certs:/etc/ssl/certs",
+			"--bindmount_ro",
+			"/lib:/lib",
+			"--bindmount_ro",
+			"/lib64:/lib64",
+			"--bindmount",
+			"/newtmp:/tmp",
+			"--bindmount",
+			fmt.Sprintf("%s:%s", tmpDir, tmpDir),
+			"--bindmount",
+			fmt.Sprintf("%s/host_x64/passing:%s/host_x64/passing", tmpDir, tmpDir),
+			"--bindmount_ro",
+			"/usr/bin:/usr/bin",
+			"--bindmount_ro",
+			"/usr/lib:/usr/lib",
+			"--bindmount_ro",
+			"/usr/share/misc/magic.mgc:/usr/share/misc/magic.mgc",
+			"--bindmount_ro",
+			"/usr/share/tcltk:/usr/share/tcltk",
+			"--bindmount_ro",
+			"/usr/share/vulkan:/usr/share/vulkan",
+			"--symlink",
+			"/proc/self/fd:/dev/fd",
+			"--rlimit_as",
+			"soft",
+			"--rlimit_fsize",
+			"soft",
+			"--rlimit_nofile",
+			"soft",
+			"--rlimit_nproc",
+			"soft",
+			"--env",
+			"ANDROID_TMP=/tmp",
+			"--env",
+			fmt.Sprintf("FUCHSIA_TEST_OUTDIR=%s/host_x64/passing", tmpDir),
+			"--env",
+			"HOME=/tmp",
+			"--env",
+			fmt.Sprintf("LLVM_PROFILE_FILE=%s/llvm-profile/host_x64/passing/%%m.profraw", tmpDir),
+			"--env",
+			"TEMP=/tmp",
+			"--env",
+			"TEMPDIR=/tmp",
+			"--env",
+			"TMP=/tmp",
+			"--env",
+			"TMPDIR=/tmp",
+			"--env",
+			"XDG_CACHE_HOME=/tmp",
+			"--env",
+			"XDG_CONFIG_HOME=/tmp",
+			"--env",
+			"XDG_DATA_HOME=/tmp",
+			"--env",
+			"XDG_HOME=/tmp",
+			"--env",
+			"XDG_STATE_HOME=/tmp",
+			"--",
+			passingTest,
+		}
+		if !isolateNetwork {
+			cmd = append(cmd, "--disable_clone_newnet")
+		}
+		return cmd
+	}
+
 	cases := []struct {
 		name           string
 		test           build.Test
@@ -146,96 +256,25 @@ func TestSubprocessTester(t *testing.T) {
 				llvmProfileEnvKey: "fake/llvm/profile/path/p.profraw",
 			},
 			expectedResult: runtests.TestSuccess,
-			wantCmd: []string{
-				"./fake_nsjail",
-				"--disable_clone_newcgroup",
-				"--disable_clone_newnet",
-				"--quiet",
-				"--bindmount_ro",
-				"/bin:/bin",
-				"--bindmount_ro",
-				"/dev/kvm:/dev/kvm",
-				"--bindmount_ro",
-				"/dev/net/tun:/dev/net/tun",
-				"--bindmount",
-				"/dev/null:/dev/null",
-				"--bindmount_ro",
-				"/dev/urandom:/dev/urandom",
-				"--bindmount_ro",
-				"/dev/zero:/dev/zero",
-				"--bindmount_ro",
-				"/etc/alternatives/awk:/etc/alternatives/awk",
-				"--bindmount_ro",
-				"/etc/host.conf:/etc/host.conf",
-				"--bindmount_ro",
-				"/etc/hosts:/etc/hosts",
-				"--bindmount_ro",
-				"/etc/nsswitch.conf:/etc/nsswitch.conf",
-				"--bindmount_ro",
-				"/etc/passwd:/etc/passwd",
-				"--bindmount_ro",
-				"/etc/resolv.conf:/etc/resolv.conf",
-				"--bindmount_ro",
-				"/etc/ssl/certs:/etc/ssl/certs",
-				"--bindmount_ro",
-				"/lib:/lib",
-				"--bindmount_ro",
-				"/lib64:/lib64",
-				"--bindmount",
-				"/newtmp:/tmp",
-				"--bindmount",
-				fmt.Sprintf("%s:%s", tmpDir, tmpDir),
-				"--bindmount",
-				fmt.Sprintf("%s/host_x64/passing:%s/host_x64/passing", tmpDir, tmpDir),
-				"--bindmount_ro",
-				"/usr/bin:/usr/bin",
-				"--bindmount_ro",
-				"/usr/lib:/usr/lib",
-				"--bindmount_ro",
-				"/usr/share/misc/magic.mgc:/usr/share/misc/magic.mgc",
-				"--bindmount_ro",
-				"/usr/share/tcltk:/usr/share/tcltk",
-				"--bindmount_ro",
-				"/usr/share/vulkan:/usr/share/vulkan",
-				"--symlink",
-				"/proc/self/fd:/dev/fd",
-				"--rlimit_as",
-				"soft",
-				"--rlimit_fsize",
-				"soft",
-				"--rlimit_nofile",
-				"soft",
-				"--rlimit_nproc",
-				"soft",
-				"--env",
-				"ANDROID_TMP=/tmp",
-				"--env",
-				fmt.Sprintf("FUCHSIA_TEST_OUTDIR=%s/host_x64/passing", tmpDir),
-				"--env",
-				"HOME=/tmp",
-				"--env",
-				fmt.Sprintf("LLVM_PROFILE_FILE=%s/llvm-profile/host_x64/passing/%%m.profraw", tmpDir),
-				"--env",
-				"TEMP=/tmp",
-				"--env",
-				"TEMPDIR=/tmp",
-				"--env",
-				"TMP=/tmp",
-				"--env",
-				"TMPDIR=/tmp",
-				"--env",
-				"XDG_CACHE_HOME=/tmp",
-				"--env",
-				"XDG_CONFIG_HOME=/tmp",
-				"--env",
-				"XDG_DATA_HOME=/tmp",
-				"--env",
-				"XDG_HOME=/tmp",
-				"--env",
-				"XDG_STATE_HOME=/tmp",
-				"--",
-				passingTest,
+			wantCmd:        wantNsjailCmd(false),
+			wantDataSinks: runtests.DataSinkMap{
+				"llvm-profile": []runtests.DataSink{
+					{
+						Name: filepath.Base(passingProfile),
+						File: passingProfile,
+					},
+				},
 			},
+		},
+		{
+			name:          "sandboxed test with host test sandboxing",
+			test:          build.Test{Path: passingTest, Sandboxed: true},
+			useSandboxing: true,
+			env: map[string]string{
+				llvmProfileEnvKey: "fake/llvm/profile/path/p.profraw",
+			},
+			expectedResult: runtests.TestSuccess,
+			wantCmd:        wantNsjailCmd(true),
 			wantDataSinks: runtests.DataSinkMap{
 				"llvm-profile": []runtests.DataSink{
 					{
@@ -245,6 +284,13 @@ func TestSubprocessTester(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:           "sandboxed test without host test sandboxing",
+			test:           build.Test{Path: "uninstrumented_test", Sandboxed: true},
+			expectedResult: runtests.TestSuccess,
+			wantCmd:        []string{"uninstrumented_test"},
+			wantDataSinks:  nil,
+		},
 		{
 			name:           "test passes without profile",
 			test:           build.Test{Path: "uninstrumented_test"},
@@ -273,6 +319,11 @@ func TestSubprocessTester(t *testing.T) {
 		t.Run(c.name, func(t *testing.T) {
 			runner := &fakeCmdRunner{
 				runErrs: c.runErrs,
+				resourceUsage: subprocess.ResourceUsage{
+					UserTime:   1500 * time.Millisecond,
+					SystemTime: 250 * time.Millisecond,
+					MaxRSS:     1 << 20,
+				},
 			}
 			tester := SubprocessTester{
 				localOutputDir: tmpDir,
@@ -333,6 +384,18 @@ func TestSubprocessTester(t *testing.T) {
 			if diff := cmp.Diff(c.wantDataSinks, sinks); diff != "" {
 				t.Errorf("Diff in data sinks (-want +got):\n%s", diff)
 			}
+
+			var wantResourceUsage *runtests.ResourceUsage
+			if runner.runCalls > 0 {
+				wantResourceUsage = &runtests.ResourceUsage{
+					UserCPUMillis:   1500,
+					SystemCPUMillis: 250,
+					MaxRSSBytes:     1 << 20,
+				}
+			}
+			if diff := cmp.Diff(wantResourceUsage, testResult.ResourceUsage); diff != "" {
+				t.Errorf("Diff in resource usage (-want +got):\n%s", diff)
+			}
 		})
 	}
 }
@@ -340,8 +403,98 @@ func TestSubprocessTester(t *testing.T) {
 type fakeDataSinkCopier struct {
 	reconnectCalls int
 	remoteDirs     map[string]struct{}
+	// batchErr is returned by CopyBatch.
+	batchErr       error
+	copyCalls      int
+	copyBatchCalls int
 }
 
+func TestSubprocessTesterSetupTeardown(t *testing.T) {
+	const (
+		setupPath    = "host_x64/setup"
+		testPath     = "host_x64/test"
+		teardownPath = "host_x64/teardown"
+	)
+	testErr := errors.New("test failed")
+
+	cases := []struct {
+		name           string
+		test           build.Test
+		runErrs        []error
+		wantCmds       [][]string
+		expectedResult runtests.TestResult
+		wantFailReason string
+	}{
+		{
+			name:           "setup and teardown pass",
+			test:           build.Test{Path: testPath, SetupPath: setupPath, TeardownPath: teardownPath},
+			wantCmds:       [][]string{{setupPath}, {testPath}, {teardownPath}},
+			expectedResult: runtests.TestSuccess,
+		},
+		{
+			name:           "setup only",
+			test:           build.Test{Path: testPath, SetupPath: setupPath},
+			wantCmds:       [][]string{{setupPath}, {testPath}},
+			expectedResult: runtests.TestSuccess,
+		},
+		{
+			name:           "setup fails",
+			test:           build.Test{Path: testPath, SetupPath: setupPath, TeardownPath: teardownPath},
+			runErrs:        []error{testErr, nil},
+			wantCmds:       [][]string{{setupPath}, {teardownPath}},
+			expectedResult: runtests.TestFailure,
+			wantFailReason: fmt.Sprintf("setup %s failed: %s", setupPath, testErr),
+		},
+		{
+			name:           "setup times out",
+			test:           build.Test{Path: testPath, SetupPath: setupPath, TeardownPath: teardownPath},
+			runErrs:        []error{context.DeadlineExceeded, nil},
+			wantCmds:       [][]string{{setupPath}, {teardownPath}},
+			expectedResult: runtests.TestAborted,
+			wantFailReason: fmt.Sprintf("setup %s timed out", setupPath),
+		},
+		{
+			name:           "test fails",
+			test:           build.Test{Path: testPath, SetupPath: setupPath, TeardownPath: teardownPath},
+			runErrs:        []error{nil, testErr, testErr},
+			wantCmds:       [][]string{{setupPath}, {testPath}, {teardownPath}},
+			expectedResult: runtests.TestFailure,
+			wantFailReason: testErr.Error(),
+		},
+		{
+			name:           "teardown fails",
+			test:           build.Test{Path: testPath, TeardownPath: teardownPath},
+			runErrs:        []error{nil, testErr},
+			wantCmds:       [][]string{{testPath}, {teardownPath}},
+			expectedResult: runtests.TestFailure,
+			wantFailReason: fmt.Sprintf("teardown %s failed: %s", teardownPath, testErr),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			runner := &fakeCmdRunner{runErrs: c.runErrs}
+			newRunner = func(dir string, env []string) cmdRunner {
+				return runner
+			}
+			tmpDir := t.TempDir()
+			tester := SubprocessTester{localOutputDir: tmpDir}
+			testResult, err := tester.Test(context.Background(), testsharder.Test{Test: c.test}, io.Discard, io.Discard, filepath.Join(tmpDir, "out"))
+			if err != nil {
+				t.Fatalf("tester.Test got error: %s, want nil", err)
+			}
+			if diff := cmp.Diff(c.wantCmds, runner.cmds); diff != "" {
+				t.Errorf("Unexpected commands run (-want +got):\n%s", diff)
+			}
+			if testResult.Result != c.expectedResult {
+				t.Errorf("tester.Test got result: %s, want: %s", testResult.Result, c.expectedResult)
+			}
+			if testResult.FailReason != c.wantFailReason {
+				t.Errorf("tester.Test got fail reason: %q, want: %q", testResult.FailReason, c.wantFailReason)
+			}
+		})
+	}
+}
 func (c *fakeDataSinkCopier) GetAllDataSinks(remoteDir string) ([]runtests.DataSink, error) {
 	c.remoteDirs[remoteDir] = struct{}{}
 	return []runtests.DataSink{{Name: "sink", File: "sink"}}, nil
@@ -352,7 +505,16 @@ func (c *fakeDataSinkCopier) GetReferences(remoteDir string) (map[string]runtest
 	return map[string]runtests.DataSinkReference{}, nil
 }
 
-func (*fakeDataSinkCopier) Copy(_ []runtests.DataSinkReference, _ string) (runtests.DataSinkMap, error) {
+func (c *fakeDataSinkCopier) Copy(_ []runtests.DataSinkReference, _ string) (runtests.DataSinkMap, error) {
+	c.copyCalls++
+	return runtests.DataSinkMap{}, nil
+}
+
+func (c *fakeDataSinkCopier) CopyBatch(_ context.Context, _ []runtests.DataSinkReference, _ string) (runtests.DataSinkMap, error) {
+	c.copyBatchCalls++
+	if c.batchErr != nil {
+		return nil, c.batchErr
+	}
 	return runtests.DataSinkMap{}, nil
 }
 
@@ -365,6 +527,47 @@ func (*fakeDataSinkCopier) Close() error {
 	return nil
 }
 
+func TestCopySinksFallback(t *testing.T) {
+	ctx := context.Background()
+	copier := &fakeDataSinkCopier{
+		remoteDirs: make(map[string]struct{}),
+		batchErr:   errors.New("tar: not found"),
+	}
+	tester := &FuchsiaSSHTester{copier: copier}
+	for i := 0; i < 2; i++ {
+		if err := tester.copySinks(ctx, []runtests.DataSinkReference{{RemoteDir: "/tmp/sinks"}}, t.TempDir()); err != nil {
+			t.Fatalf("copySinks() failed: %s", err)
+		}
+	}
+	// The batch copy is only attempted until it first fails.
+	if copier.copyBatchCalls != 1 {
+		t.Errorf("got %d batch copies, want 1", copier.copyBatchCalls)
+	}
+	if copier.copyCalls != 2 {
+		t.Errorf("got %d file-by-file copies, want 2", copier.copyCalls)
+	}
+}
+
+func TestTestShardEnv(t *testing.T) {
+	outDir := filepath.Join("out", "test")
+	if env := testShardEnv(testsharder.Test{Test: build.Test{Path: "test"}}, outDir); env != nil {
+		t.Errorf("got test shard env %v for a test that wasn't split, want none", env)
+	}
+
+	test := testsharder.Test{
+		Test:            build.Test{Path: "test", SupportsTestSharding: true},
+		TestTotalShards: 3,
+	}
+	want := map[string]string{
+		testTotalShardsEnvKey:     "3",
+		testShardIndexEnvKey:      "0",
+		testShardStatusFileEnvKey: filepath.Join(outDir, testShardStatusFileName),
+	}
+	if diff := cmp.Diff(want, testShardEnv(test, outDir)); diff != "" {
+		t.Errorf("test shard env mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestFFXTester(t *testing.T) {
 	cases := []struct {
 		name            string
@@ -880,8 +1083,9 @@ func TestSerialTester(t *testing.T) {
 			}
 			results := make(chan testResult)
 			var stdout bytes.Buffer
+			outDir := t.TempDir()
 			go func() {
-				result, err := tester.Test(ctx, test, &stdout, io.Discard, "unused-out-dir")
+				result, err := tester.Test(ctx, test, &stdout, io.Discard, outDir)
 				results <- testResult{result, err}
 			}()
 
@@ -958,10 +1162,73 @@ func TestSerialTester(t *testing.T) {
 			if !tc.wantErr && !bytes.Contains(stdoutBytes, []byte(started+testReturn)) {
 				t.Errorf("Expected stdout to contain %q, got %q", started+testReturn, string(stdoutBytes))
 			}
+			if !tc.wantErr {
+				serialLog, err := os.ReadFile(filepath.Join(outDir, serialLogFilename))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Contains(serialLog, []byte(started+testReturn)) {
+					t.Errorf("Expected serial log to contain %q, got %q", started+testReturn, string(serialLog))
+				}
+			}
 		})
 	}
 }
 
+func TestWaitForSerialShell(t *testing.T) {
+	ctx := context.Background()
+	serial, socket := serialAndSocket()
+	defer socket.Close()
+	defer serial.Close()
+
+	errs := make(chan error)
+	go func() {
+		errs <- waitForSerialShell(ctx, socket)
+	}()
+
+	expectedCmd := "\r\necho \"testrunner-\"\"serial-ready\"\r\n"
+	buff := make([]byte, len(expectedCmd))
+	if _, err := io.ReadFull(serial, buff); err != nil {
+		t.Fatalf("error reading from serial: %s", err)
+	}
+	if string(buff) != expectedCmd {
+		t.Errorf("unexpected command: %q", buff)
+	}
+	if bytes.Contains(buff, []byte(serialReadyMarker)) {
+		t.Errorf("command %q contains the ready marker", buff)
+	}
+	// Echo the command back like the console does before the shell's output.
+	if _, err := serial.Write(append(buff, []byte(serialReadyMarker+"\r\n")...)); err != nil {
+		t.Fatalf("error writing to serial: %s", err)
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("waitForSerialShell() failed: %s", err)
+	}
+}
+
+func TestTimestampWriter(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2022, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	w := &timestampWriter{w: &buf, now: func() time.Time { return now }}
+	for _, write := range []string{"first ", "line\nsecond line\n", "", "third\n\n"} {
+		n, err := w.Write([]byte(write))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(write) {
+			t.Errorf("Write(%q) = %d, want %d", write, n, len(write))
+		}
+		now = now.Add(time.Second)
+	}
+	want := "[2022-01-02T03:04:05.006Z] first line\n" +
+		"[2022-01-02T03:04:06.006Z] second line\n" +
+		"[2022-01-02T03:04:08.006Z] third\n" +
+		"[2022-01-02T03:04:08.006Z] \n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
 func longKernelLog(numChars int) string {
 	kernelLog := "[123.456]"
 	for i := 0; i < numChars; i++ {
@@ -1208,6 +1475,18 @@ func TestCommandForTest(t *testing.T) {
 			timeout:  time.Second,
 			expected: []string{"run-test-suite", "--filter-ansi", "--timeout", "1", "fuchsia-pkg://example.com/test.cm"},
 		},
+		{
+			name:        "components v2 test filters",
+			useRuntests: false,
+			test: testsharder.Test{
+				Test: build.Test{
+					Path:       "/path/to/test",
+					PackageURL: "fuchsia-pkg://example.com/test.cm",
+				},
+				TestFilters: []string{"Foo.Bar", "Foo.Baz"},
+			},
+			expected: []string{"run-test-suite", "--filter-ansi", "--test-filter", "Foo.Bar", "--test-filter", "Foo.Baz", "fuchsia-pkg://example.com/test.cm"},
+		},
 	}
 
 	for _, c := range cases {
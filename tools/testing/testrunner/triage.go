@@ -0,0 +1,143 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"go.fuchsia.dev/fuchsia/tools/lib/clock"
+	"go.fuchsia.dev/fuchsia/tools/lib/logger"
+	"go.fuchsia.dev/fuchsia/tools/lib/osmisc"
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+// TriageIndexFilename is the name of the index written to the root of a
+// triage bundle.
+const TriageIndexFilename = "index.json"
+
+// triageCommand is a command run on the target whose stdout is saved in the
+// triage bundle.
+type triageCommand struct {
+	name     string
+	filename string
+	command  []string
+}
+
+var triageCommands = []triageCommand{
+	{
+		name:     "crash_reporter_inspect",
+		filename: "crash_reporter_inspect.json",
+		command:  []string{"/bin/iquery", "--format", "json", "show", "core/feedback:root/crash_reporter"},
+	},
+	{
+		name:     "kernel_log",
+		filename: "kernel_log.txt",
+		command:  []string{"/bin/dlog"},
+	},
+	{
+		name:     "warning_logs",
+		filename: "warning_logs.txt",
+		command:  []string{"/bin/log_listener", "--dump_logs", "yes", "--severity", "WARN"},
+	},
+	{
+		name:     "netstack_inspect",
+		filename: "netstack_inspect.json",
+		command:  []string{"/bin/iquery", "--format", "json", "show", "core/network/netstack"},
+	},
+}
+
+// triageCollector is implemented by testers that can run commands on the
+// target to collect triage artifacts.
+type triageCollector interface {
+	runTriageCommand(ctx context.Context, command []string, stdout io.Writer) error
+}
+
+// TriageArtifact describes one file in a triage bundle.
+type TriageArtifact struct {
+	Name string `json:"name"`
+	// File is the path of the artifact relative to the bundle. It is set even
+	// if collecting the artifact failed, in which case the file holds whatever
+	// was written before the failure.
+	File string `json:"file"`
+	// Error is the reason the artifact could not be collected, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// TriageIndex is the contents of a triage bundle's index file.
+type TriageIndex struct {
+	// FailedTests are the names of the tests that failed in the run.
+	FailedTests []string `json:"failed_tests"`
+	// Snapshot is the path of the run's snapshot relative to the bundle, if
+	// one was taken.
+	Snapshot  string           `json:"snapshot,omitempty"`
+	Artifacts []TriageArtifact `json:"artifacts"`
+}
+
+// failedTests returns the names of the tests in summary that failed, in
+// order and without duplicates.
+func failedTests(summary runtests.TestSummary) []string {
+	var failed []string
+	seen := make(map[string]bool)
+	for _, test := range summary.Tests {
+		if runtests.IsFailure(test.Result) && !seen[test.Name] {
+			seen[test.Name] = true
+			failed = append(failed, test.Name)
+		}
+	}
+	return failed
+}
+
+// collectTriageBundle writes the output of each of triageCommands to
+// bundleDir within the output directory, along with an index of the failed
+// tests and collected artifacts. Failures to collect an artifact are recorded
+// in the index rather than returned, so that one unresponsive service doesn't
+// prevent the others from being collected.
+func collectTriageBundle(ctx context.Context, c triageCollector, outputs *TestOutputs, bundleDir, snapshotFile string) error {
+	startTime := clock.Now(ctx)
+	dir := filepath.Join(outputs.OutDir, bundleDir)
+	index := TriageIndex{
+		FailedTests: failedTests(outputs.Summary),
+	}
+	if snapshotFile != "" {
+		if _, err := os.Stat(filepath.Join(outputs.OutDir, snapshotFile)); err == nil {
+			index.Snapshot, _ = filepath.Rel(dir, filepath.Join(outputs.OutDir, snapshotFile))
+		}
+	}
+	for _, tc := range triageCommands {
+		artifact := TriageArtifact{Name: tc.name, File: tc.filename}
+		if err := runTriageCommand(ctx, c, tc, filepath.Join(dir, tc.filename)); err != nil {
+			logger.Warningf(ctx, "failed to collect %s for the triage bundle: %s", tc.name, err)
+			artifact.Error = err.Error()
+		}
+		index.Artifacts = append(index.Artifacts, artifact)
+	}
+
+	f, err := osmisc.CreateFile(filepath.Join(dir, TriageIndexFilename))
+	if err != nil {
+		return fmt.Errorf("failed to create triage bundle index: %w", err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(index); err != nil {
+		return fmt.Errorf("failed to write triage bundle index: %w", err)
+	}
+	logger.Debugf(ctx, "collected triage bundle in %s", clock.Now(ctx).Sub(startTime))
+	return nil
+}
+
+func runTriageCommand(ctx context.Context, c triageCollector, tc triageCommand, path string) error {
+	f, err := osmisc.CreateFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.runTriageCommand(ctx, tc.command, f)
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package testrunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/tools/testing/runtests"
+)
+
+type fakeTriageCollector struct {
+	// failing is the name of a binary whose commands fail.
+	failing  string
+	commands [][]string
+}
+
+func (c *fakeTriageCollector) runTriageCommand(_ context.Context, command []string, stdout io.Writer) error {
+	c.commands = append(c.commands, command)
+	if command[0] == c.failing {
+		return fmt.Errorf("%s: not found", command[0])
+	}
+	_, err := io.WriteString(stdout, strings.Join(command, " "))
+	return err
+}
+
+func TestCollectTriageBundle(t *testing.T) {
+	outDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outDir, "snapshot.zip"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	outputs := &TestOutputs{
+		OutDir: outDir,
+		Summary: runtests.TestSummary{
+			Tests: []runtests.TestDetails{
+				{Name: "a", Result: runtests.TestFailure},
+				{Name: "b", Result: runtests.TestSuccess},
+				{Name: "a", Result: runtests.TestAborted},
+				{Name: "c", Result: runtests.TestSkipped},
+			},
+		},
+	}
+	c := &fakeTriageCollector{failing: "/bin/dlog"}
+	if err := collectTriageBundle(context.Background(), c, outputs, "triage", "snapshot.zip"); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.commands) != len(triageCommands) {
+		t.Errorf("ran %d commands, want %d", len(c.commands), len(triageCommands))
+	}
+
+	b, err := os.ReadFile(filepath.Join(outDir, "triage", TriageIndexFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index TriageIndex
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	want := TriageIndex{
+		FailedTests: []string{"a"},
+		Snapshot:    filepath.Join("..", "snapshot.zip"),
+	}
+	for _, tc := range triageCommands {
+		artifact := TriageArtifact{Name: tc.name, File: tc.filename}
+		if tc.command[0] == c.failing {
+			artifact.Error = tc.command[0] + ": not found"
+		}
+		want.Artifacts = append(want.Artifacts, artifact)
+	}
+	if diff := cmp.Diff(want, index); diff != "" {
+		t.Errorf("Diff in triage index (-want +got):\n%s", diff)
+	}
+
+	for _, artifact := range index.Artifacts {
+		if artifact.Error != "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(outDir, "triage", artifact.File)); err != nil {
+			t.Errorf("artifact %s was not written: %s", artifact.Name, err)
+		}
+	}
+}